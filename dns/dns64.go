@@ -0,0 +1,167 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport/nat64"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ipv4OnlyName is the name used to discover the NAT64 prefix, as per RFC 7050.
+const ipv4OnlyName = "ipv4only.arpa."
+
+// The well-known IPv4 addresses of [ipv4OnlyName].
+var ipv4OnlyAddrs = []netip.Addr{netip.MustParseAddr("192.0.0.170"), netip.MustParseAddr("192.0.0.171")}
+
+// mappedIPv4Prefix is the prefix of IPv4-mapped IPv6 addresses, which DNS64 ignores in AAAA answers by default.
+var mappedIPv4Prefix = netip.MustParsePrefix("::ffff:0:0/96")
+
+// NewDNS64Resolver creates a [Resolver] that synthesizes AAAA records for names that only have A records, by
+// embedding their IPv4 addresses in the NAT64 prefix, as per [RFC 6147]. This lets clients on IPv6-only networks
+// reach IPv4-only destinations through a NAT64 translator, like the one from [nat64.NewExtractingStreamDialer].
+//
+// Only AAAA questions are affected. If the AAAA query fails or the name doesn't exist, the response is returned
+// unchanged.
+//
+// [RFC 6147]: https://datatracker.ietf.org/doc/html/rfc6147
+func NewDNS64Resolver(resolver Resolver, prefix netip.Prefix) (Resolver, error) {
+	if resolver == nil {
+		return nil, errors.New("argument resolver must not be nil")
+	}
+	if err := nat64.ValidatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	return FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		response, err := resolver.Query(ctx, q)
+		if err != nil || q.Type != dnsmessage.TypeAAAA || q.Class != dnsmessage.ClassINET ||
+			response.RCode != dnsmessage.RCodeSuccess || hasUsableAAAA(response) {
+			return response, err
+		}
+		aQuestion := q
+		aQuestion.Type = dnsmessage.TypeA
+		aResponse, err := resolver.Query(ctx, aQuestion)
+		if err != nil || aResponse.RCode != dnsmessage.RCodeSuccess {
+			return response, nil
+		}
+		if synthesized := synthesizeAAAA(q, aResponse, prefix); synthesized != nil {
+			return synthesized, nil
+		}
+		return response, nil
+	}), nil
+}
+
+// hasUsableAAAA returns whether the response has AAAA answers outside of the IPv4-mapped prefix.
+func hasUsableAAAA(response *dnsmessage.Message) bool {
+	for _, answer := range response.Answers {
+		if aaaa, ok := answer.Body.(*dnsmessage.AAAAResource); ok && !mappedIPv4Prefix.Contains(netip.AddrFrom16(aaaa.AAAA)) {
+			return true
+		}
+	}
+	return false
+}
+
+// synthesizeAAAA creates the response to the AAAA question from the response to the A question, or returns nil
+// if there are no A answers. CNAME answers are kept, so clients see the same chain.
+func synthesizeAAAA(q dnsmessage.Question, aResponse *dnsmessage.Message, prefix netip.Prefix) *dnsmessage.Message {
+	msg := &dnsmessage.Message{
+		Header:    aResponse.Header,
+		Questions: []dnsmessage.Question{q},
+	}
+	hasA := false
+	for _, answer := range aResponse.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.CNAMEResource:
+			msg.Answers = append(msg.Answers, answer)
+		case *dnsmessage.AResource:
+			ipv6, err := nat64.Synthesize(prefix, netip.AddrFrom4(body.A))
+			if err != nil {
+				continue
+			}
+			header := answer.Header
+			header.Type = dnsmessage.TypeAAAA
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: ipv6.As16()}})
+			hasA = true
+		}
+	}
+	if !hasA {
+		return nil
+	}
+	return msg
+}
+
+// DiscoverNAT64Prefixes returns the NAT64 prefixes of the network of the resolver, as per [RFC 7050]. It resolves
+// the AAAA records of "ipv4only.arpa", which DNS64 resolvers synthesize from its well-known IPv4 addresses, and
+// finds the prefixes that embed them. It returns no prefixes if the network has no DNS64 resolver.
+//
+// [RFC 7050]: https://datatracker.ietf.org/doc/html/rfc7050
+func DiscoverNAT64Prefixes(ctx context.Context, resolver Resolver) ([]netip.Prefix, error) {
+	q, err := NewQuestion(ipv4OnlyName, dnsmessage.TypeAAAA)
+	if err != nil {
+		return nil, err
+	}
+	response, err := resolver.Query(ctx, *q)
+	if err != nil {
+		return nil, err
+	}
+	var prefixes []netip.Prefix
+	for _, answer := range response.Answers {
+		aaaa, ok := answer.Body.(*dnsmessage.AAAAResource)
+		if !ok {
+			continue
+		}
+		prefix, ok := nat64PrefixOf(netip.AddrFrom16(aaaa.AAAA))
+		if !ok {
+			continue
+		}
+		if !containsPrefix(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes, nil
+}
+
+// nat64PrefixOf returns the NAT64 prefix of an address synthesized for [ipv4OnlyName].
+func nat64PrefixOf(ipv6 netip.Addr) (netip.Prefix, bool) {
+	// Try the longest prefix first, since it's the most common one.
+	for _, bits := range []int{96, 64, 56, 48, 40, 32} {
+		prefix, err := ipv6.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		ipv4, ok := nat64.Extract(prefix, ipv6)
+		if !ok {
+			continue
+		}
+		for _, known := range ipv4OnlyAddrs {
+			if ipv4 == known {
+				return prefix, true
+			}
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+func containsPrefix(prefixes []netip.Prefix, prefix netip.Prefix) bool {
+	for _, p := range prefixes {
+		if p == prefix {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newZoneResolver returns a resolver that answers from the given records, keyed by name and type.
+func newZoneResolver(records map[dnsmessage.Question][]dnsmessage.Resource) Resolver {
+	return FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		return &dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RecursionAvailable: true},
+			Questions: []dnsmessage.Question{q},
+			Answers:   records[q],
+		}, nil
+	})
+}
+
+func mustQuestion(t *testing.T, name string, qtype dnsmessage.Type) dnsmessage.Question {
+	q, err := NewQuestion(name, qtype)
+	require.NoError(t, err)
+	return *q
+}
+
+func newAResource(q dnsmessage.Question, ttl uint32, ip string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AResource{A: netip.MustParseAddr(ip).As4()},
+	}
+}
+
+func newAAAAResource(q dnsmessage.Question, ttl uint32, ip string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr(ip).As16()},
+	}
+}
+
+var testNAT64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+func TestDNS64Resolver_Synthesizes(t *testing.T) {
+	qA := mustQuestion(t, "v4only.example", dnsmessage.TypeA)
+	qAAAA := mustQuestion(t, "v4only.example", dnsmessage.TypeAAAA)
+	target := mustQuestion(t, "target.example", dnsmessage.TypeA)
+	cname := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: qA.Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 600},
+		Body:   &dnsmessage.CNAMEResource{CNAME: target.Name},
+	}
+	resolver, err := NewDNS64Resolver(newZoneResolver(map[dnsmessage.Question][]dnsmessage.Resource{
+		qA: {cname, newAResource(target, 300, "192.0.2.33")},
+	}), testNAT64Prefix)
+	require.NoError(t, err)
+
+	msg, err := resolver.Query(context.Background(), qAAAA)
+	require.NoError(t, err)
+	require.Equal(t, []dnsmessage.Question{qAAAA}, msg.Questions)
+	require.Len(t, msg.Answers, 2)
+	require.Equal(t, cname, msg.Answers[0])
+	require.Equal(t, newAAAAResource(target, 300, "64:ff9b::192.0.2.33"), msg.Answers[1])
+
+	// A questions are not affected.
+	msg, err = resolver.Query(context.Background(), qA)
+	require.NoError(t, err)
+	require.Len(t, msg.Answers, 2)
+	require.Equal(t, dnsmessage.TypeA, msg.Answers[1].Header.Type)
+}
+
+func TestDNS64Resolver_KeepsNativeAAAA(t *testing.T) {
+	qA := mustQuestion(t, "dual.example", dnsmessage.TypeA)
+	qAAAA := mustQuestion(t, "dual.example", dnsmessage.TypeAAAA)
+	resolver, err := NewDNS64Resolver(newZoneResolver(map[dnsmessage.Question][]dnsmessage.Resource{
+		qA:    {newAResource(qA, 300, "192.0.2.33")},
+		qAAAA: {newAAAAResource(qAAAA, 300, "2001:db8::1")},
+	}), testNAT64Prefix)
+	require.NoError(t, err)
+
+	msg, err := resolver.Query(context.Background(), qAAAA)
+	require.NoError(t, err)
+	require.Equal(t, []dnsmessage.Resource{newAAAAResource(qAAAA, 300, "2001:db8::1")}, msg.Answers)
+}
+
+func TestDNS64Resolver_IgnoresMappedAAAA(t *testing.T) {
+	qA := mustQuestion(t, "mapped.example", dnsmessage.TypeA)
+	qAAAA := mustQuestion(t, "mapped.example", dnsmessage.TypeAAAA)
+	resolver, err := NewDNS64Resolver(newZoneResolver(map[dnsmessage.Question][]dnsmessage.Resource{
+		qA:    {newAResource(qA, 300, "192.0.2.33")},
+		qAAAA: {newAAAAResource(qAAAA, 300, "::ffff:192.0.2.33")},
+	}), testNAT64Prefix)
+	require.NoError(t, err)
+
+	msg, err := resolver.Query(context.Background(), qAAAA)
+	require.NoError(t, err)
+	require.Equal(t, []dnsmessage.Resource{newAAAAResource(qAAAA, 300, "64:ff9b::192.0.2.33")}, msg.Answers)
+}
+
+func TestDNS64Resolver_NoRecords(t *testing.T) {
+	qAAAA := mustQuestion(t, "empty.example", dnsmessage.TypeAAAA)
+	resolver, err := NewDNS64Resolver(newZoneResolver(nil), testNAT64Prefix)
+	require.NoError(t, err)
+
+	msg, err := resolver.Query(context.Background(), qAAAA)
+	require.NoError(t, err)
+	require.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+	require.Empty(t, msg.Answers)
+}
+
+func TestDNS64Resolver_NameError(t *testing.T) {
+	queried := 0
+	resolver, err := NewDNS64Resolver(FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		queried++
+		return NewNameErrorResponse(q), nil
+	}), testNAT64Prefix)
+	require.NoError(t, err)
+
+	msg, err := resolver.Query(context.Background(), mustQuestion(t, "missing.example", dnsmessage.TypeAAAA))
+	require.NoError(t, err)
+	require.Equal(t, dnsmessage.RCodeNameError, msg.RCode)
+	require.Equal(t, 1, queried)
+}
+
+func TestDNS64Resolver_AQueryFails(t *testing.T) {
+	qAAAA := mustQuestion(t, "v4only.example", dnsmessage.TypeAAAA)
+	resolver, err := NewDNS64Resolver(FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		if q.Type == dnsmessage.TypeA {
+			return nil, errors.New("failed")
+		}
+		return &dnsmessage.Message{Header: dnsmessage.Header{Response: true}, Questions: []dnsmessage.Question{q}}, nil
+	}), testNAT64Prefix)
+	require.NoError(t, err)
+
+	msg, err := resolver.Query(context.Background(), qAAAA)
+	require.NoError(t, err)
+	require.Empty(t, msg.Answers)
+}
+
+func TestNewDNS64Resolver_Invalid(t *testing.T) {
+	_, err := NewDNS64Resolver(nil, testNAT64Prefix)
+	require.Error(t, err)
+	_, err = NewDNS64Resolver(newZoneResolver(nil), netip.MustParsePrefix("2001:db8::/33"))
+	require.Error(t, err)
+}
+
+func TestDiscoverNAT64Prefixes(t *testing.T) {
+	q := mustQuestion(t, "ipv4only.arpa", dnsmessage.TypeAAAA)
+	resolver := newZoneResolver(map[dnsmessage.Question][]dnsmessage.Resource{q: {
+		newAAAAResource(q, 300, "64:ff9b::192.0.0.170"),
+		newAAAAResource(q, 300, "64:ff9b::192.0.0.171"),
+		newAAAAResource(q, 300, "2001:db8:122:344:c0:0:aa00:0"),
+		newAAAAResource(q, 300, "2001:db8::1"),
+	}})
+
+	prefixes, err := DiscoverNAT64Prefixes(context.Background(), resolver)
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("64:ff9b::/96"),
+		netip.MustParsePrefix("2001:db8:122:344::/64"),
+	}, prefixes)
+}
+
+func TestDiscoverNAT64Prefixes_NoDNS64(t *testing.T) {
+	prefixes, err := DiscoverNAT64Prefixes(context.Background(), newZoneResolver(nil))
+	require.NoError(t, err)
+	require.Empty(t, prefixes)
+}
@@ -38,6 +38,26 @@ Typically you will want to use custom DNS resolution to establish connections to
 and the given dialer to establish connections. The dialer efficiently performs resolutions and connection attempts
 in parallel, as per the [Happy Eyeballs v2] algorithm.
 
+# Hooks and special-use names
+
+[NewHookResolver] runs [QueryHook] implementations around the queries of a resolver, to observe them, for instance
+to keep a query log, and to veto them, for instance to block ads and trackers with [NewBlocklistHook]:
+
+	resolver, err := dns.NewHookResolver(resolver, dns.NewBlocklistHook("ads.example.com"), &dns.QueryHookFuncs{
+		After: func(ctx context.Context, q dnsmessage.Question, result *dns.QueryResult) {
+			log.Printf("%v %v took %v, vetoed: %v, error: %v", q.Type, q.Name, result.Duration, result.Vetoed, result.Err)
+		},
+	})
+
+[NewSpecialUseResolver] answers the queries for special-use names, like "localhost" and "printer.local", without
+sending them to the global resolver. See [SpecialUseOf].
+
+# IPv6-only networks
+
+[NewDNS64Resolver] synthesizes AAAA records for IPv4-only names in a NAT64 prefix, so clients on IPv6-only networks
+can reach them through a NAT64 translator, like the ones in [transport/nat64] and [network.NewNAT64PacketProxy].
+[DiscoverNAT64Prefixes] finds the NAT64 prefixes of the current network, to reach IPv4-only servers from it.
+
 [Domain Name System]: https://datatracker.ietf.org/doc/html/rfc1034
 [commonly used for network-level filtering]: https://datatracker.ietf.org/doc/html/rfc9505#section-5.1.1
 [DNS-over-UDP]: https://datatracker.ietf.org/doc/html/rfc1035#section-4.2.1
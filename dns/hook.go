@@ -0,0 +1,127 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// QueryResult is the outcome of a query of a resolver created by [NewHookResolver].
+type QueryResult struct {
+	// Response is the response, or nil if the query failed.
+	Response *dnsmessage.Message
+	// Err is the error of the query, or nil if it succeeded.
+	Err error
+	// Vetoed is true if a hook answered the query, so it was not sent to the resolver.
+	Vetoed bool
+	// Duration is how long the query took.
+	Duration time.Duration
+}
+
+// QueryHook observes and vetoes the queries of a resolver created by [NewHookResolver], to implement features
+// like query logs and content filtering.
+type QueryHook interface {
+	// BeforeQuery is called before the question is sent to the resolver. To veto the query, it returns the
+	// response to use instead, like one from [NewNameErrorResponse], or an error to fail the query.
+	// It returns nil and nil to let the query through.
+	BeforeQuery(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error)
+	// AfterQuery is called with the result of each query, including the vetoed and failed ones.
+	AfterQuery(ctx context.Context, q dnsmessage.Question, result *QueryResult)
+}
+
+// QueryHookFuncs is a [QueryHook] made of functions. Nil functions are skipped.
+type QueryHookFuncs struct {
+	Before func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error)
+	After  func(ctx context.Context, q dnsmessage.Question, result *QueryResult)
+}
+
+var _ QueryHook = (*QueryHookFuncs)(nil)
+
+// BeforeQuery implements [QueryHook].
+func (h *QueryHookFuncs) BeforeQuery(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	if h.Before == nil {
+		return nil, nil
+	}
+	return h.Before(ctx, q)
+}
+
+// AfterQuery implements [QueryHook].
+func (h *QueryHookFuncs) AfterQuery(ctx context.Context, q dnsmessage.Question, result *QueryResult) {
+	if h.After != nil {
+		h.After(ctx, q, result)
+	}
+}
+
+// NewHookResolver creates a [Resolver] that runs the hooks around the queries to resolver.
+// The BeforeQuery methods are called in order, until one vetoes the query. The AfterQuery methods of all
+// the hooks are called in order.
+func NewHookResolver(resolver Resolver, hooks ...QueryHook) (Resolver, error) {
+	if resolver == nil {
+		return nil, errors.New("argument resolver must not be nil")
+	}
+	for _, hook := range hooks {
+		if hook == nil {
+			return nil, errors.New("hooks must not be nil")
+		}
+	}
+	return FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		start := time.Now()
+		result := &QueryResult{}
+		for _, hook := range hooks {
+			result.Response, result.Err = hook.BeforeQuery(ctx, q)
+			if result.Response != nil || result.Err != nil {
+				result.Vetoed = true
+				break
+			}
+		}
+		if !result.Vetoed {
+			result.Response, result.Err = resolver.Query(ctx, q)
+		}
+		result.Duration = time.Since(start)
+		for _, hook := range hooks {
+			hook.AfterQuery(ctx, q, result)
+		}
+		return result.Response, result.Err
+	}), nil
+}
+
+// NewBlocklistHook creates a [QueryHook] that answers the questions for the given domains and their subdomains
+// with a name error (NXDOMAIN), for instance to block ads and trackers. The domains are case-insensitive, and may
+// have the final dot.
+func NewBlocklistHook(domains ...string) QueryHook {
+	blocked := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		blocked[strings.ToLower(strings.TrimSuffix(domain, "."))] = struct{}{}
+	}
+	return &QueryHookFuncs{Before: func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		name := strings.ToLower(strings.TrimSuffix(q.Name.String(), "."))
+		// Check the name and its parent domains.
+		for {
+			if _, ok := blocked[name]; ok {
+				return NewNameErrorResponse(q), nil
+			}
+			dot := strings.IndexByte(name, '.')
+			if dot < 0 {
+				return nil, nil
+			}
+			name = name[dot+1:]
+		}
+	}}
+}
@@ -0,0 +1,105 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHookResolver_Blocklist(t *testing.T) {
+	queried := []string{}
+	resolver := FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		queried = append(queried, q.Name.String())
+		return &dnsmessage.Message{Header: dnsmessage.Header{Response: true}, Questions: []dnsmessage.Question{q}}, nil
+	})
+	var results []*QueryResult
+	logHook := &QueryHookFuncs{After: func(ctx context.Context, q dnsmessage.Question, result *QueryResult) {
+		results = append(results, result)
+	}}
+	hooked, err := NewHookResolver(resolver, NewBlocklistHook("Ads.Example.com.", "tracker"), logHook)
+	require.NoError(t, err)
+
+	for _, name := range []string{"ads.example.com", "x.ADS.example.com", "tracker", "a.b.tracker"} {
+		q, err := NewQuestion(name, dnsmessage.TypeA)
+		require.NoError(t, err)
+		msg, err := hooked.Query(context.Background(), *q)
+		require.NoError(t, err)
+		require.Equal(t, dnsmessage.RCodeNameError, msg.RCode, name)
+	}
+	for _, name := range []string{"example.com", "notads.example.com", "tracker.com"} {
+		q, err := NewQuestion(name, dnsmessage.TypeA)
+		require.NoError(t, err)
+		msg, err := hooked.Query(context.Background(), *q)
+		require.NoError(t, err)
+		require.Equal(t, dnsmessage.RCodeSuccess, msg.RCode, name)
+	}
+	require.Equal(t, []string{"example.com.", "notads.example.com.", "tracker.com."}, queried)
+	require.Len(t, results, 7)
+	require.True(t, results[0].Vetoed)
+	require.False(t, results[6].Vetoed)
+	require.NotNil(t, results[6].Response)
+}
+
+func TestHookResolver_Errors(t *testing.T) {
+	errResolver := errors.New("resolver failed")
+	errHook := errors.New("hook failed")
+	resolver := FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		return nil, errResolver
+	})
+	var results []*QueryResult
+	hook := &QueryHookFuncs{
+		Before: func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+			if q.Name.String() == "fail." {
+				return nil, errHook
+			}
+			return nil, nil
+		},
+		After: func(ctx context.Context, q dnsmessage.Question, result *QueryResult) {
+			results = append(results, result)
+		},
+	}
+	hooked, err := NewHookResolver(resolver, hook)
+	require.NoError(t, err)
+
+	q, err := NewQuestion("fail", dnsmessage.TypeA)
+	require.NoError(t, err)
+	_, err = hooked.Query(context.Background(), *q)
+	require.ErrorIs(t, err, errHook)
+	q, err = NewQuestion("example.com", dnsmessage.TypeA)
+	require.NoError(t, err)
+	_, err = hooked.Query(context.Background(), *q)
+	require.ErrorIs(t, err, errResolver)
+
+	require.Len(t, results, 2)
+	require.True(t, results[0].Vetoed)
+	require.ErrorIs(t, results[0].Err, errHook)
+	require.False(t, results[1].Vetoed)
+	require.ErrorIs(t, results[1].Err, errResolver)
+}
+
+func TestNewHookResolver_Invalid(t *testing.T) {
+	_, err := NewHookResolver(nil)
+	require.Error(t, err)
+	_, err = NewHookResolver(FuncResolver(nil), nil)
+	require.Error(t, err)
+	// Empty hooks are allowed.
+	_, err = NewHookResolver(FuncResolver(nil), &QueryHookFuncs{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// NewHostResolver creates a [transport.HostResolver] that resolves host names with the given [Resolver], so that
+// a [transport.ResolutionPolicy] can use it for the endpoints. For the "ip" network, it queries the AAAA and A
+// records in parallel and returns the IPv6 addresses first. The TTL is the lowest TTL of the answers, so cached
+// addresses expire when the DNS records do.
+func NewHostResolver(resolver Resolver) transport.HostResolver {
+	return transport.FuncHostResolver(func(ctx context.Context, network string, host string) ([]netip.Addr, time.Duration, error) {
+		var qtypes []dnsmessage.Type
+		switch network {
+		case "ip":
+			qtypes = []dnsmessage.Type{dnsmessage.TypeAAAA, dnsmessage.TypeA}
+		case "ip4":
+			qtypes = []dnsmessage.Type{dnsmessage.TypeA}
+		case "ip6":
+			qtypes = []dnsmessage.Type{dnsmessage.TypeAAAA}
+		default:
+			return nil, 0, &nestedError{ErrBadRequest, fmt.Errorf("unsupported network %v", network)}
+		}
+		type lookupResult struct {
+			ips []netip.Addr
+			ttl time.Duration
+			err error
+		}
+		results := make([]chan lookupResult, len(qtypes))
+		for i, qtype := range qtypes {
+			results[i] = make(chan lookupResult, 1)
+			go func(qtype dnsmessage.Type, resultCh chan<- lookupResult) {
+				ips, ttl, err := lookupIPs(ctx, resolver, host, qtype)
+				resultCh <- lookupResult{ips, ttl, err}
+			}(qtype, results[i])
+		}
+
+		var ips []netip.Addr
+		var ttl time.Duration
+		var errs []error
+		for _, resultCh := range results {
+			result := <-resultCh
+			if result.err != nil {
+				errs = append(errs, result.err)
+				continue
+			}
+			ips = append(ips, result.ips...)
+			if len(result.ips) > 0 && (ttl == 0 || result.ttl < ttl) {
+				ttl = result.ttl
+			}
+		}
+		if len(ips) == 0 && len(errs) > 0 {
+			return nil, 0, errors.Join(errs...)
+		}
+		return ips, ttl, nil
+	})
+}
+
+// lookupIPs queries the addresses of the given type for host, and returns them with the lowest TTL of the answers.
+func lookupIPs(ctx context.Context, resolver Resolver, host string, qtype dnsmessage.Type) ([]netip.Addr, time.Duration, error) {
+	q, err := NewQuestion(host, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+	response, err := resolver.Query(ctx, *q)
+	if err != nil {
+		return nil, 0, err
+	}
+	if response.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, &nestedError{ErrBadResponse, fmt.Errorf("got %v response for %v", response.RCode, q.Name)}
+	}
+	var ips []netip.Addr
+	var minTTL uint32
+	for i, answer := range response.Answers {
+		if i == 0 || answer.Header.TTL < minTTL {
+			minTTL = answer.Header.TTL
+		}
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, netip.AddrFrom4(body.A))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, netip.AddrFrom16(body.AAAA))
+		}
+	}
+	return ips, time.Duration(minTTL) * time.Second, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHostResolver_DualStack(t *testing.T) {
+	qA := mustQuestion(t, "dual.example", dnsmessage.TypeA)
+	qAAAA := mustQuestion(t, "dual.example", dnsmessage.TypeAAAA)
+	resolver := NewHostResolver(newZoneResolver(map[dnsmessage.Question][]dnsmessage.Resource{
+		qA:    {newAResource(qA, 300, "192.0.2.33")},
+		qAAAA: {newAAAAResource(qAAAA, 60, "2001:db8::1")},
+	}))
+
+	ips, ttl, err := resolver.ResolveHost(context.Background(), "ip", "dual.example")
+	require.NoError(t, err)
+	require.Equal(t, []netip.Addr{netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("192.0.2.33")}, ips)
+	require.Equal(t, 60*time.Second, ttl)
+
+	ips, ttl, err = resolver.ResolveHost(context.Background(), "ip4", "dual.example")
+	require.NoError(t, err)
+	require.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.33")}, ips)
+	require.Equal(t, 300*time.Second, ttl)
+}
+
+func TestHostResolver_CNAMETTL(t *testing.T) {
+	qA := mustQuestion(t, "alias.example", dnsmessage.TypeA)
+	target := mustQuestion(t, "target.example", dnsmessage.TypeA)
+	cname := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: qA.Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 30},
+		Body:   &dnsmessage.CNAMEResource{CNAME: target.Name},
+	}
+	resolver := NewHostResolver(newZoneResolver(map[dnsmessage.Question][]dnsmessage.Resource{
+		qA: {cname, newAResource(target, 300, "192.0.2.33")},
+	}))
+	ips, ttl, err := resolver.ResolveHost(context.Background(), "ip4", "alias.example")
+	require.NoError(t, err)
+	require.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.33")}, ips)
+	require.Equal(t, 30*time.Second, ttl)
+}
+
+func TestHostResolver_PartialFailure(t *testing.T) {
+	qA := mustQuestion(t, "v4only.example", dnsmessage.TypeA)
+	resolver := NewHostResolver(FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		if q.Type == dnsmessage.TypeAAAA {
+			return nil, errors.New("timeout")
+		}
+		return &dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true},
+			Questions: []dnsmessage.Question{q},
+			Answers:   []dnsmessage.Resource{newAResource(qA, 300, "192.0.2.33")},
+		}, nil
+	}))
+	ips, _, err := resolver.ResolveHost(context.Background(), "ip", "v4only.example")
+	require.NoError(t, err)
+	require.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.33")}, ips)
+
+	_, _, err = resolver.ResolveHost(context.Background(), "ip6", "v4only.example")
+	require.Error(t, err)
+}
+
+func TestHostResolver_ErrorRCode(t *testing.T) {
+	resolver := NewHostResolver(FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		return &dnsmessage.Message{Header: dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeNameError}}, nil
+	}))
+	_, _, err := resolver.ResolveHost(context.Background(), "ip", "missing.example")
+	require.ErrorIs(t, err, ErrBadResponse)
+}
+
+func TestHostResolver_BadNetwork(t *testing.T) {
+	_, _, err := NewHostResolver(newZoneResolver(nil)).ResolveHost(context.Background(), "udp", "example.com")
+	require.ErrorIs(t, err, ErrBadRequest)
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// SpecialUse is how names in a special-use domain must be resolved, as per [RFC 6761].
+//
+// [RFC 6761]: https://datatracker.ietf.org/doc/html/rfc6761
+type SpecialUse int
+
+const (
+	// SpecialUseNone is for regular names, resolved with the global DNS.
+	SpecialUseNone SpecialUse = iota
+	// SpecialUseLoopback is for "localhost" and its subdomains, which resolve to the loopback addresses.
+	SpecialUseLoopback
+	// SpecialUseNonexistent is for names that never exist in the DNS, like "invalid", "test", "alt" and "onion".
+	SpecialUseNonexistent
+	// SpecialUseLocal is for names that only exist on the local network: "local" ([RFC 6762]), "home.arpa"
+	// ([RFC 8375]), "internal", and the reverse zones of private, loopback and link-local addresses ([RFC 6303]).
+	// Sending them to a global resolver leaks local names and returns no useful answers.
+	//
+	// [RFC 6762]: https://datatracker.ietf.org/doc/html/rfc6762
+	// [RFC 8375]: https://datatracker.ietf.org/doc/html/rfc8375
+	// [RFC 6303]: https://datatracker.ietf.org/doc/html/rfc6303
+	SpecialUseLocal
+)
+
+func (u SpecialUse) String() string {
+	switch u {
+	case SpecialUseNone:
+		return "none"
+	case SpecialUseLoopback:
+		return "loopback"
+	case SpecialUseNonexistent:
+		return "nonexistent"
+	case SpecialUseLocal:
+		return "local"
+	default:
+		return "SpecialUse(" + strconv.Itoa(int(u)) + ")"
+	}
+}
+
+var (
+	nonexistentDomains = []string{"invalid", "test", "alt", "onion"}
+	localDomains       = []string{"local", "home.arpa", "internal"}
+	// localPrefixes are the address ranges of the locally served reverse zones.
+	localPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("100.64.0.0/10"),
+		netip.MustParsePrefix("127.0.0.0/8"),
+		netip.MustParsePrefix("169.254.0.0/16"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+		netip.MustParsePrefix("192.168.0.0/16"),
+		netip.MustParsePrefix("::/127"),
+		netip.MustParsePrefix("fc00::/7"),
+		netip.MustParsePrefix("fe80::/10"),
+	}
+)
+
+// inDomain returns whether name, in lower case and without the final dot, is domain or a subdomain of it.
+func inDomain(name string, domain string) bool {
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// SpecialUseOf returns how the name must be resolved. The name is case-insensitive, and may have the final dot.
+func SpecialUseOf(name string) SpecialUse {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if inDomain(name, "localhost") {
+		return SpecialUseLoopback
+	}
+	for _, domain := range nonexistentDomains {
+		if inDomain(name, domain) {
+			return SpecialUseNonexistent
+		}
+	}
+	for _, domain := range localDomains {
+		if inDomain(name, domain) {
+			return SpecialUseLocal
+		}
+	}
+	if prefix, ok := reversePrefix(name); ok {
+		for _, local := range localPrefixes {
+			if local.Bits() <= prefix.Bits() && local.Contains(prefix.Addr()) {
+				return SpecialUseLocal
+			}
+		}
+	}
+	return SpecialUseNone
+}
+
+// reversePrefix returns the address prefix of a reverse name under "in-addr.arpa" or "ip6.arpa". The prefix is
+// shorter than a full address for the names of zones, like "168.192.in-addr.arpa".
+func reversePrefix(name string) (netip.Prefix, bool) {
+	if labels, ok := strings.CutSuffix(name, ".in-addr.arpa"); ok {
+		octets := strings.Split(labels, ".")
+		if len(octets) > 4 {
+			return netip.Prefix{}, false
+		}
+		var ip [4]byte
+		for i, octet := range octets {
+			value, err := strconv.ParseUint(octet, 10, 8)
+			if err != nil {
+				return netip.Prefix{}, false
+			}
+			ip[len(octets)-1-i] = byte(value)
+		}
+		return netip.PrefixFrom(netip.AddrFrom4(ip), 8*len(octets)), true
+	}
+	if labels, ok := strings.CutSuffix(name, ".ip6.arpa"); ok {
+		nibbles := strings.Split(labels, ".")
+		if len(nibbles) > 32 {
+			return netip.Prefix{}, false
+		}
+		var ip [16]byte
+		for i, nibble := range nibbles {
+			value, err := strconv.ParseUint(nibble, 16, 4)
+			if err != nil || len(nibble) != 1 {
+				return netip.Prefix{}, false
+			}
+			position := len(nibbles) - 1 - i
+			if position%2 == 0 {
+				ip[position/2] |= byte(value) << 4
+			} else {
+				ip[position/2] |= byte(value)
+			}
+		}
+		return netip.PrefixFrom(netip.AddrFrom16(ip), 4*len(nibbles)), true
+	}
+	return netip.Prefix{}, false
+}
+
+// loopbackTTL is the TTL of the loopback answers, in seconds. They never change.
+const loopbackTTL = 86400
+
+// NewSpecialUseResolver creates a [Resolver] that handles the special-use names locally, and sends the other
+// questions to the global resolver:
+//
+//   - [SpecialUseLoopback] names get the loopback addresses.
+//   - [SpecialUseNonexistent] names get a name error (NXDOMAIN).
+//   - [SpecialUseLocal] names are sent to the local resolver, usually the resolver of the local network reached
+//     outside of any tunnel. If local is nil, they get a name error.
+func NewSpecialUseResolver(global Resolver, local Resolver) (Resolver, error) {
+	if global == nil {
+		return nil, errors.New("argument global must not be nil")
+	}
+	return FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		switch SpecialUseOf(q.Name.String()) {
+		case SpecialUseLoopback:
+			return newLoopbackResponse(q), nil
+		case SpecialUseNonexistent:
+			return NewNameErrorResponse(q), nil
+		case SpecialUseLocal:
+			if local == nil {
+				return NewNameErrorResponse(q), nil
+			}
+			return local.Query(ctx, q)
+		default:
+			return global.Query(ctx, q)
+		}
+	}), nil
+}
+
+// NewNameErrorResponse creates a response to the question that says the name doesn't exist (NXDOMAIN).
+func NewNameErrorResponse(q dnsmessage.Question) *dnsmessage.Message {
+	return &dnsmessage.Message{
+		Header:    dnsmessage.Header{Response: true, RecursionAvailable: true, RCode: dnsmessage.RCodeNameError},
+		Questions: []dnsmessage.Question{q},
+	}
+}
+
+// newLoopbackResponse answers A and AAAA questions with the loopback address. Other types get an empty answer.
+func newLoopbackResponse(q dnsmessage.Question) *dnsmessage.Message {
+	msg := &dnsmessage.Message{
+		Header:    dnsmessage.Header{Response: true, Authoritative: true, RecursionAvailable: true},
+		Questions: []dnsmessage.Question{q},
+	}
+	resourceHeader := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: loopbackTTL}
+	switch q.Type {
+	case dnsmessage.TypeA:
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: resourceHeader, Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}})
+	case dnsmessage.TypeAAAA:
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: resourceHeader, Body: &dnsmessage.AAAAResource{AAAA: netip.IPv6Loopback().As16()}})
+	}
+	return msg
+}
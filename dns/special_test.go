@@ -0,0 +1,118 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestSpecialUseOf(t *testing.T) {
+	for name, expected := range map[string]SpecialUse{
+		"example.com.":               SpecialUseNone,
+		"localhost":                  SpecialUseLoopback,
+		"LocalHost.":                 SpecialUseLoopback,
+		"app.localhost.":             SpecialUseLoopback,
+		"notlocalhost.":              SpecialUseNone,
+		"foo.invalid.":               SpecialUseNonexistent,
+		"test.":                      SpecialUseNonexistent,
+		"abc.onion.":                 SpecialUseNonexistent,
+		"printer.local.":             SpecialUseLocal,
+		"router.home.arpa.":          SpecialUseLocal,
+		"arpa.":                      SpecialUseNone,
+		"1.1.168.192.in-addr.arpa.":  SpecialUseLocal,
+		"168.192.in-addr.arpa.":      SpecialUseLocal,
+		"192.in-addr.arpa.":          SpecialUseNone,
+		"1.0.16.172.in-addr.arpa.":   SpecialUseLocal,
+		"1.0.32.172.in-addr.arpa.":   SpecialUseNone,
+		"172.in-addr.arpa.":          SpecialUseNone,
+		"4.4.8.8.in-addr.arpa.":      SpecialUseNone,
+		"1.0.0.127.in-addr.arpa.":    SpecialUseLocal,
+		"5.100.64.100.in-addr.arpa.": SpecialUseLocal,
+		"x.168.192.in-addr.arpa.":    SpecialUseNone,
+		"1.2.3.4.5.in-addr.arpa.":    SpecialUseNone,
+		"d.f.ip6.arpa.":              SpecialUseLocal,
+		"c.f.ip6.arpa.":              SpecialUseLocal,
+		"b.f.ip6.arpa.":              SpecialUseNone,
+		"8.e.f.ip6.arpa.":            SpecialUseLocal,
+		"c.e.f.ip6.arpa.":            SpecialUseNone,
+		"f.ip6.arpa.":                SpecialUseNone,
+		"8.8.8.8.8.8.0.0.0.0.6.8.4.0.6.2.ip6.arpa.":                                 SpecialUseNone,
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.": SpecialUseLocal,
+	} {
+		require.Equal(t, expected, SpecialUseOf(name), name)
+	}
+}
+
+func TestSpecialUseResolver(t *testing.T) {
+	errGlobal := errors.New("global")
+	errLocal := errors.New("local")
+	global := FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		return nil, errGlobal
+	})
+	local := FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		return nil, errLocal
+	})
+	resolver, err := NewSpecialUseResolver(global, local)
+	require.NoError(t, err)
+	query := func(name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+		q, err := NewQuestion(name, qtype)
+		require.NoError(t, err)
+		return resolver.Query(context.Background(), *q)
+	}
+
+	_, err = query("example.com", dnsmessage.TypeA)
+	require.ErrorIs(t, err, errGlobal)
+	_, err = query("printer.local", dnsmessage.TypeA)
+	require.ErrorIs(t, err, errLocal)
+
+	msg, err := query("localhost", dnsmessage.TypeA)
+	require.NoError(t, err)
+	require.Len(t, msg.Answers, 1)
+	require.Equal(t, &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}, msg.Answers[0].Body)
+	msg, err = query("localhost", dnsmessage.TypeAAAA)
+	require.NoError(t, err)
+	require.Len(t, msg.Answers, 1)
+	require.Equal(t, &dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}}, msg.Answers[0].Body)
+	msg, err = query("localhost", dnsmessage.TypeMX)
+	require.NoError(t, err)
+	require.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+	require.Empty(t, msg.Answers)
+
+	msg, err = query("foo.invalid", dnsmessage.TypeA)
+	require.NoError(t, err)
+	require.Equal(t, dnsmessage.RCodeNameError, msg.RCode)
+	_, err = msg.Pack()
+	require.NoError(t, err)
+}
+
+func TestSpecialUseResolver_NoLocal(t *testing.T) {
+	resolver, err := NewSpecialUseResolver(FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		return nil, errors.New("unexpected")
+	}), nil)
+	require.NoError(t, err)
+	q, err := NewQuestion("1.1.168.192.in-addr.arpa", dnsmessage.TypePTR)
+	require.NoError(t, err)
+	msg, err := resolver.Query(context.Background(), *q)
+	require.NoError(t, err)
+	require.Equal(t, dnsmessage.RCodeNameError, msg.RCode)
+
+	_, err = NewSpecialUseResolver(nil, nil)
+	require.Error(t, err)
+}
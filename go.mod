@@ -11,6 +11,7 @@ require (
 	github.com/things-go/go-socks5 v0.0.5
 	golang.org/x/crypto v0.18.0
 	golang.org/x/net v0.20.0
+	golang.org/x/sys v0.16.0
 )
 
 require (
@@ -33,7 +34,6 @@ require (
 	github.com/xanzy/ssh-agent v0.2.1 // indirect
 	go.opencensus.io v0.23.0 // indirect
 	golang.org/x/mod v0.8.0 // indirect
-	golang.org/x/sys v0.16.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	golang.org/x/tools v0.6.0 // indirect
 	gopkg.in/src-d/go-billy.v4 v4.3.2 // indirect
@@ -30,6 +30,15 @@ To create a [network.PacketProxy] that handles DNS requests locally:
 
 This `proxy` can then be used in, for example, lwip2transport.ConfigureDevice.
 
+Some clients don't retry truncated responses over TCP, so large responses (DNSSEC, HTTPS records) would fail for them.
+Use [NewTCPFallbackPacketProxy] instead to forward the DNS requests over TCP through a StreamDialer, and relay the
+responses back over UDP:
+
+	proxy, err := dnstruncate.NewTCPFallbackPacketProxy(streamDialer)
+	if err != nil {
+		// handle error
+	}
+
 [go-tun2socks' dnsfallback.NewUDPHandler]: https://github.com/eycorsican/go-tun2socks/blob/master/proxy/dnsfallback/udp.go
 */
 package dnstruncate
@@ -138,17 +138,21 @@ func (h *dnsTruncateRequestHandler) WriteTo(p []byte, destination netip.AddrPort
 	// We need to copy p into buf because "WriteTo must not modify p, even temporarily".
 	n := copy(buf, p)
 
+	setTruncated(buf[:n])
+	return h.respWriter.WriteFrom(buf[:n], net.UDPAddrFromAddrPort(destination))
+}
+
+// setTruncated turns the DNS request in msg into a response with the TC (truncated) bit set.
+func setTruncated(msg []byte) {
 	// Set "Response", "Truncated" and "NoError"
 	// Note: gopacket is a good library doing this kind of things. But it will increase the binary size a lot.
 	//       If we decide to use gopacket in the future, please evaluate the binary size and runtime memory consumption.
-	buf[dnsUdpAnswerByte] |= (dnsUdpResponseBit | dnsUdpTruncatedBit)
-	buf[dnsUdpRCodeByte] &= ^dnsUdpRCodeMask
+	msg[dnsUdpAnswerByte] |= (dnsUdpResponseBit | dnsUdpTruncatedBit)
+	msg[dnsUdpRCodeByte] &= ^dnsUdpRCodeMask
 
 	// Copy QDCOUNT to ANCOUNT. This is an incorrect workaround for some DNS clients (such as Windows 7);
 	// because without these clients won't retry over TCP.
 	//
 	// For reference: https://github.com/eycorsican/go-tun2socks/blob/master/proxy/dnsfallback/udp.go#L59-L63
-	copy(buf[dnsARCntStartByte:dnsARCntEndByte+1], buf[dnsQDCntStartByte:dnsQDCntEndByte+1])
-
-	return h.respWriter.WriteFrom(buf[:n], net.UDPAddrFromAddrPort(destination))
+	copy(msg[dnsARCntStartByte:dnsARCntEndByte+1], msg[dnsQDCntStartByte:dnsQDCntEndByte+1])
 }
@@ -0,0 +1,216 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnstruncate
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultTCPFallbackTimeout is the default time limit to forward a DNS request over TCP and receive its response.
+const DefaultTCPFallbackTimeout = 10 * time.Second
+
+const dnsTCPMaxMsgLen = 65535 // The message length is a 16-bit field in DNS over TCP.
+
+// dnsTCPFallbackProxy is a network.PacketProxy that forwards DNS requests over TCP.
+//
+// Multiple goroutines may invoke methods on a dnsTCPFallbackProxy simultaneously.
+type dnsTCPFallbackProxy struct {
+	dialer  transport.StreamDialer
+	timeout time.Duration
+}
+
+// dnsTCPFallbackRequestHandler is a network.PacketRequestSender that sends each DNS request in its own TCP connection,
+// and relays the response back to the caller.
+//
+// Multiple goroutines may invoke methods on a dnsTCPFallbackRequestHandler simultaneously.
+type dnsTCPFallbackRequestHandler struct {
+	proxy      *dnsTCPFallbackProxy
+	ctx        context.Context
+	cancel     context.CancelFunc
+	closed     atomic.Bool
+	mu         sync.RWMutex // Protects respWriter from being closed while writing responses.
+	respWriter network.PacketResponseReceiver
+}
+
+// Compilation guard against interface implementation
+var _ network.PacketProxy = (*dnsTCPFallbackProxy)(nil)
+var _ network.PacketRequestSender = (*dnsTCPFallbackRequestHandler)(nil)
+
+// NewTCPFallbackPacketProxy creates a new [network.PacketProxy] that can be used to handle DNS requests if the remote
+// proxy doesn't support UDP traffic. Unlike [NewPacketProxy], it answers the DNS requests itself, by sending them over
+// TCP with the given [transport.StreamDialer] and relaying the responses, so clients get an answer without having to
+// retry.
+//
+// If the response doesn't fit in the UDP payload size advertised by the client, or the request can't be forwarded over
+// TCP, the client receives a response with the TC (truncated) bit set instead, like with [NewPacketProxy].
+//
+// Note that all other non-DNS UDP packets will be dropped by this [network.PacketProxy].
+func NewTCPFallbackPacketProxy(dialer transport.StreamDialer) (network.PacketProxy, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	return &dnsTCPFallbackProxy{dialer: dialer, timeout: DefaultTCPFallbackTimeout}, nil
+}
+
+// NewSession implements [network.PacketProxy].NewSession(). It creates a new [network.PacketRequestSender] that will
+// forward the DNS requests over TCP and write the responses to `respWriter`.
+func (p *dnsTCPFallbackProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	if respWriter == nil {
+		return nil, errors.New("respWriter is required")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &dnsTCPFallbackRequestHandler{
+		proxy:      p,
+		ctx:        ctx,
+		cancel:     cancel,
+		respWriter: respWriter,
+	}, nil
+}
+
+// Close implements [network.PacketRequestSender].Close(). It cancels the pending requests and closes the
+// corresponding [network.PacketResponseReceiver].
+func (h *dnsTCPFallbackRequestHandler) Close() error {
+	if !h.closed.CompareAndSwap(false, true) {
+		return network.ErrClosed
+	}
+	h.cancel()
+	// Wait for the responses being written.
+	h.mu.Lock()
+	h.mu.Unlock()
+	h.respWriter.Close()
+	return nil
+}
+
+// WriteTo implements [network.PacketRequestSender].WriteTo(). If p is a valid DNS request, it is forwarded over TCP
+// in the background, and the response will be written to the [network.PacketResponseReceiver] passed to NewSession.
+// If it is not a valid DNS request, the packet will be discarded and returns an error.
+func (h *dnsTCPFallbackRequestHandler) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	if h.closed.Load() {
+		return 0, network.ErrClosed
+	}
+	if destination.Port() != standardDNSPort {
+		return 0, fmt.Errorf("UDP traffic to non-DNS port %v is not supported: %w", destination.Port(), network.ErrPortUnreachable)
+	}
+	if len(p) < dnsUdpMinMsgLen {
+		return 0, fmt.Errorf("invalid DNS message of length %v, it must be at least %v bytes", len(p), dnsUdpMinMsgLen)
+	}
+	if len(p) > dnsTCPMaxMsgLen {
+		return 0, fmt.Errorf("invalid DNS message of length %v, it must be at most %v bytes", len(p), dnsTCPMaxMsgLen)
+	}
+
+	// We need to copy p because "WriteTo must not modify p, even temporarily", and it's used after we return.
+	query := append([]byte(nil), p...)
+	go h.handleQuery(query, destination)
+	return len(p), nil
+}
+
+func (h *dnsTCPFallbackRequestHandler) handleQuery(query []byte, destination netip.AddrPort) {
+	resp, err := h.exchange(query, destination)
+	if err != nil || len(resp) > maxUDPPayloadSize(query) {
+		// Let the client retry over TCP by itself.
+		resp = query
+		setTruncated(resp)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed.Load() {
+		return
+	}
+	h.respWriter.WriteFrom(resp, net.UDPAddrFromAddrPort(destination))
+}
+
+// exchange sends the DNS query to the destination over TCP, and returns the response.
+// See https://datatracker.ietf.org/doc/html/rfc1035#section-4.2.2.
+func (h *dnsTCPFallbackRequestHandler) exchange(query []byte, destination netip.AddrPort) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(h.ctx, h.proxy.timeout)
+	defer cancel()
+	conn, err := h.proxy.dialer.DialStream(ctx, destination.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial DNS resolver: %w", err)
+	}
+	defer conn.Close()
+	// Abort the exchange if the session is closed or we time out.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	msg := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	copy(msg[2:], query)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, fmt.Errorf("failed to write DNS request: %w", err)
+	}
+
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+		return nil, fmt.Errorf("failed to read DNS response length: %w", err)
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, fmt.Errorf("failed to read DNS response: %w", err)
+	}
+	if len(resp) < dnsUdpMinMsgLen || resp[0] != query[0] || resp[1] != query[1] {
+		return nil, errors.New("invalid DNS response")
+	}
+	return resp, nil
+}
+
+// maxUDPPayloadSize returns the maximum size of the UDP response the client of the query accepts. That is the
+// payload size in the EDNS(0) OPT record if present, or 512 bytes otherwise.
+// See https://datatracker.ietf.org/doc/html/rfc6891#section-6.2.3.
+func maxUDPPayloadSize(query []byte) int {
+	var parser dnsmessage.Parser
+	if _, err := parser.Start(query); err != nil {
+		return dnsUdpMaxMsgLen
+	}
+	if parser.SkipAllQuestions() != nil || parser.SkipAllAnswers() != nil || parser.SkipAllAuthorities() != nil {
+		return dnsUdpMaxMsgLen
+	}
+	for {
+		header, err := parser.AdditionalHeader()
+		if err != nil {
+			return dnsUdpMaxMsgLen
+		}
+		if header.Type == dnsmessage.TypeOPT {
+			if size := int(header.Class); size > dnsUdpMaxMsgLen {
+				return size
+			}
+			return dnsUdpMaxMsgLen
+		}
+		if err := parser.SkipAdditional(); err != nil {
+			return dnsUdpMaxMsgLen
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnstruncate
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTCPFallback_AnswersOverTCP(t *testing.T) {
+	// The response is larger than 512 bytes, but the request advertises a payload size of 4096.
+	dialer := newDNSOverTCPDialerForTest(t, 1000)
+	session := newTCPFallbackSessionForTest(t, dialer)
+	defer session.Close()
+
+	resolverAddr := netip.MustParseAddrPort("1.2.3.4:53")
+	req := constructDNSRequestOrResponse(t, false, 0x1234, []string{"www.google.com"})
+	resp := session.Query(req, resolverAddr)
+	require.Len(t, resp, 1000)
+	require.Equal(t, req[:2], resp[:2])
+	require.Zero(t, resp[dnsUdpAnswerByte]&dnsUdpTruncatedBit)
+}
+
+func TestTCPFallback_TruncatesLargeResponse(t *testing.T) {
+	dialer := newDNSOverTCPDialerForTest(t, 5000)
+	session := newTCPFallbackSessionForTest(t, dialer)
+	defer session.Close()
+
+	resolverAddr := netip.MustParseAddrPort("1.2.3.4:53")
+	req := constructDNSRequestOrResponse(t, false, 0x1234, []string{"www.google.com"})
+	expected := constructDNSRequestOrResponse(t, true, 0x1234, []string{"www.google.com"})
+	require.Equal(t, expected, session.Query(req, resolverAddr))
+}
+
+func TestTCPFallback_TruncatesOnDialError(t *testing.T) {
+	dialer := transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		return nil, errors.New("dial failed")
+	})
+	session := newTCPFallbackSessionForTest(t, dialer)
+	defer session.Close()
+
+	resolverAddr := netip.MustParseAddrPort("[::1]:53")
+	req := constructDNSRequestOrResponse(t, false, 0x5678, []string{"www.google.com"})
+	expected := constructDNSRequestOrResponse(t, true, 0x5678, []string{"www.google.com"})
+	require.Equal(t, expected, session.Query(req, resolverAddr))
+}
+
+func TestTCPFallback_InvalidRequests(t *testing.T) {
+	session := newTCPFallbackSessionForTest(t, newDNSOverTCPDialerForTest(t, 100))
+
+	req := constructDNSRequestOrResponse(t, false, 0x2345, []string{"www.google.com"})
+	_, err := session.sender.WriteTo(req, netip.MustParseAddrPort("8.8.8.8:443"))
+	require.ErrorIs(t, err, network.ErrPortUnreachable)
+	_, err = session.sender.WriteTo(req[:11], netip.MustParseAddrPort("8.8.8.8:53"))
+	require.Error(t, err)
+
+	require.NoError(t, session.Close())
+	_, err = session.sender.WriteTo(req, netip.MustParseAddrPort("8.8.8.8:53"))
+	require.ErrorIs(t, err, network.ErrClosed)
+	require.ErrorIs(t, session.Close(), network.ErrClosed)
+}
+
+func TestNewTCPFallbackPacketProxy_NilDialer(t *testing.T) {
+	p, err := NewTCPFallbackPacketProxy(nil)
+	require.Error(t, err)
+	require.Nil(t, p)
+}
+
+func TestMaxUDPPayloadSize(t *testing.T) {
+	req := constructDNSRequestOrResponse(t, false, 0x1234, []string{"www.google.com"})
+	require.Equal(t, 4096, maxUDPPayloadSize(req))
+	require.Equal(t, dnsUdpMaxMsgLen, maxUDPPayloadSize(req[:dnsUdpMinMsgLen]))
+}
+
+/********** Test utilities **********/
+
+// newDNSOverTCPDialerForTest returns a dialer that connects to a local DNS-over-TCP server, regardless of the
+// address. The server answers with the request ID and QR bit, padded to respLen bytes.
+func newDNSOverTCPDialerForTest(t *testing.T, respLen int) transport.StreamDialer {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var lenBuf [2]byte
+				if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+					return
+				}
+				req := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+				if _, err := io.ReadFull(conn, req); err != nil {
+					return
+				}
+				resp := make([]byte, 2+respLen)
+				binary.BigEndian.PutUint16(resp, uint16(respLen))
+				copy(resp[2:], req[:dnsUdpMinMsgLen])
+				resp[2+dnsUdpAnswerByte] |= dnsUdpResponseBit
+				conn.Write(resp)
+			}()
+		}
+	}()
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		return (&transport.TCPDialer{}).DialStream(ctx, listener.Addr().String())
+	})
+}
+
+type tcpFallbackSession struct {
+	t         *testing.T
+	sender    network.PacketRequestSender
+	responses chan []byte
+}
+
+func newTCPFallbackSessionForTest(t *testing.T, dialer transport.StreamDialer) *tcpFallbackSession {
+	p, err := NewTCPFallbackPacketProxy(dialer)
+	require.NoError(t, err)
+	s := &tcpFallbackSession{t: t, responses: make(chan []byte, 1)}
+	s.sender, err = p.NewSession(s)
+	require.NoError(t, err)
+	return s
+}
+
+func (s *tcpFallbackSession) Query(req []byte, dest netip.AddrPort) []byte {
+	n, err := s.sender.WriteTo(req, dest)
+	require.NoError(s.t, err)
+	require.Equal(s.t, len(req), n)
+	select {
+	case resp := <-s.responses:
+		return resp
+	case <-time.After(5 * time.Second):
+		require.FailNow(s.t, "timed out waiting for DNS response")
+		return nil
+	}
+}
+
+func (s *tcpFallbackSession) Close() error {
+	return s.sender.Close()
+}
+
+func (s *tcpFallbackSession) WriteFrom(p []byte, source net.Addr) (int, error) {
+	s.responses <- append([]byte(nil), p...)
+	return len(p), nil
+}
@@ -14,10 +14,12 @@
 
 /*
 The network package defines interfaces and provides utilities for network layer (OSI layer 3) functionalities. For
-example, you can use the [IPDevice] interface to read and write IP packets from a physical or virtual network device.
+example, you can use the [IPDevice] interface to read and write IP packets from a physical or virtual network device,
+and [NewHookedIPDevice] to observe or rewrite the packets passing through it.
 
 In addition, the sub-packages include user-space network stack implementations (such as [network/lwip2transport]) that
 can translate raw IP packets into TCP/UDP flows. You can implement a [PacketProxy] to handle UDP traffic, and a
-[transport.StreamDialer] to handle TCP traffic.
+[transport.StreamDialer] to handle TCP traffic. Use [NewPacketRouter] to handle UDP flows with different
+[PacketProxy] implementations depending on their destination.
 */
 package network
@@ -0,0 +1,48 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package fakedns implements a fake-IP DNS mode for VPN integrations.
+
+Instead of resolving the domain names queried by the applications, a [network.PacketProxy] created by [NewPacketProxy]
+answers A or AAAA queries with fake IP addresses allocated from a reserved range, one per domain. When the application
+connects to the fake IP, a [transport.StreamDialer] created by [NewStreamDialer] maps it back to the domain name and
+dials the domain instead, letting the remote proxy resolve it.
+
+This avoids the DNS latency on connection setup, prevents DNS leaks, and makes the domain of each connection
+available at the IP layer, which enables domain-based routing.
+
+To use it with [network/lwip2transport]:
+
+	pool, err := fakedns.NewPool(netip.MustParsePrefix("198.18.0.0/15"))
+	if err != nil {
+		// handle error
+	}
+	pp, err := fakedns.NewPacketProxy(pool, remotePacketProxy)
+	if err != nil {
+		// handle error
+	}
+	sd, err := fakedns.NewStreamDialer(pool, remoteStreamDialer)
+	if err != nil {
+		// handle error
+	}
+	device, err := lwip2transport.ConfigureDevice(sd, pp)
+
+The fake IPs are only meaningful while the pool is alive, so the TTL of the answers is short. When the range is
+exhausted, the oldest mappings are recycled.
+
+Note that only streams are mapped back to domain names. UDP packets to fake IPs are passed to the fallback
+[network.PacketProxy] unmodified, since its destinations must be IP addresses.
+*/
+package fakedns
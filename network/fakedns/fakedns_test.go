@@ -0,0 +1,224 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestPool_Allocation(t *testing.T) {
+	pool, err := NewPool(netip.MustParsePrefix("198.18.0.0/15"))
+	require.NoError(t, err)
+
+	ip1, err := pool.IPForDomain("Example.com.")
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParseAddr("198.18.0.1"), ip1)
+	ip2, err := pool.IPForDomain("example.org")
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParseAddr("198.18.0.2"), ip2)
+
+	again, err := pool.IPForDomain("example.com")
+	require.NoError(t, err)
+	require.Equal(t, ip1, again)
+
+	domain, ok := pool.DomainForIP(ip1)
+	require.True(t, ok)
+	require.Equal(t, "example.com", domain)
+	_, ok = pool.DomainForIP(netip.MustParseAddr("198.18.0.3"))
+	require.False(t, ok)
+}
+
+func TestPool_Recycle(t *testing.T) {
+	pool, err := NewPool(netip.MustParsePrefix("10.0.0.0/30"))
+	require.NoError(t, err)
+	for _, domain := range []string{"a", "b", "c", "d"} {
+		_, err := pool.IPForDomain(domain)
+		require.NoError(t, err)
+	}
+	// The pool has 3 addresses, so "a" was recycled for "d".
+	domain, ok := pool.DomainForIP(netip.MustParseAddr("10.0.0.1"))
+	require.True(t, ok)
+	require.Equal(t, "d", domain)
+	ip, err := pool.IPForDomain("a")
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParseAddr("10.0.0.2"), ip)
+}
+
+func TestPool_IPv6(t *testing.T) {
+	pool, err := NewPool(netip.MustParsePrefix("2001:2::/48"))
+	require.NoError(t, err)
+	ip, err := pool.IPForDomain("example.com")
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParseAddr("2001:2::1"), ip)
+}
+
+func TestNewPool_Invalid(t *testing.T) {
+	_, err := NewPool(netip.Prefix{})
+	require.Error(t, err)
+	_, err = NewPool(netip.MustParsePrefix("10.0.0.1/32"))
+	require.Error(t, err)
+}
+
+type recordingReceiver struct {
+	mu      sync.Mutex
+	packets [][]byte
+	sources []net.Addr
+	closed  bool
+}
+
+func (r *recordingReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packets = append(r.packets, append([]byte(nil), p...))
+	r.sources = append(r.sources, source)
+	return len(p), nil
+}
+
+func (r *recordingReceiver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func makeQuery(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 0x1234, RecursionDesired: true})
+	require.NoError(t, b.StartQuestions())
+	require.NoError(t, b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}))
+	query, err := b.Finish()
+	require.NoError(t, err)
+	return query
+}
+
+func parseResponse(t *testing.T, response []byte) (dnsmessage.Header, []dnsmessage.Resource) {
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(response))
+	return msg.Header, msg.Answers
+}
+
+func TestPacketProxy_AQuery(t *testing.T) {
+	pool, err := NewPool(netip.MustParsePrefix("198.18.0.0/15"))
+	require.NoError(t, err)
+	proxy, err := NewPacketProxy(pool, nil)
+	require.NoError(t, err)
+	receiver := &recordingReceiver{}
+	session, err := proxy.NewSession(receiver)
+	require.NoError(t, err)
+
+	resolver := netip.MustParseAddrPort("8.8.8.8:53")
+	_, err = session.WriteTo(makeQuery(t, "example.com.", dnsmessage.TypeA), resolver)
+	require.NoError(t, err)
+	require.Len(t, receiver.packets, 1)
+	require.Equal(t, resolver.String(), receiver.sources[0].String())
+	header, answers := parseResponse(t, receiver.packets[0])
+	require.Equal(t, uint16(0x1234), header.ID)
+	require.True(t, header.Response)
+	require.Len(t, answers, 1)
+	require.Equal(t, [4]byte{198, 18, 0, 1}, answers[0].Body.(*dnsmessage.AResource).A)
+
+	// AAAA queries get an empty answer.
+	_, err = session.WriteTo(makeQuery(t, "example.com.", dnsmessage.TypeAAAA), resolver)
+	require.NoError(t, err)
+	require.Len(t, receiver.packets, 2)
+	header, answers = parseResponse(t, receiver.packets[1])
+	require.Equal(t, dnsmessage.RCodeSuccess, header.RCode)
+	require.Empty(t, answers)
+
+	// Non-DNS traffic is dropped without fallback.
+	_, err = session.WriteTo([]byte("data"), netip.MustParseAddrPort("1.2.3.4:443"))
+	require.ErrorIs(t, err, network.ErrPortUnreachable)
+
+	require.NoError(t, session.Close())
+	require.True(t, receiver.closed)
+	_, err = session.WriteTo(makeQuery(t, "example.com.", dnsmessage.TypeA), resolver)
+	require.ErrorIs(t, err, network.ErrClosed)
+}
+
+type echoSender struct {
+	receiver network.PacketResponseReceiver
+}
+
+func (s *echoSender) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	return s.receiver.WriteFrom(p, net.UDPAddrFromAddrPort(destination))
+}
+
+func (s *echoSender) Close() error {
+	return s.receiver.Close()
+}
+
+func TestPacketProxy_Fallback(t *testing.T) {
+	pool, err := NewPool(netip.MustParsePrefix("198.18.0.0/15"))
+	require.NoError(t, err)
+	fallback := fallbackProxy(func(r network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+		return &echoSender{receiver: r}, nil
+	})
+	proxy, err := NewPacketProxy(pool, fallback)
+	require.NoError(t, err)
+	receiver := &recordingReceiver{}
+	session, err := proxy.NewSession(receiver)
+	require.NoError(t, err)
+
+	// MX queries go to the fallback.
+	mxQuery := makeQuery(t, "example.com.", dnsmessage.TypeMX)
+	_, err = session.WriteTo(mxQuery, netip.MustParseAddrPort("8.8.8.8:53"))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{mxQuery}, receiver.packets)
+
+	_, err = session.WriteTo([]byte("data"), netip.MustParseAddrPort("1.2.3.4:443"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), receiver.packets[1])
+	require.NoError(t, session.Close())
+	require.True(t, receiver.closed)
+}
+
+type fallbackProxy func(network.PacketResponseReceiver) (network.PacketRequestSender, error)
+
+func (f fallbackProxy) NewSession(r network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	return f(r)
+}
+
+func TestStreamDialer(t *testing.T) {
+	pool, err := NewPool(netip.MustParsePrefix("198.18.0.0/15"))
+	require.NoError(t, err)
+	ip, err := pool.IPForDomain("example.com")
+	require.NoError(t, err)
+
+	var dialed string
+	baseDialer := transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		dialed = addr
+		return nil, errors.New("not implemented")
+	})
+	dialer, err := NewStreamDialer(pool, baseDialer)
+	require.NoError(t, err)
+
+	dialer.DialStream(context.Background(), netip.AddrPortFrom(ip, 443).String())
+	require.Equal(t, "example.com:443", dialed)
+
+	dialer.DialStream(context.Background(), "8.8.8.8:53")
+	require.Equal(t, "8.8.8.8:53", dialed)
+
+	_, err = dialer.DialStream(context.Background(), "198.18.1.1:443")
+	require.ErrorContains(t, err, "no domain")
+}
@@ -0,0 +1,243 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	standardDNSPort = uint16(53)
+	// fakeTTL is the TTL of the fake answers, in seconds. It is short so that clients don't cache
+	// the fake IPs beyond the lifetime of the pool.
+	fakeTTL = 1
+	// maxResponseSize is the maximum size of the responses we build.
+	maxResponseSize = 512
+)
+
+// fakeDNSProxy is a [network.PacketProxy] that answers DNS queries with fake IPs.
+//
+// Multiple goroutines may invoke methods on a fakeDNSProxy simultaneously.
+type fakeDNSProxy struct {
+	pool     *Pool
+	fallback network.PacketProxy
+}
+
+var _ network.PacketProxy = (*fakeDNSProxy)(nil)
+
+// NewPacketProxy creates a [network.PacketProxy] that answers A or AAAA queries sent to port 53 with fake IPs
+// from pool, according to the pool's IP version. Queries for the other IP version get an empty answer.
+//
+// Other DNS queries and non-DNS packets are sent to the fallback [network.PacketProxy]. If fallback is nil,
+// other DNS queries get an empty answer, and non-DNS packets are dropped.
+func NewPacketProxy(pool *Pool, fallback network.PacketProxy) (network.PacketProxy, error) {
+	if pool == nil {
+		return nil, errors.New("pool must not be nil")
+	}
+	return &fakeDNSProxy{pool: pool, fallback: fallback}, nil
+}
+
+// NewSession implements [network.PacketProxy].NewSession().
+func (p *fakeDNSProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	if respWriter == nil {
+		return nil, errors.New("respWriter is required")
+	}
+	return &fakeDNSSession{proxy: p, respWriter: respWriter}, nil
+}
+
+// fakeDNSSession is a [network.PacketRequestSender] that answers DNS queries locally and forwards
+// other packets to a session of the fallback proxy, created on demand.
+type fakeDNSSession struct {
+	proxy      *fakeDNSProxy
+	respWriter network.PacketResponseReceiver
+
+	mu       sync.Mutex
+	closed   bool
+	fallback network.PacketRequestSender
+}
+
+var _ network.PacketRequestSender = (*fakeDNSSession)(nil)
+
+// WriteTo implements [network.PacketRequestSender].WriteTo().
+func (s *fakeDNSSession) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return 0, network.ErrClosed
+	}
+	if destination.Port() == standardDNSPort {
+		response, err := s.proxy.answer(p)
+		if err != nil {
+			return 0, err
+		}
+		if response != nil {
+			if _, err := s.respWriter.WriteFrom(response, net.UDPAddrFromAddrPort(destination)); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+	}
+	fallback, err := s.fallbackSession()
+	if err != nil {
+		return 0, err
+	}
+	return fallback.WriteTo(p, destination)
+}
+
+func (s *fakeDNSSession) fallbackSession() (network.PacketRequestSender, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, network.ErrClosed
+	}
+	if s.fallback != nil {
+		return s.fallback, nil
+	}
+	if s.proxy.fallback == nil {
+		return nil, fmt.Errorf("UDP traffic without fallback is not supported: %w", network.ErrPortUnreachable)
+	}
+	fallback, err := s.proxy.fallback.NewSession(&fallbackReceiver{session: s})
+	if err != nil {
+		return nil, err
+	}
+	s.fallback = fallback
+	return fallback, nil
+}
+
+// Close implements [network.PacketRequestSender].Close(), and it closes the corresponding
+// [network.PacketResponseReceiver].
+func (s *fakeDNSSession) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return network.ErrClosed
+	}
+	s.closed = true
+	fallback := s.fallback
+	s.fallback = nil
+	s.mu.Unlock()
+	if fallback != nil {
+		fallback.Close()
+	}
+	return s.respWriter.Close()
+}
+
+// fallbackReceiver forwards the responses of the fallback session. When the fallback session closes,
+// for example due to a timeout, it is recreated on the next write instead of closing the whole session.
+type fallbackReceiver struct {
+	session *fakeDNSSession
+}
+
+func (r *fallbackReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	return r.session.respWriter.WriteFrom(p, source)
+}
+
+func (r *fallbackReceiver) Close() error {
+	r.session.mu.Lock()
+	r.session.fallback = nil
+	r.session.mu.Unlock()
+	return nil
+}
+
+// answer returns the response to the DNS query, or nil if the query must go to the fallback.
+func (p *fakeDNSProxy) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS message: %w", err)
+	}
+	if header.Response {
+		return nil, errors.New("DNS message is not a query")
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS question: %w", err)
+	}
+	if header.OpCode != 0 || len(questions) != 1 || questions[0].Class != dnsmessage.ClassINET {
+		return p.emptyAnswerOrFallback(header, questions)
+	}
+	question := questions[0]
+	is4 := p.pool.Prefix().Addr().Is4()
+	switch {
+	case question.Type == dnsmessage.TypeA && is4, question.Type == dnsmessage.TypeAAAA && !is4:
+		ip, err := p.pool.IPForDomain(question.Name.String())
+		if err != nil {
+			return nil, err
+		}
+		return buildResponse(header, question, ip)
+	case question.Type == dnsmessage.TypeA, question.Type == dnsmessage.TypeAAAA:
+		// Empty answer for the other IP version, so clients use the fake IPs.
+		return buildResponse(header, question, netip.Addr{})
+	default:
+		return p.emptyAnswerOrFallback(header, questions)
+	}
+}
+
+func (p *fakeDNSProxy) emptyAnswerOrFallback(header dnsmessage.Header, questions []dnsmessage.Question) ([]byte, error) {
+	if p.fallback != nil {
+		return nil, nil
+	}
+	var question dnsmessage.Question
+	if len(questions) > 0 {
+		question = questions[0]
+	}
+	return buildResponse(header, question, netip.Addr{})
+}
+
+// buildResponse builds a successful response to the query with the given header and question.
+// The answer is empty if ip is not valid.
+func buildResponse(queryHeader dnsmessage.Header, question dnsmessage.Question, ip netip.Addr) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, maxResponseSize), dnsmessage.Header{
+		ID:                 queryHeader.ID,
+		Response:           true,
+		OpCode:             queryHeader.OpCode,
+		RecursionDesired:   queryHeader.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              dnsmessage.RCodeSuccess,
+	})
+	b.EnableCompression()
+	if question.Name.Length > 0 {
+		if err := b.StartQuestions(); err != nil {
+			return nil, err
+		}
+		if err := b.Question(question); err != nil {
+			return nil, err
+		}
+	}
+	if ip.IsValid() {
+		if err := b.StartAnswers(); err != nil {
+			return nil, err
+		}
+		resourceHeader := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: fakeTTL}
+		if ip.Is4() {
+			if err := b.AResource(resourceHeader, dnsmessage.AResource{A: ip.As4()}); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := b.AAAAResource(resourceHeader, dnsmessage.AAAAResource{AAAA: ip.As16()}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
@@ -0,0 +1,118 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedns
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// maxPoolSize limits the number of addresses in a pool, to keep the arithmetic simple for large IPv6 prefixes.
+const maxPoolSize = 1 << 24
+
+// Pool allocates fake IP addresses for domain names from a reserved prefix and maps them back.
+//
+// Multiple goroutines may invoke methods on a Pool simultaneously.
+type Pool struct {
+	prefix netip.Prefix
+	size   uint64
+
+	mu       sync.Mutex
+	next     uint64
+	byDomain map[string]netip.Addr
+	byIP     map[netip.Addr]string
+}
+
+// NewPool creates a [Pool] that allocates addresses from the given prefix. The first address of the prefix is not used.
+// Common choices are the benchmarking ranges 198.18.0.0/15 for IPv4 and 2001:2::/48 for IPv6.
+func NewPool(prefix netip.Prefix) (*Pool, error) {
+	if !prefix.IsValid() {
+		return nil, errors.New("prefix must be valid")
+	}
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	size := uint64(maxPoolSize)
+	if hostBits < 24 {
+		size = uint64(1) << hostBits
+	}
+	// Exclude the first address.
+	size--
+	if size < 1 {
+		return nil, fmt.Errorf("prefix %v is too small", prefix)
+	}
+	return &Pool{
+		prefix:   prefix,
+		size:     size,
+		byDomain: make(map[string]netip.Addr),
+		byIP:     make(map[netip.Addr]string),
+	}, nil
+}
+
+// Prefix returns the prefix the pool allocates addresses from.
+func (p *Pool) Prefix() netip.Prefix {
+	return p.prefix
+}
+
+// Contains reports whether ip belongs to the pool prefix.
+func (p *Pool) Contains(ip netip.Addr) bool {
+	return p.prefix.Contains(ip.Unmap())
+}
+
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+// IPForDomain returns the fake IP for the domain, allocating one if needed.
+// If all addresses are in use, the oldest mapping is recycled.
+func (p *Pool) IPForDomain(domain string) (netip.Addr, error) {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return netip.Addr{}, errors.New("domain must not be empty")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ip, ok := p.byDomain[domain]; ok {
+		return ip, nil
+	}
+	ip := p.addrAt(p.next + 1)
+	p.next = (p.next + 1) % p.size
+	if oldDomain, ok := p.byIP[ip]; ok {
+		delete(p.byDomain, oldDomain)
+	}
+	p.byIP[ip] = domain
+	p.byDomain[domain] = ip
+	return ip, nil
+}
+
+// DomainForIP returns the domain the fake IP was allocated for, if any.
+func (p *Pool) DomainForIP(ip netip.Addr) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	domain, ok := p.byIP[ip.Unmap()]
+	return domain, ok
+}
+
+// addrAt returns the address at the given offset from the start of the prefix.
+func (p *Pool) addrAt(offset uint64) netip.Addr {
+	base := new(big.Int).SetBytes(p.prefix.Addr().AsSlice())
+	base.Add(base, new(big.Int).SetUint64(offset))
+	b := base.FillBytes(make([]byte, p.prefix.Addr().BitLen()/8))
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
@@ -0,0 +1,70 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+type fakeDNSDialer struct {
+	pool   *Pool
+	dialer transport.StreamDialer
+}
+
+var _ transport.StreamDialer = (*fakeDNSDialer)(nil)
+
+// NewStreamDialer creates a [transport.StreamDialer] that replaces the fake IPs allocated by pool with the
+// domain names they were allocated for, before dialing with dialer. Other addresses are dialed unmodified.
+func NewStreamDialer(pool *Pool, dialer transport.StreamDialer) (transport.StreamDialer, error) {
+	if pool == nil {
+		return nil, errors.New("pool must not be nil")
+	}
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	return &fakeDNSDialer{pool: pool, dialer: dialer}, nil
+}
+
+// DialStream implements [transport.StreamDialer].DialStream.
+func (d *fakeDNSDialer) DialStream(ctx context.Context, remoteAddr string) (transport.StreamConn, error) {
+	remoteAddr, err := d.pool.resolveAddress(remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	return d.dialer.DialStream(ctx, remoteAddr)
+}
+
+// resolveAddress maps a host:port address with a fake IP back to the domain:port address.
+func (p *Pool) resolveAddress(address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !p.Contains(ip) {
+		return address, nil
+	}
+	domain, ok := p.DomainForIP(ip)
+	if !ok {
+		return "", fmt.Errorf("no domain for fake IP %v", ip)
+	}
+	return net.JoinHostPort(domain, port), nil
+}
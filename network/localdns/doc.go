@@ -0,0 +1,37 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package localdns keeps local network name resolution out of the tunnel of VPN integrations.
+
+A [network.PacketProxy] created by [NewPacketProxy] sits in front of the proxy of the tunnel and:
+
+  - Drops multicast DNS (mDNS, port 5353) and LLMNR (port 5355) packets, which are only meaningful on the local link,
+    so they are not sent through the tunnel, where they would leak local names to the remote proxy.
+  - Answers the DNS queries for special-use names itself, as per [dns.NewSpecialUseResolver]: "localhost" resolves
+    to the loopback addresses, names like "invalid" get a name error, and local names like "printer.local",
+    "router.home.arpa" or the reverse names of private addresses go to a resolver of the local network.
+
+Other packets, including the other DNS queries, go to the proxy of the tunnel unmodified.
+
+To use it with [network/lwip2transport], with the resolver of the local network reached outside of the tunnel:
+
+	localResolver := dns.NewUDPResolver(protectedPacketDialer, "192.168.1.1:53")
+	pp, err := localdns.NewPacketProxy(localResolver, remotePacketProxy)
+	if err != nil {
+		// handle error
+	}
+	device, err := lwip2transport.ConfigureDevice(sd, pp)
+*/
+package localdns
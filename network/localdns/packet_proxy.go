@@ -0,0 +1,228 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultQueryTimeout is the time limit to answer a query for a special-use name.
+const DefaultQueryTimeout = 5 * time.Second
+
+const standardDNSPort = uint16(53)
+
+var (
+	mDNSGroup4  = netip.MustParseAddr("224.0.0.251")
+	mDNSGroup6  = netip.MustParseAddr("ff02::fb")
+	llmnrGroup4 = netip.MustParseAddr("224.0.0.252")
+	llmnrGroup6 = netip.MustParseAddr("ff02::1:3")
+)
+
+// isLinkLocalDiscovery returns whether the destination is the mDNS or LLMNR multicast group.
+func isLinkLocalDiscovery(destination netip.AddrPort) bool {
+	ip := destination.Addr().Unmap().WithZone("")
+	switch destination.Port() {
+	case 5353:
+		return ip == mDNSGroup4 || ip == mDNSGroup6
+	case 5355:
+		return ip == llmnrGroup4 || ip == llmnrGroup6
+	default:
+		return false
+	}
+}
+
+// localDNSProxy is a [network.PacketProxy] that handles the local name resolution, and sends the rest to a tunnel.
+//
+// Multiple goroutines may invoke methods on a localDNSProxy simultaneously.
+type localDNSProxy struct {
+	resolver dns.Resolver
+	tunnel   network.PacketProxy
+	timeout  time.Duration
+}
+
+var _ network.PacketProxy = (*localDNSProxy)(nil)
+
+// errNotSpecial is returned by the resolver of the proxy for the questions that go through the tunnel.
+var errNotSpecial = errors.New("name is not special-use")
+
+// NewPacketProxy creates a [network.PacketProxy] that drops the mDNS and LLMNR packets, answers the DNS queries
+// for special-use names, sending the local ones to localResolver, and sends the other packets to tunnel.
+// If localResolver is nil, local names get a name error.
+func NewPacketProxy(localResolver dns.Resolver, tunnel network.PacketProxy) (network.PacketProxy, error) {
+	if tunnel == nil {
+		return nil, errors.New("argument tunnel must not be nil")
+	}
+	resolver, err := dns.NewSpecialUseResolver(dns.FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		return nil, errNotSpecial
+	}), localResolver)
+	if err != nil {
+		return nil, err
+	}
+	return &localDNSProxy{resolver: resolver, tunnel: tunnel, timeout: DefaultQueryTimeout}, nil
+}
+
+// NewSession implements [network.PacketProxy].NewSession().
+func (p *localDNSProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	if respWriter == nil {
+		return nil, errors.New("respWriter is required")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &localDNSSession{proxy: p, respWriter: respWriter, ctx: ctx, cancel: cancel}, nil
+}
+
+// localDNSSession is a [network.PacketRequestSender] that answers the special-use queries in the background, and
+// forwards the other packets to a session of the tunnel proxy, created on demand.
+type localDNSSession struct {
+	proxy      *localDNSProxy
+	respWriter network.PacketResponseReceiver
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	// mu protects the fields below, and respWriter from being closed while writing responses.
+	mu     sync.RWMutex
+	closed bool
+	tunnel network.PacketRequestSender
+}
+
+var _ network.PacketRequestSender = (*localDNSSession)(nil)
+
+// WriteTo implements [network.PacketRequestSender].WriteTo().
+func (s *localDNSSession) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
+	if closed {
+		return 0, network.ErrClosed
+	}
+	if isLinkLocalDiscovery(destination) {
+		// Drop silently, like the network would.
+		return len(p), nil
+	}
+	if destination.Port() == standardDNSPort {
+		if header, question, ok := parseQuery(p); ok && dns.SpecialUseOf(question.Name.String()) != dns.SpecialUseNone {
+			go s.answer(header, question, destination)
+			return len(p), nil
+		}
+	}
+	tunnel, err := s.tunnelSession()
+	if err != nil {
+		return 0, err
+	}
+	return tunnel.WriteTo(p, destination)
+}
+
+// parseQuery returns the header and question of a standard query with a single question.
+func parseQuery(p []byte) (dnsmessage.Header, dnsmessage.Question, bool) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(p)
+	if err != nil || header.Response || header.OpCode != 0 {
+		return dnsmessage.Header{}, dnsmessage.Question{}, false
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil || len(questions) != 1 || questions[0].Class != dnsmessage.ClassINET {
+		return dnsmessage.Header{}, dnsmessage.Question{}, false
+	}
+	return header, questions[0], true
+}
+
+// answer resolves the special-use question and writes the response. If the resolution fails, the response is
+// a server failure, so the client doesn't wait for its timeout.
+func (s *localDNSSession) answer(header dnsmessage.Header, question dnsmessage.Question, destination netip.AddrPort) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.proxy.timeout)
+	defer cancel()
+	msg, err := s.proxy.resolver.Query(ctx, question)
+	if err != nil {
+		msg = &dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RecursionAvailable: true, RCode: dnsmessage.RCodeServerFailure},
+			Questions: []dnsmessage.Question{question},
+		}
+	}
+	msg.ID = header.ID
+	msg.RecursionDesired = header.RecursionDesired
+	response, err := msg.Pack()
+	if err != nil {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	s.respWriter.WriteFrom(response, net.UDPAddrFromAddrPort(destination))
+}
+
+func (s *localDNSSession) tunnelSession() (network.PacketRequestSender, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, network.ErrClosed
+	}
+	if s.tunnel != nil {
+		return s.tunnel, nil
+	}
+	tunnel, err := s.proxy.tunnel.NewSession(&tunnelReceiver{session: s})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tunnel session: %w", err)
+	}
+	s.tunnel = tunnel
+	return tunnel, nil
+}
+
+// Close implements [network.PacketRequestSender].Close(). It cancels the pending queries, closes the tunnel
+// session, and closes the corresponding [network.PacketResponseReceiver].
+func (s *localDNSSession) Close() error {
+	s.cancel()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return network.ErrClosed
+	}
+	s.closed = true
+	tunnel := s.tunnel
+	s.tunnel = nil
+	s.mu.Unlock()
+	if tunnel != nil {
+		tunnel.Close()
+	}
+	return s.respWriter.Close()
+}
+
+// tunnelReceiver forwards the responses of the tunnel session. When the tunnel session closes, for example due
+// to a timeout, it is recreated on the next write instead of closing the whole session.
+type tunnelReceiver struct {
+	session *localDNSSession
+}
+
+func (r *tunnelReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	return r.session.respWriter.WriteFrom(p, source)
+}
+
+func (r *tunnelReceiver) Close() error {
+	r.session.mu.Lock()
+	r.session.tunnel = nil
+	r.session.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localdns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type recordingReceiver struct {
+	mu      sync.Mutex
+	packets [][]byte
+	closed  bool
+}
+
+func (r *recordingReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packets = append(r.packets, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func (r *recordingReceiver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func (r *recordingReceiver) waitPacket(t *testing.T) []byte {
+	var packet []byte
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if len(r.packets) == 0 {
+			return false
+		}
+		packet = r.packets[0]
+		r.packets = r.packets[1:]
+		return true
+	}, time.Second, time.Millisecond)
+	return packet
+}
+
+// tunnelProxy records the packets sent to the tunnel.
+type tunnelProxy struct {
+	mu           sync.Mutex
+	destinations []netip.AddrPort
+}
+
+func (p *tunnelProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	return &tunnelSession{proxy: p}, nil
+}
+
+type tunnelSession struct {
+	proxy *tunnelProxy
+}
+
+func (s *tunnelSession) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	s.proxy.mu.Lock()
+	defer s.proxy.mu.Unlock()
+	s.proxy.destinations = append(s.proxy.destinations, destination)
+	return len(p), nil
+}
+
+func (s *tunnelSession) Close() error { return nil }
+
+func makeQuery(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 0x1234, RecursionDesired: true})
+	require.NoError(t, b.StartQuestions())
+	require.NoError(t, b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}))
+	query, err := b.Finish()
+	require.NoError(t, err)
+	return query
+}
+
+func parseResponse(t *testing.T, response []byte) *dnsmessage.Message {
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(response))
+	require.Equal(t, uint16(0x1234), msg.ID)
+	require.True(t, msg.Response)
+	require.True(t, msg.RecursionDesired)
+	return &msg
+}
+
+var resolverAddr = netip.MustParseAddrPort("10.0.0.1:53")
+
+func newTestSession(t *testing.T, localResolver dns.Resolver) (network.PacketRequestSender, *recordingReceiver, *tunnelProxy) {
+	tunnel := &tunnelProxy{}
+	proxy, err := NewPacketProxy(localResolver, tunnel)
+	require.NoError(t, err)
+	receiver := &recordingReceiver{}
+	session, err := proxy.NewSession(receiver)
+	require.NoError(t, err)
+	t.Cleanup(func() { session.Close() })
+	return session, receiver, tunnel
+}
+
+func TestPacketProxy_DropsLinkLocalDiscovery(t *testing.T) {
+	session, receiver, tunnel := newTestSession(t, nil)
+	query := makeQuery(t, "printer.local.", dnsmessage.TypeA)
+	for _, destination := range []string{"224.0.0.251:5353", "[ff02::fb]:5353", "224.0.0.252:5355", "[ff02::1:3]:5355"} {
+		n, err := session.WriteTo(query, netip.MustParseAddrPort(destination))
+		require.NoError(t, err)
+		require.Equal(t, len(query), n)
+	}
+	require.Empty(t, tunnel.destinations)
+	require.Empty(t, receiver.packets)
+}
+
+func TestPacketProxy_ForwardsRegularTraffic(t *testing.T) {
+	session, _, tunnel := newTestSession(t, nil)
+	_, err := session.WriteTo(makeQuery(t, "example.com.", dnsmessage.TypeA), resolverAddr)
+	require.NoError(t, err)
+	_, err = session.WriteTo([]byte("not dns"), netip.MustParseAddrPort("10.0.0.2:5353"))
+	require.NoError(t, err)
+	// Not a valid DNS message, so it's not ours to handle.
+	_, err = session.WriteTo([]byte("x"), resolverAddr)
+	require.NoError(t, err)
+	require.Equal(t, []netip.AddrPort{resolverAddr, netip.MustParseAddrPort("10.0.0.2:5353"), resolverAddr}, tunnel.destinations)
+}
+
+func TestPacketProxy_Loopback(t *testing.T) {
+	session, receiver, tunnel := newTestSession(t, nil)
+	_, err := session.WriteTo(makeQuery(t, "localhost.", dnsmessage.TypeA), resolverAddr)
+	require.NoError(t, err)
+	msg := parseResponse(t, receiver.waitPacket(t))
+	require.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+	require.Equal(t, &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}, msg.Answers[0].Body)
+	require.Empty(t, tunnel.destinations)
+}
+
+func TestPacketProxy_LocalNames(t *testing.T) {
+	localResolver := dns.FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		if q.Name.String() == "fail.local." {
+			return nil, errors.New("failed")
+		}
+		return &dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: 0xffff, Response: true},
+			Questions: []dnsmessage.Question{q},
+			Answers: []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.AResource{A: [4]byte{192, 168, 1, 10}},
+			}},
+		}, nil
+	})
+	session, receiver, tunnel := newTestSession(t, localResolver)
+
+	_, err := session.WriteTo(makeQuery(t, "printer.local.", dnsmessage.TypeA), resolverAddr)
+	require.NoError(t, err)
+	msg := parseResponse(t, receiver.waitPacket(t))
+	require.Equal(t, &dnsmessage.AResource{A: [4]byte{192, 168, 1, 10}}, msg.Answers[0].Body)
+
+	_, err = session.WriteTo(makeQuery(t, "fail.local.", dnsmessage.TypeA), resolverAddr)
+	require.NoError(t, err)
+	msg = parseResponse(t, receiver.waitPacket(t))
+	require.Equal(t, dnsmessage.RCodeServerFailure, msg.RCode)
+
+	_, err = session.WriteTo(makeQuery(t, "foo.invalid.", dnsmessage.TypeA), resolverAddr)
+	require.NoError(t, err)
+	msg = parseResponse(t, receiver.waitPacket(t))
+	require.Equal(t, dnsmessage.RCodeNameError, msg.RCode)
+	require.Empty(t, tunnel.destinations)
+}
+
+func TestPacketProxy_Close(t *testing.T) {
+	session, receiver, _ := newTestSession(t, nil)
+	require.NoError(t, session.Close())
+	require.True(t, receiver.closed)
+	_, err := session.WriteTo(makeQuery(t, "localhost.", dnsmessage.TypeA), resolverAddr)
+	require.ErrorIs(t, err, network.ErrClosed)
+	require.ErrorIs(t, session.Close(), network.ErrClosed)
+}
+
+func TestNewPacketProxy_NilTunnel(t *testing.T) {
+	_, err := NewPacketProxy(nil, nil)
+	require.Error(t, err)
+}
@@ -16,7 +16,9 @@ package lwip2transport
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"sync"
 
 	"github.com/Jigsaw-Code/outline-sdk/network"
@@ -33,6 +35,7 @@ type lwIPDevice struct {
 	tcp   *tcpHandler
 	udp   *udpHandler
 	stack lwip.LWIPStack
+	mode  StackMode
 
 	// whether the device has been closed
 	done chan struct{}
@@ -50,7 +53,8 @@ var inst *lwIPDevice = nil
 // the [transport.PacketProxy] to handle UDP packets.
 //
 // LwIP device is a [network.IPDevice] that can translate IP packets to TCP/UDP traffic and vice versa. It uses the
-// [lwIP library] to perform the translation.
+// [lwIP library] to perform the translation. It handles TCP and UDP over both IPv4 and IPv6, unless restricted
+// with [WithStackMode].
 //
 // LwIP device must be a singleton object due to limitations in [lwIP library]. If you try to call ConfigureDevice more
 // than once, we will Close the previous device and reconfigure it.
@@ -67,9 +71,41 @@ var inst *lwIPDevice = nil
 //
 // [lwIP library]: https://savannah.nongnu.org/projects/lwip/
 func ConfigureDevice(sd transport.StreamDialer, pp network.PacketProxy) (network.IPDevice, error) {
+	return ConfigureDeviceWithOptions(sd, pp)
+}
+
+// DeviceOption configures the LwIP device created by [ConfigureDeviceWithOptions].
+type DeviceOption func(*lwIPDevice) error
+
+// WithStackMode sets the IP versions handled by the LwIP device. The device drops the packets of other IP versions
+// written to it, so that apps fall back to the supported version quickly. The default is [DualStack].
+func WithStackMode(mode StackMode) DeviceOption {
+	return func(d *lwIPDevice) error {
+		if mode < DualStack || mode > IPv6Only {
+			return fmt.Errorf("invalid stack mode %v", mode)
+		}
+		d.mode = mode
+		return nil
+	}
+}
+
+// ConfigureDeviceWithOptions is like [ConfigureDevice], but it also applies the given options to the device.
+func ConfigureDeviceWithOptions(sd transport.StreamDialer, pp network.PacketProxy, options ...DeviceOption) (network.IPDevice, error) {
 	if sd == nil || pp == nil {
 		return nil, errors.New("both sd and pp are required")
 	}
+	d := &lwIPDevice{
+		tcp:   newTCPHandler(sd),
+		udp:   newUDPHandler(pp),
+		done:  make(chan struct{}),
+		rdBuf: make(chan []byte),
+		rdN:   make(chan int),
+	}
+	for _, opt := range options {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
 
 	instMu.Lock()
 	defer instMu.Unlock()
@@ -77,14 +113,8 @@ func ConfigureDevice(sd transport.StreamDialer, pp network.PacketProxy) (network
 	if inst != nil {
 		inst.Close()
 	}
-	inst = &lwIPDevice{
-		tcp:   newTCPHandler(sd),
-		udp:   newUDPHandler(pp),
-		stack: lwip.NewLWIPStack(),
-		done:  make(chan struct{}),
-		rdBuf: make(chan []byte),
-		rdN:   make(chan int),
-	}
+	d.stack = lwip.NewLWIPStack()
+	inst = d
 	lwip.RegisterTCPConnHandler(inst.tcp)
 	lwip.RegisterUDPConnHandler(inst.udp)
 	lwip.RegisterOutputFn(inst.forwardOutgoingIPPacket)
@@ -126,6 +156,9 @@ func (d *lwIPDevice) forwardOutgoingIPPacket(b []byte) (int, error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
+	if isNeighborDiscovery(b) {
+		return len(b), nil
+	}
 	select {
 	case d.rdBuf <- b:
 		select {
@@ -184,6 +217,9 @@ func (d *lwIPDevice) WriteTo(w io.Writer) (int64, error) {
 // Write implements [io.Writer] and [network.IPDevice]. It writes a single IP packet to this device. The device will
 // then translate the IP packet into a TCP or UDP traffic.
 //
+// IPv6 UDP datagrams are handled by the device directly, since lwIP can't send the responses. Packets of IP
+// versions disabled by the [StackMode] are dropped.
+//
 // Write returns [network.ErrClosed] if this device is already closed.
 func (d *lwIPDevice) Write(b []byte) (int, error) {
 	select {
@@ -191,6 +227,16 @@ func (d *lwIPDevice) Write(b []byte) (int, error) {
 		return 0, network.ErrClosed
 	default:
 	}
+	if len(b) > 0 && d.mode.drops(b[0]>>4) {
+		return len(b), nil
+	}
+	if src, dst, payload, ok := parseUDP6Packet(b); ok {
+		conn := &udp6Conn{localAddr: net.UDPAddrFromAddrPort(src), output: d.forwardOutgoingIPPacket}
+		if err := d.udp.ReceiveTo(conn, payload, net.UDPAddrFromAddrPort(dst)); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
 	n, err := d.stack.Write(b)
 	// Workaround: lwip netstack did not use a typed error.
 	if err != nil && err.Error() == "stack closed" {
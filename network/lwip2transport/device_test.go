@@ -32,6 +32,8 @@ func TestStackClosedWriteError(t *testing.T) {
 	t2s := reConfigurelwIPDeviceForTest(t, h, h)
 
 	t2s.stack.Close() // close the underlying stack without calling Close
+	// Mark the device as closed, so that reconfiguring it in other tests doesn't close the stack again
+	defer close(t2s.done)
 	n, err := t2s.Write([]byte{0x01})
 	require.Exactly(t, 0, n)
 	require.ErrorIs(t, err, network.ErrClosed)
@@ -25,6 +25,12 @@ To configure the instance with TCP/UDP handlers:
 		// handle error
 	}
 
+The device handles both IPv4 and IPv6 by default. To drop the packets of an IP version, for example when the proxy
+has no IPv6 connectivity:
+
+	t2s, err := lwip2transport.ConfigureDeviceWithOptions(tcpHandler, udpHandler,
+		lwip2transport.WithStackMode(lwip2transport.IPv4Only))
+
 [modified lwIP go library]: https://github.com/eycorsican/go-tun2socks
 [lwIP library]: https://savannah.nongnu.org/projects/lwip/
 */
@@ -0,0 +1,181 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lwip2transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	lwip "github.com/eycorsican/go-tun2socks/core"
+)
+
+const (
+	ipv6HeaderLen       = 40
+	udpHeaderLen        = 8
+	ipProtocolUDP       = 17
+	ipProtocolICMPv6    = 58
+	ipv6DefaultHopLimit = 64
+
+	icmpv6RouterSolicitation = 133
+	icmpv6Redirect           = 137
+)
+
+// StackMode selects the IP versions handled by the LwIP device.
+type StackMode int
+
+const (
+	// DualStack handles both IPv4 and IPv6 packets. It's the default.
+	DualStack StackMode = iota
+	// IPv4Only handles IPv4 packets, and drops IPv6 packets.
+	IPv4Only
+	// IPv6Only handles IPv6 packets, and drops IPv4 packets.
+	IPv6Only
+)
+
+// String implements [fmt.Stringer].
+func (m StackMode) String() string {
+	switch m {
+	case DualStack:
+		return "dual-stack"
+	case IPv4Only:
+		return "ipv4-only"
+	case IPv6Only:
+		return "ipv6-only"
+	default:
+		return fmt.Sprintf("StackMode(%d)", int(m))
+	}
+}
+
+// drops returns whether the mode drops packets of the given IP version.
+func (m StackMode) drops(version byte) bool {
+	return (version == 4 && m == IPv6Only) || (version == 6 && m == IPv4Only)
+}
+
+// Compilation guard against interface implementation
+var _ lwip.UDPConn = (*udp6Conn)(nil)
+
+// udp6Conn is a [lwip.UDPConn] for an IPv6 UDP client. The lwIP stack binds its UDP PCB to the IPv4 wildcard
+// address, so it can receive IPv6 datagrams but it drops the responses. We handle the IPv6 datagrams ourselves
+// instead, and write the responses directly to the device.
+type udp6Conn struct {
+	localAddr *net.UDPAddr
+	output    func([]byte) (int, error)
+}
+
+func (c *udp6Conn) LocalAddr() *net.UDPAddr {
+	return c.localAddr
+}
+
+// ReceiveTo is not used, since the udpHandler sends the datagrams from the device to the proxy.
+func (*udp6Conn) ReceiveTo([]byte, *net.UDPAddr) error {
+	return nil
+}
+
+// WriteFrom writes an IPv6 UDP datagram from `addr` to the client. IPv4 source addresses are mapped to IPv6.
+func (c *udp6Conn) WriteFrom(data []byte, addr *net.UDPAddr) (int, error) {
+	src, ok := netip.AddrFromSlice(addr.IP)
+	if !ok {
+		return 0, errors.New("invalid source address")
+	}
+	pkt := makeUDP6Packet(netip.AddrPortFrom(src, uint16(addr.Port)), c.localAddr.AddrPort(), data)
+	if _, err := c.output(pkt); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (*udp6Conn) Close() error {
+	return nil
+}
+
+// parseUDP6Packet returns the addresses and payload of an IPv6 UDP datagram. It returns ok = false if the packet
+// is not an unfragmented IPv6 UDP datagram without extension headers.
+func parseUDP6Packet(pkt []byte) (src, dst netip.AddrPort, payload []byte, ok bool) {
+	if len(pkt) < ipv6HeaderLen+udpHeaderLen || pkt[0]>>4 != 6 || pkt[6] != ipProtocolUDP {
+		return
+	}
+	udp := pkt[ipv6HeaderLen:]
+	udpLen := int(binary.BigEndian.Uint16(udp[4:6]))
+	if udpLen < udpHeaderLen || udpLen > len(udp) {
+		return
+	}
+	srcIP := netip.AddrFrom16([16]byte(pkt[8:24]))
+	dstIP := netip.AddrFrom16([16]byte(pkt[24:40]))
+	src = netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(udp[0:2]))
+	dst = netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(udp[2:4]))
+	return src, dst, udp[udpHeaderLen:udpLen], true
+}
+
+// makeUDP6Packet returns an IPv6 UDP datagram with the given addresses and payload.
+func makeUDP6Packet(src, dst netip.AddrPort, payload []byte) []byte {
+	udpLen := udpHeaderLen + len(payload)
+	pkt := make([]byte, ipv6HeaderLen+udpLen)
+	pkt[0] = 6 << 4
+	binary.BigEndian.PutUint16(pkt[4:6], uint16(udpLen))
+	pkt[6] = ipProtocolUDP
+	pkt[7] = ipv6DefaultHopLimit
+	srcIP, dstIP := src.Addr().As16(), dst.Addr().As16()
+	copy(pkt[8:24], srcIP[:])
+	copy(pkt[24:40], dstIP[:])
+
+	udp := pkt[ipv6HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:2], src.Port())
+	binary.BigEndian.PutUint16(udp[2:4], dst.Port())
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpLen))
+	copy(udp[udpHeaderLen:], payload)
+
+	// The checksum is mandatory in IPv6, and covers the pseudo-header with the addresses, length and protocol.
+	sum := checksumAdd(0, pkt[8:40])
+	sum += uint32(udpLen) + ipProtocolUDP
+	sum = checksumAdd(sum, udp)
+	checksum := ^checksumFold(sum)
+	if checksum == 0 {
+		checksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:8], checksum)
+	return pkt
+}
+
+// checksumAdd adds the 16-bit words of b to the one's complement sum.
+func checksumAdd(sum uint32, b []byte) uint32 {
+	for ; len(b) >= 2; b = b[2:] {
+		sum += uint32(binary.BigEndian.Uint16(b))
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+func checksumFold(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return uint16(sum)
+}
+
+// isNeighborDiscovery returns whether the packet is an ICMPv6 Neighbor Discovery message. The device is a
+// point-to-point interface without link-layer addresses, so it doesn't need Neighbor Discovery, and the messages
+// that lwIP sends, like Router Solicitations, must not reach the network.
+func isNeighborDiscovery(pkt []byte) bool {
+	if len(pkt) < ipv6HeaderLen+1 || pkt[0]>>4 != 6 || pkt[6] != ipProtocolICMPv6 {
+		return false
+	}
+	icmpType := pkt[ipv6HeaderLen]
+	return icmpType >= icmpv6RouterSolicitation && icmpType <= icmpv6Redirect
+}
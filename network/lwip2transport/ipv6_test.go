@@ -0,0 +1,214 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lwip2transport
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPv6UDPRoundTrip(t *testing.T) {
+	proxy := &echoPacketProxy{}
+	dev := reConfigurelwIPDeviceForTest(t, &errTcpUdpHandler{}, proxy)
+	defer dev.Close()
+
+	client := netip.MustParseAddrPort("[fd00::2]:5000")
+	server := netip.MustParseAddrPort("[2001:db8::1]:53")
+	pkt := makeUDP6Packet(client, server, []byte("request"))
+	n, err := dev.Write(pkt)
+	require.NoError(t, err)
+	require.Equal(t, len(pkt), n)
+
+	resp := readPacket(t, dev)
+	src, dst, payload, ok := parseUDP6Packet(resp)
+	require.True(t, ok)
+	require.Equal(t, server, src)
+	require.Equal(t, client, dst)
+	require.Equal(t, []byte("request"), payload)
+	require.Equal(t, []netip.AddrPort{server}, proxy.destinations())
+}
+
+func TestIPv6UDPMapsIPv4Source(t *testing.T) {
+	var out []byte
+	conn := &udp6Conn{
+		localAddr: net.UDPAddrFromAddrPort(netip.MustParseAddrPort("[fd00::2]:5000")),
+		output: func(b []byte) (int, error) {
+			out = b
+			return len(b), nil
+		},
+	}
+	n, err := conn.WriteFrom([]byte("response"), &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4).To4(), Port: 53})
+	require.NoError(t, err)
+	require.Equal(t, 8, n)
+
+	src, _, payload, ok := parseUDP6Packet(out)
+	require.True(t, ok)
+	require.Equal(t, netip.MustParseAddrPort("[::ffff:1.2.3.4]:53"), src)
+	require.Equal(t, []byte("response"), payload)
+}
+
+func TestMakeUDP6PacketChecksum(t *testing.T) {
+	pkt := makeUDP6Packet(netip.MustParseAddrPort("[2001:db8::1]:53"), netip.MustParseAddrPort("[fd00::2]:5000"), []byte("odd"))
+	require.Len(t, pkt, ipv6HeaderLen+udpHeaderLen+3)
+
+	// The checksum over the pseudo-header and the datagram, including the checksum field, must be all ones.
+	udp := pkt[ipv6HeaderLen:]
+	sum := checksumAdd(0, pkt[8:40])
+	sum += uint32(len(udp)) + ipProtocolUDP
+	sum = checksumAdd(sum, udp)
+	require.Equal(t, uint16(0xffff), checksumFold(sum))
+}
+
+func TestParseUDP6PacketRejectsOtherPackets(t *testing.T) {
+	pkt := makeUDP6Packet(netip.MustParseAddrPort("[fd00::2]:5000"), netip.MustParseAddrPort("[2001:db8::1]:53"), []byte("x"))
+
+	_, _, _, ok := parseUDP6Packet(pkt[:ipv6HeaderLen+4])
+	require.False(t, ok)
+
+	tcp := append([]byte{}, pkt...)
+	tcp[6] = 6
+	_, _, _, ok = parseUDP6Packet(tcp)
+	require.False(t, ok)
+
+	// Fragment extension header
+	frag := append([]byte{}, pkt...)
+	frag[6] = 44
+	_, _, _, ok = parseUDP6Packet(frag)
+	require.False(t, ok)
+
+	badLen := append([]byte{}, pkt...)
+	binary.BigEndian.PutUint16(badLen[ipv6HeaderLen+4:], 100)
+	_, _, _, ok = parseUDP6Packet(badLen)
+	require.False(t, ok)
+}
+
+func TestStackModeDropsPackets(t *testing.T) {
+	proxy := &echoPacketProxy{}
+	dev, err := ConfigureDeviceWithOptions(&errTcpUdpHandler{}, proxy, WithStackMode(IPv4Only))
+	require.NoError(t, err)
+	defer dev.Close()
+
+	pkt := makeUDP6Packet(netip.MustParseAddrPort("[fd00::2]:5000"), netip.MustParseAddrPort("[2001:db8::1]:53"), []byte("x"))
+	n, err := dev.Write(pkt)
+	require.NoError(t, err)
+	require.Equal(t, len(pkt), n)
+	require.Empty(t, proxy.destinations())
+
+	dev, err = ConfigureDeviceWithOptions(&errTcpUdpHandler{}, proxy, WithStackMode(IPv6Only))
+	require.NoError(t, err)
+	defer dev.Close()
+	pkt = []byte{0x45, 0, 0, 20, 0, 0, 0, 0, 64, 17, 0, 0, 10, 0, 0, 2, 8, 8, 8, 8}
+	n, err = dev.Write(pkt)
+	require.NoError(t, err)
+	require.Equal(t, len(pkt), n)
+	require.Empty(t, proxy.destinations())
+}
+
+func TestWithStackModeInvalid(t *testing.T) {
+	_, err := ConfigureDeviceWithOptions(&errTcpUdpHandler{}, &echoPacketProxy{}, WithStackMode(StackMode(7)))
+	require.Error(t, err)
+}
+
+func TestStackModeString(t *testing.T) {
+	require.Equal(t, "dual-stack", DualStack.String())
+	require.Equal(t, "ipv4-only", IPv4Only.String())
+	require.Equal(t, "ipv6-only", IPv6Only.String())
+	require.Equal(t, "StackMode(7)", StackMode(7).String())
+}
+
+func TestNeighborDiscoveryNotForwarded(t *testing.T) {
+	dev := reConfigurelwIPDeviceForTest(t, &errTcpUdpHandler{}, &echoPacketProxy{})
+	defer dev.Close()
+
+	// Router Solicitation from ::1 to ff02::2
+	rs := make([]byte, ipv6HeaderLen+16)
+	rs[0] = 0x60
+	rs[6] = ipProtocolICMPv6
+	rs[ipv6HeaderLen] = icmpv6RouterSolicitation
+	require.True(t, isNeighborDiscovery(rs))
+
+	// It must return without waiting for a reader.
+	n, err := dev.forwardOutgoingIPPacket(rs)
+	require.NoError(t, err)
+	require.Equal(t, len(rs), n)
+
+	// Echo replies are not Neighbor Discovery.
+	rs[ipv6HeaderLen] = 129
+	require.False(t, isNeighborDiscovery(rs))
+}
+
+/********** Test Utilities **********/
+
+func readPacket(t *testing.T, dev *lwIPDevice) []byte {
+	type result struct {
+		pkt []byte
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		buf := make([]byte, dev.MTU())
+		n, err := dev.Read(buf)
+		ch <- result{buf[:n], err}
+	}()
+	select {
+	case r := <-ch:
+		require.NoError(t, r.err)
+		return r.pkt
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out reading packet")
+		return nil
+	}
+}
+
+// echoPacketProxy sends every packet back to the client, from its destination.
+type echoPacketProxy struct {
+	mu    sync.Mutex
+	dests []netip.AddrPort
+}
+
+func (p *echoPacketProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	return &echoPacketSender{proxy: p, respWriter: respWriter}, nil
+}
+
+func (p *echoPacketProxy) destinations() []netip.AddrPort {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]netip.AddrPort(nil), p.dests...)
+}
+
+type echoPacketSender struct {
+	proxy      *echoPacketProxy
+	respWriter network.PacketResponseReceiver
+}
+
+func (s *echoPacketSender) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	s.proxy.mu.Lock()
+	s.proxy.dests = append(s.proxy.dests, destination)
+	s.proxy.mu.Unlock()
+	resp := append([]byte(nil), p...)
+	go s.respWriter.WriteFrom(resp, net.UDPAddrFromAddrPort(destination))
+	return len(p), nil
+}
+
+func (s *echoPacketSender) Close() error {
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport/nat64"
+)
+
+// Compilation guard against interface implementation
+var _ PacketProxy = (*nat64PacketProxy)(nil)
+var _ PacketRequestSender = (*nat64Session)(nil)
+var _ PacketResponseReceiver = (*nat64Receiver)(nil)
+
+type nat64PacketProxy struct {
+	proxy  PacketProxy
+	prefix netip.Prefix
+}
+
+// NewNAT64PacketProxy creates a [PacketProxy] that translates the UDP packets sent to the IPv6 addresses of the
+// NAT64 prefix into packets to the IPv4 address they embed, and the responses back, as per [RFC 6052]. Use it
+// with a DNS64 resolver, like the one from [dns.NewDNS64Resolver], to let clients on IPv6-only networks reach
+// IPv4-only destinations through `proxy`, even if the remote end has no NAT64 gateway. Other packets are
+// forwarded unchanged.
+//
+// [RFC 6052]: https://datatracker.ietf.org/doc/html/rfc6052
+func NewNAT64PacketProxy(proxy PacketProxy, prefix netip.Prefix) (PacketProxy, error) {
+	if proxy == nil {
+		return nil, errors.New("argument proxy must not be nil")
+	}
+	if err := nat64.ValidatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	return &nat64PacketProxy{proxy: proxy, prefix: prefix}, nil
+}
+
+// NewSession implements [PacketProxy].NewSession.
+func (p *nat64PacketProxy) NewSession(respWriter PacketResponseReceiver) (PacketRequestSender, error) {
+	if respWriter == nil {
+		return nil, errors.New("respWriter is required")
+	}
+	receiver := &nat64Receiver{
+		respWriter: respWriter,
+		prefix:     p.prefix,
+		translated: make(map[netip.AddrPort]struct{}),
+	}
+	sender, err := p.proxy.NewSession(receiver)
+	if err != nil {
+		return nil, err
+	}
+	return &nat64Session{sender: sender, receiver: receiver}, nil
+}
+
+type nat64Session struct {
+	sender   PacketRequestSender
+	receiver *nat64Receiver
+}
+
+// WriteTo implements [PacketRequestSender].WriteTo. Destinations in the NAT64 prefix are translated to IPv4.
+func (s *nat64Session) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	if ipv4, ok := nat64.Extract(s.receiver.prefix, destination.Addr()); ok {
+		destination = netip.AddrPortFrom(ipv4, destination.Port())
+		s.receiver.addTranslated(destination)
+	}
+	return s.sender.WriteTo(p, destination)
+}
+
+// Close implements [PacketRequestSender].Close.
+func (s *nat64Session) Close() error {
+	return s.sender.Close()
+}
+
+// nat64Receiver translates the sources of responses from the IPv4 destinations that were translated back to
+// their NAT64 addresses, so clients see responses from the addresses they sent to.
+type nat64Receiver struct {
+	respWriter PacketResponseReceiver
+	prefix     netip.Prefix
+
+	mu         sync.Mutex
+	translated map[netip.AddrPort]struct{}
+}
+
+func (r *nat64Receiver) addTranslated(destination netip.AddrPort) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.translated[destination] = struct{}{}
+}
+
+func (r *nat64Receiver) isTranslated(source netip.AddrPort) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.translated[source]
+	return ok
+}
+
+// WriteFrom implements [PacketResponseReceiver].WriteFrom.
+func (r *nat64Receiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	sourceAddr, err := netip.ParseAddrPort(source.String())
+	if err == nil {
+		sourceAddr = netip.AddrPortFrom(sourceAddr.Addr().Unmap(), sourceAddr.Port())
+		if r.isTranslated(sourceAddr) {
+			if ipv6, err := nat64.Synthesize(r.prefix, sourceAddr.Addr()); err == nil {
+				source = net.UDPAddrFromAddrPort(netip.AddrPortFrom(ipv6, sourceAddr.Port()))
+			}
+		}
+	}
+	return r.respWriter.WriteFrom(p, source)
+}
+
+// Close implements [PacketResponseReceiver].Close.
+func (r *nat64Receiver) Close() error {
+	return r.respWriter.Close()
+}
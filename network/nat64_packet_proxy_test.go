@@ -0,0 +1,102 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNAT64PacketProxyTranslates(t *testing.T) {
+	var destinations []netip.AddrPort
+	base := &echoPacketProxy{name: "echo"}
+	recorder := &destinationRecordingProxy{proxy: base, destinations: &destinations}
+	proxy, err := NewNAT64PacketProxy(recorder, netip.MustParsePrefix("64:ff9b::/96"))
+	require.NoError(t, err)
+
+	receiver := &sourceRecordingReceiver{}
+	session, err := proxy.NewSession(receiver)
+	require.NoError(t, err)
+	defer session.Close()
+
+	// Destinations in the prefix are sent to IPv4, and the responses come from the NAT64 address.
+	_, err = session.WriteTo([]byte("q"), netip.MustParseAddrPort("[64:ff9b::192.0.2.33]:53"))
+	require.NoError(t, err)
+	// Other destinations are not translated.
+	_, err = session.WriteTo([]byte("q"), netip.MustParseAddrPort("[2001:db8::1]:53"))
+	require.NoError(t, err)
+	_, err = session.WriteTo([]byte("q"), netip.MustParseAddrPort("198.51.100.1:53"))
+	require.NoError(t, err)
+
+	require.Equal(t, []netip.AddrPort{
+		netip.MustParseAddrPort("192.0.2.33:53"),
+		netip.MustParseAddrPort("[2001:db8::1]:53"),
+		netip.MustParseAddrPort("198.51.100.1:53"),
+	}, destinations)
+	require.Equal(t, []string{"[64:ff9b::c000:221]:53", "[2001:db8::1]:53", "198.51.100.1:53"}, receiver.sources)
+}
+
+func TestNewNAT64PacketProxyInvalid(t *testing.T) {
+	_, err := NewNAT64PacketProxy(nil, netip.MustParsePrefix("64:ff9b::/96"))
+	require.Error(t, err)
+	_, err = NewNAT64PacketProxy(&echoPacketProxy{}, netip.MustParsePrefix("64:ff9b::/95"))
+	require.Error(t, err)
+
+	proxy, err := NewNAT64PacketProxy(&echoPacketProxy{}, netip.MustParsePrefix("64:ff9b::/96"))
+	require.NoError(t, err)
+	_, err = proxy.NewSession(nil)
+	require.Error(t, err)
+}
+
+// destinationRecordingProxy records the destinations of the packets sent to proxy.
+type destinationRecordingProxy struct {
+	proxy        PacketProxy
+	destinations *[]netip.AddrPort
+}
+
+func (p *destinationRecordingProxy) NewSession(respWriter PacketResponseReceiver) (PacketRequestSender, error) {
+	sender, err := p.proxy.NewSession(respWriter)
+	if err != nil {
+		return nil, err
+	}
+	return &destinationRecordingSession{PacketRequestSender: sender, destinations: p.destinations}, nil
+}
+
+type destinationRecordingSession struct {
+	PacketRequestSender
+	destinations *[]netip.AddrPort
+}
+
+func (s *destinationRecordingSession) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	*s.destinations = append(*s.destinations, destination)
+	return s.PacketRequestSender.WriteTo(p, destination)
+}
+
+// sourceRecordingReceiver records the sources of the responses.
+type sourceRecordingReceiver struct {
+	sources []string
+}
+
+func (r *sourceRecordingReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	r.sources = append(r.sources, source.String())
+	return len(p), nil
+}
+
+func (r *sourceRecordingReceiver) Close() error {
+	return nil
+}
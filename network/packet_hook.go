@@ -0,0 +1,128 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PacketDirection is the direction of an IP packet passing through an [IPDevice].
+type PacketDirection int
+
+const (
+	// PacketInbound is a packet written to the device, for example by the TUN interface.
+	PacketInbound PacketDirection = iota
+	// PacketOutbound is a packet read from the device, for example a response to be written back to the TUN
+	// interface.
+	PacketOutbound
+)
+
+// String implements [fmt.Stringer].
+func (d PacketDirection) String() string {
+	switch d {
+	case PacketInbound:
+		return "inbound"
+	case PacketOutbound:
+		return "outbound"
+	default:
+		return fmt.Sprintf("PacketDirection(%d)", int(d))
+	}
+}
+
+// PacketHook observes or rewrites the raw IP packets passing through an [IPDevice]. It can be used for debugging,
+// policy enforcement or custom NAT. Use [NewHookedIPDevice] to install a PacketHook on a device.
+//
+// The packets are not copied, so the hook must follow these ownership rules:
+//   - The pkt slice is only valid during the HandlePacket call. The hook must copy it to keep it after returning.
+//   - A [PacketInbound] pkt is the buffer passed to Write, which belongs to the caller. The hook must not modify it.
+//     To rewrite the packet, the hook must return a new slice instead.
+//   - An [PacketOutbound] pkt is the buffer passed to Read, so the hook may modify it in place, and return it or a
+//     sub-slice of it. It may also return a new slice, which will be copied to the buffer, and truncated if the buffer
+//     is too small.
+//   - A returned slice other than pkt belongs to the hook again once HandlePacket is called for the next packet in
+//     the same direction.
+type PacketHook interface {
+	// HandlePacket is called with every IP packet passing through the device in the given direction. It returns the
+	// packet to pass on, which may be pkt itself, or nil to drop the packet.
+	//
+	// HandlePacket is called by the goroutines calling Read and Write on the device, so it can be called concurrently
+	// for packets of different directions.
+	HandlePacket(dir PacketDirection, pkt []byte) []byte
+}
+
+// FuncPacketHook is a [PacketHook] that uses the given function to handle packets.
+type FuncPacketHook func(dir PacketDirection, pkt []byte) []byte
+
+var _ PacketHook = (*FuncPacketHook)(nil)
+
+// HandlePacket implements [PacketHook].
+func (f FuncPacketHook) HandlePacket(dir PacketDirection, pkt []byte) []byte {
+	return f(dir, pkt)
+}
+
+// Compilation guard against interface implementation
+var _ IPDevice = (*hookedIPDevice)(nil)
+
+type hookedIPDevice struct {
+	IPDevice
+	hook PacketHook
+}
+
+// NewHookedIPDevice returns an [IPDevice] that passes all the packets written to and read from `device` through
+// `hook`. Dropped packets are reported as successfully written to the device, and are skipped by Read.
+//
+// The returned device doesn't implement [io.ReaderFrom] or [io.WriterTo], since the hook needs to see each packet.
+func NewHookedIPDevice(device IPDevice, hook PacketHook) (IPDevice, error) {
+	if device == nil {
+		return nil, errors.New("device must not be nil")
+	}
+	if hook == nil {
+		return nil, errors.New("hook must not be nil")
+	}
+	return &hookedIPDevice{IPDevice: device, hook: hook}, nil
+}
+
+// Read implements [IPDevice]. It reads packets from the underlying device until the hook accepts one.
+func (d *hookedIPDevice) Read(p []byte) (int, error) {
+	for {
+		n, err := d.IPDevice.Read(p)
+		if err != nil {
+			return n, err
+		}
+		out := d.hook.HandlePacket(PacketOutbound, p[:n])
+		if out == nil {
+			continue
+		}
+		return copy(p, out), nil
+	}
+}
+
+// Write implements [IPDevice]. It writes the packet returned by the hook to the underlying device.
+func (d *hookedIPDevice) Write(b []byte) (int, error) {
+	out := d.hook.HandlePacket(PacketInbound, b)
+	if out == nil {
+		return len(b), nil
+	}
+	n, err := d.IPDevice.Write(out)
+	if err != nil {
+		if len(out) != len(b) {
+			// The partial count is meaningless to the caller when the hook rewrote the packet.
+			return 0, err
+		}
+		return n, err
+	}
+	return len(b), nil
+}
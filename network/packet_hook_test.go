@@ -0,0 +1,171 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookedIPDeviceObservesPackets(t *testing.T) {
+	dev := &fakeIPDevice{toRead: [][]byte{{4, 5, 6}}}
+	var seen []string
+	hooked, err := NewHookedIPDevice(dev, FuncPacketHook(func(dir PacketDirection, pkt []byte) []byte {
+		seen = append(seen, fmt.Sprintf("%v:%d", dir, pkt[0]))
+		return pkt
+	}))
+	require.NoError(t, err)
+
+	n, err := hooked.Write([]byte{1, 2, 3})
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, [][]byte{{1, 2, 3}}, dev.written)
+
+	buf := make([]byte, 10)
+	n, err = hooked.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte{4, 5, 6}, buf[:n])
+
+	require.Equal(t, []string{"inbound:1", "outbound:4"}, seen)
+}
+
+func TestHookedIPDeviceRewritesPackets(t *testing.T) {
+	dev := &fakeIPDevice{toRead: [][]byte{{4, 5, 6}}}
+	hooked, err := NewHookedIPDevice(dev, FuncPacketHook(func(dir PacketDirection, pkt []byte) []byte {
+		if dir == PacketInbound {
+			// Inbound packets belong to the caller, so return a new one.
+			return append([]byte{0}, pkt...)
+		}
+		// Outbound packets can be modified in place.
+		pkt[0] = 9
+		return pkt[:2]
+	}))
+	require.NoError(t, err)
+
+	in := []byte{1, 2, 3}
+	n, err := hooked.Write(in)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, []byte{1, 2, 3}, in)
+	require.Equal(t, [][]byte{{0, 1, 2, 3}}, dev.written)
+
+	buf := make([]byte, 10)
+	n, err = hooked.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte{9, 5}, buf[:n])
+}
+
+func TestHookedIPDeviceTruncatesLongOutboundPackets(t *testing.T) {
+	dev := &fakeIPDevice{toRead: [][]byte{{1}}}
+	hooked, err := NewHookedIPDevice(dev, FuncPacketHook(func(dir PacketDirection, pkt []byte) []byte {
+		return []byte{1, 2, 3, 4}
+	}))
+	require.NoError(t, err)
+
+	buf := make([]byte, 2)
+	n, err := hooked.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, buf[:n])
+}
+
+func TestHookedIPDeviceDropsPackets(t *testing.T) {
+	dev := &fakeIPDevice{toRead: [][]byte{{1}, {2}}}
+	hooked, err := NewHookedIPDevice(dev, FuncPacketHook(func(dir PacketDirection, pkt []byte) []byte {
+		if pkt[0] == 1 {
+			return nil
+		}
+		return pkt
+	}))
+	require.NoError(t, err)
+
+	n, err := hooked.Write([]byte{1})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Empty(t, dev.written)
+
+	buf := make([]byte, 10)
+	n, err = hooked.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte{2}, buf[:n])
+
+	_, err = hooked.Read(buf)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestHookedIPDeviceWriteError(t *testing.T) {
+	dev := &fakeIPDevice{writeErr: ErrMsgSize}
+	hooked, err := NewHookedIPDevice(dev, FuncPacketHook(func(dir PacketDirection, pkt []byte) []byte {
+		return bytes.Repeat(pkt, 2)
+	}))
+	require.NoError(t, err)
+
+	n, err := hooked.Write([]byte{1, 2})
+	require.ErrorIs(t, err, ErrMsgSize)
+	require.Equal(t, 0, n)
+}
+
+func TestNewHookedIPDeviceNil(t *testing.T) {
+	hook := FuncPacketHook(func(dir PacketDirection, pkt []byte) []byte { return pkt })
+	_, err := NewHookedIPDevice(nil, hook)
+	require.Error(t, err)
+	_, err = NewHookedIPDevice(&fakeIPDevice{}, nil)
+	require.Error(t, err)
+}
+
+func TestPacketDirectionString(t *testing.T) {
+	require.Equal(t, "inbound", PacketInbound.String())
+	require.Equal(t, "outbound", PacketOutbound.String())
+	require.Equal(t, "PacketDirection(5)", PacketDirection(5).String())
+}
+
+/********** Test Utilities **********/
+
+// fakeIPDevice returns the packets in toRead, and records the written packets.
+type fakeIPDevice struct {
+	toRead   [][]byte
+	written  [][]byte
+	writeErr error
+}
+
+var _ IPDevice = (*fakeIPDevice)(nil)
+
+func (d *fakeIPDevice) Read(p []byte) (int, error) {
+	if len(d.toRead) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, d.toRead[0])
+	d.toRead = d.toRead[1:]
+	return n, nil
+}
+
+func (d *fakeIPDevice) Write(b []byte) (int, error) {
+	if d.writeErr != nil {
+		return 1, d.writeErr
+	}
+	d.written = append(d.written, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (d *fakeIPDevice) Close() error {
+	return nil
+}
+
+func (d *fakeIPDevice) MTU() int {
+	return 1500
+}
@@ -0,0 +1,35 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package quicblock provides a [network.PacketProxy] that blocks QUIC traffic, so that apps fall back to TCP.
+
+Browsers and other apps try HTTP/3 over QUIC (UDP port 443) before, or in parallel with, HTTP over TCP. That is a
+problem when only TCP traffic can be tunneled, or when the UDP path is much slower: the apps will wait for QUIC to
+time out. Blocking QUIC makes them use TCP right away.
+
+To block QUIC and send the remaining UDP traffic to another proxy:
+
+	proxy, err := quicblock.NewPacketProxy(udpProxy)
+	if err != nil {
+		// handle error
+	}
+
+This `proxy` can then be used in, for example, lwip2transport.ConfigureDevice.
+
+The QUIC packets are rejected with an error wrapping [network.ErrPortUnreachable]. A network stack may translate that
+into an ICMP port unreachable message, which makes apps give up on QUIC immediately. Network stacks that can't do that,
+like [network/lwip2transport], drop the packets instead.
+*/
+package quicblock
@@ -0,0 +1,74 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicblock
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+)
+
+// QUICPort is the UDP port used by HTTP/3. See https://datatracker.ietf.org/doc/html/rfc9114#section-3.1.
+const QUICPort = uint16(443)
+
+// NewPacketProxy creates a new [network.PacketProxy] that rejects UDP traffic to [QUICPort] with an error wrapping
+// [network.ErrPortUnreachable], and forwards all other UDP traffic to `base`. If `base` is nil, all UDP traffic other
+// than QUIC is rejected as well.
+func NewPacketProxy(base network.PacketProxy) (network.PacketProxy, error) {
+	return network.NewPacketRouter([]network.PacketRoute{
+		{Match: network.MatchPorts(QUICPort), Proxy: &blockPacketProxy{}},
+	}, base)
+}
+
+// blockPacketProxy is a [network.PacketProxy] that rejects all requests.
+type blockPacketProxy struct{}
+
+// blockRequestSender is a [network.PacketRequestSender] that rejects all requests.
+type blockRequestSender struct {
+	closed     atomic.Bool
+	respWriter network.PacketResponseReceiver
+}
+
+// Compilation guard against interface implementation
+var _ network.PacketProxy = (*blockPacketProxy)(nil)
+var _ network.PacketRequestSender = (*blockRequestSender)(nil)
+
+// NewSession implements [network.PacketProxy].NewSession().
+func (p *blockPacketProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	if respWriter == nil {
+		return nil, errors.New("respWriter is required")
+	}
+	return &blockRequestSender{respWriter: respWriter}, nil
+}
+
+// WriteTo implements [network.PacketRequestSender].WriteTo(). It always fails.
+func (s *blockRequestSender) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	if s.closed.Load() {
+		return 0, network.ErrClosed
+	}
+	return 0, fmt.Errorf("UDP traffic to %v is blocked: %w", destination, network.ErrPortUnreachable)
+}
+
+// Close implements [network.PacketRequestSender].Close(), and it closes the corresponding
+// [network.PacketResponseReceiver].
+func (s *blockRequestSender) Close() error {
+	if !s.closed.CompareAndSwap(false, true) {
+		return network.ErrClosed
+	}
+	return s.respWriter.Close()
+}
@@ -0,0 +1,98 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicblock
+
+import (
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQUICIsBlocked(t *testing.T) {
+	base := &countPacketProxy{}
+	proxy, err := NewPacketProxy(base)
+	require.NoError(t, err)
+	receiver := &closeTrackingReceiver{}
+	sender, err := proxy.NewSession(receiver)
+	require.NoError(t, err)
+
+	for _, dest := range []string{"1.2.3.4:443", "[2001:db8::1]:443"} {
+		n, err := sender.WriteTo([]byte("quic"), netip.MustParseAddrPort(dest))
+		require.ErrorIs(t, err, network.ErrPortUnreachable)
+		require.Zero(t, n)
+	}
+	require.Zero(t, base.writes.Load())
+
+	n, err := sender.WriteTo([]byte("dns"), netip.MustParseAddrPort("1.2.3.4:53"))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, int32(1), base.writes.Load())
+
+	require.NoError(t, sender.Close())
+	require.True(t, receiver.closed.Load())
+}
+
+func TestNilBaseBlocksEverything(t *testing.T) {
+	proxy, err := NewPacketProxy(nil)
+	require.NoError(t, err)
+	sender, err := proxy.NewSession(&closeTrackingReceiver{})
+	require.NoError(t, err)
+	defer sender.Close()
+
+	_, err = sender.WriteTo([]byte("quic"), netip.MustParseAddrPort("1.2.3.4:443"))
+	require.ErrorIs(t, err, network.ErrPortUnreachable)
+	_, err = sender.WriteTo([]byte("dns"), netip.MustParseAddrPort("1.2.3.4:53"))
+	require.ErrorIs(t, err, network.ErrPortUnreachable)
+}
+
+// countPacketProxy counts the packets written to its sessions.
+type countPacketProxy struct {
+	writes atomic.Int32
+}
+
+func (p *countPacketProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	return &countRequestSender{proxy: p, respWriter: respWriter}, nil
+}
+
+type countRequestSender struct {
+	proxy      *countPacketProxy
+	respWriter network.PacketResponseReceiver
+}
+
+func (s *countRequestSender) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	s.proxy.writes.Add(1)
+	return len(p), nil
+}
+
+func (s *countRequestSender) Close() error {
+	return s.respWriter.Close()
+}
+
+type closeTrackingReceiver struct {
+	closed atomic.Bool
+}
+
+func (r *closeTrackingReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	return len(p), nil
+}
+
+func (r *closeTrackingReceiver) Close() error {
+	r.closed.Store(true)
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+)
+
+// PacketRouteMatcher reports whether the UDP packets sent to `destination` should be handled by a [PacketRoute].
+type PacketRouteMatcher func(destination netip.AddrPort) bool
+
+// MatchPorts returns a [PacketRouteMatcher] that matches destinations with any of the given ports.
+func MatchPorts(ports ...uint16) PacketRouteMatcher {
+	return func(destination netip.AddrPort) bool {
+		for _, port := range ports {
+			if destination.Port() == port {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchPrefixes returns a [PacketRouteMatcher] that matches destinations with an IP address in any of the given
+// prefixes. IPv4-mapped IPv6 destinations are matched against IPv4 prefixes.
+func MatchPrefixes(prefixes ...netip.Prefix) PacketRouteMatcher {
+	return func(destination netip.AddrPort) bool {
+		ip := destination.Addr().Unmap()
+		for _, prefix := range prefixes {
+			if prefix.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PacketRoute sends the UDP packets whose destination matches Match to Proxy.
+type PacketRoute struct {
+	Match PacketRouteMatcher
+	Proxy PacketProxy
+}
+
+// Compilation guard against interface implementation
+var _ PacketProxy = (*packetRouter)(nil)
+var _ PacketRequestSender = (*packetRouterSession)(nil)
+var _ PacketResponseReceiver = (*packetRouteReceiver)(nil)
+
+type packetRouter struct {
+	routes       []PacketRoute
+	defaultProxy PacketProxy
+}
+
+// NewPacketRouter creates a [PacketProxy] that routes each UDP packet to the [PacketProxy] of the first route that
+// matches its destination, or to `defaultProxy` if none does. For example, you can send port 53 to a DNS handler,
+// port 443 to a proxy that blocks QUIC, and everything else to a direct [PacketProxy]:
+//
+//	router, err := network.NewPacketRouter([]network.PacketRoute{
+//		{Match: network.MatchPorts(53), Proxy: dnsProxy},
+//		{Match: network.MatchPorts(443), Proxy: quicProxy},
+//	}, directProxy)
+//
+// If `defaultProxy` is nil, packets that match no route are rejected with [ErrPortUnreachable].
+//
+// Each session of the router creates a session on a route's [PacketProxy] the first time a packet is sent to it. All
+// those sessions share the [PacketResponseReceiver] of the router session, which is closed when the router session is
+// closed.
+func NewPacketRouter(routes []PacketRoute, defaultProxy PacketProxy) (PacketProxy, error) {
+	for i, route := range routes {
+		if route.Match == nil {
+			return nil, fmt.Errorf("route %v must have a matcher", i)
+		}
+		if route.Proxy == nil {
+			return nil, fmt.Errorf("route %v must have a proxy", i)
+		}
+	}
+	return &packetRouter{
+		routes:       append([]PacketRoute(nil), routes...),
+		defaultProxy: defaultProxy,
+	}, nil
+}
+
+// NewSession implements [PacketProxy].NewSession.
+func (r *packetRouter) NewSession(respWriter PacketResponseReceiver) (PacketRequestSender, error) {
+	if respWriter == nil {
+		return nil, errors.New("respWriter is required")
+	}
+	return &packetRouterSession{
+		router:     r,
+		respWriter: respWriter,
+		routes:     make(map[int]*packetRouteSession),
+	}, nil
+}
+
+// route returns the index and proxy of the route for destination. The default proxy has index len(r.routes).
+func (r *packetRouter) route(destination netip.AddrPort) (int, PacketProxy) {
+	for i, route := range r.routes {
+		if route.Match(destination) {
+			return i, route.Proxy
+		}
+	}
+	return len(r.routes), r.defaultProxy
+}
+
+// packetRouterSession is the [PacketRequestSender] returned by the router. It holds a downstream session for each
+// route in use.
+type packetRouterSession struct {
+	router     *packetRouter
+	respWriter PacketResponseReceiver
+
+	mu     sync.Mutex
+	closed bool
+	routes map[int]*packetRouteSession
+}
+
+type packetRouteSession struct {
+	sender   PacketRequestSender
+	receiver *packetRouteReceiver
+}
+
+// WriteTo implements [PacketRequestSender].WriteTo. It forwards the packet to the session of the matching route.
+func (s *packetRouterSession) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	sender, err := s.sender(destination)
+	if err != nil {
+		return 0, err
+	}
+	return sender.WriteTo(p, destination)
+}
+
+func (s *packetRouterSession) sender(destination netip.AddrPort) (PacketRequestSender, error) {
+	index, proxy := s.router.route(destination)
+	if proxy == nil {
+		return nil, fmt.Errorf("no route for UDP traffic to %v: %w", destination, ErrPortUnreachable)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if route, ok := s.routes[index]; ok {
+		return route.sender, nil
+	}
+	receiver := &packetRouteReceiver{session: s, index: index}
+	sender, err := proxy.NewSession(receiver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session for route: %w", err)
+	}
+	s.routes[index] = &packetRouteSession{sender: sender, receiver: receiver}
+	return sender, nil
+}
+
+// Close implements [PacketRequestSender].Close. It closes the sessions of all routes, and the
+// [PacketResponseReceiver] of the router session.
+func (s *packetRouterSession) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	routes := s.routes
+	s.routes = nil
+	s.mu.Unlock()
+
+	var errs []error
+	for _, route := range routes {
+		// Stop forwarding responses even if the downstream proxy doesn't close the receiver.
+		route.receiver.closed.Store(true)
+		if err := route.sender.Close(); err != nil && !errors.Is(err, ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	if err := s.respWriter.Close(); err != nil && !errors.Is(err, ErrClosed) {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// packetRouteReceiver is the [PacketResponseReceiver] given to the session of a route. It forwards responses to the
+// receiver of the router session, and closing it only ends the session of the route.
+type packetRouteReceiver struct {
+	session *packetRouterSession
+	index   int
+	closed  atomic.Bool
+}
+
+// WriteFrom implements [PacketResponseReceiver].WriteFrom.
+func (r *packetRouteReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	if r.closed.Load() {
+		return 0, ErrClosed
+	}
+	return r.session.respWriter.WriteFrom(p, source)
+}
+
+// Close implements [PacketResponseReceiver].Close. The session of the route is dropped, so that a new one is created
+// for the next packet to the route.
+func (r *packetRouteReceiver) Close() error {
+	if !r.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+	r.session.mu.Lock()
+	defer r.session.mu.Unlock()
+	if route, ok := r.session.routes[r.index]; ok && route.receiver == r {
+		delete(r.session.routes, r.index)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketRouterRoutesByDestination(t *testing.T) {
+	dnsProxy := &echoPacketProxy{name: "dns"}
+	quicProxy := &echoPacketProxy{name: "quic"}
+	lanProxy := &echoPacketProxy{name: "lan"}
+	defProxy := &echoPacketProxy{name: "default"}
+	router, err := NewPacketRouter([]PacketRoute{
+		{Match: MatchPorts(53), Proxy: dnsProxy},
+		{Match: MatchPorts(443, 8443), Proxy: quicProxy},
+		{Match: MatchPrefixes(netip.MustParsePrefix("192.168.0.0/16")), Proxy: lanProxy},
+	}, defProxy)
+	require.NoError(t, err)
+
+	receiver := &recordingPacketReceiver{}
+	sender, err := router.NewSession(receiver)
+	require.NoError(t, err)
+
+	for dest, expected := range map[string]string{
+		"8.8.8.8:53":               "dns",
+		"192.168.1.1:53":           "dns",
+		"1.1.1.1:443":              "quic",
+		"[2001:db8::1]:8443":       "quic",
+		"192.168.1.1:123":          "lan",
+		"[::ffff:192.168.1.1]:123": "lan",
+		"1.1.1.1:123":              "default",
+	} {
+		n, err := sender.WriteTo([]byte("req"), netip.MustParseAddrPort(dest))
+		require.NoError(t, err)
+		require.Equal(t, 3, n)
+		require.Equal(t, expected, receiver.Last(), dest)
+	}
+	// Sessions are created once per route.
+	require.Equal(t, 1, dnsProxy.Sessions())
+	require.Equal(t, 1, quicProxy.Sessions())
+	require.Equal(t, 1, lanProxy.Sessions())
+	require.Equal(t, 1, defProxy.Sessions())
+
+	require.NoError(t, sender.Close())
+	require.True(t, receiver.Closed())
+	_, err = sender.WriteTo([]byte("req"), netip.MustParseAddrPort("8.8.8.8:53"))
+	require.ErrorIs(t, err, ErrClosed)
+	require.ErrorIs(t, sender.Close(), ErrClosed)
+}
+
+func TestPacketRouterWithoutDefault(t *testing.T) {
+	router, err := NewPacketRouter([]PacketRoute{{Match: MatchPorts(53), Proxy: &echoPacketProxy{name: "dns"}}}, nil)
+	require.NoError(t, err)
+	sender, err := router.NewSession(&recordingPacketReceiver{})
+	require.NoError(t, err)
+	defer sender.Close()
+
+	_, err = sender.WriteTo([]byte("req"), netip.MustParseAddrPort("8.8.8.8:123"))
+	require.ErrorIs(t, err, ErrPortUnreachable)
+	_, err = sender.WriteTo([]byte("req"), netip.MustParseAddrPort("8.8.8.8:53"))
+	require.NoError(t, err)
+}
+
+func TestPacketRouterRecreatesClosedRouteSession(t *testing.T) {
+	proxy := &echoPacketProxy{name: "dns"}
+	router, err := NewPacketRouter(nil, proxy)
+	require.NoError(t, err)
+	receiver := &recordingPacketReceiver{}
+	sender, err := router.NewSession(receiver)
+	require.NoError(t, err)
+
+	_, err = sender.WriteTo([]byte("req"), netip.MustParseAddrPort("8.8.8.8:53"))
+	require.NoError(t, err)
+	// The downstream session ends by itself, which must not close the router session.
+	require.NoError(t, proxy.LastReceiver().Close())
+	require.False(t, receiver.Closed())
+
+	_, err = sender.WriteTo([]byte("req"), netip.MustParseAddrPort("8.8.8.8:53"))
+	require.NoError(t, err)
+	require.Equal(t, 2, proxy.Sessions())
+	require.NoError(t, sender.Close())
+	require.True(t, receiver.Closed())
+}
+
+func TestNewPacketRouterWithInvalidRoutes(t *testing.T) {
+	_, err := NewPacketRouter([]PacketRoute{{Proxy: &echoPacketProxy{}}}, nil)
+	require.Error(t, err)
+	_, err = NewPacketRouter([]PacketRoute{{Match: MatchPorts(53)}}, nil)
+	require.Error(t, err)
+
+	router, err := NewPacketRouter(nil, nil)
+	require.NoError(t, err)
+	_, err = router.NewSession(nil)
+	require.Error(t, err)
+}
+
+// echoPacketProxy creates sessions that respond to each request with the name of the proxy.
+type echoPacketProxy struct {
+	name     string
+	mu       sync.Mutex
+	sessions int
+	last     PacketResponseReceiver
+}
+
+func (p *echoPacketProxy) NewSession(respWriter PacketResponseReceiver) (PacketRequestSender, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sessions++
+	p.last = respWriter
+	return &echoPacketSession{name: p.name, respWriter: respWriter}, nil
+}
+
+func (p *echoPacketProxy) Sessions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions
+}
+
+func (p *echoPacketProxy) LastReceiver() PacketResponseReceiver {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+type echoPacketSession struct {
+	name       string
+	respWriter PacketResponseReceiver
+}
+
+func (s *echoPacketSession) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	if _, err := s.respWriter.WriteFrom([]byte(s.name), net.UDPAddrFromAddrPort(destination)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *echoPacketSession) Close() error {
+	return s.respWriter.Close()
+}
+
+type recordingPacketReceiver struct {
+	mu     sync.Mutex
+	last   string
+	closed bool
+}
+
+func (r *recordingPacketReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = string(p)
+	return len(p), nil
+}
+
+func (r *recordingPacketReceiver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func (r *recordingPacketReceiver) Last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+func (r *recordingPacketReceiver) Closed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
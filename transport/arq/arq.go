@@ -0,0 +1,221 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package arq provides reliable streams over packet connections, so that transports that only relay datagrams,
+// like UDP-only proxies, can carry TCP-like traffic.
+//
+// It implements a lightweight automatic repeat request (ARQ) protocol: data is split in numbered segments, the
+// receiver acknowledges the next segment it expects and buffers the segments that arrive out of order, and the
+// sender retransmits segments on timeouts or duplicate acknowledgments. The number of segments in flight is capped
+// by a fixed window, and there's no congestion control beyond that.
+//
+// The peer must run the same protocol, for instance with [Listener]. There's no handshake: the first segment
+// starts the session, so data can be sent right away.
+package arq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// StreamDialer is a [transport.StreamDialer] that creates reliable streams over packet connections
+// from a [transport.PacketDialer].
+type StreamDialer struct {
+	dialer transport.PacketDialer
+	config *Config
+}
+
+var _ transport.StreamDialer = (*StreamDialer)(nil)
+var _ transport.CapabilityReporter = (*StreamDialer)(nil)
+
+// NewStreamDialer creates a [StreamDialer] that sends the streams over packet connections from the dialer.
+// The config may be nil to use the defaults.
+func NewStreamDialer(dialer transport.PacketDialer, config *Config) (*StreamDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	return &StreamDialer{dialer: dialer, config: config}, nil
+}
+
+// Capabilities implements [transport.CapabilityReporter]. It preserves the remote DNS and IPv6 support of
+// the packet dialer.
+func (d *StreamDialer) Capabilities() transport.Capability {
+	return transport.CapabilityStream | transport.Capabilities(d.dialer)&(transport.CapabilityRemoteDNS|transport.CapabilityIPv6)
+}
+
+// DialStream implements [transport.StreamDialer]. The peer at the address must run a [Listener] or compatible
+// implementation. DialStream returns as soon as the packet connection is created, since no handshake is needed.
+func (d *StreamDialer) DialStream(ctx context.Context, address string) (transport.StreamConn, error) {
+	var sessionBytes [4]byte
+	if _, err := rand.Read(sessionBytes[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	pc, err := d.dialer.DialPacket(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	send := func(packet []byte) error {
+		_, err := pc.Write(packet)
+		return err
+	}
+	release := func() { pc.Close() }
+	c := newConn(binary.BigEndian.Uint32(sessionBytes[:]), d.config, send, release, pc.LocalAddr(), pc.RemoteAddr())
+	go func() {
+		buf := make([]byte, 0xffff)
+		for {
+			n, err := pc.Read(buf)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			c.input(buf[:n])
+		}
+	}()
+	return c, nil
+}
+
+type sessionKey struct {
+	address string
+	session uint32
+}
+
+// acceptQueueSize is the number of sessions that can wait for Accept. New sessions are reset when it's full.
+const acceptQueueSize = 32
+
+// Listener accepts reliable streams from peers that use [StreamDialer] on a [net.PacketConn].
+type Listener struct {
+	pc       net.PacketConn
+	config   *Config
+	acceptCh chan *conn
+	done     chan struct{}
+
+	mu       sync.Mutex
+	sessions map[sessionKey]*conn
+	err      error
+}
+
+// NewListener creates a [Listener] that serves the sessions on pc, and starts reading from it.
+// The config may be nil to use the defaults.
+func NewListener(pc net.PacketConn, config *Config) *Listener {
+	l := &Listener{
+		pc:       pc,
+		config:   config,
+		acceptCh: make(chan *conn, acceptQueueSize),
+		done:     make(chan struct{}),
+		sessions: make(map[sessionKey]*conn),
+	}
+	go l.serve()
+	return l
+}
+
+func (l *Listener) serve() {
+	buf := make([]byte, 0xffff)
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			l.closeWithError(err)
+			return
+		}
+		h, _, err := parseSegment(buf[:n])
+		if err != nil {
+			continue
+		}
+		key := sessionKey{addr.String(), h.session}
+		l.mu.Lock()
+		c, ok := l.sessions[key]
+		// New sessions start at sequence number zero, but the first segments may be lost.
+		if !ok && h.hasSeq() && int(h.seq) < l.config.window() {
+			c = l.newSessionLocked(key, addr)
+			select {
+			case l.acceptCh <- c:
+				ok = true
+			default:
+				delete(l.sessions, key)
+			}
+		}
+		l.mu.Unlock()
+		if !ok {
+			// Unknown session, for instance after a restart. Abort it, unless it's being aborted already.
+			if h.flags&flagRST == 0 {
+				l.pc.WriteTo(appendSegment(nil, header{session: h.session, flags: flagRST}, nil), addr)
+			}
+			continue
+		}
+		// The conn is called without the listener lock, since releasing the conn takes the lock.
+		c.input(buf[:n])
+	}
+}
+
+func (l *Listener) newSessionLocked(key sessionKey, addr net.Addr) *conn {
+	var c *conn
+	send := func(packet []byte) error {
+		_, err := l.pc.WriteTo(packet, addr)
+		return err
+	}
+	release := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.sessions[key] == c {
+			delete(l.sessions, key)
+		}
+	}
+	c = newConn(key.session, l.config, send, release, l.pc.LocalAddr(), addr)
+	l.sessions[key] = c
+	return c
+}
+
+func (l *Listener) closeWithError(err error) {
+	l.mu.Lock()
+	if l.err != nil {
+		l.mu.Unlock()
+		return
+	}
+	l.err = err
+	close(l.done)
+	sessions := l.sessions
+	l.sessions = make(map[sessionKey]*conn)
+	l.mu.Unlock()
+	for _, c := range sessions {
+		c.fail(net.ErrClosed)
+	}
+}
+
+// Accept waits for and returns the next session.
+func (l *Listener) Accept() (transport.StreamConn, error) {
+	select {
+	case c := <-l.acceptCh:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener, closes the packet connection, and aborts the sessions.
+func (l *Listener) Close() error {
+	err := l.pc.Close()
+	l.closeWithError(net.ErrClosed)
+	return err
+}
+
+// Addr returns the local address of the packet connection.
+func (l *Listener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
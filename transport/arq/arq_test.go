@@ -0,0 +1,279 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arq
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	mrand "math/rand"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// lossyPacketConn drops and duplicates outgoing packets at random.
+type lossyPacketConn struct {
+	net.PacketConn
+	mu        sync.Mutex
+	rand      *mrand.Rand
+	dropRate  float64
+	dupRate   float64
+	sentCount int
+}
+
+func (c *lossyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	c.sentCount++
+	drop := c.rand.Float64() < c.dropRate
+	dup := c.rand.Float64() < c.dupRate
+	c.mu.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	if dup {
+		c.PacketConn.WriteTo(b, addr)
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+// lossyConn drops outgoing packets of a connected net.Conn at random.
+type lossyConn struct {
+	net.Conn
+	mu       sync.Mutex
+	rand     *mrand.Rand
+	dropRate float64
+}
+
+func (c *lossyConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	drop := c.rand.Float64() < c.dropRate
+	c.mu.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+// startEchoServer runs a listener that echoes each stream back, and closes the write side at the end.
+func startEchoServer(t *testing.T, pc net.PacketConn) *Listener {
+	listener := NewListener(pc, nil)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+				conn.CloseWrite()
+			}()
+		}
+	}()
+	return listener
+}
+
+func newUDPPacketConn(t *testing.T) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return pc
+}
+
+func echo(t *testing.T, dialer transport.StreamDialer, address string, size int) {
+	conn, err := dialer.DialStream(context.Background(), address)
+	require.NoError(t, err)
+	defer conn.Close()
+	data := make([]byte, size)
+	rand.Read(data)
+
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(data)
+		if err == nil {
+			err = conn.CloseWrite()
+		}
+		writeErr <- err
+	}()
+	conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+	received, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.NoError(t, <-writeErr)
+	require.True(t, bytes.Equal(data, received), "received data doesn't match")
+}
+
+func TestEcho(t *testing.T) {
+	listener := startEchoServer(t, newUDPPacketConn(t))
+	dialer, err := NewStreamDialer(&transport.UDPDialer{}, nil)
+	require.NoError(t, err)
+	echo(t, dialer, listener.Addr().String(), 1_000_000)
+}
+
+func TestEcho_Lossy(t *testing.T) {
+	pc := &lossyPacketConn{PacketConn: newUDPPacketConn(t), rand: mrand.New(mrand.NewSource(1)), dropRate: 0.1, dupRate: 0.05}
+	listener := startEchoServer(t, pc)
+	rng := mrand.New(mrand.NewSource(2))
+	packetDialer := transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := (&transport.UDPDialer{}).DialPacket(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &lossyConn{Conn: conn, rand: rng, dropRate: 0.1}, nil
+	})
+	dialer, err := NewStreamDialer(packetDialer, &Config{MaxSegmentSize: 500, Window: 32})
+	require.NoError(t, err)
+	echo(t, dialer, listener.Addr().String(), 200_000)
+}
+
+func TestConcurrentStreams(t *testing.T) {
+	listener := startEchoServer(t, newUDPPacketConn(t))
+	dialer, err := NewStreamDialer(&transport.UDPDialer{}, nil)
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			echo(t, dialer, listener.Addr().String(), 100_000)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReadDeadline(t *testing.T) {
+	listener := startEchoServer(t, newUDPPacketConn(t))
+	dialer, err := NewStreamDialer(&transport.UDPDialer{}, nil)
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 10))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	// The stream is still usable.
+	require.NoError(t, conn.SetReadDeadline(time.Time{}))
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 10)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf[:n]))
+
+	require.NoError(t, conn.Close())
+	_, err = conn.Read(buf)
+	require.ErrorIs(t, err, net.ErrClosed)
+	_, err = conn.Write(buf)
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func newTestConn(sent *[][]byte) *conn {
+	send := func(packet []byte) error {
+		*sent = append(*sent, packet)
+		return nil
+	}
+	return newConn(7, nil, send, func() {}, nil, nil)
+}
+
+func TestConn_Reset(t *testing.T) {
+	var sent [][]byte
+	c := newTestConn(&sent)
+	c.input(appendSegment(nil, header{session: 7, flags: flagRST}, nil))
+	_, err := c.Read(make([]byte, 10))
+	require.ErrorIs(t, err, ErrConnectionReset)
+	_, err = c.Write([]byte("data"))
+	require.ErrorIs(t, err, ErrConnectionReset)
+}
+
+func TestConn_Reorder(t *testing.T) {
+	var sent [][]byte
+	c := newTestConn(&sent)
+	// Segments from another session are ignored.
+	c.input(appendSegment(nil, header{session: 8, flags: flagData, seq: 0}, []byte("wrong")))
+	require.Empty(t, sent)
+
+	c.input(appendSegment(nil, header{session: 7, flags: flagFIN, seq: 2, window: DefaultWindow}, nil))
+	c.input(appendSegment(nil, header{session: 7, flags: flagData, seq: 1, window: DefaultWindow}, []byte("world")))
+	c.input(appendSegment(nil, header{session: 7, flags: flagData, seq: 0, window: DefaultWindow}, []byte("hello ")))
+	// Duplicate.
+	c.input(appendSegment(nil, header{session: 7, flags: flagData, seq: 0, window: DefaultWindow}, []byte("hello ")))
+
+	acks := []uint32{}
+	for _, packet := range sent {
+		h, _, err := parseSegment(packet)
+		require.NoError(t, err)
+		require.False(t, h.hasSeq())
+		acks = append(acks, h.ack)
+	}
+	require.Equal(t, []uint32{0, 0, 3, 3}, acks)
+
+	data, err := io.ReadAll(c)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(data))
+}
+
+func TestConn_FastRetransmit(t *testing.T) {
+	var sent [][]byte
+	c := newTestConn(&sent)
+	_, err := c.Write(bytes.Repeat([]byte{1}, 3*DefaultMaxSegmentSize))
+	require.NoError(t, err)
+	require.Len(t, sent, 3)
+
+	ack := appendSegment(nil, header{session: 7, ack: 1, window: DefaultWindow}, nil)
+	c.input(ack)
+	for i := 0; i < dupAckThreshold; i++ {
+		c.input(ack)
+	}
+	require.Len(t, sent, 4)
+	h, _, err := parseSegment(sent[3])
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), h.seq)
+
+	c.input(appendSegment(nil, header{session: 7, ack: 3, window: DefaultWindow}, nil))
+	c.mu.Lock()
+	require.Empty(t, c.inflight)
+	c.mu.Unlock()
+}
+
+func TestListener_UnknownSession(t *testing.T) {
+	listener := NewListener(newUDPPacketConn(t), nil)
+	defer listener.Close()
+	client, err := net.Dial("udp", listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	// A pure ack for an unknown session is reset.
+	_, err = client.Write(appendSegment(nil, header{session: 9}, nil))
+	require.NoError(t, err)
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 100)
+	n, err := client.Read(buf)
+	require.NoError(t, err)
+	h, _, err := parseSegment(buf[:n])
+	require.NoError(t, err)
+	require.Equal(t, uint32(9), h.session)
+	require.Equal(t, uint8(flagRST), h.flags)
+
+	require.NoError(t, listener.Close())
+	_, err = listener.Accept()
+	require.True(t, errors.Is(err, net.ErrClosed))
+}
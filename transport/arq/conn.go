@@ -0,0 +1,539 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arq
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// ErrConnectionReset is returned when the peer aborts the session.
+var ErrConnectionReset = errors.New("connection reset by peer")
+
+// ErrRetransmitTimeout is returned when the peer doesn't acknowledge data after repeated retransmissions.
+var ErrRetransmitTimeout = errors.New("peer stopped acknowledging data")
+
+const (
+	// DefaultMaxSegmentSize is the default maximum payload of each packet, which keeps packets under the
+	// IPv6 minimum MTU after the overhead of the header and of common tunnels.
+	DefaultMaxSegmentSize = 1200
+	// DefaultWindow is the default number of segments that can be in flight.
+	DefaultWindow = 64
+
+	initialRTO = time.Second
+	minRTO     = 200 * time.Millisecond
+	maxRTO     = 10 * time.Second
+	// maxTransmissions is how many times a segment is sent before giving up on the peer.
+	maxTransmissions = 10
+	// dupAckThreshold is the number of duplicate acks that triggers a fast retransmission.
+	dupAckThreshold = 3
+)
+
+// Config configures the sessions.
+type Config struct {
+	// MaxSegmentSize is the maximum payload of each packet, not including the 15-byte header.
+	// If zero, [DefaultMaxSegmentSize] is used.
+	MaxSegmentSize int
+	// Window is the maximum number of segments in flight, which is also the number of segments each side buffers
+	// for reading. Both sides should use the same value. If zero, [DefaultWindow] is used.
+	Window int
+}
+
+func (c *Config) maxSegmentSize() int {
+	if c == nil || c.MaxSegmentSize <= 0 {
+		return DefaultMaxSegmentSize
+	}
+	return c.MaxSegmentSize
+}
+
+func (c *Config) window() int {
+	if c == nil || c.Window <= 0 {
+		return DefaultWindow
+	}
+	if c.Window > 0xffff {
+		return 0xffff
+	}
+	return c.Window
+}
+
+type segment struct {
+	seq           uint32
+	flags         uint8
+	payload       []byte
+	sentAt        time.Time
+	transmissions int
+}
+
+// conn is a reliable stream over packets. It's safe for concurrent use.
+type conn struct {
+	session    uint32
+	mss        int
+	window     int
+	send       func(packet []byte) error
+	release    func()
+	localAddr  net.Addr
+	remoteAddr net.Addr
+
+	mu sync.Mutex
+	// changed is closed and replaced whenever the state changes, to wake up blocked calls.
+	changed chan struct{}
+
+	// Send state.
+	sndUna     uint32
+	sndNxt     uint32
+	inflight   []*segment
+	peerWindow int
+	finQueued  bool
+	dupAcks    int
+	srtt       time.Duration
+	rttvar     time.Duration
+	rto        time.Duration
+	rtxTimer   *time.Timer
+
+	// Receive state.
+	rcvNxt         uint32
+	outOfOrder     map[uint32]*segment
+	readQueue      [][]byte
+	lastAdvertised int
+	finReceived    bool
+	readClosed     bool
+
+	closed        bool
+	released      bool
+	err           error
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+var _ transport.StreamConn = (*conn)(nil)
+
+func newConn(session uint32, config *Config, send func([]byte) error, release func(), localAddr, remoteAddr net.Addr) *conn {
+	window := config.window()
+	return &conn{
+		session:        session,
+		mss:            config.maxSegmentSize(),
+		window:         window,
+		send:           send,
+		release:        release,
+		localAddr:      localAddr,
+		remoteAddr:     remoteAddr,
+		changed:        make(chan struct{}),
+		peerWindow:     window,
+		rto:            initialRTO,
+		outOfOrder:     make(map[uint32]*segment),
+		lastAdvertised: window,
+	}
+}
+
+func (c *conn) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// waitLocked waits for a state change or the deadline. The lock is released while waiting.
+func (c *conn) waitLocked(deadline time.Time) error {
+	changed := c.changed
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	c.mu.Unlock()
+	defer c.mu.Lock()
+	select {
+	case <-changed:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+func (c *conn) recvWindowLocked() int {
+	if len(c.readQueue) >= c.window {
+		return 0
+	}
+	return c.window - len(c.readQueue)
+}
+
+// sendWindowLocked returns how many segments can be in flight. It always allows one, so it works as a probe
+// when the peer window is zero.
+func (c *conn) sendWindowLocked() int {
+	if c.peerWindow < 1 {
+		return 1
+	}
+	if c.peerWindow < c.window {
+		return c.peerWindow
+	}
+	return c.window
+}
+
+func (c *conn) sendPacketLocked(flags uint8, seq uint32, payload []byte) {
+	c.lastAdvertised = c.recvWindowLocked()
+	packet := appendSegment(make([]byte, 0, headerLen+len(payload)), header{
+		session: c.session,
+		flags:   flags,
+		seq:     seq,
+		ack:     c.rcvNxt,
+		window:  uint16(c.lastAdvertised),
+	}, payload)
+	if err := c.send(packet); err != nil {
+		c.failLocked(err)
+	}
+}
+
+func (c *conn) transmitLocked(seg *segment) {
+	seg.sentAt = time.Now()
+	seg.transmissions++
+	c.sendPacketLocked(seg.flags, seg.seq, seg.payload)
+}
+
+func (c *conn) sendAckLocked() {
+	c.sendPacketLocked(0, c.sndNxt, nil)
+}
+
+func (c *conn) queueLocked(flags uint8, payload []byte) {
+	seg := &segment{seq: c.sndNxt, flags: flags, payload: payload}
+	c.sndNxt++
+	c.inflight = append(c.inflight, seg)
+	if len(c.inflight) == 1 {
+		c.armTimerLocked()
+	}
+	c.transmitLocked(seg)
+}
+
+func (c *conn) armTimerLocked() {
+	if c.rtxTimer == nil {
+		c.rtxTimer = time.AfterFunc(c.rto, c.onTimeout)
+	} else {
+		c.rtxTimer.Reset(c.rto)
+	}
+}
+
+func (c *conn) stopTimerLocked() {
+	if c.rtxTimer != nil {
+		c.rtxTimer.Stop()
+	}
+}
+
+// onTimeout retransmits the oldest unacknowledged segment.
+func (c *conn) onTimeout() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil || len(c.inflight) == 0 {
+		return
+	}
+	seg := c.inflight[0]
+	if seg.transmissions >= maxTransmissions {
+		c.failLocked(ErrRetransmitTimeout)
+		return
+	}
+	c.rto *= 2
+	if c.rto > maxRTO {
+		c.rto = maxRTO
+	}
+	c.transmitLocked(seg)
+	c.armTimerLocked()
+}
+
+// updateRTOLocked updates the retransmission timeout with a new round-trip time sample, as per RFC 6298.
+func (c *conn) updateRTOLocked(rtt time.Duration) {
+	if c.srtt == 0 {
+		c.srtt = rtt
+		c.rttvar = rtt / 2
+	} else {
+		delta := c.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		c.rttvar = (3*c.rttvar + delta) / 4
+		c.srtt = (7*c.srtt + rtt) / 8
+	}
+	c.rto = c.srtt + 4*c.rttvar
+	if c.rto < minRTO {
+		c.rto = minRTO
+	} else if c.rto > maxRTO {
+		c.rto = maxRTO
+	}
+}
+
+// input processes a packet from the peer.
+func (c *conn) input(packet []byte) {
+	h, payload, err := parseSegment(packet)
+	if err != nil || h.session != c.session {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if h.flags&flagRST != 0 {
+		c.failLocked(ErrConnectionReset)
+		return
+	}
+
+	if seqBefore(c.sndUna, h.ack) && !seqBefore(c.sndNxt, h.ack) {
+		// New data acknowledged.
+		acked := c.inflight[:h.ack-c.sndUna]
+		recovering := false
+		for _, seg := range acked {
+			if seg.transmissions > 1 {
+				recovering = true
+			}
+		}
+		// Karn's algorithm: only sample segments that were not retransmitted.
+		if last := acked[len(acked)-1]; last.transmissions == 1 {
+			c.updateRTOLocked(time.Since(last.sentAt))
+		}
+		c.inflight = c.inflight[len(acked):]
+		c.sndUna = h.ack
+		c.dupAcks = 0
+		if len(c.inflight) == 0 {
+			c.stopTimerLocked()
+		} else {
+			c.armTimerLocked()
+			if recovering {
+				// A partial ack after a retransmission means the next segment was likely lost too.
+				c.transmitLocked(c.inflight[0])
+			}
+		}
+	} else if h.ack == c.sndUna && !h.hasSeq() && len(c.inflight) > 0 && int(h.window) == c.peerWindow {
+		c.dupAcks++
+		if c.dupAcks == dupAckThreshold {
+			c.transmitLocked(c.inflight[0])
+		}
+	}
+	c.peerWindow = int(h.window)
+
+	if h.hasSeq() {
+		c.receiveLocked(h, payload)
+		c.sendAckLocked()
+	}
+	if c.closed && len(c.inflight) == 0 {
+		// Everything was delivered after Close.
+		c.failLocked(net.ErrClosed)
+	}
+	c.notifyLocked()
+}
+
+func (c *conn) receiveLocked(h header, payload []byte) {
+	if seqBefore(h.seq, c.rcvNxt) || c.finReceived {
+		// Duplicate.
+		return
+	}
+	if int(h.seq-c.rcvNxt) >= c.recvWindowLocked() {
+		// No room. The sender will retry.
+		return
+	}
+	seg := &segment{seq: h.seq, flags: h.flags, payload: append([]byte(nil), payload...)}
+	if h.seq != c.rcvNxt {
+		c.outOfOrder[h.seq] = seg
+		return
+	}
+	for {
+		c.deliverLocked(seg)
+		c.rcvNxt++
+		next, ok := c.outOfOrder[c.rcvNxt]
+		if !ok || c.finReceived {
+			return
+		}
+		delete(c.outOfOrder, c.rcvNxt)
+		seg = next
+	}
+}
+
+func (c *conn) deliverLocked(seg *segment) {
+	if seg.flags&flagFIN != 0 {
+		c.finReceived = true
+		c.outOfOrder = make(map[uint32]*segment)
+		return
+	}
+	if len(seg.payload) > 0 && !c.readClosed {
+		c.readQueue = append(c.readQueue, seg.payload)
+	}
+}
+
+// fail terminates the session with the given error.
+func (c *conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failLocked(err)
+}
+
+func (c *conn) failLocked(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+	c.stopTimerLocked()
+	c.notifyLocked()
+	if !c.released {
+		c.released = true
+		c.release()
+	}
+}
+
+// Read implements [io.Reader].
+func (c *conn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if c.closed || c.readClosed {
+			return 0, net.ErrClosed
+		}
+		if len(c.readQueue) > 0 {
+			n := copy(b, c.readQueue[0])
+			if n < len(c.readQueue[0]) {
+				c.readQueue[0] = c.readQueue[0][n:]
+			} else {
+				c.readQueue[0] = nil
+				c.readQueue = c.readQueue[1:]
+				// Let the peer know about the new room if it may be waiting for it.
+				if c.err == nil && c.lastAdvertised < c.window/2 && c.recvWindowLocked() >= c.window/2 {
+					c.sendAckLocked()
+				}
+			}
+			return n, nil
+		}
+		if c.finReceived {
+			return 0, io.EOF
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		if err := c.waitLocked(c.readDeadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write implements [io.Writer]. It returns once the data is sent, without waiting for it to be acknowledged.
+func (c *conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	written := 0
+	for written < len(b) {
+		if c.closed || c.finQueued {
+			return written, net.ErrClosed
+		}
+		if c.err != nil {
+			return written, c.err
+		}
+		if len(c.inflight) >= c.sendWindowLocked() {
+			if err := c.waitLocked(c.writeDeadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+		n := len(b) - written
+		if n > c.mss {
+			n = c.mss
+		}
+		c.queueLocked(flagData, append([]byte(nil), b[written:written+n]...))
+		written += n
+	}
+	return written, nil
+}
+
+// CloseWrite sends the end of the stream to the peer, after the data already written.
+func (c *conn) CloseWrite() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	if !c.finQueued && c.err == nil {
+		c.finQueued = true
+		c.queueLocked(flagFIN, nil)
+	}
+	return nil
+}
+
+// CloseRead discards the received data. Further reads fail.
+func (c *conn) CloseRead() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.readClosed = true
+	c.readQueue = nil
+	c.notifyLocked()
+	return nil
+}
+
+// Close closes the stream. The data already written is still delivered in the background, and the resources are
+// released once the peer acknowledges it or stops responding.
+func (c *conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.closed = true
+	c.readQueue = nil
+	if !c.finQueued && c.err == nil {
+		c.finQueued = true
+		c.queueLocked(flagFIN, nil)
+	}
+	if len(c.inflight) == 0 || c.err != nil {
+		c.failLocked(net.ErrClosed)
+	}
+	c.notifyLocked()
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.notifyLocked()
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.notifyLocked()
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	c.notifyLocked()
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arq
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Segment flags.
+const (
+	// flagData marks a segment with a sequence number and payload.
+	flagData = 1 << iota
+	// flagFIN marks the end of the stream. It takes a sequence number.
+	flagFIN
+	// flagRST aborts the session.
+	flagRST
+)
+
+// The segment header is:
+//
+//	+------------+-------+-----+-----+--------+---------+
+//	| session ID | flags | seq | ack | window | payload |
+//	+------------+-------+-----+-----+--------+---------+
+//	|     4      |   1   |  4  |  4  |   2    |   ...   |
+//	+------------+-------+-----+-----+--------+---------+
+//
+// The ack is the next sequence number the sender expects, and the window is how many more segments it can receive.
+// Segments without the data or FIN flags only carry the ack and window, and their seq is ignored.
+const headerLen = 15
+
+var errShortSegment = errors.New("segment too short")
+
+type header struct {
+	session uint32
+	flags   uint8
+	seq     uint32
+	ack     uint32
+	window  uint16
+}
+
+func (h *header) hasSeq() bool {
+	return h.flags&(flagData|flagFIN) != 0
+}
+
+func appendSegment(b []byte, h header, payload []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, h.session)
+	b = append(b, h.flags)
+	b = binary.BigEndian.AppendUint32(b, h.seq)
+	b = binary.BigEndian.AppendUint32(b, h.ack)
+	b = binary.BigEndian.AppendUint16(b, h.window)
+	return append(b, payload...)
+}
+
+func parseSegment(packet []byte) (header, []byte, error) {
+	if len(packet) < headerLen {
+		return header{}, nil, errShortSegment
+	}
+	h := header{
+		session: binary.BigEndian.Uint32(packet[0:4]),
+		flags:   packet[4],
+		seq:     binary.BigEndian.Uint32(packet[5:9]),
+		ack:     binary.BigEndian.Uint32(packet[9:13]),
+		window:  binary.BigEndian.Uint16(packet[13:15]),
+	}
+	return h, packet[headerLen:], nil
+}
+
+// seqBefore returns whether sequence number a comes before b, taking wrap around into account.
+func seqBefore(a, b uint32) bool {
+	return int32(a-b) < 0
+}
@@ -0,0 +1,41 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"io"
+	"net"
+)
+
+// BuffersWriter is implemented by writers that can write multiple buffers in one call. The network connections
+// of the standard library, like [net.TCPConn], write [net.Buffers] with a single writev system call, but
+// [net.Buffers.WriteTo] can only use it on those types. Connection wrappers implement BuffersWriter to pass the
+// buffers through to the connection they wrap, so relays can write a header and a payload without copying them
+// into a single buffer or making a system call for each.
+type BuffersWriter interface {
+	// WriteBuffers writes the contents of the buffers in order, and returns the number of bytes written.
+	// It may modify the buffers slice, like [net.Buffers.WriteTo], but not the bytes of the buffers.
+	WriteBuffers(buffers net.Buffers) (int64, error)
+}
+
+// WriteBuffers writes the buffers to w with w.WriteBuffers if w implements [BuffersWriter], or with
+// [net.Buffers.WriteTo] otherwise, which uses writev on the standard network connections and writes the buffers
+// one by one to other writers.
+func WriteBuffers(w io.Writer, buffers net.Buffers) (int64, error) {
+	if bw, ok := w.(BuffersWriter); ok {
+		return bw.WriteBuffers(buffers)
+	}
+	return buffers.WriteTo(w)
+}
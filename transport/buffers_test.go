@@ -0,0 +1,97 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteBuffers_BuffersWriter(t *testing.T) {
+	var w collectBuffersWriter
+	n, err := WriteBuffers(&w, net.Buffers{[]byte("Req"), []byte("uest")})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+	require.Equal(t, []string{"Request"}, w.calls)
+}
+
+func TestWriteBuffers_Writer(t *testing.T) {
+	var w bytes.Buffer
+	n, err := WriteBuffers(&w, net.Buffers{[]byte("Req"), []byte("uest")})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+	require.Equal(t, "Request", w.String())
+}
+
+func TestWrapConn_WriteBuffers(t *testing.T) {
+	var w collectBuffersWriter
+	conn := WrapConn(nil, nil, &w)
+	bw, ok := conn.(BuffersWriter)
+	require.True(t, ok)
+	n, err := bw.WriteBuffers(net.Buffers{[]byte("Req"), []byte("uest")})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+	require.Equal(t, []string{"Request"}, w.calls)
+}
+
+func TestWrapConn_WriteBuffersTCP(t *testing.T) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		serverConn, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		defer serverConn.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(serverConn)
+		received <- buf.Bytes()
+	}()
+
+	tcpConn, err := net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	require.NoError(t, err)
+	conn := WrapConn(tcpConn, tcpConn, tcpConn)
+	n, err := WriteBuffers(conn, net.Buffers{[]byte("Req"), []byte("uest")})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+	require.NoError(t, conn.CloseWrite())
+	require.Equal(t, "Request", string(<-received))
+}
+
+/********** Test Utilities **********/
+
+// collectBuffersWriter is a [BuffersWriter] that records the concatenated buffers of each call.
+type collectBuffersWriter struct {
+	calls []string
+}
+
+var _ BuffersWriter = (*collectBuffersWriter)(nil)
+
+func (w *collectBuffersWriter) Write(b []byte) (int, error) {
+	w.calls = append(w.calls, string(b))
+	return len(b), nil
+}
+
+func (w *collectBuffersWriter) WriteBuffers(buffers net.Buffers) (int64, error) {
+	var call bytes.Buffer
+	n, err := buffers.WriteTo(&call)
+	w.calls = append(w.calls, call.String())
+	return n, err
+}
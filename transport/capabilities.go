@@ -0,0 +1,105 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Capability is a set of features supported by a dialer or listener. It allows for rejecting invalid
+// compositions early with a clear error, instead of failing at runtime. For example, a strategy that needs
+// to proxy UDP can check for [CapabilityPacket] before it's used.
+type Capability uint32
+
+const (
+	// CapabilityStream means the object can create stream connections, like a [StreamDialer].
+	CapabilityStream Capability = 1 << iota
+	// CapabilityPacket means the object can create packet connections, like a [PacketDialer] or [PacketListener].
+	CapabilityPacket
+	// CapabilityRemoteDNS means domain names are resolved by the remote end, like a proxy, rather than locally.
+	CapabilityRemoteDNS
+	// CapabilityIPv6 means IPv6 destinations are supported.
+	CapabilityIPv6
+	// CapabilityZeroRTT means the initial data can be sent along with the connection setup, as in [DialAndWriter].
+	CapabilityZeroRTT
+)
+
+// capabilityNames are the names of the capabilities, in bit order.
+var capabilityNames = []string{"stream", "packet", "remote-dns", "ipv6", "0-rtt"}
+
+// Has reports whether c includes all the capabilities in want.
+func (c Capability) Has(want Capability) bool {
+	return c&want == want
+}
+
+// String returns the names of the capabilities separated by "|", like "stream|remote-dns".
+func (c Capability) String() string {
+	var names []string
+	for i, name := range capabilityNames {
+		if c&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if unknown := c &^ (1<<len(capabilityNames) - 1); unknown != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(unknown)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// CapabilityReporter is implemented by dialers and listeners that advertise their capabilities.
+// Wrappers should report the capabilities of the object they wrap that they preserve.
+type CapabilityReporter interface {
+	Capabilities() Capability
+}
+
+// ErrMissingCapability is returned by [CheckCapabilities] when an object lacks required capabilities.
+var ErrMissingCapability = errors.New("missing capability")
+
+// Capabilities returns the capabilities of the given dialer or listener.
+// If it doesn't implement [CapabilityReporter], the capabilities are inferred from the interfaces it implements,
+// which can only tell stream, packet and 0-RTT support.
+func Capabilities(object any) Capability {
+	if r, ok := object.(CapabilityReporter); ok {
+		return r.Capabilities()
+	}
+	var caps Capability
+	if _, ok := object.(StreamDialer); ok {
+		caps |= CapabilityStream
+	}
+	if _, ok := object.(PacketDialer); ok {
+		caps |= CapabilityPacket
+	}
+	if _, ok := object.(PacketListener); ok {
+		caps |= CapabilityPacket
+	}
+	if _, ok := object.(DialAndWriter); ok {
+		caps |= CapabilityZeroRTT
+	}
+	return caps
+}
+
+// CheckCapabilities returns an error wrapping [ErrMissingCapability] that names the missing capabilities
+// if the object doesn't have all the capabilities in want.
+func CheckCapabilities(object any, want Capability) error {
+	if missing := want &^ Capabilities(object); missing != 0 {
+		return fmt.Errorf("%w: %T doesn't support %v", ErrMissingCapability, object, missing)
+	}
+	return nil
+}
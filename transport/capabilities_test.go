@@ -0,0 +1,79 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapability_String(t *testing.T) {
+	require.Equal(t, "none", Capability(0).String())
+	require.Equal(t, "stream|remote-dns", (CapabilityStream | CapabilityRemoteDNS).String())
+	require.Equal(t, "stream|packet|remote-dns|ipv6|0-rtt",
+		(CapabilityStream | CapabilityPacket | CapabilityRemoteDNS | CapabilityIPv6 | CapabilityZeroRTT).String())
+	require.Equal(t, "packet|0x100", (CapabilityPacket | 0x100).String())
+}
+
+func TestCapability_Has(t *testing.T) {
+	caps := CapabilityStream | CapabilityIPv6
+	require.True(t, caps.Has(CapabilityStream))
+	require.True(t, caps.Has(CapabilityStream|CapabilityIPv6))
+	require.False(t, caps.Has(CapabilityStream|CapabilityPacket))
+	require.True(t, caps.Has(0))
+}
+
+func TestCapabilities_Reported(t *testing.T) {
+	require.Equal(t, CapabilityStream|CapabilityIPv6|CapabilityZeroRTT, Capabilities(&TCPDialer{}))
+	require.Equal(t, CapabilityPacket|CapabilityIPv6, Capabilities(&UDPDialer{}))
+	require.Equal(t, CapabilityPacket|CapabilityIPv6, Capabilities(&UDPListener{}))
+	require.Equal(t, CapabilityPacket|CapabilityIPv6, Capabilities(PacketListenerDialer{Listener: &UDPListener{}}))
+	// The dialer doesn't support packets if the listener doesn't.
+	require.Equal(t, CapabilityRemoteDNS, Capabilities(PacketListenerDialer{Listener: streamOnlyListener{}}))
+}
+
+// streamOnlyListener is a [PacketListener] that reports no packet support, like a SOCKS5 client without
+// packets enabled.
+type streamOnlyListener struct {
+	PacketListener
+}
+
+func (streamOnlyListener) Capabilities() Capability {
+	return CapabilityStream | CapabilityRemoteDNS
+}
+
+func TestCapabilities_Inferred(t *testing.T) {
+	streamDialer := FuncStreamDialer(func(ctx context.Context, addr string) (StreamConn, error) {
+		return nil, nil
+	})
+	require.Equal(t, CapabilityStream, Capabilities(streamDialer))
+	packetDialer := FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return nil, nil
+	})
+	require.Equal(t, CapabilityPacket, Capabilities(packetDialer))
+	require.Equal(t, Capability(0), Capabilities(nil))
+	require.Equal(t, Capability(0), Capabilities("not a dialer"))
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	require.NoError(t, CheckCapabilities(&TCPDialer{}, CapabilityStream|CapabilityZeroRTT))
+
+	err := CheckCapabilities(&TCPDialer{}, CapabilityStream|CapabilityPacket|CapabilityRemoteDNS)
+	require.ErrorIs(t, err, ErrMissingCapability)
+	require.ErrorContains(t, err, "*transport.TCPDialer doesn't support packet|remote-dns")
+}
@@ -0,0 +1,208 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrPeerUnresponsive is the error of packet connections closed by the dead peer detection, because the relay
+// stopped sending packets back. It also matches [ErrBlockedSuspected], since that's a typical way relays are blocked.
+var ErrPeerUnresponsive = errors.New("peer is unresponsive")
+
+// DeadPeerDetection configures how a packet connection through a relay, like a SOCKS5 UDP association or a
+// Shadowsocks UDP session, detects that the relay silently died, so the application can reconnect instead of
+// sending packets into a black hole. See [WithDeadPeerDetection].
+type DeadPeerDetection struct {
+	// Timeout is how long the connection waits for a packet after sending one before it's considered dead.
+	// If probes are configured, only the probes need a response, so traffic to destinations that don't respond
+	// doesn't close the connection. It must be positive.
+	Timeout time.Duration
+	// ProbeInterval is how long the connection can go without receiving packets before a probe is sent.
+	// Zero disables the probes.
+	ProbeInterval time.Duration
+	// ProbeAddr is the destination of the probes, which must respond to ProbePayload, like a DNS resolver to a
+	// query. It should be an IP address that the application doesn't use, since the packets from it are dropped.
+	ProbeAddr net.Addr
+	// ProbePayload is the payload of the probes.
+	ProbePayload []byte
+	// OnClose, if not nil, is called once when the connection closes, with nil if it was closed by
+	// the application, or the reason otherwise, like an error matching [ErrPeerUnresponsive].
+	OnClose func(err error)
+}
+
+// WithDeadPeerDetection wraps the packet connection to close it when its peer stops responding, or when reads
+// fail with an error matching [net.ErrClosed] or [ErrPeerUnresponsive], like when the control connection of a
+// SOCKS5 UDP association closes. Reads after that return the reason.
+//
+// Packets are only seen when the connection is read, so the application must keep reading from it, as
+// it usually does.
+func WithDeadPeerDetection(conn net.PacketConn, config DeadPeerDetection) (net.PacketConn, error) {
+	if conn == nil {
+		return nil, errors.New("argument conn must not be nil")
+	}
+	if config.Timeout <= 0 {
+		return nil, errors.New("dead peer timeout must be positive")
+	}
+	if config.ProbeInterval > 0 && config.ProbeAddr == nil {
+		return nil, errors.New("dead peer probes need a ProbeAddr")
+	}
+	if config.ProbeInterval < 0 || config.ProbeAddr == nil {
+		config.ProbeInterval = 0
+	}
+	c := &deadPeerConn{
+		PacketConn:   conn,
+		config:       config,
+		done:         make(chan struct{}),
+		lastReceived: time.Now(),
+	}
+	if config.ProbeAddr != nil {
+		c.probeAddr = config.ProbeAddr.String()
+	}
+	go c.monitor()
+	return c, nil
+}
+
+type deadPeerConn struct {
+	net.PacketConn
+	config    DeadPeerDetection
+	probeAddr string
+
+	mu sync.Mutex
+	// lastReceived is when the last packet was received, or the connection was created.
+	lastReceived time.Time
+	// lastProbe is when the last probe was sent.
+	lastProbe time.Time
+	// waitingSince is when the first packet that needs a response since the last received packet was sent,
+	// or zero if there's none.
+	waitingSince time.Time
+	closeErr     error
+	done         chan struct{}
+}
+
+var _ net.PacketConn = (*deadPeerConn)(nil)
+
+func (c *deadPeerConn) monitor() {
+	checkInterval := c.config.Timeout
+	if c.config.ProbeInterval > 0 && c.config.ProbeInterval < checkInterval {
+		checkInterval = c.config.ProbeInterval
+	}
+	ticker := time.NewTicker(checkInterval / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			dead := !c.waitingSince.IsZero() && now.Sub(c.waitingSince) >= c.config.Timeout
+			needsProbe := c.config.ProbeInterval > 0 && now.Sub(c.lastReceived) >= c.config.ProbeInterval &&
+				now.Sub(c.lastProbe) >= c.config.ProbeInterval
+			c.mu.Unlock()
+			if dead {
+				c.closeWithError(WithErrorClass(ErrPeerUnresponsive, ErrBlockedSuspected))
+				return
+			}
+			if needsProbe {
+				c.probe(now)
+			}
+		}
+	}
+}
+
+func (c *deadPeerConn) probe(now time.Time) {
+	c.mu.Lock()
+	c.lastProbe = now
+	if c.waitingSince.IsZero() {
+		c.waitingSince = now
+	}
+	c.mu.Unlock()
+	// Write errors are detected by the timeout.
+	c.PacketConn.WriteTo(c.config.ProbePayload, c.config.ProbeAddr)
+}
+
+func (c *deadPeerConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil {
+			if closeErr := c.closeError(); closeErr != nil {
+				return 0, nil, closeErr
+			}
+			if errors.Is(err, net.ErrClosed) || errors.Is(err, ErrPeerUnresponsive) {
+				c.closeWithError(err)
+			}
+			return n, addr, err
+		}
+		c.mu.Lock()
+		c.lastReceived = time.Now()
+		c.waitingSince = time.Time{}
+		c.mu.Unlock()
+		if c.probeAddr != "" && addr != nil && addr.String() == c.probeAddr {
+			// Drop the probe responses.
+			continue
+		}
+		return n, addr, nil
+	}
+}
+
+func (c *deadPeerConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if closeErr := c.closeError(); closeErr != nil {
+		return 0, closeErr
+	}
+	if c.config.ProbeInterval == 0 {
+		// Without probes, all the packets need a response.
+		c.mu.Lock()
+		if c.waitingSince.IsZero() {
+			c.waitingSince = time.Now()
+		}
+		c.mu.Unlock()
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func (c *deadPeerConn) closeError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeErr
+}
+
+// closeWithError closes the connection and reports the reason to OnClose, if it's not closed yet.
+// A nil reason means the application closed the connection.
+func (c *deadPeerConn) closeWithError(reason error) error {
+	c.mu.Lock()
+	if c.closeErr != nil {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	c.closeErr = reason
+	if reason == nil {
+		c.closeErr = net.ErrClosed
+	}
+	close(c.done)
+	c.mu.Unlock()
+	err := c.PacketConn.Close()
+	if c.config.OnClose != nil {
+		c.config.OnClose(reason)
+	}
+	return err
+}
+
+// Close closes the connection. OnClose is called with nil.
+func (c *deadPeerConn) Close() error {
+	return c.closeWithError(nil)
+}
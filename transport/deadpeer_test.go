@@ -0,0 +1,189 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDeadPeerDetection_Unresponsive(t *testing.T) {
+	conn := listenLocalUDP(t)
+	silent := listenLocalUDP(t)
+
+	closed := make(chan error, 1)
+	dpConn, err := WithDeadPeerDetection(conn, DeadPeerDetection{
+		Timeout: 50 * time.Millisecond,
+		OnClose: func(err error) { closed <- err },
+	})
+	require.NoError(t, err)
+	defer dpConn.Close()
+
+	_, err = dpConn.WriteTo([]byte("ping"), silent.LocalAddr())
+	require.NoError(t, err)
+	_, _, err = dpConn.ReadFrom(make([]byte, 10))
+	require.ErrorIs(t, err, ErrPeerUnresponsive)
+	require.ErrorIs(t, err, ErrBlockedSuspected)
+	require.ErrorIs(t, <-closed, ErrPeerUnresponsive)
+
+	_, err = dpConn.WriteTo([]byte("ping"), silent.LocalAddr())
+	require.ErrorIs(t, err, ErrPeerUnresponsive)
+	require.ErrorIs(t, dpConn.Close(), net.ErrClosed)
+}
+
+func TestWithDeadPeerDetection_Responsive(t *testing.T) {
+	conn := listenLocalUDP(t)
+	echo := startUDPEcho(t)
+
+	dpConn, err := WithDeadPeerDetection(conn, DeadPeerDetection{
+		Timeout: 50 * time.Millisecond,
+		OnClose: func(err error) { require.NoError(t, err) },
+	})
+	require.NoError(t, err)
+
+	buf := make([]byte, 10)
+	for deadline := time.Now().Add(150 * time.Millisecond); time.Now().Before(deadline); {
+		_, err = dpConn.WriteTo([]byte("ping"), echo.LocalAddr())
+		require.NoError(t, err)
+		n, addr, err := dpConn.ReadFrom(buf)
+		require.NoError(t, err)
+		require.Equal(t, echo.LocalAddr().String(), addr.String())
+		require.Equal(t, []byte("ping"), buf[:n])
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, dpConn.Close())
+}
+
+func TestWithDeadPeerDetection_Probes(t *testing.T) {
+	conn := listenLocalUDP(t)
+	echo := startUDPEcho(t)
+	silent := listenLocalUDP(t)
+
+	dpConn, err := WithDeadPeerDetection(conn, DeadPeerDetection{
+		Timeout:       50 * time.Millisecond,
+		ProbeInterval: 20 * time.Millisecond,
+		ProbeAddr:     echo.LocalAddr(),
+		ProbePayload:  []byte("probe"),
+	})
+	require.NoError(t, err)
+	defer dpConn.Close()
+
+	// Traffic to a silent destination doesn't kill the connection while the probes are answered.
+	_, err = dpConn.WriteTo([]byte("ping"), silent.LocalAddr())
+	require.NoError(t, err)
+	require.NoError(t, dpConn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, _, err = dpConn.ReadFrom(make([]byte, 10))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestWithDeadPeerDetection_UnansweredProbes(t *testing.T) {
+	conn := listenLocalUDP(t)
+	silent := listenLocalUDP(t)
+
+	dpConn, err := WithDeadPeerDetection(conn, DeadPeerDetection{
+		Timeout:       50 * time.Millisecond,
+		ProbeInterval: 20 * time.Millisecond,
+		ProbeAddr:     silent.LocalAddr(),
+		ProbePayload:  []byte("probe"),
+	})
+	require.NoError(t, err)
+	defer dpConn.Close()
+
+	_, _, err = dpConn.ReadFrom(make([]byte, 10))
+	require.ErrorIs(t, err, ErrPeerUnresponsive)
+	n, _, err := silent.ReadFrom(make([]byte, 10))
+	require.NoError(t, err)
+	require.Equal(t, len("probe"), n)
+}
+
+func TestWithDeadPeerDetection_Close(t *testing.T) {
+	conn := listenLocalUDP(t)
+	var mu sync.Mutex
+	var reasons []error
+	dpConn, err := WithDeadPeerDetection(conn, DeadPeerDetection{
+		Timeout: time.Minute,
+		OnClose: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reasons = append(reasons, err)
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, dpConn.Close())
+	require.ErrorIs(t, dpConn.Close(), net.ErrClosed)
+	_, _, err = dpConn.ReadFrom(make([]byte, 10))
+	require.ErrorIs(t, err, net.ErrClosed)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []error{nil}, reasons)
+}
+
+func TestWithDeadPeerDetection_InnerClosed(t *testing.T) {
+	conn := listenLocalUDP(t)
+	closed := make(chan error, 1)
+	dpConn, err := WithDeadPeerDetection(conn, DeadPeerDetection{
+		Timeout: time.Minute,
+		OnClose: func(err error) { closed <- err },
+	})
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		conn.Close()
+	}()
+	_, _, err = dpConn.ReadFrom(make([]byte, 10))
+	require.ErrorIs(t, err, net.ErrClosed)
+	require.ErrorIs(t, <-closed, net.ErrClosed)
+}
+
+func TestWithDeadPeerDetection_InvalidConfig(t *testing.T) {
+	conn := listenLocalUDP(t)
+	_, err := WithDeadPeerDetection(nil, DeadPeerDetection{Timeout: time.Second})
+	require.Error(t, err)
+	_, err = WithDeadPeerDetection(conn, DeadPeerDetection{})
+	require.Error(t, err)
+	_, err = WithDeadPeerDetection(conn, DeadPeerDetection{Timeout: time.Second, ProbeInterval: time.Second})
+	require.Error(t, err)
+}
+
+/********** Test Utilities **********/
+
+func listenLocalUDP(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func startUDPEcho(t *testing.T) net.PacketConn {
+	conn := listenLocalUDP(t)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], addr)
+		}
+	}()
+	return conn
+}
@@ -34,6 +34,14 @@ if more data does arrive (TCP will usually send a RST).
 
 Connections can be wrapped to create nested connections over a new transport. For example, a StreamConn could be over TCP,
 over TLS over TCP, over HTTP over TLS over TCP, over QUIC, among other options.
+A wrapping connection must implement CloseWrite by first sending any data it has buffered and then calling CloseWrite on the
+connection it wraps, so that protocols that rely on half-close, like HTTP/1.0 or git, see the EOF after all the data.
+[WrapConn] takes care of that for writers that have a Flush() error method.
+Wrappers should also keep the fast paths of the connection they wrap: [io.ReaderFrom], [io.WriterTo], and [BuffersWriter]
+for vectorized writes of [net.Buffers]. Use [WriteBuffers] to write multiple buffers to any writer.
+
+Packet connections through a relay don't notice when the relay stops forwarding packets. [WithDeadPeerDetection] closes
+them when the relay stops responding, optionally sending probes to tell an unresponsive destination from a dead relay.
 
 # Dialers
 
@@ -43,5 +51,25 @@ The [StreamDialer] and [PacketDialer] types create stream ([StreamConn]) and dat
 Dialers can also be nested. For example, a TLS Stream Dialer can use a TCP dialer to create a StreamConn backed by a TCP connection,
 then create a TLS StreamConn backed by the TCP StreamConn. A SOCKS5-over-TLS Dialer could use the TLS Dialer to create the TLS StreamConn
 to the proxy before doing the SOCKS5 connection to the target address.
+
+Dialers can advertise what they support, like packets, remote DNS resolution or IPv6, by implementing [CapabilityReporter].
+Use [Capabilities] or [CheckCapabilities] to reject compositions that can't work before using them.
+Proxy dialers and endpoints can also measure the round-trip time to their server by implementing [Pinger]. Use [Ping]
+to rank servers for failover, load balancing or server lists without dialing a destination.
+Endpoints resolve the host names of their addresses with the dialer by default. Set a [ResolutionPolicy] on a [TCPEndpoint]
+or [UDPEndpoint] to pick the address families, use a custom [HostResolver], like one from dns.NewHostResolver, or cache
+the addresses for their TTL. Endpoints with other dialers always pass the host name to the dialer.
+
+The dialers in this package create the system sockets. Apps running as a VPN on Android must exclude those sockets from the VPN,
+so the traffic doesn't loop back into it, by calling VpnService.protect in a [SetSocketProtector] function.
+
+# Errors
+
+Handshake errors from the SOCKS5, Shadowsocks, TLS and HTTP CONNECT dialers keep their protocol-specific details,
+like the reply codes of SOCKS5, but also match one of the error classes [ErrProxyHandshake], [ErrUpstreamUnreachable]
+and [ErrBlockedSuspected] with [errors.Is], so applications can tell a misconfigured proxy from an unreachable
+destination or from suspected blocking without matching strings. Other errors, like the system errors of a failed
+dial, don't match a class, but [ErrorClass] infers it from the system error. [ErrorClass] returns the class of any
+error, or nil if unknown.
 */
 package transport
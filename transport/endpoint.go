@@ -0,0 +1,198 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AddressPolicy determines the order in which the addresses of a multi-address endpoint are tried.
+type AddressPolicy int
+
+const (
+	// AddressFailover tries the addresses in order, starting from the last one that worked, so connections stick
+	// to a working address.
+	AddressFailover AddressPolicy = iota
+	// AddressRotate starts each connection on the address after the one used by the previous connection, to spread
+	// the connections over all the addresses. Failed attempts still move on to the next address.
+	AddressRotate
+)
+
+func (p AddressPolicy) String() string {
+	switch p {
+	case AddressFailover:
+		return "failover"
+	case AddressRotate:
+		return "rotate"
+	default:
+		return fmt.Sprintf("AddressPolicy(%d)", int(p))
+	}
+}
+
+// ParseAddressList parses a list of candidate addresses for the same server, in the form "HOSTS:PORTS", where HOSTS
+// and PORTS are comma-separated lists, and returns all the host:port combinations, grouped by host. IPv6 hosts must be
+// in brackets. For example, "[2001:db8::1],example.com:443,8443" returns "[2001:db8::1]:443", "[2001:db8::1]:8443",
+// "example.com:443" and "example.com:8443".
+func ParseAddressList(list string) ([]string, error) {
+	// The port list starts after the last colon that is not in brackets.
+	portsStart := -1
+	depth := 0
+	for i, c := range list {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				portsStart = i
+			}
+		}
+	}
+	if portsStart < 0 {
+		return nil, fmt.Errorf("missing port in address list %q", list)
+	}
+	var addresses []string
+	for _, host := range strings.Split(list[:portsStart], ",") {
+		host = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(host), "["), "]")
+		if host == "" {
+			return nil, fmt.Errorf("empty host in address list %q", list)
+		}
+		for _, port := range strings.Split(list[portsStart+1:], ",") {
+			port = strings.TrimSpace(port)
+			if port == "" {
+				return nil, fmt.Errorf("empty port in address list %q", list)
+			}
+			addresses = append(addresses, net.JoinHostPort(host, port))
+		}
+	}
+	return addresses, nil
+}
+
+// addressRotator holds the state of a multi-address endpoint.
+type addressRotator struct {
+	mu   sync.Mutex
+	next int
+}
+
+// order returns the indices of the numAddresses addresses in the order to try them.
+func (r *addressRotator) order(numAddresses int, policy AddressPolicy) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	start := r.next % numAddresses
+	if policy == AddressRotate {
+		r.next = start + 1
+	}
+	order := make([]int, numAddresses)
+	for i := range order {
+		order[i] = (start + i) % numAddresses
+	}
+	return order
+}
+
+// succeeded records that the address at index worked.
+func (r *addressRotator) succeeded(index int, policy AddressPolicy) {
+	if policy != AddressFailover {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next = index
+}
+
+// connectAny tries the addresses in the order of the policy until connect succeeds.
+func connectAny[Conn any](ctx context.Context, r *addressRotator, addresses []string, policy AddressPolicy, attemptTimeout time.Duration, connect func(ctx context.Context, address string) (Conn, error)) (Conn, error) {
+	var zero Conn
+	if len(addresses) == 0 {
+		return zero, errors.New("endpoint has no addresses")
+	}
+	var errs []error
+	for _, index := range r.order(len(addresses), policy) {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if attemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, attemptTimeout)
+		}
+		conn, err := connect(attemptCtx, addresses[index])
+		cancel()
+		if err == nil {
+			r.succeeded(index, policy)
+			return conn, nil
+		}
+		errs = append(errs, fmt.Errorf("failed to connect to %v: %w", addresses[index], err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return zero, errors.Join(errs...)
+}
+
+// MultiStreamEndpoint is a [StreamEndpoint] that connects to one of multiple candidate addresses of the same server,
+// like different IPs, ports or host names, with the [StreamDialer]. If a connection attempt fails, it tries the next
+// address. Use [ParseAddressList] to create the addresses from a compact list.
+type MultiStreamEndpoint struct {
+	Dialer    StreamDialer
+	Addresses []string
+	// Policy determines the order in which the addresses are tried.
+	Policy AddressPolicy
+	// AttemptTimeout limits each connection attempt, so blocked addresses that drop packets don't use all the time
+	// of the context. Zero means no limit other than the context.
+	AttemptTimeout time.Duration
+
+	rotator addressRotator
+}
+
+var _ StreamEndpoint = (*MultiStreamEndpoint)(nil)
+var _ ConnectAndWriter = (*MultiStreamEndpoint)(nil)
+
+// ConnectStream implements [StreamEndpoint].ConnectStream. It returns the errors of all the attempts if none
+// succeeds.
+func (e *MultiStreamEndpoint) ConnectStream(ctx context.Context) (StreamConn, error) {
+	return connectAny(ctx, &e.rotator, e.Addresses, e.Policy, e.AttemptTimeout, e.Dialer.DialStream)
+}
+
+// ConnectAndWrite implements [ConnectAndWriter] with [DialAndWrite] on the Dialer, so write errors also make it
+// try the next address.
+func (e *MultiStreamEndpoint) ConnectAndWrite(ctx context.Context, data []byte) (StreamConn, error) {
+	return connectAny(ctx, &e.rotator, e.Addresses, e.Policy, e.AttemptTimeout, func(ctx context.Context, address string) (StreamConn, error) {
+		return DialAndWrite(ctx, e.Dialer, address, data)
+	})
+}
+
+// MultiPacketEndpoint is a [PacketEndpoint] that connects to one of multiple candidate addresses of the same server
+// with the [PacketDialer]. Since packet connections usually don't fail until they are used, the failover only applies
+// to dial errors, like failed name resolutions, but [AddressRotate] still spreads the connections.
+type MultiPacketEndpoint struct {
+	Dialer    PacketDialer
+	Addresses []string
+	// Policy determines the order in which the addresses are tried.
+	Policy AddressPolicy
+	// AttemptTimeout limits each connection attempt. Zero means no limit other than the context.
+	AttemptTimeout time.Duration
+
+	rotator addressRotator
+}
+
+var _ PacketEndpoint = (*MultiPacketEndpoint)(nil)
+
+// ConnectPacket implements [PacketEndpoint].ConnectPacket.
+func (e *MultiPacketEndpoint) ConnectPacket(ctx context.Context) (net.Conn, error) {
+	return connectAny(ctx, &e.rotator, e.Addresses, e.Policy, e.AttemptTimeout, e.Dialer.DialPacket)
+}
@@ -0,0 +1,144 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddressList(t *testing.T) {
+	addresses, err := ParseAddressList("example.com:443,8443,53")
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.com:443", "example.com:8443", "example.com:53"}, addresses)
+
+	addresses, err = ParseAddressList("[2001:db8::1], 192.0.2.1:443, 8443")
+	require.NoError(t, err)
+	require.Equal(t, []string{"[2001:db8::1]:443", "[2001:db8::1]:8443", "192.0.2.1:443", "192.0.2.1:8443"}, addresses)
+
+	for _, list := range []string{"example.com", "example.com:", ",example.com:443", "example.com:443,", "[2001:db8::1]"} {
+		_, err = ParseAddressList(list)
+		require.Error(t, err, list)
+	}
+}
+
+// recordingStreamDialer fails to dial the addresses in failing, and records the dialed addresses.
+type recordingStreamDialer struct {
+	failing map[string]bool
+	dialed  []string
+}
+
+func (d *recordingStreamDialer) DialStream(ctx context.Context, addr string) (StreamConn, error) {
+	d.dialed = append(d.dialed, addr)
+	if d.failing[addr] {
+		return nil, errors.New("connection refused")
+	}
+	return &fakeStreamConn{}, nil
+}
+
+// fakeStreamConn is a connection that does nothing.
+type fakeStreamConn struct {
+	net.TCPConn
+}
+
+func (c *fakeStreamConn) Close() error { return nil }
+
+func TestMultiStreamEndpoint_Failover(t *testing.T) {
+	dialer := &recordingStreamDialer{failing: map[string]bool{"a:1": true}}
+	endpoint := &MultiStreamEndpoint{Dialer: dialer, Addresses: []string{"a:1", "a:2", "a:3"}}
+	for i := 0; i < 2; i++ {
+		conn, err := endpoint.ConnectStream(context.Background())
+		require.NoError(t, err)
+		conn.Close()
+	}
+	// The second connection starts on the address that worked.
+	require.Equal(t, []string{"a:1", "a:2", "a:2"}, dialer.dialed)
+}
+
+func TestMultiStreamEndpoint_Rotate(t *testing.T) {
+	dialer := &recordingStreamDialer{failing: map[string]bool{"a:2": true}}
+	endpoint := &MultiStreamEndpoint{Dialer: dialer, Addresses: []string{"a:1", "a:2", "a:3"}, Policy: AddressRotate}
+	for i := 0; i < 3; i++ {
+		conn, err := endpoint.ConnectStream(context.Background())
+		require.NoError(t, err)
+		conn.Close()
+	}
+	require.Equal(t, []string{"a:1", "a:2", "a:3", "a:3"}, dialer.dialed)
+}
+
+func TestMultiStreamEndpoint_AllFail(t *testing.T) {
+	dialer := &recordingStreamDialer{failing: map[string]bool{"a:1": true, "a:2": true}}
+	endpoint := &MultiStreamEndpoint{Dialer: dialer, Addresses: []string{"a:1", "a:2"}}
+	_, err := endpoint.ConnectStream(context.Background())
+	require.ErrorContains(t, err, "failed to connect to a:1")
+	require.ErrorContains(t, err, "failed to connect to a:2")
+
+	_, err = (&MultiStreamEndpoint{Dialer: dialer}).ConnectStream(context.Background())
+	require.Error(t, err)
+}
+
+func TestMultiStreamEndpoint_AttemptTimeout(t *testing.T) {
+	dialer := FuncStreamDialer(func(ctx context.Context, addr string) (StreamConn, error) {
+		if addr == "blackhole:1" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &fakeStreamConn{}, nil
+	})
+	endpoint := &MultiStreamEndpoint{Dialer: dialer, Addresses: []string{"blackhole:1", "ok:1"}, AttemptTimeout: 10 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := endpoint.ConnectStream(ctx)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestMultiStreamEndpoint_ContextCanceled(t *testing.T) {
+	dialer := &recordingStreamDialer{failing: map[string]bool{"a:1": true, "a:2": true}}
+	endpoint := &MultiStreamEndpoint{Dialer: dialer, Addresses: []string{"a:1", "a:2"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := endpoint.ConnectStream(ctx)
+	require.Error(t, err)
+	require.Equal(t, []string{"a:1"}, dialer.dialed)
+}
+
+func TestMultiPacketEndpoint(t *testing.T) {
+	var dialed []string
+	dialer := FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		a, b := net.Pipe()
+		b.Close()
+		return a, nil
+	})
+	endpoint := &MultiPacketEndpoint{Dialer: dialer, Addresses: []string{"a:1", "a:2"}, Policy: AddressRotate}
+	for i := 0; i < 3; i++ {
+		conn, err := endpoint.ConnectPacket(context.Background())
+		require.NoError(t, err)
+		conn.Close()
+	}
+	require.Equal(t, []string{"a:1", "a:2", "a:1"}, dialed)
+}
+
+func TestAddressPolicyString(t *testing.T) {
+	require.Equal(t, "failover", AddressFailover.String())
+	require.Equal(t, "rotate", AddressRotate.String())
+	require.Equal(t, "AddressPolicy(7)", AddressPolicy(7).String())
+}
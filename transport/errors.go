@@ -0,0 +1,97 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"errors"
+	"io"
+	"syscall"
+)
+
+// Error classes. Transports wrap their errors so they match these with [errors.Is], in addition to the
+// protocol-specific errors, so applications can handle failures by class. Use [ErrorClass] to get the class.
+var (
+	// ErrProxyHandshake is the class of failures in the handshake with a proxy or a TLS server, like protocol
+	// violations, rejected credentials or rejected requests.
+	ErrProxyHandshake = errors.New("proxy handshake failed")
+	// ErrUpstreamUnreachable is the class of failures to reach the destination, as reported by a proxy or by the
+	// local network, like refused connections or unreachable hosts.
+	ErrUpstreamUnreachable = errors.New("upstream unreachable")
+	// ErrBlockedSuspected is the class of failures that are typical of network interference, like connections
+	// that are reset, or closed in the middle of a handshake. It's a hint, not a proof: servers can fail that
+	// way too.
+	ErrBlockedSuspected = errors.New("blocking suspected")
+)
+
+// classError wraps an error so it also matches a list of classes.
+type classError struct {
+	err     error
+	classes []error
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classError) Unwrap() []error {
+	return append([]error{e.err}, e.classes...)
+}
+
+// WithErrorClass returns an error that wraps err and also matches the given classes with [errors.Is].
+// The message is the message of err. It returns nil if err is nil.
+func WithErrorClass(err error, classes ...error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{err: err, classes: classes}
+}
+
+// NewHandshakeError wraps an error from a handshake so it matches the class, and [ErrBlockedSuspected] as well if
+// the connection was reset or closed in the middle of the handshake. Errors that already match a class, like the
+// errors of a nested dialer, are returned as is.
+func NewHandshakeError(err error, class error) error {
+	if err == nil {
+		return nil
+	}
+	for _, existing := range []error{ErrBlockedSuspected, ErrUpstreamUnreachable, ErrProxyHandshake} {
+		if errors.Is(err, existing) {
+			return err
+		}
+	}
+	classes := []error{class}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		classes = append(classes, ErrBlockedSuspected)
+	}
+	return WithErrorClass(err, classes...)
+}
+
+// ErrorClass returns the class of err: [ErrBlockedSuspected], [ErrUpstreamUnreachable] or [ErrProxyHandshake]
+// if err matches them, in that order, or the class inferred from the system error otherwise. It returns nil if
+// the class is unknown.
+func ErrorClass(err error) error {
+	for _, class := range []error{ErrBlockedSuspected, ErrUpstreamUnreachable, ErrProxyHandshake} {
+		if errors.Is(err, class) {
+			return class
+		}
+	}
+	switch {
+	case errors.Is(err, syscall.ECONNRESET):
+		return ErrBlockedSuspected
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH):
+		return ErrUpstreamUnreachable
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithErrorClass(t *testing.T) {
+	base := errors.New("reply 7")
+	err := WithErrorClass(base, ErrProxyHandshake)
+	require.Equal(t, "reply 7", err.Error())
+	require.ErrorIs(t, err, base)
+	require.ErrorIs(t, err, ErrProxyHandshake)
+	require.NotErrorIs(t, err, ErrUpstreamUnreachable)
+	require.NoError(t, WithErrorClass(nil, ErrProxyHandshake))
+
+	wrapped := fmt.Errorf("dial failed: %w", err)
+	require.Equal(t, ErrProxyHandshake, ErrorClass(wrapped))
+}
+
+func TestNewHandshakeError(t *testing.T) {
+	err := NewHandshakeError(fmt.Errorf("failed to read response: %w", io.EOF), ErrProxyHandshake)
+	require.ErrorIs(t, err, ErrProxyHandshake)
+	require.ErrorIs(t, err, ErrBlockedSuspected)
+	require.ErrorIs(t, err, io.EOF)
+	// Suspected blocking takes precedence.
+	require.Equal(t, ErrBlockedSuspected, ErrorClass(err))
+
+	err = NewHandshakeError(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, ErrProxyHandshake)
+	require.ErrorIs(t, err, ErrBlockedSuspected)
+
+	err = NewHandshakeError(errors.New("invalid protocol version"), ErrProxyHandshake)
+	require.NotErrorIs(t, err, ErrBlockedSuspected)
+	require.Equal(t, ErrProxyHandshake, ErrorClass(err))
+
+	// Errors that have a class keep it.
+	unreachable := WithErrorClass(errors.New("host unreachable"), ErrUpstreamUnreachable)
+	err = NewHandshakeError(fmt.Errorf("nested: %w", unreachable), ErrProxyHandshake)
+	require.NotErrorIs(t, err, ErrProxyHandshake)
+	require.Equal(t, ErrUpstreamUnreachable, ErrorClass(err))
+
+	require.NoError(t, NewHandshakeError(nil, ErrProxyHandshake))
+}
+
+func TestErrorClass_Inferred(t *testing.T) {
+	opError := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}
+	}
+	require.Equal(t, ErrUpstreamUnreachable, ErrorClass(opError(syscall.ECONNREFUSED)))
+	require.Equal(t, ErrUpstreamUnreachable, ErrorClass(opError(syscall.EHOSTUNREACH)))
+	require.Equal(t, ErrUpstreamUnreachable, ErrorClass(opError(syscall.ENETUNREACH)))
+	require.Equal(t, ErrBlockedSuspected, ErrorClass(opError(syscall.ECONNRESET)))
+	require.Nil(t, ErrorClass(errors.New("unknown")))
+	require.Nil(t, ErrorClass(nil))
+}
@@ -0,0 +1,223 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nat64 maps IPv4 addresses to and from IPv6 addresses of a NAT64 prefix, as per [RFC 6052], so the SDK
+// can work on IPv6-only networks.
+//
+// On an IPv6-only network with a NAT64 gateway, use [NewStreamDialer] and [NewPacketDialer] to reach IPv4-only
+// proxy servers by their IPv4 address, which are then dialed at the IPv6 address that the gateway translates. You
+// can find the prefix of the network with [dns.DiscoverNAT64Prefixes].
+//
+// In the other direction, when the clients of a tunnel resolve names with a DNS64 resolver like the one from
+// [dns.NewDNS64Resolver], [NewExtractingStreamDialer] and [network.NewNAT64PacketProxy] translate their
+// destinations back to IPv4, so the remote proxy doesn't need a NAT64 gateway.
+//
+// [RFC 6052]: https://datatracker.ietf.org/doc/html/rfc6052
+package nat64
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// WellKnownPrefix is the Well-Known Prefix for the algorithmic mapping of IPv4 addresses to IPv6.
+var WellKnownPrefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// ValidatePrefix returns an error if the prefix is not a valid NAT64 prefix. Valid prefixes are IPv6 prefixes of
+// length 32, 40, 48, 56, 64 or 96.
+func ValidatePrefix(prefix netip.Prefix) error {
+	if !prefix.IsValid() || !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+		return fmt.Errorf("invalid NAT64 prefix %v", prefix)
+	}
+	switch prefix.Bits() {
+	case 32, 40, 48, 56, 64, 96:
+		return nil
+	default:
+		return fmt.Errorf("invalid NAT64 prefix length %v", prefix.Bits())
+	}
+}
+
+// ipv4Positions returns the positions of the bytes of the IPv4 address in the IPv6 addresses of the prefix, which
+// skip the byte 8 that RFC 6052 reserves.
+func ipv4Positions(prefixBits int) [4]int {
+	var positions [4]int
+	pos := prefixBits / 8
+	for i := range positions {
+		if pos == 8 {
+			pos++
+		}
+		positions[i] = pos
+		pos++
+	}
+	return positions
+}
+
+// Synthesize returns the IPv6 address of the prefix that embeds the IPv4 address.
+func Synthesize(prefix netip.Prefix, ipv4 netip.Addr) (netip.Addr, error) {
+	if err := ValidatePrefix(prefix); err != nil {
+		return netip.Addr{}, err
+	}
+	ipv4 = ipv4.Unmap()
+	if !ipv4.Is4() {
+		return netip.Addr{}, fmt.Errorf("address %v is not IPv4", ipv4)
+	}
+	ip6 := prefix.Masked().Addr().As16()
+	ip4 := ipv4.As4()
+	for i, pos := range ipv4Positions(prefix.Bits()) {
+		ip6[pos] = ip4[i]
+	}
+	return netip.AddrFrom16(ip6), nil
+}
+
+// Extract returns the IPv4 address embedded in an IPv6 address of the prefix. It returns false if the address is
+// not in the prefix, or if the prefix is invalid.
+func Extract(prefix netip.Prefix, ipv6 netip.Addr) (netip.Addr, bool) {
+	if ValidatePrefix(prefix) != nil || !ipv6.Is6() || ipv6.Is4In6() || !prefix.Contains(ipv6) {
+		return netip.Addr{}, false
+	}
+	ip6 := ipv6.As16()
+	var ip4 [4]byte
+	for i, pos := range ipv4Positions(prefix.Bits()) {
+		ip4[i] = ip6[pos]
+	}
+	return netip.AddrFrom4(ip4), true
+}
+
+// mapAddress applies mapIP to the IP of a host:port address. Addresses with domain names or IPs that mapIP
+// doesn't map are returned unchanged.
+func mapAddress(address string, mapIP func(netip.Addr) (netip.Addr, bool)) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return address
+	}
+	mapped, ok := mapIP(ip)
+	if !ok {
+		return address
+	}
+	return net.JoinHostPort(mapped.String(), port)
+}
+
+// synthesizer returns the function to map IPv4 addresses into the prefix.
+func synthesizer(prefix netip.Prefix) func(netip.Addr) (netip.Addr, bool) {
+	return func(ip netip.Addr) (netip.Addr, bool) {
+		if !ip.Unmap().Is4() {
+			return netip.Addr{}, false
+		}
+		mapped, err := Synthesize(prefix, ip)
+		return mapped, err == nil
+	}
+}
+
+type synthesizingStreamDialer struct {
+	dialer transport.StreamDialer
+	mapIP  func(netip.Addr) (netip.Addr, bool)
+}
+
+var _ transport.StreamDialer = (*synthesizingStreamDialer)(nil)
+var _ transport.CapabilityReporter = (*synthesizingStreamDialer)(nil)
+
+// NewStreamDialer creates a [transport.StreamDialer] that dials IPv4 addresses at their IPv6 address in the NAT64
+// prefix, to reach IPv4 servers from IPv6-only networks. Other addresses are dialed unchanged.
+func NewStreamDialer(dialer transport.StreamDialer, prefix netip.Prefix) (transport.StreamDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if err := ValidatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	return &synthesizingStreamDialer{dialer: dialer, mapIP: synthesizer(prefix)}, nil
+}
+
+// Capabilities implements [transport.CapabilityReporter]. It preserves the capabilities of the base dialer.
+func (d *synthesizingStreamDialer) Capabilities() transport.Capability {
+	return transport.Capabilities(d.dialer)
+}
+
+// DialStream implements [transport.StreamDialer].DialStream.
+func (d *synthesizingStreamDialer) DialStream(ctx context.Context, remoteAddr string) (transport.StreamConn, error) {
+	return d.dialer.DialStream(ctx, mapAddress(remoteAddr, d.mapIP))
+}
+
+type synthesizingPacketDialer struct {
+	dialer transport.PacketDialer
+	mapIP  func(netip.Addr) (netip.Addr, bool)
+}
+
+var _ transport.PacketDialer = (*synthesizingPacketDialer)(nil)
+var _ transport.CapabilityReporter = (*synthesizingPacketDialer)(nil)
+
+// NewPacketDialer creates a [transport.PacketDialer] that dials IPv4 addresses at their IPv6 address in the NAT64
+// prefix, to reach IPv4 servers from IPv6-only networks. Other addresses are dialed unchanged.
+func NewPacketDialer(dialer transport.PacketDialer, prefix netip.Prefix) (transport.PacketDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if err := ValidatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	return &synthesizingPacketDialer{dialer: dialer, mapIP: synthesizer(prefix)}, nil
+}
+
+// Capabilities implements [transport.CapabilityReporter]. It preserves the capabilities of the base dialer.
+func (d *synthesizingPacketDialer) Capabilities() transport.Capability {
+	return transport.Capabilities(d.dialer)
+}
+
+// DialPacket implements [transport.PacketDialer].DialPacket.
+func (d *synthesizingPacketDialer) DialPacket(ctx context.Context, remoteAddr string) (net.Conn, error) {
+	return d.dialer.DialPacket(ctx, mapAddress(remoteAddr, d.mapIP))
+}
+
+type extractingStreamDialer struct {
+	dialer transport.StreamDialer
+	prefix netip.Prefix
+}
+
+var _ transport.StreamDialer = (*extractingStreamDialer)(nil)
+var _ transport.CapabilityReporter = (*extractingStreamDialer)(nil)
+
+// NewExtractingStreamDialer creates a [transport.StreamDialer] that dials the IPv6 addresses of the NAT64 prefix at
+// the IPv4 address they embed. Use it to handle the connections of clients that resolve names with a DNS64
+// resolver, so the base dialer, like a remote proxy, doesn't need a NAT64 gateway. Other addresses are dialed
+// unchanged.
+func NewExtractingStreamDialer(dialer transport.StreamDialer, prefix netip.Prefix) (transport.StreamDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if err := ValidatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	return &extractingStreamDialer{dialer: dialer, prefix: prefix}, nil
+}
+
+// Capabilities implements [transport.CapabilityReporter]. It preserves the capabilities of the base dialer.
+func (d *extractingStreamDialer) Capabilities() transport.Capability {
+	return transport.Capabilities(d.dialer)
+}
+
+// DialStream implements [transport.StreamDialer].DialStream.
+func (d *extractingStreamDialer) DialStream(ctx context.Context, remoteAddr string) (transport.StreamConn, error) {
+	return d.dialer.DialStream(ctx, mapAddress(remoteAddr, func(ip netip.Addr) (netip.Addr, bool) {
+		return Extract(d.prefix, ip)
+	}))
+}
@@ -0,0 +1,143 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nat64
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// Examples from https://datatracker.ietf.org/doc/html/rfc6052#section-2.4
+var rfc6052Examples = []struct {
+	prefix string
+	ipv6   string
+}{
+	{"2001:db8::/32", "2001:db8:c000:221::"},
+	{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+	{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+	{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+	{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+	{"2001:db8:122:344::/96", "2001:db8:122:344::c000:221"},
+	{"64:ff9b::/96", "64:ff9b::c000:221"},
+}
+
+func TestSynthesize(t *testing.T) {
+	ipv4 := netip.MustParseAddr("192.0.2.33")
+	for _, example := range rfc6052Examples {
+		t.Run(example.prefix, func(t *testing.T) {
+			ipv6, err := Synthesize(netip.MustParsePrefix(example.prefix), ipv4)
+			require.NoError(t, err)
+			require.Equal(t, netip.MustParseAddr(example.ipv6), ipv6)
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	for _, example := range rfc6052Examples {
+		t.Run(example.prefix, func(t *testing.T) {
+			ipv4, ok := Extract(netip.MustParsePrefix(example.prefix), netip.MustParseAddr(example.ipv6))
+			require.True(t, ok)
+			require.Equal(t, netip.MustParseAddr("192.0.2.33"), ipv4)
+		})
+	}
+}
+
+func TestExtract_NotInPrefix(t *testing.T) {
+	_, ok := Extract(WellKnownPrefix, netip.MustParseAddr("2001:db8::1"))
+	require.False(t, ok)
+	_, ok = Extract(WellKnownPrefix, netip.MustParseAddr("192.0.2.33"))
+	require.False(t, ok)
+}
+
+func TestSynthesize_Invalid(t *testing.T) {
+	_, err := Synthesize(WellKnownPrefix, netip.MustParseAddr("2001:db8::1"))
+	require.Error(t, err)
+	_, err = Synthesize(netip.MustParsePrefix("2001:db8::/33"), netip.MustParseAddr("192.0.2.33"))
+	require.Error(t, err)
+	_, err = Synthesize(netip.MustParsePrefix("10.0.0.0/8"), netip.MustParseAddr("192.0.2.33"))
+	require.Error(t, err)
+	_, err = Synthesize(netip.MustParsePrefix("::ffff:0:0/96"), netip.MustParseAddr("192.0.2.33"))
+	require.Error(t, err)
+}
+
+func TestSynthesize_MappedIPv4(t *testing.T) {
+	ipv6, err := Synthesize(WellKnownPrefix, netip.MustParseAddr("::ffff:192.0.2.33"))
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParseAddr("64:ff9b::192.0.2.33"), ipv6)
+}
+
+func newRecordingStreamDialer(dialed *[]string) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		*dialed = append(*dialed, addr)
+		return nil, errors.New("not implemented")
+	})
+}
+
+func TestNewStreamDialer(t *testing.T) {
+	var dialed []string
+	dialer, err := NewStreamDialer(newRecordingStreamDialer(&dialed), WellKnownPrefix)
+	require.NoError(t, err)
+
+	for _, addr := range []string{"192.0.2.33:443", "[2001:db8::1]:443", "example.com:443", "invalid"} {
+		dialer.DialStream(context.Background(), addr)
+	}
+	require.Equal(t, []string{"[64:ff9b::c000:221]:443", "[2001:db8::1]:443", "example.com:443", "invalid"}, dialed)
+}
+
+func TestNewPacketDialer(t *testing.T) {
+	var dialed []string
+	dialer, err := NewPacketDialer(transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return nil, errors.New("not implemented")
+	}), netip.MustParsePrefix("2001:db8:122:344::/64"))
+	require.NoError(t, err)
+
+	dialer.DialPacket(context.Background(), "192.0.2.33:53")
+	require.Equal(t, []string{"[2001:db8:122:344:c0:2:2100:0]:53"}, dialed)
+}
+
+func TestNewExtractingStreamDialer(t *testing.T) {
+	var dialed []string
+	dialer, err := NewExtractingStreamDialer(newRecordingStreamDialer(&dialed), WellKnownPrefix)
+	require.NoError(t, err)
+
+	for _, addr := range []string{"[64:ff9b::c000:221]:443", "[2001:db8::1]:443", "192.0.2.33:443"} {
+		dialer.DialStream(context.Background(), addr)
+	}
+	require.Equal(t, []string{"192.0.2.33:443", "[2001:db8::1]:443", "192.0.2.33:443"}, dialed)
+}
+
+func TestNewDialers_Invalid(t *testing.T) {
+	_, err := NewStreamDialer(nil, WellKnownPrefix)
+	require.Error(t, err)
+	_, err = NewStreamDialer(&transport.TCPDialer{}, netip.MustParsePrefix("2001:db8::/33"))
+	require.Error(t, err)
+	_, err = NewPacketDialer(nil, WellKnownPrefix)
+	require.Error(t, err)
+	_, err = NewExtractingStreamDialer(nil, WellKnownPrefix)
+	require.Error(t, err)
+}
+
+func TestCapabilities(t *testing.T) {
+	dialer, err := NewStreamDialer(&transport.TCPDialer{}, WellKnownPrefix)
+	require.NoError(t, err)
+	require.Equal(t, transport.Capabilities(&transport.TCPDialer{}), transport.Capabilities(dialer))
+}
@@ -31,15 +31,22 @@ type UDPEndpoint struct {
 	// The Dialer used to create the net.Conn on Connect().
 	Dialer net.Dialer
 	// The endpoint address ("host:port") to pass to Dial.
-	// If the host is a domain name, consider pre-resolving it to avoid resolution calls.
+	// If the host is a domain name, consider pre-resolving it, or setting a Resolution policy with a cache, to
+	// avoid resolution calls.
 	Address string
+	// Resolution, if not nil, controls how the host name of the Address is resolved. See [ResolutionPolicy].
+	Resolution *ResolutionPolicy
 }
 
 var _ PacketEndpoint = (*UDPEndpoint)(nil)
 
 // ConnectPacket implements [PacketEndpoint].ConnectPacket.
 func (e UDPEndpoint) ConnectPacket(ctx context.Context) (net.Conn, error) {
-	return e.Dialer.DialContext(ctx, "udp", e.Address)
+	dialer := e.Dialer
+	protectDialer(&dialer)
+	return connectResolved(ctx, e.Resolution, e.Address, func(ctx context.Context, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "udp", address)
+	})
 }
 
 // FuncPacketEndpoint is a [PacketEndpoint] that uses the given function to connect.
@@ -79,10 +86,18 @@ type UDPDialer struct {
 }
 
 var _ PacketDialer = (*UDPDialer)(nil)
+var _ CapabilityReporter = (*UDPDialer)(nil)
+
+// Capabilities implements [CapabilityReporter].
+func (d *UDPDialer) Capabilities() Capability {
+	return CapabilityPacket | CapabilityIPv6
+}
 
 // DialPacket implements [PacketDialer].DialPacket.
 func (d *UDPDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
-	return d.Dialer.DialContext(ctx, "udp", addr)
+	dialer := d.Dialer
+	protectDialer(&dialer)
+	return dialer.DialContext(ctx, "udp", addr)
 }
 
 // PacketListenerDialer is a [PacketDialer] that connects to the destination using the specified [PacketListener].
@@ -92,6 +107,14 @@ type PacketListenerDialer struct {
 }
 
 var _ PacketDialer = (*PacketListenerDialer)(nil)
+var _ CapabilityReporter = (*PacketListenerDialer)(nil)
+
+// Capabilities implements [CapabilityReporter]. It preserves the packet, remote DNS and IPv6 support of the
+// listener, so a listener that can't create packet connections, like a SOCKS5 client without packets enabled, is
+// reported as such.
+func (e PacketListenerDialer) Capabilities() Capability {
+	return Capabilities(e.Listener) & (CapabilityPacket | CapabilityRemoteDNS | CapabilityIPv6)
+}
 
 type boundPacketConn struct {
 	net.PacketConn
@@ -160,10 +183,18 @@ type UDPListener struct {
 }
 
 var _ PacketListener = (*UDPListener)(nil)
+var _ CapabilityReporter = (*UDPListener)(nil)
+
+// Capabilities implements [CapabilityReporter].
+func (l UDPListener) Capabilities() Capability {
+	return CapabilityPacket | CapabilityIPv6
+}
 
 // ListenPacket implements [PacketListener].ListenPacket
 func (l UDPListener) ListenPacket(ctx context.Context) (net.PacketConn, error) {
-	return l.ListenConfig.ListenPacket(ctx, "udp", l.Address)
+	config := l.ListenConfig
+	protectListenConfig(&config)
+	return config.ListenPacket(ctx, "udp", l.Address)
 }
 
 // FuncPacketDialer is a [PacketDialer] that uses the given function to dial.
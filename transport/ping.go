@@ -0,0 +1,54 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Pinger is implemented by dialers and endpoints that can measure the round-trip time to their server, like a proxy.
+// Failover, load balancing and server lists can use it to rank servers without dialing a destination through them.
+type Pinger interface {
+	// Ping measures one application-level round trip to the server, like a handshake or a protocol echo, and
+	// returns its duration. It doesn't send any traffic to destinations through the server.
+	Ping(ctx context.Context) (time.Duration, error)
+}
+
+// ErrPingUnsupported is returned by [Ping] for objects that can't be pinged.
+var ErrPingUnsupported = errors.New("ping not supported")
+
+// Ping measures the round-trip time to the server of the given dialer or endpoint. If it doesn't implement [Pinger],
+// [StreamEndpoint] objects are pinged by timing [StreamEndpoint.ConnectStream], which includes the name resolution
+// and the handshakes of the endpoint. Other objects return an error wrapping [ErrPingUnsupported].
+func Ping(ctx context.Context, object any) (time.Duration, error) {
+	switch o := object.(type) {
+	case Pinger:
+		return o.Ping(ctx)
+	case StreamEndpoint:
+		start := time.Now()
+		conn, err := o.ConnectStream(ctx)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+		conn.Close()
+		return rtt, nil
+	default:
+		return 0, fmt.Errorf("%w: %T", ErrPingUnsupported, object)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fixedPinger time.Duration
+
+func (p fixedPinger) Ping(ctx context.Context) (time.Duration, error) {
+	return time.Duration(p), nil
+}
+
+func TestPing_Pinger(t *testing.T) {
+	rtt, err := Ping(context.Background(), fixedPinger(42*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, 42*time.Millisecond, rtt)
+}
+
+func TestPing_StreamEndpoint(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	rtt, err := Ping(context.Background(), &TCPEndpoint{Address: listener.Addr().String()})
+	require.NoError(t, err)
+	require.Greater(t, rtt, time.Duration(0))
+
+	connectErr := errors.New("connect failed")
+	_, err = Ping(context.Background(), FuncStreamEndpoint(func(ctx context.Context) (StreamConn, error) {
+		return nil, connectErr
+	}))
+	require.ErrorIs(t, err, connectErr)
+}
+
+func TestPing_Unsupported(t *testing.T) {
+	_, err := Ping(context.Background(), &TCPDialer{})
+	require.ErrorIs(t, err, ErrPingUnsupported)
+	require.ErrorContains(t, err, "*transport.TCPDialer")
+}
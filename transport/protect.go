@@ -0,0 +1,104 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"syscall"
+)
+
+var socketProtector atomic.Pointer[func(fd uintptr) error]
+
+// SetSocketProtector sets the function to call with the file descriptor of every socket created by [TCPDialer],
+// [TCPEndpoint], [UDPDialer], [UDPEndpoint] and [UDPListener], before the socket connects or binds.
+// If the function returns an error, the socket is closed and the dial or listen fails with that error.
+// Pass nil to remove the protector.
+//
+// Android apps running a VpnService must pass the descriptors to VpnService.protect, otherwise the traffic
+// of the SDK loops back into the VPN. The function is called for each new socket, so sockets created after
+// the device roams to a different network are protected too.
+//
+// The function must not close the file descriptor, or use it after returning. Host name resolution by
+// [net.Dialer] may use sockets that are not passed to the function, so dial IP addresses or resolve names
+// with a resolver that uses the dialers above.
+func SetSocketProtector(protect func(fd uintptr) error) {
+	if protect == nil {
+		socketProtector.Store(nil)
+		return
+	}
+	socketProtector.Store(&protect)
+}
+
+// protectDialer makes the dialer pass its sockets to the socket protector, if one is set, after its own Control.
+func protectDialer(dialer *net.Dialer) {
+	if protect := socketProtector.Load(); protect != nil {
+		addDialerControl(dialer, func(c syscall.RawConn) error {
+			return protectRawConn(c, *protect)
+		})
+	}
+}
+
+// protectListenConfig makes the listen config pass its sockets to the socket protector, if one is set,
+// after its own Control.
+func protectListenConfig(config *net.ListenConfig) {
+	protect := socketProtector.Load()
+	if protect == nil {
+		return
+	}
+	control := config.Control
+	config.Control = func(network, address string, c syscall.RawConn) error {
+		if control != nil {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+		return protectRawConn(c, *protect)
+	}
+}
+
+func protectRawConn(c syscall.RawConn, protect func(fd uintptr) error) error {
+	var protectErr error
+	if err := c.Control(func(fd uintptr) {
+		protectErr = protect(fd)
+	}); err != nil {
+		return err
+	}
+	return protectErr
+}
+
+// addDialerControl makes the dialer call control on its sockets, after its own Control.
+func addDialerControl(dialer *net.Dialer, control func(c syscall.RawConn) error) {
+	// ControlContext takes precedence over Control in net.Dialer.
+	if controlContext := dialer.ControlContext; controlContext != nil {
+		dialer.ControlContext = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+			if err := controlContext(ctx, network, address, c); err != nil {
+				return err
+			}
+			return control(c)
+		}
+		return
+	}
+	dialerControl := dialer.Control
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		if dialerControl != nil {
+			if err := dialerControl(network, address, c); err != nil {
+				return err
+			}
+		}
+		return control(c)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSocketProtector(t *testing.T) {
+	var mu sync.Mutex
+	var protected []uintptr
+	SetSocketProtector(func(fd uintptr) error {
+		mu.Lock()
+		defer mu.Unlock()
+		protected = append(protected, fd)
+		return nil
+	})
+	defer SetSocketProtector(nil)
+	countProtected := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(protected)
+	}
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	var ownControlCalled bool
+	tcpDialer := &TCPDialer{}
+	tcpDialer.Dialer.Control = func(network, address string, c syscall.RawConn) error {
+		ownControlCalled = true
+		return nil
+	}
+	conn, err := tcpDialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+	require.True(t, ownControlCalled)
+	require.Equal(t, 1, countProtected())
+
+	conn, err = tcpDialer.DialAndWrite(context.Background(), listener.Addr().String(), []byte("Request"))
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, 2, countProtected())
+
+	conn, err = (&TCPEndpoint{Address: listener.Addr().String()}).ConnectStream(context.Background())
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, 3, countProtected())
+
+	packetConn, err := (&UDPDialer{}).DialPacket(context.Background(), "127.0.0.1:53")
+	require.NoError(t, err)
+	packetConn.Close()
+	require.Equal(t, 4, countProtected())
+
+	packetConn, err = UDPEndpoint{Address: "127.0.0.1:53"}.ConnectPacket(context.Background())
+	require.NoError(t, err)
+	packetConn.Close()
+	require.Equal(t, 5, countProtected())
+
+	listenConn, err := UDPListener{Address: "127.0.0.1:0"}.ListenPacket(context.Background())
+	require.NoError(t, err)
+	listenConn.Close()
+	require.Equal(t, 6, countProtected())
+
+	// The dialers don't keep the protector in their own Control.
+	require.Nil(t, tcpDialer.Dialer.ControlContext)
+	SetSocketProtector(nil)
+	conn, err = tcpDialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, 6, countProtected())
+}
+
+func TestSetSocketProtector_Error(t *testing.T) {
+	protectErr := errors.New("protect failed")
+	SetSocketProtector(func(fd uintptr) error {
+		return protectErr
+	})
+	defer SetSocketProtector(nil)
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	_, err = (&TCPDialer{}).DialStream(context.Background(), listener.Addr().String())
+	require.ErrorIs(t, err, protectErr)
+	_, err = (&UDPDialer{}).DialPacket(context.Background(), "127.0.0.1:53")
+	require.ErrorIs(t, err, protectErr)
+	_, err = UDPListener{Address: "127.0.0.1:0"}.ListenPacket(context.Background())
+	require.ErrorIs(t, err, protectErr)
+}
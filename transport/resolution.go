@@ -0,0 +1,259 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// AddressFamily selects the IP versions of the addresses used to connect to a host name.
+type AddressFamily int
+
+const (
+	// AddressFamilyAll uses the IPv4 and IPv6 addresses, in the order returned by the resolver.
+	AddressFamilyAll AddressFamily = iota
+	// AddressFamilyIPv4 uses the IPv4 addresses only.
+	AddressFamilyIPv4
+	// AddressFamilyIPv6 uses the IPv6 addresses only.
+	AddressFamilyIPv6
+	// AddressFamilyPreferIPv4 uses the IPv4 addresses first, then the IPv6 addresses.
+	AddressFamilyPreferIPv4
+	// AddressFamilyPreferIPv6 uses the IPv6 addresses first, then the IPv4 addresses.
+	AddressFamilyPreferIPv6
+)
+
+func (f AddressFamily) String() string {
+	switch f {
+	case AddressFamilyAll:
+		return "all"
+	case AddressFamilyIPv4:
+		return "ipv4"
+	case AddressFamilyIPv6:
+		return "ipv6"
+	case AddressFamilyPreferIPv4:
+		return "prefer-ipv4"
+	case AddressFamilyPreferIPv6:
+		return "prefer-ipv6"
+	default:
+		return fmt.Sprintf("AddressFamily(%d)", int(f))
+	}
+}
+
+// network returns the network to resolve for the family: "ip4", "ip6" or "ip".
+func (f AddressFamily) network() string {
+	switch f {
+	case AddressFamilyIPv4:
+		return "ip4"
+	case AddressFamilyIPv6:
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// filter returns the addresses of the family, in the preferred order.
+func (f AddressFamily) filter(ips []netip.Addr) []netip.Addr {
+	var ip4s, ip6s []netip.Addr
+	for _, ip := range ips {
+		ip = ip.Unmap()
+		if ip.Is4() {
+			ip4s = append(ip4s, ip)
+		} else {
+			ip6s = append(ip6s, ip)
+		}
+	}
+	switch f {
+	case AddressFamilyIPv4:
+		return ip4s
+	case AddressFamilyIPv6:
+		return ip6s
+	case AddressFamilyPreferIPv4:
+		return append(ip4s, ip6s...)
+	case AddressFamilyPreferIPv6:
+		return append(ip6s, ip4s...)
+	default:
+		result := make([]netip.Addr, len(ips))
+		for i, ip := range ips {
+			result[i] = ip.Unmap()
+		}
+		return result
+	}
+}
+
+// HostResolver resolves host names for a [ResolutionPolicy].
+type HostResolver interface {
+	// ResolveHost returns the addresses of the host for the network, which is "ip", "ip4" or "ip6", and how long
+	// they can be cached. A zero TTL means the resolver doesn't know it.
+	ResolveHost(ctx context.Context, network string, host string) ([]netip.Addr, time.Duration, error)
+}
+
+// FuncHostResolver is a [HostResolver] that uses the given function to resolve.
+type FuncHostResolver func(ctx context.Context, network string, host string) ([]netip.Addr, time.Duration, error)
+
+var _ HostResolver = (*FuncHostResolver)(nil)
+
+// ResolveHost implements [HostResolver].
+func (f FuncHostResolver) ResolveHost(ctx context.Context, network string, host string) ([]netip.Addr, time.Duration, error) {
+	return f(ctx, network, host)
+}
+
+// defaultResolutionTTL is how long resolutions without a TTL are cached.
+const defaultResolutionTTL = time.Minute
+
+// ResolutionPolicy controls how endpoints resolve the host names of their addresses: which address families to
+// use, which resolver to use, and whether to cache the addresses. Without a policy, each dial resolves the host
+// name in its own way, usually with the system resolver on every connection.
+//
+// Only [TCPEndpoint] and [UDPEndpoint] take a policy, since they dial the resolved IPs directly. Endpoints with
+// arbitrary dialers pass the host name through, because the dialer may need it, like a TLS dialer for the SNI or a
+// proxy dialer that resolves names remotely.
+//
+// A policy can be shared by multiple endpoints, which then share its cache. It must not be copied after first use.
+type ResolutionPolicy struct {
+	// Family selects the IP versions of the addresses and their order.
+	Family AddressFamily
+	// Resolver resolves the host names. If nil, the system resolver is used.
+	Resolver HostResolver
+	// Cache makes the policy reuse the addresses of a host for their TTL, instead of resolving on every dial.
+	// The cached addresses are dropped if all of them fail to connect.
+	Cache bool
+	// DefaultTTL is how long addresses are cached when the resolver doesn't report a TTL, like the system resolver.
+	// If zero, one minute is used.
+	DefaultTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]resolutionCacheEntry
+}
+
+type resolutionCacheEntry struct {
+	ips     []netip.Addr
+	expires time.Time
+}
+
+// Resolve returns the addresses to connect to the host, in the order to try them. IP literals are returned as is,
+// but must match the Family.
+func (p *ResolutionPolicy) Resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips := p.Family.filter([]netip.Addr{ip})
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("address %v is not in the %v address family", host, p.Family)
+		}
+		return ips, nil
+	}
+	if ips, ok := p.cached(host); ok {
+		return ips, nil
+	}
+
+	network := p.Family.network()
+	var ips []netip.Addr
+	var ttl time.Duration
+	var err error
+	if p.Resolver != nil {
+		ips, ttl, err = p.Resolver.ResolveHost(ctx, network, host)
+	} else {
+		ips, err = net.DefaultResolver.LookupNetIP(ctx, network, host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %v: %w", host, err)
+	}
+	ips = p.Family.filter(ips)
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no %v addresses found for %v", p.Family, host)
+	}
+	p.store(host, ips, ttl)
+	return ips, nil
+}
+
+func (p *ResolutionPolicy) cached(host string) ([]netip.Addr, bool) {
+	if !p.Cache {
+		return nil, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.cache[host]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(p.cache, host)
+		return nil, false
+	}
+	// Callers may modify the result.
+	return append([]netip.Addr(nil), entry.ips...), true
+}
+
+func (p *ResolutionPolicy) store(host string, ips []netip.Addr, ttl time.Duration) {
+	if !p.Cache {
+		return
+	}
+	if ttl <= 0 {
+		ttl = p.DefaultTTL
+	}
+	if ttl <= 0 {
+		ttl = defaultResolutionTTL
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cache == nil {
+		p.cache = make(map[string]resolutionCacheEntry)
+	}
+	p.cache[host] = resolutionCacheEntry{ips: append([]netip.Addr(nil), ips...), expires: time.Now().Add(ttl)}
+}
+
+// forget drops the cached addresses of the host, so the next dial resolves it again.
+func (p *ResolutionPolicy) forget(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cache, host)
+}
+
+// connectResolved resolves the host of address with the policy, and calls connect with each of the resolved
+// addresses, in order, until one succeeds. If the policy is nil, it calls connect with the address as is.
+func connectResolved[Conn any](ctx context.Context, policy *ResolutionPolicy, address string, connect func(ctx context.Context, address string) (Conn, error)) (Conn, error) {
+	var zero Conn
+	if policy == nil {
+		return connect(ctx, address)
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return zero, err
+	}
+	ips, err := policy.Resolve(ctx, host)
+	if err != nil {
+		return zero, err
+	}
+	var errs []error
+	for _, ip := range ips {
+		conn, err := connect(ctx, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if ctx.Err() == nil {
+		// The addresses may be stale.
+		policy.forget(host)
+	}
+	return zero, errors.Join(errs...)
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testResolutionIPs = []netip.Addr{
+	netip.MustParseAddr("192.0.2.1"),
+	netip.MustParseAddr("2001:db8::1"),
+	netip.MustParseAddr("::ffff:192.0.2.2"),
+}
+
+func TestAddressFamily_Filter(t *testing.T) {
+	ip4a, ip6, ip4b := testResolutionIPs[0], testResolutionIPs[1], netip.MustParseAddr("192.0.2.2")
+	require.Equal(t, []netip.Addr{ip4a, ip6, ip4b}, AddressFamilyAll.filter(testResolutionIPs))
+	require.Equal(t, []netip.Addr{ip4a, ip4b}, AddressFamilyIPv4.filter(testResolutionIPs))
+	require.Equal(t, []netip.Addr{ip6}, AddressFamilyIPv6.filter(testResolutionIPs))
+	require.Equal(t, []netip.Addr{ip4a, ip4b, ip6}, AddressFamilyPreferIPv4.filter(testResolutionIPs))
+	require.Equal(t, []netip.Addr{ip6, ip4a, ip4b}, AddressFamilyPreferIPv6.filter(testResolutionIPs))
+	require.Equal(t, "prefer-ipv6", AddressFamilyPreferIPv6.String())
+}
+
+func TestResolutionPolicy_Network(t *testing.T) {
+	var networks []string
+	policy := &ResolutionPolicy{
+		Family: AddressFamilyIPv6,
+		Resolver: FuncHostResolver(func(ctx context.Context, network string, host string) ([]netip.Addr, time.Duration, error) {
+			networks = append(networks, network)
+			return testResolutionIPs, 0, nil
+		}),
+	}
+	ips, err := policy.Resolve(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, []netip.Addr{testResolutionIPs[1]}, ips)
+	require.Equal(t, []string{"ip6"}, networks)
+}
+
+func TestResolutionPolicy_IPLiteral(t *testing.T) {
+	policy := &ResolutionPolicy{Family: AddressFamilyIPv4, Resolver: failingHostResolver()}
+	ips, err := policy.Resolve(context.Background(), "192.0.2.1")
+	require.NoError(t, err)
+	require.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.1")}, ips)
+
+	_, err = policy.Resolve(context.Background(), "2001:db8::1")
+	require.Error(t, err)
+}
+
+func TestResolutionPolicy_NoAddresses(t *testing.T) {
+	policy := &ResolutionPolicy{
+		Family:   AddressFamilyIPv6,
+		Resolver: staticHostResolver(new(int), []netip.Addr{testResolutionIPs[0]}, 0),
+	}
+	_, err := policy.Resolve(context.Background(), "example.com")
+	require.Error(t, err)
+}
+
+func TestResolutionPolicy_NoCache(t *testing.T) {
+	var lookups int
+	policy := &ResolutionPolicy{Resolver: staticHostResolver(&lookups, testResolutionIPs, time.Hour)}
+	for i := 0; i < 3; i++ {
+		_, err := policy.Resolve(context.Background(), "example.com")
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, lookups)
+}
+
+func TestResolutionPolicy_CacheTTL(t *testing.T) {
+	var lookups int
+	policy := &ResolutionPolicy{Cache: true, Resolver: staticHostResolver(&lookups, testResolutionIPs, 50*time.Millisecond)}
+	for i := 0; i < 3; i++ {
+		ips, err := policy.Resolve(context.Background(), "example.com")
+		require.NoError(t, err)
+		require.Len(t, ips, 3)
+		// Changes to the result don't affect the cache.
+		ips[0] = netip.Addr{}
+	}
+	require.Equal(t, 1, lookups)
+
+	time.Sleep(60 * time.Millisecond)
+	ips, err := policy.Resolve(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, testResolutionIPs[0], ips[0])
+	require.Equal(t, 2, lookups)
+}
+
+func TestResolutionPolicy_DefaultTTL(t *testing.T) {
+	var lookups int
+	policy := &ResolutionPolicy{Cache: true, DefaultTTL: time.Hour, Resolver: staticHostResolver(&lookups, testResolutionIPs, 0)}
+	_, err := policy.Resolve(context.Background(), "example.com")
+	require.NoError(t, err)
+	policy.mu.Lock()
+	expires := policy.cache["example.com"].expires
+	policy.mu.Unlock()
+	require.WithinDuration(t, time.Now().Add(time.Hour), expires, time.Minute)
+}
+
+func TestConnectResolved_Failover(t *testing.T) {
+	var lookups int
+	policy := &ResolutionPolicy{Cache: true, Resolver: staticHostResolver(&lookups, testResolutionIPs[:2], time.Hour)}
+	var dialed []string
+	conn, err := connectResolved(context.Background(), policy, "example.com:443", func(ctx context.Context, address string) (string, error) {
+		dialed = append(dialed, address)
+		if address == "192.0.2.1:443" {
+			return "", errors.New("connection refused")
+		}
+		return address, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "[2001:db8::1]:443", conn)
+	require.Equal(t, []string{"192.0.2.1:443", "[2001:db8::1]:443"}, dialed)
+
+	// All addresses failing drops the cache.
+	_, err = connectResolved(context.Background(), policy, "example.com:443", func(ctx context.Context, address string) (string, error) {
+		return "", errors.New("connection refused")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, lookups)
+	_, err = policy.Resolve(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, 2, lookups)
+}
+
+func TestTCPEndpoint_Resolution(t *testing.T) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	endpoint := &TCPEndpoint{
+		Address: net.JoinHostPort("proxy.test", port),
+		Resolution: &ResolutionPolicy{
+			Family:   AddressFamilyIPv4,
+			Resolver: staticHostResolver(new(int), []netip.Addr{netip.MustParseAddr("127.0.0.1")}, 0),
+		},
+	}
+	conn, err := endpoint.ConnectStream(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, listener.Addr().String(), conn.RemoteAddr().String())
+	conn.Close()
+}
+
+/********** Test Utilities **********/
+
+func staticHostResolver(lookups *int, ips []netip.Addr, ttl time.Duration) HostResolver {
+	return FuncHostResolver(func(ctx context.Context, network string, host string) ([]netip.Addr, time.Duration, error) {
+		*lookups++
+		return append([]netip.Addr(nil), ips...), ttl, nil
+	})
+}
+
+func failingHostResolver() HostResolver {
+	return FuncHostResolver(func(ctx context.Context, network string, host string) ([]netip.Addr, time.Duration, error) {
+		return nil, 0, errors.New("unexpected lookup")
+	})
+}
@@ -19,11 +19,13 @@ import (
 	"crypto/cipher"
 	"crypto/md5"
 	"crypto/sha1"
-	"io"
+	"hash"
+	"runtime"
 	"strings"
+	"sync"
 
 	"golang.org/x/crypto/chacha20poly1305"
-	"golang.org/x/crypto/hkdf"
+	"golang.org/x/sys/cpu"
 )
 
 type cipherSpec struct {
@@ -63,6 +65,31 @@ func (err ErrUnsupportedCipher) Error() string {
 // Largest tag size among the supported ciphers. Used by the TCP buffer pool
 const maxTagSize = 16
 
+// Largest key and nonce sizes among the supported ciphers.
+const (
+	maxKeySize   = 32
+	maxNonceSize = 12
+)
+
+// hasAESGCMHardwareSupport is true if the CPU has instructions that make AES-GCM faster than ChaCha20-Poly1305,
+// as in crypto/tls.
+var hasAESGCMHardwareSupport = (cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ) ||
+	(runtime.GOARCH == "arm64" && cpu.ARM64.HasAES && cpu.ARM64.HasPMULL) ||
+	(runtime.GOARCH == "s390x" && cpu.S390X.HasAES && cpu.S390X.HasAESCBC && cpu.S390X.HasAESCTR &&
+		(cpu.S390X.HasGHASH || cpu.S390X.HasAESGCM))
+
+// PreferredCipher returns the fastest cipher on this device: [AES256GCM] if the CPU has AES-GCM instructions,
+// like AES-NI, or [CHACHA20IETFPOLY1305] otherwise, which is faster in software.
+//
+// The cipher of a connection is set by the server, so this is only useful when the app gets to pick,
+// for instance when creating the access keys of a server it manages.
+func PreferredCipher() string {
+	if hasAESGCMHardwareSupport {
+		return AES256GCM
+	}
+	return CHACHA20IETFPOLY1305
+}
+
 // CipherByName returns a [*Cipher] with the given name, or an error if the cipher is not supported.
 // The name must be the IETF name (as per https://www.iana.org/assignments/aead-parameters/aead-parameters.xhtml) or the
 // Shadowsocks alias from https://shadowsocks.org/guide/aead.html.
@@ -109,14 +136,90 @@ var subkeyInfo = []byte("ss-subkey")
 
 // NewAEAD creates the AEAD for this cipher
 func (c *EncryptionKey) NewAEAD(salt []byte) (cipher.AEAD, error) {
-	sessionKey := make([]byte, c.cipher.keySize)
-	r := hkdf.New(sha1.New, c.secret, salt, subkeyInfo)
-	if _, err := io.ReadFull(r, sessionKey); err != nil {
-		return nil, err
-	}
+	d := subkeyDeriverPool.Get().(*subkeyDeriver)
+	defer subkeyDeriverPool.Put(d)
+	// The AEAD constructors copy the key, so the buffer can be reused.
+	sessionKey := d.derive(c.secret, salt, subkeyInfo, d.sessionKey[:c.cipher.keySize])
 	return c.cipher.newInstance(sessionKey)
 }
 
+// subkeyDeriver computes HKDF-SHA1 (RFC 5869) without allocations. NewAEAD runs for every UDP packet and every
+// TCP connection, and hkdf.New allocates new HMAC states and their buffers on each call. The HMAC key changes in
+// every step, and crypto/hmac can only reset to the same key, so the deriver computes the HMACs with its own
+// SHA-1 states.
+type subkeyDeriver struct {
+	inner      hash.Hash
+	outer      hash.Hash
+	pad        [sha1.BlockSize]byte
+	hashedKey  [sha1.Size]byte
+	innerSum   [sha1.Size]byte
+	prk        [sha1.Size]byte
+	block      [sha1.Size]byte
+	counter    [1]byte
+	sessionKey [maxKeySize]byte
+}
+
+var subkeyDeriverPool = sync.Pool{
+	New: func() any {
+		return &subkeyDeriver{inner: sha1.New(), outer: sha1.New()}
+	},
+}
+
+// startHMAC resets the hash states to compute HMAC-SHA1 with the given key. The message goes to d.inner, and
+// the result is returned by finishHMAC.
+func (d *subkeyDeriver) startHMAC(key []byte) {
+	d.outer.Reset()
+	if len(key) > sha1.BlockSize {
+		d.outer.Write(key)
+		key = d.outer.Sum(d.hashedKey[:0])
+		d.outer.Reset()
+	}
+	d.inner.Reset()
+	for i := range d.pad {
+		d.pad[i] = 0x36
+		if i < len(key) {
+			d.pad[i] ^= key[i]
+		}
+	}
+	d.inner.Write(d.pad[:])
+	for i := range d.pad {
+		d.pad[i] = 0x5c
+		if i < len(key) {
+			d.pad[i] ^= key[i]
+		}
+	}
+	d.outer.Write(d.pad[:])
+}
+
+// finishHMAC appends the HMAC started with startHMAC to dst.
+func (d *subkeyDeriver) finishHMAC(dst []byte) []byte {
+	d.outer.Write(d.inner.Sum(d.innerSum[:0]))
+	return d.outer.Sum(dst)
+}
+
+// derive fills out with the HKDF-SHA1 output for the given secret, salt and info, and returns it.
+// The output must not be longer than 255 SHA-1 blocks.
+func (d *subkeyDeriver) derive(secret, salt, info, out []byte) []byte {
+	// Extract: PRK = HMAC(salt, secret).
+	d.startHMAC(salt)
+	d.inner.Write(secret)
+	prk := d.finishHMAC(d.prk[:0])
+
+	// Expand: T(i) = HMAC(PRK, T(i-1) | info | i).
+	var previous []byte
+	d.counter[0] = 0
+	for n := 0; n < len(out); {
+		d.startHMAC(prk)
+		d.inner.Write(previous)
+		d.inner.Write(info)
+		d.counter[0]++
+		d.inner.Write(d.counter[:])
+		previous = d.finishHMAC(d.block[:0])
+		n += copy(out[n:], previous)
+	}
+	return out
+}
+
 // Function definition at https://www.openssl.org/docs/manmaster/man3/EVP_BytesToKey.html
 func simpleEVPBytesToKey(data []byte, keyLen int) ([]byte, error) {
 	var derived, di []byte
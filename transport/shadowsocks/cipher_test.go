@@ -15,10 +15,13 @@
 package shadowsocks
 
 import (
+	"crypto/sha1"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/hkdf"
 )
 
 func assertCipher(t *testing.T, cipher string, saltSize, tagSize int) {
@@ -97,3 +100,61 @@ func TestMaxTagSize(t *testing.T) {
 	}
 	require.Equal(t, maxTagSize, calculatedMax)
 }
+
+func TestMaxKeySize(t *testing.T) {
+	for _, cipher := range supportedCiphers {
+		spec, err := cipherByName(cipher)
+		require.NoError(t, err)
+		require.LessOrEqual(t, spec.keySize, maxKeySize, cipher)
+	}
+}
+
+func TestPreferredCipher(t *testing.T) {
+	cipher := PreferredCipher()
+	require.Contains(t, supportedCiphers, cipher)
+	if hasAESGCMHardwareSupport {
+		require.Equal(t, AES256GCM, cipher)
+	} else {
+		require.Equal(t, CHACHA20IETFPOLY1305, cipher)
+	}
+}
+
+func TestSubkeyDeriver_MatchesHKDF(t *testing.T) {
+	d := subkeyDeriverPool.Get().(*subkeyDeriver)
+	defer subkeyDeriverPool.Put(d)
+	for _, salt := range [][]byte{nil, make([]byte, 16), []byte("0123456789abcdef0123456789abcdef"), make([]byte, 100)} {
+		for _, size := range []int{16, 24, 32, 50} {
+			expected := make([]byte, size)
+			_, err := io.ReadFull(hkdf.New(sha1.New, []byte("secret"), salt, subkeyInfo), expected)
+			require.NoError(t, err)
+			require.Equal(t, expected, d.derive([]byte("secret"), salt, subkeyInfo, make([]byte, size)))
+		}
+	}
+}
+
+func TestSubkeyDeriver_NoAllocations(t *testing.T) {
+	d := subkeyDeriverPool.Get().(*subkeyDeriver)
+	defer subkeyDeriverPool.Put(d)
+	secret := []byte("secret")
+	salt := make([]byte, 32)
+	out := make([]byte, 32)
+	allocs := testing.AllocsPerRun(100, func() {
+		d.derive(secret, salt, subkeyInfo, out)
+	})
+	require.Equal(t, float64(0), allocs)
+}
+
+func TestNewAEAD_Allocations(t *testing.T) {
+	key, err := NewEncryptionKey(CHACHA20IETFPOLY1305, "test secret")
+	require.NoError(t, err)
+	salt := make([]byte, key.SaltSize())
+	allocs := testing.AllocsPerRun(100, func() {
+		key.NewAEAD(salt)
+	})
+	hkdfAllocs := testing.AllocsPerRun(100, func() {
+		subkey := make([]byte, key.cipher.keySize)
+		io.ReadFull(hkdf.New(sha1.New, key.secret, salt, subkeyInfo), subkey)
+		key.cipher.newInstance(subkey)
+	})
+	require.Less(t, allocs, hkdfAllocs)
+}
@@ -27,6 +27,12 @@ When using Shadowsocks, you will need a server. There are many ways to run Shado
   - [Outline Manager app]: The easiest way to create and manage Shadowsocks servers in the cloud.
   - [outline-ss-server]: A command-line tool for advanced users offering greater configuration flexibility.
 
+# Choosing a Cipher
+
+The cipher is part of the server configuration. When creating the keys of a server you manage, use [PreferredCipher]
+to pick the fastest cipher for the device: AES-GCM is faster on CPUs with AES instructions, like AES-NI on x86 and the
+ARMv8 crypto extensions, while ChaCha20-Poly1305 is faster in software. All the supported ciphers are equally secure.
+
 # IPv6 Limitations
 
 The Shadowsocks proxy protocol lacks a mechanism for servers to signal successful connection to a destination.
@@ -50,6 +56,14 @@ completely random secret for every session, and delivering it to the client in a
 With Outline, that can be done via [Dynamic Keys]: when the Dynamic Key is requested, generate a new secret.
 The response is sent over TLS, which implements forward-secrecy.
 
+Shadowsocks-UDP packets are not protected against replay by the protocol. To drop replayed and reflected packets,
+enable a [ReplayCache] on the packet listener with SetReplayCache. Every packet has its own random salt, so the cache
+rejects packets whose salt was already seen. Use SetReplayHandler to count the dropped packets. The sliding packet ID windows of [SIP022] only apply to the 2022 ciphers, which
+are not supported by this package.
+
+UDP is connectionless, so a server that stops relaying packets goes unnoticed. Use SetDeadPeerDetection on the packet
+listener to close connections when the server stops responding, as configured by [transport.DeadPeerDetection].
+
 [SOCKS5]: https://datatracker.ietf.org/doc/html/rfc1928
 [Outline Manager app]: https://getoutline.org/get-started/#step-1
 [outline-ss-server]: https://github.com/Jigsaw-Code/outline-ss-server?tab=readme-ov-file#how-to-run-it
@@ -57,5 +71,6 @@ The response is sent over TLS, which implements forward-secrecy.
 [Proxy protocol]: https://shadowsocks.org/doc/what-is-shadowsocks.html
 [stream ciphers]: https://shadowsocks.org/doc/stream.html
 [Dynamic Keys]: https://www.reddit.com/r/outlinevpn/wiki/index/dynamic_access_keys/
+[SIP022]: https://shadowsocks.org/doc/sip022.html
 */
 package shadowsocks
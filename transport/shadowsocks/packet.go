@@ -22,8 +22,8 @@ import (
 // ErrShortPacket indicates that the destination packet given to Unpack is too short.
 var ErrShortPacket = errors.New("short packet")
 
-// Assumes all ciphers have NonceSize() <= 12.
-var zeroNonce [12]byte
+// Assumes all ciphers have NonceSize() <= maxNonceSize.
+var zeroNonce [maxNonceSize]byte
 
 // PackSalt encrypts a Shadowsocks-UDP packet and returns a slice containing the encrypted packet.
 // dst must be big enough to hold the encrypted packet.
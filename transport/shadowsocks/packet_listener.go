@@ -36,9 +36,18 @@ type packetListener struct {
 	endpoint      transport.PacketEndpoint
 	key           *EncryptionKey
 	saltGenerator SaltGenerator
+	replayCache   *ReplayCache
+	onReplay      func()
+	deadPeer      *transport.DeadPeerDetection
 }
 
 var _ transport.PacketListener = (*packetListener)(nil)
+var _ transport.CapabilityReporter = (*packetListener)(nil)
+
+// Capabilities implements [transport.CapabilityReporter].
+func (pl *packetListener) Capabilities() transport.Capability {
+	return transport.CapabilityPacket | transport.CapabilityRemoteDNS | transport.CapabilityIPv6
+}
 
 type PacketListener = *packetListener
 
@@ -59,19 +68,51 @@ func (pl *packetListener) SetSaltGenerator(sg SaltGenerator) {
 	pl.saltGenerator = sg
 }
 
+// SetReplayCache enables replay protection for the connections created by the listener, which is disabled by default.
+// Received packets whose salt is in the cache are dropped, and reading continues with the next packet. The salts of
+// sent packets are also added to the cache, so that packets reflected back by an attacker are dropped as well.
+func (pl *packetListener) SetReplayCache(cache *ReplayCache) {
+	pl.replayCache = cache
+}
+
+// SetReplayHandler sets a function to call for each packet dropped by the replay protection, for instance to count
+// them. It must not block.
+func (pl *packetListener) SetReplayHandler(handler func()) {
+	pl.onReplay = handler
+}
+
+// SetDeadPeerDetection makes the connections created by the listener close when the server stops responding,
+// as configured. Pass nil to disable it, which is the default.
+func (pl *packetListener) SetDeadPeerDetection(config *transport.DeadPeerDetection) {
+	pl.deadPeer = config
+}
+
 // ListenPacket creates a net.PackeConn to send packets from the remote endpoint.
 func (pl *packetListener) ListenPacket(ctx context.Context) (net.PacketConn, error) {
 	proxyConn, err := pl.endpoint.ConnectPacket(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("could not connect to endpoint: %w", err)
 	}
-	return &packetConn{Conn: proxyConn, key: pl.key, saltGenerator: pl.saltGenerator}, nil
+	conn := &packetConn{Conn: proxyConn, key: pl.key, saltGenerator: pl.saltGenerator, replayCache: pl.replayCache, onReplay: pl.onReplay}
+	if pl.deadPeer == nil {
+		return conn, nil
+	}
+	wrapped, err := transport.WithDeadPeerDetection(conn, *pl.deadPeer)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return wrapped, nil
 }
 
 type packetConn struct {
 	net.Conn
 	key           *EncryptionKey
 	saltGenerator SaltGenerator
+	// replayCache is nil if replay protection is disabled.
+	replayCache *ReplayCache
+	// onReplay, if not nil, is called for each dropped replayed packet.
+	onReplay func()
 }
 
 var _ net.PacketConn = (*packetConn)(nil)
@@ -103,23 +144,37 @@ func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if c.replayCache != nil {
+		// Remember our own salts, so that reflected packets are rejected.
+		c.replayCache.Add(buf[:saltSize])
+	}
 	_, err = c.Conn.Write(buf)
 	return len(b), err
 }
 
-// ReadFrom reads from the embedded PacketConn and decrypts into `b`.
+// ReadFrom reads from the embedded PacketConn and decrypts into `b`. Replayed packets are dropped.
 func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
 	lazySlice := udpPool.LazySlice()
 	cipherBuf := lazySlice.Acquire()
 	defer lazySlice.Release()
-	n, err := c.Conn.Read(cipherBuf)
-	if err != nil {
-		return 0, nil, err
-	}
-	// Decrypt in-place.
-	buf, err := Unpack(nil, cipherBuf[:n], c.key)
-	if err != nil {
-		return 0, nil, err
+	var buf []byte
+	for {
+		n, err := c.Conn.Read(cipherBuf)
+		if err != nil {
+			return 0, nil, err
+		}
+		// Decrypt in-place.
+		buf, err = Unpack(nil, cipherBuf[:n], c.key)
+		if err != nil {
+			return 0, nil, err
+		}
+		// Only authenticated packets are added to the cache, so that forged packets can't evict the valid salts.
+		if c.replayCache == nil || c.replayCache.Add(cipherBuf[:c.key.SaltSize()]) {
+			break
+		}
+		if c.onReplay != nil {
+			c.onReplay()
+		}
 	}
 	socksSrcAddr := socks.SplitAddr(buf)
 	if socksSrcAddr == nil {
@@ -129,7 +184,7 @@ func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
 	if err != nil {
 		return 0, nil, fmt.Errorf("failed to convert incoming address: %w", err)
 	}
-	n = copy(b, buf[len(socksSrcAddr):]) // Strip the SOCKS source address
+	n := copy(b, buf[len(socksSrcAddr):]) // Strip the SOCKS source address
 	if len(b) < len(buf)-len(socksSrcAddr) {
 		return n, srcAddr, io.ErrShortBuffer
 	}
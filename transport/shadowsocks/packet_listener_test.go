@@ -50,6 +50,27 @@ func TestShadowsocksPacketListener_ListenPacket(t *testing.T) {
 	running.Wait()
 }
 
+func TestShadowsocksPacketListener_DeadPeer(t *testing.T) {
+	key := makeTestKey(t)
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer server.Close()
+
+	listener, err := NewPacketListener(transport.UDPEndpoint{Address: server.LocalAddr().String()}, key)
+	require.NoError(t, err)
+	listener.SetDeadPeerDetection(&transport.DeadPeerDetection{Timeout: 50 * time.Millisecond})
+	conn, err := listener.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	targetAddr, err := transport.MakeNetAddr("udp", testTargetAddr)
+	require.NoError(t, err)
+	_, err = conn.WriteTo([]byte("request"), targetAddr)
+	require.NoError(t, err)
+	_, _, err = conn.ReadFrom(make([]byte, 1024))
+	require.ErrorIs(t, err, transport.ErrPeerUnresponsive)
+}
+
 func BenchmarkShadowsocksPacketListener_ListenPacket(b *testing.B) {
 	b.StopTimer()
 	b.ResetTimer()
@@ -0,0 +1,65 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shadowsocks
+
+import "sync"
+
+// maxSaltSize is the largest salt size of the supported ciphers.
+const maxSaltSize = 32
+
+// ReplayCache remembers the salts of recent Shadowsocks-UDP packets to detect replays.
+// Each legacy AEAD packet has its own random salt, so a repeated salt means a replayed packet.
+//
+// It keeps two generations of up to capacity salts each, so it remembers at least the last capacity salts,
+// and discards the oldest generation in bulk. A ReplayCache is safe for concurrent use, and can be shared
+// by multiple connections with the same key.
+type ReplayCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	active  map[[maxSaltSize]byte]struct{}
+	archive map[[maxSaltSize]byte]struct{}
+}
+
+// NewReplayCache creates a [ReplayCache] that remembers at least the last capacity salts.
+func NewReplayCache(capacity int) *ReplayCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &ReplayCache{
+		capacity: capacity,
+		active:   make(map[[maxSaltSize]byte]struct{}, capacity),
+	}
+}
+
+// Add records the salt, and returns false if it was already in the cache.
+func (c *ReplayCache) Add(salt []byte) bool {
+	var key [maxSaltSize]byte
+	copy(key[:], salt)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.active[key]; ok {
+		return false
+	}
+	if _, ok := c.archive[key]; ok {
+		return false
+	}
+	if len(c.active) >= c.capacity {
+		c.archive = c.active
+		c.active = make(map[[maxSaltSize]byte]struct{}, c.capacity)
+	}
+	c.active[key] = struct{}{}
+	return true
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shadowsocks
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/shadowsocks/go-shadowsocks2/socks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayCache_Add(t *testing.T) {
+	cache := NewReplayCache(2)
+	require.True(t, cache.Add([]byte("salt-a")))
+	require.False(t, cache.Add([]byte("salt-a")))
+	require.True(t, cache.Add([]byte("salt-b")))
+	// The first generation is archived, but still remembered.
+	require.True(t, cache.Add([]byte("salt-c")))
+	require.False(t, cache.Add([]byte("salt-a")))
+	require.True(t, cache.Add([]byte("salt-d")))
+	// The first generation is discarded.
+	require.True(t, cache.Add([]byte("salt-e")))
+	require.True(t, cache.Add([]byte("salt-a")))
+	require.False(t, cache.Add([]byte("salt-d")))
+}
+
+func TestShadowsocksPacketListener_ReplayProtection(t *testing.T) {
+	key := makeTestKey(t)
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer server.Close()
+
+	listener, err := NewPacketListener(transport.UDPEndpoint{Address: server.LocalAddr().String()}, key)
+	require.NoError(t, err)
+	listener.SetReplayCache(NewReplayCache(100))
+	var replayed atomic.Int32
+	listener.SetReplayHandler(func() { replayed.Add(1) })
+	conn, err := listener.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	targetAddr, err := transport.MakeNetAddr("udp", testTargetAddr)
+	require.NoError(t, err)
+	_, err = conn.WriteTo([]byte("request"), targetAddr)
+	require.NoError(t, err)
+	request := make([]byte, clientUDPBufferSize)
+	n, clientAddr, err := server.ReadFrom(request)
+	require.NoError(t, err)
+	request = request[:n]
+
+	// The first response is accepted.
+	plaintext := append(socks.ParseAddr(testTargetAddr), []byte("response")...)
+	response, err := Pack(make([]byte, clientUDPBufferSize), plaintext, key)
+	require.NoError(t, err)
+	_, err = server.WriteTo(response, clientAddr)
+	require.NoError(t, err)
+	buf := make([]byte, 1024)
+	n, _, err = conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, "response", string(buf[:n]))
+
+	// A replay of the response and the request reflected back are dropped, and the next response is read.
+	_, err = server.WriteTo(response, clientAddr)
+	require.NoError(t, err)
+	_, err = server.WriteTo(request, clientAddr)
+	require.NoError(t, err)
+	plaintext = append(socks.ParseAddr(testTargetAddr), []byte("next")...)
+	next, err := Pack(make([]byte, clientUDPBufferSize), plaintext, key)
+	require.NoError(t, err)
+	_, err = server.WriteTo(next, clientAddr)
+	require.NoError(t, err)
+	n, _, err = conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, "next", string(buf[:n]))
+	require.Equal(t, int32(2), replayed.Load())
+}
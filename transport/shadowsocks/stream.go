@@ -54,8 +54,9 @@ type Writer struct {
 	// These are populated by init():
 	buf  []byte
 	aead cipher.AEAD
-	// Index of the next encrypted chunk to write.
-	counter []byte
+	// Index of the next encrypted chunk to write. It points to counterBuf.
+	counter    []byte
+	counterBuf [maxNonceSize]byte
 }
 
 var (
@@ -78,7 +79,13 @@ func (sw *Writer) SetSaltGenerator(saltGenerator SaltGenerator) {
 // the salt to the inner Writer.
 func (sw *Writer) init() (err error) {
 	if sw.aead == nil {
-		salt := make([]byte, sw.key.SaltSize())
+		// The maximum length message is the salt (first message only), length, length tag,
+		// payload, and payload tag.
+		saltSize := sw.key.SaltSize()
+		overhead := sw.key.TagSize()
+		buf := make([]byte, saltSize+2+overhead+payloadSizeMask+overhead)
+		// Store the salt at the start of the buffer.
+		salt := buf[:saltSize]
 		if err := sw.saltGenerator.GetSalt(salt); err != nil {
 			return fmt.Errorf("failed to generate salt: %w", err)
 		}
@@ -87,14 +94,8 @@ func (sw *Writer) init() (err error) {
 			return fmt.Errorf("failed to create AEAD: %w", err)
 		}
 		sw.saltGenerator = nil // No longer needed, so release reference.
-		sw.counter = make([]byte, sw.aead.NonceSize())
-		// The maximum length message is the salt (first message only), length, length tag,
-		// payload, and payload tag.
-		sizeBufSize := 2 + sw.aead.Overhead()
-		maxPayloadBufSize := payloadSizeMask + sw.aead.Overhead()
-		sw.buf = make([]byte, len(salt)+sizeBufSize+maxPayloadBufSize)
-		// Store the salt at the start of sw.buf.
-		copy(sw.buf, salt)
+		sw.counter = sw.counterBuf[:sw.aead.NonceSize()]
+		sw.buf = buf
 	}
 	return nil
 }
@@ -271,10 +272,12 @@ type chunkReader struct {
 	key    *EncryptionKey
 	// These are lazily initialized:
 	aead cipher.AEAD
-	// Index of the next encrypted chunk to read.
-	counter []byte
-	// Buffer for the uint16 size and its AEAD tag.  Made in init().
-	payloadSizeBuf []byte
+	// Index of the next encrypted chunk to read. It points to counterBuf.
+	counter    []byte
+	counterBuf [maxNonceSize]byte
+	// Buffer for the uint16 size and its AEAD tag. It points to payloadSizeArray.
+	payloadSizeBuf   []byte
+	payloadSizeArray [2 + maxTagSize]byte
 	// Holds a buffer for the payload and its AEAD tag, when needed.
 	payload slicepool.LazySlice
 }
@@ -313,8 +316,8 @@ func (cr *chunkReader) init() (err error) {
 		if err != nil {
 			return fmt.Errorf("failed to create AEAD: %w", err)
 		}
-		cr.counter = make([]byte, cr.aead.NonceSize())
-		cr.payloadSizeBuf = make([]byte, 2+cr.aead.Overhead())
+		cr.counter = cr.counterBuf[:cr.aead.NonceSize()]
+		cr.payloadSizeBuf = cr.payloadSizeArray[:2+cr.aead.Overhead()]
 	}
 	return nil
 }
@@ -15,8 +15,11 @@
 package shadowsocks
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
@@ -59,9 +62,60 @@ type StreamDialer struct {
 	// typical network latency.  (In an Android emulator, the 90th percentile delay
 	// was ~1 ms.)  If no client payload is received by this time, we connect without it.
 	ClientDataWait time.Duration
+
+	// InitialWriteMode controls which parts of the connection request are coalesced in the first write to the proxy.
+	// The default, [InitialWriteCoalesced], sends them all at once.
+	InitialWriteMode InitialWriteMode
+
+	// InitialWriteFragmentSize, if positive, splits the first write to the proxy into writes of at most this many
+	// bytes, to avoid the characteristic length of the first packet. The writes are only sent as separate packets
+	// if the connection doesn't delay small writes, which is the default for TCP connections in Go.
+	InitialWriteFragmentSize int
+}
+
+// InitialWriteMode controls how the salt, the target address and the initial client data are grouped in
+// the first writes to the proxy. Some firewalls fingerprint the length of the first packet of Shadowsocks
+// connections, which the separate modes change.
+type InitialWriteMode int
+
+const (
+	// InitialWriteCoalesced sends the salt, target address and initial data in one write.
+	InitialWriteCoalesced InitialWriteMode = iota
+	// InitialWriteSeparateSalt sends the salt in its own write, followed by the target address and initial data.
+	InitialWriteSeparateSalt
+	// InitialWriteSeparateData sends the salt and target address as soon as the proxy is connected, and the
+	// initial data in later writes. [StreamDialer.ClientDataWait] is not used.
+	InitialWriteSeparateData
+)
+
+func (m InitialWriteMode) String() string {
+	switch m {
+	case InitialWriteCoalesced:
+		return "coalesced"
+	case InitialWriteSeparateSalt:
+		return "separate-salt"
+	case InitialWriteSeparateData:
+		return "separate-data"
+	default:
+		return fmt.Sprintf("InitialWriteMode(%d)", int(m))
+	}
 }
 
 var _ transport.StreamDialer = (*StreamDialer)(nil)
+var _ transport.DialAndWriter = (*StreamDialer)(nil)
+var _ transport.CapabilityReporter = (*StreamDialer)(nil)
+var _ transport.Pinger = (*StreamDialer)(nil)
+
+// Capabilities implements [transport.CapabilityReporter].
+func (c *StreamDialer) Capabilities() transport.Capability {
+	return transport.CapabilityStream | transport.CapabilityRemoteDNS | transport.CapabilityIPv6 | transport.CapabilityZeroRTT
+}
+
+// Ping implements [transport.Pinger]. Shadowsocks servers don't reply until the target sends data, so it measures
+// the connection to the proxy with [transport.Ping] on the endpoint.
+func (c *StreamDialer) Ping(ctx context.Context) (time.Duration, error) {
+	return transport.Ping(ctx, c.endpoint)
+}
 
 // DialStream implements StreamDialer.DialStream using a Shadowsocks server.
 //
@@ -79,26 +133,198 @@ var _ transport.StreamDialer = (*StreamDialer)(nil)
 // all in one packet. This makes the size of the initial packet hard to predict, avoiding packet size
 // fingerprinting. We can only get the application initial data if we return a connection first.
 func (c *StreamDialer) DialStream(ctx context.Context, remoteAddr string) (transport.StreamConn, error) {
+	proxyConn, ssw, err := c.connect(ctx, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	if c.InitialWriteMode != InitialWriteSeparateData {
+		time.AfterFunc(c.ClientDataWait, func() {
+			ssw.Flush()
+		})
+	}
+	ssr := &firstReadClassifier{Reader: NewReader(proxyConn, c.key)}
+	return transport.WrapConn(proxyConn, ssr, ssw), nil
+}
+
+// DialAndWrite implements [transport.DialAndWriter]. It sends the salt, the target address and the data
+// in the first write to the proxy, unless [StreamDialer.InitialWriteMode] separates them, without waiting for
+// [StreamDialer.ClientDataWait]. With [InitialWriteCoalesced] and no fragmentation, the first write is sent along
+// with the connection setup if the endpoint implements [transport.ConnectAndWriter], like [transport.TCPEndpoint]
+// with TCP Fast Open.
+func (c *StreamDialer) DialAndWrite(ctx context.Context, remoteAddr string, data []byte) (transport.StreamConn, error) {
+	if c.InitialWriteMode != InitialWriteCoalesced || c.InitialWriteFragmentSize > 0 {
+		// The first write is split, so it can't be sent with the connection setup.
+		proxyConn, ssw, err := c.connect(ctx, remoteAddr)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeInitialData(ssw, data); err != nil {
+			proxyConn.Close()
+			return nil, err
+		}
+		ssr := &firstReadClassifier{Reader: NewReader(proxyConn, c.key)}
+		return transport.WrapConn(proxyConn, ssr, ssw), nil
+	}
 	socksTargetAddr := socks.ParseAddr(remoteAddr)
 	if socksTargetAddr == nil {
 		return nil, errors.New("failed to parse target address")
 	}
-	proxyConn, err := c.endpoint.ConnectStream(ctx)
+	proxyWriter := &pendingConnWriter{}
+	ssw := c.newWriter(proxyWriter)
+	if _, err := ssw.LazyWrite(socksTargetAddr); err != nil {
+		return nil, errors.New("failed to write target address")
+	}
+	if err := writeInitialData(ssw, data); err != nil {
+		return nil, err
+	}
+	proxyConn, err := transport.ConnectAndWrite(ctx, c.endpoint, proxyWriter.pending.Bytes())
 	if err != nil {
 		return nil, err
 	}
-	ssw := NewWriter(proxyConn, c.key)
-	if c.SaltGenerator != nil {
-		ssw.SetSaltGenerator(c.SaltGenerator)
+	proxyWriter.Writer = proxyConn
+	ssr := &firstReadClassifier{Reader: NewReader(proxyConn, c.key)}
+	return transport.WrapConn(proxyConn, ssr, ssw), nil
+}
+
+// writeInitialData writes the data to ssw, or flushes the pending target address if there's no data.
+func writeInitialData(ssw *Writer, data []byte) error {
+	var err error
+	if len(data) == 0 {
+		err = ssw.Flush()
+	} else {
+		_, err = ssw.Write(data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write initial data: %w", err)
+	}
+	return nil
+}
+
+// firstReadClassifier adds the error classes to the error of the first read from the proxy, which is when
+// misconfigured or blocked proxies fail, like a wrong key failing to decrypt or a reset connection. [io.EOF] is kept
+// as is, since readers must return it unwrapped.
+type firstReadClassifier struct {
+	Reader
+	done bool
+}
+
+func (r *firstReadClassifier) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	return n, r.classify(n > 0, err)
+}
+
+func (r *firstReadClassifier) WriteTo(w io.Writer) (int64, error) {
+	n, err := r.Reader.WriteTo(w)
+	return n, r.classify(n > 0, err)
+}
+
+func (r *firstReadClassifier) classify(readData bool, err error) error {
+	if r.done || readData {
+		r.done = true
+		return err
+	}
+	if err == nil || err == io.EOF {
+		return err
+	}
+	r.done = true
+	return transport.NewHandshakeError(err, transport.ErrProxyHandshake)
+}
+
+// pendingConnWriter keeps the writes until the connection to the proxy is established, so they can be sent with the
+// connection setup, and then writes to the connection.
+type pendingConnWriter struct {
+	// Writer is the connection, or nil if not established yet.
+	io.Writer
+	pending bytes.Buffer
+}
+
+func (w *pendingConnWriter) Write(b []byte) (int, error) {
+	if w.Writer == nil {
+		return w.pending.Write(b)
+	}
+	return w.Writer.Write(b)
+}
+
+// connect connects to the proxy and queues the target address to be sent with the first write.
+func (c *StreamDialer) connect(ctx context.Context, remoteAddr string) (transport.StreamConn, *Writer, error) {
+	socksTargetAddr := socks.ParseAddr(remoteAddr)
+	if socksTargetAddr == nil {
+		return nil, nil, errors.New("failed to parse target address")
+	}
+	proxyConn, err := c.endpoint.ConnectStream(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var proxyWriter io.Writer = proxyConn
+	if c.InitialWriteMode == InitialWriteSeparateSalt || c.InitialWriteFragmentSize > 0 {
+		splitter := &firstWriteSplitter{Writer: proxyConn, fragmentSize: c.InitialWriteFragmentSize}
+		if c.InitialWriteMode == InitialWriteSeparateSalt {
+			splitter.prefixSize = c.key.SaltSize()
+		}
+		proxyWriter = splitter
+	}
+	ssw := c.newWriter(proxyWriter)
+	if c.InitialWriteMode == InitialWriteSeparateData {
+		_, err = ssw.Write(socksTargetAddr)
+	} else {
+		_, err = ssw.LazyWrite(socksTargetAddr)
 	}
-	_, err = ssw.LazyWrite(socksTargetAddr)
 	if err != nil {
 		proxyConn.Close()
-		return nil, errors.New("failed to write target address")
+		return nil, nil, errors.New("failed to write target address")
 	}
-	time.AfterFunc(c.ClientDataWait, func() {
-		ssw.Flush()
-	})
-	ssr := NewReader(proxyConn, c.key)
-	return transport.WrapConn(proxyConn, ssr, ssw), nil
+	return proxyConn, ssw, nil
+}
+
+func (c *StreamDialer) newWriter(proxyWriter io.Writer) *Writer {
+	ssw := NewWriter(proxyWriter, c.key)
+	if c.SaltGenerator != nil {
+		ssw.SetSaltGenerator(c.SaltGenerator)
+	}
+	return ssw
+}
+
+// firstWriteSplitter splits the first write into multiple writes to the underlying writer: the prefix, if any,
+// and then fragments of at most fragmentSize bytes, if positive. Later writes are passed through.
+type firstWriteSplitter struct {
+	io.Writer
+	prefixSize   int
+	fragmentSize int
+	done         bool
+}
+
+func (w *firstWriteSplitter) Write(b []byte) (int, error) {
+	if w.done {
+		return w.Writer.Write(b)
+	}
+	w.done = true
+	written := 0
+	if w.prefixSize > 0 && w.prefixSize < len(b) {
+		n, err := w.writeFragments(b[:w.prefixSize])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	n, err := w.writeFragments(b[written:])
+	return written + n, err
+}
+
+func (w *firstWriteSplitter) writeFragments(b []byte) (int, error) {
+	if w.fragmentSize <= 0 {
+		return w.Writer.Write(b)
+	}
+	written := 0
+	for written < len(b) {
+		end := written + w.fragmentSize
+		if end > len(b) {
+			end = len(b)
+		}
+		n, err := w.Writer.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
 }
@@ -15,7 +15,10 @@
 package shadowsocks
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"sync"
@@ -46,6 +49,17 @@ func TestStreamDialer_Dial(t *testing.T) {
 	running.Wait()
 }
 
+func TestStreamDialer_Ping(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	d, err := NewStreamDialer(&transport.TCPEndpoint{Address: listener.Addr().String()}, makeTestKey(t))
+	require.NoError(t, err)
+	rtt, err := transport.Ping(context.Background(), d)
+	require.NoError(t, err)
+	require.Greater(t, rtt, time.Duration(0))
+}
+
 func TestStreamDialer_DialNoPayload(t *testing.T) {
 	key := makeTestKey(t)
 	proxy, running := startShadowsocksTCPEchoProxy(key, testTargetAddr, t)
@@ -71,6 +85,71 @@ func TestStreamDialer_DialNoPayload(t *testing.T) {
 	running.Wait()
 }
 
+func TestStreamDialer_CloseWriteSendsHeader(t *testing.T) {
+	key := makeTestKey(t)
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer listener.Close()
+	type result struct {
+		addr string
+		rest []byte
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		clientConn, err := listener.AcceptTCP()
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		defer clientConn.Close()
+		ssr := NewReader(clientConn, key)
+		tgtAddr, err := socks.ReadAddr(ssr)
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		rest, err := io.ReadAll(ssr)
+		resultCh <- result{addr: tgtAddr.String(), rest: rest, err: err}
+	}()
+
+	d, err := NewStreamDialer(&transport.TCPEndpoint{Address: listener.Addr().String()}, key)
+	require.NoError(t, err)
+	// Make sure the header is not sent by the timer.
+	d.ClientDataWait = time.Hour
+	conn, err := d.DialStream(context.Background(), testTargetAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.CloseWrite())
+	res := <-resultCh
+	require.NoError(t, res.err)
+	require.Equal(t, testTargetAddr, res.addr)
+	require.Empty(t, res.rest)
+}
+
+func TestStreamDialer_DialAndWrite(t *testing.T) {
+	key := makeTestKey(t)
+	proxy, running := startShadowsocksTCPEchoProxy(key, testTargetAddr, t)
+	d, err := NewStreamDialer(&transport.TCPEndpoint{Address: proxy.Addr().String()}, key)
+	require.NoError(t, err)
+	// The initial data must be sent without waiting for the client data.
+	d.ClientDataWait = time.Hour
+
+	payload := makeTestPayload(1024)
+	conn, err := d.DialAndWrite(context.Background(), testTargetAddr, payload)
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	received := make([]byte, len(payload))
+	_, err = io.ReadFull(conn, received)
+	require.NoError(t, err)
+	require.Equal(t, payload, received)
+	conn.Close()
+
+	proxy.Close()
+	running.Wait()
+}
+
 func TestStreamDialer_DialFastClose(t *testing.T) {
 	// Set up a listener that verifies no data is sent.
 	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
@@ -228,3 +307,151 @@ func startShadowsocksTCPEchoProxy(key *EncryptionKey, expectedTgtAddr string, t
 	}()
 	return listener, &running
 }
+
+// writeRecorderConn records the writes to the proxy.
+type writeRecorderConn struct {
+	transport.StreamConn
+	writes [][]byte
+}
+
+func (c *writeRecorderConn) Write(b []byte) (int, error) {
+	c.writes = append(c.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (c *writeRecorderConn) Close() error {
+	return nil
+}
+
+func TestStreamDialer_InitialWriteMode(t *testing.T) {
+	key := makeTestKey(t)
+	payload := makeTestPayload(100)
+	for _, tc := range []struct {
+		mode         InitialWriteMode
+		fragmentSize int
+		writeSizes   func(saltSize, addrSize, overhead int) []int
+	}{
+		{InitialWriteCoalesced, 0, func(saltSize, addrSize, overhead int) []int {
+			return []int{saltSize + 2 + overhead + addrSize + len(payload) + overhead}
+		}},
+		{InitialWriteSeparateSalt, 0, func(saltSize, addrSize, overhead int) []int {
+			return []int{saltSize, 2 + overhead + addrSize + len(payload) + overhead}
+		}},
+		{InitialWriteSeparateData, 0, func(saltSize, addrSize, overhead int) []int {
+			return []int{saltSize + 2 + overhead + addrSize + overhead, 2 + overhead + len(payload) + overhead}
+		}},
+		{InitialWriteSeparateSalt, 50, func(saltSize, addrSize, overhead int) []int {
+			// The salt, and then the rest in 50-byte fragments.
+			return []int{saltSize, 50, 50, 2 + overhead + addrSize + len(payload) + overhead - 100}
+		}},
+	} {
+		t.Run(fmt.Sprintf("%v/%d", tc.mode, tc.fragmentSize), func(t *testing.T) {
+			conn := &writeRecorderConn{}
+			d, err := NewStreamDialer(transport.FuncStreamEndpoint(func(ctx context.Context) (transport.StreamConn, error) {
+				return conn, nil
+			}), key)
+			require.NoError(t, err)
+			d.InitialWriteMode = tc.mode
+			d.InitialWriteFragmentSize = tc.fragmentSize
+			_, err = d.DialAndWrite(context.Background(), testTargetAddr, payload)
+			require.NoError(t, err)
+
+			var sizes []int
+			var sent []byte
+			for _, w := range conn.writes {
+				sizes = append(sizes, len(w))
+				sent = append(sent, w...)
+			}
+			require.Equal(t, tc.writeSizes(key.SaltSize(), len(socks.ParseAddr(testTargetAddr)), key.TagSize()), sizes)
+
+			ssr := NewReader(bytes.NewReader(sent), key)
+			addr, err := socks.ReadAddr(ssr)
+			require.NoError(t, err)
+			require.Equal(t, testTargetAddr, addr.String())
+			received, err := io.ReadAll(ssr)
+			require.NoError(t, err)
+			require.Equal(t, payload, received)
+		})
+	}
+}
+
+func TestStreamDialer_DialAndWriteWithConnectionSetup(t *testing.T) {
+	key := makeTestKey(t)
+	payload := makeTestPayload(100)
+	endpoint := &connectAndWriteRecorder{conn: &writeRecorderConn{}}
+	d, err := NewStreamDialer(endpoint, key)
+	require.NoError(t, err)
+	conn, err := d.DialAndWrite(context.Background(), testTargetAddr, payload)
+	require.NoError(t, err)
+	require.Empty(t, endpoint.conn.writes)
+
+	// The whole request goes with the connection setup.
+	ssr := NewReader(bytes.NewReader(endpoint.data), key)
+	addr, err := socks.ReadAddr(ssr)
+	require.NoError(t, err)
+	require.Equal(t, testTargetAddr, addr.String())
+	received, err := io.ReadAll(ssr)
+	require.NoError(t, err)
+	require.Equal(t, payload, received)
+
+	// Later writes go to the connection.
+	_, err = conn.Write([]byte("more"))
+	require.NoError(t, err)
+	require.Len(t, endpoint.conn.writes, 1)
+	ssr = NewReader(bytes.NewReader(append(endpoint.data, endpoint.conn.writes[0]...)), key)
+	_, err = socks.ReadAddr(ssr)
+	require.NoError(t, err)
+	received, err = io.ReadAll(ssr)
+	require.NoError(t, err)
+	require.Equal(t, append(payload, "more"...), received)
+}
+
+// connectAndWriteRecorder is a [transport.ConnectAndWriter] that records the data sent with the connection setup.
+type connectAndWriteRecorder struct {
+	conn *writeRecorderConn
+	data []byte
+}
+
+func (e *connectAndWriteRecorder) ConnectStream(ctx context.Context) (transport.StreamConn, error) {
+	return nil, errors.New("not expected")
+}
+
+func (e *connectAndWriteRecorder) ConnectAndWrite(ctx context.Context, data []byte) (transport.StreamConn, error) {
+	e.data = append([]byte(nil), data...)
+	return e.conn, nil
+}
+
+func TestStreamDialer_FirstReadErrorClass(t *testing.T) {
+	key := makeTestKey(t)
+	otherKey, err := NewEncryptionKey(CHACHA20IETFPOLY1305, "other secret")
+	require.NoError(t, err)
+	serverConn, clientConn := net.Pipe()
+	go func() {
+		// Reply with a chunk encrypted with another key.
+		ssw := NewWriter(serverConn, otherKey)
+		ssw.Write([]byte("response"))
+		serverConn.Close()
+	}()
+	d, err := NewStreamDialer(transport.FuncStreamEndpoint(func(ctx context.Context) (transport.StreamConn, error) {
+		return &pipeStreamConn{Conn: clientConn}, nil
+	}), key)
+	require.NoError(t, err)
+	conn, err := d.DialStream(context.Background(), testTargetAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Read(make([]byte, 100))
+	require.ErrorIs(t, err, transport.ErrProxyHandshake)
+}
+
+// pipeStreamConn is a [transport.StreamConn] over a [net.Pipe] conn.
+type pipeStreamConn struct {
+	net.Conn
+}
+
+func (c *pipeStreamConn) CloseRead() error  { return nil }
+func (c *pipeStreamConn) CloseWrite() error { return nil }
+
+func TestInitialWriteMode_String(t *testing.T) {
+	require.Equal(t, "coalesced", InitialWriteCoalesced.String())
+	require.Equal(t, "InitialWriteMode(9)", InitialWriteMode(9).String())
+}
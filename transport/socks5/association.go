@@ -0,0 +1,455 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sharedConnQueueSize is the number of received packets a shared connection buffers before dropping.
+const sharedConnQueueSize = 64
+
+// packetAssociation is a UDP association shared by multiple packet connections.
+type packetAssociation struct {
+	sc        io.ReadCloser
+	pc        net.Conn
+	boundAddr Address
+
+	done chan struct{}
+
+	mu sync.Mutex
+	// err is set when the association is no longer usable.
+	err   error
+	conns map[*sharedPacketConn]struct{}
+	// routes maps destination addresses to the connection that owns them. Packets don't identify the connection,
+	// so only one connection on the association can talk to each destination.
+	routes map[string]*sharedPacketConn
+	// ports maps the ports of domain name destinations to the connection that owns them, for responses whose
+	// source is the IP address of the domain.
+	ports map[string]*sharedPacketConn
+}
+
+func newPacketAssociation(sc io.ReadCloser, pc net.Conn, boundAddr Address) *packetAssociation {
+	a := &packetAssociation{
+		sc:        sc,
+		pc:        pc,
+		boundAddr: boundAddr,
+		done:      make(chan struct{}),
+		conns:     make(map[*sharedPacketConn]struct{}),
+		routes:    make(map[string]*sharedPacketConn),
+		ports:     make(map[string]*sharedPacketConn),
+	}
+	go a.readLoop()
+	go func() {
+		// The association terminates when the control connection closes.
+		// See https://datatracker.ietf.org/doc/html/rfc1928#section-7
+		io.Copy(io.Discard, sc)
+		a.fail(errControlClosed)
+	}()
+	return a
+}
+
+// listenSharedPacket returns a connection on the shared association, creating the association if needed.
+func (c *Client) listenSharedPacket(ctx context.Context) (*sharedPacketConn, error) {
+	c.assocMu.Lock()
+	defer c.assocMu.Unlock()
+	if c.assoc != nil {
+		if conn := c.assoc.newConn(c); conn != nil {
+			return conn, nil
+		}
+	}
+	sc, pc, bindAddr, err := c.associate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.assoc = newPacketAssociation(sc, pc, bindAddr)
+	if conn := c.assoc.newConn(c); conn != nil {
+		return conn, nil
+	}
+	return nil, c.assoc.failure()
+}
+
+// newConn returns a new connection on the association, or nil if the association has failed.
+func (a *packetAssociation) newConn(client *Client) *sharedPacketConn {
+	conn := &sharedPacketConn{
+		client:       client,
+		recv:         make(chan receivedPacket, sharedConnQueueSize),
+		closed:       make(chan struct{}),
+		readDeadline: makeDeadline(),
+	}
+	if !a.addConn(conn) {
+		return nil
+	}
+	return conn
+}
+
+// addConn registers conn on the association, unless the association has failed.
+func (a *packetAssociation) addConn(conn *sharedPacketConn) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return false
+	}
+	a.conns[conn] = struct{}{}
+	conn.assoc.Store(a)
+	return true
+}
+
+func (a *packetAssociation) failure() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// fail terminates the association with the given error. Only the first call has effect.
+func (a *packetAssociation) fail(err error) {
+	a.mu.Lock()
+	if a.err != nil {
+		a.mu.Unlock()
+		return
+	}
+	a.err = err
+	close(a.done)
+	a.mu.Unlock()
+	a.sc.Close()
+	a.pc.Close()
+}
+
+func (a *packetAssociation) readLoop() {
+	buffer := make([]byte, clientUDPBufferSize)
+	for {
+		n, err := a.pc.Read(buffer)
+		if err != nil {
+			a.fail(err)
+			return
+		}
+		addr, payload, err := unpackUDP(buffer[:n])
+		if err != nil {
+			// Drop invalid packets.
+			continue
+		}
+		if conn := a.route(addr); conn != nil {
+			conn.deliver(receivedPacket{payload: bytes.Clone(payload), addr: addr})
+		}
+	}
+}
+
+// route finds the connection that should receive a packet from addr.
+func (a *packetAssociation) route(addr net.Addr) *sharedPacketConn {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if conn, ok := a.routes[addr.String()]; ok {
+		return conn
+	}
+	if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+		if conn, ok := a.ports[port]; ok {
+			return conn
+		}
+	}
+	if len(a.conns) == 1 {
+		for conn := range a.conns {
+			return conn
+		}
+	}
+	return nil
+}
+
+// claim makes conn the owner of the destination, so it receives the packets from it. It returns false if another
+// connection owns it, in which case conn must move to another association.
+func (a *packetAssociation) claim(conn *sharedPacketConn, dstAddr string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.conns[conn]; !ok {
+		// The connection is closed or moved, and writes fail anyway.
+		return true
+	}
+	if owner, ok := a.routes[dstAddr]; ok && owner != conn {
+		return false
+	}
+	host, port, err := net.SplitHostPort(dstAddr)
+	isDomain := err == nil && net.ParseIP(host) == nil
+	if isDomain {
+		if owner, ok := a.ports[port]; ok && owner != conn {
+			return false
+		}
+		a.ports[port] = conn
+	}
+	a.routes[dstAddr] = conn
+	return true
+}
+
+// removeConn unregisters conn and terminates the association if it was the last connection.
+func (a *packetAssociation) removeConn(conn *sharedPacketConn) {
+	a.mu.Lock()
+	delete(a.conns, conn)
+	for key, routeConn := range a.routes {
+		if routeConn == conn {
+			delete(a.routes, key)
+		}
+	}
+	for key, routeConn := range a.ports {
+		if routeConn == conn {
+			delete(a.ports, key)
+		}
+	}
+	isLast := len(a.conns) == 0
+	a.mu.Unlock()
+	if isLast {
+		a.fail(net.ErrClosed)
+	}
+}
+
+type receivedPacket struct {
+	payload []byte
+	addr    net.Addr
+}
+
+// sharedPacketConn is a [net.PacketConn] on a shared [packetAssociation]. It moves to an association of its
+// own if it writes to a destination another connection on the shared association talks to, since the replies
+// couldn't be told apart.
+type sharedPacketConn struct {
+	client *Client
+	assoc  atomic.Pointer[packetAssociation]
+	// moveMu serializes the moves to another association.
+	moveMu       sync.Mutex
+	recv         chan receivedPacket
+	closeOnce    sync.Once
+	closed       chan struct{}
+	readDeadline deadline
+
+	writeDeadlineMu sync.Mutex
+	writeDeadline   time.Time
+}
+
+var _ net.PacketConn = (*sharedPacketConn)(nil)
+var _ BoundAddrConn = (*sharedPacketConn)(nil)
+
+func (c *sharedPacketConn) BoundAddr() Address {
+	return c.assoc.Load().boundAddr
+}
+
+// fail terminates the association of the connection with the given error.
+func (c *sharedPacketConn) fail(err error) {
+	c.assoc.Load().fail(err)
+}
+
+// moveToOwnAssociation moves the connection to a new association that is not shared with new connections,
+// unless it was moved already.
+func (c *sharedPacketConn) moveToOwnAssociation(from *packetAssociation) (*packetAssociation, error) {
+	c.moveMu.Lock()
+	defer c.moveMu.Unlock()
+	if isClosedChan(c.closed) {
+		return nil, net.ErrClosed
+	}
+	if current := c.assoc.Load(); current != from {
+		return current, nil
+	}
+	ctx := context.Background()
+	c.writeDeadlineMu.Lock()
+	writeDeadline := c.writeDeadline
+	c.writeDeadlineMu.Unlock()
+	if !writeDeadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, writeDeadline)
+		defer cancel()
+	}
+	sc, pc, bindAddr, err := c.client.associate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	to := newPacketAssociation(sc, pc, bindAddr)
+	if !to.addConn(c) {
+		return nil, to.failure()
+	}
+	from.removeConn(c)
+	return to, nil
+}
+
+func (c *sharedPacketConn) deliver(packet receivedPacket) {
+	select {
+	case c.recv <- packet:
+	default:
+		// Drop the packet if the reader is not keeping up.
+	}
+}
+
+func (c *sharedPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	case <-c.readDeadline.wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	default:
+	}
+	for {
+		assoc := c.assoc.Load()
+		select {
+		case packet := <-c.recv:
+			if len(packet.payload) > len(b) {
+				return 0, nil, io.ErrShortBuffer
+			}
+			return copy(b, packet.payload), packet.addr, nil
+		case <-c.closed:
+			return 0, nil, net.ErrClosed
+		case <-assoc.done:
+			if c.assoc.Load() != assoc {
+				// The connection moved to another association.
+				continue
+			}
+			return 0, nil, assoc.failure()
+		case <-c.readDeadline.wait():
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (c *sharedPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	assoc := c.assoc.Load()
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	case <-assoc.done:
+		return 0, assoc.failure()
+	default:
+	}
+	c.writeDeadlineMu.Lock()
+	writeDeadline := c.writeDeadline
+	c.writeDeadlineMu.Unlock()
+	if !writeDeadline.IsZero() && !time.Now().Before(writeDeadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	dstAddr := addr.String()
+	lazySlice := udpPool.LazySlice()
+	buffer := lazySlice.Acquire()
+	defer lazySlice.Release()
+	buffer, err := AppendUDPHeader(buffer[:0], dstAddr)
+	if err != nil {
+		return 0, err
+	}
+	if !assoc.claim(c, dstAddr) {
+		if assoc, err = c.moveToOwnAssociation(assoc); err != nil {
+			return 0, err
+		}
+		assoc.claim(c, dstAddr)
+	}
+	if _, err := assoc.pc.Write(append(buffer, b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the connection. The shared association is closed when its last connection is closed.
+func (c *sharedPacketConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		c.moveMu.Lock()
+		defer c.moveMu.Unlock()
+		close(c.closed)
+		c.assoc.Load().removeConn(c)
+		err = nil
+	})
+	return err
+}
+
+func (c *sharedPacketConn) LocalAddr() net.Addr {
+	return c.assoc.Load().pc.LocalAddr()
+}
+
+func (c *sharedPacketConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *sharedPacketConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline. Since writes to the relay don't block on the peer,
+// the deadline is only checked before each write.
+func (c *sharedPacketConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadlineMu.Lock()
+	defer c.writeDeadlineMu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+// deadline is a channel-based deadline, closed when the deadline is reached.
+type deadline struct {
+	mu     *sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func makeDeadline() deadline {
+	return deadline{mu: &sync.Mutex{}, cancel: make(chan struct{})}
+}
+
+// set sets the deadline. A zero value for t means no deadline.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// The timer already fired and closed the channel.
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() {
+			close(cancel)
+		})
+		return
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline is exceeded.
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+	"github.com/things-go/go-socks5"
+)
+
+// startSOCKS5Server starts a SOCKS5 server and returns its address and the number of accepted control connections.
+func startSOCKS5Server(t *testing.T) (string, *atomic.Int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	var accepted atomic.Int32
+	server := socks5.NewServer()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go server.ServeConn(conn)
+		}
+	}()
+	return listener.Addr().String(), &accepted
+}
+
+func TestSharedAssociation(t *testing.T) {
+	echoServer1 := setupUDPEchoServer(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	echoServer2 := setupUDPEchoServer(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	proxyAddress, accepted := startSOCKS5Server(t)
+
+	client, err := NewClient(&transport.TCPEndpoint{Address: proxyAddress})
+	require.NoError(t, err)
+	client.EnablePacket(&transport.UDPDialer{})
+	client.EnableAssociationReuse()
+
+	conn1, err := client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn1.Close()
+	conn2, err := client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn2.Close()
+	require.Equal(t, int32(1), accepted.Load())
+	require.Equal(t, conn1.LocalAddr(), conn2.LocalAddr())
+	require.Equal(t, conn1.(BoundAddrConn).BoundAddr(), conn2.(BoundAddrConn).BoundAddr())
+	require.NotZero(t, conn1.(BoundAddrConn).BoundAddr().Port)
+
+	response := make([]byte, 1024)
+	for _, tc := range []struct {
+		conn   net.PacketConn
+		server net.Addr
+	}{{conn1, echoServer1.LocalAddr()}, {conn2, echoServer2.LocalAddr()}, {conn1, echoServer1.LocalAddr()}} {
+		_, err = tc.conn.WriteTo([]byte("ping"), tc.server)
+		require.NoError(t, err)
+		require.NoError(t, tc.conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, addr, err := tc.conn.ReadFrom(response)
+		require.NoError(t, err)
+		require.Equal(t, tc.server.String(), addr.String())
+		require.Equal(t, []byte("pong"), response[:n])
+	}
+}
+
+func TestSharedAssociation_SameDestination(t *testing.T) {
+	echoServer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echoServer.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := echoServer.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echoServer.WriteTo(buf[:n], addr)
+		}
+	}()
+	proxyAddress, accepted := startSOCKS5Server(t)
+
+	client, err := NewClient(&transport.TCPEndpoint{Address: proxyAddress})
+	require.NoError(t, err)
+	client.EnablePacket(&transport.UDPDialer{})
+	client.EnableAssociationReuse()
+
+	conn1, err := client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn1.Close()
+	conn2, err := client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn2.Close()
+	require.Equal(t, int32(1), accepted.Load())
+
+	// The second connection can't share the association for the same destination.
+	_, err = conn1.WriteTo([]byte("one"), echoServer.LocalAddr())
+	require.NoError(t, err)
+	_, err = conn2.WriteTo([]byte("two"), echoServer.LocalAddr())
+	require.NoError(t, err)
+	require.Equal(t, int32(2), accepted.Load())
+	require.NotEqual(t, conn1.LocalAddr(), conn2.LocalAddr())
+	require.NotEqual(t, conn1.(BoundAddrConn).BoundAddr(), conn2.(BoundAddrConn).BoundAddr())
+
+	response := make([]byte, 1024)
+	for _, tc := range []struct {
+		conn     net.PacketConn
+		expected string
+	}{{conn1, "one"}, {conn2, "two"}} {
+		require.NoError(t, tc.conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, addr, err := tc.conn.ReadFrom(response)
+		require.NoError(t, err)
+		require.Equal(t, echoServer.LocalAddr().String(), addr.String())
+		require.Equal(t, tc.expected, string(response[:n]))
+	}
+
+	// New connections still share the first association.
+	conn3, err := client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn3.Close()
+	require.Equal(t, int32(2), accepted.Load())
+	require.Equal(t, conn1.LocalAddr(), conn3.LocalAddr())
+}
+
+func TestPacketAssociation_Claim(t *testing.T) {
+	a := &packetAssociation{
+		conns:  make(map[*sharedPacketConn]struct{}),
+		routes: make(map[string]*sharedPacketConn),
+		ports:  make(map[string]*sharedPacketConn),
+	}
+	conn1, conn2 := &sharedPacketConn{}, &sharedPacketConn{}
+	a.conns[conn1] = struct{}{}
+	a.conns[conn2] = struct{}{}
+
+	// Different IPs on the same port can be shared.
+	require.True(t, a.claim(conn1, "8.8.8.8:53"))
+	require.True(t, a.claim(conn2, "1.1.1.1:53"))
+	require.True(t, a.claim(conn1, "8.8.8.8:53"))
+	require.False(t, a.claim(conn2, "8.8.8.8:53"))
+
+	// Domain names claim their port.
+	require.True(t, a.claim(conn1, "example.com:443"))
+	require.False(t, a.claim(conn2, "example.org:443"))
+	require.True(t, a.claim(conn2, "93.184.216.34:443"))
+	require.Same(t, conn2, a.route(&net.UDPAddr{IP: net.IPv4(93, 184, 216, 34), Port: 443}))
+	require.Same(t, conn1, a.route(&net.UDPAddr{IP: net.IPv4(93, 184, 216, 35), Port: 443}))
+	require.Nil(t, a.route(&net.UDPAddr{IP: net.IPv4(9, 9, 9, 9), Port: 53}))
+}
+
+func TestSharedAssociation_RecreatedAfterClose(t *testing.T) {
+	proxyAddress, accepted := startSOCKS5Server(t)
+	client, err := NewClient(&transport.TCPEndpoint{Address: proxyAddress})
+	require.NoError(t, err)
+	client.EnablePacket(&transport.UDPDialer{})
+	client.EnableAssociationReuse()
+
+	conn, err := client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	require.ErrorIs(t, conn.Close(), net.ErrClosed)
+
+	conn, err = client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, int32(2), accepted.Load())
+}
+
+func TestSharedAssociation_ReadDeadline(t *testing.T) {
+	proxyAddress, _ := startSOCKS5Server(t)
+	client, err := NewClient(&transport.TCPEndpoint{Address: proxyAddress})
+	require.NoError(t, err)
+	client.EnablePacket(&transport.UDPDialer{})
+	client.EnableAssociationReuse()
+
+	conn, err := client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, _, err = conn.ReadFrom(make([]byte, 10))
+	require.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+}
+
+func TestSharedAssociation_DeadPeer(t *testing.T) {
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer silent.Close()
+	proxyAddress, accepted := startSOCKS5Server(t)
+
+	client, err := NewClient(&transport.TCPEndpoint{Address: proxyAddress})
+	require.NoError(t, err)
+	client.EnablePacket(&transport.UDPDialer{})
+	client.EnableAssociationReuse()
+	client.SetDeadPeerDetection(&transport.DeadPeerDetection{Timeout: 50 * time.Millisecond})
+
+	conn, err := client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NotZero(t, conn.(BoundAddrConn).BoundAddr().Port)
+	_, err = conn.WriteTo([]byte("ping"), silent.LocalAddr())
+	require.NoError(t, err)
+	_, _, err = conn.ReadFrom(make([]byte, 10))
+	require.ErrorIs(t, err, transport.ErrPeerUnresponsive)
+
+	// The dead association is not reused.
+	conn, err = client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, int32(2), accepted.Load())
+}
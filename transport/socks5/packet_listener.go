@@ -15,13 +15,13 @@
 package socks5
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/netip"
+	"sync"
 	"time"
 
 	"github.com/Jigsaw-Code/outline-sdk/internal/slicepool"
@@ -34,12 +34,54 @@ const clientUDPBufferSize = 16 * 1024
 // udpPool stores the byte slices used for storing packets.
 var udpPool = slicepool.MakePool(clientUDPBufferSize)
 
+// errControlClosed is the error of UDP associations whose control connection closed, which terminates them.
+// See https://datatracker.ietf.org/doc/html/rfc1928#section-7
+var errControlClosed = fmt.Errorf("SOCKS5 control connection closed: %w", net.ErrClosed)
+
 type packetConn struct {
-	pc net.Conn
-	sc io.Closer
+	pc        net.Conn
+	sc        io.ReadCloser
+	boundAddr Address
+
+	mu sync.Mutex
+	// err is set when the connection is closed, or the association terminated.
+	err error
+}
+
+func newPacketConn(sc io.ReadCloser, pc net.Conn, boundAddr Address) *packetConn {
+	p := &packetConn{pc: pc, sc: sc, boundAddr: boundAddr}
+	go func() {
+		// The association terminates when the control connection closes.
+		io.Copy(io.Discard, sc)
+		p.fail(errControlClosed)
+	}()
+	return p
+}
+
+// fail closes the connection with the given error, if it's not closed yet.
+func (p *packetConn) fail(err error) error {
+	p.mu.Lock()
+	if p.err != nil {
+		p.mu.Unlock()
+		return net.ErrClosed
+	}
+	p.err = err
+	p.mu.Unlock()
+	return errors.Join(p.sc.Close(), p.pc.Close())
+}
+
+func (p *packetConn) failure() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
 }
 
 var _ net.PacketConn = (*packetConn)(nil)
+var _ BoundAddrConn = (*packetConn)(nil)
+
+func (p *packetConn) BoundAddr() Address {
+	return p.boundAddr
+}
 
 func (p *packetConn) LocalAddr() net.Addr {
 	return p.pc.LocalAddr()
@@ -66,48 +108,15 @@ func (p *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
 
 	n, err := p.pc.Read(buffer)
 	if err != nil {
+		if failure := p.failure(); failure != nil {
+			return 0, nil, failure
+		}
 		return 0, nil, err
 	}
-	// Minimum packet size
-	if n < 10 {
-		return 0, nil, errors.New("invalid SOCKS5 UDP packet: too short")
-	}
-
-	// Using bytes.Buffer to handle data
-	buf := bytes.NewBuffer(buffer[:n])
-
-	// Read and check reserved bytes
-	rsv := make([]byte, 2)
-	if _, err := buf.Read(rsv); err != nil {
-		return 0, nil, err
-	}
-	if rsv[0] != 0x00 || rsv[1] != 0x00 {
-		return 0, nil, fmt.Errorf("invalid reserved bytes: expected 0x0000, got %#x%#x", rsv[0], rsv[1])
-	}
-
-	// Read fragment byte
-	frag, err := buf.ReadByte()
+	addr, payload, err := unpackUDP(buffer[:n])
 	if err != nil {
 		return 0, nil, err
 	}
-	if frag != 0 {
-		return 0, nil, errors.New("fragmentation is not supported")
-	}
-
-	// Read address using socks.ReadAddr which must now accept a bytes.Buffer directly
-	address, err := readAddr(buf)
-	if err != nil {
-		return 0, nil, fmt.Errorf("failed to read address: %w", err)
-	}
-
-	// Convert the address to a net.Addr
-	addr, err := transport.MakeNetAddr("udp", addrToString(address))
-	if err != nil {
-		return 0, nil, fmt.Errorf("failed to convert address: %w", err)
-	}
-
-	// Payload handling: remaining bytes in the buffer are the payload
-	payload := buf.Bytes()
 	payloadLength := len(payload)
 	if payloadLength > len(b) {
 		return 0, nil, io.ErrShortBuffer
@@ -117,24 +126,30 @@ func (p *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
 	return payloadLength, addr, nil
 }
 
+// unpackUDP parses a SOCKS5 UDP packet and returns the source address and the payload.
+// The payload slice points into the packet.
+func unpackUDP(packet []byte) (net.Addr, []byte, error) {
+	address, payload, err := ParseUDPPacket(packet)
+	if err != nil {
+		return nil, nil, err
+	}
+	addr, err := transport.MakeNetAddr("udp", address.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert address: %w", err)
+	}
+	return addr, payload, nil
+}
+
 // WriteTo encapsulates the payload in a SOCKS5 UDP packet as specified in
 // https://datatracker.ietf.org/doc/html/rfc1928#section-7
 // and write it to the SOCKS5 server via the underlying connection.
 func (p *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
-
-	// The minimum preallocated header size (10 bytes)
 	lazySlice := udpPool.LazySlice()
 	buffer := lazySlice.Acquire()
 	defer lazySlice.Release()
-	buffer = append(buffer[:0],
-		0x00, 0x00, // Reserved
-		0x00, // Fragment number
-		// To be appended below:
-		// ATYP, IPv4, IPv6, Domain Name, Port
-	)
-	buffer, err := appendSOCKS5Address(buffer, addr.String())
+	buffer, err := AppendUDPHeader(buffer[:0], addr.String())
 	if err != nil {
-		return 0, fmt.Errorf("failed to append SOCKS5 address: %w", err)
+		return 0, err
 	}
 	// Combine the header and the payload
 	return p.pc.Write(append(buffer, b...))
@@ -142,11 +157,79 @@ func (p *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
 
 // Close closes both the underlying stream and packet connections.
 func (p *packetConn) Close() error {
-	return errors.Join(p.sc.Close(), p.pc.Close())
+	return p.fail(net.ErrClosed)
 }
 
 // ListenPacket creates a [net.PacketConn] for UDP communication via the SOCKS5 server.
+// If association reuse is enabled with [Client.EnableAssociationReuse], the returned
+// connection shares the UDP association with the other open connections.
+// The returned connection implements [BoundAddrConn], with the address of the UDP relay.
+// It's closed when the control connection of the association closes, and, if enabled with
+// [Client.SetDeadPeerDetection], when the relay stops responding.
 func (c *Client) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	if c.reuseAssociation {
+		conn, err := c.listenSharedPacket(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// A dead relay is dead for all the connections, so new connections must not reuse the association.
+		return c.withDeadPeerDetection(conn, conn.fail)
+	}
+	sc, proxyConn, bindAddr, err := c.associate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.withDeadPeerDetection(newPacketConn(sc, proxyConn, bindAddr), nil)
+}
+
+// SetDeadPeerDetection makes the connections created by [Client.ListenPacket] close when the UDP relay stops
+// responding, as configured. Pass nil to disable it, which is the default.
+func (c *Client) SetDeadPeerDetection(config *transport.DeadPeerDetection) {
+	c.deadPeer = config
+}
+
+// boundPacketConn keeps the [BoundAddrConn] interface of a wrapped connection.
+type boundPacketConn struct {
+	net.PacketConn
+	bound BoundAddrConn
+}
+
+func (c *boundPacketConn) BoundAddr() Address {
+	return c.bound.BoundAddr()
+}
+
+// withDeadPeerDetection wraps the connection with the dead peer detection, if enabled. onDead, if not nil,
+// is called when the relay is found unresponsive.
+func (c *Client) withDeadPeerDetection(conn interface {
+	net.PacketConn
+	BoundAddrConn
+}, onDead func(error)) (net.PacketConn, error) {
+	if c.deadPeer == nil {
+		return conn, nil
+	}
+	config := *c.deadPeer
+	if onDead != nil {
+		onClose := config.OnClose
+		config.OnClose = func(err error) {
+			if errors.Is(err, transport.ErrPeerUnresponsive) {
+				onDead(err)
+			}
+			if onClose != nil {
+				onClose(err)
+			}
+		}
+	}
+	wrapped, err := transport.WithDeadPeerDetection(conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &boundPacketConn{PacketConn: wrapped, bound: conn}, nil
+}
+
+// associate performs a UDP association and returns the control connection, the
+// connection to the UDP relay and the address of the relay.
+func (c *Client) associate(ctx context.Context) (transport.StreamConn, net.Conn, Address, error) {
 	// Connect to the SOCKS5 server and perform UDP association
 	// Since local address is not known in advance, we use unspecified address
 	// which means the server is going to accept incoming packets from any address
@@ -157,7 +240,7 @@ func (c *Client) ListenPacket(ctx context.Context) (net.PacketConn, error) {
 	// challenges such as NAT traveral if client is behind NAT.
 	sc, bindAddr, err := c.connectAndRequest(ctx, CmdUDPAssociate, "0.0.0.0:0")
 	if err != nil {
-		return nil, err
+		return nil, nil, Address{}, err
 	}
 
 	// If the returned bind IP address is unspecified (i.e. "0.0.0.0" or "::"),
@@ -165,19 +248,21 @@ func (c *Client) ListenPacket(ctx context.Context) (net.PacketConn, error) {
 	if ipAddr := bindAddr.IP; ipAddr.IsValid() && ipAddr.IsUnspecified() {
 		schost, _, err := net.SplitHostPort(sc.RemoteAddr().String())
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse tcp address: %w", err)
+			sc.Close()
+			return nil, nil, Address{}, fmt.Errorf("failed to parse tcp address: %w", err)
 		}
 
 		bindAddr.IP, err = netip.ParseAddr(schost)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse bind address: %w", err)
+			sc.Close()
+			return nil, nil, Address{}, fmt.Errorf("failed to parse bind address: %w", err)
 		}
 	}
 
-	proxyConn, err := c.pd.DialPacket(ctx, addrToString(bindAddr))
+	proxyConn, err := c.pd.DialPacket(ctx, bindAddr.String())
 	if err != nil {
 		sc.Close()
-		return nil, fmt.Errorf("could not connect to packet endpoint: %w", err)
+		return nil, nil, Address{}, fmt.Errorf("could not connect to packet endpoint: %w", err)
 	}
-	return &packetConn{pc: proxyConn, sc: sc}, nil
+	return sc, proxyConn, *bindAddr, nil
 }
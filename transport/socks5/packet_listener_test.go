@@ -55,6 +55,9 @@ func TestSOCKS5Associate(t *testing.T) {
 	conn, err := client.ListenPacket(context.Background())
 	require.NoError(t, err)
 	defer conn.Close()
+	boundAddr := conn.(BoundAddrConn).BoundAddr()
+	require.Equal(t, "127.0.0.1", boundAddr.IP.String())
+	require.NotZero(t, boundAddr.Port)
 
 	// Send "ping" message.
 	_, err = conn.WriteTo([]byte("ping"), echoServer.LocalAddr())
@@ -69,6 +72,36 @@ func TestSOCKS5Associate(t *testing.T) {
 	require.Equal(t, []byte("pong"), response[:n])
 }
 
+func TestSOCKS5Associate_ControlClosed(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	controlConns := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		controlConns <- conn
+		socks5.NewServer().ServeConn(conn)
+	}()
+
+	client, err := NewClient(&transport.TCPEndpoint{Address: listener.Addr().String()})
+	require.NoError(t, err)
+	client.EnablePacket(&transport.UDPDialer{})
+	conn, err := client.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The association terminates with the control connection.
+	(<-controlConns).Close()
+	// The connection may already be closed, so the deadline error is ignored.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadFrom(make([]byte, 10))
+	require.ErrorIs(t, err, net.ErrClosed)
+	require.ErrorIs(t, conn.Close(), net.ErrClosed)
+}
+
 func TestUDPLoopBack(t *testing.T) {
 	// Create a local listener.
 	locIP := net.ParseIP("127.0.0.1")
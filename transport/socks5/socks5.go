@@ -22,6 +22,8 @@ import (
 	"net"
 	"net/netip"
 	"strconv"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
 )
 
 // ReplyCode is a byte-unsigned number that represents a SOCKS error as indicated in the REP field of the server response.
@@ -54,6 +56,23 @@ const (
 
 var _ error = (ReplyCode)(0)
 
+// replySucceeded is the REP value of successful replies, which is not an error.
+const replySucceeded = ReplyCode(0x00)
+
+// Is reports whether the reply code belongs to the error class target: the codes about the destination match
+// [transport.ErrUpstreamUnreachable], and the other failure codes match [transport.ErrProxyHandshake]. The
+// success code matches neither.
+func (e ReplyCode) Is(target error) bool {
+	switch target {
+	case transport.ErrUpstreamUnreachable:
+		return e == ErrNetworkUnreachable || e == ErrHostUnreachable || e == ErrConnectionRefused || e == ErrTTLExpired
+	case transport.ErrProxyHandshake:
+		return e != replySucceeded && !e.Is(transport.ErrUpstreamUnreachable)
+	default:
+		return false
+	}
+}
+
 // Error returns a human-readable description of the error, based on the SOCKS5 RFC.
 func (e ReplyCode) Error() string {
 	switch e {
@@ -88,17 +107,24 @@ const (
 	addrTypeIPv6 = 0x04
 )
 
-// address is a SOCKS-specific address.
+// ErrInvalidAddress is returned when a SOCKS5 address is malformed.
+var ErrInvalidAddress = errors.New("invalid SOCKS5 address")
+
+// maxDomainNameLength is the maximum length of a domain name in a SOCKS5 address,
+// since its length is encoded in a single byte.
+const maxDomainNameLength = 255
+
+// Address is a SOCKS-specific address.
 // Either Name or IP is used exclusively.
-type address struct {
+type Address struct {
 	Name string // fully-qualified domain name
 	IP   netip.Addr
 	Port uint16
 }
 
-// Address returns a string suitable to dial; prefer returning IP-based
+// String returns a string suitable to dial; prefer returning IP-based
 // address, fallback to Name
-func addrToString(a *address) string {
+func (a *Address) String() string {
 	if a == nil {
 		return ""
 	}
@@ -109,16 +135,17 @@ func addrToString(a *address) string {
 	return net.JoinHostPort(a.Name, port)
 }
 
-// appendSOCKS5Address adds the address to buffer b in SOCKS5 format,
+// AppendAddr adds the host:port address to buffer b in SOCKS5 format,
 // as specified in https://datatracker.ietf.org/doc/html/rfc1928#section-4
-func appendSOCKS5Address(b []byte, address string) ([]byte, error) {
+// It returns an error wrapping [ErrInvalidAddress] if the address cannot be encoded.
+func AppendAddr(b []byte, address string) ([]byte, error) {
 	host, portStr, err := net.SplitHostPort(address)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAddress, err)
 	}
 	portNum, err := strconv.ParseUint(portStr, 10, 16)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: invalid port: %w", ErrInvalidAddress, err)
 	}
 	// The SOCKS address format is as follows:
 	//     +------+----------+----------+
@@ -127,20 +154,26 @@ func appendSOCKS5Address(b []byte, address string) ([]byte, error) {
 	//     |  1   | Variable |    2     |
 	//     +------+----------+----------+
 	// See https://datatracker.ietf.org/doc/html/rfc1928#section-5 for DST.ADDR details.
-	if ip := net.ParseIP(host); ip != nil {
-		if ip4 := ip.To4(); ip4 != nil {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		// Zones can't be represented in SOCKS5.
+		if ip.Zone() != "" {
+			return nil, fmt.Errorf("%w: IP address zones are not supported", ErrInvalidAddress)
+		}
+		if ip.Is4() || ip.Is4In6() {
 			b = append(b, addrTypeIPv4)
-			b = append(b, ip4...)
-		} else if ip6 := ip.To16(); ip6 != nil {
-			b = append(b, addrTypeIPv6)
-			b = append(b, ip6...)
+			ip4 := ip.As4()
+			b = append(b, ip4[:]...)
 		} else {
-			// This should never happen.
-			return nil, errors.New("IP address not IPv4 or IPv6")
+			b = append(b, addrTypeIPv6)
+			ip6 := ip.As16()
+			b = append(b, ip6[:]...)
 		}
 	} else {
-		if len(host) > 255 {
-			return nil, fmt.Errorf("domain name length = %v is over 255", len(host))
+		if len(host) == 0 {
+			return nil, fmt.Errorf("%w: empty host", ErrInvalidAddress)
+		}
+		if len(host) > maxDomainNameLength {
+			return nil, fmt.Errorf("%w: domain name length = %v is over %v", ErrInvalidAddress, len(host), maxDomainNameLength)
 		}
 		b = append(b, addrTypeDomainName)
 		b = append(b, byte(len(host)))
@@ -150,46 +183,61 @@ func appendSOCKS5Address(b []byte, address string) ([]byte, error) {
 	return b, nil
 }
 
-func readAddr(r io.Reader) (*address, error) {
-	address := &address{}
+// ReadAddr reads a SOCKS5 address from r, as specified in https://datatracker.ietf.org/doc/html/rfc1928#section-5.
+// It reads exactly the bytes of the address and nothing more.
+// It returns [io.EOF] if no bytes were read, [io.ErrUnexpectedEOF] if the address was truncated,
+// [ErrAddressTypeNotSupported] if the address type is unknown, and an error wrapping [ErrInvalidAddress]
+// if the address is malformed.
+func ReadAddr(r io.Reader) (*Address, error) {
+	address := &Address{}
 
-	var addrType [1]byte
-	if _, err := r.Read(addrType[:]); err != nil {
+	var buf [1]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
 		return nil, err
 	}
 
-	switch addrType[0] {
+	switch buf[0] {
 	case addrTypeIPv4:
 		var addr [4]byte
 		if _, err := io.ReadFull(r, addr[:]); err != nil {
-			return nil, err
+			return nil, noEOF(err)
 		}
 		address.IP = netip.AddrFrom4(addr)
 	case addrTypeIPv6:
 		var addr [16]byte
 		if _, err := io.ReadFull(r, addr[:]); err != nil {
-			return nil, err
+			return nil, noEOF(err)
 		}
 		address.IP = netip.AddrFrom16(addr)
 	case addrTypeDomainName:
-		if _, err := r.Read(addrType[:]); err != nil {
-			return nil, err
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, noEOF(err)
+		}
+		// The length is a single byte, which limits domain names to 255 bytes.
+		addrLen := buf[0]
+		if addrLen == 0 {
+			return nil, fmt.Errorf("%w: empty domain name", ErrInvalidAddress)
 		}
-		addrLen := addrType[0]
-		// addrLen btye type maximum value is 255 which
-		// prevents passing larger then 255 values for domain names.
 		fqdn := make([]byte, addrLen)
 		if _, err := io.ReadFull(r, fqdn); err != nil {
-			return nil, err
+			return nil, noEOF(err)
 		}
 		address.Name = string(fqdn)
 	default:
-		return nil, errors.New("unrecognized address type")
+		return nil, fmt.Errorf("%w: unrecognized address type %v", ErrAddressTypeNotSupported, buf[0])
 	}
 	var port [2]byte
 	if _, err := io.ReadFull(r, port[:]); err != nil {
-		return nil, err
+		return nil, noEOF(err)
 	}
 	address.Port = binary.BigEndian.Uint16(port[:])
 	return address, nil
 }
+
+// noEOF converts io.EOF to io.ErrUnexpectedEOF, for when the input ends in the middle of an address.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -16,11 +16,16 @@ package socks5
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"net"
 	"net/netip"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
 
+	"github.com/Jigsaw-Code/outline-sdk/transport"
 	"github.com/stretchr/testify/require"
 )
 
@@ -28,14 +33,14 @@ func TestReadAddr(t *testing.T) {
 	tests := []struct {
 		name    string
 		input   []byte
-		want    *address
+		want    *Address
 		wantErr bool
 	}{
 
 		{
 			name:    "IPv4 Example",
 			input:   []byte{addrTypeIPv4, 192, 168, 1, 1, 0x01, 0xF4},
-			want:    &address{IP: netip.MustParseAddr("192.168.1.1"), Port: 500},
+			want:    &Address{IP: netip.MustParseAddr("192.168.1.1"), Port: 500},
 			wantErr: false,
 		},
 		{
@@ -48,7 +53,7 @@ func TestReadAddr(t *testing.T) {
 				0x00, 0x00, 0x00, 0x01, // last segment with the "1"
 				0x04, 0xD2, // port number 1234
 			},
-			want:    &address{IP: netip.MustParseAddr("2001:db8::1"), Port: 1234},
+			want:    &Address{IP: netip.MustParseAddr("2001:db8::1"), Port: 1234},
 			wantErr: false,
 		},
 		{
@@ -61,7 +66,7 @@ func TestReadAddr(t *testing.T) {
 				0xfe, 0x9d, 0xf1, 0x56, // "fe9d:f156"
 				0x00, 0x50, // port number 80 in hexadecimal
 			},
-			want:    &address{IP: netip.MustParseAddr("fe80::204:61ff:fe9d:f156"), Port: 80},
+			want:    &Address{IP: netip.MustParseAddr("fe80::204:61ff:fe9d:f156"), Port: 80},
 			wantErr: false,
 		},
 		{
@@ -74,7 +79,7 @@ func TestReadAddr(t *testing.T) {
 				0x00, 0x00, 0x00, 0x01, // last segment is "0001"
 				0x1F, 0x90, // port number 8080 in hexadecimal
 			},
-			want:    &address{IP: netip.IPv6Loopback(), Port: 8080},
+			want:    &Address{IP: netip.IPv6Loopback(), Port: 8080},
 			wantErr: false,
 		},
 		{
@@ -85,13 +90,13 @@ func TestReadAddr(t *testing.T) {
 				'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', // The domain name "example.com"
 				0x23, 0x28, // Port number 9000 in hexadecimal
 			},
-			want:    &address{Name: "example.com", Port: 9000},
+			want:    &Address{Name: "example.com", Port: 9000},
 			wantErr: false,
 		},
 		{
 			name:    "Domain Long",
 			input:   append([]byte{addrTypeDomainName, 0x3B}, append([]byte("very-long-domain-name-used-for-testing-purposes.example.com"), 0x00, 0x50)...),
-			want:    &address{Name: "very-long-domain-name-used-for-testing-purposes.example.com", Port: 80},
+			want:    &Address{Name: "very-long-domain-name-used-for-testing-purposes.example.com", Port: 80},
 			wantErr: false,
 		},
 		{
@@ -106,12 +111,24 @@ func TestReadAddr(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name:    "Empty Domain",
+			input:   []byte{addrTypeDomainName, 0, 0x00, 0x50},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "Short Domain",
+			input:   []byte{addrTypeDomainName, 10, 'a', 'b'},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := bytes.NewReader(tt.input)
-			got, err := readAddr(r)
+			got, err := ReadAddr(r)
 			if tt.wantErr {
 				require.Error(t, err, "Expected an error but got none")
 			} else {
@@ -119,12 +136,109 @@ func TestReadAddr(t *testing.T) {
 			}
 
 			if !tt.wantErr && !compareAddresses(got, tt.want) {
-				t.Errorf("readAddr() got = %v, want %v", got, tt.want)
+				t.Errorf("ReadAddr() got = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestReadAddr_Errors(t *testing.T) {
+	_, err := ReadAddr(bytes.NewReader(nil))
+	require.ErrorIs(t, err, io.EOF)
+
+	_, err = ReadAddr(bytes.NewReader([]byte{addrTypeDomainName}))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = ReadAddr(bytes.NewReader([]byte{addrTypeIPv4, 1, 2, 3, 4, 0}))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = ReadAddr(bytes.NewReader([]byte{0x02, 1, 2, 3, 4, 0, 0}))
+	require.ErrorIs(t, err, ErrAddressTypeNotSupported)
+
+	_, err = ReadAddr(bytes.NewReader([]byte{addrTypeDomainName, 0, 0, 0}))
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+// zeroReader returns (0, nil) on every other call, which is allowed by the io.Reader contract.
+type zeroReader struct {
+	r    io.Reader
+	zero bool
+}
+
+func (z *zeroReader) Read(p []byte) (int, error) {
+	z.zero = !z.zero
+	if z.zero {
+		return 0, nil
+	}
+	return z.r.Read(p)
+}
+
+func TestReadAddr_EmptyReads(t *testing.T) {
+	input := []byte{addrTypeDomainName, 0x0b, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', 0x23, 0x28}
+	got, err := ReadAddr(&zeroReader{r: iotest.OneByteReader(bytes.NewReader(input))})
+	require.NoError(t, err)
+	require.Equal(t, &Address{Name: "example.com", Port: 9000}, got)
+}
+
+func TestReadAddr_ExactRead(t *testing.T) {
+	r := bytes.NewReader([]byte{addrTypeIPv4, 8, 8, 8, 8, 0, 53, 'r', 'e', 's', 't'})
+	got, err := ReadAddr(r)
+	require.NoError(t, err)
+	require.Equal(t, "8.8.8.8:53", got.String())
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "rest", string(rest))
+}
+
+func FuzzReadAddr(f *testing.F) {
+	f.Add([]byte{addrTypeIPv4, 192, 168, 1, 1, 0x01, 0xF4})
+	f.Add([]byte{addrTypeIPv6, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0x04, 0xD2})
+	f.Add([]byte{addrTypeDomainName, 0x0b, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', 0x23, 0x28})
+	f.Add([]byte{addrTypeDomainName, 0})
+	f.Fuzz(func(t *testing.T, input []byte) {
+		r := bytes.NewReader(input)
+		addr, err := ReadAddr(r)
+		if err != nil {
+			require.Nil(t, addr)
+			return
+		}
+		consumed := len(input) - r.Len()
+		require.True(t, addr.IP.IsValid() != (addr.Name != ""))
+		if addr.IP.IsValid() {
+			// IP addresses must round-trip exactly.
+			encoded, err := AppendAddr(nil, addr.String())
+			require.NoError(t, err)
+			require.Equal(t, input[:consumed], encoded)
+		}
+	})
+}
+
+func FuzzAppendAddr(f *testing.F) {
+	f.Add("8.8.8.8:853")
+	f.Add("[2001:4860:4860::8888]:853")
+	f.Add("dns.google:853")
+	f.Add(":53")
+	f.Fuzz(func(t *testing.T, address string) {
+		encoded, err := AppendAddr(nil, address)
+		if err != nil {
+			require.ErrorIs(t, err, ErrInvalidAddress)
+			return
+		}
+		r := bytes.NewReader(encoded)
+		decoded, err := ReadAddr(r)
+		require.NoError(t, err)
+		require.Zero(t, r.Len())
+		host, port, err := net.SplitHostPort(address)
+		require.NoError(t, err)
+		portNum, err := strconv.ParseUint(port, 10, 16)
+		require.NoError(t, err)
+		require.Equal(t, uint16(portNum), decoded.Port)
+		if !decoded.IP.IsValid() {
+			require.Equal(t, host, decoded.Name)
+		}
+	})
+}
+
 func BenchmarkReadAddr(b *testing.B) {
 	tests := []struct {
 		name  string
@@ -152,7 +266,7 @@ func BenchmarkReadAddr(b *testing.B) {
 				if _, err := reader.Seek(0, io.SeekStart); err != nil {
 					b.Error("Seek failed:", err)
 				}
-				if _, err := readAddr(reader); err != nil {
+				if _, err := ReadAddr(reader); err != nil {
 					b.Error("readAddr failed:", err)
 				}
 			}
@@ -160,7 +274,7 @@ func BenchmarkReadAddr(b *testing.B) {
 	}
 }
 
-func compareAddresses(a1, a2 *address) bool {
+func compareAddresses(a1, a2 *Address) bool {
 	if a1 == nil || a2 == nil {
 		return a1 == a2
 	}
@@ -170,39 +284,77 @@ func compareAddresses(a1, a2 *address) bool {
 	return true
 }
 
-func TestAppendSOCKS5Address_IPv4(t *testing.T) {
+func TestAppendAddr_IPv4(t *testing.T) {
 	b := []byte{}
-	b, err := appendSOCKS5Address(b, "8.8.8.8:853")
+	b, err := AppendAddr(b, "8.8.8.8:853")
 	require.NoError(t, err)
 	// 853 = 0x355
 	require.EqualValues(t, []byte{1, 8, 8, 8, 8, 0x3, 0x55}, b)
 }
 
-func TestAppendSOCKS5Address_IPv6(t *testing.T) {
+func TestAppendAddr_IPv6(t *testing.T) {
 	b := []byte{}
-	b, err := appendSOCKS5Address(b, "[2001:4860:4860::8888]:853")
+	b, err := AppendAddr(b, "[2001:4860:4860::8888]:853")
 	require.NoError(t, err)
 	require.EqualValues(t, []byte{0x04, 0x20, 0x01, 0x48, 0x60, 0x48, 0x60, 0, 0, 0, 0, 0, 0, 0, 0, 0x88, 0x88, 0x3, 0x55}, b)
 }
 
-func TestAppendSOCKS5Address_DomainName(t *testing.T) {
+func TestAppendAddr_DomainName(t *testing.T) {
 	b := []byte{}
-	b, err := appendSOCKS5Address(b, "dns.google:853")
+	b, err := AppendAddr(b, "dns.google:853")
 	require.NoError(t, err)
 	require.EqualValues(t, []byte{0x03, byte(len("dns.google")), 'd', 'n', 's', '.', 'g', 'o', 'o', 'g', 'l', 'e', 0x3, 0x55}, b)
 }
 
-func TestAppendSOCKS5Address_NotHostPort(t *testing.T) {
-	_, err := appendSOCKS5Address([]byte{}, "fsdfksajdhfjk")
+func TestAppendAddr_NotHostPort(t *testing.T) {
+	_, err := AppendAddr([]byte{}, "fsdfksajdhfjk")
 	require.Error(t, err)
 }
 
-func TestAppendSOCKS5Address_BadPort(t *testing.T) {
-	_, err := appendSOCKS5Address([]byte{}, "dns.google:dns")
+func TestAppendAddr_BadPort(t *testing.T) {
+	_, err := AppendAddr([]byte{}, "dns.google:dns")
 	require.Error(t, err)
 }
 
-func TestAppendSOCKS5Address_DomainNameTooLong(t *testing.T) {
-	_, err := appendSOCKS5Address([]byte{}, strings.Repeat("1234567890", 26)+":53")
-	require.Error(t, err)
+func TestAppendAddr_DomainNameTooLong(t *testing.T) {
+	_, err := AppendAddr([]byte{}, strings.Repeat("1234567890", 26)+":53")
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestAppendAddr_EmptyHost(t *testing.T) {
+	_, err := AppendAddr([]byte{}, ":53")
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestAppendAddr_IPv4MappedIPv6(t *testing.T) {
+	b, err := AppendAddr(nil, "[::ffff:8.8.8.8]:853")
+	require.NoError(t, err)
+	require.EqualValues(t, []byte{1, 8, 8, 8, 8, 0x3, 0x55}, b)
+}
+
+func TestReplyCode_ErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		code        ReplyCode
+		unreachable bool
+		handshake   bool
+	}{
+		{code: replySucceeded},
+		{code: ErrGeneralServerFailure, handshake: true},
+		{code: ErrConnectionNotAllowedByRuleset, handshake: true},
+		{code: ErrNetworkUnreachable, unreachable: true},
+		{code: ErrHostUnreachable, unreachable: true},
+		{code: ErrConnectionRefused, unreachable: true},
+		{code: ErrTTLExpired, unreachable: true},
+		{code: ErrCommandNotSupported, handshake: true},
+		{code: ErrAddressTypeNotSupported, handshake: true},
+		{code: ReplyCode(0x09), handshake: true},
+		{code: ReplyCode(0xff), handshake: true},
+	} {
+		t.Run(tc.code.Error(), func(t *testing.T) {
+			require.Equal(t, tc.unreachable, errors.Is(tc.code, transport.ErrUpstreamUnreachable))
+			require.Equal(t, tc.handshake, errors.Is(tc.code, transport.ErrProxyHandshake))
+		})
+	}
+	require.ErrorIs(t, ErrHostUnreachable, ErrHostUnreachable)
+	require.NotErrorIs(t, ErrHostUnreachable, ErrNetworkUnreachable)
 }
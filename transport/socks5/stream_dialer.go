@@ -19,6 +19,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"sync"
+	"time"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 )
@@ -39,14 +42,70 @@ func NewClient(streamEndpoint transport.StreamEndpoint) (*Client, error) {
 	return &Client{se: streamEndpoint, cred: nil}, nil
 }
 
+// NewConnClient creates a SOCKS5 client that runs the handshake over conn, an established connection to the proxy,
+// instead of connecting to the proxy itself. This is useful when the connection comes from a platform API, like the
+// protected sockets of an Android VpnService. Use [github.com/Jigsaw-Code/outline-sdk/x/netadapter.ToStreamConn] to
+// convert a [net.Conn].
+//
+// The client takes ownership of conn, which can only be used for one request: a single [Client.DialStream], or a
+// single [Client.ListenPacket] as the control connection of the association. Later requests fail. The connection is
+// closed if the handshake fails.
+func NewConnClient(conn transport.StreamConn) (*Client, error) {
+	if conn == nil {
+		return nil, errors.New("argument conn must not be nil")
+	}
+	return NewClient(&connEndpoint{conn: conn})
+}
+
+// connEndpoint is a [transport.StreamEndpoint] that returns an established connection once.
+type connEndpoint struct {
+	mu   sync.Mutex
+	conn transport.StreamConn
+}
+
+var _ transport.StreamEndpoint = (*connEndpoint)(nil)
+
+func (e *connEndpoint) ConnectStream(ctx context.Context) (transport.StreamConn, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return nil, errors.New("the connection to the proxy was already used")
+	}
+	conn := e.conn
+	e.conn = nil
+	return conn, nil
+}
+
 type Client struct {
 	se   transport.StreamEndpoint
 	pd   transport.PacketDialer
 	cred *credentials
+
+	handshakeTimeout time.Duration
+	methodTimeout    time.Duration
+	requestTimeout   time.Duration
+
+	reuseAssociation bool
+	assocMu          sync.Mutex
+	assoc            *packetAssociation
+
+	deadPeer *transport.DeadPeerDetection
 }
 
 var _ transport.StreamDialer = (*Client)(nil)
 var _ transport.PacketListener = (*Client)(nil)
+var _ transport.CapabilityReporter = (*Client)(nil)
+var _ transport.Pinger = (*Client)(nil)
+
+// Capabilities implements [transport.CapabilityReporter]. The proxy resolves domain names, and
+// packets are only supported if enabled with [Client.EnablePacket].
+func (c *Client) Capabilities() transport.Capability {
+	caps := transport.CapabilityStream | transport.CapabilityRemoteDNS | transport.CapabilityIPv6
+	if c.pd != nil {
+		caps |= transport.CapabilityPacket
+	}
+	return caps
+}
 
 func (c *Client) SetCredentials(username, password []byte) error {
 	if len(username) > 255 {
@@ -72,9 +131,51 @@ func (c *Client) EnablePacket(packetDialer transport.PacketDialer) {
 	c.pd = packetDialer
 }
 
+// SetHandshakeTimeout limits the duration of the SOCKS5 handshake, after the connection to the proxy is
+// established. The dial context still applies. Zero, the default, means no limit other than the context.
+func (c *Client) SetHandshakeTimeout(timeout time.Duration) {
+	c.handshakeTimeout = timeout
+}
+
+// SetPhaseTimeouts limits how long the client waits for the server in each phase of the handshake:
+// methodTimeout for the method selection and authentication responses, and requestTimeout for the reply to the
+// command, starting when the previous phase completes. They apply on top of the handshake timeout and the dial
+// context. Zero, the default, means no limit for the phase.
+func (c *Client) SetPhaseTimeouts(methodTimeout, requestTimeout time.Duration) {
+	c.methodTimeout = methodTimeout
+	c.requestTimeout = requestTimeout
+}
+
+// phaseDeadline returns the deadline of a phase that starts now, which is capped by the handshake deadline.
+func phaseDeadline(handshakeDeadline time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return handshakeDeadline
+	}
+	deadline := time.Now().Add(timeout)
+	if !handshakeDeadline.IsZero() && handshakeDeadline.Before(deadline) {
+		return handshakeDeadline
+	}
+	return deadline
+}
+
+// EnableAssociationReuse makes [Client.ListenPacket] share a single UDP association, with one
+// control connection and one relay socket, among all the open packet connections, instead of
+// performing a new handshake for each one. The association is closed once the last connection
+// using it is closed.
+//
+// Since the relay only reports the source of each response, each destination belongs to the first
+// connection that sends to it, which receives its responses. A connection that sends to a destination
+// of another connection moves to an association of its own, at the cost of a new handshake. Responses
+// from the IP addresses of domain name destinations are routed by port, so a domain name destination
+// also claims its port.
+func (c *Client) EnableAssociationReuse() {
+	c.reuseAssociation = true
+}
+
 // request sends a SOCKS5 request to the server to perform a command (e.g., connect, udp associate),
 // performs authentication (if provided), returns the bound address.
-func (c *Client) request(conn io.ReadWriter, cmd byte, dstAddr string) (*address, error) {
+// The handshake must complete by handshakeDeadline, unless it's zero. The deadlines are left set on conn.
+func (c *Client) request(conn net.Conn, handshakeDeadline time.Time, cmd byte, dstAddr string) (*Address, error) {
 	// For protocol details, see https://datatracker.ietf.org/doc/html/rfc1928#section-3
 	// Creating a single buffer for method selection, authentication, and connection request
 	// Buffer large enough for method, auth, and connect requests with a domain name address.
@@ -120,7 +221,7 @@ func (c *Client) request(conn io.ReadWriter, cmd byte, dstAddr string) (*address
 	// +----+-----+-------+------+----------+----------+
 	b = append(b, 5, cmd, 0)
 	// TODO: Probably more memory efficient if remoteAddr is added to the buffer directly.
-	b, err := appendSOCKS5Address(b, dstAddr)
+	b, err := AppendAddr(b, dstAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SOCKS5 address: %w", err)
 	}
@@ -128,6 +229,7 @@ func (c *Client) request(conn io.ReadWriter, cmd byte, dstAddr string) (*address
 	// We merge the method and CMD requests and only perform one write
 	// because we send a single authentication method, so there's no point
 	// in waiting for the response. This eliminates a roundtrip.
+	conn.SetDeadline(handshakeDeadline)
 	_, err = conn.Write(b)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write combined SOCKS5 request: %w", err)
@@ -142,6 +244,7 @@ func (c *Client) request(conn io.ReadWriter, cmd byte, dstAddr string) (*address
 	// +----+--------+
 	// buffer[0]: VER, buffer[1]: METHOD
 	// Reuse buffer for better performance.
+	conn.SetReadDeadline(phaseDeadline(handshakeDeadline, c.methodTimeout))
 	if _, err = io.ReadFull(conn, buffer[:2]); err != nil {
 		return nil, fmt.Errorf("failed to read method server response: %w", err)
 	}
@@ -186,6 +289,7 @@ func (c *Client) request(conn io.ReadWriter, cmd byte, dstAddr string) (*address
 	// buffer[1]: REP
 	// buffer[2]: RSV
 	// buffer[3]: ATYP
+	conn.SetReadDeadline(phaseDeadline(handshakeDeadline, c.requestTimeout))
 	if _, err = io.ReadFull(conn, buffer[:3]); err != nil {
 		return nil, fmt.Errorf("failed to read connect server response: %w", err)
 	}
@@ -195,12 +299,12 @@ func (c *Client) request(conn io.ReadWriter, cmd byte, dstAddr string) (*address
 	}
 
 	// if REP is not 0, it means the server returned an error.
-	if buffer[1] != 0 {
+	if ReplyCode(buffer[1]) != replySucceeded {
 		return nil, ReplyCode(buffer[1])
 	}
 
 	// 4. Read BND.ADDR.
-	bindAddr, err := readAddr(conn)
+	bindAddr, err := ReadAddr(conn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read bound address: %w", err)
 	}
@@ -208,27 +312,146 @@ func (c *Client) request(conn io.ReadWriter, cmd byte, dstAddr string) (*address
 	return bindAddr, nil
 }
 
+// cancelableConn is a [net.Conn] whose deadlines can be cancelled, so that the deadlines set later by the
+// handshake phases don't extend a cancelled handshake.
+type cancelableConn struct {
+	net.Conn
+	mu        sync.Mutex
+	cancelled bool
+}
+
+// cancel expires the deadlines of the connection, which unblocks any pending read or write, and ignores
+// the deadlines set afterwards.
+func (c *cancelableConn) cancel() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancelled = true
+	c.Conn.SetDeadline(time.Unix(1, 0))
+}
+
+func (c *cancelableConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancelled {
+		return nil
+	}
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *cancelableConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancelled {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *cancelableConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancelled {
+		return nil
+	}
+	return c.Conn.SetWriteDeadline(t)
+}
+
 // connectAndRequest manages the connection lifecycle and delegates the SOCKS5 communication to the request function.
-func (c *Client) connectAndRequest(ctx context.Context, cmd byte, dstAddr string) (transport.StreamConn, *address, error) {
+func (c *Client) connectAndRequest(ctx context.Context, cmd byte, dstAddr string) (transport.StreamConn, *Address, error) {
 	proxyConn, err := c.se.ConnectStream(ctx)
 	if err != nil {
 		return nil, nil, fmt.Errorf("could not connect to SOCKS5 proxy: %w", err)
 	}
 
-	bindAddr, err := c.request(proxyConn, cmd, dstAddr)
+	handshakeDeadline, _ := ctx.Deadline()
+	if c.handshakeTimeout > 0 {
+		if deadline := time.Now().Add(c.handshakeTimeout); handshakeDeadline.IsZero() || deadline.Before(handshakeDeadline) {
+			handshakeDeadline = deadline
+		}
+	}
+	// Unblock the handshake if the context is cancelled, so a stalled server can't hang it.
+	handshakeConn := &cancelableConn{Conn: proxyConn}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			handshakeConn.cancel()
+		case <-stop:
+		}
+	}()
+	bindAddr, err := c.request(handshakeConn, handshakeDeadline, cmd, dstAddr)
+	close(stop)
+	<-stopped
 	if err != nil {
 		proxyConn.Close()
+		// Reply codes carry their own class.
+		var replyCode ReplyCode
+		if !errors.As(err, &replyCode) {
+			err = transport.NewHandshakeError(err, transport.ErrProxyHandshake)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, fmt.Errorf("SOCKS5 handshake aborted: %w: %w", ctxErr, err)
+		}
 		return nil, nil, err
 	}
+	// Clear the handshake deadlines.
+	proxyConn.SetDeadline(time.Time{})
 
 	return proxyConn, bindAddr, nil
 }
 
+// Ping implements [transport.Pinger]. It connects to the proxy and measures the round trip of the method
+// selection, which doesn't include the connection setup. It doesn't authenticate or send a request.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	proxyConn, err := c.se.ConnectStream(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("could not connect to SOCKS5 proxy: %w", err)
+	}
+	defer proxyConn.Close()
+	// Unblock the exchange if the context is cancelled.
+	pingConn := &cancelableConn{Conn: proxyConn}
+	if deadline, ok := ctx.Deadline(); ok {
+		pingConn.SetDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			pingConn.cancel()
+		case <-stop:
+		}
+	}()
+
+	method := byte(authMethodNoAuth)
+	if c.cred != nil {
+		method = authMethodUserPass
+	}
+	start := time.Now()
+	if _, err := pingConn.Write([]byte{5, 1, method}); err != nil {
+		return 0, fmt.Errorf("failed to write SOCKS5 method selection: %w", err)
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(pingConn, reply[:]); err != nil {
+		return 0, fmt.Errorf("failed to read method server response: %w", err)
+	}
+	rtt := time.Since(start)
+	if reply[0] != 5 {
+		return 0, fmt.Errorf("invalid protocol version %v. Expected 5", reply[0])
+	}
+	return rtt, nil
+}
+
 // DialStream implements [transport.StreamDialer].DialStream using SOCKS5.
 // It will send the auth method, auth credentials (if auth is chosen), and
 // the connect requests in one packet, to avoid an additional roundtrip.
 // The returned [error] will be of type [ReplyCode] if the server sends a SOCKS error reply code, which
 // you can check against the error constants in this package using [errors.Is].
+// Other handshake errors match [transport.ErrProxyHandshake].
+// The handshake is bound by the context, and by the timeouts set with [Client.SetHandshakeTimeout] and
+// [Client.SetPhaseTimeouts].
 func (c *Client) DialStream(ctx context.Context, dstAddr string) (transport.StreamConn, error) {
 	proxyConn, _, err := c.connectAndRequest(ctx, CmdConnect, dstAddr)
 	if err != nil {
@@ -236,3 +459,27 @@ func (c *Client) DialStream(ctx context.Context, dstAddr string) (transport.Stre
 	}
 	return proxyConn, nil
 }
+
+// DialStreamWithBoundAddr is like [Client.DialStream], but it also returns the address in the reply of the server
+// (BND.ADDR and BND.PORT), which is the address the server used to connect to the destination. Applications that
+// need to know their public address, like for NAT traversal or FTP, can use it.
+func (c *Client) DialStreamWithBoundAddr(ctx context.Context, dstAddr string) (transport.StreamConn, Address, error) {
+	proxyConn, bindAddr, err := c.connectAndRequest(ctx, CmdConnect, dstAddr)
+	if err != nil {
+		return nil, Address{}, err
+	}
+	return proxyConn, *bindAddr, nil
+}
+
+// BoundAddrConn is implemented by the packet connections of the [Client], to expose the address in the reply of the
+// server to the UDP ASSOCIATE request (BND.ADDR and BND.PORT). Get it with a type assertion:
+//
+//	if bound, ok := conn.(socks5.BoundAddrConn); ok {
+//		addr := bound.BoundAddr()
+//	}
+//
+// For stream connections, use [Client.DialStreamWithBoundAddr].
+type BoundAddrConn interface {
+	// BoundAddr returns the address of the UDP relay, with an unspecified IP replaced by the IP of the server.
+	BoundAddr() Address
+}
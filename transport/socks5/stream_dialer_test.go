@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 	"github.com/stretchr/testify/assert"
@@ -36,6 +38,79 @@ func TestSOCKS5Dialer_NewStreamDialerNil(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestNewConnClient(t *testing.T) {
+	client, err := NewConnClient(nil)
+	require.Nil(t, client)
+	require.Error(t, err)
+
+	// Destination server that echoes the request.
+	destListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer destListener.Close()
+	go func() {
+		conn, err := destListener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer proxyListener.Close()
+	go socks5.NewServer().Serve(proxyListener)
+
+	// The connection to the proxy is established by the caller.
+	proxyConn, err := net.DialTCP("tcp", nil, proxyListener.Addr().(*net.TCPAddr))
+	require.NoError(t, err)
+	client, err = NewConnClient(proxyConn)
+	require.NoError(t, err)
+	conn, err := client.DialStream(context.Background(), destListener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, proxyConn, conn)
+	_, err = conn.Write([]byte("Request"))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	require.NoError(t, iotest.TestReader(conn, []byte("Request")))
+
+	// The connection can't be reused.
+	_, err = client.DialStream(context.Background(), destListener.Addr().String())
+	require.ErrorContains(t, err, "already used")
+}
+
+func TestClient_BoundAddr(t *testing.T) {
+	destListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer destListener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := destListener.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- conn
+	}()
+
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer proxyListener.Close()
+	go socks5.NewServer().Serve(proxyListener)
+
+	client, err := NewClient(&transport.TCPEndpoint{Address: proxyListener.Addr().String()})
+	require.NoError(t, err)
+	conn, boundAddr, err := client.DialStreamWithBoundAddr(context.Background(), destListener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	destConn := <-accepted
+	defer destConn.Close()
+
+	// The connection is not wrapped, and the bound address is the source of the connection to the destination.
+	require.IsType(t, &net.TCPConn{}, conn)
+	require.Equal(t, destConn.RemoteAddr().String(), boundAddr.String())
+}
+
 func TestSOCKS5Dialer_BadConnection(t *testing.T) {
 	client, err := NewClient(&transport.TCPEndpoint{Address: "127.0.0.0:0"})
 	require.NotNil(t, client)
@@ -101,6 +176,7 @@ func testExchange(tb testing.TB, listener *net.TCPListener, destAddr string, req
 		serverConn, err := client.DialStream(context.Background(), destAddr)
 		if replyCode != 0 {
 			require.ErrorIs(tb, err, replyCode)
+			require.NotNil(tb, transport.ErrorClass(err))
 			var extractedReplyCode ReplyCode
 			require.True(tb, errors.As(err, &extractedReplyCode))
 			require.Equal(tb, replyCode, extractedReplyCode)
@@ -131,7 +207,7 @@ func testExchange(tb testing.TB, listener *net.TCPListener, destAddr string, req
 		// Method request: VER = 5, NMETHODS = 1, METHODS = 0 (no auth)
 		// Connect request: VER = 5, CMD = 1, RSV = 0, ATYP, DST.ADDR, DST.PORT
 		expected := []byte{5, 1, 0, 5, 1, 0}
-		expected, err = appendSOCKS5Address(expected, destAddr)
+		expected, err = AppendAddr(expected, destAddr)
 		require.NoError(tb, err)
 		err = iotest.TestReader(io.LimitReader(clientConn, int64(len(expected))), expected)
 		assert.NoError(tb, err, "Request read failed: %v", err)
@@ -245,3 +321,191 @@ func TestConnectWithAuth(t *testing.T) {
 	_, err = dialer.DialStream(context.Background(), address)
 	require.Error(t, err)
 }
+
+func TestClientCapabilities(t *testing.T) {
+	client, err := NewClient(&transport.TCPEndpoint{Address: "127.0.0.1:1080"})
+	require.NoError(t, err)
+	require.Equal(t, transport.CapabilityStream|transport.CapabilityRemoteDNS|transport.CapabilityIPv6, transport.Capabilities(client))
+	require.ErrorIs(t, transport.CheckCapabilities(client, transport.CapabilityPacket), transport.ErrMissingCapability)
+
+	client.EnablePacket(&transport.UDPDialer{})
+	require.True(t, transport.Capabilities(client).Has(transport.CapabilityPacket|transport.CapabilityRemoteDNS))
+}
+
+// startStallingServer runs a server that reads the requests and replies with the given bytes, then stalls.
+func startStallingServer(t *testing.T, reply []byte) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write(reply)
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClient_HandshakeTimeout(t *testing.T) {
+	address := startStallingServer(t, nil)
+	client, err := NewClient(&transport.TCPEndpoint{Address: address})
+	require.NoError(t, err)
+	client.SetHandshakeTimeout(100 * time.Millisecond)
+	start := time.Now()
+	_, err = client.DialStream(context.Background(), "example.com:443")
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.ErrorIs(t, err, transport.ErrProxyHandshake)
+	require.NotErrorIs(t, err, transport.ErrBlockedSuspected)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestClient_HandshakeErrorClass(t *testing.T) {
+	// The server closes the connection in the middle of the handshake.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}()
+	client, err := NewClient(&transport.TCPEndpoint{Address: listener.Addr().String()})
+	require.NoError(t, err)
+	_, err = client.DialStream(context.Background(), "example.com:443")
+	require.ErrorIs(t, err, transport.ErrProxyHandshake)
+	require.ErrorIs(t, err, transport.ErrBlockedSuspected)
+	require.ErrorContains(t, err, "failed to read method server response")
+}
+
+func TestClient_PhaseTimeouts(t *testing.T) {
+	// The server accepts the method, but never replies to the command.
+	address := startStallingServer(t, []byte{5, authMethodNoAuth})
+	client, err := NewClient(&transport.TCPEndpoint{Address: address})
+	require.NoError(t, err)
+	client.SetPhaseTimeouts(time.Minute, 100*time.Millisecond)
+	_, err = client.DialStream(context.Background(), "example.com:443")
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.ErrorContains(t, err, "connect server response")
+
+	// The server never replies to the method selection.
+	address = startStallingServer(t, nil)
+	client, err = NewClient(&transport.TCPEndpoint{Address: address})
+	require.NoError(t, err)
+	client.SetPhaseTimeouts(100*time.Millisecond, time.Minute)
+	_, err = client.DialStream(context.Background(), "example.com:443")
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.ErrorContains(t, err, "method server response")
+}
+
+func TestClient_HandshakeContextCancel(t *testing.T) {
+	address := startStallingServer(t, nil)
+	client, err := NewClient(&transport.TCPEndpoint{Address: address})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err = client.DialStream(ctx, "example.com:443")
+	require.ErrorIs(t, err, context.Canceled)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.DialStream(ctx, "example.com:443")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// cancelOnWriteConn cancels the handshake context after the first write, and waits for the cancellation to expire
+// the deadlines, so the following phase deadlines are set after it.
+type cancelOnWriteConn struct {
+	transport.StreamConn
+	cancel  context.CancelFunc
+	expired chan struct{}
+	once    sync.Once
+}
+
+func (c *cancelOnWriteConn) Write(b []byte) (int, error) {
+	n, err := c.StreamConn.Write(b)
+	c.once.Do(func() {
+		c.cancel()
+		<-c.expired
+	})
+	return n, err
+}
+
+func (c *cancelOnWriteConn) SetDeadline(t time.Time) error {
+	if t.Equal(time.Unix(1, 0)) {
+		close(c.expired)
+	}
+	return c.StreamConn.SetDeadline(t)
+}
+
+func TestClient_HandshakeCancelDuringMethodNegotiation(t *testing.T) {
+	address := startStallingServer(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	endpoint := transport.FuncStreamEndpoint(func(ctx context.Context) (transport.StreamConn, error) {
+		conn, err := (&transport.TCPEndpoint{Address: address}).ConnectStream(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &cancelOnWriteConn{StreamConn: conn, cancel: cancel, expired: make(chan struct{})}, nil
+	})
+	client, err := NewClient(endpoint)
+	require.NoError(t, err)
+	// The method timeout must not override the expired deadline of the cancelled handshake.
+	client.SetPhaseTimeouts(time.Minute, time.Minute)
+	start := time.Now()
+	_, err = client.DialStream(ctx, "example.com:443")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestClient_Ping(t *testing.T) {
+	address := startStallingServer(t, []byte{5, authMethodNoAuth})
+	client, err := NewClient(&transport.TCPEndpoint{Address: address})
+	require.NoError(t, err)
+	rtt, err := transport.Ping(context.Background(), client)
+	require.NoError(t, err)
+	require.Greater(t, rtt, time.Duration(0))
+
+	// Bad version.
+	client, err = NewClient(&transport.TCPEndpoint{Address: startStallingServer(t, []byte{4, 0})})
+	require.NoError(t, err)
+	_, err = client.Ping(context.Background())
+	require.ErrorContains(t, err, "invalid protocol version 4")
+
+	// The server never replies.
+	client, err = NewClient(&transport.TCPEndpoint{Address: startStallingServer(t, nil)})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.Ping(ctx)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestClient_HandshakeTimeoutClearedAfterDial(t *testing.T) {
+	// Method response and successful connect reply.
+	address := startStallingServer(t, []byte{5, 0, 5, 0, 0, 1, 0, 0, 0, 0, 0, 0, 'o', 'k'})
+	client, err := NewClient(&transport.TCPEndpoint{Address: address})
+	require.NoError(t, err)
+	client.SetHandshakeTimeout(50 * time.Millisecond)
+	client.SetPhaseTimeouts(50*time.Millisecond, 50*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	conn, err := client.DialStream(ctx, "example.com:443")
+	cancel()
+	require.NoError(t, err)
+	defer conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(buf))
+}
@@ -0,0 +1,78 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrFragmentationNotSupported is returned when decoding a SOCKS5 UDP packet that is a fragment of a larger
+// datagram, as indicated by a non-zero FRAG field. Fragment reassembly is optional in the SOCKS5 specification
+// and not supported, so such packets should be dropped.
+var ErrFragmentationNotSupported = errors.New("SOCKS5 UDP fragmentation is not supported")
+
+// udpHeaderPrefixLen is the length of the RSV and FRAG fields that precede the address.
+const udpHeaderPrefixLen = 3
+
+// AppendUDPHeader appends the SOCKS5 UDP request header for the given host:port address to b,
+// as specified in https://datatracker.ietf.org/doc/html/rfc1928#section-7.
+// The FRAG field is always 0, marking the datagram as standalone.
+// It returns an error wrapping [ErrInvalidAddress] if the address cannot be encoded.
+//
+// The header is used in both directions: clients prefix it with the destination address, and
+// servers prefix it with the source address of the reply.
+func AppendUDPHeader(b []byte, address string) ([]byte, error) {
+	// The SOCKS UDP request header is as follows:
+	//     +----+------+------+----------+----------+----------+
+	//     |RSV | FRAG | ATYP | DST.ADDR | DST.PORT |   DATA   |
+	//     +----+------+------+----------+----------+----------+
+	//     | 2  |  1   |  1   | Variable |    2     | Variable |
+	//     +----+------+------+----------+----------+----------+
+	b = append(b,
+		0x00, 0x00, // RSV
+		0x00, // FRAG
+	)
+	b, err := AppendAddr(b, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append SOCKS5 address: %w", err)
+	}
+	return b, nil
+}
+
+// ParseUDPPacket parses a SOCKS5 UDP packet, as specified in https://datatracker.ietf.org/doc/html/rfc1928#section-7,
+// and returns the address in its header and the payload. The payload slice points into the packet.
+//
+// It returns an error wrapping [ErrFragmentationNotSupported] if the FRAG field is not 0, [io.ErrUnexpectedEOF]
+// if the header is truncated, and the errors from [ReadAddr] if the address is invalid.
+func ParseUDPPacket(packet []byte) (*Address, []byte, error) {
+	if len(packet) < udpHeaderPrefixLen {
+		return nil, nil, fmt.Errorf("invalid SOCKS5 UDP packet: %w", io.ErrUnexpectedEOF)
+	}
+	if packet[0] != 0x00 || packet[1] != 0x00 {
+		return nil, nil, fmt.Errorf("invalid reserved bytes: expected 0x0000, got 0x%x", packet[:2])
+	}
+	if frag := packet[2]; frag != 0 {
+		return nil, nil, fmt.Errorf("%w: got FRAG=%v", ErrFragmentationNotSupported, frag)
+	}
+	r := bytes.NewReader(packet[udpHeaderPrefixLen:])
+	address, err := ReadAddr(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read address: %w", noEOF(err))
+	}
+	return address, packet[len(packet)-r.Len():], nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendUDPHeader(t *testing.T) {
+	b, err := AppendUDPHeader([]byte("prefix"), "8.8.8.8:53")
+	require.NoError(t, err)
+	require.Equal(t, append([]byte("prefix"), 0, 0, 0, addrTypeIPv4, 8, 8, 8, 8, 0, 53), b)
+
+	b, err = AppendUDPHeader(nil, "dns.google:853")
+	require.NoError(t, err)
+	require.Equal(t, append(append([]byte{0, 0, 0, addrTypeDomainName, 10}, "dns.google"...), 0x03, 0x55), b)
+}
+
+func TestAppendUDPHeader_InvalidAddress(t *testing.T) {
+	_, err := AppendUDPHeader(nil, "no-port")
+	require.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestParseUDPPacket(t *testing.T) {
+	packet := []byte{0, 0, 0, addrTypeIPv4, 127, 0, 0, 1, 0x1F, 0x90, 'p', 'i', 'n', 'g'}
+	addr, payload, err := ParseUDPPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:8080", addr.String())
+	require.Equal(t, []byte("ping"), payload)
+
+	// Short domain names make packets shorter than the IPv4 header.
+	packet = []byte{0, 0, 0, addrTypeDomainName, 1, 'a', 0, 80}
+	addr, payload, err = ParseUDPPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, "a", addr.Name)
+	require.Empty(t, payload)
+}
+
+func TestParseUDPPacket_Errors(t *testing.T) {
+	_, _, err := ParseUDPPacket([]byte{0, 0, 1, addrTypeIPv4, 127, 0, 0, 1, 0, 80})
+	require.ErrorIs(t, err, ErrFragmentationNotSupported)
+
+	_, _, err = ParseUDPPacket([]byte{0, 1, 0, addrTypeIPv4, 127, 0, 0, 1, 0, 80})
+	require.ErrorContains(t, err, "reserved")
+
+	_, _, err = ParseUDPPacket([]byte{0, 0})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, _, err = ParseUDPPacket([]byte{0, 0, 0})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, _, err = ParseUDPPacket([]byte{0, 0, 0, addrTypeIPv4, 127, 0})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, _, err = ParseUDPPacket([]byte{0, 0, 0, 0x09, 127, 0, 0, 1, 0, 80})
+	require.ErrorIs(t, err, ErrAddressTypeNotSupported)
+}
+
+func FuzzParseUDPPacket(f *testing.F) {
+	f.Add([]byte{0, 0, 0, addrTypeIPv4, 192, 168, 1, 1, 0x01, 0xF4, 'd', 'a', 't', 'a'})
+	f.Add([]byte{0, 0, 0, addrTypeIPv6, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0x04, 0xD2})
+	f.Add([]byte{0, 0, 0, addrTypeDomainName, 0x0b, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', 0x23, 0x28})
+	f.Add([]byte{0, 0, 1, addrTypeIPv4, 192, 168, 1, 1, 0x01, 0xF4})
+	f.Fuzz(func(t *testing.T, packet []byte) {
+		addr, payload, err := ParseUDPPacket(packet)
+		if err != nil {
+			require.Nil(t, addr)
+			return
+		}
+		require.Equal(t, byte(0), packet[2])
+		require.Equal(t, packet[len(packet)-len(payload):], payload)
+		if addr.IP.IsValid() {
+			// IP addresses must round-trip, except for IPv4-mapped IPv6 addresses, which are encoded as IPv4.
+			header, err := AppendUDPHeader(nil, addr.String())
+			require.NoError(t, err)
+			reparsed, reparsedPayload, err := ParseUDPPacket(header)
+			require.NoError(t, err)
+			require.Empty(t, reparsedPayload)
+			require.Equal(t, addr.IP.Unmap(), reparsed.IP)
+			require.Equal(t, addr.Port, reparsed.Port)
+		}
+	})
+}
+
+func FuzzAppendUDPHeader(f *testing.F) {
+	f.Add("8.8.8.8:853", []byte("data"))
+	f.Add("[2001:4860:4860::8888]:853", []byte{})
+	f.Add("dns.google:853", []byte{0, 0, 0})
+	f.Add(":53", []byte{})
+	f.Fuzz(func(t *testing.T, address string, data []byte) {
+		header, err := AppendUDPHeader(nil, address)
+		if err != nil {
+			require.ErrorIs(t, err, ErrInvalidAddress)
+			return
+		}
+		addr, payload, err := ParseUDPPacket(append(header, data...))
+		require.NoError(t, err)
+		require.Equal(t, data, payload)
+		host, _, err := net.SplitHostPort(address)
+		require.NoError(t, err)
+		if !addr.IP.IsValid() {
+			require.Equal(t, host, addr.Name)
+		}
+	})
+}
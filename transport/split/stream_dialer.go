@@ -17,6 +17,7 @@ package split
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 )
@@ -26,19 +27,34 @@ import (
 type splitDialer struct {
 	dialer    transport.StreamDialer
 	nextSplit SplitIterator
+	opts      []Option
 }
 
 var _ transport.StreamDialer = (*splitDialer)(nil)
+var _ transport.CapabilityReporter = (*splitDialer)(nil)
+var _ transport.Pinger = (*splitDialer)(nil)
 
 // NewStreamDialer creates a [transport.StreamDialer] that splits the outgoing stream according to nextSplit.
-func NewStreamDialer(dialer transport.StreamDialer, nextSplit SplitIterator) (transport.StreamDialer, error) {
+// Use [WithDelay] to wait between the segments.
+func NewStreamDialer(dialer transport.StreamDialer, nextSplit SplitIterator, opts ...Option) (transport.StreamDialer, error) {
 	if dialer == nil {
 		return nil, errors.New("argument dialer must not be nil")
 	}
 	if nextSplit == nil {
 		return nil, errors.New("argument nextSplit must not be nil")
 	}
-	return &splitDialer{dialer: dialer, nextSplit: nextSplit}, nil
+	return &splitDialer{dialer: dialer, nextSplit: nextSplit, opts: opts}, nil
+}
+
+// Capabilities implements [transport.CapabilityReporter]. It preserves the remote DNS and IPv6 support of
+// the base dialer.
+func (d *splitDialer) Capabilities() transport.Capability {
+	return transport.CapabilityStream | transport.Capabilities(d.dialer)&(transport.CapabilityRemoteDNS|transport.CapabilityIPv6)
+}
+
+// Ping implements [transport.Pinger] by pinging the base dialer.
+func (d *splitDialer) Ping(ctx context.Context) (time.Duration, error) {
+	return transport.Ping(ctx, d.dialer)
 }
 
 // DialStream implements [transport.StreamDialer].DialStream.
@@ -47,5 +63,5 @@ func (d *splitDialer) DialStream(ctx context.Context, remoteAddr string) (transp
 	if err != nil {
 		return nil, err
 	}
-	return transport.WrapConn(innerConn, innerConn, NewWriter(innerConn, d.nextSplit)), nil
+	return transport.WrapConn(innerConn, innerConn, NewWriter(innerConn, d.nextSplit, d.opts...)), nil
 }
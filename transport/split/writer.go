@@ -16,6 +16,11 @@ package split
 
 import (
 	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
 )
 
 type splitWriter struct {
@@ -23,9 +28,13 @@ type splitWriter struct {
 	// Bytes until the next split. This must always be > 0, unless splits are done.
 	nextSplitBytes    int64
 	nextSegmentLength func() int64
+	options
+	// Whether a split just happened, and the delay is due before the next write.
+	delayPending bool
 }
 
 var _ io.Writer = (*splitWriter)(nil)
+var _ transport.BuffersWriter = (*splitWriter)(nil)
 
 type splitWriterReaderFrom struct {
 	*splitWriter
@@ -78,10 +87,36 @@ func NewRepeatedSplitIterator(splits ...RepeatedSplit) SplitIterator {
 	}
 }
 
+// Option configures the split [io.Writer] and [transport.StreamDialer].
+type Option func(*options)
+
+type options struct {
+	delay, jitter time.Duration
+	sleep         func(time.Duration)
+}
+
+func newOptions(opts []Option) options {
+	o := options{sleep: time.Sleep}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithDelay makes the writer wait between the writes of consecutive segments, so they arrive in different polling
+// intervals of the middleboxes that try to reassemble them. Each wait is picked uniformly at random between
+// delay-jitter and delay+jitter, and is never negative.
+func WithDelay(delay, jitter time.Duration) Option {
+	return func(o *options) {
+		o.delay = delay
+		o.jitter = jitter
+	}
+}
+
 // NewWriter creates a split Writer that calls the nextSegmentLength [SplitIterator] to determine the number bytes until the next split
 // point until it returns zero.
-func NewWriter(writer io.Writer, nextSegmentLength SplitIterator) io.Writer {
-	sw := &splitWriter{writer: writer, nextSegmentLength: nextSegmentLength}
+func NewWriter(writer io.Writer, nextSegmentLength SplitIterator, opts ...Option) io.Writer {
+	sw := &splitWriter{writer: writer, nextSegmentLength: nextSegmentLength, options: newOptions(opts)}
 	sw.nextSplitBytes = nextSegmentLength()
 	if rf, ok := writer.(io.ReaderFrom); ok {
 		return &splitWriterReaderFrom{sw, rf}
@@ -94,6 +129,7 @@ func (w *splitWriterReaderFrom) ReadFrom(source io.Reader) (int64, error) {
 	var written int64
 	for w.nextSplitBytes > 0 {
 		expectedBytes := w.nextSplitBytes
+		w.waitDelay()
 		n, err := w.rf.ReadFrom(io.LimitReader(source, expectedBytes))
 		written += n
 		w.advance(n)
@@ -105,6 +141,7 @@ func (w *splitWriterReaderFrom) ReadFrom(source io.Reader) (int64, error) {
 			return written, err
 		}
 	}
+	w.waitDelay()
 	n, err := w.rf.ReadFrom(source)
 	written += n
 	w.advance(n)
@@ -122,12 +159,29 @@ func (w *splitWriter) advance(n int64) {
 	}
 	// Split done, set up the next split.
 	w.nextSplitBytes = w.nextSegmentLength()
+	w.delayPending = true
+}
+
+// waitDelay waits for the configured delay if a split happened since the last write.
+func (w *splitWriter) waitDelay() {
+	if !w.delayPending {
+		return
+	}
+	w.delayPending = false
+	delay := w.delay
+	if w.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(2*w.jitter)+1)) - w.jitter
+	}
+	if delay > 0 {
+		w.sleep(delay)
+	}
 }
 
 // Write implements io.Writer.
 func (w *splitWriter) Write(data []byte) (written int, err error) {
 	for 0 < w.nextSplitBytes && w.nextSplitBytes < int64(len(data)) {
 		dataToSend := data[:w.nextSplitBytes]
+		w.waitDelay()
 		n, err := w.writer.Write(dataToSend)
 		written += n
 		w.advance(int64(n))
@@ -136,8 +190,57 @@ func (w *splitWriter) Write(data []byte) (written int, err error) {
 		}
 		data = data[n:]
 	}
+	if len(data) > 0 {
+		w.waitDelay()
+	}
 	n, err := w.writer.Write(data)
 	written += n
 	w.advance(int64(n))
 	return written, err
 }
+
+// WriteBuffers implements [transport.BuffersWriter]. The buffers between split points are written together.
+func (w *splitWriter) WriteBuffers(buffers net.Buffers) (written int64, err error) {
+	for 0 < w.nextSplitBytes && w.nextSplitBytes < buffersLen(buffers) {
+		var segment net.Buffers
+		segment, buffers = cutBuffers(buffers, w.nextSplitBytes)
+		w.waitDelay()
+		n, err := transport.WriteBuffers(w.writer, segment)
+		written += n
+		w.advance(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	if buffersLen(buffers) > 0 {
+		w.waitDelay()
+	}
+	n, err := transport.WriteBuffers(w.writer, buffers)
+	written += n
+	w.advance(n)
+	return written, err
+}
+
+func buffersLen(buffers net.Buffers) int64 {
+	var n int64
+	for _, b := range buffers {
+		n += int64(len(b))
+	}
+	return n
+}
+
+// cutBuffers returns the first n bytes of the buffers in head, and the rest in tail, which reuses the buffers slice.
+func cutBuffers(buffers net.Buffers, n int64) (head, tail net.Buffers) {
+	for len(buffers) > 0 && n > 0 {
+		b := buffers[0]
+		if int64(len(b)) > n {
+			head = append(head, b[:n])
+			buffers[0] = b[n:]
+			return head, buffers
+		}
+		head = append(head, b)
+		n -= int64(len(b))
+		buffers = buffers[1:]
+	}
+	return head, buffers
+}
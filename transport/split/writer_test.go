@@ -17,7 +17,9 @@ package split
 import (
 	"bytes"
 	"io"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -36,6 +38,18 @@ func (w *collectWrites) Write(data []byte) (int, error) {
 	return len(data), nil
 }
 
+// collectBuffers is a [transport.BuffersWriter] that appends the concatenated buffers of each call to the writes slice.
+type collectBuffers struct {
+	collectWrites
+}
+
+func (w *collectBuffers) WriteBuffers(buffers net.Buffers) (int64, error) {
+	var data bytes.Buffer
+	n, err := buffers.WriteTo(&data)
+	w.writes = append(w.writes, data.Bytes())
+	return n, err
+}
+
 func TestWrite_Split(t *testing.T) {
 	var innerWriter collectWrites
 	splitWriter := NewWriter(&innerWriter, NewFixedSplitIterator(3))
@@ -45,6 +59,38 @@ func TestWrite_Split(t *testing.T) {
 	require.Equal(t, [][]byte{[]byte("Req"), []byte("uest")}, innerWriter.writes)
 }
 
+func TestWrite_Delay(t *testing.T) {
+	var innerWriter collectWrites
+	var sleeps []time.Duration
+	w := NewWriter(&innerWriter, NewRepeatedSplitIterator(RepeatedSplit{2, 2}), WithDelay(10*time.Millisecond, 0))
+	w.(*splitWriter).sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	n, err := w.Write([]byte("Request"))
+	require.NoError(t, err)
+	require.Equal(t, 7, n)
+	require.Equal(t, [][]byte{[]byte("Re"), []byte("qu"), []byte("est")}, innerWriter.writes)
+	// Delays are only between segments.
+	require.Equal(t, []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}, sleeps)
+
+	n, err = w.Write([]byte("Request"))
+	require.NoError(t, err)
+	require.Equal(t, 7, n)
+	require.Len(t, sleeps, 2)
+}
+
+func TestWrite_DelayJitter(t *testing.T) {
+	var innerWriter collectWrites
+	var sleeps []time.Duration
+	w := NewWriter(&innerWriter, NewRepeatedSplitIterator(RepeatedSplit{100, 1}), WithDelay(10*time.Millisecond, 5*time.Millisecond))
+	w.(*splitWriter).sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	_, err := w.Write(bytes.Repeat([]byte("a"), 101))
+	require.NoError(t, err)
+	require.Len(t, sleeps, 100)
+	for _, d := range sleeps {
+		require.GreaterOrEqual(t, d, 5*time.Millisecond)
+		require.LessOrEqual(t, d, 15*time.Millisecond)
+	}
+}
+
 func TestWrite_SplitZero(t *testing.T) {
 	var innerWriter collectWrites
 	splitWriter := NewWriter(&innerWriter, NewRepeatedSplitIterator(RepeatedSplit{1, 0}, RepeatedSplit{0, 1}, RepeatedSplit{10, 0}, RepeatedSplit{0, 2}))
@@ -145,6 +191,33 @@ func TestWrite_RepeatNumber3_SkipBytes0(t *testing.T) {
 }
 
 // collectReader is a [io.Reader] that appends each Read from the Reader to the reads slice.
+func TestWriteBuffers_Split(t *testing.T) {
+	var innerWriter collectBuffers
+	w := NewWriter(&innerWriter, NewRepeatedSplitIterator(RepeatedSplit{1, 2}, RepeatedSplit{1, 4}))
+	n, err := w.(*splitWriter).WriteBuffers(net.Buffers{[]byte("Req"), []byte("ue"), []byte("st"), []byte("Data")})
+	require.NoError(t, err)
+	require.Equal(t, int64(11), n)
+	require.Equal(t, [][]byte{[]byte("Re"), []byte("ques"), []byte("tData")}, innerWriter.writes)
+
+	// Done with splits, all buffers are written together.
+	n, err = w.(*splitWriter).WriteBuffers(net.Buffers{[]byte("Re"), []byte("quest")})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+	require.Equal(t, []byte("Request"), innerWriter.writes[3])
+}
+
+func TestWriteBuffers_Delay(t *testing.T) {
+	var innerWriter collectBuffers
+	var sleeps []time.Duration
+	w := NewWriter(&innerWriter, NewFixedSplitIterator(3), WithDelay(10*time.Millisecond, 0))
+	w.(*splitWriter).sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	n, err := w.(*splitWriter).WriteBuffers(net.Buffers{[]byte("Re"), []byte("quest")})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+	require.Equal(t, [][]byte{[]byte("Req"), []byte("uest")}, innerWriter.writes)
+	require.Equal(t, []time.Duration{10 * time.Millisecond}, sleeps)
+}
+
 type collectReader struct {
 	io.Reader
 	reads [][]byte
@@ -178,6 +251,19 @@ func TestReadFrom(t *testing.T) {
 	require.Equal(t, [][]byte{[]byte("Request2")}, cr.reads)
 }
 
+func TestReadFrom_Delay(t *testing.T) {
+	splitWriter := NewWriter(&bytes.Buffer{}, NewFixedSplitIterator(3), WithDelay(10*time.Millisecond, 0))
+	var sleeps []time.Duration
+	splitWriter.(*splitWriterReaderFrom).sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	rf, ok := splitWriter.(io.ReaderFrom)
+	require.True(t, ok)
+
+	n, err := rf.ReadFrom(bytes.NewReader([]byte("Request1")))
+	require.NoError(t, err)
+	require.Equal(t, int64(8), n)
+	require.Equal(t, []time.Duration{10 * time.Millisecond}, sleeps)
+}
+
 func TestReadFrom_Multi(t *testing.T) {
 	splitWriter := NewWriter(&bytes.Buffer{}, NewRepeatedSplitIterator(RepeatedSplit{1, 1}, RepeatedSplit{3, 2}, RepeatedSplit{2, 3}))
 	rf, ok := splitWriter.(io.ReaderFrom)
@@ -16,8 +16,10 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net"
+	"time"
 )
 
 // StreamConn is a [net.Conn] that allows for closing only the reader or writer end of it, supporting half-open state.
@@ -28,9 +30,18 @@ type StreamConn interface {
 	CloseRead() error
 	// Closes the Write end of the connection. An EOF or FIN signal can be
 	// sent to the connection target.
+	// Implementations that buffer writes must send the buffered data first, and then
+	// propagate the CloseWrite to the connection they wrap, so the target sees all the data
+	// followed by the EOF, even across chained dialers.
 	CloseWrite() error
 }
 
+// flusher is implemented by writers that may hold buffered data, like the Shadowsocks writer
+// that waits for the first payload before sending the connection request.
+type flusher interface {
+	Flush() error
+}
+
 type duplexConnAdaptor struct {
 	StreamConn
 	r io.Reader
@@ -38,6 +49,7 @@ type duplexConnAdaptor struct {
 }
 
 var _ StreamConn = (*duplexConnAdaptor)(nil)
+var _ BuffersWriter = (*duplexConnAdaptor)(nil)
 
 func (dc *duplexConnAdaptor) Read(b []byte) (int, error) {
 	return dc.r.Read(b)
@@ -58,17 +70,30 @@ func (dc *duplexConnAdaptor) ReadFrom(r io.Reader) (int64, error) {
 	}
 	return io.Copy(dc.w, r)
 }
+func (dc *duplexConnAdaptor) WriteBuffers(buffers net.Buffers) (int64, error) {
+	return WriteBuffers(dc.w, buffers)
+}
 func (dc *duplexConnAdaptor) CloseWrite() error {
-	return dc.StreamConn.CloseWrite()
+	var flushErr error
+	if f, ok := dc.w.(flusher); ok {
+		flushErr = f.Flush()
+	}
+	return errors.Join(flushErr, dc.StreamConn.CloseWrite())
 }
 
 // WrapConn wraps an existing [StreamConn] with a new [io.Reader] and [io.Writer], but preserves the original
 // [StreamConn].CloseRead and [StreamConn].CloseWrite.
+//
+// If w has a Flush() error method, CloseWrite calls it before closing the write end of c, so that data held
+// by w (for instance, a pending protocol header) is sent before the EOF.
 func WrapConn(c StreamConn, r io.Reader, w io.Writer) StreamConn {
 	conn := c
-	// We special-case duplexConnAdaptor to avoid multiple levels of nesting.
+	// We special-case duplexConnAdaptor to avoid multiple levels of nesting, unless its writer needs
+	// to be flushed on CloseWrite.
 	if a, ok := c.(*duplexConnAdaptor); ok {
-		conn = a.StreamConn
+		if _, ok := a.w.(flusher); !ok {
+			conn = a.StreamConn
+		}
 	}
 	return &duplexConnAdaptor{StreamConn: conn, r: r, w: w}
 }
@@ -85,19 +110,61 @@ type TCPEndpoint struct {
 	// The Dialer used to create the net.Conn on Connect().
 	Dialer net.Dialer
 	// The endpoint address (host:port) to pass to Dial.
-	// If the host is a domain name, consider pre-resolving it to avoid resolution calls.
+	// If the host is a domain name, consider pre-resolving it, or setting a Resolution policy with a cache, to
+	// avoid resolution calls.
 	Address string
+	// Resolution, if not nil, controls how the host name of the Address is resolved. See [ResolutionPolicy].
+	Resolution *ResolutionPolicy
+	// KeepAlive configures the keep-alive probes of the connections, like [TCPDialer.KeepAlive].
+	KeepAlive TCPKeepAliveConfig
+	// UserTimeout sets TCP_USER_TIMEOUT on the connections, like [TCPDialer.UserTimeout].
+	UserTimeout time.Duration
 }
 
 var _ StreamEndpoint = (*TCPEndpoint)(nil)
+var _ ConnectAndWriter = (*TCPEndpoint)(nil)
 
 // ConnectStream implements [StreamEndpoint].ConnectStream.
 func (e *TCPEndpoint) ConnectStream(ctx context.Context) (StreamConn, error) {
-	conn, err := e.Dialer.DialContext(ctx, "tcp", e.Address)
-	if err != nil {
-		return nil, err
+	dialer := e.Dialer
+	protectDialer(&dialer)
+	return connectResolved(ctx, e.Resolution, e.Address, func(ctx context.Context, address string) (StreamConn, error) {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		if err := setTCPOptions(conn.(*net.TCPConn), e.KeepAlive, e.UserTimeout); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn.(*net.TCPConn), nil
+	})
+}
+
+// ConnectAndWrite implements [ConnectAndWriter]. It uses TCP Fast Open where supported, like
+// [TCPDialer.DialAndWrite].
+func (e *TCPEndpoint) ConnectAndWrite(ctx context.Context, data []byte) (StreamConn, error) {
+	dialer := e.Dialer
+	protectDialer(&dialer)
+	if len(data) > 0 {
+		enableFastOpenConnect(&dialer)
 	}
-	return conn.(*net.TCPConn), nil
+	return connectResolved(ctx, e.Resolution, e.Address, func(ctx context.Context, address string) (StreamConn, error) {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		if err := setTCPOptions(conn.(*net.TCPConn), e.KeepAlive, e.UserTimeout); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// With TCP Fast Open, connection errors are only reported by the write.
+		if err := writeInitialData(ctx, conn, data); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn.(*net.TCPConn), nil
+	})
 }
 
 // FuncStreamEndpoint is a [StreamEndpoint] that uses the given function to connect.
@@ -118,12 +185,18 @@ type StreamDialerEndpoint struct {
 }
 
 var _ StreamEndpoint = (*StreamDialerEndpoint)(nil)
+var _ ConnectAndWriter = (*StreamDialerEndpoint)(nil)
 
 // ConnectStream implements [StreamEndpoint].ConnectStream.
 func (e *StreamDialerEndpoint) ConnectStream(ctx context.Context) (StreamConn, error) {
 	return e.Dialer.DialStream(ctx, e.Address)
 }
 
+// ConnectAndWrite implements [ConnectAndWriter] with [DialAndWrite] on the Dialer.
+func (e *StreamDialerEndpoint) ConnectAndWrite(ctx context.Context, data []byte) (StreamConn, error) {
+	return DialAndWrite(ctx, e.Dialer, e.Address, data)
+}
+
 // StreamDialer provides a way to dial a destination and establish stream connections.
 type StreamDialer interface {
 	// DialStream connects to `raddr`.
@@ -131,17 +204,163 @@ type StreamDialer interface {
 	DialStream(ctx context.Context, raddr string) (StreamConn, error)
 }
 
+// DialAndWriter is an optional interface implemented by a [StreamDialer] that can send the initial
+// payload of a connection together with its setup, where the protocol allows, saving a round trip.
+//
+// The TLS dialers don't implement it, since crypto/tls doesn't support sending early data.
+type DialAndWriter interface {
+	// DialAndWrite connects to `raddr` and writes `data` to the new connection.
+	// An error is returned if the data could not be written, in which case the connection is closed.
+	DialAndWrite(ctx context.Context, raddr string, data []byte) (StreamConn, error)
+}
+
+// DialAndWrite connects to `raddr` using the dialer and writes `data` to the connection. It uses the
+// dialer's fast path if it implements [DialAndWriter], and otherwise writes the data after [StreamDialer].DialStream.
+func DialAndWrite(ctx context.Context, dialer StreamDialer, raddr string, data []byte) (StreamConn, error) {
+	if dw, ok := dialer.(DialAndWriter); ok {
+		return dw.DialAndWrite(ctx, raddr, data)
+	}
+	conn, err := dialer.DialStream(ctx, raddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeInitialData(ctx, conn, data); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ConnectAndWriter is an optional interface implemented by a [StreamEndpoint] that can send the initial payload
+// of a connection together with its setup, like [DialAndWriter] for dialers. Proxy dialers use it to send their
+// first write to the proxy in the connection setup.
+type ConnectAndWriter interface {
+	// ConnectAndWrite connects to the endpoint and writes `data` to the new connection.
+	// An error is returned if the data could not be written, in which case the connection is closed.
+	ConnectAndWrite(ctx context.Context, data []byte) (StreamConn, error)
+}
+
+// ConnectAndWrite connects to the endpoint and writes `data` to the connection. It uses the endpoint's fast path
+// if it implements [ConnectAndWriter], and otherwise writes the data after [StreamEndpoint].ConnectStream.
+func ConnectAndWrite(ctx context.Context, endpoint StreamEndpoint, data []byte) (StreamConn, error) {
+	if cw, ok := endpoint.(ConnectAndWriter); ok {
+		return cw.ConnectAndWrite(ctx, data)
+	}
+	conn, err := endpoint.ConnectStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeInitialData(ctx, conn, data); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// writeInitialData writes data to conn, honoring the context deadline.
+func writeInitialData(ctx context.Context, conn net.Conn, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	_, err := conn.Write(data)
+	return err
+}
+
 // TCPDialer is a [StreamDialer] that uses the standard [net.Dialer] to dial.
 // It provides a convenient way to use a [net.Dialer] when you need a [StreamDialer].
 type TCPDialer struct {
 	Dialer net.Dialer
+	// KeepAlive configures the keep-alive probes of the dialed connections, so that dead peers are detected
+	// faster than with the system defaults. Zero fields keep the behavior of Dialer.
+	KeepAlive TCPKeepAliveConfig
+	// UserTimeout is the maximum time that sent data may remain unacknowledged before the connection is
+	// closed (TCP_USER_TIMEOUT). Zero uses the system default. It's only supported on Linux, and ignored
+	// elsewhere.
+	UserTimeout time.Duration
+}
+
+// TCPKeepAliveConfig configures the TCP keep-alive probes.
+type TCPKeepAliveConfig struct {
+	// Idle is the time the connection must be idle before the first probe is sent.
+	// If zero, Dialer.KeepAlive is used.
+	Idle time.Duration
+	// Interval is the time between probes. If zero, the system default is used, unless Idle is set,
+	// in which case it also sets the interval. It's only supported on Linux and Darwin.
+	Interval time.Duration
+	// Count is the number of unacknowledged probes before the connection is closed. If zero, the
+	// system default is used. It's only supported on Linux and Darwin.
+	Count int
 }
 
 var _ StreamDialer = (*TCPDialer)(nil)
+var _ DialAndWriter = (*TCPDialer)(nil)
+var _ CapabilityReporter = (*TCPDialer)(nil)
+
+// Capabilities implements [CapabilityReporter].
+func (d *TCPDialer) Capabilities() Capability {
+	return CapabilityStream | CapabilityIPv6 | CapabilityZeroRTT
+}
 
 func (d *TCPDialer) DialStream(ctx context.Context, addr string) (StreamConn, error) {
-	conn, err := d.Dialer.DialContext(ctx, "tcp", addr)
+	dialer := d.Dialer
+	protectDialer(&dialer)
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := setTCPOptions(conn.(*net.TCPConn), d.KeepAlive, d.UserTimeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+// setTCPOptions applies the keep-alive and user timeout settings to the connection.
+func setTCPOptions(conn *net.TCPConn, keepAlive TCPKeepAliveConfig, userTimeout time.Duration) error {
+	if keepAlive.Idle > 0 {
+		if err := conn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		// On some platforms, this also sets the interval, so it must come before it.
+		if err := conn.SetKeepAlivePeriod(keepAlive.Idle); err != nil {
+			return err
+		}
+	}
+	if keepAlive.Interval <= 0 && keepAlive.Count <= 0 && userTimeout <= 0 {
+		return nil
+	}
+	rawConn, err := conn.SyscallConn()
 	if err != nil {
+		return err
+	}
+	return setRawTCPOptions(rawConn, keepAlive.Interval, keepAlive.Count, userTimeout)
+}
+
+// DialAndWrite implements [DialAndWriter]. Where supported (currently Linux), it uses TCP Fast Open, so
+// the data can be sent in the SYN packet if the server supports it. Otherwise it writes the data once connected.
+//
+// With TCP Fast Open, connection errors are only reported when writing the data, which is why it's not used
+// by [TCPDialer.DialStream].
+func (d *TCPDialer) DialAndWrite(ctx context.Context, addr string, data []byte) (StreamConn, error) {
+	dialer := d.Dialer
+	protectDialer(&dialer)
+	if len(data) > 0 {
+		enableFastOpenConnect(&dialer)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := setTCPOptions(conn.(*net.TCPConn), d.KeepAlive, d.UserTimeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := writeInitialData(ctx, conn, data); err != nil {
+		conn.Close()
 		return nil, err
 	}
 	return conn.(*net.TCPConn), nil
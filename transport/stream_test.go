@@ -158,6 +158,135 @@ func TestDialStreamEndpointAddr(t *testing.T) {
 	require.Nil(t, conn.Close())
 }
 
+func TestTCPDialer_DialAndWrite(t *testing.T) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	var running sync.WaitGroup
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		clientConn, err := listener.AcceptTCP()
+		require.NoError(t, err)
+		defer clientConn.Close()
+		assert.NoError(t, iotest.TestReader(clientConn, []byte("Request")))
+	}()
+
+	controlCalled := false
+	dialer := &TCPDialer{}
+	dialer.Dialer.Control = func(network, address string, c syscall.RawConn) error {
+		controlCalled = true
+		return nil
+	}
+	conn, err := dialer.DialAndWrite(context.Background(), listener.Addr().String(), []byte("Request"))
+	require.NoError(t, err)
+	require.True(t, controlCalled)
+	require.NoError(t, conn.CloseWrite())
+	running.Wait()
+	require.NoError(t, conn.Close())
+}
+
+func TestDialAndWrite_Fallback(t *testing.T) {
+	var written bytes.Buffer
+	dialer := FuncStreamDialer(func(ctx context.Context, addr string) (StreamConn, error) {
+		require.Equal(t, "example.com:443", addr)
+		return WrapConn(&fakeConn{}, nil, &written), nil
+	})
+	conn, err := DialAndWrite(context.Background(), dialer, "example.com:443", []byte("Request"))
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	require.Equal(t, "Request", written.String())
+}
+
+func TestDialAndWrite_WriteError(t *testing.T) {
+	closed := false
+	dialer := FuncStreamDialer(func(ctx context.Context, addr string) (StreamConn, error) {
+		return &closeTrackingConn{closed: &closed}, nil
+	})
+	_, err := DialAndWrite(context.Background(), dialer, "example.com:443", []byte("Request"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+	require.True(t, closed)
+}
+
+func TestTCPEndpoint_ConnectAndWrite(t *testing.T) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	var running sync.WaitGroup
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		clientConn, err := listener.AcceptTCP()
+		require.NoError(t, err)
+		defer clientConn.Close()
+		assert.NoError(t, iotest.TestReader(clientConn, []byte("Request")))
+	}()
+
+	conn, err := ConnectAndWrite(context.Background(), &TCPEndpoint{Address: listener.Addr().String()}, []byte("Request"))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	running.Wait()
+	require.NoError(t, conn.Close())
+}
+
+func TestConnectAndWrite_DialerEndpoint(t *testing.T) {
+	var written []byte
+	dialer := &dialAndWriteRecorder{written: &written}
+	conn, err := ConnectAndWrite(context.Background(), &StreamDialerEndpoint{Dialer: dialer, Address: "example.com:443"}, []byte("Request"))
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	require.Equal(t, "Request", string(written))
+}
+
+func TestConnectAndWrite_Fallback(t *testing.T) {
+	var written bytes.Buffer
+	endpoint := FuncStreamEndpoint(func(ctx context.Context) (StreamConn, error) {
+		return WrapConn(&fakeConn{}, nil, &written), nil
+	})
+	conn, err := ConnectAndWrite(context.Background(), endpoint, []byte("Request"))
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	require.Equal(t, "Request", written.String())
+
+	closed := false
+	endpoint = FuncStreamEndpoint(func(ctx context.Context) (StreamConn, error) {
+		return &closeTrackingConn{closed: &closed}, nil
+	})
+	_, err = ConnectAndWrite(context.Background(), endpoint, []byte("Request"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+	require.True(t, closed)
+}
+
+// dialAndWriteRecorder is a [DialAndWriter] that records the data of DialAndWrite.
+type dialAndWriteRecorder struct {
+	written *[]byte
+}
+
+func (d *dialAndWriteRecorder) DialStream(ctx context.Context, addr string) (StreamConn, error) {
+	return nil, errors.New("not expected")
+}
+
+func (d *dialAndWriteRecorder) DialAndWrite(ctx context.Context, addr string, data []byte) (StreamConn, error) {
+	*d.written = append([]byte(nil), data...)
+	return &fakeConn{}, nil
+}
+
+type closeTrackingConn struct {
+	fakeConn
+	closed *bool
+}
+
+func (c *closeTrackingConn) Write(b []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func (c *closeTrackingConn) Close() error {
+	*c.closed = true
+	return nil
+}
+
 type countWriter struct {
 	writeCalls, readFromCalls int
 }
@@ -185,3 +314,72 @@ func Test_duplexConnAdaptor_PreferReadFrom(t *testing.T) {
 	require.Equal(t, 0, w.writeCalls)
 	require.Equal(t, int64(0), n)
 }
+
+// eventLog records the order of calls across the wrapped connection and writers.
+type eventLog []string
+
+type closeWriteConn struct {
+	fakeConn
+	log *eventLog
+}
+
+func (c *closeWriteConn) CloseWrite() error {
+	*c.log = append(*c.log, "CloseWrite")
+	return nil
+}
+
+type bufferedWriter struct {
+	name string
+	base io.Writer
+	buf  []byte
+	log  *eventLog
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
+
+func (w *bufferedWriter) Flush() error {
+	*w.log = append(*w.log, "Flush "+w.name+": "+string(w.buf))
+	if w.base != nil {
+		if _, err := w.base.Write(w.buf); err != nil {
+			return err
+		}
+	}
+	w.buf = nil
+	return nil
+}
+
+func Test_duplexConnAdaptor_CloseWriteFlushes(t *testing.T) {
+	var log eventLog
+	conn := WrapConn(&closeWriteConn{log: &log}, nil, &bufferedWriter{name: "w", log: &log})
+	_, err := conn.Write([]byte("header"))
+	require.NoError(t, err)
+	require.Empty(t, log)
+
+	require.NoError(t, conn.CloseWrite())
+	require.Equal(t, eventLog{"Flush w: header", "CloseWrite"}, log)
+}
+
+func Test_duplexConnAdaptor_CloseWriteFlushesNested(t *testing.T) {
+	var log eventLog
+	inner := WrapConn(&closeWriteConn{log: &log}, nil, &bufferedWriter{name: "inner", log: &log})
+	outer := WrapConn(inner, nil, &bufferedWriter{name: "outer", base: inner, log: &log})
+	_, err := outer.Write([]byte("data"))
+	require.NoError(t, err)
+
+	require.NoError(t, outer.CloseWrite())
+	require.Equal(t, eventLog{"Flush outer: data", "Flush inner: data", "CloseWrite"}, log)
+}
+
+func Test_duplexConnAdaptor_CloseWriteFlushError(t *testing.T) {
+	var log eventLog
+	conn := WrapConn(&closeWriteConn{log: &log}, nil, &bufferedWriter{name: "w", base: &closeTrackingConn{closed: new(bool)}, log: &log})
+	_, err := conn.Write([]byte("data"))
+	require.NoError(t, err)
+
+	// The write end is still closed if the flush fails.
+	require.ErrorIs(t, conn.CloseWrite(), io.ErrClosedPipe)
+	require.Equal(t, eventLog{"Flush w: data", "CloseWrite"}, log)
+}
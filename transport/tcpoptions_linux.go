@@ -0,0 +1,45 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"syscall"
+	"time"
+)
+
+const tcpUserTimeout = 18
+
+func setRawTCPOptions(c syscall.RawConn, interval time.Duration, count int, userTimeout time.Duration) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if interval > 0 {
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, roundSeconds(interval)); sockErr != nil {
+				return
+			}
+		}
+		if count > 0 {
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, count); sockErr != nil {
+				return
+			}
+		}
+		if userTimeout > 0 {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeout, int(userTimeout.Milliseconds()))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,93 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getTCPOption(t *testing.T, conn StreamConn, opt int) int {
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err)
+	var value int
+	var sockErr error
+	require.NoError(t, rawConn.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, opt)
+	}))
+	require.NoError(t, sockErr)
+	return value
+}
+
+func TestTCPDialer_Options(t *testing.T) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	dialer := &TCPDialer{
+		KeepAlive:   TCPKeepAliveConfig{Idle: 10 * time.Second, Interval: 1500 * time.Millisecond, Count: 3},
+		UserTimeout: 20 * time.Second,
+	}
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Equal(t, 10, getTCPOption(t, conn, syscall.TCP_KEEPIDLE))
+	require.Equal(t, 2, getTCPOption(t, conn, syscall.TCP_KEEPINTVL))
+	require.Equal(t, 3, getTCPOption(t, conn, syscall.TCP_KEEPCNT))
+	require.Equal(t, 20000, getTCPOption(t, conn, tcpUserTimeout))
+}
+
+func TestTCPDialer_DialAndWriteOptions(t *testing.T) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	dialer := &TCPDialer{UserTimeout: 5 * time.Second}
+	conn, err := dialer.DialAndWrite(context.Background(), listener.Addr().String(), []byte("Request"))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Equal(t, 5000, getTCPOption(t, conn, tcpUserTimeout))
+}
+
+func TestTCPEndpoint_Options(t *testing.T) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	endpoint := &TCPEndpoint{
+		Address:     listener.Addr().String(),
+		KeepAlive:   TCPKeepAliveConfig{Idle: 15 * time.Second, Interval: 5 * time.Second, Count: 4},
+		UserTimeout: 30 * time.Second,
+	}
+	conn, err := endpoint.ConnectStream(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, 15, getTCPOption(t, conn, syscall.TCP_KEEPIDLE))
+	require.Equal(t, 5, getTCPOption(t, conn, syscall.TCP_KEEPINTVL))
+	require.Equal(t, 4, getTCPOption(t, conn, syscall.TCP_KEEPCNT))
+	require.Equal(t, 30000, getTCPOption(t, conn, tcpUserTimeout))
+
+	conn, err = endpoint.ConnectAndWrite(context.Background(), []byte("Request"))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, 30000, getTCPOption(t, conn, tcpUserTimeout))
+}
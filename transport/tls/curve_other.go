@@ -0,0 +1,24 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !go1.25
+
+package tls
+
+import "crypto/tls"
+
+// negotiatedCurve returns false, since [tls.ConnectionState] only reports the key exchange starting with Go 1.25.
+func negotiatedCurve(state tls.ConnectionState) (tls.CurveID, bool) {
+	return 0, false
+}
@@ -0,0 +1,458 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// TLS extension types used in fingerprints, from the [IANA TLS ExtensionType Values registry].
+//
+// [IANA TLS ExtensionType Values registry]: https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml#tls-extensiontype-values-1
+const (
+	extensionServerName          uint16 = 0
+	extensionSupportedGroups     uint16 = 10
+	extensionPointFormats        uint16 = 11
+	extensionSignatureAlgorithms uint16 = 13
+	extensionALPN                uint16 = 16
+	extensionSupportedVersions   uint16 = 43
+)
+
+const (
+	recordTypeHandshake      = 22
+	handshakeTypeClientHello = 1
+)
+
+// ClientHello has the fields of a TLS Client Hello that are relevant for fingerprinting.
+// Use [ParseClientHello] or [CaptureClientHello] to get one.
+type ClientHello struct {
+	// Version is the legacy_version field. TLS 1.3 uses SupportedVersions instead.
+	Version             uint16
+	CipherSuites        []uint16
+	Extensions          []uint16
+	ServerName          string
+	SupportedGroups     []uint16
+	PointFormats        []uint8
+	SignatureAlgorithms []uint16
+	ALPN                []string
+	SupportedVersions   []uint16
+}
+
+// isGREASE reports whether v is a [GREASE] value, which are ignored in fingerprints.
+//
+// [GREASE]: https://datatracker.ietf.org/doc/html/rfc8701
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// isPostQuantumGroup reports whether the group is a post-quantum key exchange.
+func isPostQuantumGroup(group uint16) bool {
+	switch group {
+	// Pure ML-KEM groups.
+	case 0x0200, 0x0201, 0x0202:
+		return true
+	}
+	return isPostQuantumCurve(group)
+}
+
+// ParseClientHello parses the TLS records with a Client Hello, as sent by a client at the start of a connection.
+// The Client Hello may be fragmented across multiple records.
+func ParseClientHello(records []byte) (*ClientHello, error) {
+	var handshake []byte
+	input := cryptobyte.String(records)
+	for {
+		var recordType uint8
+		var version uint16
+		var fragment cryptobyte.String
+		if input.Empty() {
+			return nil, fmt.Errorf("incomplete Client Hello: %w", io.ErrUnexpectedEOF)
+		}
+		if !input.ReadUint8(&recordType) || !input.ReadUint16(&version) || !input.ReadUint16LengthPrefixed(&fragment) {
+			return nil, fmt.Errorf("incomplete TLS record: %w", io.ErrUnexpectedEOF)
+		}
+		if recordType != recordTypeHandshake {
+			return nil, fmt.Errorf("unexpected TLS record type %v", recordType)
+		}
+		handshake = append(handshake, fragment...)
+		if len(handshake) >= 4 {
+			msgLen := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+			if len(handshake) >= 4+msgLen {
+				return parseClientHelloMessage(handshake[:4+msgLen])
+			}
+		}
+	}
+}
+
+func parseClientHelloMessage(msg cryptobyte.String) (*ClientHello, error) {
+	var msgType uint8
+	var body cryptobyte.String
+	if !msg.ReadUint8(&msgType) || !msg.ReadUint24LengthPrefixed(&body) {
+		return nil, errors.New("invalid handshake message")
+	}
+	if msgType != handshakeTypeClientHello {
+		return nil, fmt.Errorf("unexpected handshake message type %v", msgType)
+	}
+	hello := &ClientHello{}
+	var sessionID, cipherSuites, compression cryptobyte.String
+	if !body.ReadUint16(&hello.Version) || !body.Skip(32) || !body.ReadUint8LengthPrefixed(&sessionID) ||
+		!body.ReadUint16LengthPrefixed(&cipherSuites) || !body.ReadUint8LengthPrefixed(&compression) {
+		return nil, errors.New("invalid Client Hello")
+	}
+	for !cipherSuites.Empty() {
+		var suite uint16
+		if !cipherSuites.ReadUint16(&suite) {
+			return nil, errors.New("invalid cipher suites")
+		}
+		hello.CipherSuites = append(hello.CipherSuites, suite)
+	}
+	if body.Empty() {
+		// No extensions.
+		return hello, nil
+	}
+	var extensions cryptobyte.String
+	if !body.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errors.New("invalid extensions")
+	}
+	for !extensions.Empty() {
+		var extType uint16
+		var extData cryptobyte.String
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&extData) {
+			return nil, errors.New("invalid extension")
+		}
+		hello.Extensions = append(hello.Extensions, extType)
+		if err := hello.parseExtension(extType, extData); err != nil {
+			return nil, fmt.Errorf("invalid extension %v: %w", extType, err)
+		}
+	}
+	return hello, nil
+}
+
+func (h *ClientHello) parseExtension(extType uint16, data cryptobyte.String) error {
+	switch extType {
+	case extensionServerName:
+		var names cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&names) {
+			return errors.New("invalid server name list")
+		}
+		for !names.Empty() {
+			var nameType uint8
+			var name cryptobyte.String
+			if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+				return errors.New("invalid server name")
+			}
+			if nameType == 0 {
+				h.ServerName = string(name)
+			}
+		}
+	case extensionSupportedGroups:
+		return readUint16List(&data, &h.SupportedGroups)
+	case extensionPointFormats:
+		var formats cryptobyte.String
+		if !data.ReadUint8LengthPrefixed(&formats) {
+			return errors.New("invalid point formats")
+		}
+		h.PointFormats = append([]uint8(nil), formats...)
+	case extensionSignatureAlgorithms:
+		return readUint16List(&data, &h.SignatureAlgorithms)
+	case extensionALPN:
+		var protocols cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&protocols) {
+			return errors.New("invalid protocol list")
+		}
+		for !protocols.Empty() {
+			var protocol cryptobyte.String
+			if !protocols.ReadUint8LengthPrefixed(&protocol) {
+				return errors.New("invalid protocol")
+			}
+			h.ALPN = append(h.ALPN, string(protocol))
+		}
+	case extensionSupportedVersions:
+		var versions cryptobyte.String
+		if !data.ReadUint8LengthPrefixed(&versions) {
+			return errors.New("invalid supported versions")
+		}
+		for !versions.Empty() {
+			var version uint16
+			if !versions.ReadUint16(&version) {
+				return errors.New("invalid supported version")
+			}
+			h.SupportedVersions = append(h.SupportedVersions, version)
+		}
+	}
+	return nil
+}
+
+func readUint16List(data *cryptobyte.String, list *[]uint16) error {
+	var values cryptobyte.String
+	if !data.ReadUint16LengthPrefixed(&values) {
+		return errors.New("invalid list")
+	}
+	for !values.Empty() {
+		var v uint16
+		if !values.ReadUint16(&v) {
+			return errors.New("invalid list value")
+		}
+		*list = append(*list, v)
+	}
+	return nil
+}
+
+// WithoutPostQuantum returns a copy of the Client Hello without the post-quantum key exchanges in the supported groups.
+// They depend on the Go version and settings, so removing them allows for matching fingerprints regardless of them.
+func (h *ClientHello) WithoutPostQuantum() *ClientHello {
+	result := *h
+	result.SupportedGroups = nil
+	for _, group := range h.SupportedGroups {
+		if !isPostQuantumGroup(group) {
+			result.SupportedGroups = append(result.SupportedGroups, group)
+		}
+	}
+	return &result
+}
+
+// JA3String returns the [JA3] fingerprint string, before hashing.
+//
+// [JA3]: https://github.com/salesforce/ja3
+func (h *ClientHello) JA3String() string {
+	formats := make([]uint16, len(h.PointFormats))
+	for i, f := range h.PointFormats {
+		formats[i] = uint16(f)
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(h.Version)),
+		joinValues(h.CipherSuites, "-", strconv.Itoa),
+		joinValues(h.Extensions, "-", strconv.Itoa),
+		joinValues(h.SupportedGroups, "-", strconv.Itoa),
+		joinValues(formats, "-", strconv.Itoa),
+	}, ",")
+}
+
+// JA3 returns the [JA3] fingerprint, the MD5 hash of [ClientHello.JA3String] in hex.
+//
+// [JA3]: https://github.com/salesforce/ja3
+func (h *ClientHello) JA3() string {
+	hash := md5.Sum([]byte(h.JA3String()))
+	return hex.EncodeToString(hash[:])
+}
+
+// JA4 returns the [JA4] fingerprint of the Client Hello, assuming it's sent over TCP.
+// Unlike JA3, it's not affected by the extension order randomization done by browsers.
+//
+// [JA4]: https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4.md
+func (h *ClientHello) JA4() string {
+	version := h.Version
+	for _, v := range h.SupportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+	sni := "i"
+	extensions := make([]uint16, 0, len(h.Extensions))
+	for _, ext := range h.Extensions {
+		if isGREASE(ext) {
+			continue
+		}
+		if ext == extensionServerName {
+			sni = "d"
+		}
+		extensions = append(extensions, ext)
+	}
+	ciphers := make([]uint16, 0, len(h.CipherSuites))
+	for _, c := range h.CipherSuites {
+		if !isGREASE(c) {
+			ciphers = append(ciphers, c)
+		}
+	}
+	ja4a := fmt.Sprintf("t%s%s%02d%02d%s", ja4Version(version), sni, min99(len(ciphers)), min99(len(extensions)), ja4ALPN(h.ALPN))
+
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
+	ja4b := ja4Hash(joinValues(ciphers, ",", hex4))
+
+	sortedExtensions := make([]uint16, 0, len(extensions))
+	for _, ext := range extensions {
+		if ext != extensionServerName && ext != extensionALPN {
+			sortedExtensions = append(sortedExtensions, ext)
+		}
+	}
+	sort.Slice(sortedExtensions, func(i, j int) bool { return sortedExtensions[i] < sortedExtensions[j] })
+	ja4c := joinValues(sortedExtensions, ",", hex4)
+	if len(h.SignatureAlgorithms) > 0 {
+		ja4c += "_" + joinValues(h.SignatureAlgorithms, ",", hex4)
+	}
+	return ja4a + "_" + ja4b + "_" + ja4Hash(ja4c)
+}
+
+// joinValues formats the values that are not GREASE and joins them with sep.
+func joinValues(values []uint16, sep string, format func(int) string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if isGREASE(v) {
+			continue
+		}
+		parts = append(parts, format(int(v)))
+	}
+	return strings.Join(parts, sep)
+}
+
+func hex4(v int) string {
+	return fmt.Sprintf("%04x", v)
+}
+
+func min99(n int) int {
+	if n > 99 {
+		return 99
+	}
+	return n
+}
+
+func ja4Version(version uint16) string {
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	default:
+		return "00"
+	}
+}
+
+func ja4ALPN(protocols []string) string {
+	if len(protocols) == 0 || protocols[0] == "" {
+		return "00"
+	}
+	p := protocols[0]
+	first, last := p[0], p[len(p)-1]
+	if !isAlphanumeric(first) || !isAlphanumeric(last) {
+		h := hex.EncodeToString([]byte(p))
+		return h[:1] + h[len(h)-1:]
+	}
+	return string([]byte{first, last})
+}
+
+func isAlphanumeric(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// ja4Hash returns the first 12 hex characters of the SHA-256 hash of s, or zeros if s is empty.
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])[:12]
+}
+
+// FingerprintProfile is the expected fingerprint of a target client, like a browser.
+// Empty fields are not compared.
+type FingerprintProfile struct {
+	Name string
+	// JA3 is the JA3 hash. Compute it without post-quantum key exchanges, since JA3 includes the supported groups.
+	JA3 string
+	JA4 string
+}
+
+// MatchProfile returns the first profile that matches the Client Hello fingerprints. The JA3 fingerprint is compared
+// without the post-quantum key exchanges, so that the result doesn't depend on whether they are enabled.
+func (h *ClientHello) MatchProfile(profiles []FingerprintProfile) (FingerprintProfile, bool) {
+	ja3 := h.WithoutPostQuantum().JA3()
+	ja4 := h.JA4()
+	for _, profile := range profiles {
+		if profile.JA3 == "" && profile.JA4 == "" {
+			continue
+		}
+		if (profile.JA3 == "" || profile.JA3 == ja3) && (profile.JA4 == "" || profile.JA4 == ja4) {
+			return profile, true
+		}
+	}
+	return FingerprintProfile{}, false
+}
+
+// CaptureClientHello returns the Client Hello that a dialer sends when connecting to address, without actually
+// connecting to it. The dialer is created by newDialer on top of the given base dialer, which records the bytes
+// written to it and fails the handshake.
+//
+// Only the layers that run on top of TLS should be added by newDialer. For example, use it to verify that
+// the [StreamDialer] options, or a third-party TLS library, produce the intended fingerprint.
+func CaptureClientHello(ctx context.Context, newDialer func(base transport.StreamDialer) (transport.StreamDialer, error), address string) (*ClientHello, error) {
+	capture := &captureConn{}
+	base := transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		return capture, nil
+	})
+	dialer, err := newDialer(base)
+	if err != nil {
+		return nil, err
+	}
+	conn, dialErr := dialer.DialStream(ctx, address)
+	if dialErr == nil {
+		conn.Close()
+	}
+	hello, err := ParseClientHello(capture.Bytes())
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to capture Client Hello: %w", err), dialErr)
+	}
+	return hello, nil
+}
+
+// captureConn is a [transport.StreamConn] that records the written data, and has nothing to read.
+type captureConn struct {
+	mu      sync.Mutex
+	written []byte
+}
+
+var _ transport.StreamConn = (*captureConn)(nil)
+
+func (c *captureConn) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.written
+}
+
+func (c *captureConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, b...)
+	return len(b), nil
+}
+
+func (c *captureConn) Read(b []byte) (int, error)         { return 0, io.EOF }
+func (c *captureConn) Close() error                       { return nil }
+func (c *captureConn) CloseRead() error                   { return nil }
+func (c *captureConn) CloseWrite() error                  { return nil }
+func (c *captureConn) LocalAddr() net.Addr                { return nil }
+func (c *captureConn) RemoteAddr() net.Addr               { return nil }
+func (c *captureConn) SetDeadline(t time.Time) error      { return nil }
+func (c *captureConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *captureConn) SetWriteDeadline(t time.Time) error { return nil }
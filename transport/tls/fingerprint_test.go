@@ -0,0 +1,226 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/tlsfrag"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// makeTestClientHello returns a Client Hello record with GREASE values and a post-quantum group.
+func makeTestClientHello(t *testing.T) []byte {
+	var b cryptobyte.Builder
+	b.AddUint8(recordTypeHandshake)
+	b.AddUint16(0x0301)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(handshakeTypeClientHello)
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(0x0303)
+			b.AddBytes(make([]byte, 32))
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {})
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint16(0x0a0a)
+				b.AddUint16(0x1302)
+				b.AddUint16(0x1301)
+			})
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint8(0) })
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				addExtension := func(extType uint16, data func(b *cryptobyte.Builder)) {
+					b.AddUint16(extType)
+					b.AddUint16LengthPrefixed(data)
+				}
+				addExtension(0x1a1a, func(b *cryptobyte.Builder) {})
+				addExtension(extensionServerName, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8(0)
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte("example.com")) })
+					})
+				})
+				addExtension(extensionSupportedVersions, func(b *cryptobyte.Builder) {
+					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint16(0x2a2a)
+						b.AddUint16(0x0304)
+						b.AddUint16(0x0303)
+					})
+				})
+				addExtension(extensionSupportedGroups, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint16(0x3a3a)
+						b.AddUint16(uint16(x25519MLKEM768))
+						b.AddUint16(0x001d)
+					})
+				})
+				addExtension(extensionPointFormats, func(b *cryptobyte.Builder) {
+					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint8(0) })
+				})
+				addExtension(extensionALPN, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte("h2")) })
+						b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte("http/1.1")) })
+					})
+				})
+				addExtension(extensionSignatureAlgorithms, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint16(0x0804)
+						b.AddUint16(0x0403)
+					})
+				})
+			})
+		})
+	})
+	record, err := b.Bytes()
+	require.NoError(t, err)
+	return record
+}
+
+func sha256Prefix(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])[:12]
+}
+
+func TestParseClientHello(t *testing.T) {
+	hello, err := ParseClientHello(makeTestClientHello(t))
+	require.NoError(t, err)
+	require.Equal(t, &ClientHello{
+		Version:             0x0303,
+		CipherSuites:        []uint16{0x0a0a, 0x1302, 0x1301},
+		Extensions:          []uint16{0x1a1a, 0, 43, 10, 11, 16, 13},
+		ServerName:          "example.com",
+		SupportedGroups:     []uint16{0x3a3a, uint16(x25519MLKEM768), 0x001d},
+		PointFormats:        []uint8{0},
+		SignatureAlgorithms: []uint16{0x0804, 0x0403},
+		ALPN:                []string{"h2", "http/1.1"},
+		SupportedVersions:   []uint16{0x2a2a, 0x0304, 0x0303},
+	}, hello)
+}
+
+func TestParseClientHello_Fragmented(t *testing.T) {
+	record := makeTestClientHello(t)
+	// Split the handshake message in two records.
+	split := 20
+	fragmented := append([]byte{recordTypeHandshake, 0x03, 0x01, 0, byte(split)}, record[5:5+split]...)
+	rest := record[5+split:]
+	fragmented = append(fragmented, recordTypeHandshake, 0x03, 0x01, byte(len(rest)>>8), byte(len(rest)))
+	fragmented = append(fragmented, rest...)
+
+	hello, err := ParseClientHello(fragmented)
+	require.NoError(t, err)
+	require.Equal(t, "example.com", hello.ServerName)
+
+	_, err = ParseClientHello(fragmented[:len(fragmented)-1])
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = ParseClientHello(record[:5+split])
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestParseClientHello_NotHandshake(t *testing.T) {
+	_, err := ParseClientHello([]byte{23, 0x03, 0x03, 0, 1, 0})
+	require.ErrorContains(t, err, "record type")
+}
+
+func TestClientHello_JA3(t *testing.T) {
+	hello, err := ParseClientHello(makeTestClientHello(t))
+	require.NoError(t, err)
+	require.Equal(t, "771,4866-4865,0-43-10-11-16-13,4588-29,0", hello.JA3String())
+	require.Equal(t, "771,4866-4865,0-43-10-11-16-13,29,0", hello.WithoutPostQuantum().JA3String())
+	require.Len(t, hello.JA3(), 32)
+	require.NotEqual(t, hello.JA3(), hello.WithoutPostQuantum().JA3())
+	// The original is not modified.
+	require.Len(t, hello.SupportedGroups, 3)
+}
+
+func TestClientHello_JA4(t *testing.T) {
+	hello, err := ParseClientHello(makeTestClientHello(t))
+	require.NoError(t, err)
+	expected := "t13d0206h2_" + sha256Prefix("1301,1302") + "_" + sha256Prefix("000a,000b,000d,002b_0804,0403")
+	require.Equal(t, expected, hello.JA4())
+	// Post-quantum groups don't affect JA4.
+	require.Equal(t, expected, hello.WithoutPostQuantum().JA4())
+
+	hello.ServerName = ""
+	hello.Extensions = []uint16{10}
+	hello.ALPN = nil
+	hello.SupportedVersions = nil
+	hello.SignatureAlgorithms = nil
+	require.Equal(t, "t12i020100_"+sha256Prefix("1301,1302")+"_"+sha256Prefix("000a"), hello.JA4())
+}
+
+func TestJA4ALPN(t *testing.T) {
+	require.Equal(t, "00", ja4ALPN(nil))
+	require.Equal(t, "h2", ja4ALPN([]string{"h2"}))
+	require.Equal(t, "h1", ja4ALPN([]string{"http/1.1"}))
+	require.Equal(t, "ab", ja4ALPN([]string{"\xab"}))
+}
+
+func TestClientHello_MatchProfile(t *testing.T) {
+	hello, err := ParseClientHello(makeTestClientHello(t))
+	require.NoError(t, err)
+	profiles := []FingerprintProfile{
+		{Name: "other", JA4: "t13d1516h2_8daaf6152771_000000000000"},
+		{Name: "target", JA3: hello.WithoutPostQuantum().JA3(), JA4: hello.JA4()},
+	}
+	profile, ok := hello.MatchProfile(profiles)
+	require.True(t, ok)
+	require.Equal(t, "target", profile.Name)
+
+	_, ok = hello.MatchProfile(profiles[:1])
+	require.False(t, ok)
+	_, ok = hello.MatchProfile([]FingerprintProfile{{Name: "empty"}})
+	require.False(t, ok)
+}
+
+func TestCaptureClientHello(t *testing.T) {
+	hello, err := CaptureClientHello(context.Background(), func(base transport.StreamDialer) (transport.StreamDialer, error) {
+		return NewStreamDialer(base, WithSNI("decoy.example.com"), WithALPN([]string{"h2", "http/1.1"}))
+	}, "example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, "decoy.example.com", hello.ServerName)
+	require.Equal(t, []string{"h2", "http/1.1"}, hello.ALPN)
+	require.Regexp(t, "^t13d[0-9]{4}h2_[0-9a-f]{12}_[0-9a-f]{12}$", hello.JA4())
+}
+
+func TestCaptureClientHello_Fragmented(t *testing.T) {
+	newDialer := func(base transport.StreamDialer) (transport.StreamDialer, error) {
+		return NewStreamDialer(base)
+	}
+	expected, err := CaptureClientHello(context.Background(), newDialer, "example.com:443")
+	require.NoError(t, err)
+
+	hello, err := CaptureClientHello(context.Background(), func(base transport.StreamDialer) (transport.StreamDialer, error) {
+		fragDialer, err := tlsfrag.NewFixedLenStreamDialer(base, 10)
+		if err != nil {
+			return nil, err
+		}
+		return newDialer(fragDialer)
+	}, "example.com:443")
+	require.NoError(t, err)
+	// Record fragmentation doesn't change the fingerprint.
+	require.Equal(t, expected.JA4(), hello.JA4())
+}
+
+func TestCaptureClientHello_NoTLS(t *testing.T) {
+	_, err := CaptureClientHello(context.Background(), func(base transport.StreamDialer) (transport.StreamDialer, error) {
+		return base, nil
+	}, "example.com:443")
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
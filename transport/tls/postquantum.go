@@ -0,0 +1,76 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// ErrPostQuantumUnsupported is returned by [NewStreamDialer] and [WrapConn] when [WithPostQuantum] enables the
+// post-quantum key exchange, but the program was built with a Go version older than 1.24, whose crypto/tls doesn't
+// support it.
+var ErrPostQuantumUnsupported = errors.New("post-quantum key exchange requires Go 1.24 or later")
+
+// Post-quantum hybrid key exchanges, from the [IANA TLS Supported Groups registry]. They are defined
+// here because the crypto/tls constants are not available in all supported Go versions.
+//
+// [IANA TLS Supported Groups registry]: https://www.iana.org/assignments/tls-parameters/tls-parameters.xhtml#tls-parameters-8
+const (
+	secP256r1MLKEM768     tls.CurveID = 0x11EB
+	x25519MLKEM768        tls.CurveID = 0x11EC
+	secP384r1MLKEM1024    tls.CurveID = 0x11ED
+	x25519Kyber768Draft00 tls.CurveID = 0x6399
+)
+
+// IsPostQuantum reports whether the TLS connection, as returned by [StreamDialer] or [WrapConn], negotiated a
+// post-quantum hybrid key exchange. It returns false if conn is not a TLS connection, or if the Go version
+// can't report the key exchange (it requires Go 1.25 or later).
+func IsPostQuantum(conn net.Conn) bool {
+	state, ok := ConnectionState(conn)
+	if !ok {
+		return false
+	}
+	curve, ok := negotiatedCurve(state)
+	if !ok {
+		return false
+	}
+	return isPostQuantumCurve(uint16(curve))
+}
+
+// checkCurvePreferences returns [ErrPostQuantumUnsupported] if the config enables the post-quantum key exchange
+// and the Go version doesn't support it, which would otherwise make every handshake fail.
+func checkCurvePreferences(cfg *ClientConfig) error {
+	if postQuantumSupported {
+		return nil
+	}
+	for _, curve := range cfg.CurvePreferences {
+		if isPostQuantumCurve(uint16(curve)) {
+			return ErrPostQuantumUnsupported
+		}
+	}
+	return nil
+}
+
+// isPostQuantumCurve reports whether the curve is one of the post-quantum hybrid key exchanges.
+func isPostQuantumCurve(curve uint16) bool {
+	switch tls.CurveID(curve) {
+	case secP256r1MLKEM768, x25519MLKEM768, secP384r1MLKEM1024, x25519Kyber768Draft00:
+		return true
+	default:
+		return false
+	}
+}
@@ -35,6 +35,13 @@ type StreamDialer struct {
 }
 
 var _ transport.StreamDialer = (*StreamDialer)(nil)
+var _ transport.CapabilityReporter = (*StreamDialer)(nil)
+
+// Capabilities implements [transport.CapabilityReporter]. It preserves the remote DNS and IPv6 support of
+// the base dialer.
+func (d *StreamDialer) Capabilities() transport.Capability {
+	return transport.CapabilityStream | transport.Capabilities(d.dialer)&(transport.CapabilityRemoteDNS|transport.CapabilityIPv6)
+}
 
 // NewStreamDialer creates a [StreamDialer] that wraps the connections from the baseDialer with TLS
 // configured with the given options.
@@ -42,6 +49,14 @@ func NewStreamDialer(baseDialer transport.StreamDialer, options ...ClientOption)
 	if baseDialer == nil {
 		return nil, errors.New("base dialer must not be nil")
 	}
+	// Report the options that can't work with this Go version now, rather than on every dial.
+	var cfg ClientConfig
+	for _, option := range options {
+		option("", &cfg)
+	}
+	if err := checkCurvePreferences(&cfg); err != nil {
+		return nil, err
+	}
 	return &StreamDialer{baseDialer, options}, nil
 }
 
@@ -62,6 +77,23 @@ func (c streamConn) CloseRead() error {
 	return c.innerConn.CloseRead()
 }
 
+// ConnectionState returns the state of a TLS connection returned by [StreamDialer] or [WrapConn], including the
+// protocol negotiated with ALPN. It returns false if conn is not a TLS connection.
+func ConnectionState(conn net.Conn) (tls.ConnectionState, bool) {
+	stateConn, ok := conn.(interface{ ConnectionState() tls.ConnectionState })
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return stateConn.ConnectionState(), true
+}
+
+// NegotiatedProtocol returns the application protocol negotiated with ALPN on a TLS connection returned by
+// [StreamDialer] or [WrapConn], or an empty string if none was negotiated. See [WithALPN].
+func NegotiatedProtocol(conn net.Conn) string {
+	state, _ := ConnectionState(conn)
+	return state.NegotiatedProtocol
+}
+
 // DialStream implements [transport.StreamDialer].DialStream.
 func (d *StreamDialer) DialStream(ctx context.Context, remoteAddr string) (transport.StreamConn, error) {
 	host, _, err := net.SplitHostPort(remoteAddr)
@@ -103,6 +135,10 @@ type ClientConfig struct {
 	// If nil, [StandardCertVerifier] is used by default, validating against the dialed
 	// server name. See [WithCertVerifier].
 	CertVerifier CertVerifier
+
+	// CurvePreferences lists the key exchange mechanisms in preference order.
+	// If nil, the Go defaults are used. See [WithPostQuantum].
+	CurvePreferences []tls.CurveID
 }
 
 // toStdConfig creates a [tls.Config] based on the configured parameters.
@@ -111,6 +147,7 @@ func (cfg *ClientConfig) toStdConfig() *tls.Config {
 		ServerName:         cfg.ServerName,
 		NextProtos:         cfg.NextProtos,
 		ClientSessionCache: cfg.SessionCache,
+		CurvePreferences:   cfg.CurvePreferences,
 		// Set InsecureSkipVerify to skip the default validation we are
 		// replacing. This will not disable VerifyConnection.
 		InsecureSkipVerify: true,
@@ -129,6 +166,9 @@ func WrapConn(ctx context.Context, conn transport.StreamConn, serverName string,
 	for _, option := range options {
 		option(normName, &cfg)
 	}
+	if err := checkCurvePreferences(&cfg); err != nil {
+		return nil, err
+	}
 	if cfg.CertVerifier == nil {
 		// If CertVerifier is not provided, use the default verification logic,
 		// which validates the peer certificate against the provided serverName.
@@ -137,7 +177,7 @@ func WrapConn(ctx context.Context, conn transport.StreamConn, serverName string,
 	tlsConn := tls.Client(conn, cfg.toStdConfig())
 	err := tlsConn.HandshakeContext(ctx)
 	if err != nil {
-		return nil, err
+		return nil, transport.NewHandshakeError(err, transport.ErrProxyHandshake)
 	}
 	return streamConn{tlsConn, conn}, nil
 }
@@ -182,6 +222,26 @@ func WithSessionCache(sessionCache tls.ClientSessionCache) ClientOption {
 	}
 }
 
+// WithPostQuantum enables or disables the post-quantum hybrid key exchange X25519MLKEM768.
+// Enabling it makes the handshake look like current browsers, and protects the connection against
+// future quantum computers. Disabling it avoids the larger Client Hello, which some middleboxes fail to handle.
+// If absent, the Go default is used, which depends on the Go version and the tlsmlkem [GODEBUG] setting.
+// Enabling requires building with Go 1.24 or later, since the module supports older Go versions. With older
+// versions, [NewStreamDialer] and [WrapConn] return [ErrPostQuantumUnsupported].
+//
+// Use [IsPostQuantum] to find out whether a connection negotiated it.
+//
+// [GODEBUG]: https://go.dev/doc/godebug
+func WithPostQuantum(enabled bool) ClientOption {
+	return func(_ string, config *ClientConfig) {
+		if enabled {
+			config.CurvePreferences = []tls.CurveID{x25519MLKEM768, tls.X25519, tls.CurveP256, tls.CurveP384}
+		} else {
+			config.CurvePreferences = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+		}
+	}
+}
+
 // WithCertVerifier sets the verifier to be used for the certificate verification.
 func WithCertVerifier(verifier CertVerifier) ClientOption {
 	return func(_ string, config *ClientConfig) {
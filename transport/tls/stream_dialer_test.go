@@ -19,8 +19,10 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"io"
 	"math/big"
 	"net"
 	"testing"
@@ -147,6 +149,124 @@ func TestWithALPN(t *testing.T) {
 	require.Equal(t, []string{"h2", "http/1.1"}, cfg.NextProtos)
 }
 
+func TestNegotiatedProtocol(t *testing.T) {
+	rootCA, rootKey := createRootCA(t)
+	leafCert, leafKey := createLeafCert(t, []string{"test.local"}, nil, rootCA, rootKey, time.Now().Add(-1*time.Hour), time.Now().Add(1*time.Hour))
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leafCert.Raw}, PrivateKey: leafKey}},
+		NextProtos:   []string{"h2", "http/1.1"},
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	rootPool := x509.NewCertPool()
+	rootPool.AddCert(rootCA)
+	verifier := WithCertVerifier(&StandardCertVerifier{CertificateName: "test.local", Roots: rootPool})
+	for _, tc := range []struct {
+		alpn     []string
+		expected string
+	}{
+		{[]string{"http/1.1", "h2"}, "h2"},
+		{[]string{"http/1.1"}, "http/1.1"},
+		{nil, ""},
+	} {
+		sd, err := NewStreamDialer(&transport.TCPDialer{}, verifier, WithALPN(tc.alpn))
+		require.NoError(t, err)
+		conn, err := sd.DialStream(context.Background(), listener.Addr().String())
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, NegotiatedProtocol(conn))
+		state, ok := ConnectionState(conn)
+		require.True(t, ok)
+		require.True(t, state.HandshakeComplete)
+		conn.Close()
+	}
+	_, ok := ConnectionState(nil)
+	require.False(t, ok)
+}
+
+func TestWithPostQuantum(t *testing.T) {
+	var cfg ClientConfig
+	WithPostQuantum(true)("", &cfg)
+	require.Equal(t, x25519MLKEM768, cfg.CurvePreferences[0])
+	WithPostQuantum(false)("", &cfg)
+	require.NotContains(t, cfg.CurvePreferences, x25519MLKEM768)
+}
+
+func TestWithPostQuantum_GoVersion(t *testing.T) {
+	_, err := NewStreamDialer(&transport.TCPDialer{}, WithPostQuantum(false))
+	require.NoError(t, err)
+	_, err = NewStreamDialer(&transport.TCPDialer{}, WithPostQuantum(true))
+	if postQuantumSupported {
+		require.NoError(t, err)
+	} else {
+		require.ErrorIs(t, err, ErrPostQuantumUnsupported)
+	}
+}
+
+func TestCheckCurvePreferences(t *testing.T) {
+	cfg := ClientConfig{CurvePreferences: []tls.CurveID{x25519MLKEM768, tls.X25519}}
+	if postQuantumSupported {
+		require.NoError(t, checkCurvePreferences(&cfg))
+	} else {
+		require.ErrorIs(t, checkCurvePreferences(&cfg), ErrPostQuantumUnsupported)
+	}
+	require.NoError(t, checkCurvePreferences(&ClientConfig{CurvePreferences: []tls.CurveID{tls.X25519}}))
+	require.NoError(t, checkCurvePreferences(&ClientConfig{}))
+}
+
+func TestIsPostQuantum(t *testing.T) {
+	if _, ok := negotiatedCurve(tls.ConnectionState{}); !ok {
+		t.Skip("Reporting the key exchange requires Go 1.25")
+	}
+	rootCA, rootKey := createRootCA(t)
+	leafCert, leafKey := createLeafCert(t, []string{"test.local"}, nil, rootCA, rootKey, time.Now().Add(-1*time.Hour), time.Now().Add(1*time.Hour))
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates:     []tls.Certificate{{Certificate: [][]byte{leafCert.Raw}, PrivateKey: leafKey}},
+		CurvePreferences: []tls.CurveID{x25519MLKEM768, tls.X25519},
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	rootPool := x509.NewCertPool()
+	rootPool.AddCert(rootCA)
+	verifier := WithCertVerifier(&StandardCertVerifier{CertificateName: "test.local", Roots: rootPool})
+	for _, enabled := range []bool{true, false} {
+		sd, err := NewStreamDialer(&transport.TCPDialer{}, verifier, WithPostQuantum(enabled))
+		require.NoError(t, err)
+		conn, err := sd.DialStream(context.Background(), listener.Addr().String())
+		require.NoError(t, err)
+		require.Equal(t, enabled, IsPostQuantum(conn))
+		conn.Close()
+	}
+	require.False(t, IsPostQuantum(nil))
+}
+
 // Make sure there are no connection leakage in DialStream
 func TestDialStreamCloseInnerConnOnError(t *testing.T) {
 	inner := &connCounterDialer{base: &transport.TCPDialer{}}
@@ -260,3 +380,24 @@ func TestGeneratedCert_Valid(t *testing.T) {
 	require.Equal(t, "other.local", hostErr.Host)
 	require.Equal(t, leafCert, hostErr.Certificate)
 }
+
+func TestStreamDialerCapabilities(t *testing.T) {
+	dialer, err := NewStreamDialer(&transport.TCPDialer{})
+	require.NoError(t, err)
+	// TLS doesn't support 0-RTT, but preserves IPv6 support.
+	require.Equal(t, transport.CapabilityStream|transport.CapabilityIPv6, transport.Capabilities(dialer))
+
+	remoteDNSDialer := &capabilityDialer{StreamDialer: &transport.TCPDialer{}, caps: transport.CapabilityStream | transport.CapabilityRemoteDNS}
+	dialer, err = NewStreamDialer(remoteDNSDialer)
+	require.NoError(t, err)
+	require.Equal(t, transport.CapabilityStream|transport.CapabilityRemoteDNS, transport.Capabilities(dialer))
+}
+
+type capabilityDialer struct {
+	transport.StreamDialer
+	caps transport.Capability
+}
+
+func (d *capabilityDialer) Capabilities() transport.Capability {
+	return d.caps
+}
@@ -29,6 +29,9 @@ This package offers convenient helper functions to create a TLS
     message]. It accepts a callback function that determines the split point,
     enabling advanced splitting logic such as splitting based on the SNI
     extension.
+  - [NewHandshakeFragStreamDialer] splits every plaintext handshake record
+    sent by the client, not only the first one, into records of at most the
+    given length, for middleboxes that reassemble the Client Hello record.
 
 [Circumventing the GFW with TLS Record Fragmentation]: https://upb-syssec.github.io/blog/2023/record-fragmentation/#tls-record-fragmentation
 [TLS records]: https://datatracker.ietf.org/doc/html/rfc8446#section-5.1
@@ -0,0 +1,160 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsfrag
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// handshakeFragWriter splits every plaintext TLS handshake record sent by the client into records with payloads of at
+// most maxFragLen bytes. It stops splitting and passes the data through once it sees a record of another type, like
+// Change Cipher Spec or Application Data, since the handshake records after it are encrypted and can't be split.
+type handshakeFragWriter struct {
+	base       io.Writer
+	maxFragLen int
+	// done is set after the first non-handshake record, after which all data goes to base as is.
+	done bool
+	// record holds the handshake record being received, including the 5-byte header.
+	record []byte
+	// frags is the buffer used to build the fragmented records.
+	frags []byte
+}
+
+var _ io.Writer = (*handshakeFragWriter)(nil)
+var _ transport.BuffersWriter = (*handshakeFragWriter)(nil)
+
+// NewHandshakeFragWriter creates a [io.Writer] that splits all the TLS handshake records written to it into records
+// with payloads of at most maxFragLen bytes, and writes them to the base [io.Writer]. Each handshake record is buffered
+// until it's fully received, and its fragments are then written to base in a single Write.
+//
+// The records are split until the first record that is not a handshake record. All data after that, including the
+// encrypted handshake messages, is written to base without modification.
+func NewHandshakeFragWriter(base io.Writer, maxFragLen int) (io.Writer, error) {
+	if base == nil {
+		return nil, errors.New("base writer must not be nil")
+	}
+	if maxFragLen <= 0 {
+		return nil, errors.New("maxFragLen must be positive")
+	}
+	if maxFragLen > maxRecordPayloadLen {
+		maxFragLen = maxRecordPayloadLen
+	}
+	return &handshakeFragWriter{
+		base:       base,
+		maxFragLen: maxFragLen,
+		record:     make([]byte, 0, recordHeaderLen),
+	}, nil
+}
+
+// Write implements io.Writer.Write. It splits the handshake records in p, buffering incomplete ones until they are
+// fully received.
+func (w *handshakeFragWriter) Write(p []byte) (n int, err error) {
+	for !w.done && len(p) > 0 {
+		if len(w.record) < recordHeaderLen {
+			m := copy(w.record[len(w.record):recordHeaderLen], p)
+			w.record = w.record[:len(w.record)+m]
+			n += m
+			p = p[m:]
+			if len(w.record) < recordHeaderLen {
+				return
+			}
+			hdr, _ := newTLSHandshakeRecordHeader(w.record)
+			if hdr.Validate() != nil {
+				// Not a handshake record, stop splitting.
+				if err = w.Flush(); err != nil {
+					return
+				}
+				break
+			}
+			recordLen := recordHeaderLen + int(hdr.PayloadLen())
+			if cap(w.record) < recordLen {
+				record := make([]byte, recordHeaderLen, recordLen)
+				copy(record, w.record)
+				w.record = record
+			}
+		}
+		hdr, _ := newTLSHandshakeRecordHeader(w.record[:recordHeaderLen])
+		recordLen := recordHeaderLen + int(hdr.PayloadLen())
+		m := copy(w.record[len(w.record):recordLen], p)
+		w.record = w.record[:len(w.record)+m]
+		n += m
+		p = p[m:]
+		if len(w.record) < recordLen {
+			return
+		}
+		if err = w.writeFragments(); err != nil {
+			return
+		}
+	}
+	if len(p) > 0 {
+		m, e := w.base.Write(p)
+		n += m
+		err = e
+	}
+	return
+}
+
+// WriteBuffers implements [transport.BuffersWriter]. The buffers go through Write until the splitting stops,
+// and the rest are passed through to the base [io.Writer].
+func (w *handshakeFragWriter) WriteBuffers(buffers net.Buffers) (int64, error) {
+	return writeBuffers(w, func() bool { return w.done }, w.base, buffers)
+}
+
+// writeFragments splits the complete record in w.record and writes the fragments to base.
+func (w *handshakeFragWriter) writeFragments() error {
+	hdr := w.record[:recordHeaderLen]
+	payload := w.record[recordHeaderLen:]
+	numFrags := (len(payload) + w.maxFragLen - 1) / w.maxFragLen
+	if size := len(payload) + numFrags*recordHeaderLen; cap(w.frags) < size {
+		w.frags = make([]byte, 0, size)
+	}
+	w.frags = w.frags[:0]
+	for len(payload) > 0 {
+		fragLen := w.maxFragLen
+		if fragLen > len(payload) {
+			fragLen = len(payload)
+		}
+		start := len(w.frags)
+		w.frags = append(w.frags, hdr...)
+		fragHdr, _ := newTLSHandshakeRecordHeader(w.frags[start:])
+		fragHdr.SetPayloadLen(uint16(fragLen))
+		w.frags = append(w.frags, payload[:fragLen]...)
+		payload = payload[fragLen:]
+	}
+	w.record = w.record[:0]
+	_, err := w.base.Write(w.frags)
+	return err
+}
+
+// Flush writes any partially received record to base without splitting it, and stops splitting subsequent data.
+// It's called when the write end of the connection is closed, or when a non-handshake record is found.
+func (w *handshakeFragWriter) Flush() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.frags = nil // allows the GC to recycle the memory
+	record := w.record
+	w.record = nil
+	if len(record) == 0 {
+		return nil
+	}
+	_, err := w.base.Write(record)
+	return err
+}
@@ -0,0 +1,234 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsfrag
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHandshakeFragWriterCheckParameters(t *testing.T) {
+	_, err := NewHandshakeFragWriter(nil, 1)
+	require.Error(t, err)
+	_, err = NewHandshakeFragWriter(&collectWriter{}, 0)
+	require.Error(t, err)
+	_, err = NewHandshakeFragStreamDialer(&collectStreamDialer{}, -1)
+	require.Error(t, err)
+}
+
+// Make sure all handshake records before the Change Cipher Spec are split, and nothing after it.
+func TestHandshakeFragStreamDialerSplitsAllHandshakeRecords(t *testing.T) {
+	hello := constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00, 0x00, 0x03, 0xaa})
+	keyExchange := constructTLSRecord(t, layers.TLSHandshake, 0x0303, []byte{0x10, 0x00, 0x00, 0x01, 0xbb})
+	cipher := constructTLSRecord(t, layers.TLSChangeCipherSpec, 0x0303, []byte{0x01})
+	finished := constructTLSRecord(t, layers.TLSHandshake, 0x0303, []byte{0xff, 0xee, 0xdd, 0xcc})
+
+	inner := &collectStreamDialer{}
+	d, err := NewHandshakeFragStreamDialer(inner, 2)
+	require.NoError(t, err)
+	conn, err := d.DialStream(context.Background(), "ipinfo.io:443")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assertCanWriteAll(t, conn, net.Buffers{hello, keyExchange, cipher, finished})
+
+	expected := joinBytes(
+		joinBytes(
+			constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00}),
+			constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x00, 0x03}),
+			constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0xaa}),
+		),
+		joinBytes(
+			constructTLSRecord(t, layers.TLSHandshake, 0x0303, []byte{0x10, 0x00}),
+			constructTLSRecord(t, layers.TLSHandshake, 0x0303, []byte{0x00, 0x01}),
+			constructTLSRecord(t, layers.TLSHandshake, 0x0303, []byte{0xbb}),
+		),
+		cipher, finished, // Unchanged
+	)
+	require.Equal(t, expected, joinBytes(inner.bufs...))
+}
+
+// Make sure records are reassembled across Writes, and that multiple records in one Write are all split.
+func TestHandshakeFragWriterSplitsAcrossWrites(t *testing.T) {
+	hello := constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00, 0x00, 0x03, 0xaa})
+	appData := constructTLSRecord(t, layers.TLSApplicationData, 0x0303, []byte{0x01, 0x02, 0x03})
+	stream := joinBytes(hello, hello, appData)
+
+	inner := &collectWriter{}
+	w, err := NewHandshakeFragWriter(inner, 3)
+	require.NoError(t, err)
+	for _, b := range stream {
+		n, err := w.Write([]byte{b})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	}
+
+	frags := joinBytes(
+		constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00, 0x00}),
+		constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x03, 0xaa}),
+	)
+	require.Equal(t, joinBytes(frags, frags, appData), joinBytes(inner.buf...))
+
+	inner = &collectWriter{}
+	w, err = NewHandshakeFragWriter(inner, 3)
+	require.NoError(t, err)
+	n, err := w.Write(stream)
+	require.NoError(t, err)
+	require.Equal(t, len(stream), n)
+	// Each record's fragments are written in a single Write.
+	require.Equal(t, [][]byte{frags, frags}, inner.buf[:2])
+	require.Equal(t, appData, joinBytes(inner.buf[2:]...))
+}
+
+func TestHandshakeFragWriterDoesntSplitNonHandshake(t *testing.T) {
+	appData := constructTLSRecord(t, layers.TLSApplicationData, 0x0303, []byte{0x01, 0x02, 0x03})
+	hello := constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00, 0x00, 0x03, 0xaa})
+
+	inner := &collectWriter{}
+	w, err := NewHandshakeFragWriter(inner, 1)
+	require.NoError(t, err)
+	assertCanWriteAll(t, w, net.Buffers{appData, hello})
+	require.Equal(t, joinBytes(appData, hello), joinBytes(inner.buf...))
+}
+
+func TestHandshakeFragWriterWriteBuffers(t *testing.T) {
+	hello := constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00, 0x00, 0x03, 0xaa})
+	appData := constructTLSRecord(t, layers.TLSApplicationData, 0x0303, []byte{0x01, 0x02, 0x03})
+
+	inner := &collectBuffersWriter{}
+	w, err := NewHandshakeFragWriter(inner, 3)
+	require.NoError(t, err)
+	n, err := w.(transport.BuffersWriter).WriteBuffers(net.Buffers{hello, appData, appData})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(hello)+2*len(appData)), n)
+
+	frags := joinBytes(
+		constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00, 0x00}),
+		constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x03, 0xaa}),
+	)
+	require.Equal(t, joinBytes(frags, appData, appData), joinBytes(inner.buf...))
+	// The buffers after the first application data record are passed through together.
+	require.Equal(t, 1, inner.bufOps)
+	require.Equal(t, appData, inner.buf[len(inner.buf)-1])
+}
+
+func TestRecordLenFragWriterWriteBuffers(t *testing.T) {
+	hello := constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00, 0x00, 0x03, 0xaa})
+	appData := constructTLSRecord(t, layers.TLSApplicationData, 0x0303, []byte{0x01, 0x02, 0x03})
+
+	expected := &collectWriter{}
+	w, err := NewRecordLenFuncWriter(expected, func(int) int { return 2 })
+	require.NoError(t, err)
+	assertCanWriteAll(t, w, net.Buffers{hello, appData, appData})
+
+	inner := &collectBuffersWriter{}
+	w, err = NewRecordLenFuncWriter(inner, func(int) int { return 2 })
+	require.NoError(t, err)
+	n, err := w.(transport.BuffersWriter).WriteBuffers(net.Buffers{hello, appData, appData})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(hello)+2*len(appData)), n)
+	require.Equal(t, joinBytes(expected.buf...), joinBytes(inner.buf...))
+	// Both application data records are passed through together.
+	require.Equal(t, 1, inner.bufOps)
+}
+
+func TestHandshakeFragStreamDialerFlushesPartialRecordOnCloseWrite(t *testing.T) {
+	hello := constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00, 0x00, 0x03, 0xaa})
+	for _, partial := range [][]byte{hello[:3], hello[:7]} {
+		inner := &collectStreamDialer{}
+		d, err := NewHandshakeFragStreamDialer(inner, 1)
+		require.NoError(t, err)
+		conn, err := d.DialStream(context.Background(), "ipinfo.io:443")
+		require.NoError(t, err)
+		assertCanWriteAll(t, conn, net.Buffers{partial})
+		require.Empty(t, inner.bufs)
+		require.NoError(t, conn.CloseWrite())
+		require.Equal(t, net.Buffers{partial}, inner.bufs)
+	}
+}
+
+// Make sure a real TLS server accepts the fragmented handshake, for both TLS 1.2 and 1.3.
+func TestHandshakeFragStreamDialerCompletesHandshake(t *testing.T) {
+	cert := makeTestCertificate(t)
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   version,
+			MaxVersion:   version,
+		})
+		require.NoError(t, err)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			io.Copy(conn, conn)
+		}()
+
+		d, err := NewHandshakeFragStreamDialer(&transport.TCPDialer{}, 1)
+		require.NoError(t, err)
+		conn, err := d.DialStream(context.Background(), listener.Addr().String())
+		require.NoError(t, err)
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, MinVersion: version, MaxVersion: version})
+		require.NoError(t, tlsConn.Handshake())
+		_, err = tlsConn.Write([]byte("ping"))
+		require.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(tlsConn, buf)
+		require.NoError(t, err)
+		require.Equal(t, "ping", string(buf))
+		tlsConn.Close()
+		listener.Close()
+	}
+}
+
+// Private test helpers
+
+func joinBytes(bufs ...[]byte) []byte {
+	var joined []byte
+	for _, b := range bufs {
+		joined = append(joined, b...)
+	}
+	return joined
+}
+
+func makeTestCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
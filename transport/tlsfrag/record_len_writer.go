@@ -19,6 +19,8 @@ import (
 	"errors"
 	"io"
 	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
 )
 
 // RecordLenFragFunc takes the length of the first [handshake record]'s content (without the 5-byte header),
@@ -47,6 +49,7 @@ type recordLenFragWriter struct {
 }
 
 var _ io.Writer = (*recordLenFragWriter)(nil)
+var _ transport.BuffersWriter = (*recordLenFragWriter)(nil)
 
 // NewRecordLenFuncWriter creates a [io.Writer] that splits the first TLS Client Hello record into two records
 // based on the provided [RecordLenFragFunc] callback.
@@ -140,6 +143,12 @@ func (w *recordLenFragWriter) Write(p []byte) (n int, err error) {
 	return n + m, e
 }
 
+// WriteBuffers implements [transport.BuffersWriter]. The buffers go through Write until both record headers are
+// written, and the rest are passed through to the base [io.Writer].
+func (w *recordLenFragWriter) WriteBuffers(buffers net.Buffers) (int64, error) {
+	return writeBuffers(w, func() bool { return w.done && len(w.hdr) == 0 }, w.base, buffers)
+}
+
 // fixedLenReaderFrom optimizes for fixedLenWriter when the base [io.Writer] implements [io.ReaderFrom].
 type fixedLenReaderFrom struct {
 	*recordLenFragWriter
@@ -256,6 +265,22 @@ func (w *fixedLenReaderFrom) ReadFrom(r io.Reader) (n int64, err error) {
 	return w.baseRF.ReadFrom(r)
 }
 
+// Flush writes the header bytes held back in w.hdr to base. It's called when the write end of the connection is
+// closed before the header could be sent along with the record content.
+func (w *recordLenFragWriter) Flush() error {
+	if !w.done && w.tlsHdr != nil {
+		// The first record is being written through, so nothing is held back.
+		return nil
+	}
+	w.done = true
+	if len(w.hdr) == 0 {
+		return nil
+	}
+	n, err := w.base.Write(w.hdr)
+	w.hdr = w.hdr[n:]
+	return err
+}
+
 // updateSplitLen determines the split length by calling w.frag with the input of w.tlsHdr.PayloadLen().
 // It returns nil error if w.frag returns a valid split length, otherwise it returns non-nil error.
 //
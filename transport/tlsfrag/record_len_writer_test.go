@@ -1185,6 +1185,19 @@ func (w *collectWriter) Write(p []byte) (n int, err error) {
 	return w.append(p), nil
 }
 
+type collectBuffersWriter struct {
+	collectWriter
+	bufOps int
+}
+
+func (w *collectBuffersWriter) WriteBuffers(buffers net.Buffers) (n int64, err error) {
+	w.bufOps++
+	for _, b := range buffers {
+		n += int64(w.append(b))
+	}
+	return
+}
+
 type collectReaderFrom struct {
 	collectWriter
 	bufSize int
@@ -127,3 +127,44 @@ func WrapConnFixedLen(base transport.StreamConn, splitLen int) (conn transport.S
 	conn = transport.WrapConn(base, base, w)
 	return
 }
+
+// NewHandshakeFragStreamDialer creates a [transport.StreamDialer] that splits every plaintext [handshake record] sent
+// by the client, not only the first Client Hello, into records with payloads of at most maxFragLen bytes. This covers
+// the whole client side of the handshake until the first record of another type, and defeats middleboxes that
+// reassemble the first record only.
+//
+// [handshake record]: https://datatracker.ietf.org/doc/html/rfc8446#section-5.1
+func NewHandshakeFragStreamDialer(base transport.StreamDialer, maxFragLen int) (transport.StreamDialer, error) {
+	if base == nil {
+		return nil, errors.New("base dialer must not be nil")
+	}
+	if maxFragLen <= 0 {
+		return nil, errors.New("maxFragLen must be positive")
+	}
+	return transport.FuncStreamDialer(func(ctx context.Context, raddr string) (transport.StreamConn, error) {
+		baseConn, err := base.DialStream(ctx, raddr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := WrapConnHandshakeFrag(baseConn, maxFragLen)
+		if err != nil {
+			baseConn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}), nil
+}
+
+// WrapConnHandshakeFrag wraps the base [transport.StreamConn] and splits all the TLS handshake records into records
+// with payloads of at most maxFragLen bytes, until the first record that is not a handshake record, like Change Cipher
+// Spec or Application Data. After that, all data is forwarded without modification.
+//
+// Note that in TLS 1.3 middlebox compatibility mode, a second Client Hello sent after a Hello Retry Request follows a
+// Change Cipher Spec record, so it's not split.
+func WrapConnHandshakeFrag(base transport.StreamConn, maxFragLen int) (transport.StreamConn, error) {
+	w, err := NewHandshakeFragWriter(base, maxFragLen)
+	if err != nil {
+		return nil, err
+	}
+	return transport.WrapConn(base, base, w), nil
+}
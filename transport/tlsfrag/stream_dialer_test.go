@@ -174,6 +174,26 @@ func TestNestedFixedLenStreamDialerSplitsClientHello(t *testing.T) {
 	require.Equal(t, expected, inner.bufs)
 }
 
+// Make sure a partial Client Hello held back by the writers is sent when the write end is closed.
+func TestStreamDialersFlushPartialClientHelloOnCloseWrite(t *testing.T) {
+	hello := constructTLSRecord(t, layers.TLSHandshake, 0x0301, []byte{0x01, 0x00, 0x00, 0x03, 0xaa, 0xbb, 0xcc})
+	for _, partial := range [][]byte{hello[:3], hello[:8]} {
+		inner := &collectStreamDialer{}
+		conn := assertCanDialFragFunc(t, inner, "ipinfo.io:443", func(payload []byte) int { return len(payload) / 2 })
+		assertCanWriteAll(t, conn, net.Buffers{partial})
+		require.Empty(t, inner.bufs)
+		require.NoError(t, conn.CloseWrite())
+		require.Equal(t, net.Buffers{partial}, inner.bufs)
+	}
+
+	inner := &collectStreamDialer{}
+	conn := assertCanDialFixedLenFrag(t, inner, "ipinfo.io:443", 2)
+	assertCanWriteAll(t, conn, net.Buffers{hello[:3]})
+	require.Empty(t, inner.bufs)
+	require.NoError(t, conn.CloseWrite())
+	require.Equal(t, net.Buffers{hello[:3]}, inner.bufs)
+}
+
 // test assertions
 
 func assertCanDialFragFunc(t *testing.T, inner transport.StreamDialer, raddr string, frag FragFunc) transport.StreamConn {
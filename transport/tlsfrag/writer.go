@@ -18,6 +18,9 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
 )
 
 // clientHelloFragWriter intercepts the initial TLS Client Hello record and splits it into two TLS records based on the
@@ -46,6 +49,7 @@ type clientHelloFragReaderFrom struct {
 var _ io.Writer = (*clientHelloFragWriter)(nil)
 var _ io.Writer = (*clientHelloFragReaderFrom)(nil)
 var _ io.ReaderFrom = (*clientHelloFragReaderFrom)(nil)
+var _ transport.BuffersWriter = (*clientHelloFragWriter)(nil)
 
 // newClientHelloFragWriter creates a [io.Writer] that splits the first TLS Client Hello record into two records
 // based on the provided [FragFunc] callback.
@@ -141,6 +145,27 @@ func (w *clientHelloFragReaderFrom) ReadFrom(r io.Reader) (n int64, err error) {
 	return
 }
 
+// WriteBuffers implements [transport.BuffersWriter]. The buffers go through Write until the Client Hello is
+// written, and the rest are passed through to the base [io.Writer].
+func (w *clientHelloFragWriter) WriteBuffers(buffers net.Buffers) (int64, error) {
+	return writeBuffers(w, func() bool { return w.done }, w.base, buffers)
+}
+
+// writeBuffers writes the buffers to w one by one until passthrough returns true, and then writes the remaining
+// buffers to base together, so that the data after the fragmented records keeps the vectorized writes of base.
+func writeBuffers(w io.Writer, passthrough func() bool, base io.Writer, buffers net.Buffers) (n int64, err error) {
+	for len(buffers) > 0 && !passthrough() {
+		m, err := w.Write(buffers[0])
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+		buffers = buffers[1:]
+	}
+	m, err := transport.WriteBuffers(base, buffers)
+	return n + m, err
+}
+
 // copyHelloBufToRecord copies w.helloBuf into w.record without allocations.
 func (w *clientHelloFragWriter) copyHelloBufToRecord() {
 	w.record = bytes.NewBuffer(w.helloBuf.Bytes())
@@ -183,6 +208,19 @@ func (w *clientHelloFragWriter) splitHelloBufToRecord() {
 	w.helloBuf = nil // allows the GC to recycle the memory
 }
 
+// Flush writes any data held back while waiting for the full Client Hello to base, without splitting it.
+// It's called when the write end of the connection is closed before the Client Hello is complete.
+func (w *clientHelloFragWriter) Flush() error {
+	if w.done {
+		return nil
+	}
+	if w.record == nil {
+		w.copyHelloBufToRecord()
+	}
+	_, err := w.flushRecord()
+	return err
+}
+
 // flushRecord writes all bytes from w.record to base.
 func (w *clientHelloFragWriter) flushRecord() (int, error) {
 	n, err := io.Copy(w.base, w.record)
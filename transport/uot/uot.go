@@ -0,0 +1,233 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package uot provides a [transport.PacketDialer] that sends datagrams over a stream connection, so that transports
+// that only support streams can also carry UDP traffic.
+//
+// Each datagram is framed with a [Codec]. [LengthPrefixCodec] prefixes datagrams with their 16-bit length, as used
+// by DNS over TCP and most SOCKS-over-TCP relays. [NewUoTPacketDialer] implements the connect mode of the
+// UDP-over-TCP version 2 protocol supported by Shadowsocks servers like sing-box.
+package uot
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// ErrPacketTooLarge is returned when a datagram can't be framed by the [Codec].
+var ErrPacketTooLarge = errors.New("packet too large")
+
+// Codec frames datagrams in a stream.
+type Codec interface {
+	// AppendPacket appends the framed packet to b, returning an error wrapping [ErrPacketTooLarge] if the packet
+	// can't be framed.
+	AppendPacket(b []byte, packet []byte) ([]byte, error)
+	// ReadPacket reads the next framed packet from r into buf, returning the packet length. If the packet doesn't
+	// fit in buf, it's truncated, as with UDP sockets, and the rest is discarded.
+	ReadPacket(r io.Reader, buf []byte) (int, error)
+}
+
+// LengthPrefixCodec frames each packet with its length as a 16-bit big-endian integer.
+var LengthPrefixCodec Codec = lengthPrefixCodec{}
+
+type lengthPrefixCodec struct{}
+
+func (lengthPrefixCodec) AppendPacket(b []byte, packet []byte) ([]byte, error) {
+	if len(packet) > 0xffff {
+		return nil, fmt.Errorf("%w: %v bytes", ErrPacketTooLarge, len(packet))
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(packet)))
+	return append(b, packet...), nil
+}
+
+func (lengthPrefixCodec) ReadPacket(r io.Reader, buf []byte) (int, error) {
+	var lengthBytes [2]byte
+	if _, err := io.ReadFull(r, lengthBytes[:]); err != nil {
+		return 0, err
+	}
+	length := int(binary.BigEndian.Uint16(lengthBytes[:]))
+	n := length
+	if n > len(buf) {
+		n = len(buf)
+	}
+	if _, err := io.ReadFull(r, buf[:n]); err != nil {
+		return 0, noEOF(err)
+	}
+	if n < length {
+		if _, err := io.CopyN(io.Discard, r, int64(length-n)); err != nil {
+			return 0, noEOF(err)
+		}
+	}
+	return n, nil
+}
+
+// noEOF converts io.EOF in the middle of a packet to io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// PacketDialer is a [transport.PacketDialer] that sends datagrams over streams from a [transport.StreamDialer].
+// Each call to DialPacket creates a new stream.
+type PacketDialer struct {
+	dialer transport.StreamDialer
+	codec  Codec
+	// connect establishes the stream for packets to the address.
+	connect func(ctx context.Context, dialer transport.StreamDialer, address string) (transport.StreamConn, error)
+}
+
+var _ transport.PacketDialer = (*PacketDialer)(nil)
+var _ transport.CapabilityReporter = (*PacketDialer)(nil)
+
+// NewPacketDialer creates a [PacketDialer] that connects a stream to the packet destination with dialer, and
+// frames the packets with codec.
+func NewPacketDialer(dialer transport.StreamDialer, codec Codec) (*PacketDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if codec == nil {
+		return nil, errors.New("argument codec must not be nil")
+	}
+	return &PacketDialer{dialer: dialer, codec: codec, connect: connectDirect}, nil
+}
+
+func connectDirect(ctx context.Context, dialer transport.StreamDialer, address string) (transport.StreamConn, error) {
+	return dialer.DialStream(ctx, address)
+}
+
+// UoTMagicAddress is the address that proxies recognize as a UDP-over-TCP version 2 request.
+const UoTMagicAddress = "sp.v2.udp-over-tcp.arpa:0"
+
+// NewUoTPacketDialer creates a [PacketDialer] that uses the connect mode of the UDP-over-TCP version 2 protocol.
+// The dialer is usually a proxy dialer, like the Shadowsocks one. Streams are connected to [UoTMagicAddress],
+// and start with a request with the packet destination, which the proxy resolves.
+func NewUoTPacketDialer(dialer transport.StreamDialer) (*PacketDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	return &PacketDialer{dialer: dialer, codec: LengthPrefixCodec, connect: connectUoT}, nil
+}
+
+// Address families of UDP-over-TCP requests, which differ from the SOCKS5 address types.
+// See https://github.com/SagerNet/sing/blob/main/common/uot/protocol.go.
+const (
+	uotFamilyIPv4 = 0x00
+	uotFamilyIPv6 = 0x01
+	uotFamilyFQDN = 0x02
+)
+
+// appendUoTAddr appends the address in the format of UDP-over-TCP requests: the family, the address, with
+// a length prefix for domain names, and the big-endian port.
+func appendUoTAddr(b []byte, address string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", portStr, err)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ip = ip.Unmap()
+		if ip.Is4() {
+			b = append(b, uotFamilyIPv4)
+		} else {
+			b = append(b, uotFamilyIPv6)
+		}
+		b = append(b, ip.AsSlice()...)
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host name too long: %v bytes", len(host))
+		}
+		b = append(b, uotFamilyFQDN, byte(len(host)))
+		b = append(b, host...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+func connectUoT(ctx context.Context, dialer transport.StreamDialer, address string) (transport.StreamConn, error) {
+	// The request is the connect flag followed by the destination.
+	request, err := appendUoTAddr([]byte{1}, address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialer.DialStream(ctx, UoTMagicAddress)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to write request: %w", err)
+	}
+	return conn, nil
+}
+
+// Capabilities implements [transport.CapabilityReporter]. It preserves the remote DNS and IPv6 support of
+// the stream dialer.
+func (d *PacketDialer) Capabilities() transport.Capability {
+	return transport.CapabilityPacket | transport.Capabilities(d.dialer)&(transport.CapabilityRemoteDNS|transport.CapabilityIPv6)
+}
+
+// DialPacket implements [transport.PacketDialer].
+func (d *PacketDialer) DialPacket(ctx context.Context, address string) (net.Conn, error) {
+	conn, err := d.connect(ctx, d.dialer, address)
+	if err != nil {
+		return nil, err
+	}
+	return &packetConn{StreamConn: conn, codec: d.codec}, nil
+}
+
+// packetConn is a [net.Conn] with datagram semantics over a stream.
+type packetConn struct {
+	transport.StreamConn
+	codec Codec
+	rMu   sync.Mutex
+	wMu   sync.Mutex
+	wBuf  []byte
+}
+
+var _ net.Conn = (*packetConn)(nil)
+
+// Read reads one packet.
+func (c *packetConn) Read(b []byte) (int, error) {
+	c.rMu.Lock()
+	defer c.rMu.Unlock()
+	return c.codec.ReadPacket(c.StreamConn, b)
+}
+
+// Write writes one packet, with a single write to the stream.
+func (c *packetConn) Write(b []byte) (int, error) {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+	frame, err := c.codec.AppendPacket(c.wBuf[:0], b)
+	if err != nil {
+		return 0, err
+	}
+	c.wBuf = frame
+	if _, err := c.StreamConn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
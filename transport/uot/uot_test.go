@@ -0,0 +1,201 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uot
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLengthPrefixCodec(t *testing.T) {
+	var stream bytes.Buffer
+	frame, err := LengthPrefixCodec.AppendPacket(nil, []byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 5, 'h', 'e', 'l', 'l', 'o'}, frame)
+	stream.Write(frame)
+	frame, err = LengthPrefixCodec.AppendPacket(nil, []byte{})
+	require.NoError(t, err)
+	stream.Write(frame)
+	frame, err = LengthPrefixCodec.AppendPacket(nil, []byte("truncated"))
+	require.NoError(t, err)
+	stream.Write(frame)
+	frame, err = LengthPrefixCodec.AppendPacket(nil, []byte("next"))
+	require.NoError(t, err)
+	stream.Write(frame)
+
+	buf := make([]byte, 5)
+	n, err := LengthPrefixCodec.ReadPacket(&stream, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf[:n]))
+	n, err = LengthPrefixCodec.ReadPacket(&stream, buf)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	// Truncated packets don't affect the following ones.
+	n, err = LengthPrefixCodec.ReadPacket(&stream, buf)
+	require.NoError(t, err)
+	require.Equal(t, "trunc", string(buf[:n]))
+	n, err = LengthPrefixCodec.ReadPacket(&stream, buf)
+	require.NoError(t, err)
+	require.Equal(t, "next", string(buf[:n]))
+	_, err = LengthPrefixCodec.ReadPacket(&stream, buf)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestLengthPrefixCodec_Errors(t *testing.T) {
+	_, err := LengthPrefixCodec.AppendPacket(nil, make([]byte, 0x10000))
+	require.ErrorIs(t, err, ErrPacketTooLarge)
+
+	_, err = LengthPrefixCodec.ReadPacket(bytes.NewReader([]byte{0}), make([]byte, 10))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = LengthPrefixCodec.ReadPacket(bytes.NewReader([]byte{0, 5, 'a'}), make([]byte, 10))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = LengthPrefixCodec.ReadPacket(bytes.NewReader([]byte{0, 5, 'a', 'b'}), make([]byte, 1))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+// runEchoServer echoes length-prefixed packets after calling handleRequest on each new connection.
+func runEchoServer(t *testing.T, handleRequest func(conn net.Conn)) (transport.StreamDialer, *[]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if handleRequest != nil {
+					handleRequest(conn)
+				}
+				buf := make([]byte, 0xffff)
+				for {
+					n, err := LengthPrefixCodec.ReadPacket(conn, buf)
+					if err != nil {
+						return
+					}
+					frame, _ := LengthPrefixCodec.AppendPacket(nil, buf[:n])
+					conn.Write(frame)
+				}
+			}()
+		}
+	}()
+	var dialed []string
+	dialer := transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		dialed = append(dialed, addr)
+		return (&transport.TCPDialer{}).DialStream(ctx, listener.Addr().String())
+	})
+	return dialer, &dialed
+}
+
+func TestPacketDialer(t *testing.T) {
+	streamDialer, dialed := runEchoServer(t, nil)
+	dialer, err := NewPacketDialer(streamDialer, LengthPrefixCodec)
+	require.NoError(t, err)
+	conn, err := dialer.DialPacket(context.Background(), "8.8.8.8:53")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, []string{"8.8.8.8:53"}, *dialed)
+
+	for _, packet := range []string{"first", "second", ""} {
+		n, err := conn.Write([]byte(packet))
+		require.NoError(t, err)
+		require.Equal(t, len(packet), n)
+	}
+	buf := make([]byte, 100)
+	for _, expected := range []string{"first", "second", ""} {
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(buf[:n]))
+	}
+
+	_, err = conn.Write(make([]byte, 0x10000))
+	require.ErrorIs(t, err, ErrPacketTooLarge)
+}
+
+func TestUoTPacketDialer(t *testing.T) {
+	requests := make(chan []byte, 1)
+	expectedRequest := []byte("\x01\x02\x0adns.google\x00\x35")
+	streamDialer, dialed := runEchoServer(t, func(conn net.Conn) {
+		request := make([]byte, len(expectedRequest))
+		_, err := io.ReadFull(conn, request)
+		require.NoError(t, err)
+		requests <- request
+	})
+	dialer, err := NewUoTPacketDialer(streamDialer)
+	require.NoError(t, err)
+	conn, err := dialer.DialPacket(context.Background(), "dns.google:53")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, []string{UoTMagicAddress}, *dialed)
+
+	_, err = conn.Write([]byte("query"))
+	require.NoError(t, err)
+	require.Equal(t, expectedRequest, <-requests)
+	buf := make([]byte, 100)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "query", string(buf[:n]))
+
+	_, err = dialer.DialPacket(context.Background(), "invalid")
+	require.Error(t, err)
+}
+
+// TestAppendUoTAddr checks the requests against the ones of sing-box, as encoded by uot.EncodeRequest
+// in github.com/sagernet/sing/common/uot, with IsConnect set.
+func TestAppendUoTAddr(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		request string
+	}{
+		{"1.2.3.4:53", "0100010203040035"},
+		{"[::ffff:1.2.3.4]:53", "0100010203040035"},
+		{"[2001:db8::1]:443", "010120010db800000000000000000000000101bb"},
+		{"example.com:8080", "0102" + "0b" + "6578616d706c652e636f6d" + "1f90"},
+	} {
+		t.Run(tc.address, func(t *testing.T) {
+			request, err := appendUoTAddr([]byte{1}, tc.address)
+			require.NoError(t, err)
+			require.Equal(t, tc.request, hex.EncodeToString(request))
+		})
+	}
+
+	for _, address := range []string{"invalid", "example.com:http", "example.com:65536", strings.Repeat("a", 256) + ":53"} {
+		_, err := appendUoTAddr(nil, address)
+		require.Error(t, err, address)
+	}
+}
+
+func TestPacketDialer_Capabilities(t *testing.T) {
+	dialer, err := NewPacketDialer(&transport.TCPDialer{}, LengthPrefixCodec)
+	require.NoError(t, err)
+	require.Equal(t, transport.CapabilityPacket|transport.CapabilityIPv6, transport.Capabilities(dialer))
+
+	_, err = NewPacketDialer(nil, LengthPrefixCodec)
+	require.Error(t, err)
+	_, err = NewPacketDialer(&transport.TCPDialer{}, nil)
+	require.Error(t, err)
+	_, err = NewUoTPacketDialer(nil)
+	require.Error(t, err)
+}
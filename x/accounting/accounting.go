@@ -0,0 +1,240 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package accounting tracks the traffic of the access keys of a server: the bytes in each direction, the number of
+connections, and when the key was last seen. It's meant for lightweight server deployments that need to report
+usage or enforce quotas without external infrastructure.
+
+The usage is kept in a [Store]. [MemoryStore] keeps it in memory, and [FileStore] also persists it to a JSON file.
+Other storage can be plugged in by implementing [Store].
+
+The server components update the store by wrapping their listeners or connections with the access key they serve:
+
+	store, err := accounting.NewFileStore("usage.json")
+	// ...
+	go store.Run(ctx, time.Minute)
+	listener, err := providers.NewStreamListener(ctx, "ss://[USERINFO]@[HOST]:[PORT]?listen=:443")
+	// ...
+	l, err := listener.ListenStream(ctx)
+	// ...
+	l = accounting.WrapListener(l, "key-1", store)
+
+A [QuotaEnforcer] enforces data limits and expiry dates per key on top of the store, rejecting the new connections
+of keys over their quota, or throttling them.
+*/
+package accounting
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Usage is the traffic of an access key.
+type Usage struct {
+	// BytesReceived is the number of bytes received from the clients.
+	BytesReceived uint64 `json:"bytesReceived"`
+	// BytesSent is the number of bytes sent to the clients.
+	BytesSent uint64 `json:"bytesSent"`
+	// Connections is the number of connections accepted.
+	Connections uint64 `json:"connections"`
+	// LastSeen is the last time the key had traffic, or the zero time if never.
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// TotalBytes returns the bytes in both directions, as counted by data limits.
+func (u Usage) TotalBytes() uint64 {
+	return u.BytesReceived + u.BytesSent
+}
+
+// add adds the counters of delta to u, and keeps the latest LastSeen.
+func (u *Usage) add(delta Usage) {
+	u.BytesReceived += delta.BytesReceived
+	u.BytesSent += delta.BytesSent
+	u.Connections += delta.Connections
+	if delta.LastSeen.After(u.LastSeen) {
+		u.LastSeen = delta.LastSeen
+	}
+}
+
+// Store stores the usage of access keys. Implementations must be safe for concurrent use, and Add must not block
+// for long, since it's called on every read and write. Implementations backed by slow storage should buffer.
+type Store interface {
+	// Add adds the counters of delta to the usage of the key, and updates its LastSeen if delta's is later.
+	Add(key string, delta Usage)
+	// Usage returns the usage of the key. It returns false if the key has no usage.
+	Usage(key string) (Usage, bool)
+	// AllUsage returns the usage of all the keys with usage.
+	AllUsage() map[string]Usage
+	// Reset removes the usage of the key, for instance at the start of a new quota period.
+	Reset(key string)
+}
+
+// MemoryStore is a [Store] that keeps the usage in memory.
+type MemoryStore struct {
+	mu    sync.Mutex
+	usage map[string]Usage
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty [MemoryStore].
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{usage: make(map[string]Usage)}
+}
+
+// Add implements [Store].
+func (s *MemoryStore) Add(key string, delta Usage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := s.usage[key]
+	usage.add(delta)
+	s.usage[key] = usage
+}
+
+// Usage implements [Store].
+func (s *MemoryStore) Usage(key string) (Usage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage, ok := s.usage[key]
+	return usage, ok
+}
+
+// AllUsage implements [Store].
+func (s *MemoryStore) AllUsage() map[string]Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make(map[string]Usage, len(s.usage))
+	for key, usage := range s.usage {
+		all[key] = usage
+	}
+	return all
+}
+
+// Reset implements [Store].
+func (s *MemoryStore) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.usage, key)
+}
+
+// WrapListener returns a listener that records the connections it accepts, and their traffic, as usage of the key.
+func WrapListener(listener net.Listener, key string, store Store) net.Listener {
+	return &accountingListener{Listener: listener, key: key, store: store}
+}
+
+// WrapConn records the connection, and its traffic until it's closed, as usage of the key. Use it for connections
+// that don't come from a wrapped listener, like the ones of servers with multiple keys, once the key is known.
+// The returned connection keeps the Target method of connections from proxy protocol listeners, like
+// [github.com/Jigsaw-Code/outline-sdk/x/configurl.TargetConn].
+func WrapConn(conn net.Conn, key string, store Store) net.Conn {
+	store.Add(key, Usage{Connections: 1, LastSeen: time.Now()})
+	c := &accountingConn{Conn: conn, key: key, store: store}
+	if _, ok := conn.(targetConn); ok {
+		return &accountingTargetConn{c}
+	}
+	return c
+}
+
+// WrapPacketConn returns a packet conn that records the bytes of the datagrams as usage of the key.
+func WrapPacketConn(conn net.PacketConn, key string, store Store) net.PacketConn {
+	return &accountingPacketConn{PacketConn: conn, key: key, store: store}
+}
+
+type accountingListener struct {
+	net.Listener
+	key   string
+	store Store
+}
+
+func (l *accountingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return WrapConn(conn, l.key, l.store), nil
+}
+
+type accountingConn struct {
+	net.Conn
+	key   string
+	store Store
+}
+
+func (c *accountingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.store.Add(c.key, Usage{BytesReceived: uint64(n), LastSeen: time.Now()})
+	}
+	return n, err
+}
+
+func (c *accountingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.store.Add(c.key, Usage{BytesSent: uint64(n), LastSeen: time.Now()})
+	}
+	return n, err
+}
+
+func (c *accountingConn) CloseRead() error {
+	if cr, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+func (c *accountingConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
+
+// targetConn is implemented by the connections of proxy protocol listeners.
+type targetConn interface {
+	Target() (string, error)
+}
+
+type accountingTargetConn struct {
+	*accountingConn
+}
+
+func (c *accountingTargetConn) Target() (string, error) {
+	return c.Conn.(targetConn).Target()
+}
+
+type accountingPacketConn struct {
+	net.PacketConn
+	key   string
+	store Store
+}
+
+func (c *accountingPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	if n > 0 {
+		c.store.Add(c.key, Usage{BytesReceived: uint64(n), LastSeen: time.Now()})
+	}
+	return n, addr, err
+}
+
+func (c *accountingPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(b, addr)
+	if n > 0 {
+		c.store.Add(c.key, Usage{BytesSent: uint64(n), LastSeen: time.Now()})
+	}
+	return n, err
+}
@@ -0,0 +1,154 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounting
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	_, ok := store.Usage("key")
+	require.False(t, ok)
+
+	first := time.Unix(100, 0)
+	store.Add("key", Usage{BytesReceived: 10, Connections: 1, LastSeen: first})
+	store.Add("key", Usage{BytesSent: 5, LastSeen: first.Add(-time.Second)})
+	usage, ok := store.Usage("key")
+	require.True(t, ok)
+	require.Equal(t, Usage{BytesReceived: 10, BytesSent: 5, Connections: 1, LastSeen: first}, usage)
+	require.Equal(t, uint64(15), usage.TotalBytes())
+	require.Equal(t, map[string]Usage{"key": usage}, store.AllUsage())
+
+	store.Reset("key")
+	_, ok = store.Usage("key")
+	require.False(t, ok)
+}
+
+type fakeTargetConn struct {
+	net.Conn
+}
+
+func (c *fakeTargetConn) Target() (string, error) {
+	return "example.com:443", nil
+}
+
+func TestWrapListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	store := NewMemoryStore()
+	listener = WrapListener(listener, "key", store)
+
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("request"))
+		io.ReadAll(conn)
+	}()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	buf := make([]byte, 7)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("response!"))
+	require.NoError(t, err)
+	require.NoError(t, conn.(interface{ CloseWrite() error }).CloseWrite())
+	conn.Close()
+
+	usage, ok := store.Usage("key")
+	require.True(t, ok)
+	require.Equal(t, uint64(7), usage.BytesReceived)
+	require.Equal(t, uint64(9), usage.BytesSent)
+	require.Equal(t, uint64(1), usage.Connections)
+	require.WithinDuration(t, time.Now(), usage.LastSeen, time.Minute)
+}
+
+func TestWrapConn_KeepsTarget(t *testing.T) {
+	store := NewMemoryStore()
+	conn := WrapConn(&fakeTargetConn{}, "key", store)
+	target, err := conn.(targetConn).Target()
+	require.NoError(t, err)
+	require.Equal(t, "example.com:443", target)
+
+	_, ok := WrapConn(&net.TCPConn{}, "key", store).(targetConn)
+	require.False(t, ok)
+}
+
+func TestWrapPacketConn(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+	store := NewMemoryStore()
+	server = WrapPacketConn(server, "key", store)
+
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 10)
+	n, addr, err := server.ReadFrom(buf)
+	require.NoError(t, err)
+	_, err = server.WriteTo(buf[:n], addr)
+	require.NoError(t, err)
+
+	usage, _ := store.Usage("key")
+	require.Equal(t, uint64(4), usage.BytesReceived)
+	require.Equal(t, uint64(4), usage.BytesSent)
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	require.Empty(t, store.AllUsage())
+
+	lastSeen := time.Unix(100, 0).UTC()
+	store.Add("key", Usage{BytesReceived: 1, BytesSent: 2, Connections: 3, LastSeen: lastSeen})
+	require.NoError(t, store.Save())
+
+	loaded, err := NewFileStore(path)
+	require.NoError(t, err)
+	usage, ok := loaded.Usage("key")
+	require.True(t, ok)
+	require.Equal(t, Usage{BytesReceived: 1, BytesSent: 2, Connections: 3, LastSeen: lastSeen}, usage)
+}
+
+func TestFileStore_Run(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	store.Add("key", Usage{Connections: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, store.Run(ctx, time.Hour))
+
+	loaded, err := NewFileStore(path)
+	require.NoError(t, err)
+	usage, _ := loaded.Usage("key")
+	require.Equal(t, uint64(1), usage.Connections)
+}
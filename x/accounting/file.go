@@ -0,0 +1,91 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileStore is a [Store] that keeps the usage in memory, and persists it to a JSON file with [FileStore.Save].
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore creates a [FileStore] that persists the usage to the file at path, loading the usage already in
+// the file, if it exists.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: MemoryStore{usage: make(map[string]Usage)}, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.usage); err != nil {
+		return nil, fmt.Errorf("failed to parse usage file: %w", err)
+	}
+	if s.usage == nil {
+		s.usage = make(map[string]Usage)
+	}
+	return s, nil
+}
+
+// Save writes the usage to the file. The file is replaced atomically, so it's never left partially written.
+func (s *FileStore) Save() error {
+	data, err := json.MarshalIndent(s.AllUsage(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Run saves the usage every interval until ctx is done, and then once more, so the latest usage is persisted
+// on shutdown. It returns the error of the last save.
+func (s *FileStore) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return s.Save()
+		case <-ticker.C:
+			// Errors are retried on the next tick.
+			s.Save()
+		}
+	}
+}
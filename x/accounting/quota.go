@@ -0,0 +1,193 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounting
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/ratelimit"
+)
+
+var (
+	// ErrDataLimitExceeded is returned by [QuotaEnforcer.Check] when the key used up its data limit.
+	ErrDataLimitExceeded = errors.New("data limit exceeded")
+	// ErrKeyExpired is returned by [QuotaEnforcer.Check] when the key is past its expiry.
+	ErrKeyExpired = errors.New("access key expired")
+)
+
+// Quota limits the use of an access key, like the data limits of Outline Manager.
+type Quota struct {
+	// DataLimit is the maximum number of bytes, in both directions, the key can use. Zero means no limit.
+	DataLimit uint64
+	// Expiry is when the key stops working. The zero time means it never expires.
+	Expiry time.Time
+	// ThrottleBytesPerSecond, if positive, makes the keys over their data limit keep working at this bandwidth,
+	// instead of rejecting their connections.
+	ThrottleBytesPerSecond int
+}
+
+// QuotaEnforcer enforces per-key quotas on the usage of a [Store]. The quotas are checked when connections are
+// accepted, so connections that are already open are not interrupted. It's safe for concurrent use.
+type QuotaEnforcer struct {
+	// OnReject, if set, is called when a connection is rejected by [QuotaEnforcer.WrapListener].
+	OnReject func(key string, err error)
+
+	store Store
+	now   func() time.Time
+
+	mu     sync.Mutex
+	quotas map[string]Quota
+	// throttles has the bandwidth limiters of the throttled keys, by rate.
+	throttles map[int]*ratelimit.Limiter
+}
+
+// NewQuotaEnforcer creates a [QuotaEnforcer] for the usage in store. Keys without a quota are not limited.
+func NewQuotaEnforcer(store Store) (*QuotaEnforcer, error) {
+	if store == nil {
+		return nil, errors.New("argument store must not be nil")
+	}
+	return &QuotaEnforcer{
+		store:     store,
+		now:       time.Now,
+		quotas:    make(map[string]Quota),
+		throttles: make(map[int]*ratelimit.Limiter),
+	}, nil
+}
+
+// SetQuota sets the quota of the key, replacing the previous one.
+func (e *QuotaEnforcer) SetQuota(key string, quota Quota) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.quotas[key] = quota
+}
+
+// RemoveQuota removes the quota of the key, so it's no longer limited.
+func (e *QuotaEnforcer) RemoveQuota(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.quotas, key)
+}
+
+// Quota returns the quota of the key. It returns false if the key has no quota.
+func (e *QuotaEnforcer) Quota(key string) (Quota, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	quota, ok := e.quotas[key]
+	return quota, ok
+}
+
+// Check returns whether the key can open a new connection. It returns [ErrKeyExpired] if the key expired, or
+// [ErrDataLimitExceeded] if it used up its data limit and is not throttled.
+func (e *QuotaEnforcer) Check(key string) error {
+	_, err := e.check(key)
+	return err
+}
+
+// check returns the bandwidth the key is throttled to, or zero, and the error of [QuotaEnforcer.Check].
+func (e *QuotaEnforcer) check(key string) (int, error) {
+	quota, ok := e.Quota(key)
+	if !ok {
+		return 0, nil
+	}
+	if !quota.Expiry.IsZero() && !e.now().Before(quota.Expiry) {
+		return 0, ErrKeyExpired
+	}
+	if quota.DataLimit == 0 {
+		return 0, nil
+	}
+	usage, _ := e.store.Usage(key)
+	if usage.TotalBytes() < quota.DataLimit {
+		return 0, nil
+	}
+	if quota.ThrottleBytesPerSecond > 0 {
+		return quota.ThrottleBytesPerSecond, nil
+	}
+	return 0, ErrDataLimitExceeded
+}
+
+// throttle returns the bandwidth limiter for the rate.
+func (e *QuotaEnforcer) throttle(bytesPerSecond int) *ratelimit.Limiter {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	limiter, ok := e.throttles[bytesPerSecond]
+	if !ok {
+		// The limits are positive, so it can't fail.
+		limiter, _ = ratelimit.NewLimiter(ratelimit.Limits{BytesPerSecond: bytesPerSecond})
+		e.throttles[bytesPerSecond] = limiter
+	}
+	return limiter
+}
+
+// WrapConn checks the quota of the key and returns the connection wrapped to record its usage in the store, as
+// with [WrapConn], and throttled if the key is over its data limit with a throttle. It returns the error of
+// [QuotaEnforcer.Check] if the connection is rejected, in which case the caller must close it.
+func (e *QuotaEnforcer) WrapConn(conn net.Conn, key string) (net.Conn, error) {
+	bytesPerSecond, err := e.check(key)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := WrapConn(conn, key, e.store)
+	if bytesPerSecond == 0 {
+		return wrapped, nil
+	}
+	throttled := e.throttle(bytesPerSecond).WrapConn(context.Background(), key, wrapped.(transport.StreamConn))
+	if _, ok := conn.(targetConn); ok {
+		return &throttledTargetConn{StreamConn: throttled, target: conn.(targetConn)}, nil
+	}
+	return throttled, nil
+}
+
+// WrapListener returns a listener that enforces the quota of the key on the connections it accepts, and records
+// their usage in the store. Rejected connections are closed, and reported to [QuotaEnforcer.OnReject].
+func (e *QuotaEnforcer) WrapListener(listener net.Listener, key string) net.Listener {
+	return &quotaListener{Listener: listener, enforcer: e, key: key}
+}
+
+type quotaListener struct {
+	net.Listener
+	enforcer *QuotaEnforcer
+	key      string
+}
+
+func (l *quotaListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := l.enforcer.WrapConn(conn, l.key)
+		if err == nil {
+			return wrapped, nil
+		}
+		conn.Close()
+		if l.enforcer.OnReject != nil {
+			l.enforcer.OnReject(l.key, err)
+		}
+	}
+}
+
+type throttledTargetConn struct {
+	transport.StreamConn
+	target targetConn
+}
+
+func (c *throttledTargetConn) Target() (string, error) {
+	return c.target.Target()
+}
@@ -0,0 +1,125 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounting
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaEnforcer_Check(t *testing.T) {
+	store := NewMemoryStore()
+	e, err := NewQuotaEnforcer(store)
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	e.now = func() time.Time { return now }
+
+	// No quota.
+	store.Add("key", Usage{BytesReceived: 1000})
+	require.NoError(t, e.Check("key"))
+
+	e.SetQuota("key", Quota{DataLimit: 2000})
+	require.NoError(t, e.Check("key"))
+	store.Add("key", Usage{BytesSent: 1000})
+	require.ErrorIs(t, e.Check("key"), ErrDataLimitExceeded)
+
+	// Throttled keys can still connect.
+	e.SetQuota("key", Quota{DataLimit: 2000, ThrottleBytesPerSecond: 1000})
+	require.NoError(t, e.Check("key"))
+
+	e.SetQuota("key", Quota{Expiry: now.Add(time.Second)})
+	require.NoError(t, e.Check("key"))
+	e.SetQuota("key", Quota{Expiry: now})
+	require.ErrorIs(t, e.Check("key"), ErrKeyExpired)
+
+	e.RemoveQuota("key")
+	_, ok := e.Quota("key")
+	require.False(t, ok)
+	require.NoError(t, e.Check("key"))
+
+	_, err = NewQuotaEnforcer(nil)
+	require.Error(t, err)
+}
+
+func TestQuotaEnforcer_WrapListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	store := NewMemoryStore()
+	e, err := NewQuotaEnforcer(store)
+	require.NoError(t, err)
+	e.SetQuota("key", Quota{DataLimit: 5})
+	rejected := make(chan error, 1)
+	e.OnReject = func(key string, err error) {
+		if key != "key" {
+			err = fmt.Errorf("unexpected key %v", key)
+		}
+		rejected <- err
+	}
+	listener = e.WrapListener(listener, "key")
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	// The first connection uses up the data limit.
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("hello"))
+	require.NoError(t, err)
+	conn := <-accepted
+	defer conn.Close()
+	_, err = conn.Read(make([]byte, 5))
+	require.NoError(t, err)
+
+	// The second one is rejected.
+	client2, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer client2.Close()
+	require.ErrorIs(t, <-rejected, ErrDataLimitExceeded)
+	client2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = client2.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrDataLimitExceeded))
+}
+
+func TestQuotaEnforcer_Throttle(t *testing.T) {
+	store := NewMemoryStore()
+	e, err := NewQuotaEnforcer(store)
+	require.NoError(t, err)
+	e.SetQuota("key", Quota{DataLimit: 1, ThrottleBytesPerSecond: 1000})
+	store.Add("key", Usage{BytesReceived: 1})
+
+	conn, err := e.WrapConn(&fakeTargetConn{}, "key")
+	require.NoError(t, err)
+	target, err := conn.(targetConn).Target()
+	require.NoError(t, err)
+	require.Equal(t, "example.com:443", target)
+	usage, _ := store.Usage("key")
+	require.Equal(t, uint64(1), usage.Connections)
+}
@@ -0,0 +1,424 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package antiprobe protects proxy servers from active probing, where a censor connects to suspected servers and
+watches how they react to invalid handshakes.
+
+A [Listener] wraps the server listener and validates the start of each connection with a [Validator] before the
+server sees it. Connections with invalid handshakes, such as a bad Shadowsocks authentication or a malformed SOCKS
+request, never reach the server. They get a configurable [Response] instead, which doesn't reveal the protocol:
+
+	validator, err := antiprobe.NewShadowsocksValidator(key)
+	if err != nil {
+		// handle error
+	}
+	listener, err := antiprobe.NewListener(tcpListener, validator, &antiprobe.Config{
+		Response:     antiprobe.RespondDecoy,
+		Decoy:        &transport.TCPDialer{},
+		DecoyAddress: "localhost:8080",
+		MaxFailures:  10,
+	})
+
+The listener can also limit the connections of each source IP, and stop validating connections from IPs with too
+many invalid handshakes, since they are likely probers.
+
+Server transports over TLS can look like an ordinary HTTPS site. Before TLS, use [NewTLSValidator] with
+[RespondDecoy] to send connections for other server names to a local web server. After TLS, use [DecoyHandler] to
+reverse proxy the unauthenticated requests to the web server.
+*/
+package antiprobe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/ratelimit"
+)
+
+const (
+	// DefaultHandshakeTimeout is the time allowed for the client to send a valid handshake, if not configured.
+	DefaultHandshakeTimeout = 10 * time.Second
+	// DefaultResponseTimeout is how long [RespondTimeout] holds the connection, if not configured.
+	DefaultResponseTimeout = 60 * time.Second
+	// DefaultFailureWindow is the period over which the invalid handshakes of an IP are counted, if not configured.
+	DefaultFailureWindow = 10 * time.Minute
+)
+
+// ErrTooManyFailures is reported for connections from an IP that sent too many invalid handshakes.
+var ErrTooManyFailures = errors.New("too many invalid handshakes")
+
+// Response is how the [Listener] treats a connection that failed the validation.
+type Response int
+
+const (
+	// RespondReadForever reads and discards the data from the client until it closes the connection. The server
+	// never closes first, so the prober can't learn how much data the server expects.
+	RespondReadForever Response = iota
+	// RespondTimeout reads and discards the data from the client for [Config.ResponseTimeout], then closes the
+	// connection.
+	RespondTimeout
+	// RespondDecoy forwards the connection, including the data already received, to a decoy server such as a web
+	// server, so the server looks like the decoy. If the decoy is unreachable, it falls back to [RespondReadForever].
+	RespondDecoy
+)
+
+// String returns the name of the response.
+func (r Response) String() string {
+	switch r {
+	case RespondReadForever:
+		return "ReadForever"
+	case RespondTimeout:
+		return "Timeout"
+	case RespondDecoy:
+		return "Decoy"
+	default:
+		return fmt.Sprintf("Response(%d)", int(r))
+	}
+}
+
+// Config configures a [Listener].
+type Config struct {
+	// HandshakeTimeout is the time allowed to send a valid handshake. If zero, [DefaultHandshakeTimeout] is used.
+	HandshakeTimeout time.Duration
+	// Response is how connections that fail the validation are treated.
+	Response Response
+	// ResponseTimeout is how long [RespondTimeout] holds the connection. If zero, [DefaultResponseTimeout] is used.
+	ResponseTimeout time.Duration
+	// Decoy dials the decoy server of [RespondDecoy].
+	Decoy transport.StreamDialer
+	// DecoyAddress is the address of the decoy server of [RespondDecoy].
+	DecoyAddress string
+	// Limiter limits the connections of each source IP, if not nil. Connections over the limits get the Response
+	// without validation.
+	Limiter *ratelimit.Limiter
+	// MaxFailures is the number of invalid handshakes after which the connections from an IP get the Response
+	// without validation, until the end of the FailureWindow. Handshake timeouts count as failures. If zero,
+	// the failures are not limited.
+	MaxFailures int
+	// FailureWindow is the period over which the failures are counted, starting from the first one. If zero,
+	// [DefaultFailureWindow] is used.
+	FailureWindow time.Duration
+	// OnProbe is called, if not nil, when a connection gets the Response, with the reason.
+	OnProbe func(remoteAddr net.Addr, err error)
+}
+
+// Listener is a [net.Listener] that only accepts the connections that pass the validation. It must be closed to
+// release the connections held by the responses.
+type Listener struct {
+	listener net.Listener
+	validate Validator
+	config   Config
+
+	accepted  chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	// err is the error returned by Accept after done is closed.
+	err error
+
+	mu        sync.Mutex
+	closed    bool
+	handling  map[net.Conn]struct{}
+	failures  map[string]*failureState
+	lastSweep time.Time
+}
+
+type failureState struct {
+	count int
+	start time.Time
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// NewListener creates a [Listener] that accepts connections from listener and validates them with validate.
+// If config is nil, the default configuration is used.
+func NewListener(listener net.Listener, validate Validator, config *Config) (*Listener, error) {
+	if listener == nil {
+		return nil, errors.New("argument listener must not be nil")
+	}
+	if validate == nil {
+		return nil, errors.New("argument validate must not be nil")
+	}
+	l := &Listener{
+		listener: listener,
+		validate: validate,
+		accepted: make(chan net.Conn),
+		done:     make(chan struct{}),
+		handling: make(map[net.Conn]struct{}),
+		failures: make(map[string]*failureState),
+	}
+	if config != nil {
+		l.config = *config
+	}
+	if l.config.HandshakeTimeout == 0 {
+		l.config.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+	if l.config.ResponseTimeout == 0 {
+		l.config.ResponseTimeout = DefaultResponseTimeout
+	}
+	if l.config.FailureWindow == 0 {
+		l.config.FailureWindow = DefaultFailureWindow
+	}
+	if l.config.MaxFailures < 0 {
+		return nil, errors.New("MaxFailures must not be negative")
+	}
+	if l.config.Response == RespondDecoy && (l.config.Decoy == nil || l.config.DecoyAddress == "") {
+		return nil, errors.New("RespondDecoy requires Decoy and DecoyAddress")
+	}
+	go l.acceptLoop()
+	return l, nil
+}
+
+// Accept implements [net.Listener].Accept. It returns the next connection that passed the validation, which is a
+// [*Conn].
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accepted:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Close implements [net.Listener].Close. It also closes the connections being validated or held by a response.
+func (l *Listener) Close() error {
+	l.shutdown(net.ErrClosed)
+	return l.closeErr
+}
+
+// Addr implements [net.Listener].Addr.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *Listener) shutdown(err error) {
+	l.closeOnce.Do(func() {
+		l.err = err
+		close(l.done)
+		l.closeErr = l.listener.Close()
+		l.mu.Lock()
+		l.closed = true
+		for conn := range l.handling {
+			conn.Close()
+		}
+		l.mu.Unlock()
+	})
+}
+
+func (l *Listener) acceptLoop() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			l.shutdown(err)
+			return
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			conn.Close()
+			return
+		}
+		l.handling[conn] = struct{}{}
+		l.mu.Unlock()
+		go l.handle(conn)
+	}
+}
+
+func (l *Listener) untrack(conn net.Conn) {
+	l.mu.Lock()
+	delete(l.handling, conn)
+	l.mu.Unlock()
+}
+
+func (l *Listener) handle(conn net.Conn) {
+	client := clientIP(conn.RemoteAddr())
+	release := func() {}
+	var err error
+	if l.config.Limiter != nil {
+		release, err = l.config.Limiter.Acquire(client)
+		if err != nil {
+			release = func() {}
+		}
+	}
+	if err == nil && l.isBlocked(client) {
+		err = ErrTooManyFailures
+	}
+	recorder := &recordingReader{reader: conn}
+	if err == nil {
+		conn.SetReadDeadline(time.Now().Add(l.config.HandshakeTimeout))
+		err = l.validate(recorder)
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			l.recordFailure(client)
+		}
+	}
+	if err != nil {
+		defer release()
+		defer l.untrack(conn)
+		if l.config.OnProbe != nil {
+			l.config.OnProbe(conn.RemoteAddr(), err)
+		}
+		l.respond(conn, recorder.received)
+		return
+	}
+
+	l.untrack(conn)
+	accepted := &Conn{
+		Conn:    conn,
+		reader:  io.MultiReader(bytes.NewReader(recorder.received), conn),
+		release: release,
+	}
+	select {
+	case l.accepted <- accepted:
+	case <-l.done:
+		accepted.Close()
+	}
+}
+
+func (l *Listener) respond(conn net.Conn, received []byte) {
+	defer conn.Close()
+	switch l.config.Response {
+	case RespondTimeout:
+		conn.SetDeadline(time.Now().Add(l.config.ResponseTimeout))
+	case RespondDecoy:
+		if l.forwardToDecoy(conn, received) {
+			return
+		}
+	}
+	io.Copy(io.Discard, conn)
+}
+
+// forwardToDecoy relays the connection to the decoy server. It returns false if the decoy is unreachable.
+func (l *Listener) forwardToDecoy(conn net.Conn, received []byte) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), l.config.HandshakeTimeout)
+	decoy, err := l.config.Decoy.DialStream(ctx, l.config.DecoyAddress)
+	cancel()
+	if err != nil {
+		return false
+	}
+	defer decoy.Close()
+	if _, err := decoy.Write(received); err != nil {
+		return true
+	}
+	uploadDone := make(chan struct{})
+	go func() {
+		defer close(uploadDone)
+		io.Copy(decoy, conn)
+		decoy.CloseWrite()
+	}()
+	io.Copy(conn, decoy)
+	// The decoy is done, so close like it would.
+	conn.Close()
+	<-uploadDone
+	return true
+}
+
+func (l *Listener) isBlocked(client string) bool {
+	if l.config.MaxFailures == 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state, ok := l.failures[client]
+	return ok && state.count >= l.config.MaxFailures && time.Since(state.start) < l.config.FailureWindow
+}
+
+func (l *Listener) recordFailure(client string) {
+	if l.config.MaxFailures == 0 {
+		return
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Remove the expired states, at most once per window.
+	if now.Sub(l.lastSweep) >= l.config.FailureWindow {
+		l.lastSweep = now
+		for key, state := range l.failures {
+			if now.Sub(state.start) >= l.config.FailureWindow {
+				delete(l.failures, key)
+			}
+		}
+	}
+	state, ok := l.failures[client]
+	if !ok || now.Sub(state.start) >= l.config.FailureWindow {
+		state = &failureState{start: now}
+		l.failures[client] = state
+	}
+	state.count++
+}
+
+func clientIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// recordingReader keeps the data read, so it can be replayed to the server or the decoy.
+type recordingReader struct {
+	reader   io.Reader
+	received []byte
+}
+
+func (r *recordingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.received = append(r.received, b[:n]...)
+	return n, err
+}
+
+// Conn is a connection accepted by a [Listener]. Reads start with the handshake data read by the validation.
+type Conn struct {
+	net.Conn
+	reader    io.Reader
+	release   func()
+	closeOnce sync.Once
+}
+
+var _ transport.StreamConn = (*Conn)(nil)
+
+// Read implements [net.Conn].Read.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// Close implements [net.Conn].Close.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(c.release)
+	return c.Conn.Close()
+}
+
+// CloseRead implements [transport.StreamConn].CloseRead, if supported by the accepted connection.
+func (c *Conn) CloseRead() error {
+	if cr, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+// CloseWrite implements [transport.StreamConn].CloseWrite, if supported by the accepted connection.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
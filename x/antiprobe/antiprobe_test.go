@@ -0,0 +1,247 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package antiprobe
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func newTCPListener(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return listener
+}
+
+// probeRecorder records the probes reported by the listener.
+type probeRecorder struct {
+	mu     sync.Mutex
+	errors []error
+}
+
+func (r *probeRecorder) OnProbe(addr net.Addr, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, err)
+}
+
+func (r *probeRecorder) Errors() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.errors...)
+}
+
+func TestListener_Valid(t *testing.T) {
+	listener, err := NewListener(newTCPListener(t), ValidateSOCKS5, nil)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte{5, 1, 0, 'x'})
+	require.NoError(t, err)
+	require.NoError(t, client.(*net.TCPConn).CloseWrite())
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	require.IsType(t, &Conn{}, conn)
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, []byte{5, 1, 0, 'x'}, data)
+}
+
+func TestListener_RespondTimeout(t *testing.T) {
+	var probes probeRecorder
+	listener, err := NewListener(newTCPListener(t), ValidateSOCKS5, &Config{
+		Response:        RespondTimeout,
+		ResponseTimeout: 100 * time.Millisecond,
+		OnProbe:         probes.OnProbe,
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+
+	start := time.Now()
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := client.Read(make([]byte, 10))
+	require.Zero(t, n)
+	require.ErrorIs(t, err, io.EOF)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	errs := probes.Errors()
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], ErrInvalidHandshake)
+}
+
+func TestListener_RespondReadForever(t *testing.T) {
+	listener, err := NewListener(newTCPListener(t), ValidateSOCKS5, &Config{HandshakeTimeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	// An incomplete handshake times out, but the connection stays open.
+	_, err = client.Write([]byte{5})
+	require.NoError(t, err)
+	client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, err = client.Read(make([]byte, 10))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	// Closing the listener releases the connection.
+	require.NoError(t, listener.Close())
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = client.Read(make([]byte, 10))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	_, err = listener.Accept()
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestListener_RespondDecoy(t *testing.T) {
+	decoy := newTCPListener(t)
+	defer decoy.Close()
+	go func() {
+		conn, err := decoy.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		request, _ := io.ReadAll(conn)
+		conn.Write([]byte("decoy got " + string(request)))
+	}()
+
+	listener, err := NewListener(newTCPListener(t), ValidateSOCKS5, &Config{
+		Response:     RespondDecoy,
+		Decoy:        &transport.TCPDialer{},
+		DecoyAddress: decoy.Addr().String(),
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("GET / HTTP/1.1"))
+	require.NoError(t, err)
+	require.NoError(t, client.(*net.TCPConn).CloseWrite())
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := io.ReadAll(client)
+	require.NoError(t, err)
+	require.Equal(t, "decoy got GET / HTTP/1.1", string(response))
+}
+
+func TestListener_MaxFailures(t *testing.T) {
+	var probes probeRecorder
+	listener, err := NewListener(newTCPListener(t), ValidateSOCKS5, &Config{
+		Response:        RespondTimeout,
+		ResponseTimeout: time.Millisecond,
+		MaxFailures:     2,
+		OnProbe:         probes.OnProbe,
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	dial := func(data []byte) net.Conn {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		_, err = client.Write(data)
+		require.NoError(t, err)
+		return client
+	}
+	for i := 0; i < 2; i++ {
+		client := dial([]byte{4, 1})
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = client.Read(make([]byte, 1))
+		require.ErrorIs(t, err, io.EOF)
+		client.Close()
+	}
+
+	// A valid handshake is rejected now.
+	client := dial([]byte{5, 1, 0})
+	defer client.Close()
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = client.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+
+	errs := probes.Errors()
+	require.Len(t, errs, 3)
+	require.ErrorIs(t, errs[2], ErrTooManyFailures)
+}
+
+func TestListener_Limiter(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(ratelimit.Limits{MaxConnections: 1})
+	require.NoError(t, err)
+	var probes probeRecorder
+	listener, err := NewListener(newTCPListener(t), ValidateSOCKS5, &Config{
+		Response:        RespondTimeout,
+		ResponseTimeout: time.Millisecond,
+		Limiter:         limiter,
+		OnProbe:         probes.OnProbe,
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	first, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	_, err = first.Write([]byte{5, 1, 0})
+	require.NoError(t, err)
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+
+	second, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = second.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+	errs := probes.Errors()
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], ratelimit.ErrLimitExceeded)
+
+	// Closing the accepted connection releases it from the limiter.
+	require.NoError(t, conn.Close())
+	third, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer third.Close()
+	_, err = third.Write([]byte{5, 1, 0})
+	require.NoError(t, err)
+	conn, err = listener.Accept()
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestNewListener_DecoyRequiresAddress(t *testing.T) {
+	listener := newTCPListener(t)
+	defer listener.Close()
+	_, err := NewListener(listener, ValidateSOCKS5, &Config{Response: RespondDecoy})
+	require.Error(t, err)
+}
@@ -0,0 +1,128 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package antiprobe
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// errClientHelloRead stops the TLS handshake of the validation once the ClientHello is read.
+var errClientHelloRead = errors.New("ClientHello read")
+
+// NewTLSValidator returns a [Validator] of TLS connections, which accepts the connections with a ClientHello for one
+// of the server names. Use it with [RespondDecoy] and a local HTTPS web server as the decoy, so that connections with
+// other or no server names reach the web server, and the endpoint looks like an ordinary HTTPS site.
+func NewTLSValidator(serverNames ...string) (Validator, error) {
+	if len(serverNames) == 0 {
+		return nil, errors.New("at least one server name is required")
+	}
+	names := make(map[string]struct{}, len(serverNames))
+	for _, name := range serverNames {
+		names[strings.ToLower(name)] = struct{}{}
+	}
+	return func(r io.Reader) error {
+		var serverName string
+		helloRead := false
+		server := tls.Server(&readOnlyConn{reader: r}, &tls.Config{
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				serverName, helloRead = hello.ServerName, true
+				return nil, errClientHelloRead
+			},
+		})
+		err := server.Handshake()
+		if !helloRead {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, os.ErrDeadlineExceeded) {
+				return fmt.Errorf("failed to read ClientHello: %w", err)
+			}
+			return fmt.Errorf("%w: invalid ClientHello: %w", ErrInvalidHandshake, err)
+		}
+		if _, ok := names[strings.ToLower(serverName)]; !ok {
+			return fmt.Errorf("%w: unexpected server name %q", ErrInvalidHandshake, serverName)
+		}
+		return nil
+	}, nil
+}
+
+// readOnlyConn is a [net.Conn] that reads from a reader and fails writes, to parse the ClientHello with [tls.Server].
+type readOnlyConn struct {
+	reader io.Reader
+}
+
+var _ net.Conn = (*readOnlyConn)(nil)
+
+func (c *readOnlyConn) Read(b []byte) (int, error)         { return c.reader.Read(b) }
+func (c *readOnlyConn) Write(b []byte) (int, error)        { return 0, errors.ErrUnsupported }
+func (c *readOnlyConn) Close() error                       { return nil }
+func (c *readOnlyConn) LocalAddr() net.Addr                { return nil }
+func (c *readOnlyConn) RemoteAddr() net.Addr               { return nil }
+func (c *readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c *readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// DecoyHandler is a [http.Handler] for server transports over HTTPS, such as WebSocket. It passes the authenticated
+// requests to the transport handler, and reverse proxies the other requests to a decoy web server, so that probes
+// see an ordinary website.
+type DecoyHandler struct {
+	authenticate func(req *http.Request) bool
+	next         http.Handler
+	decoy        *httputil.ReverseProxy
+}
+
+var _ http.Handler = (*DecoyHandler)(nil)
+
+// NewDecoyHandler creates a [DecoyHandler] that passes the requests for which authenticate returns true to next,
+// and the others to the web server at decoyURL, such as "http://localhost:8080". The decoy gets the original Host
+// header.
+func NewDecoyHandler(decoyURL string, authenticate func(req *http.Request) bool, next http.Handler) (*DecoyHandler, error) {
+	if authenticate == nil {
+		return nil, errors.New("argument authenticate must not be nil")
+	}
+	if next == nil {
+		return nil, errors.New("argument next must not be nil")
+	}
+	target, err := url.Parse(decoyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decoy URL: %w", err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported decoy URL scheme %q", target.Scheme)
+	}
+	decoy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.Host = r.In.Host
+		},
+	}
+	return &DecoyHandler{authenticate: authenticate, next: next, decoy: decoy}, nil
+}
+
+// ServeHTTP implements [http.Handler].ServeHTTP.
+func (h *DecoyHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if h.authenticate(req) {
+		h.next.ServeHTTP(resp, req)
+		return
+	}
+	h.decoy.ServeHTTP(resp, req)
+}
@@ -0,0 +1,143 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package antiprobe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// clientHello returns the first flight of a TLS client for the server name.
+func clientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+		client.Close()
+	}()
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	require.NoError(t, err)
+	return buf[:n]
+}
+
+func TestTLSValidator(t *testing.T) {
+	validate, err := NewTLSValidator("Proxy.Example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, validate(bytes.NewReader(clientHello(t, "proxy.example.com"))))
+	require.ErrorIs(t, validate(bytes.NewReader(clientHello(t, "other.example.com"))), ErrInvalidHandshake)
+	require.ErrorIs(t, validate(bytes.NewReader(clientHello(t, ""))), ErrInvalidHandshake)
+	require.ErrorIs(t, validate(bytes.NewReader([]byte("GET / HTTP/1.1\r\n\r\n"))), ErrInvalidHandshake)
+
+	hello := clientHello(t, "proxy.example.com")
+	err = validate(bytes.NewReader(hello[:len(hello)/2]))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidHandshake)
+
+	_, err = NewTLSValidator()
+	require.Error(t, err)
+}
+
+func TestListener_TLSDecoy(t *testing.T) {
+	website := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ordinary website")
+	}))
+	defer website.Close()
+	validate, err := NewTLSValidator("proxy.example.com")
+	require.NoError(t, err)
+	listener, err := NewListener(newTCPListener(t), validate, &Config{
+		Response:     RespondDecoy,
+		Decoy:        &transport.TCPDialer{},
+		DecoyAddress: website.Listener.Addr().String(),
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// A probe without the server name gets the website.
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "tcp", listener.Addr().String())
+		},
+		TLSClientConfig: &tls.Config{RootCAs: website.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs},
+	}}
+	resp, err := client.Get("https://example.com/")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "ordinary website", string(body))
+
+	// The client with the server name reaches the server.
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tls.Client(conn, &tls.Config{ServerName: "proxy.example.com", InsecureSkipVerify: true}).Handshake()
+	}()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	require.NoError(t, validate(conn))
+}
+
+func TestDecoyHandler(t *testing.T) {
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "website for "+r.Host)
+	}))
+	defer website.Close()
+	transportHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "transport")
+	})
+	handler, err := NewDecoyHandler(website.URL, func(r *http.Request) bool {
+		return r.URL.Path == "/secret"
+	}, transportHandler)
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(path string) string {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		req.Host = "example.com"
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	require.Equal(t, "transport", get("/secret"))
+	require.Equal(t, "website for example.com", get("/"))
+	require.Equal(t, "website for example.com", get("/secret/other"))
+
+	_, err = NewDecoyHandler("ftp://localhost", func(*http.Request) bool { return true }, transportHandler)
+	require.Error(t, err)
+	_, err = NewDecoyHandler(website.URL, nil, transportHandler)
+	require.Error(t, err)
+}
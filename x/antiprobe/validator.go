@@ -0,0 +1,83 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package antiprobe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks"
+)
+
+// ErrInvalidHandshake is matched by the errors of the validators in this package when the client sent data that is
+// not a valid handshake, as opposed to failing to send a complete one.
+var ErrInvalidHandshake = errors.New("invalid handshake")
+
+// Validator reads the start of a connection and returns an error if it's not a valid handshake of the protocol the
+// server speaks. It must only read as much as it needs, since the bytes it reads are replayed to the server.
+type Validator func(r io.Reader) error
+
+// NewShadowsocksValidator returns a [Validator] of Shadowsocks AEAD connections, which accepts connections
+// encrypted with any of the keys. It authenticates the encrypted length of the first chunk, so it only reads
+// the salt and the length.
+func NewShadowsocksValidator(keys ...*shadowsocks.EncryptionKey) (Validator, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one key is required")
+	}
+	return func(r io.Reader) error {
+		var buf []byte
+		for _, key := range keys {
+			saltSize := key.SaltSize()
+			need := saltSize + 2 + key.TagSize()
+			if len(buf) < need {
+				more := make([]byte, need-len(buf))
+				if _, err := io.ReadFull(r, more); err != nil {
+					return fmt.Errorf("failed to read Shadowsocks header: %w", err)
+				}
+				buf = append(buf, more...)
+			}
+			aead, err := key.NewAEAD(buf[:saltSize])
+			if err != nil {
+				return fmt.Errorf("failed to create cipher: %w", err)
+			}
+			nonce := make([]byte, aead.NonceSize())
+			if _, err := aead.Open(nil, nonce, buf[saltSize:need], nil); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: Shadowsocks authentication failed", ErrInvalidHandshake)
+	}, nil
+}
+
+// ValidateSOCKS5 is a [Validator] of SOCKS5 connections. It reads the method selection message and checks the
+// version and the list of methods.
+func ValidateSOCKS5(r io.Reader) error {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("failed to read SOCKS header: %w", err)
+	}
+	if header[0] != 5 {
+		return fmt.Errorf("%w: unsupported SOCKS version %v", ErrInvalidHandshake, header[0])
+	}
+	if header[1] == 0 {
+		return fmt.Errorf("%w: no SOCKS authentication methods", ErrInvalidHandshake)
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return fmt.Errorf("failed to read SOCKS methods: %w", err)
+	}
+	return nil
+}
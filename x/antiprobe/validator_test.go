@@ -0,0 +1,72 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package antiprobe
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks"
+	"github.com/stretchr/testify/require"
+)
+
+func newShadowsocksHandshake(t *testing.T, key *shadowsocks.EncryptionKey) []byte {
+	var buf bytes.Buffer
+	_, err := shadowsocks.NewWriter(&buf, key).Write([]byte("payload"))
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestShadowsocksValidator(t *testing.T) {
+	key1, err := shadowsocks.NewEncryptionKey("chacha20-ietf-poly1305", "secret1")
+	require.NoError(t, err)
+	key2, err := shadowsocks.NewEncryptionKey("aes-128-gcm", "secret2")
+	require.NoError(t, err)
+	validate, err := NewShadowsocksValidator(key1, key2)
+	require.NoError(t, err)
+
+	for _, key := range []*shadowsocks.EncryptionKey{key1, key2} {
+		handshake := newShadowsocksHandshake(t, key)
+		reader := bytes.NewReader(handshake)
+		require.NoError(t, validate(reader))
+		// Only the salt and the length were read, as sized by the first key.
+		require.Equal(t, len(handshake)-reader.Len(), key1.SaltSize()+2+key1.TagSize())
+	}
+
+	otherKey, err := shadowsocks.NewEncryptionKey("chacha20-ietf-poly1305", "other")
+	require.NoError(t, err)
+	err = validate(bytes.NewReader(newShadowsocksHandshake(t, otherKey)))
+	require.ErrorIs(t, err, ErrInvalidHandshake)
+
+	err = validate(bytes.NewReader([]byte("short")))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.NotErrorIs(t, err, ErrInvalidHandshake)
+
+	_, err = NewShadowsocksValidator()
+	require.Error(t, err)
+}
+
+func TestValidateSOCKS5(t *testing.T) {
+	reader := bytes.NewReader([]byte{5, 2, 0, 2, 5, 1, 0, 1})
+	require.NoError(t, ValidateSOCKS5(reader))
+	require.Equal(t, 4, reader.Len())
+
+	require.ErrorIs(t, ValidateSOCKS5(bytes.NewReader([]byte("GET / HTTP/1.1\r\n"))), ErrInvalidHandshake)
+	require.ErrorIs(t, ValidateSOCKS5(bytes.NewReader([]byte{5, 0})), ErrInvalidHandshake)
+	err := ValidateSOCKS5(bytes.NewReader([]byte{5, 3, 0}))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.NotErrorIs(t, err, ErrInvalidHandshake)
+}
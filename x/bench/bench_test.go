@@ -0,0 +1,106 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func newEchoServerForTest(t testing.TB) *EchoServer {
+	server, err := NewEchoServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestStreamThroughput(t *testing.T) {
+	server := newEchoServerForTest(t)
+	result, err := StreamThroughput(context.Background(), &transport.TCPDialer{}, server.StreamAddr(), 1_000_000)
+	require.NoError(t, err)
+	require.Equal(t, int64(1_000_000), result.Bytes)
+	require.Positive(t, result.Throughput())
+	require.Contains(t, result.String(), "MB/s")
+}
+
+func TestStreamLatency(t *testing.T) {
+	server := newEchoServerForTest(t)
+	result, err := StreamLatency(context.Background(), &transport.TCPDialer{}, server.StreamAddr(), 20)
+	require.NoError(t, err)
+	require.Equal(t, 20, result.Operations)
+	require.Equal(t, 20, result.Latency.Count)
+	require.LessOrEqual(t, result.Latency.Min, result.Latency.P50)
+	require.LessOrEqual(t, result.Latency.P50, result.Latency.Max)
+}
+
+func TestStreamChurn(t *testing.T) {
+	server := newEchoServerForTest(t)
+	result, err := StreamChurn(context.Background(), &transport.TCPDialer{}, server.StreamAddr(), 50, 8)
+	require.NoError(t, err)
+	require.Equal(t, 50, result.Operations)
+	require.Zero(t, result.Errors)
+	require.Equal(t, 50, result.Latency.Count)
+}
+
+func TestStreamChurn_DialErrors(t *testing.T) {
+	dialer := transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		return nil, errors.New("blocked")
+	})
+	result, err := StreamChurn(context.Background(), dialer, "127.0.0.1:9", 10, 2)
+	require.NoError(t, err)
+	require.Equal(t, 10, result.Errors)
+	require.Equal(t, 1.0, result.ErrorRate())
+}
+
+func TestPacketLatency(t *testing.T) {
+	server := newEchoServerForTest(t)
+	result, err := PacketLatency(context.Background(), &transport.UDPDialer{}, server.PacketAddr(), 20, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 20, result.Operations)
+	require.Zero(t, result.Errors)
+	require.Equal(t, 20, result.Latency.Count)
+}
+
+func TestNewLatencyStats(t *testing.T) {
+	samples := make([]time.Duration, 0, 100)
+	for i := 100; i > 0; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	stats := newLatencyStats(samples)
+	require.Equal(t, LatencyStats{
+		Count: 100,
+		Min:   1 * time.Millisecond,
+		Mean:  50500 * time.Microsecond,
+		P50:   50 * time.Millisecond,
+		P90:   90 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+		Max:   100 * time.Millisecond,
+	}, stats)
+	require.Equal(t, LatencyStats{}, newLatencyStats(nil))
+}
+
+func BenchmarkTCPDialer(b *testing.B) {
+	server := newEchoServerForTest(b)
+	for i := 0; i < b.N; i++ {
+		result, err := StreamChurn(context.Background(), &transport.TCPDialer{}, server.StreamAddr(), 100, 10)
+		require.NoError(b, err)
+		b.ReportMetric(float64(result.Latency.P50.Microseconds()), "p50-µs")
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package bench provides benchmarks to measure the performance of [transport.StreamDialer] and
+[transport.PacketDialer] implementations, so transport authors can compare implementations and catch
+performance regressions.
+
+The benchmarks exchange data with an echo server. You can use [NewEchoServer] for an in-process one:
+
+	server, err := bench.NewEchoServer()
+	if err != nil {
+		// handle error
+	}
+	defer server.Close()
+	result, err := bench.StreamThroughput(ctx, dialer, server.StreamAddr(), 10_000_000)
+	if err != nil {
+		// handle error
+	}
+	fmt.Println(result)
+
+The available benchmarks are:
+  - [StreamThroughput] measures the transfer rate of a single stream connection.
+  - [StreamLatency] measures the round-trip time of small messages in a single stream connection.
+  - [StreamChurn] measures the time to establish many short-lived stream connections.
+  - [PacketLatency] measures the round-trip time of small packets, and the packet loss.
+*/
+package bench
@@ -0,0 +1,120 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// EchoServer is an in-process server that echoes back everything it receives, over TCP and UDP.
+type EchoServer struct {
+	listener   net.Listener
+	packetConn net.PacketConn
+
+	mu     sync.Mutex
+	closed bool
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+}
+
+// NewEchoServer starts an [EchoServer] on the loopback interface.
+func NewEchoServer() (*EchoServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on TCP: %w", err)
+	}
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen on UDP: %w", err)
+	}
+	s := &EchoServer{listener: listener, packetConn: packetConn, conns: make(map[net.Conn]struct{})}
+	s.wg.Add(2)
+	go s.serveStream()
+	go s.servePacket()
+	return s, nil
+}
+
+// StreamAddr returns the TCP address of the server.
+func (s *EchoServer) StreamAddr() string {
+	return s.listener.Addr().String()
+}
+
+// PacketAddr returns the UDP address of the server.
+func (s *EchoServer) PacketAddr() string {
+	return s.packetConn.LocalAddr().String()
+}
+
+// Close stops the server and closes all its connections.
+func (s *EchoServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	err := errors.Join(s.listener.Close(), s.packetConn.Close())
+	s.wg.Wait()
+	return err
+}
+
+func (s *EchoServer) serveStream() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			io.Copy(conn, conn)
+			if tcpConn, ok := conn.(*net.TCPConn); ok {
+				tcpConn.CloseWrite()
+			}
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (s *EchoServer) servePacket() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		s.packetConn.WriteTo(buf[:n], addr)
+	}
+}
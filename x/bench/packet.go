@@ -0,0 +1,82 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// PacketLatency sends count small packets, one after the other, to the echo server at addr, and measures the
+// round-trip time of each. Packets without a response after timeout are counted as errors.
+func PacketLatency(ctx context.Context, dialer transport.PacketDialer, addr string, count int, timeout time.Duration) (*Result, error) {
+	start := time.Now()
+	conn, err := dialer.DialPacket(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	samples := make([]time.Duration, 0, count)
+	errorCount := 0
+	msg := make([]byte, 8)
+	buf := make([]byte, 1500)
+	for i := 0; i < count; i++ {
+		// Number the packets, so late responses to previous packets are ignored.
+		binary.BigEndian.PutUint64(msg, uint64(i))
+		rtStart := time.Now()
+		if _, err := conn.Write(msg); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errorCount++
+			continue
+		}
+		conn.SetReadDeadline(rtStart.Add(timeout))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				var netErr net.Error
+				if !errors.As(err, &netErr) || !netErr.Timeout() {
+					return nil, fmt.Errorf("failed to read: %w", err)
+				}
+				errorCount++
+				break
+			}
+			if n == len(msg) && binary.BigEndian.Uint64(buf) == uint64(i) {
+				samples = append(samples, time.Since(rtStart))
+				break
+			}
+		}
+	}
+	return &Result{
+		Name:       "PacketLatency",
+		Operations: count,
+		Errors:     errorCount,
+		Duration:   time.Since(start),
+		Latency:    newLatencyStats(samples),
+	}, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Result holds the measurements of a benchmark.
+type Result struct {
+	// Name identifies the benchmark.
+	Name string
+	// Operations is the number of operations attempted, such as round trips or connections.
+	Operations int
+	// Errors is the number of failed operations. For packets, that includes lost packets.
+	Errors int
+	// Bytes is the number of bytes transferred in each direction.
+	Bytes int64
+	// Duration is the total time of the benchmark.
+	Duration time.Duration
+	// Latency summarizes the duration of the successful operations.
+	Latency LatencyStats
+}
+
+// Throughput returns the transfer rate in bytes per second.
+func (r *Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// ErrorRate returns the fraction of operations that failed.
+func (r *Result) ErrorRate() float64 {
+	if r.Operations == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Operations)
+}
+
+// String returns a human-readable summary of the result.
+func (r *Result) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v: %v ops in %v", r.Name, r.Operations, r.Duration.Round(time.Millisecond))
+	if r.Errors > 0 {
+		fmt.Fprintf(&b, ", %v errors (%.1f%%)", r.Errors, 100*r.ErrorRate())
+	}
+	if r.Bytes > 0 {
+		fmt.Fprintf(&b, ", %.2f MB/s", r.Throughput()/1e6)
+	}
+	if r.Latency.Count > 0 {
+		fmt.Fprintf(&b, ", latency %v", &r.Latency)
+	}
+	return b.String()
+}
+
+// LatencyStats summarizes a set of latency samples.
+type LatencyStats struct {
+	Count int
+	Min   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// String returns a human-readable summary of the latencies.
+func (s *LatencyStats) String() string {
+	return fmt.Sprintf("min=%v mean=%v p50=%v p90=%v p99=%v max=%v", s.Min, s.Mean, s.P50, s.P90, s.P99, s.Max)
+}
+
+// newLatencyStats computes the stats of the samples. It sorts samples in place.
+func newLatencyStats(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	slices.Sort(samples)
+	var total time.Duration
+	for _, sample := range samples {
+		total += sample
+	}
+	percentile := func(p int) time.Duration {
+		return samples[(len(samples)-1)*p/100]
+	}
+	return LatencyStats{
+		Count: len(samples),
+		Min:   samples[0],
+		Mean:  total / time.Duration(len(samples)),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+		Max:   samples[len(samples)-1],
+	}
+}
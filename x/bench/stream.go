@@ -0,0 +1,185 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// StreamThroughput sends size bytes over a single connection to the echo server at addr, and reads them back
+// concurrently. The result has the transfer rate in each direction.
+func StreamThroughput(ctx context.Context, dialer transport.StreamDialer, addr string, size int64) (*Result, error) {
+	start := time.Now()
+	conn, err := dialer.DialStream(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var writeErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		chunk := make([]byte, 32*1024)
+		for i := range chunk {
+			chunk[i] = byte(i)
+		}
+		_, writeErr = io.Copy(conn, io.LimitReader(repeatReader(chunk), size))
+		if writeErr == nil {
+			writeErr = conn.CloseWrite()
+		}
+	}()
+	received, readErr := io.Copy(io.Discard, conn)
+	wg.Wait()
+	duration := time.Since(start)
+	if err := errors.Join(writeErr, readErr, ctx.Err()); err != nil {
+		return nil, err
+	}
+	if received != size {
+		return nil, fmt.Errorf("received %v bytes, expected %v", received, size)
+	}
+	return &Result{Name: "StreamThroughput", Operations: 1, Bytes: size, Duration: duration}, nil
+}
+
+// repeatReader returns a reader that repeats chunk forever.
+func repeatReader(chunk []byte) io.Reader {
+	return &repeater{chunk: chunk}
+}
+
+type repeater struct {
+	chunk  []byte
+	offset int
+}
+
+func (r *repeater) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.chunk[r.offset:])
+		n += copied
+		r.offset = (r.offset + copied) % len(r.chunk)
+	}
+	return n, nil
+}
+
+// StreamLatency measures the round-trip time of count small messages sent one after the other over a single
+// connection to the echo server at addr.
+func StreamLatency(ctx context.Context, dialer transport.StreamDialer, addr string, count int) (*Result, error) {
+	start := time.Now()
+	conn, err := dialer.DialStream(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	samples := make([]time.Duration, 0, count)
+	msg := []byte("ping")
+	buf := make([]byte, len(msg))
+	for i := 0; i < count; i++ {
+		rtStart := time.Now()
+		if _, err := conn.Write(msg); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to write: %w", err), ctx.Err())
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to read: %w", err), ctx.Err())
+		}
+		samples = append(samples, time.Since(rtStart))
+	}
+	return &Result{
+		Name:       "StreamLatency",
+		Operations: count,
+		Duration:   time.Since(start),
+		Latency:    newLatencyStats(samples),
+	}, nil
+}
+
+// StreamChurn opens count short-lived connections to the echo server at addr, with up to concurrency of them at
+// a time. Each connection does one round trip and is closed. The latency is the time to connect and do the round
+// trip. Failed connections are counted as errors.
+func StreamChurn(ctx context.Context, dialer transport.StreamDialer, addr string, count int, concurrency int) (*Result, error) {
+	if concurrency < 1 {
+		return nil, errors.New("concurrency must be at least 1")
+	}
+	start := time.Now()
+	var mu sync.Mutex
+	samples := make([]time.Duration, 0, count)
+	errorCount := 0
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			connStart := time.Now()
+			err := streamRoundTrip(ctx, dialer, addr)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errorCount++
+				return
+			}
+			samples = append(samples, time.Since(connStart))
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &Result{
+		Name:       "StreamChurn",
+		Operations: count,
+		Errors:     errorCount,
+		Duration:   time.Since(start),
+		Latency:    newLatencyStats(samples),
+	}, nil
+}
+
+func streamRoundTrip(ctx context.Context, dialer transport.StreamDialer, addr string) error {
+	conn, err := dialer.DialStream(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	msg := []byte("hello")
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if !bytes.Equal(msg, buf) {
+		return errors.New("echo mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compression implements a transport that compresses streams with zstd or snappy, for
+// text-heavy traffic on slow or metered links.
+//
+// Compression only helps before encryption, since encrypted data doesn't compress. Use it on top
+// of the encrypted channel and below a proxy protocol that doesn't encrypt, like SOCKS5 over TLS
+// ("tls|compress|socks5://..." in [configurl]), or have the app use it directly. Compressing
+// secrets together with attacker-controlled data leaks information about the secrets through the
+// size of the messages, as in the CRIME and BREACH attacks, so don't compress traffic that mixes them.
+//
+// The client sends a header with the algorithm it uses for the upstream, followed by the algorithms
+// it accepts for the downstream, and starts sending compressed data right away. The server replies
+// with the downstream algorithm, which is the first of the accepted ones that it supports, or
+// [None] if there's none. The peers must be created with [NewStreamDialer] and [NewServerConn] or
+// [NewListener], and the server must support the upstream algorithm of the client.
+//
+// Each write is compressed and flushed, so interactive protocols work as usual, at the cost of a
+// lower compression ratio for small writes.
+//
+// [configurl]: https://pkg.go.dev/github.com/Jigsaw-Code/outline-sdk/x/configurl
+package compression
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithm is a compression algorithm.
+type Algorithm uint8
+
+const (
+	// None sends the data uncompressed.
+	None Algorithm = 0
+	// Zstd compresses the data with zstd.
+	Zstd Algorithm = 1
+	// Snappy compresses the data with the snappy framing format. It's faster than zstd, but compresses less.
+	Snappy Algorithm = 2
+)
+
+// protocolVersion is the version of the header sent by the client.
+const protocolVersion = 1
+
+const (
+	// zstdWindowSize is the window of the zstd encoder. It limits the memory used per connection.
+	zstdWindowSize = 1 << 20
+	// zstdMaxWindowSize is the largest window the zstd decoder accepts from the peer.
+	zstdMaxWindowSize = 8 << 20
+)
+
+// String returns the name of the algorithm, as accepted by [ParseAlgorithm].
+func (a Algorithm) String() string {
+	switch a {
+	case None:
+		return "none"
+	case Zstd:
+		return "zstd"
+	case Snappy:
+		return "snappy"
+	default:
+		return fmt.Sprintf("Algorithm(%d)", uint8(a))
+	}
+}
+
+// ParseAlgorithm returns the algorithm with the given name: "none", "zstd" or "snappy".
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "none":
+		return None, nil
+	case "zstd":
+		return Zstd, nil
+	case "snappy":
+		return Snappy, nil
+	default:
+		return None, fmt.Errorf("unsupported compression algorithm %q", name)
+	}
+}
+
+func (a Algorithm) supported() bool {
+	return a == None || a == Zstd || a == Snappy
+}
+
+func checkAlgorithms(algorithms []Algorithm) error {
+	if len(algorithms) == 0 {
+		return errors.New("must specify at least one algorithm")
+	}
+	if len(algorithms) > 255 {
+		return fmt.Errorf("too many algorithms: %v", len(algorithms))
+	}
+	for _, a := range algorithms {
+		if !a.supported() {
+			return fmt.Errorf("unsupported compression algorithm %v", a)
+		}
+	}
+	return nil
+}
+
+// compressor compresses the data written to it. Flush writes the pending data to the underlying writer.
+type compressor interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+func newCompressor(a Algorithm, w io.Writer) (compressor, error) {
+	switch a {
+	case None:
+		return nopCompressor{w}, nil
+	case Zstd:
+		return zstd.NewWriter(w,
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(zstdWindowSize),
+			zstd.WithEncoderLevel(zstd.SpeedDefault))
+	case Snappy:
+		return s2.NewWriter(w, s2.WriterSnappyCompat(), s2.WriterConcurrency(1)), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %v", a)
+	}
+}
+
+// newDecompressor returns a reader that decompresses the data read from r, and a function to release its resources.
+func newDecompressor(a Algorithm, r io.Reader) (io.Reader, func(), error) {
+	switch a {
+	case None:
+		return r, func() {}, nil
+	case Zstd:
+		// With a concurrency of 1, the decoder decodes in the calling goroutine, so it returns the data of
+		// each block as soon as it arrives.
+		d, err := zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxWindow(zstdMaxWindowSize))
+		if err != nil {
+			return nil, nil, err
+		}
+		return d, d.Close, nil
+	case Snappy:
+		return s2.NewReader(r), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported compression algorithm %v", a)
+	}
+}
+
+type nopCompressor struct {
+	io.Writer
+}
+
+func (nopCompressor) Flush() error { return nil }
+func (nopCompressor) Close() error { return nil }
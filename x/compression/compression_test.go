@@ -0,0 +1,212 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	for _, a := range []Algorithm{None, Zstd, Snappy} {
+		parsed, err := ParseAlgorithm(strings.ToUpper(a.String()))
+		require.NoError(t, err)
+		require.Equal(t, a, parsed)
+	}
+	_, err := ParseAlgorithm("gzip")
+	require.Error(t, err)
+	require.Equal(t, "Algorithm(9)", Algorithm(9).String())
+}
+
+func TestNewStreamDialer_Validation(t *testing.T) {
+	_, err := NewStreamDialer(nil, Zstd)
+	require.Error(t, err)
+	_, err = NewStreamDialer(&transport.TCPDialer{})
+	require.Error(t, err)
+	_, err = NewStreamDialer(&transport.TCPDialer{}, Zstd, Algorithm(9))
+	require.Error(t, err)
+	_, err = NewServerConn(nil, Zstd)
+	require.Error(t, err)
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, a := range []Algorithm{None, Zstd, Snappy} {
+		t.Run(a.String(), func(t *testing.T) {
+			server := startEchoServer(t, a)
+			var sent atomic.Int64
+			dialer, err := NewStreamDialer(&countingDialer{&transport.TCPDialer{}, &sent}, a)
+			require.NoError(t, err)
+			conn, err := dialer.DialStream(context.Background(), server.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			// Each write must get to the server right away, for interactive protocols.
+			for _, message := range []string{"ping", "pong", strings.Repeat("x", 100_000)} {
+				_, err = conn.Write([]byte(message))
+				require.NoError(t, err)
+				echo := make([]byte, len(message))
+				_, err = io.ReadFull(conn, echo)
+				require.NoError(t, err)
+				require.Equal(t, message, string(echo))
+			}
+			if a == None {
+				require.Greater(t, sent.Load(), int64(100_000))
+			} else {
+				require.Less(t, sent.Load(), int64(10_000))
+			}
+
+			// Half-close ends the compressed stream, and the server closes after echoing everything.
+			require.NoError(t, conn.CloseWrite())
+			rest, err := io.ReadAll(conn)
+			require.NoError(t, err)
+			require.Empty(t, rest)
+		})
+	}
+}
+
+func TestNegotiation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		client []Algorithm
+		server []Algorithm
+	}{
+		{name: "client preference", client: []Algorithm{Snappy, Zstd}, server: []Algorithm{Zstd, Snappy}},
+		{name: "downstream fallback", client: []Algorithm{Zstd, Snappy}, server: []Algorithm{Snappy, Zstd}},
+		{name: "no common algorithm", client: []Algorithm{None}, server: []Algorithm{Zstd}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clientConn, serverConn := newTCPPair(t)
+			client, err := newClientConn(clientConn, tc.client)
+			require.NoError(t, err)
+			server, err := NewServerConn(serverConn, tc.server...)
+			require.NoError(t, err)
+
+			go func() {
+				// The server can speak first.
+				server.Write([]byte("hello"))
+				server.CloseWrite()
+			}()
+			received, err := io.ReadAll(client)
+			require.NoError(t, err)
+			require.Equal(t, "hello", string(received))
+		})
+	}
+}
+
+func TestServerHandshake(t *testing.T) {
+	var reply bytes.Buffer
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{bytes.NewReader([]byte{protocolVersion, byte(Snappy), 3, byte(Zstd), byte(Snappy), byte(None)}), &reply}
+	upstream, downstream, err := serverHandshake(rw, []Algorithm{Snappy})
+	require.NoError(t, err)
+	require.Equal(t, Snappy, upstream)
+	require.Equal(t, Snappy, downstream)
+	require.Equal(t, []byte{byte(Snappy)}, reply.Bytes())
+}
+
+func TestUnsupportedUpstream(t *testing.T) {
+	clientConn, serverConn := newTCPPair(t)
+	client, err := newClientConn(clientConn, []Algorithm{Zstd})
+	require.NoError(t, err)
+	server, err := NewServerConn(serverConn, Snappy)
+	require.NoError(t, err)
+
+	_, err = client.Write([]byte("data"))
+	require.NoError(t, err)
+	_, err = server.Read(make([]byte, 10))
+	require.ErrorContains(t, err, "unsupported upstream compression algorithm zstd")
+}
+
+func TestServerConn_BadVersion(t *testing.T) {
+	clientConn, serverConn := newTCPPair(t)
+	server, err := NewServerConn(serverConn, Zstd)
+	require.NoError(t, err)
+	_, err = clientConn.Write([]byte{2, 1, 1, 1})
+	require.NoError(t, err)
+	_, err = server.Read(make([]byte, 10))
+	require.ErrorContains(t, err, "unsupported compression protocol version 2")
+}
+
+/********** Test Utilities **********/
+
+func startEchoServer(t *testing.T, algorithms ...Algorithm) net.Listener {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := NewListener(tcpListener, algorithms...)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+				conn.(transport.StreamConn).CloseWrite()
+			}()
+		}
+	}()
+	return listener
+}
+
+func newTCPPair(t *testing.T) (transport.StreamConn, transport.StreamConn) {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+	clientConn, err := net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	require.NoError(t, err)
+	t.Cleanup(func() { clientConn.Close() })
+	serverConn, err := listener.AcceptTCP()
+	require.NoError(t, err)
+	t.Cleanup(func() { serverConn.Close() })
+	return clientConn, serverConn
+}
+
+// countingDialer counts the bytes written to the connections it creates.
+type countingDialer struct {
+	transport.StreamDialer
+	written *atomic.Int64
+}
+
+func (d *countingDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	conn, err := d.StreamDialer.DialStream(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return transport.WrapConn(conn, conn, &countingWriter{conn, d.written}), nil
+}
+
+type countingWriter struct {
+	io.Writer
+	written *atomic.Int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.written.Add(int64(n))
+	return n, err
+}
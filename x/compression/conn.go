@@ -0,0 +1,104 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"io"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// compressedConn is a [transport.StreamConn] that compresses the data written to it and decompresses the
+// data read from it. The compressor and decompressor are created lazily by the setup functions, so that
+// the handshake can happen on the first read or write.
+type compressedConn struct {
+	transport.StreamConn
+
+	readOnce   sync.Once
+	setupRead  func() (io.Reader, func(), error)
+	reader     io.Reader
+	release    func()
+	readErr    error
+	writeOnce  sync.Once
+	setupWrite func() (compressor, error)
+	writeMu    sync.Mutex
+	writer     compressor
+	writeErr   error
+}
+
+var _ transport.StreamConn = (*compressedConn)(nil)
+
+func (c *compressedConn) initReader() error {
+	c.readOnce.Do(func() {
+		c.reader, c.release, c.readErr = c.setupRead()
+	})
+	return c.readErr
+}
+
+func (c *compressedConn) initWriter() error {
+	c.writeOnce.Do(func() {
+		c.writer, c.writeErr = c.setupWrite()
+	})
+	return c.writeErr
+}
+
+// Read implements [io.Reader].
+func (c *compressedConn) Read(b []byte) (int, error) {
+	if err := c.initReader(); err != nil {
+		return 0, err
+	}
+	if c.release == nil {
+		// The decompressor was released after an error.
+		return 0, c.readErr
+	}
+	n, err := c.reader.Read(b)
+	if err != nil {
+		// Release the decompressor here rather than on Close, since Close can be called concurrently with Read.
+		c.readErr = err
+		c.release()
+		c.release = nil
+	}
+	return n, err
+}
+
+// Write implements [io.Writer]. It compresses the data and flushes it to the underlying connection.
+func (c *compressedConn) Write(b []byte) (int, error) {
+	if err := c.initWriter(); err != nil {
+		return 0, err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	n, err := c.writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, c.writer.Flush()
+}
+
+// CloseWrite implements [transport.StreamConn]. It ends the compressed stream before closing the write
+// end of the underlying connection.
+func (c *compressedConn) CloseWrite() error {
+	if err := c.initWriter(); err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	err := c.writer.Close()
+	c.writeMu.Unlock()
+	if closeErr := c.StreamConn.CloseWrite(); err == nil {
+		err = closeErr
+	}
+	return err
+}
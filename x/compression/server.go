@@ -0,0 +1,149 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// NewServerConn wraps a connection accepted from a client created with [NewStreamDialer]. The downstream is
+// compressed with the first of the client's accepted algorithms that is in algorithms, or not at all if
+// there's none. Connections with an upstream algorithm not in algorithms fail on the first read or write.
+//
+// The handshake happens on the first read or write, so it doesn't block the caller.
+func NewServerConn(conn transport.StreamConn, algorithms ...Algorithm) (transport.StreamConn, error) {
+	if conn == nil {
+		return nil, errors.New("argument conn must not be nil")
+	}
+	if err := checkAlgorithms(algorithms); err != nil {
+		return nil, err
+	}
+	return newServerConn(conn, slices.Clone(algorithms)), nil
+}
+
+func newServerConn(conn transport.StreamConn, algorithms []Algorithm) transport.StreamConn {
+	var handshakeOnce sync.Once
+	var upstream, downstream Algorithm
+	var handshakeErr error
+	handshake := func() error {
+		handshakeOnce.Do(func() {
+			upstream, downstream, handshakeErr = serverHandshake(conn, algorithms)
+		})
+		return handshakeErr
+	}
+	c := &compressedConn{StreamConn: conn}
+	c.setupRead = func() (io.Reader, func(), error) {
+		if err := handshake(); err != nil {
+			return nil, nil, err
+		}
+		return newDecompressor(upstream, conn)
+	}
+	c.setupWrite = func() (compressor, error) {
+		if err := handshake(); err != nil {
+			return nil, err
+		}
+		return newCompressor(downstream, conn)
+	}
+	return c
+}
+
+// serverHandshake reads the client header and replies with the downstream algorithm.
+func serverHandshake(conn io.ReadWriter, algorithms []Algorithm) (upstream Algorithm, downstream Algorithm, err error) {
+	var header [3]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return None, None, fmt.Errorf("failed to read compression header: %w", err)
+	}
+	if header[0] != protocolVersion {
+		return None, None, fmt.Errorf("unsupported compression protocol version %v", header[0])
+	}
+	upstream = Algorithm(header[1])
+	if !slices.Contains(algorithms, upstream) && upstream != None {
+		return None, None, fmt.Errorf("unsupported upstream compression algorithm %v", upstream)
+	}
+	accepted := make([]byte, header[2])
+	if _, err := io.ReadFull(conn, accepted); err != nil {
+		return None, None, fmt.Errorf("failed to read compression header: %w", err)
+	}
+	downstream = None
+	for _, a := range accepted {
+		if slices.Contains(algorithms, Algorithm(a)) {
+			downstream = Algorithm(a)
+			break
+		}
+	}
+	if _, err := conn.Write([]byte{byte(downstream)}); err != nil {
+		return None, None, fmt.Errorf("failed to write compression reply: %w", err)
+	}
+	return upstream, downstream, nil
+}
+
+type listener struct {
+	net.Listener
+	algorithms []Algorithm
+}
+
+var _ net.Listener = (*listener)(nil)
+
+// NewListener creates a [net.Listener] that wraps the connections accepted by l with [NewServerConn].
+// The handshake happens on the first read or write, so slow clients don't block Accept.
+func NewListener(l net.Listener, algorithms ...Algorithm) (net.Listener, error) {
+	if l == nil {
+		return nil, errors.New("argument l must not be nil")
+	}
+	if err := checkAlgorithms(algorithms); err != nil {
+		return nil, err
+	}
+	return &listener{Listener: l, algorithms: slices.Clone(algorithms)}, nil
+}
+
+// Accept implements [net.Listener].Accept.
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	streamConn, ok := conn.(transport.StreamConn)
+	if !ok {
+		streamConn = &halfCloseConn{conn}
+	}
+	return newServerConn(streamConn, l.algorithms), nil
+}
+
+// halfCloseConn adapts a [net.Conn] to a [transport.StreamConn], for connections like [crypto/tls.Conn] that
+// only support some of the half-close methods.
+type halfCloseConn struct {
+	net.Conn
+}
+
+func (c *halfCloseConn) CloseRead() error {
+	if closer, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return closer.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+func (c *halfCloseConn) CloseWrite() error {
+	if closer, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return closer.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
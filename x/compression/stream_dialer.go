@@ -0,0 +1,90 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// StreamDialer is a [transport.StreamDialer] that compresses the connections of a base dialer.
+type StreamDialer struct {
+	dialer     transport.StreamDialer
+	algorithms []Algorithm
+}
+
+var _ transport.StreamDialer = (*StreamDialer)(nil)
+
+// NewStreamDialer creates a [StreamDialer] that compresses the connections created by dialer. The first of the
+// algorithms is used for the upstream, and must be supported by the server. All the algorithms are accepted for
+// the downstream, in order of preference. Include [None] to allow servers that don't compress the downstream.
+func NewStreamDialer(dialer transport.StreamDialer, algorithms ...Algorithm) (*StreamDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if err := checkAlgorithms(algorithms); err != nil {
+		return nil, err
+	}
+	return &StreamDialer{dialer: dialer, algorithms: slices.Clone(algorithms)}, nil
+}
+
+// DialStream implements [transport.StreamDialer].DialStream.
+func (d *StreamDialer) DialStream(ctx context.Context, remoteAddr string) (transport.StreamConn, error) {
+	innerConn, err := d.dialer.DialStream(ctx, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newClientConn(innerConn, d.algorithms)
+	if err != nil {
+		innerConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func newClientConn(conn transport.StreamConn, algorithms []Algorithm) (transport.StreamConn, error) {
+	header := make([]byte, 0, 3+len(algorithms))
+	header = append(header, protocolVersion, byte(algorithms[0]), byte(len(algorithms)))
+	for _, a := range algorithms {
+		header = append(header, byte(a))
+	}
+	// Send the header right away, so the server can reply even if the app waits for it to speak first.
+	if _, err := conn.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write compression header: %w", err)
+	}
+	writer, err := newCompressor(algorithms[0], conn)
+	if err != nil {
+		return nil, err
+	}
+	c := &compressedConn{StreamConn: conn}
+	c.writeOnce.Do(func() { c.writer = writer })
+	c.setupRead = func() (io.Reader, func(), error) {
+		var reply [1]byte
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return nil, nil, fmt.Errorf("failed to read compression reply: %w", err)
+		}
+		downstream := Algorithm(reply[0])
+		if !slices.Contains(algorithms, downstream) {
+			return nil, nil, fmt.Errorf("server selected unexpected compression algorithm %v", downstream)
+		}
+		return newDecompressor(downstream, conn)
+	}
+	return c, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/compression"
+)
+
+// parseCompressionAlgorithms parses the "algorithms" option of the compress config, which defaults to "zstd,snappy".
+func parseCompressionAlgorithms(configURL url.URL) ([]compression.Algorithm, error) {
+	values, err := url.ParseQuery(configURL.Opaque)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{"zstd", "snappy"}
+	for key, values := range values {
+		switch strings.ToLower(key) {
+		case "algorithms":
+			if len(values) != 1 {
+				return nil, fmt.Errorf("algorithms option must have one value, found %v", len(values))
+			}
+			names = strings.Split(values[0], ",")
+		default:
+			return nil, fmt.Errorf("unsupported option %v", key)
+		}
+	}
+	algorithms := make([]compression.Algorithm, 0, len(names))
+	for _, name := range names {
+		algorithm, err := compression.ParseAlgorithm(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		algorithms = append(algorithms, algorithm)
+	}
+	return algorithms, nil
+}
+
+func registerCompressStreamDialer(r TypeRegistry[transport.StreamDialer], typeID string, newSD BuildFunc[transport.StreamDialer]) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.StreamDialer, error) {
+		sd, err := newSD(ctx, config.BaseConfig)
+		if err != nil {
+			return nil, err
+		}
+		algorithms, err := parseCompressionAlgorithms(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		return compression.NewStreamDialer(sd, algorithms...)
+	})
+}
+
+func registerCompressStreamListener(r TypeRegistry[StreamListener], typeID string, newSL BuildFunc[StreamListener]) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (StreamListener, error) {
+		sl, err := newSL(ctx, config.BaseConfig)
+		if err != nil {
+			return nil, err
+		}
+		algorithms, err := parseCompressionAlgorithms(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		return FuncStreamListener(func(ctx context.Context) (net.Listener, error) {
+			baseListener, err := sl.ListenStream(ctx)
+			if err != nil {
+				return nil, err
+			}
+			listener, err := compression.NewListener(baseListener, algorithms...)
+			if err != nil {
+				baseListener.Close()
+				return nil, err
+			}
+			return listener, nil
+		}), nil
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/compression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCompressionAlgorithms(t *testing.T) {
+	algorithms, err := parseCompressionAlgorithms(mustParseURL(t, "compress"))
+	require.NoError(t, err)
+	require.Equal(t, []compression.Algorithm{compression.Zstd, compression.Snappy}, algorithms)
+
+	algorithms, err = parseCompressionAlgorithms(mustParseURL(t, "compress:algorithms=snappy,none"))
+	require.NoError(t, err)
+	require.Equal(t, []compression.Algorithm{compression.Snappy, compression.None}, algorithms)
+
+	_, err = parseCompressionAlgorithms(mustParseURL(t, "compress:algorithms=gzip"))
+	require.Error(t, err)
+	_, err = parseCompressionAlgorithms(mustParseURL(t, "compress:level=3"))
+	require.Error(t, err)
+}
+
+func TestNewStreamListener_Compress(t *testing.T) {
+	providers := NewDefaultProviders()
+	sl, err := providers.NewStreamListener(context.Background(), "compress:algorithms=snappy,zstd&listen=127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := sl.ListenStream(context.Background())
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+				conn.(transport.StreamConn).CloseWrite()
+			}()
+		}
+	}()
+
+	dialer, err := providers.NewStreamDialer(context.Background(), "compress:algorithms=zstd,snappy")
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "Request", requestEcho(t, conn))
+}
+
+/********** Test Utilities **********/
+
+func mustParseURL(t *testing.T, configText string) url.URL {
+	config, err := ParseConfig(configText)
+	require.NoError(t, err)
+	return config.URL
+}
@@ -69,20 +69,26 @@ func (p *ExtensibleProvider[ObjectType]) RegisterType(subtype string, newInstanc
 }
 
 // NewInstance creates a new instance of ObjectType according to the config.
+// Stream dialers, packet dialers, packet listeners and stream listeners created from a non-nil config implement [Describer].
+// If ctx has a tracer from [github.com/Jigsaw-Code/outline-sdk/x/tracing.WithTracer], the dialers run their dials in spans named after the config type.
 func (p *ExtensibleProvider[ObjectType]) NewInstance(ctx context.Context, config *Config) (ObjectType, error) {
 	var zero ObjectType
 	if config == nil {
 		if p.BaseInstance == zero {
 			return zero, errors.New("base instance is not configured")
 		}
-		return p.BaseInstance, nil
+		return withTracing(ctx, p.BaseInstance, ""), nil
 	}
 
 	newInstance, ok := p.ensureBuildersMap()[config.URL.Scheme]
 	if !ok {
 		return zero, fmt.Errorf("config type '%v' is not registered", config.URL.Scheme)
 	}
-	return newInstance(ctx, config)
+	object, err := newInstance(ctx, config)
+	if err != nil {
+		return zero, err
+	}
+	return withDescription(withTracing(ctx, object, config.URL.Scheme), config), nil
 }
 
 // ParseConfig will parse a config given as a string and return the structured [Config].
@@ -94,19 +100,56 @@ func ParseConfig(configText string) (*Config, error) {
 
 	var config *Config = nil
 	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			return nil, errors.New("empty config part")
-		}
-		// Make it "<scheme>:" if it's only "<scheme>" to parse as a URL.
-		if !strings.Contains(part, ":") {
-			part += ":"
-		}
-		url, err := url.Parse(part)
+		url, err := parseConfigPart(part)
 		if err != nil {
-			return nil, fmt.Errorf("part is not a valid URL: %w", err)
+			return nil, err
 		}
 		config = &Config{URL: *url, BaseConfig: config}
 	}
 	return config, nil
 }
+
+// parseConfigPart parses one of the pipe-separated parts of a config.
+func parseConfigPart(part string) (*url.URL, error) {
+	part = strings.TrimSpace(part)
+	if part == "" {
+		return nil, errors.New("empty config part")
+	}
+	// Make it "<scheme>:" if it's only "<scheme>" to parse as a URL.
+	if !strings.Contains(part, ":") {
+		part += ":"
+	}
+	url, err := url.Parse(part)
+	if err != nil {
+		if url, ok := parseAddressListURL(part); ok {
+			return url, nil
+		}
+		return nil, fmt.Errorf("part is not a valid URL: %w", err)
+	}
+	return url, nil
+}
+
+// parseAddressListURL parses a config part with a list of addresses in the host, like "ss://KEY@host:443,8443,53",
+// which url.Parse rejects. The host of the URL keeps the list as is.
+func parseAddressListURL(part string) (*url.URL, bool) {
+	_, afterScheme, ok := strings.Cut(part, "://")
+	if !ok {
+		return nil, false
+	}
+	authorityStart := len(part) - len(afterScheme)
+	authorityEnd := len(part)
+	if i := strings.IndexAny(afterScheme, "/?#"); i >= 0 {
+		authorityEnd = authorityStart + i
+	}
+	hostStart := authorityStart + strings.LastIndex(part[authorityStart:authorityEnd], "@") + 1
+	host := part[hostStart:authorityEnd]
+	if !isAddressList(host) {
+		return nil, false
+	}
+	url, err := url.Parse(part[:hostStart] + part[authorityEnd:])
+	if err != nil {
+		return nil, false
+	}
+	url.Host = host
+	return url, true
+}
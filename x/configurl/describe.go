@@ -0,0 +1,249 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// Description is a structured description of an object created from a config, with secrets redacted,
+// so that apps can display and log the active chain without exposing passwords.
+type Description struct {
+	// Type is the config type, like "ss" or "tls".
+	Type string `json:"type"`
+	// Config is the config text for this object only, with secrets redacted.
+	Config string `json:"config"`
+	// Options are the parameters of the config, with secrets replaced by "REDACTED". The server address,
+	// if any, is in the "address" option, and the value of opaque configs like "split:5" in the "value" option.
+	// Options is nil for types that don't support sanitization.
+	Options map[string]string `json:"options,omitempty"`
+	// Base describes the object this one is built on, or is nil if it's built directly on the base instance.
+	Base *Description `json:"base,omitempty"`
+}
+
+// String returns the sanitized config text of the chain, in the same format as [SanitizeConfig].
+func (d *Description) String() string {
+	text := ""
+	for ; d != nil; d = d.Base {
+		if text == "" {
+			text = d.Config
+		} else {
+			text = d.Config + "|" + text
+		}
+	}
+	return text
+}
+
+// Describer is implemented by the objects created by an [ExtensibleProvider] from a config.
+type Describer interface {
+	// Describe returns the description of the object.
+	Describe() *Description
+}
+
+// Describe returns the description of an object created from a config, or nil if the object doesn't
+// have a description, like the base instances.
+func Describe(object any) *Description {
+	if d, ok := object.(Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+// describeConfig creates the description of the given config, with secrets redacted.
+// It returns nil for a nil config.
+func describeConfig(config *Config) (*Description, error) {
+	if config == nil {
+		return nil, nil
+	}
+	base, err := describeConfig(config.BaseConfig)
+	if err != nil {
+		return nil, err
+	}
+	sanitized, err := sanitizeConfigURL(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	scheme := strings.ToLower(config.URL.Scheme)
+	desc := &Description{Type: scheme, Base: base}
+	if sanitized == nil {
+		desc.Config = scheme + "://UNKNOWN"
+		return desc, nil
+	}
+	desc.Config = sanitized.String()
+	desc.Options = make(map[string]string)
+	if sanitized.Host != "" {
+		desc.Options["address"] = sanitized.Host
+	}
+	if sanitized.User != nil {
+		desc.Options["user"] = sanitized.User.Username()
+	}
+	query := sanitized.RawQuery
+	if sanitized.Opaque != "" {
+		// The value may be followed by options, as in "split:5&delay=10ms".
+		if value, options, _ := strings.Cut(sanitized.Opaque, "&"); strings.Contains(value, "=") {
+			query = sanitized.Opaque
+		} else {
+			desc.Options["value"] = value
+			query = options
+		}
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		desc.Options[key] = strings.Join(value, ",")
+	}
+	return desc, nil
+}
+
+// withDescription returns the object wrapped so that it implements [Describer], if ObjectType is one of the
+// transport interfaces. Other objects are returned as is.
+func withDescription[ObjectType any](object ObjectType, config *Config) ObjectType {
+	if any(object) == nil {
+		return object
+	}
+	desc, err := describeConfig(config)
+	if err != nil || desc == nil {
+		return object
+	}
+	// Switch on the object type rather than the dynamic type, since an object can implement multiple interfaces.
+	var described any
+	switch o := any(&object).(type) {
+	case *transport.StreamDialer:
+		described = &describedStreamDialer{StreamDialer: *o, desc: desc}
+	case *transport.PacketDialer:
+		described = &describedPacketDialer{PacketDialer: *o, desc: desc}
+	case *transport.PacketListener:
+		described = &describedPacketListener{PacketListener: *o, desc: desc}
+	case *StreamListener:
+		described = &describedStreamListener{StreamListener: *o, desc: desc}
+	default:
+		return object
+	}
+	return described.(ObjectType)
+}
+
+// describedStreamDialer adds the description to a dialer. It forwards the optional interfaces of the dialer,
+// so the description doesn't change its capabilities.
+type describedStreamDialer struct {
+	transport.StreamDialer
+	desc *Description
+}
+
+var _ Describer = (*describedStreamDialer)(nil)
+var _ transport.DialAndWriter = (*describedStreamDialer)(nil)
+var _ transport.CapabilityReporter = (*describedStreamDialer)(nil)
+var _ transport.Pinger = (*describedStreamDialer)(nil)
+
+func (d *describedStreamDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	return d.StreamDialer.DialStream(ctx, addr)
+}
+
+// DialAndWrite implements [transport.DialAndWriter] with the fast path of the dialer, if it has one.
+func (d *describedStreamDialer) DialAndWrite(ctx context.Context, addr string, data []byte) (transport.StreamConn, error) {
+	return transport.DialAndWrite(ctx, d.StreamDialer, addr, data)
+}
+
+// Capabilities implements [transport.CapabilityReporter] with the capabilities of the dialer.
+func (d *describedStreamDialer) Capabilities() transport.Capability {
+	return transport.Capabilities(d.StreamDialer)
+}
+
+// Ping implements [transport.Pinger] by pinging the dialer.
+func (d *describedStreamDialer) Ping(ctx context.Context) (time.Duration, error) {
+	return transport.Ping(ctx, d.StreamDialer)
+}
+
+func (d *describedStreamDialer) Describe() *Description {
+	return d.desc
+}
+
+// describedPacketDialer is like [describedStreamDialer], for packet dialers.
+type describedPacketDialer struct {
+	transport.PacketDialer
+	desc *Description
+}
+
+var _ Describer = (*describedPacketDialer)(nil)
+var _ transport.CapabilityReporter = (*describedPacketDialer)(nil)
+var _ transport.Pinger = (*describedPacketDialer)(nil)
+
+func (d *describedPacketDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	return d.PacketDialer.DialPacket(ctx, addr)
+}
+
+// Capabilities implements [transport.CapabilityReporter] with the capabilities of the dialer.
+func (d *describedPacketDialer) Capabilities() transport.Capability {
+	return transport.Capabilities(d.PacketDialer)
+}
+
+// Ping implements [transport.Pinger] by pinging the dialer.
+func (d *describedPacketDialer) Ping(ctx context.Context) (time.Duration, error) {
+	return transport.Ping(ctx, d.PacketDialer)
+}
+
+func (d *describedPacketDialer) Describe() *Description {
+	return d.desc
+}
+
+// describedPacketListener is like [describedStreamDialer], for packet listeners.
+type describedPacketListener struct {
+	transport.PacketListener
+	desc *Description
+}
+
+var _ Describer = (*describedPacketListener)(nil)
+var _ transport.CapabilityReporter = (*describedPacketListener)(nil)
+var _ transport.Pinger = (*describedPacketListener)(nil)
+
+func (l *describedPacketListener) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	return l.PacketListener.ListenPacket(ctx)
+}
+
+// Capabilities implements [transport.CapabilityReporter] with the capabilities of the listener.
+func (l *describedPacketListener) Capabilities() transport.Capability {
+	return transport.Capabilities(l.PacketListener)
+}
+
+// Ping implements [transport.Pinger] by pinging the listener.
+func (l *describedPacketListener) Ping(ctx context.Context) (time.Duration, error) {
+	return transport.Ping(ctx, l.PacketListener)
+}
+
+func (l *describedPacketListener) Describe() *Description {
+	return l.desc
+}
+
+type describedStreamListener struct {
+	StreamListener
+	desc *Description
+}
+
+var _ Describer = (*describedStreamListener)(nil)
+
+func (l *describedStreamListener) ListenStream(ctx context.Context) (net.Listener, error) {
+	return l.StreamListener.ListenStream(ctx)
+}
+
+func (l *describedStreamListener) Describe() *Description {
+	return l.desc
+}
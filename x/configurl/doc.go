@@ -49,7 +49,12 @@ The following sections list transport types are currently supported, along with
 
 Shadowsocks proxy (compatible with Outline's access keys, package [github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks])
 
-	ss://[USERINFO]@[HOST]:[PORT]?prefix=[PREFIX]
+	ss://[USERINFO]@[HOST]:[PORT]?prefix=[PREFIX]&initial_write=[MODE]&initial_write_fragment=[SIZE]
+
+The initial_write parameter controls the first write to the proxy of stream connections: "coalesced" (the default) sends the salt,
+target address and initial data at once, "separate-salt" sends the salt on its own, and "separate-data" sends the salt and target
+address without waiting for the initial data. The initial_write_fragment parameter splits the first write into writes of at most SIZE
+bytes. Both change the length of the first packet, which some firewalls fingerprint.
 
 SOCKS5 proxy (works with both stream and packet dialers, package [github.com/Jigsaw-Code/outline-sdk/transport/socks5])
 
@@ -57,18 +62,69 @@ SOCKS5 proxy (works with both stream and packet dialers, package [github.com/Jig
 
 USERINFO field is optional and only required if username and password authentication is used. It is in the format of username:password.
 
+The HOST and PORT of the ss, socks5 and socks5s proxies can be comma-separated lists of candidate addresses of the same server, like
+different IPs, host names or ports, as in "ss://[USERINFO]@example.com,192.0.2.1:443,8443,53". IPv6 addresses must be in brackets.
+Connections try each host and port combination in turn until one works, starting from the last one that worked.
+
+SOCKS5 over TLS, and SOCKS5 over a WebSocket over TLS (streams only)
+
+	socks5s://[USERINFO]@[HOST]:[PORT]?sni=[SNI]&certname=[CERT_NAME]
+	socks5+wss://[USERINFO]@[HOST]:[PORT]/[PATH]?sni=[SNI]&certname=[CERT_NAME]&host=[HTTP_HOST]
+
+The sni, certname and alpn parameters are the same as in the tls transport, and the host parameter sets the HTTP Host header of the
+WebSocket handshake, as in the ws transport. PATH defaults to "/". They don't support packet dialers or listeners, because
+SOCKS5 exchanges the datagrams with the UDP ASSOCIATE relay in the clear, which would defeat the secure connection.
+
 # Transports
 
 TLS transport (currently streams only, package [github.com/Jigsaw-Code/outline-sdk/transport/tls])
 
 The sni parameter defines the name to be sent in the TLS SNI. It can be empty.
 The certname parameter defines what name to validate against the server certificate.
+The alpn parameter is a comma-separated list of the application protocols to offer, in order of preference (e.g. "h2,http/1.1").
+If not set, no ALPN extension is sent.
 
-	tls:sni=[SNI]&certname=[CERT_NAME]
+	tls:sni=[SNI]&certname=[CERT_NAME]&alpn=[PROTOCOLS]
 
 WebSockets
 
-	ws:tcp_path=[PATH]&udp_path=[PATH]
+	ws:tcp_path=[PATH]&udp_path=[PATH]&host=[HOST]
+
+The host parameter sets the HTTP Host header of the Websocket handshake. If not set, the dialed address is used.
+
+Unix domain sockets (streams only)
+
+	unix:[PATH]
+
+Dials the unix socket at PATH instead of the requested address, to reach local helper daemons, like a SOCKS5 proxy
+with "unix:/run/helper.sock|socks5://localhost:1080". Use "unix:///[PATH]" or "unix:/[PATH]" for absolute paths. It must be
+the first part of the config.
+
+TCP options (streams only)
+
+	tcp:keepalive=[IDLE]&keepalive_interval=[INTERVAL]&keepalive_count=[COUNT]&user_timeout=[TIMEOUT]
+
+Configures the TCP connections to the proxy, so dead proxies are detected faster than with the system defaults. keepalive is the
+idle time before the first keep-alive probe, keepalive_interval the time between probes, and keepalive_count the number of
+unacknowledged probes before the connection is closed. user_timeout sets TCP_USER_TIMEOUT, the maximum time that sent data
+may remain unacknowledged. The times are durations, like "15s". keepalive_interval and keepalive_count are only supported on
+Linux and Darwin, and user_timeout on Linux only. It must be the first part of the config, as in
+"tcp:keepalive=15s&keepalive_count=3|ss://[USERINFO]@[HOST]:[PORT]".
+
+Windows named pipes (streams only, package [github.com/Jigsaw-Code/outline-sdk/x/npipe])
+
+	npipe:////./pipe/[NAME]
+
+Like unix, but dials the named pipe `\\.\pipe\[NAME]`, for local helper daemons on Windows. It must be the first part of the config.
+
+Compression (streams only, package [github.com/Jigsaw-Code/outline-sdk/x/compression])
+
+	compress:algorithms=[ALGORITHMS]
+
+The algorithms parameter is a comma-separated list of "zstd", "snappy" and "none", in order of preference, and defaults to
+"zstd,snappy". The first one compresses the upstream, and the server picks the downstream one. The server must be a matching
+compress listener. Encrypted data doesn't compress, so put it between the encryption and a proxy protocol that doesn't encrypt,
+as in "tls|compress|socks5://[HOST]:[PORT]".
 
 # DNS Protection
 
@@ -96,6 +152,18 @@ The port parameter, if not empty, specifies the port to dial instead of the orig
 
 	override:host=[HOST]&port=[PORT]
 
+The ip parameter, if not empty, specifies the IP address to connect to. If the override follows a tls config, the TLS
+connection goes to that IP, but the SNI and certificate validation still use the original host name, which lets you reach
+a blocked site through an unblocked IP. Otherwise, it's the same as the host parameter. The host and ip parameters are
+mutually exclusive.
+The sni parameter, if not empty, specifies the SNI of the tls config the override follows, replacing its sni option.
+It requires the override to follow a tls config.
+
+	tls|override:ip=[IP]&sni=[SNI]
+
+The override doesn't change how host names are resolved. To use a specific resolver for a hop, use a do53 or doh
+config before it.
+
 # Packet manipulation
 
 These strategies manipulate packets to bypass SNI-based blocking.
@@ -104,7 +172,10 @@ Stream split transport (streams only, package [github.com/Jigsaw-Code/outline-sd
 
 It takes a list of count*length pairs meaning splitting the sequence in count segments of the given length. If you omit "[COUNT]*", it's assumed to be 1.
 
-	split:[COUNT1]*[LENGTH1],[COUNT2]*[LENGTH2],...
+	split:[COUNT1]*[LENGTH1],[COUNT2]*[LENGTH2],...&delay=[DELAY]&jitter=[JITTER]
+
+The optional delay parameter, like "20ms", makes it wait between the writes of the segments, so they arrive in different polling
+intervals of the middleboxes that reassemble them. The optional jitter parameter randomizes each wait by up to that much.
 
 TLS fragmentation (streams only, package [github.com/Jigsaw-Code/outline-sdk/transport/tlsfrag]).
 
@@ -114,6 +185,25 @@ For more details, refer to [github.com/Jigsaw-Code/outline-sdk/transport/tlsfrag
 
 	tlsfrag:[LENGTH]
 
+With the handshake parameter, every plaintext handshake record the client sends, not only the Client Hello, is split into
+records with payloads of at most MAX_LENGTH bytes, until the first record of another type.
+
+	tlsfrag:handshake=[MAX_LENGTH]
+
+QUIC Initial fragmentation (packets only, package [github.com/Jigsaw-Code/outline-sdk/x/quicfrag])
+
+The CRYPTO frames of the QUIC Initial packets, which carry the TLS Client Hello, are split into separate datagrams with
+at most LENGTH bytes of handshake data each.
+
+	quicfrag:[LENGTH]
+
+UDP port hopping (packets only, package [github.com/Jigsaw-Code/outline-sdk/x/porthop])
+
+The port of the dialed address is replaced by a random port of the range, which changes every INTERVAL (30s by
+default), to avoid throttling of long-lived flows. The server must accept the traffic on all the ports of the range.
+
+	porthop:ports=[FIRST]-[LAST]&interval=[INTERVAL]
+
 Packet reordering (streams only, package [github.com/Jigsaw-Code/outline-sdk/x/disorder])
 
 The disorder strategy sends TCP packets out of order by manipulating the
@@ -152,7 +242,12 @@ of the resolver itself. This can be combines with a TCP split or TLS Record Frag
 
 SOCKS5-over-TLS, with domain-fronting - To tunnel SOCKS5 over TLS, and set the SNI to decoy.example.com, while still validating against your host name, use:
 
-	tls:sni=decoy.example.com&certname=[HOST]|socks5:[HOST]:[PORT]
+	socks5s://[HOST]:[PORT]?sni=decoy.example.com&certname=[HOST]
+
+Websocket with domain fronting - To connect to a front CDN address, send the front domain in the SNI, and request
+your real host from the CDN, separate the connection address, the SNI, and the Host header:
+
+	override:host=[FRONT_ADDRESS]|tls:sni=[FRONT_DOMAIN]|ws:tcp_path=[PATH]&host=[REAL_HOST]
 
 Onion Routing with Shadowsocks - To route your traffic through three Shadowsocks servers, similar to [Onion Routing], use:
 
@@ -164,11 +259,66 @@ DPI Evasion - To add packet splitting to a Shadowsocks server for enhanced DPI e
 
 	split:2|ss://[USERINFO]@[HOST]:[PORT]
 
+# Server listeners
+
+[ProviderContainer.NewStreamListener] builds server listeners from configs in the same grammar, so clients and
+servers can share a config. The "listen" parameter of the last part sets the TCP address to listen on, and the parts
+are terminated in order. The supported types are:
+
+  - tls:certFile=[CERT_FILE]&keyFile=[KEY_FILE][&alpn=[PROTOCOLS]] terminates TLS with the certificate and key in the PEM files.
+  - ws:tcp_path=[PATH] accepts WebSocket connections on the path.
+  - compress:algorithms=[ALGORITHMS] decompresses streams from compress dialers, using the algorithms it supports.
+  - ss://[USERINFO]@[HOST]:[PORT] decrypts Shadowsocks streams. The host is ignored, and the accepted connections implement
+    [TargetConn], which returns the destination requested by the client.
+
+For instance, for a Shadowsocks server behind WebSocket over TLS:
+
+	tls:certFile=cert.pem&keyFile=key.pem|ws:tcp_path=/tcp|ss://[USERINFO]@[HOST]:[PORT]?listen=:443
+
+Only stream listeners are supported on the server side. Packet listeners, created with
+[ProviderContainer.NewPacketListener], are client-side and send the packets through the proxies of the config, so
+configs with the "listen" parameter are rejected there. UDP servers, like the UDP side of a Shadowsocks server, must be
+set up outside of configurl, for instance with [github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks.Unpack].
+
+# Describing dialers
+
+The stream dialers, packet dialers and packet listeners created from a config implement [Describer], which returns a
+[Description] of the chain with secrets like passwords redacted, so apps can display and log the active configuration:
+
+	dialer, err := p.NewStreamDialer(ctx, configText)
+	// ...
+	log.Printf("Using %v", configurl.Describe(dialer))
+
+Types that are not known to be safe to log, including custom types, are described by their type name only.
+
+# Validating configs
+
+[Validate] checks a config without dialing or listening, so UIs can validate pasted configs before saving them.
+It returns [ValidationErrors] with the position of each invalid part in the config text:
+
+	var errs configurl.ValidationErrors
+	if errors.As(configurl.Validate(configText), &errs) {
+		for _, err := range errs {
+			// Highlight configText[err.Offset:err.Offset+err.Length].
+		}
+	}
+
+Use [ProviderContainer.Validate] for configs with custom types.
+
+# Tracing
+
+If the context passed to the creation of a dialer has a tracer from [github.com/Jigsaw-Code/outline-sdk/x/tracing.WithTracer],
+each dial has a root span with a child span per part of the config, named after its type, down to the base "tcp" or
+"udp" span, which separates the "dns" resolution from the "connect" attempts:
+
+	ctx = tracing.WithTracer(ctx, tracer)
+	dialer, err := p.NewStreamDialer(ctx, "tls|ss://[USERINFO]@[HOST]:[PORT]")
+
 # Defining custom strategies
 
 Core Concepts:
 
-  - [ProviderContainer]: A central registry for managing different types of network object builders (StreamDialers, PacketDialers, PacketListeners).
+  - [ProviderContainer]: A central registry for managing different types of network object builders (StreamDialers, PacketDialers, PacketListeners, StreamListeners).
   - [ExtensibleProvider]: A type that provides a mechanism to register and retrieve builders for specific subtypes of network objects.
   - [BuildFunc]: A function that creates an instance of a network object from a parsed configuration.
   - [Config]: A parsed representation of the configuration string.
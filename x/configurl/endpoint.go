@@ -0,0 +1,51 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"strings"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// isAddressList returns whether the address of a config is a list of candidate addresses, like "host:443,8443,53".
+func isAddressList(address string) bool {
+	return strings.Contains(address, ",")
+}
+
+// newStreamEndpoint returns the endpoint that connects to the address of a config with sd. If the address is a list,
+// the endpoint tries each address in turn, starting from the last one that worked.
+func newStreamEndpoint(sd transport.StreamDialer, address string) (transport.StreamEndpoint, error) {
+	if !isAddressList(address) {
+		return &transport.StreamDialerEndpoint{Dialer: sd, Address: address}, nil
+	}
+	addresses, err := transport.ParseAddressList(address)
+	if err != nil {
+		return nil, err
+	}
+	return &transport.MultiStreamEndpoint{Dialer: sd, Addresses: addresses}, nil
+}
+
+// newPacketEndpoint is like [newStreamEndpoint] for packet endpoints.
+func newPacketEndpoint(pd transport.PacketDialer, address string) (transport.PacketEndpoint, error) {
+	if !isAddressList(address) {
+		return &transport.PacketDialerEndpoint{Dialer: pd, Address: address}, nil
+	}
+	addresses, err := transport.ParseAddressList(address)
+	if err != nil {
+		return nil, err
+	}
+	return &transport.MultiPacketEndpoint{Dialer: pd, Addresses: addresses}, nil
+}
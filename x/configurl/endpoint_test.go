@@ -0,0 +1,51 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig_AddressList(t *testing.T) {
+	config, err := ParseConfig("split:5|ss://user:secret@example.com,[2001:db8::1]:443,8443,53/?prefix=x#name")
+	require.NoError(t, err)
+	require.Equal(t, "ss", config.URL.Scheme)
+	require.Equal(t, "example.com,[2001:db8::1]:443,8443,53", config.URL.Host)
+	require.Equal(t, "user:secret", config.URL.User.String())
+	require.Equal(t, "x", config.URL.Query().Get("prefix"))
+	require.Equal(t, "name", config.URL.Fragment)
+
+	sanitized, err := SanitizeConfig("ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpLeTUyN2duU3FEVFB3R0JpQ1RxUnlT@example.com:443,8443")
+	require.NoError(t, err)
+	require.Equal(t, "ss://REDACTED@example.com:443,8443", sanitized)
+}
+
+func TestNewStreamDialer_AddressList(t *testing.T) {
+	providers := NewDefaultProviders()
+	_, err := providers.NewStreamDialer(context.Background(), "ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpLeTUyN2duU3FEVFB3R0JpQ1RxUnlT@example.com,192.0.2.1:443,8443")
+	require.NoError(t, err)
+	_, err = providers.NewPacketDialer(context.Background(), "ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpLeTUyN2duU3FEVFB3R0JpQ1RxUnlT@example.com:443,8443")
+	require.NoError(t, err)
+	_, err = providers.NewStreamDialer(context.Background(), "ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpLeTUyN2duU3FEVFB3R0JpQ1RxUnlT@example.com:443,")
+	require.Error(t, err)
+
+	endpoint, err := newStreamEndpoint(nil, "example.com:443,8443")
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.com:443", "example.com:8443"}, endpoint.(*transport.MultiStreamEndpoint).Addresses)
+}
@@ -0,0 +1,358 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks"
+	"github.com/Jigsaw-Code/outline-sdk/transport/socks5"
+	"github.com/Jigsaw-Code/outline-sdk/x/tlslistener"
+	"github.com/Jigsaw-Code/outline-sdk/x/websocket"
+)
+
+// StreamListener creates listeners of stream connections. It's the server-side counterpart of a
+// [transport.StreamDialer].
+type StreamListener interface {
+	// ListenStream starts listening and returns the listener.
+	ListenStream(ctx context.Context) (net.Listener, error)
+}
+
+// TargetConn is a connection accepted by a listener of a proxy protocol, like "ss", that carries the address
+// of the destination requested by the client.
+type TargetConn interface {
+	transport.StreamConn
+	// Target returns the destination address requested by the client, reading it from the connection on the first
+	// call. Set a read deadline to limit how long to wait for it.
+	Target() (string, error)
+}
+
+type listenAddressKey struct{}
+
+// tcpStreamListener is the base stream listener. It listens on TCP on the address set in the context by
+// [ProviderContainer.NewStreamListener].
+type tcpStreamListener struct{}
+
+func (*tcpStreamListener) ListenStream(ctx context.Context) (net.Listener, error) {
+	address, ok := ctx.Value(listenAddressKey{}).(string)
+	if !ok {
+		return nil, errors.New("listen address not specified")
+	}
+	var lc net.ListenConfig
+	return lc.Listen(ctx, "tcp", address)
+}
+
+// addressStreamListener listens with the listen address of the config.
+type addressStreamListener struct {
+	StreamListener
+	address string
+}
+
+func (l *addressStreamListener) ListenStream(ctx context.Context) (net.Listener, error) {
+	return l.StreamListener.ListenStream(context.WithValue(ctx, listenAddressKey{}, l.address))
+}
+
+func (l *addressStreamListener) Describe() *Description {
+	return Describe(l.StreamListener)
+}
+
+// errMissingListen is returned by [cutListenAddress] for configs without the "listen" parameter.
+var errMissingListen = errors.New("must specify the listen parameter")
+
+// errServerPacketListener is returned by [ProviderContainer.NewPacketListener] for server-side configs.
+var errServerPacketListener = errors.New("server-side packet listeners are not supported; the listen parameter only applies to stream listeners")
+
+// cutListenAddress returns the value of the "listen" parameter of the last config part, and a copy of the config
+// without it. The parameter goes in the query, or in the opaque part of opaque configs like "ws:tcp_path=/t".
+func cutListenAddress(config *Config) (string, *Config, error) {
+	if config == nil {
+		return "", nil, errMissingListen
+	}
+	u := config.URL
+	query := &u.RawQuery
+	if u.Opaque != "" {
+		query = &u.Opaque
+	}
+	values, err := url.ParseQuery(*query)
+	if err != nil {
+		return "", nil, err
+	}
+	listen, ok := values["listen"]
+	if !ok {
+		return "", nil, errMissingListen
+	}
+	if len(listen) != 1 || listen[0] == "" {
+		return "", nil, errors.New("listen parameter must have one non-empty value")
+	}
+	values.Del("listen")
+	*query = values.Encode()
+	return listen[0], &Config{URL: u, BaseConfig: config.BaseConfig}, nil
+}
+
+func registerTLSStreamListener(r TypeRegistry[StreamListener], typeID string, newSL BuildFunc[StreamListener]) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (StreamListener, error) {
+		sl, err := newSL(ctx, config.BaseConfig)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig, err := parseTLSServerConfig(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		return FuncStreamListener(func(ctx context.Context) (net.Listener, error) {
+			baseListener, err := sl.ListenStream(ctx)
+			if err != nil {
+				return nil, err
+			}
+			listener, err := tlslistener.NewListener(baseListener, tlsConfig, nil)
+			if err != nil {
+				baseListener.Close()
+				return nil, err
+			}
+			return listener, nil
+		}), nil
+	})
+}
+
+func parseTLSServerConfig(configURL url.URL) (*tls.Config, error) {
+	values, err := url.ParseQuery(configURL.Opaque)
+	if err != nil {
+		return nil, err
+	}
+	var certFile, keyFile string
+	tlsConfig := &tls.Config{}
+	for key, values := range values {
+		if len(values) != 1 {
+			return nil, fmt.Errorf("%v option must has one value, found %v", key, len(values))
+		}
+		switch strings.ToLower(key) {
+		case "certfile":
+			certFile = values[0]
+		case "keyfile":
+			keyFile = values[0]
+		case "alpn":
+			if values[0] != "" {
+				tlsConfig.NextProtos = strings.Split(values[0], ",")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported option %v", key)
+		}
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("must specify certFile and keyFile")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return tlsConfig, nil
+}
+
+func registerWebsocketStreamListener(r TypeRegistry[StreamListener], typeID string, newSL BuildFunc[StreamListener]) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (StreamListener, error) {
+		sl, err := newSL(ctx, config.BaseConfig)
+		if err != nil {
+			return nil, err
+		}
+		wsConfig, err := parseWSConfig(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		if wsConfig.tcpPath == "" {
+			return nil, errors.New("must specify tcp_path")
+		}
+		if wsConfig.udpPath != "" || wsConfig.host != "" {
+			return nil, errors.New("stream listeners only support the tcp_path option")
+		}
+		return FuncStreamListener(func(ctx context.Context) (net.Listener, error) {
+			baseListener, err := sl.ListenStream(ctx)
+			if err != nil {
+				return nil, err
+			}
+			listener, err := websocket.NewListener(baseListener, wsConfig.tcpPath)
+			if err != nil {
+				baseListener.Close()
+				return nil, err
+			}
+			return listener, nil
+		}), nil
+	})
+}
+
+func registerShadowsocksStreamListener(r TypeRegistry[StreamListener], typeID string, newSL BuildFunc[StreamListener]) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (StreamListener, error) {
+		sl, err := newSL(ctx, config.BaseConfig)
+		if err != nil {
+			return nil, err
+		}
+		ssConfig, err := parseShadowsocksURL(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		return FuncStreamListener(func(ctx context.Context) (net.Listener, error) {
+			baseListener, err := sl.ListenStream(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return &shadowsocksListener{
+				Listener:    baseListener,
+				key:         ssConfig.cryptoKey,
+				replayCache: shadowsocks.NewReplayCache(shadowsocksReplayCacheCapacity),
+			}, nil
+		}), nil
+	})
+}
+
+// FuncStreamListener is a [StreamListener] that uses the given function to listen.
+type FuncStreamListener func(ctx context.Context) (net.Listener, error)
+
+// ListenStream implements [StreamListener].
+func (f FuncStreamListener) ListenStream(ctx context.Context) (net.Listener, error) {
+	return f(ctx)
+}
+
+// shadowsocksReplayCacheCapacity is the minimum number of recent salts a Shadowsocks listener remembers.
+const shadowsocksReplayCacheCapacity = 10_000
+
+// errReplayedConnection is returned when a Shadowsocks connection reuses the salt of a previous connection.
+var errReplayedConnection = errors.New("replayed shadowsocks connection")
+
+// shadowsocksListener accepts Shadowsocks connections. The handshake happens on the first Read or Target call, so
+// slow clients don't block Accept.
+//
+// Connections that reuse a recent salt, including the salts of the listener's own responses, are rejected, so that
+// recorded connections can't be replayed or reflected to probe the server.
+type shadowsocksListener struct {
+	net.Listener
+	key         *shadowsocks.EncryptionKey
+	replayCache *shadowsocks.ReplayCache
+}
+
+func (l *shadowsocksListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	salt := &saltRecorder{reader: conn, salt: make([]byte, 0, l.key.SaltSize())}
+	writer := shadowsocks.NewWriter(conn, l.key)
+	writer.SetSaltGenerator(replaySaltGenerator{l.replayCache})
+	return &shadowsocksServerConn{
+		Conn:        conn,
+		reader:      shadowsocks.NewReader(salt, l.key),
+		writer:      writer,
+		salt:        salt,
+		replayCache: l.replayCache,
+	}, nil
+}
+
+// saltRecorder is an [io.Reader] that keeps a copy of the first cap(salt) bytes read, which hold the salt of a
+// Shadowsocks stream.
+type saltRecorder struct {
+	reader io.Reader
+	salt   []byte
+}
+
+func (r *saltRecorder) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	if missing := cap(r.salt) - len(r.salt); missing > 0 {
+		if missing > n {
+			missing = n
+		}
+		r.salt = append(r.salt, b[:missing]...)
+	}
+	return n, err
+}
+
+// replaySaltGenerator generates random salts and adds them to the replay cache, so that the listener's responses
+// can't be reflected back to it.
+type replaySaltGenerator struct {
+	replayCache *shadowsocks.ReplayCache
+}
+
+func (g replaySaltGenerator) GetSalt(salt []byte) error {
+	if err := shadowsocks.RandomSaltGenerator.GetSalt(salt); err != nil {
+		return err
+	}
+	g.replayCache.Add(salt)
+	return nil
+}
+
+type shadowsocksServerConn struct {
+	net.Conn
+	reader      io.Reader
+	writer      io.Writer
+	salt        *saltRecorder
+	replayCache *shadowsocks.ReplayCache
+	targetOnce  sync.Once
+	target      string
+	targetErr   error
+}
+
+var _ TargetConn = (*shadowsocksServerConn)(nil)
+
+func (c *shadowsocksServerConn) Target() (string, error) {
+	c.targetOnce.Do(func() {
+		c.target, c.targetErr = c.readTarget()
+	})
+	return c.target, c.targetErr
+}
+
+func (c *shadowsocksServerConn) readTarget() (string, error) {
+	addr, err := socks5.ReadAddr(c.reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read target address: %w", err)
+	}
+	// The salt is only added once the first chunk is authenticated, so that forged connections can't evict the
+	// valid salts.
+	if !c.replayCache.Add(c.salt.salt) {
+		return "", errReplayedConnection
+	}
+	return addr.String(), nil
+}
+
+func (c *shadowsocksServerConn) Read(b []byte) (int, error) {
+	if _, err := c.Target(); err != nil {
+		return 0, err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *shadowsocksServerConn) Write(b []byte) (int, error) {
+	return c.writer.Write(b)
+}
+
+func (c *shadowsocksServerConn) CloseRead() error {
+	if closer, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return closer.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+func (c *shadowsocksServerConn) CloseWrite() error {
+	if closer, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return closer.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
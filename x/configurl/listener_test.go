@@ -0,0 +1,213 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks"
+	"github.com/Jigsaw-Code/outline-sdk/x/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// serveShadowsocksEcho accepts connections, and writes back the target followed by the echoed data.
+func serveShadowsocksEcho(t *testing.T, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			target, err := conn.(TargetConn).Target()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(target + " "))
+			io.Copy(conn, conn)
+			conn.(TargetConn).CloseWrite()
+		}()
+	}
+}
+
+func requestEcho(t *testing.T, conn transport.StreamConn) string {
+	_, err := conn.Write([]byte("Request"))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(response)
+}
+
+func TestNewStreamListener_Shadowsocks(t *testing.T) {
+	providers := NewDefaultProviders()
+	sl, err := providers.NewStreamListener(context.Background(), "ss://chacha20-ietf-poly1305:secret@server.example:1?listen=127.0.0.1:0")
+	require.NoError(t, err)
+	require.Equal(t, "ss://REDACTED@server.example:1", Describe(sl).String())
+	listener, err := sl.ListenStream(context.Background())
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveShadowsocksEcho(t, listener)
+
+	dialer, err := providers.NewStreamDialer(context.Background(), "ss://chacha20-ietf-poly1305:secret@"+listener.Addr().String())
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "example.com:443 Request", requestEcho(t, conn))
+}
+
+func TestNewStreamListener_ShadowsocksReplay(t *testing.T) {
+	providers := NewDefaultProviders()
+	sl, err := providers.NewStreamListener(context.Background(), "ss://chacha20-ietf-poly1305:secret@server.example:1?listen=127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := sl.ListenStream(context.Background())
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveShadowsocksEcho(t, listener)
+
+	var recorded bytes.Buffer
+	endpoint := &transport.TCPEndpoint{Address: listener.Addr().String()}
+	connect := func(ctx context.Context) (transport.StreamConn, error) {
+		conn, err := endpoint.ConnectStream(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return transport.WrapConn(conn, conn, io.MultiWriter(conn, &recorded)), nil
+	}
+	key, err := shadowsocks.NewEncryptionKey("chacha20-ietf-poly1305", "secret")
+	require.NoError(t, err)
+	dialer, err := shadowsocks.NewStreamDialer(transport.FuncStreamEndpoint(connect), key)
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "example.com:443 Request", requestEcho(t, conn))
+
+	// Replaying the recorded client stream must not get a response.
+	replayConn, err := endpoint.ConnectStream(context.Background())
+	require.NoError(t, err)
+	defer replayConn.Close()
+	_, err = replayConn.Write(recorded.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, replayConn.CloseWrite())
+	response, err := io.ReadAll(replayConn)
+	require.NoError(t, err)
+	require.Empty(t, response)
+}
+
+func writeTestCertificate(t *testing.T) (certFile string, keyFile string, roots *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "server.example"},
+		DNSNames:     []string{"server.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots = x509.NewCertPool()
+	roots.AddCert(leaf)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile, roots
+}
+
+func TestNewStreamListener_ShadowsocksOverWebsocketOverTLS(t *testing.T) {
+	certFile, keyFile, roots := writeTestCertificate(t)
+	providers := NewDefaultProviders()
+	config := "tls:certFile=" + certFile + "&keyFile=" + keyFile + "|ws:tcp_path=/tcp|ss://chacha20-ietf-poly1305:secret@server.example:1?listen=127.0.0.1:0"
+	sl, err := providers.NewStreamListener(context.Background(), config)
+	require.NoError(t, err)
+	listener, err := sl.ListenStream(context.Background())
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveShadowsocksEcho(t, listener)
+
+	connect, err := websocket.NewStreamEndpoint("wss://server.example/tcp",
+		&transport.TCPEndpoint{Address: listener.Addr().String()}, websocket.WithTLSConfig(&tls.Config{RootCAs: roots}))
+	require.NoError(t, err)
+	key, err := shadowsocks.NewEncryptionKey("chacha20-ietf-poly1305", "secret")
+	require.NoError(t, err)
+	dialer, err := shadowsocks.NewStreamDialer(transport.FuncStreamEndpoint(connect), key)
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), "[2001:db8::1]:80")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "[2001:db8::1]:80 Request", requestEcho(t, conn))
+}
+
+func TestNewStreamListener_Errors(t *testing.T) {
+	providers := NewDefaultProviders()
+	for _, config := range []string{
+		"",
+		"ss://chacha20-ietf-poly1305:secret@server.example:1",
+		"ss://chacha20-ietf-poly1305:secret@server.example:1?listen=",
+		"split:2?listen=:0",
+		"tls:certFile=missing.pem&keyFile=missing.pem&listen=:0",
+		"tls:listen=:0",
+		"ws:listen=:0",
+		"ws:tcp_path=/t&udp_path=/u&listen=:0",
+	} {
+		_, err := providers.NewStreamListener(context.Background(), config)
+		require.Error(t, err, config)
+	}
+}
+
+func TestCutListenAddress(t *testing.T) {
+	config, err := ParseConfig("tls:certFile=c.pem|ws:tcp_path=/t&listen=:443")
+	require.NoError(t, err)
+	address, config, err := cutListenAddress(config)
+	require.NoError(t, err)
+	require.Equal(t, ":443", address)
+	require.Equal(t, "tcp_path=%2Ft", config.URL.Opaque)
+	require.Equal(t, "certFile=c.pem", config.BaseConfig.URL.Opaque)
+}
+
+func TestNewPacketListener_RejectsListen(t *testing.T) {
+	providers := NewDefaultProviders()
+	_, err := providers.NewPacketListener(context.Background(), "ss://chacha20-ietf-poly1305:secret@server.example:1?listen=:8388")
+	require.ErrorIs(t, err, errServerPacketListener)
+
+	// Client-side packet listeners are still supported.
+	listener, err := providers.NewPacketListener(context.Background(), "ss://chacha20-ietf-poly1305:secret@server.example:1")
+	require.NoError(t, err)
+	require.NotNil(t, listener)
+}
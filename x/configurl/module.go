@@ -16,6 +16,7 @@ package configurl
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 	"strings"
 
@@ -28,6 +29,7 @@ type ProviderContainer struct {
 	StreamDialers   ExtensibleProvider[transport.StreamDialer]
 	PacketDialers   ExtensibleProvider[transport.PacketDialer]
 	PacketListeners ExtensibleProvider[transport.PacketListener]
+	StreamListeners ExtensibleProvider[StreamListener]
 }
 
 // NewProviderContainer creates a [ProviderContainer] with the base instances properly initialized.
@@ -36,35 +38,54 @@ func NewProviderContainer() *ProviderContainer {
 		StreamDialers:   NewExtensibleProvider[transport.StreamDialer](&transport.TCPDialer{}),
 		PacketDialers:   NewExtensibleProvider[transport.PacketDialer](&transport.UDPDialer{}),
 		PacketListeners: NewExtensibleProvider[transport.PacketListener](&transport.UDPListener{}),
+		StreamListeners: NewExtensibleProvider[StreamListener](&tcpStreamListener{}),
 	}
 }
 
 // RegisterDefaultProviders registers a set of default providers with the providers in [ProviderContainer].
 func RegisterDefaultProviders(c *ProviderContainer) *ProviderContainer {
 	// Please keep the list in alphabetical order.
+	registerCompressStreamDialer(&c.StreamDialers, "compress", c.StreamDialers.NewInstance)
+	registerCompressStreamListener(&c.StreamListeners, "compress", c.StreamListeners.NewInstance)
+
 	registerDisorderDialer(&c.StreamDialers, "disorder", c.StreamDialers.NewInstance)
 	registerDO53StreamDialer(&c.StreamDialers, "do53", c.StreamDialers.NewInstance, c.PacketDialers.NewInstance)
 	registerDOHStreamDialer(&c.StreamDialers, "doh", c.StreamDialers.NewInstance)
 
+	registerNamedPipeStreamDialer(&c.StreamDialers, "npipe")
+
 	registerOverrideStreamDialer(&c.StreamDialers, "override", c.StreamDialers.NewInstance)
 	registerOverridePacketDialer(&c.PacketDialers, "override", c.PacketDialers.NewInstance)
 
-	registerSOCKS5StreamDialer(&c.StreamDialers, "socks5", c.StreamDialers.NewInstance)
-	registerSOCKS5PacketDialer(&c.PacketDialers, "socks5", c.StreamDialers.NewInstance, c.PacketDialers.NewInstance)
-	registerSOCKS5PacketListener(&c.PacketListeners, "socks5", c.StreamDialers.NewInstance, c.PacketDialers.NewInstance)
+	registerPortHopPacketDialer(&c.PacketDialers, "porthop", c.PacketDialers.NewInstance)
+
+	registerQUICFragPacketDialer(&c.PacketDialers, "quicfrag", c.PacketDialers.NewInstance)
+
+	registerSOCKS5StreamDialer(&c.StreamDialers, "socks5", c.StreamDialers.NewInstance, newSOCKS5TCPEndpoint)
+	registerSOCKS5PacketDialer(&c.PacketDialers, "socks5", c.StreamDialers.NewInstance, c.PacketDialers.NewInstance, newSOCKS5TCPEndpoint)
+	registerSOCKS5PacketListener(&c.PacketListeners, "socks5", c.StreamDialers.NewInstance, c.PacketDialers.NewInstance, newSOCKS5TCPEndpoint)
+	registerSOCKS5StreamDialer(&c.StreamDialers, "socks5s", c.StreamDialers.NewInstance, socks5TLSEndpoint())
+	registerSOCKS5StreamDialer(&c.StreamDialers, "socks5+wss", c.StreamDialers.NewInstance, socks5WSSEndpoint())
 
 	registerSplitStreamDialer(&c.StreamDialers, "split", c.StreamDialers.NewInstance)
 
 	registerShadowsocksStreamDialer(&c.StreamDialers, "ss", c.StreamDialers.NewInstance)
 	registerShadowsocksPacketDialer(&c.PacketDialers, "ss", c.PacketDialers.NewInstance)
 	registerShadowsocksPacketListener(&c.PacketListeners, "ss", c.PacketDialers.NewInstance)
+	registerShadowsocksStreamListener(&c.StreamListeners, "ss", c.StreamListeners.NewInstance)
+
+	registerTCPStreamDialer(&c.StreamDialers, "tcp")
 
 	registerTLSStreamDialer(&c.StreamDialers, "tls", c.StreamDialers.NewInstance)
+	registerTLSStreamListener(&c.StreamListeners, "tls", c.StreamListeners.NewInstance)
 
 	registerTLSFragStreamDialer(&c.StreamDialers, "tlsfrag", c.StreamDialers.NewInstance)
 
+	registerUnixStreamDialer(&c.StreamDialers, "unix")
+
 	registerWebsocketStreamDialer(&c.StreamDialers, "ws", c.StreamDialers.NewInstance)
 	registerWebsocketPacketDialer(&c.PacketDialers, "ws", c.StreamDialers.NewInstance)
+	registerWebsocketStreamListener(&c.StreamListeners, "ws", c.StreamListeners.NewInstance)
 
 	return c
 }
@@ -80,7 +101,11 @@ func (p *ProviderContainer) NewStreamDialer(ctx context.Context, configText stri
 	if err != nil {
 		return nil, err
 	}
-	return p.StreamDialers.NewInstance(ctx, config)
+	dialer, err := p.StreamDialers.NewInstance(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return withRootSpan(ctx, dialer, config), nil
 }
 
 // NewPacketDialer creates a [transport.PacketDialer] according to the config text.
@@ -89,16 +114,54 @@ func (p *ProviderContainer) NewPacketDialer(ctx context.Context, configText stri
 	if err != nil {
 		return nil, err
 	}
-	return p.PacketDialers.NewInstance(ctx, config)
+	dialer, err := p.PacketDialers.NewInstance(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := transport.CheckCapabilities(dialer, transport.CapabilityPacket); err != nil {
+		return nil, fmt.Errorf("config can't create packet connections: %w", err)
+	}
+	return withRootSpan(ctx, dialer, config), nil
 }
 
-// NewPacketListner creates a [transport.PacketListener] according to the config text.
+// NewPacketListner creates a [transport.PacketListener] according to the config text. Packet listeners are
+// client-side: they send the packets through the proxies of the config. Server-side packet listeners are not
+// supported, so configs with the "listen" parameter of [ProviderContainer.NewStreamListener] are rejected.
 func (p *ProviderContainer) NewPacketListener(ctx context.Context, configText string) (transport.PacketListener, error) {
 	config, err := ParseConfig(configText)
 	if err != nil {
 		return nil, err
 	}
-	return p.PacketListeners.NewInstance(ctx, config)
+	if _, _, err := cutListenAddress(config); err == nil {
+		return nil, errServerPacketListener
+	}
+	listener, err := p.PacketListeners.NewInstance(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := transport.CheckCapabilities(listener, transport.CapabilityPacket); err != nil {
+		return nil, fmt.Errorf("config can't create packet connections: %w", err)
+	}
+	return listener, nil
+}
+
+// NewStreamListener creates a [StreamListener] according to the config text, for servers. The config uses the same
+// grammar as the dialers, with the parts applied in the same order: "tls:certFile=c.pem&keyFile=k.pem|ss://..."
+// terminates TLS, and then Shadowsocks. The "listen" parameter of the last part sets the TCP address to listen on.
+func (p *ProviderContainer) NewStreamListener(ctx context.Context, configText string) (StreamListener, error) {
+	config, err := ParseConfig(configText)
+	if err != nil {
+		return nil, err
+	}
+	address, config, err := cutListenAddress(config)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := p.StreamListeners.NewInstance(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return &addressStreamListener{StreamListener: listener, address: address}, nil
 }
 
 // SanitizeConfig removes sensitive information from the given config so it can be safely be used in logging and debugging.
@@ -115,24 +178,13 @@ func SanitizeConfig(configStr string) (string, error) {
 
 	var sanitized string
 	for config != nil {
-		var part string
-		scheme := strings.ToLower(config.URL.Scheme)
-		switch scheme {
-		case "ss":
-			part, err = sanitizeShadowsocksURL(config.URL)
-			if err != nil {
-				return "", err
-			}
-		case "socks5":
-			part, err = sanitizeSOCKS5URL(&config.URL)
-			if err != nil {
-				return "", err
-			}
-		case "override", "split", "tls", "tlsfrag":
-			// No sanitization needed
-			part = config.URL.String()
-		default:
-			part = scheme + "://UNKNOWN"
+		part := strings.ToLower(config.URL.Scheme) + "://UNKNOWN"
+		u, err := sanitizeConfigURL(config.URL)
+		if err != nil {
+			return "", err
+		}
+		if u != nil {
+			part = u.String()
 		}
 		if sanitized == "" {
 			sanitized = part
@@ -144,11 +196,30 @@ func SanitizeConfig(configStr string) (string, error) {
 	return sanitized, nil
 }
 
-func sanitizeSOCKS5URL(u *url.URL) (string, error) {
+// sanitizeConfigURL returns the config URL with secrets redacted, or nil if the config type is unknown,
+// in which case it can't be known which parts are sensitive.
+func sanitizeConfigURL(u url.URL) (*url.URL, error) {
+	switch strings.ToLower(u.Scheme) {
+	case "ss":
+		sanitized, err := sanitizeShadowsocksURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return parseConfigPart(sanitized)
+	case "socks5", "socks5s", "socks5+wss":
+		return sanitizeSOCKS5URL(u), nil
+	case "compress", "disorder", "do53", "doh", "npipe", "override", "porthop", "quicfrag", "split", "tcp", "tls", "tlsfrag", "unix", "ws":
+		// No sanitization needed
+		return &u, nil
+	default:
+		return nil, nil
+	}
+}
+
+func sanitizeSOCKS5URL(u url.URL) *url.URL {
 	const redactedPlaceholder = "REDACTED"
 	if u.User != nil {
 		u.User = url.User(redactedPlaceholder)
-		return u.String(), nil
 	}
-	return u.String(), nil
+	return &u
 }
@@ -15,8 +15,11 @@
 package configurl
 
 import (
+	"context"
 	"testing"
 
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/socks5"
 	"github.com/stretchr/testify/require"
 )
 
@@ -60,3 +63,20 @@ func TestSocks5URLSanitization(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "socks5://REDACTED@192.168.1.100:1080", sanitizedConfig)
 }
+
+func TestNewPacketDialer_MissingPacketCapability(t *testing.T) {
+	providers := NewDefaultProviders()
+	// A SOCKS5 client without packets enabled can't create packet connections.
+	providers.PacketDialers.RegisterType("tcponly", func(ctx context.Context, config *Config) (transport.PacketDialer, error) {
+		client, err := socks5.NewClient(&transport.TCPEndpoint{Address: config.URL.Host})
+		if err != nil {
+			return nil, err
+		}
+		return transport.PacketListenerDialer{Listener: client}, nil
+	})
+	_, err := providers.NewPacketDialer(context.Background(), "tcponly://localhost:1080")
+	require.ErrorIs(t, err, transport.ErrMissingCapability)
+
+	_, err = providers.NewPacketDialer(context.Background(), "socks5://localhost:1080")
+	require.NoError(t, err)
+}
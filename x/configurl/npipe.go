@@ -0,0 +1,54 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/npipe"
+)
+
+// parseNamedPipePath returns the Windows path of a npipe config, which can be "npipe:////./pipe/[NAME]", as in
+// Docker, or "npipe://./pipe/[NAME]". Both are `\\.\pipe\[NAME]`.
+func parseNamedPipePath(configURL url.URL) (string, error) {
+	path := configURL.Path
+	if configURL.Host != "" {
+		path = "//" + configURL.Host + path
+	}
+	if !strings.HasPrefix(path, "//") || len(path) <= 2 {
+		return "", errors.New("pipe path must be in the format npipe:////[SERVER]/pipe/[NAME]")
+	}
+	return strings.ReplaceAll(path, "/", `\`), nil
+}
+
+func registerNamedPipeStreamDialer(r TypeRegistry[transport.StreamDialer], typeID string) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.StreamDialer, error) {
+		if config.BaseConfig != nil {
+			return nil, errors.New("npipe must be the first part of the config")
+		}
+		path, err := parseNamedPipePath(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		endpoint := &npipe.Endpoint{Path: path}
+		return transport.FuncStreamDialer(func(ctx context.Context, _ string) (transport.StreamConn, error) {
+			return endpoint.ConnectStream(ctx)
+		}), nil
+	})
+}
@@ -0,0 +1,37 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNamedPipePath(t *testing.T) {
+	for config, want := range map[string]string{
+		"npipe:////./pipe/proxy":    `\\.\pipe\proxy`,
+		"npipe://./pipe/proxy":      `\\.\pipe\proxy`,
+		"npipe:////server/pipe/a/b": `\\server\pipe\a\b`,
+	} {
+		path, err := parseNamedPipePath(mustParseURL(t, config))
+		require.NoError(t, err, config)
+		require.Equal(t, want, path, config)
+	}
+	for _, config := range []string{"npipe:", "npipe:/pipe/proxy", "npipe:proxy"} {
+		_, err := parseNamedPipePath(mustParseURL(t, config))
+		require.Error(t, err, config)
+	}
+}
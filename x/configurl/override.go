@@ -16,24 +16,49 @@ package configurl
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"net/url"
 	"strings"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 )
 
+// overrideOptions are the options of the override config.
+type overrideOptions struct {
+	host string
+	port string
+	sni  string
+	ip   string
+}
+
 func registerOverrideStreamDialer(r TypeRegistry[transport.StreamDialer], typeID string, newSD BuildFunc[transport.StreamDialer]) {
 	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.StreamDialer, error) {
-		sd, err := newSD(ctx, config.BaseConfig)
+		options, err := parseOverrideOptions(config.URL)
 		if err != nil {
 			return nil, err
 		}
-		override, err := newOverrideFromURL(config.URL)
+		baseConfig := config.BaseConfig
+		overTLS := baseConfig != nil && strings.ToLower(baseConfig.URL.Scheme) == "tls"
+		if options.sni != "" && !overTLS {
+			return nil, errors.New("sni option requires a tls config before the override")
+		}
+		if overTLS && (options.sni != "" || options.ip != "") {
+			// The tls config gets the SNI as an explicit option, and connects to the IP, so that the SNI and
+			// certificate validation still use the host.
+			baseConfig, err = overrideTLSConfig(baseConfig, typeID, options.sni, options.ip)
+			if err != nil {
+				return nil, err
+			}
+			options.ip = ""
+		}
+		sd, err := newSD(ctx, baseConfig)
 		if err != nil {
 			return nil, err
 		}
+		override := newOverride(options.connectHost(), options.port)
 		return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
 			addr, err := override(addr)
 			if err != nil {
@@ -50,10 +75,14 @@ func registerOverridePacketDialer(r TypeRegistry[transport.PacketDialer], typeID
 		if err != nil {
 			return nil, err
 		}
-		override, err := newOverrideFromURL(config.URL)
+		options, err := parseOverrideOptions(config.URL)
 		if err != nil {
 			return nil, err
 		}
+		if options.sni != "" {
+			return nil, errors.New("sni option is not supported for packet dialers")
+		}
+		override := newOverride(options.connectHost(), options.port)
 		return transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
 			addr, err := override(addr)
 			if err != nil {
@@ -64,34 +93,89 @@ func registerOverridePacketDialer(r TypeRegistry[transport.PacketDialer], typeID
 	})
 }
 
-func newOverrideFromURL(configURL url.URL) (func(string) (string, error), error) {
+// overrideTLSConfig returns a copy of the tls config with the given SNI, if not empty, and with an overrideTypeID
+// config to the given IP, if not empty, before it.
+func overrideTLSConfig(tlsConfig *Config, overrideTypeID string, sni string, ip string) (*Config, error) {
+	tlsURL := tlsConfig.URL
+	if sni != "" {
+		values, err := url.ParseQuery(tlsURL.Opaque)
+		if err != nil {
+			return nil, err
+		}
+		for key := range values {
+			if strings.ToLower(key) == "sni" {
+				delete(values, key)
+			}
+		}
+		values.Set("sni", sni)
+		tlsURL.Opaque = values.Encode()
+	}
+	baseConfig := tlsConfig.BaseConfig
+	if ip != "" {
+		baseConfig = &Config{URL: url.URL{Scheme: overrideTypeID, Opaque: url.Values{"host": {ip}}.Encode()}, BaseConfig: baseConfig}
+	}
+	return &Config{URL: tlsURL, BaseConfig: baseConfig}, nil
+}
+
+// connectHost returns the host to connect to, which is the IP if set.
+func (o *overrideOptions) connectHost() string {
+	if o.ip != "" {
+		return o.ip
+	}
+	return o.host
+}
+
+func parseOverrideOptions(configURL url.URL) (*overrideOptions, error) {
 	query := configURL.Opaque
 	values, err := url.ParseQuery(query)
 	if err != nil {
 		return nil, err
 	}
-	hostOverride, portOverride := "", ""
+	options := &overrideOptions{}
 	for key, values := range values {
+		if len(values) != 1 {
+			return nil, fmt.Errorf("%v option must has one value, found %v", key, len(values))
+		}
 		switch strings.ToLower(key) {
 		case "host":
-			if len(values) != 1 {
-				return nil, fmt.Errorf("host option must has one value, found %v", len(values))
-			}
-			hostOverride = values[0]
+			options.host = values[0]
 		case "port":
-			if len(values) != 1 {
-				return nil, fmt.Errorf("port option must has one value, found %v", len(values))
+			options.port = values[0]
+		case "sni":
+			options.sni = values[0]
+		case "ip":
+			if _, err := netip.ParseAddr(values[0]); err != nil {
+				return nil, fmt.Errorf("ip option must be an IP address: %w", err)
 			}
-			portOverride = values[0]
+			options.ip = values[0]
 		default:
 			return nil, fmt.Errorf("unsupported option %v", key)
 		}
 	}
+	if options.host != "" && options.ip != "" {
+		return nil, errors.New("host and ip options are mutually exclusive")
+	}
+	return options, nil
+}
+
+func newOverrideFromURL(configURL url.URL) (func(string) (string, error), error) {
+	options, err := parseOverrideOptions(configURL)
+	if err != nil {
+		return nil, err
+	}
+	return newOverride(options.connectHost(), options.port), nil
+}
+
+// newOverride returns a function that replaces the host and port of an address with the non-empty overrides.
+func newOverride(hostOverride, portOverride string) func(string) (string, error) {
 	return func(address string) (string, error) {
 		// Optimization when we fully override the address.
 		if hostOverride != "" && portOverride != "" {
 			return net.JoinHostPort(hostOverride, portOverride), nil
 		}
+		if hostOverride == "" && portOverride == "" {
+			return address, nil
+		}
 		host, port, err := net.SplitHostPort(address)
 		if err != nil {
 			return "", fmt.Errorf("address is not valid host:port: %w", err)
@@ -103,5 +187,5 @@ func newOverrideFromURL(configURL url.URL) (func(string) (string, error), error)
 			port = portOverride
 		}
 		return net.JoinHostPort(host, port), nil
-	}, nil
+	}
 }
@@ -15,6 +15,10 @@
 package configurl
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/url"
 	"testing"
 
@@ -69,3 +73,85 @@ func Test_newOverrideFromURL(t *testing.T) {
 		})
 	})
 }
+
+func Test_parseOverrideOptions(t *testing.T) {
+	for _, config := range []string{
+		"override:ip=www.google.com",
+		"override:ip=8.8.8.8&host=dns.google",
+		"override:host=a&host=b",
+		"override:foo=bar",
+	} {
+		cfgUrl, err := url.Parse(config)
+		require.NoError(t, err)
+		_, err = parseOverrideOptions(*cfgUrl)
+		require.Error(t, err, config)
+	}
+
+	cfgUrl, err := url.Parse("override:ip=2001:db8::1&port=853")
+	require.NoError(t, err)
+	override, err := newOverrideFromURL(*cfgUrl)
+	require.NoError(t, err)
+	addr, err := override("dns.google:53")
+	require.NoError(t, err)
+	require.Equal(t, "[2001:db8::1]:853", addr)
+}
+
+// startSNIRecorder starts a TLS listener that records the SNI of the first connection and fails the handshake.
+func startSNIRecorder(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	serverNames := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tls.Server(conn, &tls.Config{
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				serverNames <- hello.ServerName
+				return nil, errors.New("done")
+			},
+		}).Handshake()
+	}()
+	return listener.Addr().String(), serverNames
+}
+
+func TestOverrideStreamDialer_TLS(t *testing.T) {
+	providers := NewDefaultProviders()
+	t.Run("IP keeps SNI", func(t *testing.T) {
+		serverAddr, serverNames := startSNIRecorder(t)
+		host, port, err := net.SplitHostPort(serverAddr)
+		require.NoError(t, err)
+		dialer, err := providers.NewStreamDialer(context.Background(), "tls|override:ip="+host)
+		require.NoError(t, err)
+		_, err = dialer.DialStream(context.Background(), net.JoinHostPort("blocked.example", port))
+		require.Error(t, err)
+		require.Equal(t, "blocked.example", <-serverNames)
+	})
+	t.Run("SNI", func(t *testing.T) {
+		serverAddr, serverNames := startSNIRecorder(t)
+		dialer, err := providers.NewStreamDialer(context.Background(), "tls:sni=ignored.example|override:sni=front.example")
+		require.NoError(t, err)
+		_, err = dialer.DialStream(context.Background(), serverAddr)
+		require.Error(t, err)
+		require.Equal(t, "front.example", <-serverNames)
+	})
+	t.Run("IP and SNI", func(t *testing.T) {
+		serverAddr, serverNames := startSNIRecorder(t)
+		host, port, err := net.SplitHostPort(serverAddr)
+		require.NoError(t, err)
+		dialer, err := providers.NewStreamDialer(context.Background(), "tls:SNI=ignored.example&alpn=h2|override:ip="+host+"&sni=front.example")
+		require.NoError(t, err)
+		_, err = dialer.DialStream(context.Background(), net.JoinHostPort("blocked.example", port))
+		require.Error(t, err)
+		require.Equal(t, "front.example", <-serverNames)
+	})
+	t.Run("SNI requires tls", func(t *testing.T) {
+		_, err := providers.NewStreamDialer(context.Background(), "override:sni=front.example")
+		require.Error(t, err)
+		_, err = providers.NewPacketDialer(context.Background(), "override:sni=front.example")
+		require.Error(t, err)
+	})
+}
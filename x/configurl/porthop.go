@@ -0,0 +1,68 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/porthop"
+)
+
+func registerPortHopPacketDialer(r TypeRegistry[transport.PacketDialer], typeID string, newPD BuildFunc[transport.PacketDialer]) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.PacketDialer, error) {
+		pd, err := newPD(ctx, config.BaseConfig)
+		if err != nil {
+			return nil, err
+		}
+		values, err := url.ParseQuery(config.URL.Opaque)
+		if err != nil {
+			return nil, err
+		}
+		var ports porthop.PortRange
+		var interval time.Duration
+		for key, values := range values {
+			if len(values) != 1 {
+				return nil, fmt.Errorf("%v option must has one value, found %v", key, len(values))
+			}
+			switch strings.ToLower(key) {
+			case "ports":
+				ports, err = porthop.ParsePortRange(values[0])
+				if err != nil {
+					return nil, err
+				}
+			case "interval":
+				interval, err = time.ParseDuration(values[0])
+				if err != nil {
+					return nil, fmt.Errorf("invalid interval: %w", err)
+				}
+			default:
+				return nil, fmt.Errorf("unsupported option %v", key)
+			}
+		}
+		if ports.First == 0 {
+			return nil, errors.New("ports option is required")
+		}
+		if interval == 0 {
+			interval = 30 * time.Second
+		}
+		return porthop.NewPacketDialer(pd, ports, interval)
+	})
+}
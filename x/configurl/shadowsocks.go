@@ -16,14 +16,13 @@ package configurl
 
 import (
 	"context"
-	"encoding/base64"
-	"errors"
 	"fmt"
 	"net/url"
-	"strings"
+	"strconv"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 	"github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks"
+	"github.com/Jigsaw-Code/outline-sdk/x/internal/ssurl"
 )
 
 func registerShadowsocksStreamDialer(r TypeRegistry[transport.StreamDialer], typeID string, newSD BuildFunc[transport.StreamDialer]) {
@@ -36,7 +35,10 @@ func registerShadowsocksStreamDialer(r TypeRegistry[transport.StreamDialer], typ
 		if err != nil {
 			return nil, err
 		}
-		endpoint := &transport.StreamDialerEndpoint{Dialer: sd, Address: ssConfig.serverAddress}
+		endpoint, err := newStreamEndpoint(sd, ssConfig.serverAddress)
+		if err != nil {
+			return nil, err
+		}
 		dialer, err := shadowsocks.NewStreamDialer(endpoint, ssConfig.cryptoKey)
 		if err != nil {
 			return nil, err
@@ -44,6 +46,8 @@ func registerShadowsocksStreamDialer(r TypeRegistry[transport.StreamDialer], typ
 		if len(ssConfig.prefix) > 0 {
 			dialer.SaltGenerator = shadowsocks.NewPrefixSaltGenerator(ssConfig.prefix)
 		}
+		dialer.InitialWriteMode = ssConfig.initialWriteMode
+		dialer.InitialWriteFragmentSize = ssConfig.initialWriteFragmentSize
 		return dialer, nil
 	})
 }
@@ -58,7 +62,10 @@ func registerShadowsocksPacketDialer(r TypeRegistry[transport.PacketDialer], typ
 		if err != nil {
 			return nil, err
 		}
-		endpoint := &transport.PacketDialerEndpoint{Dialer: pd, Address: ssConfig.serverAddress}
+		endpoint, err := newPacketEndpoint(pd, ssConfig.serverAddress)
+		if err != nil {
+			return nil, err
+		}
 		pl, err := shadowsocks.NewPacketListener(endpoint, ssConfig.cryptoKey)
 		if err != nil {
 			return nil, err
@@ -78,15 +85,20 @@ func registerShadowsocksPacketListener(r TypeRegistry[transport.PacketListener],
 		if err != nil {
 			return nil, err
 		}
-		endpoint := &transport.PacketDialerEndpoint{Dialer: pd, Address: ssConfig.serverAddress}
+		endpoint, err := newPacketEndpoint(pd, ssConfig.serverAddress)
+		if err != nil {
+			return nil, err
+		}
 		return shadowsocks.NewPacketListener(endpoint, ssConfig.cryptoKey)
 	})
 }
 
 type shadowsocksConfig struct {
-	serverAddress string
-	cryptoKey     *shadowsocks.EncryptionKey
-	prefix        []byte
+	serverAddress            string
+	cryptoKey                *shadowsocks.EncryptionKey
+	prefix                   []byte
+	initialWriteMode         shadowsocks.InitialWriteMode
+	initialWriteFragmentSize int
 }
 
 func parseShadowsocksURL(url url.URL) (*shadowsocksConfig, error) {
@@ -102,100 +114,62 @@ func parseShadowsocksURL(url url.URL) (*shadowsocksConfig, error) {
 // parseShadowsocksLegacyBase64URL parses URL based on legacy base64 format:
 // https://shadowsocks.org/doc/configs.html#uri-and-qr-code
 func parseShadowsocksLegacyBase64URL(url url.URL) (*shadowsocksConfig, error) {
-	config := &shadowsocksConfig{}
-	if url.Host == "" {
-		return nil, errors.New("host not specified")
-	}
-	decoded, err := base64.URLEncoding.WithPadding(base64.NoPadding).DecodeString(url.Host)
+	key, err := ssurl.ParseLegacy(url.Host)
 	if err != nil {
-		// If decoding fails, return the original url with error
-		return nil, fmt.Errorf("failed to decode host string [%v]: %w", url.String(), err)
+		return nil, err
 	}
-	var fragment string
-	if url.Fragment != "" {
-		fragment = "#" + url.Fragment
-	} else {
-		fragment = ""
-	}
-	newURL, err := url.Parse(strings.ToLower(url.Scheme) + "://" + string(decoded) + fragment)
-	if err != nil {
-		// if parsing fails, return the original url with error
-		return nil, fmt.Errorf("failed to parse config part: %w", err)
-	}
-	// extend this check to see if decoded string contains contains other valid fields
-	if newURL.User == nil {
-		return nil, fmt.Errorf("invalid user info: %w", err)
-	}
-	cipherInfoBytes := newURL.User.String()
-	cipherName, secret, found := strings.Cut(string(cipherInfoBytes), ":")
-	if !found {
-		return nil, errors.New("invalid cipher info: no ':' separator")
-	}
-	config.serverAddress = newURL.Host
-	config.cryptoKey, err = shadowsocks.NewEncryptionKey(cipherName, secret)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
-	}
-	prefixStr := newURL.Query().Get("prefix")
-	if len(prefixStr) > 0 {
-		config.prefix, err = parseStringPrefix(prefixStr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse prefix: %w", err)
-		}
-	}
-	return config, nil
+	return newShadowsocksConfig(key)
 }
 
 // parseShadowsocksSIP002URL parses URL based on SIP002 format:
 // https://shadowsocks.org/doc/sip002.html
 func parseShadowsocksSIP002URL(url url.URL) (*shadowsocksConfig, error) {
-	config := &shadowsocksConfig{}
-	if url.Host == "" {
-		return nil, errors.New("host not specified")
-	}
-	config.serverAddress = url.Host
-	userInfo := url.User.String()
-	// Cipher info can be optionally encoded with Base64URL.
-	encoding := base64.URLEncoding.WithPadding(base64.NoPadding)
-	decodedUserInfo, err := encoding.DecodeString(userInfo)
+	key, err := ssurl.ParseSIP002(&url)
 	if err != nil {
-		// Try base64 decoding in legacy mode
-		decodedUserInfo, err = base64.StdEncoding.DecodeString(userInfo)
+		return nil, err
 	}
-	var cipherInfo string
-	if err == nil {
-		cipherInfo = string(decodedUserInfo)
-	} else {
-		cipherInfo = userInfo
-	}
-	cipherName, secret, found := strings.Cut(cipherInfo, ":")
-	if !found {
-		return nil, errors.New("invalid cipher info: no ':' separator")
-	}
-	config.cryptoKey, err = shadowsocks.NewEncryptionKey(cipherName, secret)
+	return newShadowsocksConfig(key)
+}
+
+func newShadowsocksConfig(key *ssurl.Key) (*shadowsocksConfig, error) {
+	cryptoKey, err := shadowsocks.NewEncryptionKey(key.Cipher, key.Secret)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
-	prefixStr := url.Query().Get("prefix")
-	if len(prefixStr) > 0 {
-		config.prefix, err = parseStringPrefix(prefixStr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse prefix: %w", err)
-		}
+	config := &shadowsocksConfig{serverAddress: key.Address, cryptoKey: cryptoKey}
+	if err := parseShadowsocksQuery(config, key.Query); err != nil {
+		return nil, err
 	}
 	return config, nil
 }
 
-func parseStringPrefix(utf8Str string) ([]byte, error) {
-	runes := []rune(utf8Str)
-	rawBytes := make([]byte, len(runes))
-	for i, r := range runes {
-		if (r & 0xFF) != r {
-			return nil, fmt.Errorf("character out of range: %d", r)
+// parseShadowsocksQuery parses the options in the query of a Shadowsocks URL.
+func parseShadowsocksQuery(config *shadowsocksConfig, query url.Values) error {
+	var err error
+	prefixStr := query.Get("prefix")
+	if len(prefixStr) > 0 {
+		config.prefix, err = ssurl.ParsePrefix(prefixStr)
+		if err != nil {
+			return fmt.Errorf("failed to parse prefix: %w", err)
+		}
+	}
+	switch mode := query.Get("initial_write"); mode {
+	case "", shadowsocks.InitialWriteCoalesced.String():
+		config.initialWriteMode = shadowsocks.InitialWriteCoalesced
+	case shadowsocks.InitialWriteSeparateSalt.String():
+		config.initialWriteMode = shadowsocks.InitialWriteSeparateSalt
+	case shadowsocks.InitialWriteSeparateData.String():
+		config.initialWriteMode = shadowsocks.InitialWriteSeparateData
+	default:
+		return fmt.Errorf("unsupported initial_write mode %q", mode)
+	}
+	if sizeStr := query.Get("initial_write_fragment"); sizeStr != "" {
+		config.initialWriteFragmentSize, err = strconv.Atoi(sizeStr)
+		if err != nil || config.initialWriteFragmentSize <= 0 {
+			return fmt.Errorf("invalid initial_write_fragment %q: it must be a positive number", sizeStr)
 		}
-		rawBytes[i] = byte(r)
 	}
-	return rawBytes, nil
+	return nil
 }
 
 func sanitizeShadowsocksURL(u url.URL) (string, error) {
@@ -204,8 +178,10 @@ func sanitizeShadowsocksURL(u url.URL) (string, error) {
 		return "", err
 	}
 	values := make(url.Values)
-	if prefix := u.Query().Get("prefix"); prefix != "" {
-		values.Add("prefix", prefix)
+	for _, key := range []string{"prefix", "initial_write", "initial_write_fragment"} {
+		if value := u.Query().Get(key); value != "" {
+			values.Add(key, value)
+		}
 	}
 	cleanURL := url.URL{
 		Scheme:   "ss",
@@ -19,6 +19,7 @@ import (
 	"net/url"
 	"testing"
 
+	"github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks"
 	"github.com/stretchr/testify/require"
 )
 
@@ -145,3 +146,30 @@ func TestParseShadowsocksSIP002URLUnsuccessful(t *testing.T) {
 	_, err = parseShadowsocksSIP002URL(config.URL)
 	require.Error(t, err, "URL is %v", config.URL.String())
 }
+
+func TestParseShadowsocksURLInitialWrite(t *testing.T) {
+	config, err := ParseConfig("ss://YWVzLTEyOC1nY206dGVzdA@example.com:1234?initial_write=separate-salt&initial_write_fragment=40")
+	require.NoError(t, err)
+	ssConfig, err := parseShadowsocksURL(config.URL)
+	require.NoError(t, err)
+	require.Equal(t, shadowsocks.InitialWriteSeparateSalt, ssConfig.initialWriteMode)
+	require.Equal(t, 40, ssConfig.initialWriteFragmentSize)
+
+	config, err = ParseConfig("ss://YWVzLTEyOC1nY206dGVzdA@example.com:1234?initial_write=separate-data")
+	require.NoError(t, err)
+	ssConfig, err = parseShadowsocksURL(config.URL)
+	require.NoError(t, err)
+	require.Equal(t, shadowsocks.InitialWriteSeparateData, ssConfig.initialWriteMode)
+	require.Equal(t, 0, ssConfig.initialWriteFragmentSize)
+
+	for _, query := range []string{"initial_write=other", "initial_write_fragment=0", "initial_write_fragment=x"} {
+		config, err = ParseConfig("ss://YWVzLTEyOC1nY206dGVzdA@example.com:1234?" + query)
+		require.NoError(t, err)
+		_, err = parseShadowsocksURL(config.URL)
+		require.Error(t, err, query)
+	}
+
+	sanitized, err := SanitizeConfig("ss://YWVzLTEyOC1nY206dGVzdA@example.com:1234?initial_write=separate-salt&initial_write_fragment=40")
+	require.NoError(t, err)
+	require.Equal(t, "ss://REDACTED@example.com:1234?initial_write=separate-salt&initial_write_fragment=40", sanitized)
+}
@@ -16,23 +16,97 @@ package configurl
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 	"github.com/Jigsaw-Code/outline-sdk/transport/socks5"
+	"github.com/Jigsaw-Code/outline-sdk/transport/tls"
+	"github.com/Jigsaw-Code/outline-sdk/x/websocket"
 )
 
-func registerSOCKS5StreamDialer(r TypeRegistry[transport.StreamDialer], typeID string, newSD BuildFunc[transport.StreamDialer]) {
+// newSOCKS5EndpointFunc creates the endpoint of the SOCKS5 server in the config URL, on top of the given dialer.
+type newSOCKS5EndpointFunc func(sd transport.StreamDialer, configURL url.URL) (transport.StreamEndpoint, error)
+
+// newSOCKS5TCPEndpoint connects to the SOCKS5 server directly, as in socks5://HOST:PORT.
+func newSOCKS5TCPEndpoint(sd transport.StreamDialer, configURL url.URL) (transport.StreamEndpoint, error) {
+	return newStreamEndpoint(sd, configURL.Host)
+}
+
+// socks5TLSEndpoint returns a function that connects to the SOCKS5 server over TLS, as in
+// socks5s://HOST:PORT?sni=SNI&certname=CERT_NAME. The options from the config URL take precedence over tlsOptions.
+func socks5TLSEndpoint(tlsOptions ...tls.ClientOption) newSOCKS5EndpointFunc {
+	return func(sd transport.StreamDialer, configURL url.URL) (transport.StreamEndpoint, error) {
+		tlsDialer, err := newSOCKS5TLSDialer(sd, configURL.RawQuery, tlsOptions)
+		if err != nil {
+			return nil, err
+		}
+		return newStreamEndpoint(tlsDialer, configURL.Host)
+	}
+}
+
+// socks5WSSEndpoint returns a function that connects to the SOCKS5 server over a WebSocket over TLS, as in
+// socks5+wss://HOST:PORT/PATH?host=HOST&sni=SNI&certname=CERT_NAME. The options from the config URL take
+// precedence over tlsOptions.
+func socks5WSSEndpoint(tlsOptions ...tls.ClientOption) newSOCKS5EndpointFunc {
+	return func(sd transport.StreamDialer, configURL url.URL) (transport.StreamEndpoint, error) {
+		values, err := url.ParseQuery(configURL.RawQuery)
+		if err != nil {
+			return nil, err
+		}
+		var wsOptions []websocket.Option
+		tlsValues := url.Values{}
+		for key, values := range values {
+			if strings.ToLower(key) != "host" {
+				tlsValues[key] = values
+				continue
+			}
+			if len(values) != 1 {
+				return nil, fmt.Errorf("host option must has one value, found %v", len(values))
+			}
+			wsOptions = append(wsOptions, websocket.WithHost(values[0]))
+		}
+		tlsDialer, err := newSOCKS5TLSDialer(sd, tlsValues.Encode(), tlsOptions)
+		if err != nil {
+			return nil, err
+		}
+		path := configURL.Path
+		if path == "" {
+			path = "/"
+		}
+		// The TLS dialer already secures the connection, so the WebSocket runs in the clear on top of it.
+		wsURL := url.URL{Scheme: "ws", Host: configURL.Host, Path: path}
+		connect, err := websocket.NewStreamEndpoint(wsURL.String(), &transport.StreamDialerEndpoint{Dialer: tlsDialer, Address: configURL.Host}, wsOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create websocket stream endpoint: %w", err)
+		}
+		return transport.FuncStreamEndpoint(connect), nil
+	}
+}
+
+func newSOCKS5TLSDialer(sd transport.StreamDialer, query string, tlsOptions []tls.ClientOption) (transport.StreamDialer, error) {
+	options, err := parseOptions(url.URL{Opaque: query})
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewStreamDialer(sd, append(tlsOptions[:len(tlsOptions):len(tlsOptions)], options...)...)
+}
+
+func registerSOCKS5StreamDialer(r TypeRegistry[transport.StreamDialer], typeID string, newSD BuildFunc[transport.StreamDialer], newEndpoint newSOCKS5EndpointFunc) {
 	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.StreamDialer, error) {
-		return newSOCKS5Client(ctx, *config, newSD)
+		return newSOCKS5Client(ctx, *config, newSD, newEndpoint)
 	})
 }
 
-func registerSOCKS5PacketDialer(r TypeRegistry[transport.PacketDialer], typeID string, newSD BuildFunc[transport.StreamDialer], newPD BuildFunc[transport.PacketDialer]) {
+func registerSOCKS5PacketDialer(r TypeRegistry[transport.PacketDialer], typeID string, newSD BuildFunc[transport.StreamDialer], newPD BuildFunc[transport.PacketDialer], newEndpoint newSOCKS5EndpointFunc) {
 	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.PacketDialer, error) {
-		client, err := newSOCKS5Client(ctx, *config, newSD)
+		client, err := newSOCKS5Client(ctx, *config, newSD, newEndpoint)
 		if err != nil {
 			return nil, err
 		}
+		// The UDP relay is reached directly, even when the control connection is secured,
+		// since SOCKS5 exchanges the datagrams in the clear.
 		pd, err := newPD(ctx, config.BaseConfig)
 		if err != nil {
 			return nil, err
@@ -42,12 +116,14 @@ func registerSOCKS5PacketDialer(r TypeRegistry[transport.PacketDialer], typeID s
 	})
 }
 
-func registerSOCKS5PacketListener(r TypeRegistry[transport.PacketListener], typeID string, newSD BuildFunc[transport.StreamDialer], newPD BuildFunc[transport.PacketDialer]) {
+func registerSOCKS5PacketListener(r TypeRegistry[transport.PacketListener], typeID string, newSD BuildFunc[transport.StreamDialer], newPD BuildFunc[transport.PacketDialer], newEndpoint newSOCKS5EndpointFunc) {
 	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.PacketListener, error) {
-		client, err := newSOCKS5Client(ctx, *config, newSD)
+		client, err := newSOCKS5Client(ctx, *config, newSD, newEndpoint)
 		if err != nil {
 			return nil, err
 		}
+		// The UDP relay is reached directly, even when the control connection is secured,
+		// since SOCKS5 exchanges the datagrams in the clear.
 		pd, err := newPD(ctx, config.BaseConfig)
 		if err != nil {
 			return nil, err
@@ -57,13 +133,16 @@ func registerSOCKS5PacketListener(r TypeRegistry[transport.PacketListener], type
 	})
 }
 
-func newSOCKS5Client(ctx context.Context, config Config, newSD BuildFunc[transport.StreamDialer]) (*socks5.Client, error) {
+func newSOCKS5Client(ctx context.Context, config Config, newSD BuildFunc[transport.StreamDialer], newEndpoint newSOCKS5EndpointFunc) (*socks5.Client, error) {
 	sd, err := newSD(ctx, config.BaseConfig)
 	if err != nil {
 		return nil, err
 	}
-	endpoint := transport.StreamDialerEndpoint{Dialer: sd, Address: config.URL.Host}
-	client, err := socks5.NewClient(&endpoint)
+	endpoint, err := newEndpoint(sd, config.URL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := socks5.NewClient(endpoint)
 	if err != nil {
 		return nil, err
 	}
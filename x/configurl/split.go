@@ -17,8 +17,10 @@ package configurl
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 	"github.com/Jigsaw-Code/outline-sdk/transport/split"
@@ -30,7 +32,11 @@ func registerSplitStreamDialer(r TypeRegistry[transport.StreamDialer], typeID st
 		if err != nil {
 			return nil, err
 		}
-		configText := config.URL.Opaque
+		configText, optionsText, _ := strings.Cut(config.URL.Opaque, "&")
+		opts, err := parseSplitOptions(optionsText)
+		if err != nil {
+			return nil, err
+		}
 		splits := make([]split.RepeatedSplit, 0)
 		for _, part := range strings.Split(configText, ",") {
 			var count int
@@ -57,6 +63,36 @@ func registerSplitStreamDialer(r TypeRegistry[transport.StreamDialer], typeID st
 			}
 			splits = append(splits, split.RepeatedSplit{Count: count, Bytes: bytes})
 		}
-		return split.NewStreamDialer(sd, split.NewRepeatedSplitIterator(splits...))
+		return split.NewStreamDialer(sd, split.NewRepeatedSplitIterator(splits...), opts...)
 	})
 }
+
+// parseSplitOptions parses the options after the split pattern, like "delay=20ms&jitter=5ms".
+func parseSplitOptions(text string) ([]split.Option, error) {
+	values, err := url.ParseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	var delay, jitter time.Duration
+	for key, values := range values {
+		if len(values) != 1 {
+			return nil, fmt.Errorf("%v option must has one value, found %v", key, len(values))
+		}
+		value, err := time.ParseDuration(values[0])
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid %v option %q: it must be a non-negative duration", key, values[0])
+		}
+		switch strings.ToLower(key) {
+		case "delay":
+			delay = value
+		case "jitter":
+			jitter = value
+		default:
+			return nil, fmt.Errorf("unsupported option %v", key)
+		}
+	}
+	if delay == 0 && jitter == 0 {
+		return nil, nil
+	}
+	return []split.Option{split.WithDelay(delay, jitter)}, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit_Delay(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	dialer, err := NewDefaultProviders().NewStreamDialer(context.Background(), "split:1,1&delay=50ms")
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	start := time.Now()
+	_, err = conn.Write([]byte("abc"))
+	require.NoError(t, err)
+	// There are two waits, between the three segments.
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	desc := Describe(dialer)
+	require.Equal(t, map[string]string{"value": "1,1", "delay": "50ms"}, desc.Options)
+}
+
+func TestSplit_InvalidOptions(t *testing.T) {
+	providers := NewDefaultProviders()
+	for _, config := range []string{
+		"split:5&delay=x",
+		"split:5&delay=-1ms",
+		"split:5&jitter=1ms&jitter=2ms",
+		"split:5&other=1ms",
+	} {
+		_, err := providers.NewStreamDialer(context.Background(), config)
+		require.Error(t, err, config)
+	}
+	_, err := providers.NewStreamDialer(context.Background(), "split:5&delay=10ms&jitter=5ms")
+	require.NoError(t, err)
+}
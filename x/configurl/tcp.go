@@ -0,0 +1,77 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+func registerTCPStreamDialer(r TypeRegistry[transport.StreamDialer], typeID string) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.StreamDialer, error) {
+		if config.BaseConfig != nil {
+			return nil, errors.New("tcp must be the first part of the config")
+		}
+		return parseTCPDialer(config.URL)
+	})
+}
+
+// parseTCPDialer parses the options of the tcp config, like "tcp:keepalive=15s&keepalive_count=3".
+func parseTCPDialer(configURL url.URL) (*transport.TCPDialer, error) {
+	values, err := url.ParseQuery(configURL.Opaque)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &transport.TCPDialer{}
+	for key, values := range values {
+		if len(values) != 1 {
+			return nil, fmt.Errorf("%v option must has one value, found %v", key, len(values))
+		}
+		switch strings.ToLower(key) {
+		case "keepalive":
+			dialer.KeepAlive.Idle, err = parseTCPDuration(key, values[0])
+		case "keepalive_interval":
+			dialer.KeepAlive.Interval, err = parseTCPDuration(key, values[0])
+		case "keepalive_count":
+			dialer.KeepAlive.Count, err = strconv.Atoi(values[0])
+			if err != nil || dialer.KeepAlive.Count < 0 {
+				err = fmt.Errorf("invalid %v option %q: it must be a non-negative integer", key, values[0])
+			}
+		case "user_timeout":
+			dialer.UserTimeout, err = parseTCPDuration(key, values[0])
+		default:
+			return nil, fmt.Errorf("unsupported option %v", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dialer, nil
+}
+
+func parseTCPDuration(key string, text string) (time.Duration, error) {
+	value, err := time.ParseDuration(text)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %v option %q: it must be a non-negative duration", key, text)
+	}
+	return value, nil
+}
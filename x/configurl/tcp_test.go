@@ -0,0 +1,57 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTCPDialer(t *testing.T) {
+	dialer, err := parseTCPDialer(mustParseURL(t, "tcp:keepalive=15s&keepalive_interval=5s&keepalive_count=3&user_timeout=20s"))
+	require.NoError(t, err)
+	require.Equal(t, &transport.TCPDialer{
+		KeepAlive:   transport.TCPKeepAliveConfig{Idle: 15 * time.Second, Interval: 5 * time.Second, Count: 3},
+		UserTimeout: 20 * time.Second,
+	}, dialer)
+
+	dialer, err = parseTCPDialer(mustParseURL(t, "tcp:"))
+	require.NoError(t, err)
+	require.Equal(t, &transport.TCPDialer{}, dialer)
+
+	for _, config := range []string{
+		"tcp:keepalive=fast",
+		"tcp:keepalive=-1s",
+		"tcp:keepalive_count=-1",
+		"tcp:keepalive_count=3&keepalive_count=4",
+		"tcp:nodelay=true",
+	} {
+		_, err := parseTCPDialer(mustParseURL(t, config))
+		require.Error(t, err, config)
+	}
+}
+
+func TestTCP_MustBeFirst(t *testing.T) {
+	_, err := NewDefaultProviders().NewStreamDialer(context.Background(), "split:2|tcp:keepalive=15s")
+	require.ErrorContains(t, err, "first part")
+
+	dialer, err := NewDefaultProviders().NewStreamDialer(context.Background(), "tcp:keepalive=15s|split:2")
+	require.NoError(t, err)
+	require.NotNil(t, dialer)
+}
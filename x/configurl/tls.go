@@ -57,6 +57,15 @@ func parseOptions(configURL url.URL) ([]tls.ClientOption, error) {
 				return nil, fmt.Errorf("certName option must has one value, found %v", len(values))
 			}
 			options = append(options, tls.WithCertVerifier(&tls.StandardCertVerifier{CertificateName: values[0]}))
+		case "alpn":
+			if len(values) != 1 {
+				return nil, fmt.Errorf("alpn option must has one value, found %v", len(values))
+			}
+			protocols := []string{}
+			if values[0] != "" {
+				protocols = strings.Split(values[0], ",")
+			}
+			options = append(options, tls.WithALPN(protocols))
 		default:
 			return nil, fmt.Errorf("unsupported option %v", key)
 
@@ -88,3 +88,22 @@ func TestTLS_UnsupportedOption(t *testing.T) {
 	_, err = parseOptions(config.URL)
 	require.Error(t, err)
 }
+
+func TestTLS_ALPN(t *testing.T) {
+	config, err := ParseConfig("tls:alpn=h2,http/1.1")
+	require.NoError(t, err)
+	options, err := parseOptions(config.URL)
+	require.NoError(t, err)
+	cfg := tls.ClientConfig{ServerName: "host"}
+	for _, option := range options {
+		option("host", &cfg)
+	}
+	require.Equal(t, []string{"h2", "http/1.1"}, cfg.NextProtos)
+}
+
+func TestTLS_MultipleALPN(t *testing.T) {
+	config, err := ParseConfig("tls:alpn=h2&alpn=http/1.1")
+	require.NoError(t, err)
+	_, err = parseOptions(config.URL)
+	require.Error(t, err)
+}
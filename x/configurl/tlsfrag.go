@@ -17,7 +17,9 @@ package configurl
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 	"github.com/Jigsaw-Code/outline-sdk/transport/tlsfrag"
@@ -30,6 +32,13 @@ func registerTLSFragStreamDialer(r TypeRegistry[transport.StreamDialer], typeID
 			return nil, err
 		}
 		lenStr := config.URL.Opaque
+		if strings.Contains(lenStr, "=") {
+			maxFragLen, err := parseHandshakeFragOption(lenStr)
+			if err != nil {
+				return nil, err
+			}
+			return tlsfrag.NewHandshakeFragStreamDialer(sd, maxFragLen)
+		}
 		fixedLen, err := strconv.Atoi(lenStr)
 		if err != nil {
 			return nil, fmt.Errorf("invalid tlsfrag option: %v. It should be in tlsfrag:<number> format", lenStr)
@@ -37,3 +46,27 @@ func registerTLSFragStreamDialer(r TypeRegistry[transport.StreamDialer], typeID
 		return tlsfrag.NewFixedLenStreamDialer(sd, fixedLen)
 	})
 }
+
+// parseHandshakeFragOption parses the "handshake=[MAX_LENGTH]" option of tlsfrag.
+func parseHandshakeFragOption(opaque string) (int, error) {
+	values, err := url.ParseQuery(opaque)
+	if err != nil {
+		return 0, err
+	}
+	var maxFragLen int
+	for key, values := range values {
+		if len(values) != 1 {
+			return 0, fmt.Errorf("%v option must has one value, found %v", key, len(values))
+		}
+		switch strings.ToLower(key) {
+		case "handshake":
+			maxFragLen, err = strconv.Atoi(values[0])
+			if err != nil || maxFragLen <= 0 {
+				return 0, fmt.Errorf("invalid handshake option %q: it must be a positive number", values[0])
+			}
+		default:
+			return 0, fmt.Errorf("unsupported option %v", key)
+		}
+	}
+	return maxFragLen, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSFrag_Handshake(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	dialer, err := NewDefaultProviders().NewStreamDialer(context.Background(), "tlsfrag:handshake=4")
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	handshake := append([]byte{0x16, 3, 1, 0, 10}, "0123456789"...)
+	appData := append([]byte{0x17, 3, 3, 0, 2}, "xy"...)
+	_, err = conn.Write(append(handshake, appData...))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+
+	var expected []byte
+	expected = append(expected, 0x16, 3, 1, 0, 4, '0', '1', '2', '3')
+	expected = append(expected, 0x16, 3, 1, 0, 4, '4', '5', '6', '7')
+	expected = append(expected, 0x16, 3, 1, 0, 2, '8', '9')
+	expected = append(expected, appData...)
+	require.Equal(t, expected, <-received)
+	conn.Close()
+}
+
+func TestTLSFrag_InvalidOptions(t *testing.T) {
+	providers := NewDefaultProviders()
+	for _, config := range []string{
+		"tlsfrag:abc",
+		"tlsfrag:handshake=0",
+		"tlsfrag:handshake=abc",
+		"tlsfrag:handshake=1&handshake=2",
+		"tlsfrag:other=1",
+	} {
+		_, err := providers.NewStreamDialer(context.Background(), config)
+		require.Error(t, err, config)
+	}
+}
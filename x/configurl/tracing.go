@@ -0,0 +1,82 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/tracing"
+)
+
+// withTracing returns the dialer wrapped to run its dials in spans named after the config type, if ctx has a tracer.
+// An empty config type means the base dialer, which is traced with its network name. Other objects are returned as is.
+func withTracing[ObjectType any](ctx context.Context, object ObjectType, configType string) ObjectType {
+	tracer := tracing.TracerFromContext(ctx)
+	if tracer == nil || any(object) == nil {
+		return object
+	}
+	var traced any
+	var err error
+	switch o := any(&object).(type) {
+	case *transport.StreamDialer:
+		if tcpDialer, ok := (*o).(*transport.TCPDialer); ok && configType == "" {
+			traced, err = tracing.NewTCPDialer(tracer, tcpDialer)
+		} else {
+			traced, err = tracing.NewStreamDialer(tracer, spanName(configType, "tcp"), *o)
+		}
+	case *transport.PacketDialer:
+		if udpDialer, ok := (*o).(*transport.UDPDialer); ok && configType == "" {
+			traced, err = tracing.NewUDPDialer(tracer, udpDialer)
+		} else {
+			traced, err = tracing.NewPacketDialer(tracer, spanName(configType, "udp"), *o)
+		}
+	default:
+		return object
+	}
+	if err != nil {
+		return object
+	}
+	return traced.(ObjectType)
+}
+
+func spanName(configType string, baseName string) string {
+	if configType == "" {
+		return baseName
+	}
+	return configType
+}
+
+// withRootSpan wraps the dialer of a whole config so that each dial has a root span, if ctx has a tracer.
+func withRootSpan[ObjectType any](ctx context.Context, object ObjectType, config *Config) ObjectType {
+	tracer := tracing.TracerFromContext(ctx)
+	if tracer == nil {
+		return object
+	}
+	var traced any
+	var err error
+	switch o := any(&object).(type) {
+	case *transport.StreamDialer:
+		traced, err = tracing.NewStreamDialer(tracer, "DialStream", *o)
+	case *transport.PacketDialer:
+		traced, err = tracing.NewPacketDialer(tracer, "DialPacket", *o)
+	default:
+		return object
+	}
+	if err != nil {
+		return object
+	}
+	return withDescription(traced.(ObjectType), config)
+}
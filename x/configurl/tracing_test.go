@@ -0,0 +1,80 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/x/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+type parentSpanKey struct{}
+
+// treeTracer records each span as "name<parent".
+type treeTracer struct {
+	mu   sync.Mutex
+	tree []string
+}
+
+func (t *treeTracer) Start(ctx context.Context, name string, attributes ...tracing.Attribute) (context.Context, tracing.Span) {
+	parent, _ := ctx.Value(parentSpanKey{}).(string)
+	t.mu.Lock()
+	t.tree = append(t.tree, name+"<"+parent)
+	t.mu.Unlock()
+	return context.WithValue(ctx, parentSpanKey{}, name), nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) RecordError(error) {}
+func (nopSpan) End()              {}
+
+func TestTracing_StreamDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	tracer := &treeTracer{}
+	ctx := tracing.WithTracer(context.Background(), tracer)
+	config := "override:host=127.0.0.1&port=" + port + "|split:2"
+	dialer, err := NewDefaultProviders().NewStreamDialer(ctx, config)
+	require.NoError(t, err)
+	require.Equal(t, "override:host=127.0.0.1&port="+port+"|split:2", Describe(dialer).String())
+	require.Empty(t, tracer.tree)
+
+	conn, err := dialer.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, []string{"DialStream<", "split<DialStream", "override<split", "tcp<override", "connect<tcp"}, tracer.tree)
+}
+
+func TestTracing_Disabled(t *testing.T) {
+	dialer, err := NewDefaultProviders().NewPacketDialer(context.Background(), "")
+	require.NoError(t, err)
+	// Without a tracer, the base dialer is returned as is.
+	require.Equal(t, NewDefaultProviders().PacketDialers.BaseInstance, dialer)
+}
@@ -0,0 +1,60 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// parseUnixSocketPath returns the socket path of a unix config, which can be absolute, as in "unix:///run/x.sock"
+// or "unix:/run/x.sock", or relative, as in "unix:x.sock".
+func parseUnixSocketPath(configURL url.URL) (string, error) {
+	path := configURL.Path
+	if configURL.Opaque != "" {
+		path = configURL.Opaque
+	}
+	if path == "" {
+		return "", errors.New("must specify the socket path")
+	}
+	if configURL.Host != "" {
+		return "", errors.New("unix sockets don't support a host. Use unix:///path for absolute paths")
+	}
+	return path, nil
+}
+
+func registerUnixStreamDialer(r TypeRegistry[transport.StreamDialer], typeID string) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.StreamDialer, error) {
+		if config.BaseConfig != nil {
+			return nil, errors.New("unix must be the first part of the config")
+		}
+		path, err := parseUnixSocketPath(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		return transport.FuncStreamDialer(func(ctx context.Context, _ string) (transport.StreamConn, error) {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "unix", path)
+			if err != nil {
+				return nil, err
+			}
+			return conn.(*net.UnixConn), nil
+		}), nil
+	})
+}
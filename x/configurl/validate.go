@@ -0,0 +1,185 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ValidationError is an error in one of the parts of a config, as found by [ProviderContainer.Validate].
+type ValidationError struct {
+	// Index is the position of the part in the config, starting at 0 for the base part.
+	Index int
+	// Offset is the position of the part in the config text, in bytes.
+	Offset int
+	// Length is the length of the part in the config text, in bytes, so UIs can highlight it.
+	Length int
+	// Err is the error of the part.
+	Err error
+}
+
+var _ error = (*ValidationError)(nil)
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("config part %d at offset %d: %v", e.Index+1, e.Offset, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors are the errors found by [ProviderContainer.Validate], in the order of the parts.
+type ValidationErrors []*ValidationError
+
+var _ error = (ValidationErrors)(nil)
+
+func (e ValidationErrors) Error() string {
+	texts := make([]string, len(e))
+	for i, err := range e {
+		texts[i] = err.Error()
+	}
+	return strings.Join(texts, "; ")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Validate checks the config text with the default providers. See [ProviderContainer.Validate].
+func Validate(configText string) error {
+	return NewDefaultProviders().Validate(context.Background(), configText)
+}
+
+// partValidator checks config parts against one of the providers of a [ProviderContainer].
+type partValidator struct {
+	registered func(subtype string) bool
+	build      func(ctx context.Context, config *Config) error
+}
+
+func newPartValidator[ObjectType comparable](p *ExtensibleProvider[ObjectType]) partValidator {
+	return partValidator{
+		registered: func(subtype string) bool {
+			_, ok := p.ensureBuildersMap()[subtype]
+			return ok
+		},
+		build: func(ctx context.Context, config *Config) error {
+			_, err := p.NewInstance(ctx, config)
+			return err
+		},
+	}
+}
+
+// Validate parses the config text and builds the objects of each part, without dialing or listening, so apps can
+// check configs before saving them. It checks that the part types are registered, that their options are valid, and
+// that each part can be used on top of the previous ones. A part only needs to work as one of the stream dialers,
+// packet dialers or packet listeners, unless the last part has a "listen" parameter, in which case the config is
+// checked as a stream listener, like in [ProviderContainer.NewStreamListener].
+//
+// It returns nil if the config is valid, or [ValidationErrors] with the errors of all the parts otherwise. Parts after
+// an invalid one are checked on their own.
+func (p *ProviderContainer) Validate(ctx context.Context, configText string) error {
+	if strings.TrimSpace(configText) == "" {
+		return nil
+	}
+	var errs ValidationErrors
+	texts := strings.Split(configText, "|")
+	urls := make([]*url.URL, len(texts))
+	offsets := make([]int, len(texts))
+	offset := 0
+	for i, text := range texts {
+		trimmed := strings.TrimSpace(text)
+		offsets[i] = offset + strings.Index(text, trimmed)
+		offset += len(text) + 1
+		u, err := parseConfigPart(text)
+		if err != nil {
+			errs = append(errs, &ValidationError{Index: i, Offset: offsets[i], Length: len(trimmed), Err: err})
+			continue
+		}
+		urls[i] = u
+	}
+
+	validators := []partValidator{
+		newPartValidator(&p.StreamDialers),
+		newPartValidator(&p.PacketDialers),
+		newPartValidator(&p.PacketListeners),
+	}
+	if last := len(urls) - 1; urls[last] != nil {
+		_, config, err := cutListenAddress(&Config{URL: *urls[last]})
+		switch {
+		case err == nil:
+			urls[last] = &config.URL
+			validators = []partValidator{newPartValidator(&p.StreamListeners)}
+		case !errors.Is(err, errMissingListen):
+			errs = append(errs, &ValidationError{Index: last, Offset: offsets[last], Length: len(strings.TrimSpace(texts[last])), Err: err})
+			urls[last] = nil
+		}
+	}
+
+	var base *Config
+	chainValid := true
+	for i, u := range urls {
+		if u == nil {
+			chainValid = false
+			continue
+		}
+		config := &Config{URL: *u, BaseConfig: base}
+		base = config
+		if !chainValid {
+			// The previous parts are invalid, so check this one on its own.
+			config = &Config{URL: *u}
+		}
+		if err := buildPart(ctx, validators, config); err != nil {
+			errs = append(errs, &ValidationError{Index: i, Offset: offsets[i], Length: len(strings.TrimSpace(texts[i])), Err: err})
+			chainValid = false
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	// Parse errors come first, so sort by part.
+	slices.SortStableFunc(errs, func(a, b *ValidationError) int { return a.Index - b.Index })
+	return errs
+}
+
+// buildPart builds the config with the validators that support its type, and returns nil if any of them succeeds,
+// or the error of the first one otherwise.
+func buildPart(ctx context.Context, validators []partValidator, config *Config) error {
+	var firstErr error
+	for _, v := range validators {
+		if !v.registered(config.URL.Scheme) {
+			continue
+		}
+		err := v.build(ctx, config)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		return fmt.Errorf("config type '%v' is not registered", config.URL.Scheme)
+	}
+	return firstErr
+}
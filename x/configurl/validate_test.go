@@ -0,0 +1,93 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate_Valid(t *testing.T) {
+	for _, config := range []string{
+		"",
+		"  ",
+		"split:2|tlsfrag:1",
+		"tls:sni=decoy.example.com|override:ip=192.0.2.1&sni=other.example.com",
+		"quicfrag:20|porthop:ports=5000-5010",
+		"ss://chacha20-ietf-poly1305:secret@server.example:1",
+		"socks5://server.example:1080",
+	} {
+		require.NoError(t, Validate(config), config)
+	}
+}
+
+func TestValidate_Listener(t *testing.T) {
+	certFile, keyFile, _ := writeTestCertificate(t)
+	require.NoError(t, Validate("tls:certFile="+certFile+"&keyFile="+keyFile+"|ws:tcp_path=/tcp|ss://chacha20-ietf-poly1305:secret@server.example:1?listen=:443"))
+
+	// Dialer-only types are not valid in listener configs.
+	var errs ValidationErrors
+	require.ErrorAs(t, Validate("split:2|ss://chacha20-ietf-poly1305:secret@server.example:1?listen=:443"), &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, 0, errs[0].Index)
+
+	require.ErrorAs(t, Validate("ws:tcp_path=/tcp&listen="), &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, 0, errs[0].Index)
+}
+
+func TestValidate_Errors(t *testing.T) {
+	config := "split:x | unknown:1|tls|quicfrag:20||ss://invalid@server.example:1"
+	var errs ValidationErrors
+	require.ErrorAs(t, Validate(config), &errs)
+
+	type position struct{ index, offset, length int }
+	var positions []position
+	for _, err := range errs {
+		positions = append(positions, position{err.Index, err.Offset, err.Length})
+		require.Equal(t, config[err.Offset:err.Offset+err.Length], []string{"split:x", "unknown:1", "tls", "quicfrag:20", "", "ss://invalid@server.example:1"}[err.Index])
+	}
+	require.Equal(t, []position{
+		{0, 0, 7},
+		{1, 10, 9},
+		// quicfrag works on its own, since the chain is already broken.
+		{4, 36, 0},
+		{5, 37, 29},
+	}, positions)
+	require.ErrorContains(t, errs[1], "config type 'unknown' is not registered")
+	require.ErrorContains(t, errs[2], "empty config part")
+}
+
+func TestValidate_IncompatibleChain(t *testing.T) {
+	var errs ValidationErrors
+	require.ErrorAs(t, Validate("tls|quicfrag:20"), &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, 1, errs[0].Index)
+	require.Equal(t, 4, errs[0].Offset)
+
+	var partErr *ValidationError
+	require.True(t, errors.As(Validate("tls|quicfrag:20"), &partErr))
+	require.Equal(t, 1, partErr.Index)
+}
+
+func TestProviderContainer_ValidateCustomType(t *testing.T) {
+	p := NewProviderContainer()
+	require.Error(t, p.Validate(context.Background(), "custom"))
+	registerSplitStreamDialer(&p.StreamDialers, "custom", p.StreamDialers.NewInstance)
+	require.NoError(t, p.Validate(context.Background(), "custom:2"))
+}
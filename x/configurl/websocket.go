@@ -29,6 +29,7 @@ import (
 type wsConfig struct {
 	tcpPath string
 	udpPath string
+	host    string
 }
 
 func parseWSConfig(configURL url.URL) (*wsConfig, error) {
@@ -50,6 +51,11 @@ func parseWSConfig(configURL url.URL) (*wsConfig, error) {
 				return nil, fmt.Errorf("tcp_path option must has one value, found %v", len(values))
 			}
 			cfg.udpPath = values[0]
+		case "host":
+			if len(values) != 1 {
+				return nil, fmt.Errorf("host option must has one value, found %v", len(values))
+			}
+			cfg.host = values[0]
 		default:
 			return nil, fmt.Errorf("unsupported option %v", key)
 		}
@@ -57,6 +63,14 @@ func parseWSConfig(configURL url.URL) (*wsConfig, error) {
 	return &cfg, nil
 }
 
+func (c *wsConfig) options() []websocket.Option {
+	var opts []websocket.Option
+	if c.host != "" {
+		opts = append(opts, websocket.WithHost(c.host))
+	}
+	return opts
+}
+
 func registerWebsocketStreamDialer(r TypeRegistry[transport.StreamDialer], typeID string, newSD BuildFunc[transport.StreamDialer]) {
 	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.StreamDialer, error) {
 		sd, err := newSD(ctx, config.BaseConfig)
@@ -72,7 +86,7 @@ func registerWebsocketStreamDialer(r TypeRegistry[transport.StreamDialer], typeI
 		}
 		return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
 			wsURL := url.URL{Scheme: "ws", Host: addr, Path: wsConfig.tcpPath}
-			connect, err := websocket.NewStreamEndpoint(wsURL.String(), &transport.StreamDialerEndpoint{Address: addr, Dialer: sd})
+			connect, err := websocket.NewStreamEndpoint(wsURL.String(), &transport.StreamDialerEndpoint{Address: addr, Dialer: sd}, wsConfig.options()...)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create websocket stream endpoint: %w", err)
 			}
@@ -96,7 +110,7 @@ func registerWebsocketPacketDialer(r TypeRegistry[transport.PacketDialer], typeI
 		}
 		return transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
 			wsURL := url.URL{Scheme: "ws", Host: addr, Path: wsConfig.udpPath}
-			connect, err := websocket.NewPacketEndpoint(wsURL.String(), &transport.StreamDialerEndpoint{Address: addr, Dialer: sd})
+			connect, err := websocket.NewPacketEndpoint(wsURL.String(), &transport.StreamDialerEndpoint{Address: addr, Dialer: sd}, wsConfig.options()...)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create websocket stream endpoint: %w", err)
 			}
@@ -0,0 +1,38 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWS_Host(t *testing.T) {
+	config, err := ParseConfig("ws:tcp_path=/tcp&host=real.example.com")
+	require.NoError(t, err)
+	cfg, err := parseWSConfig(config.URL)
+	require.NoError(t, err)
+	require.Equal(t, "/tcp", cfg.tcpPath)
+	require.Equal(t, "real.example.com", cfg.host)
+	require.Len(t, cfg.options(), 1)
+}
+
+func TestWS_MultipleHost(t *testing.T) {
+	config, err := ParseConfig("ws:tcp_path=/tcp&host=a.example.com&host=b.example.com")
+	require.NoError(t, err)
+	_, err = parseWSConfig(config.URL)
+	require.Error(t, err)
+}
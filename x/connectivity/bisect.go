@@ -0,0 +1,273 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	sdktls "github.com/Jigsaw-Code/outline-sdk/transport/tls"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// InterferenceCause is the likely reason a target fails to load, as found by [Bisector].
+type InterferenceCause string
+
+const (
+	// CauseNone means the target works over the direct path.
+	CauseNone InterferenceCause = "none"
+	// CauseTarget means the target also fails over the proxy, so it's likely down rather than blocked.
+	CauseTarget InterferenceCause = "target"
+	// CauseDNS means the direct resolution fails or returns bad addresses, but the target works with the trusted addresses.
+	CauseDNS InterferenceCause = "dns"
+	// CauseIP means TCP connections to the target addresses fail over the direct path.
+	CauseIP InterferenceCause = "ip"
+	// CauseSNI means TLS with the target name fails, but TLS without it succeeds on the same address.
+	CauseSNI InterferenceCause = "sni"
+	// CauseProtocol means TCP connects, but TLS fails regardless of the name.
+	CauseProtocol InterferenceCause = "protocol"
+	// CauseUnknown means the probes were not enough to find a cause, for instance because no address could be resolved.
+	CauseUnknown InterferenceCause = "unknown"
+)
+
+// ProbeResult is the outcome of one of the probes run by [Bisector].
+type ProbeResult struct {
+	// Name identifies the probe, such as "direct-dns" or "direct-tls-control".
+	Name string
+	// Address is the host:port the probe connected to, or the domain that was resolved.
+	Address string
+	// SNI is the server name sent in TLS probes. It's empty for other probes, or if no name was sent.
+	SNI string
+	// Error is nil if the probe succeeded.
+	Error *ConnectivityError
+	// Duration is how long the probe took.
+	Duration time.Duration
+}
+
+// Diagnosis is the structured result of [Bisector.Bisect].
+type Diagnosis struct {
+	// Domain is the target domain.
+	Domain string
+	// Cause is the likely cause of the failure.
+	Cause InterferenceCause
+	// DirectIPs are the addresses returned by the direct resolver.
+	DirectIPs []netip.Addr
+	// TrustedIPs are the addresses returned by the trusted resolver.
+	TrustedIPs []netip.Addr
+	// Probes lists the probes that were run, in order.
+	Probes []ProbeResult
+}
+
+// errNoAddresses is the error of resolution probes that return no addresses.
+var errNoAddresses = errors.New("no addresses found")
+
+// Bisector finds the cause of a failure to reach a target, by running a decision tree of probes through
+// the direct path and a trusted path, like a proxy:
+//
+//  1. Resolve the domain with the direct and trusted resolvers.
+//  2. Connect with TLS over the proxy. If it fails, the target is down ([CauseTarget]).
+//  3. Connect with TLS directly to a directly resolved address. If it works, there's no interference ([CauseNone]).
+//  4. If the trusted addresses are different, connect with TLS directly to one. If it works, DNS is the cause ([CauseDNS]).
+//  5. Connect with TCP directly. If it fails, the address is blocked ([CauseIP]).
+//  6. Connect with TLS directly to the same address without the target name. If it works, the name is blocked ([CauseSNI]),
+//     otherwise TLS itself is blocked ([CauseProtocol]).
+type Bisector struct {
+	// DirectDialer is the dialer for the direct path. If nil, a [transport.TCPDialer] is used.
+	DirectDialer transport.StreamDialer
+	// ProxyDialer is the dialer for the trusted path. If nil, the probes over the trusted path are skipped,
+	// and the target is assumed to be up.
+	ProxyDialer transport.StreamDialer
+	// DirectResolver is the resolver for the direct path, usually the network's resolver. It must not be nil.
+	DirectResolver dns.Resolver
+	// TrustedResolver is a resolver expected to return correct answers, for instance an encrypted resolver over
+	// the proxy. If nil, only the direct addresses are tested.
+	TrustedResolver dns.Resolver
+	// Port is the target port. If empty, "443" is used.
+	Port string
+	// RootCAs are used to verify the target certificates. If nil, the system roots are used.
+	RootCAs *x509.CertPool
+	// ProbeTimeout limits each probe. If zero, 5 seconds is used.
+	ProbeTimeout time.Duration
+}
+
+// Bisect runs the probes for the target domain, and returns the diagnosis.
+// It returns an error only if the bisection can't run, for instance if the domain is invalid.
+func (b *Bisector) Bisect(ctx context.Context, domain string) (*Diagnosis, error) {
+	if b.DirectResolver == nil {
+		return nil, errors.New("direct resolver must not be nil")
+	}
+	q, err := dns.NewQuestion(domain, dnsmessage.TypeA)
+	if err != nil {
+		return nil, fmt.Errorf("question creation failed: %w", err)
+	}
+	port := b.Port
+	if port == "" {
+		port = "443"
+	}
+	directDialer := b.DirectDialer
+	if directDialer == nil {
+		directDialer = &transport.TCPDialer{}
+	}
+	diagnosis := &Diagnosis{Domain: domain}
+
+	diagnosis.DirectIPs = b.resolve(ctx, diagnosis, "direct-dns", b.DirectResolver, q)
+	if b.TrustedResolver != nil {
+		diagnosis.TrustedIPs = b.resolve(ctx, diagnosis, "trusted-dns", b.TrustedResolver, q)
+	}
+
+	if b.ProxyDialer != nil {
+		address := net.JoinHostPort(domain, port)
+		if err := b.probe(ctx, diagnosis, "proxy-tls", address, domain, func(ctx context.Context) error {
+			return b.tlsHandshake(ctx, b.ProxyDialer, address, domain, true)
+		}); err != nil {
+			diagnosis.Cause = CauseTarget
+			return diagnosis, nil
+		}
+	}
+
+	if len(diagnosis.DirectIPs) > 0 {
+		address := net.JoinHostPort(diagnosis.DirectIPs[0].String(), port)
+		if err := b.probe(ctx, diagnosis, "direct-tls", address, domain, func(ctx context.Context) error {
+			return b.tlsHandshake(ctx, directDialer, address, domain, true)
+		}); err == nil {
+			diagnosis.Cause = CauseNone
+			return diagnosis, nil
+		}
+	}
+
+	// Pick the address to bisect on, preferring one from the trusted resolver.
+	var targetIP netip.Addr
+	switch {
+	case len(diagnosis.TrustedIPs) > 0:
+		targetIP = diagnosis.TrustedIPs[0]
+	case len(diagnosis.DirectIPs) > 0:
+		targetIP = diagnosis.DirectIPs[0]
+	default:
+		diagnosis.Cause = CauseUnknown
+		return diagnosis, nil
+	}
+	address := net.JoinHostPort(targetIP.String(), port)
+
+	if !slices.Contains(diagnosis.DirectIPs, targetIP) {
+		if err := b.probe(ctx, diagnosis, "direct-tls-trusted-ip", address, domain, func(ctx context.Context) error {
+			return b.tlsHandshake(ctx, directDialer, address, domain, true)
+		}); err == nil {
+			diagnosis.Cause = CauseDNS
+			return diagnosis, nil
+		}
+	}
+
+	if err := b.probe(ctx, diagnosis, "direct-tcp", address, "", func(ctx context.Context) error {
+		conn, err := directDialer.DialStream(ctx, address)
+		if err != nil {
+			return makeConnectivityError("connect", err)
+		}
+		return conn.Close()
+	}); err != nil {
+		diagnosis.Cause = CauseIP
+		return diagnosis, nil
+	}
+
+	// Control handshake without the target name. An IP address as the server name omits the SNI extension.
+	if err := b.probe(ctx, diagnosis, "direct-tls-control", address, "", func(ctx context.Context) error {
+		return b.tlsHandshake(ctx, directDialer, address, targetIP.String(), false)
+	}); err != nil {
+		diagnosis.Cause = CauseProtocol
+		return diagnosis, nil
+	}
+	diagnosis.Cause = CauseSNI
+	return diagnosis, nil
+}
+
+// probe runs the probe function with the probe timeout, and records the result in the diagnosis.
+func (b *Bisector) probe(ctx context.Context, diagnosis *Diagnosis, name string, address string, sni string, probeFunc func(ctx context.Context) error) *ConnectivityError {
+	timeout := b.ProbeTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := probeFunc(ctx)
+	result := ProbeResult{Name: name, Address: address, SNI: sni, Duration: time.Since(start)}
+	if err != nil {
+		if !errors.As(err, &result.Error) {
+			result.Error = makeConnectivityError("connect", err)
+		}
+	}
+	diagnosis.Probes = append(diagnosis.Probes, result)
+	return result.Error
+}
+
+func (b *Bisector) resolve(ctx context.Context, diagnosis *Diagnosis, name string, resolver dns.Resolver, q *dnsmessage.Question) []netip.Addr {
+	var ips []netip.Addr
+	b.probe(ctx, diagnosis, name, q.Name.String(), "", func(ctx context.Context) error {
+		response, err := resolver.Query(ctx, *q)
+		if err != nil {
+			return makeConnectivityError("resolve", err)
+		}
+		for _, answer := range response.Answers {
+			if a, ok := answer.Body.(*dnsmessage.AResource); ok {
+				ips = append(ips, netip.AddrFrom4(a.A))
+			}
+		}
+		if len(ips) == 0 {
+			return makeConnectivityError("resolve", errNoAddresses)
+		}
+		return nil
+	})
+	return ips
+}
+
+// acceptAnyCert is used in the control handshake, which only needs to reach the server.
+type acceptAnyCert struct{}
+
+func (acceptAnyCert) VerifyCertificate(*sdktls.CertVerificationContext) error {
+	return nil
+}
+
+// tlsHandshake connects to the address and completes a TLS handshake with the server name. If verify is false, any
+// certificate is accepted, and a TLS alert from the server also counts as success, since it means the server was reached.
+func (b *Bisector) tlsHandshake(ctx context.Context, dialer transport.StreamDialer, address string, serverName string, verify bool) error {
+	conn, err := dialer.DialStream(ctx, address)
+	if err != nil {
+		return makeConnectivityError("connect", err)
+	}
+	defer conn.Close()
+	options := []sdktls.ClientOption{}
+	if verify {
+		options = append(options, sdktls.WithCertVerifier(&sdktls.StandardCertVerifier{CertificateName: serverName, Roots: b.RootCAs}))
+	} else {
+		options = append(options, sdktls.WithCertVerifier(acceptAnyCert{}))
+	}
+	tlsConn, err := sdktls.WrapConn(ctx, conn, serverName, options...)
+	if err != nil {
+		// Alerts from the server are reported as "remote error".
+		var opErr *net.OpError
+		if !verify && errors.As(err, &opErr) && opErr.Op == "remote error" {
+			return nil
+		}
+		return makeConnectivityError("tls", err)
+	}
+	return tlsConn.Close()
+}
@@ -0,0 +1,221 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	goodIP  = netip.MustParseAddr("192.0.2.1")
+	bogusIP = netip.MustParseAddr("192.0.2.66")
+)
+
+func newTestResolver(ips ...netip.Addr) dns.Resolver {
+	return dns.FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		if len(ips) == 0 {
+			return nil, &net.DNSError{Err: "no such host", IsNotFound: true}
+		}
+		msg := &dnsmessage.Message{Questions: []dnsmessage.Question{q}}
+		for _, ip := range ips {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.AResource{A: ip.As4()},
+			})
+		}
+		return msg, nil
+	})
+}
+
+// blockingConn resets the connection on writes that the block function matches.
+type blockingConn struct {
+	transport.StreamConn
+	block func(data []byte) bool
+}
+
+func (c *blockingConn) Write(data []byte) (int, error) {
+	if c.block != nil && c.block(data) {
+		c.StreamConn.Close()
+		return 0, &net.OpError{Op: "write", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+	return c.StreamConn.Write(data)
+}
+
+// newTestDialer returns a dialer that connects every address to the server, except for the blocked IPs,
+// and resets connections on blocked writes.
+func newTestDialer(serverAddr string, blockedIPs []netip.Addr, blockWrite func([]byte) bool) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip, err := netip.ParseAddr(host); err == nil && (ip == bogusIP || slices.Contains(blockedIPs, ip)) {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		}
+		conn, err := (&transport.TCPDialer{}).DialStream(ctx, serverAddr)
+		if err != nil {
+			return nil, err
+		}
+		return &blockingConn{StreamConn: conn, block: blockWrite}, nil
+	})
+}
+
+func TestBisector(t *testing.T) {
+	// The test server certificate is valid for example.com.
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	serverAddr := server.Listener.Addr().String()
+	roots := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	isTLS := func(data []byte) bool { return len(data) > 0 && data[0] == 0x16 }
+	hasSNI := func(data []byte) bool { return bytes.Contains(data, []byte("example.com")) }
+
+	for _, tc := range []struct {
+		name            string
+		directResolver  dns.Resolver
+		trustedResolver dns.Resolver
+		directDialer    transport.StreamDialer
+		proxyDialer     transport.StreamDialer
+		cause           InterferenceCause
+		lastProbe       string
+	}{
+		{
+			name:           "none",
+			directResolver: newTestResolver(goodIP),
+			directDialer:   newTestDialer(serverAddr, nil, nil),
+			proxyDialer:    newTestDialer(serverAddr, nil, nil),
+			cause:          CauseNone,
+			lastProbe:      "direct-tls",
+		},
+		{
+			name:           "target down",
+			directResolver: newTestResolver(goodIP),
+			directDialer:   newTestDialer(serverAddr, nil, nil),
+			proxyDialer: transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+				return nil, errors.New("proxy failed to connect")
+			}),
+			cause:     CauseTarget,
+			lastProbe: "proxy-tls",
+		},
+		{
+			name:            "dns bogus answer",
+			directResolver:  newTestResolver(bogusIP),
+			trustedResolver: newTestResolver(goodIP),
+			directDialer:    newTestDialer(serverAddr, nil, nil),
+			cause:           CauseDNS,
+			lastProbe:       "direct-tls-trusted-ip",
+		},
+		{
+			name:            "dns failure",
+			directResolver:  newTestResolver(),
+			trustedResolver: newTestResolver(goodIP),
+			directDialer:    newTestDialer(serverAddr, nil, nil),
+			cause:           CauseDNS,
+			lastProbe:       "direct-tls-trusted-ip",
+		},
+		{
+			name:            "ip",
+			directResolver:  newTestResolver(goodIP),
+			trustedResolver: newTestResolver(goodIP),
+			directDialer:    newTestDialer(serverAddr, []netip.Addr{goodIP}, nil),
+			cause:           CauseIP,
+			lastProbe:       "direct-tcp",
+		},
+		{
+			name:           "sni",
+			directResolver: newTestResolver(goodIP),
+			directDialer:   newTestDialer(serverAddr, nil, hasSNI),
+			proxyDialer:    newTestDialer(serverAddr, nil, nil),
+			cause:          CauseSNI,
+			lastProbe:      "direct-tls-control",
+		},
+		{
+			name:           "protocol",
+			directResolver: newTestResolver(goodIP),
+			directDialer:   newTestDialer(serverAddr, nil, isTLS),
+			cause:          CauseProtocol,
+			lastProbe:      "direct-tls-control",
+		},
+		{
+			name:            "unknown",
+			directResolver:  newTestResolver(),
+			trustedResolver: newTestResolver(),
+			directDialer:    newTestDialer(serverAddr, nil, nil),
+			cause:           CauseUnknown,
+			lastProbe:       "trusted-dns",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bisector := &Bisector{
+				DirectDialer:    tc.directDialer,
+				ProxyDialer:     tc.proxyDialer,
+				DirectResolver:  tc.directResolver,
+				TrustedResolver: tc.trustedResolver,
+				RootCAs:         roots,
+			}
+			diagnosis, err := bisector.Bisect(context.Background(), "example.com")
+			require.NoError(t, err)
+			require.Equal(t, tc.cause, diagnosis.Cause)
+			require.Equal(t, tc.lastProbe, diagnosis.Probes[len(diagnosis.Probes)-1].Name)
+		})
+	}
+}
+
+func TestBisector_Probes(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	bisector := &Bisector{
+		DirectDialer:    newTestDialer(server.Listener.Addr().String(), nil, func(data []byte) bool { return bytes.Contains(data, []byte("example.com")) }),
+		DirectResolver:  newTestResolver(bogusIP),
+		TrustedResolver: newTestResolver(goodIP),
+	}
+	diagnosis, err := bisector.Bisect(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, CauseSNI, diagnosis.Cause)
+	require.Equal(t, []netip.Addr{bogusIP}, diagnosis.DirectIPs)
+	require.Equal(t, []netip.Addr{goodIP}, diagnosis.TrustedIPs)
+
+	var names []string
+	for _, probe := range diagnosis.Probes {
+		names = append(names, probe.Name)
+	}
+	require.Equal(t, []string{"direct-dns", "trusted-dns", "direct-tls", "direct-tls-trusted-ip", "direct-tcp", "direct-tls-control"}, names)
+	require.Equal(t, "example.com.", diagnosis.Probes[0].Address)
+	require.Nil(t, diagnosis.Probes[0].Error)
+	require.Equal(t, "192.0.2.66:443", diagnosis.Probes[2].Address)
+	require.Equal(t, "connect", diagnosis.Probes[2].Error.Op)
+	require.Equal(t, "ECONNREFUSED", diagnosis.Probes[2].Error.PosixError)
+	require.Equal(t, "example.com", diagnosis.Probes[3].SNI)
+	require.Equal(t, "tls", diagnosis.Probes[3].Error.Op)
+	require.Empty(t, diagnosis.Probes[5].SNI)
+	require.Nil(t, diagnosis.Probes[5].Error)
+
+	_, err = (&Bisector{}).Bisect(context.Background(), "example.com")
+	require.Error(t, err)
+}
@@ -0,0 +1,188 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// InjectionIndicator is a property of an HTTP response that is common in the block pages injected by networks,
+// and rare in the responses of real servers.
+type InjectionIndicator string
+
+const (
+	// IndicatorLegalStatus means the response has the 451 Unavailable For Legal Reasons status.
+	IndicatorLegalStatus InjectionIndicator = "legal-status"
+	// IndicatorReservedRedirect means the response redirects to a private or reserved IP address, where networks
+	// usually host their block pages.
+	IndicatorReservedRedirect InjectionIndicator = "reserved-redirect"
+	// IndicatorReservedFrame means the body loads a frame from, or refreshes to, a private or reserved IP address.
+	IndicatorReservedFrame InjectionIndicator = "reserved-frame"
+	// IndicatorMissingDate means the response has no Date header, which real servers are required to send.
+	IndicatorMissingDate InjectionIndicator = "missing-date"
+	// IndicatorRegionalCharset means the response declares a legacy regional charset, like windows-1256, that
+	// block pages often use and modern sites rarely do.
+	IndicatorRegionalCharset InjectionIndicator = "regional-charset"
+)
+
+// strongIndicators are the indicators that are enough on their own to consider a response injected.
+var strongIndicators = []InjectionIndicator{IndicatorLegalStatus, IndicatorReservedRedirect, IndicatorReservedFrame}
+
+// regionalCharsets are the legacy charsets seen in block pages. They are compared in lower case.
+var regionalCharsets = []string{
+	"big5", "euc-kr", "gb2312", "gbk", "iso-8859-6", "koi8-r", "ks_c_5601-1987", "tis-620",
+	"windows-1251", "windows-1254", "windows-1256", "windows-874",
+}
+
+var (
+	// charsetPattern matches the charset parameter in a Content-Type header or a meta tag.
+	charsetPattern = regexp.MustCompile(`(?i)charset\s*=\s*["']?([a-z0-9_.:-]+)`)
+	// frameTargetPattern matches the host of the URLs loaded by frames and refreshes, when it's an IP address.
+	frameTargetPattern = regexp.MustCompile(`(?i)(?:src|url)\s*=\s*["']?https?://\[?([0-9a-f.:]+)`)
+)
+
+// HTTPInspection is the result of [InspectHTTPResponse].
+type HTTPInspection struct {
+	// BlockPage is the name of the matched block page signature, or empty if none matched.
+	BlockPage string
+	// Indicators are the injection indicators found in the response.
+	Indicators []InjectionIndicator
+}
+
+// LikelyInjected returns whether the response was likely injected by the network: it matched a block page
+// signature, it has a strong indicator, like a redirect to a private address, or it has at least two indicators.
+func (i *HTTPInspection) LikelyInjected() bool {
+	if i.BlockPage != "" || len(i.Indicators) >= 2 {
+		return true
+	}
+	for _, indicator := range i.Indicators {
+		for _, strong := range strongIndicators {
+			if indicator == strong {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InspectHTTPResponse inspects the response and the beginning of its body for signs that the network injected it,
+// so that apps can tell the user that a site is blocked, rather than show the block page as the site.
+// The body must not be compressed, otherwise only the headers are inspected. It uses the given block page
+// signatures, or [DefaultBlockPages] if nil. The response body is not read.
+func InspectHTTPResponse(resp *http.Response, body []byte, signatures []BlockPageSignature) *HTTPInspection {
+	var raw bytes.Buffer
+	raw.WriteString(resp.Status + "\r\n")
+	resp.Header.Write(&raw)
+	raw.WriteString("\r\n")
+	raw.Write(body)
+	return inspectHTTPResponse(resp, raw.Bytes(), body, signatures)
+}
+
+// inspectRawHTTPResponse inspects the response as received from the network. The heuristics are skipped if it's
+// not a valid HTTP response.
+func inspectRawHTTPResponse(response []byte, signatures []BlockPageSignature) *HTTPInspection {
+	if len(response) == 0 {
+		return &HTTPInspection{}
+	}
+	body := response
+	if i := bytes.Index(response, []byte("\r\n\r\n")); i >= 0 {
+		body = response[i+4:]
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(response)), nil)
+	if err != nil {
+		resp = nil
+	}
+	return inspectHTTPResponse(resp, response, body, signatures)
+}
+
+func inspectHTTPResponse(resp *http.Response, raw []byte, body []byte, signatures []BlockPageSignature) *HTTPInspection {
+	inspection := &HTTPInspection{}
+	inspection.BlockPage, _ = matchBlockPage(signatures, raw, body)
+	if resp == nil {
+		return inspection
+	}
+	if resp.StatusCode == http.StatusUnavailableForLegalReasons {
+		inspection.Indicators = append(inspection.Indicators, IndicatorLegalStatus)
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		if u, err := url.Parse(location); err == nil && isReservedHost(u.Hostname()) {
+			inspection.Indicators = append(inspection.Indicators, IndicatorReservedRedirect)
+		}
+	}
+	for _, match := range frameTargetPattern.FindAllSubmatch(body, -1) {
+		if isReservedHost(string(match[1])) {
+			inspection.Indicators = append(inspection.Indicators, IndicatorReservedFrame)
+			break
+		}
+	}
+	if resp.Header.Get("Date") == "" {
+		inspection.Indicators = append(inspection.Indicators, IndicatorMissingDate)
+	}
+	if hasRegionalCharset([]byte(resp.Header.Get("Content-Type"))) || hasRegionalCharset(body) {
+		inspection.Indicators = append(inspection.Indicators, IndicatorRegionalCharset)
+	}
+	return inspection
+}
+
+// matchBlockPage returns the name of the first block page signature that matches the HTTP response, or of
+// [DefaultBlockPages] if signatures is nil.
+func matchBlockPage(signatures []BlockPageSignature, response []byte, body []byte) (string, bool) {
+	if len(response) == 0 {
+		return "", false
+	}
+	hash := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(hash[:])
+	if signatures == nil {
+		signatures = DefaultBlockPages
+	}
+	for _, signature := range signatures {
+		if signature.BodySHA256 != "" && signature.BodySHA256 == bodyHash {
+			return signature.Name, true
+		}
+		if signature.Pattern != "" && bytes.Contains(response, []byte(signature.Pattern)) {
+			return signature.Name, true
+		}
+	}
+	return "", false
+}
+
+func isReservedHost(host string) bool {
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsMulticast()
+}
+
+func hasRegionalCharset(text []byte) bool {
+	for _, match := range charsetPattern.FindAllSubmatch(text, -1) {
+		charset := strings.ToLower(string(match[1]))
+		for _, regional := range regionalCharsets {
+			if charset == regional {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectHTTPResponse(t *testing.T) {
+	date := "Tue, 04 Mar 2025 10:00:00 GMT"
+	for _, tc := range []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		blockPage  string
+		indicators []InjectionIndicator
+		injected   bool
+	}{
+		{"regular", http.StatusOK, http.Header{"Date": {date}, "Content-Type": {"text/html; charset=utf-8"}}, "<html>welcome</html>", "", nil, false},
+		{"no date", http.StatusOK, http.Header{}, "welcome", "", []InjectionIndicator{IndicatorMissingDate}, false},
+		{"signature", http.StatusForbidden, http.Header{"Date": {date}}, `<iframe src="http://10.10.34.3"></iframe>`, "ir-iframe", []InjectionIndicator{IndicatorReservedFrame}, true},
+		{"legal status", http.StatusUnavailableForLegalReasons, http.Header{"Date": {date}}, "", "", []InjectionIndicator{IndicatorLegalStatus}, true},
+		{"reserved redirect", http.StatusFound, http.Header{"Date": {date}, "Location": {"http://192.168.10.1/blocked"}}, "", "", []InjectionIndicator{IndicatorReservedRedirect}, true},
+		{"public redirect", http.StatusFound, http.Header{"Date": {date}, "Location": {"https://8.8.8.8/"}}, "", "", nil, false},
+		{"reserved refresh", http.StatusOK, http.Header{"Date": {date}}, `<meta http-equiv="refresh" content="0; url=http://[fd00::1]/">`, "", []InjectionIndicator{IndicatorReservedFrame}, true},
+		{"regional charset", http.StatusOK, http.Header{"Date": {date}, "Content-Type": {"text/html; charset=Windows-1256"}}, "", "", []InjectionIndicator{IndicatorRegionalCharset}, false},
+		{"weak indicators", http.StatusForbidden, http.Header{}, `<meta charset="gb2312">`, "", []InjectionIndicator{IndicatorMissingDate, IndicatorRegionalCharset}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tc.status, Status: http.StatusText(tc.status), Header: tc.header}
+			inspection := InspectHTTPResponse(resp, []byte(tc.body), nil)
+			require.Equal(t, tc.blockPage, inspection.BlockPage)
+			require.Equal(t, tc.indicators, inspection.Indicators)
+			require.Equal(t, tc.injected, inspection.LikelyInjected())
+		})
+	}
+}
+
+func TestInspectHTTPResponse_Signatures(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{"X-Filter": {"isp-blocker"}}}
+	signatures := []BlockPageSignature{{Name: "header", Pattern: "X-Filter: isp-blocker"}}
+	inspection := InspectHTTPResponse(resp, nil, signatures)
+	require.Equal(t, "header", inspection.BlockPage)
+	require.True(t, inspection.LikelyInjected())
+
+	// Empty signatures disable the default ones.
+	resp.Header.Set("Date", "Tue, 04 Mar 2025 10:00:00 GMT")
+	inspection = InspectHTTPResponse(resp, []byte(`<iframe src="http://10.10.34.3"></iframe>`), []BlockPageSignature{})
+	require.Empty(t, inspection.BlockPage)
+	require.Equal(t, []InjectionIndicator{IndicatorReservedFrame}, inspection.Indicators)
+}
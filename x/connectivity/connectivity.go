@@ -27,7 +27,8 @@ import (
 
 // ConnectivityError captures the observed error of the connectivity test.
 type ConnectivityError struct {
-	// Which operation in the test that failed: "connect", "send" or "receive"
+	// Which operation in the test that failed: "connect", "send" or "receive", or "resolve" and "tls" in
+	// the probes of [Bisector].
 	Op string
 	// The POSIX error, when available
 	PosixError string
@@ -0,0 +1,372 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/netip"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/sockopt"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Fingerprint identifies the kind of middlebox that interfered with a probe of [Fingerprinter].
+type Fingerprint string
+
+const (
+	// FingerprintNone means no interference was observed.
+	FingerprintNone Fingerprint = "none"
+	// FingerprintRSTInjection means the connection was reset after the request was sent.
+	FingerprintRSTInjection Fingerprint = "rst-injection"
+	// FingerprintBlockPage means the response matched a known block page, or looks injected by the network,
+	// as found by [InspectHTTPResponse].
+	FingerprintBlockPage Fingerprint = "blockpage"
+	// FingerprintDNSInjection means DNS responses came from an address that doesn't run a resolver, or a resolver
+	// returned multiple different responses to the same query, as injectors race the legitimate response.
+	FingerprintDNSInjection Fingerprint = "dns-injection"
+	// FingerprintDNSPoisoning means the DNS answers are in a known poisoned set, or in reserved address ranges.
+	FingerprintDNSPoisoning Fingerprint = "dns-poisoning"
+	// FingerprintDrop means there was no response, so the packets were likely dropped.
+	FingerprintDrop Fingerprint = "drop"
+	// FingerprintUnknown means the probe failed in a way that doesn't match any fingerprint.
+	FingerprintUnknown Fingerprint = "unknown"
+)
+
+// MiddleboxFinding is the outcome of a probe of [Fingerprinter].
+type MiddleboxFinding struct {
+	// Probe identifies the probe, such as "dns-injection" or "http".
+	Probe string
+	// Address is the host:port the probe sent its packets to.
+	Address string
+	// Fingerprint is the classification of the observed interference.
+	Fingerprint Fingerprint
+	// Hop is the number of hops from the client at which the interference happened, as found by
+	// [Fingerprinter.ProbeResetHop]. It's zero if unknown. A hop lower than the distance to the server
+	// means the middlebox is on the path, rather than at the server.
+	Hop int
+	// BlockPage is the name of the matched block page signature, if any.
+	BlockPage string
+	// Indicators are the signs of injection found in the HTTP response, if it was classified as a block page.
+	Indicators []InjectionIndicator
+	// Answers are the addresses in the DNS responses, for the DNS probes.
+	Answers []netip.Addr
+	// Error is the error observed by the probe, if any.
+	Error *ConnectivityError
+}
+
+// BlockPageSignature identifies a block page served by a middlebox.
+type BlockPageSignature struct {
+	// Name identifies the block page in findings.
+	Name string
+	// BodySHA256 is the hex-encoded SHA-256 hash of the HTTP response body. Ignored if empty.
+	BodySHA256 string
+	// Pattern is a string found anywhere in the HTTP response, including the headers. Ignored if empty.
+	Pattern string
+}
+
+// DefaultBlockPages are the block page signatures used if [Fingerprinter.BlockPages] is nil, and by
+// [InspectHTTPResponse] if no signatures are given.
+var DefaultBlockPages = []BlockPageSignature{
+	// Iran serves an iframe pointing to the filtering server.
+	{Name: "ir-iframe", Pattern: `src="http://10.10.34.3`},
+}
+
+// Fingerprinter runs probes that classify the interference of middleboxes into a [Fingerprint], so that
+// reports tell how a network blocks traffic, and not only that it does.
+type Fingerprinter struct {
+	// StreamDialer is the dialer for the HTTP probes. If nil, a [transport.TCPDialer] is used.
+	StreamDialer transport.StreamDialer
+	// PacketDialer is the dialer for the DNS probes. If nil, a [transport.UDPDialer] is used.
+	PacketDialer transport.PacketDialer
+	// PoisonedPrefixes are the address ranges known to be returned by DNS injectors. Answers in them, or in
+	// reserved ranges like private addresses, are classified as [FingerprintDNSPoisoning].
+	PoisonedPrefixes []netip.Prefix
+	// BlockPages are the known block pages. If nil, [DefaultBlockPages] is used.
+	BlockPages []BlockPageSignature
+	// ProbeTimeout limits each probe. If zero, 5 seconds is used.
+	ProbeTimeout time.Duration
+	// HopTimeout is how long [Fingerprinter.ProbeResetHop] waits for a response at each hop. If zero, 2 seconds is used.
+	HopTimeout time.Duration
+	// MaxHops is the maximum hop tested by [Fingerprinter.ProbeResetHop]. If zero, 30 is used.
+	MaxHops int
+}
+
+func (f *Fingerprinter) probeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := f.ProbeTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// ProbeDNSInjection sends a query for the domain to the address of a host that doesn't run a DNS resolver.
+// Since the host can't answer, any response was injected by the network.
+func (f *Fingerprinter) ProbeDNSInjection(ctx context.Context, address string, domain string) (*MiddleboxFinding, error) {
+	responses, connErr, err := f.queryDNS(ctx, address, domain)
+	if err != nil {
+		return nil, err
+	}
+	finding := &MiddleboxFinding{Probe: "dns-injection", Address: address, Fingerprint: FingerprintNone}
+	for _, response := range responses {
+		finding.Answers = append(finding.Answers, response...)
+	}
+	switch {
+	case len(responses) > 0:
+		finding.Fingerprint = FingerprintDNSInjection
+	case !isTimeout(connErr):
+		// The probe expects a timeout, so other errors mean it didn't work.
+		finding.Fingerprint = FingerprintUnknown
+		finding.Error = connErr
+	}
+	return finding, nil
+}
+
+// ProbeDNSPoisoning sends a query for the domain to the address of a DNS resolver, and classifies the responses.
+// Multiple different responses mean the query was answered by an injector as well as the resolver.
+func (f *Fingerprinter) ProbeDNSPoisoning(ctx context.Context, address string, domain string) (*MiddleboxFinding, error) {
+	responses, connErr, err := f.queryDNS(ctx, address, domain)
+	if err != nil {
+		return nil, err
+	}
+	finding := &MiddleboxFinding{Probe: "dns-poisoning", Address: address, Fingerprint: FingerprintNone}
+	if len(responses) == 0 {
+		finding.Error = connErr
+		if isTimeout(connErr) {
+			finding.Fingerprint = FingerprintDrop
+		} else {
+			finding.Fingerprint = FingerprintUnknown
+		}
+		return finding, nil
+	}
+	for i, response := range responses {
+		finding.Answers = append(finding.Answers, response...)
+		if i > 0 && !slices.Equal(response, responses[0]) {
+			finding.Fingerprint = FingerprintDNSInjection
+		}
+	}
+	if finding.Fingerprint == FingerprintNone && slices.ContainsFunc(finding.Answers, f.isPoisoned) {
+		finding.Fingerprint = FingerprintDNSPoisoning
+	}
+	return finding, nil
+}
+
+func (f *Fingerprinter) isPoisoned(ip netip.Addr) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return true
+	}
+	for _, prefix := range f.PoisonedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryDNS sends an A query and collects the addresses of all the responses until the probe timeout, since
+// injected responses usually arrive before the legitimate one. The connectivity error is the one that ended the
+// collection.
+func (f *Fingerprinter) queryDNS(ctx context.Context, address string, domain string) ([][]netip.Addr, *ConnectivityError, error) {
+	q, err := dns.NewQuestion(domain, dnsmessage.TypeA)
+	if err != nil {
+		return nil, nil, fmt.Errorf("question creation failed: %w", err)
+	}
+	id := uint16(rand.Uint32())
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{*q},
+	}
+	request, err := query.Pack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to pack query: %w", err)
+	}
+
+	ctx, cancel := f.probeContext(ctx)
+	defer cancel()
+	dialer := f.PacketDialer
+	if dialer == nil {
+		dialer = &transport.UDPDialer{}
+	}
+	conn, err := dialer.DialPacket(ctx, address)
+	if err != nil {
+		return nil, makeConnectivityError("connect", err), nil
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(request); err != nil {
+		return nil, makeConnectivityError("send", err), nil
+	}
+	var responses [][]netip.Addr
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return responses, makeConnectivityError("receive", err), nil
+		}
+		var response dnsmessage.Message
+		if err := response.Unpack(buf[:n]); err != nil || response.ID != id || !response.Response {
+			continue
+		}
+		var ips []netip.Addr
+		for _, answer := range response.Answers {
+			if a, ok := answer.Body.(*dnsmessage.AResource); ok {
+				ips = append(ips, netip.AddrFrom4(a.A))
+			}
+		}
+		responses = append(responses, ips)
+	}
+}
+
+// ProbeHTTP sends a plain HTTP request for the domain to the address, and classifies the response or error.
+func (f *Fingerprinter) ProbeHTTP(ctx context.Context, address string, domain string) (*MiddleboxFinding, error) {
+	ctx, cancel := f.probeContext(ctx)
+	defer cancel()
+	dialer := f.StreamDialer
+	if dialer == nil {
+		dialer = &transport.TCPDialer{}
+	}
+	finding := &MiddleboxFinding{Probe: "http", Address: address}
+	conn, err := dialer.DialStream(ctx, address)
+	if err != nil {
+		finding.Error = makeConnectivityError("connect", err)
+		finding.Fingerprint = f.classifyError(finding.Error)
+		return finding, nil
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	response, connErr := exchangeHTTP(conn, domain)
+	f.classifyResponse(finding, response, connErr)
+	return finding, nil
+}
+
+func exchangeHTTP(conn net.Conn, domain string) ([]byte, *ConnectivityError) {
+	request := fmt.Sprintf("GET / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", domain)
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return nil, makeConnectivityError("send", err)
+	}
+	response, err := io.ReadAll(io.LimitReader(conn, 64*1024))
+	if err != nil {
+		return response, makeConnectivityError("receive", err)
+	}
+	return response, nil
+}
+
+// classifyResponse sets the fingerprint of the finding from the response received, and the error that ended it.
+func (f *Fingerprinter) classifyResponse(finding *MiddleboxFinding, response []byte, connErr *ConnectivityError) {
+	if inspection := inspectRawHTTPResponse(response, f.BlockPages); inspection.LikelyInjected() {
+		finding.Fingerprint = FingerprintBlockPage
+		finding.BlockPage = inspection.BlockPage
+		finding.Indicators = inspection.Indicators
+		return
+	}
+	finding.Error = connErr
+	if connErr != nil && len(response) == 0 {
+		finding.Fingerprint = f.classifyError(connErr)
+		return
+	}
+	finding.Fingerprint = FingerprintNone
+}
+
+func (f *Fingerprinter) classifyError(err *ConnectivityError) Fingerprint {
+	switch {
+	case errors.Is(err, syscall.ECONNRESET):
+		return FingerprintRSTInjection
+	case isTimeout(err):
+		return FingerprintDrop
+	default:
+		return FingerprintUnknown
+	}
+}
+
+// ProbeResetHop locates the middlebox that resets or answers the payload, like a TLS Client Hello or an HTTP request,
+// sent to the address. It sends the payload with increasing hop limits, so it expires before reaching the server,
+// until a response or reset comes back. Responses to packets that can't have reached the server were injected
+// on the path, at the hop reported in the finding. The TCP handshake uses the default hop limit.
+func (f *Fingerprinter) ProbeResetHop(ctx context.Context, address string, payload []byte) (*MiddleboxFinding, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("payload must not be empty")
+	}
+	maxHops := f.MaxHops
+	if maxHops == 0 {
+		maxHops = 30
+	}
+	hopTimeout := f.HopTimeout
+	if hopTimeout == 0 {
+		hopTimeout = 2 * time.Second
+	}
+	finding := &MiddleboxFinding{Probe: "reset-hop", Address: address, Fingerprint: FingerprintNone}
+	for hop := 1; hop <= maxHops; hop++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		response, connErr, err := sendWithHopLimit(ctx, address, payload, hop, hopTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if connErr != nil && isTimeout(connErr) && len(response) == 0 {
+			// The payload expired before reaching anything that answers.
+			continue
+		}
+		finding.Hop = hop
+		f.classifyResponse(finding, response, connErr)
+		return finding, nil
+	}
+	finding.Fingerprint = FingerprintDrop
+	return finding, nil
+}
+
+// sendWithHopLimit connects to the address and sends the payload with the hop limit. It returns the data received
+// before the hop timeout, and the error that ended the exchange.
+func sendWithHopLimit(ctx context.Context, address string, payload []byte, hop int, hopTimeout time.Duration) ([]byte, *ConnectivityError, error) {
+	ctx, cancel := context.WithTimeout(ctx, hopTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, makeConnectivityError("connect", err), nil
+	}
+	defer conn.Close()
+	tcpOptions, err := sockopt.NewTCPOptions(conn.(*net.TCPConn))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tcpOptions.SetHopLimit(hop); err != nil {
+		return nil, nil, fmt.Errorf("failed to set the hop limit %d: %w", hop, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return nil, makeConnectivityError("send", err), nil
+	}
+	response, err := io.ReadAll(io.LimitReader(conn, 64*1024))
+	if err != nil {
+		return response, makeConnectivityError("receive", err), nil
+	}
+	return response, nil, nil
+}
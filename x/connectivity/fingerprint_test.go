@@ -0,0 +1,175 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startDNSInjector starts a UDP server that answers each query once per address list.
+func startDNSInjector(t *testing.T, answers ...[]netip.Addr) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			for _, ips := range answers {
+				response := dnsmessage.Message{Header: dnsmessage.Header{ID: query.ID, Response: true}, Questions: query.Questions}
+				for _, ip := range ips {
+					response.Answers = append(response.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+						Body:   &dnsmessage.AResource{A: ip.As4()},
+					})
+				}
+				packed, err := response.Pack()
+				require.NoError(t, err)
+				conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestFingerprinter_DNSInjection(t *testing.T) {
+	f := &Fingerprinter{ProbeTimeout: 200 * time.Millisecond}
+
+	finding, err := f.ProbeDNSInjection(context.Background(), startDNSInjector(t, []netip.Addr{goodIP}), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, FingerprintDNSInjection, finding.Fingerprint)
+	require.Equal(t, []netip.Addr{goodIP}, finding.Answers)
+
+	finding, err = f.ProbeDNSInjection(context.Background(), startDNSInjector(t), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, FingerprintNone, finding.Fingerprint)
+	require.Nil(t, finding.Error)
+}
+
+func TestFingerprinter_DNSPoisoning(t *testing.T) {
+	f := &Fingerprinter{
+		ProbeTimeout:     200 * time.Millisecond,
+		PoisonedPrefixes: []netip.Prefix{netip.PrefixFrom(bogusIP, 32)},
+	}
+	for _, tc := range []struct {
+		name     string
+		answers  [][]netip.Addr
+		expected Fingerprint
+	}{
+		{"none", [][]netip.Addr{{goodIP}}, FingerprintNone},
+		{"poisoned prefix", [][]netip.Addr{{bogusIP}}, FingerprintDNSPoisoning},
+		{"reserved", [][]netip.Addr{{netip.MustParseAddr("10.10.34.34")}}, FingerprintDNSPoisoning},
+		{"race", [][]netip.Addr{{bogusIP}, {goodIP}}, FingerprintDNSInjection},
+		{"duplicates", [][]netip.Addr{{goodIP}, {goodIP}}, FingerprintNone},
+		{"drop", nil, FingerprintDrop},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			finding, err := f.ProbeDNSPoisoning(context.Background(), startDNSInjector(t, tc.answers...), "example.com")
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, finding.Fingerprint)
+		})
+	}
+}
+
+// startTCPServer starts a server that runs handle for each connection after reading the request.
+func startTCPServer(t *testing.T, handle func(conn *net.TCPConn)) string {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.AcceptTCP()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Read(make([]byte, 1500))
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestFingerprinter_HTTP(t *testing.T) {
+	f := &Fingerprinter{
+		ProbeTimeout: 200 * time.Millisecond,
+		BlockPages:   append([]BlockPageSignature{{Name: "test", BodySHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}}, DefaultBlockPages...),
+	}
+	for _, tc := range []struct {
+		name      string
+		handle    func(conn *net.TCPConn)
+		expected  Fingerprint
+		blockPage string
+	}{
+		{"none", func(conn *net.TCPConn) {
+			conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\nwelcome"))
+		}, FingerprintNone, ""},
+		{"hash", func(conn *net.TCPConn) {
+			conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\nhello"))
+		}, FingerprintBlockPage, "test"},
+		{"pattern", func(conn *net.TCPConn) {
+			conn.Write([]byte(`HTTP/1.1 403 Forbidden\r\n\r\n<html><iframe src="http://10.10.34.34?type=Invalid Site"></iframe></html>`))
+		}, FingerprintBlockPage, "ir-iframe"},
+		{"reset", func(conn *net.TCPConn) {
+			conn.SetLinger(0)
+		}, FingerprintRSTInjection, ""},
+		{"drop", func(conn *net.TCPConn) {
+			time.Sleep(time.Second)
+		}, FingerprintDrop, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			finding, err := f.ProbeHTTP(context.Background(), startTCPServer(t, tc.handle), "example.com")
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, finding.Fingerprint)
+			require.Equal(t, tc.blockPage, finding.BlockPage)
+		})
+	}
+}
+
+func TestFingerprinter_ResetHop(t *testing.T) {
+	f := &Fingerprinter{HopTimeout: 200 * time.Millisecond, MaxHops: 2}
+
+	// Loopback is one hop away, so the reset comes at the first hop.
+	address := startTCPServer(t, func(conn *net.TCPConn) { conn.SetLinger(0) })
+	finding, err := f.ProbeResetHop(context.Background(), address, []byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, FingerprintRSTInjection, finding.Fingerprint)
+	require.Equal(t, 1, finding.Hop)
+
+	address = startTCPServer(t, func(conn *net.TCPConn) { time.Sleep(time.Second) })
+	finding, err = f.ProbeResetHop(context.Background(), address, []byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, FingerprintDrop, finding.Fingerprint)
+	require.Equal(t, 0, finding.Hop)
+
+	_, err = f.ProbeResetHop(context.Background(), address, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,101 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"sync"
+	"time"
+)
+
+// TestRecord is the result of a test run by a [Scheduler].
+type TestRecord struct {
+	// Name is the name of the test in the suite.
+	Name string
+	// Network is the type of the network the test ran on, as reported by [Scheduler.NetworkType].
+	Network string
+	// Time is when the test started.
+	Time time.Time
+	// Duration is how long the test took.
+	Duration time.Duration
+	// Result is the connectivity error found by the test, or nil if there's connectivity.
+	Result *ConnectivityError
+	// Err is set if the test was invalid and could not assert connectivity.
+	Err error
+}
+
+// OK reports whether the test was valid and found connectivity.
+func (r *TestRecord) OK() bool {
+	return r.Result == nil && r.Err == nil
+}
+
+// HistoryStore keeps the most recent test records in memory, dropping the oldest when full, so apps can
+// show the connection health over time. It's safe for concurrent use.
+type HistoryStore struct {
+	mu      sync.Mutex
+	records []TestRecord
+	// next is the index of the next record to write.
+	next int
+	full bool
+}
+
+// NewHistoryStore creates a [HistoryStore] that keeps up to capacity records, or a single record
+// if capacity is not positive.
+func NewHistoryStore(capacity int) *HistoryStore {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &HistoryStore{records: make([]TestRecord, capacity)}
+}
+
+// Add appends the record to the store, replacing the oldest one if the store is full.
+func (s *HistoryStore) Add(record TestRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[s.next] = record
+	s.next++
+	if s.next == len(s.records) {
+		s.next = 0
+		s.full = true
+	}
+}
+
+// Len returns the number of records in the store.
+func (s *HistoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.full {
+		return len(s.records)
+	}
+	return s.next
+}
+
+// Query returns the records that started at or after since, from oldest to newest.
+// Use the zero time to get all the records.
+func (s *HistoryStore) Query(since time.Time) []TestRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ordered []TestRecord
+	if s.full {
+		ordered = append(ordered, s.records[s.next:]...)
+	}
+	ordered = append(ordered, s.records[:s.next]...)
+	result := make([]TestRecord, 0, len(ordered))
+	for _, record := range ordered {
+		if !record.Time.Before(since) {
+			result = append(result, record)
+		}
+	}
+	return result
+}
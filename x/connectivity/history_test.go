@@ -0,0 +1,51 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryStore_Wraps(t *testing.T) {
+	store := NewHistoryStore(3)
+	require.Equal(t, 0, store.Len())
+	require.Empty(t, store.Query(time.Time{}))
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		store.Add(TestRecord{Name: string(rune('a' + i)), Time: start.Add(time.Duration(i) * time.Second)})
+	}
+	require.Equal(t, 3, store.Len())
+	var names []string
+	for _, record := range store.Query(time.Time{}) {
+		names = append(names, record.Name)
+	}
+	require.Equal(t, []string{"c", "d", "e"}, names)
+}
+
+func TestHistoryStore_QuerySince(t *testing.T) {
+	store := NewHistoryStore(10)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		store.Add(TestRecord{Name: string(rune('a' + i)), Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+	records := store.Query(start.Add(2 * time.Minute))
+	require.Len(t, records, 2)
+	require.Equal(t, "c", records[0].Name)
+	require.Equal(t, "d", records[1].Name)
+}
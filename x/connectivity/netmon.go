@@ -0,0 +1,218 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// netmonPollInterval is how often the network state is polled when system notifications are not available.
+	netmonPollInterval = 5 * time.Second
+	// netmonWatchPollInterval is how often the network state is polled as a safety net when system
+	// notifications are available.
+	netmonWatchPollInterval = time.Minute
+	// netmonDebounceDelay is how long to wait for a burst of system notifications to settle.
+	netmonDebounceDelay = 500 * time.Millisecond
+)
+
+// NetworkChangeListener is notified when the network changes. It is an interface, rather than a function,
+// so it can be implemented in Java, Kotlin, Objective-C or Swift via Go Mobile.
+type NetworkChangeListener interface {
+	// OnNetworkChange is called when the network interfaces or their addresses change.
+	// It's called from a monitor goroutine and should not block.
+	OnNetworkChange()
+}
+
+// NetworkChangeFunc is a [NetworkChangeListener] that calls the function.
+type NetworkChangeFunc func()
+
+var _ NetworkChangeListener = (NetworkChangeFunc)(nil)
+
+// OnNetworkChange implements [NetworkChangeListener].
+func (f NetworkChangeFunc) OnNetworkChange() {
+	f()
+}
+
+// NetworkMonitor detects changes to the system network, such as switching from Wi-Fi to cellular, so that
+// apps can invalidate state that depends on the network, like cached strategies.
+//
+// On Linux and Android, it listens to link, address and route notifications from netlink. On macOS and iOS,
+// it listens to the routing socket. On other platforms, or if the notifications are not available, it polls
+// the network interfaces. In all cases, listeners are only notified when the set of active interfaces or their
+// addresses change, which filters the frequent notifications that don't affect connectivity.
+type NetworkMonitor struct {
+	getState func() (string, error)
+	check    chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+
+	mu        sync.Mutex
+	listeners map[*NetworkSubscription]NetworkChangeListener
+	closeOnce sync.Once
+}
+
+// NetworkSubscription represents a [NetworkChangeListener] registered with [NetworkMonitor.Subscribe].
+type NetworkSubscription struct {
+	monitor *NetworkMonitor
+}
+
+// Cancel stops the notifications to the subscribed listener.
+func (s *NetworkSubscription) Cancel() {
+	s.monitor.mu.Lock()
+	defer s.monitor.mu.Unlock()
+	delete(s.monitor.listeners, s)
+}
+
+// NewNetworkMonitor starts monitoring the system network. Call [NetworkMonitor.Close] to stop it.
+func NewNetworkMonitor() (*NetworkMonitor, error) {
+	m := newNetworkMonitor(networkState)
+	pollInterval := netmonWatchPollInterval
+	stopWatch, err := watchSystemNetwork(m.Check)
+	if err != nil {
+		// Fall back to polling.
+		pollInterval = netmonPollInterval
+		stopWatch = func() {}
+	}
+	if err := m.start(pollInterval, stopWatch); err != nil {
+		stopWatch()
+		return nil, err
+	}
+	return m, nil
+}
+
+func newNetworkMonitor(getState func() (string, error)) *NetworkMonitor {
+	return &NetworkMonitor{
+		getState:  getState,
+		check:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		listeners: make(map[*NetworkSubscription]NetworkChangeListener),
+	}
+}
+
+func (m *NetworkMonitor) start(pollInterval time.Duration, stopWatch func()) error {
+	state, err := m.getState()
+	if err != nil {
+		return fmt.Errorf("failed to get network state: %w", err)
+	}
+	go func() {
+		defer close(m.stopped)
+		defer stopWatch()
+		m.run(state, pollInterval)
+	}()
+	return nil
+}
+
+func (m *NetworkMonitor) run(state string, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		case <-m.check:
+			// Let bursts of notifications settle.
+			select {
+			case <-m.done:
+				return
+			case <-time.After(netmonDebounceDelay):
+			}
+			// Drop the notifications that arrived while waiting.
+			select {
+			case <-m.check:
+			default:
+			}
+		}
+		newState, err := m.getState()
+		if err != nil || newState == state {
+			continue
+		}
+		state = newState
+		m.notify()
+	}
+}
+
+func (m *NetworkMonitor) notify() {
+	m.mu.Lock()
+	listeners := make([]NetworkChangeListener, 0, len(m.listeners))
+	for _, listener := range m.listeners {
+		listeners = append(listeners, listener)
+	}
+	m.mu.Unlock()
+	for _, listener := range listeners {
+		listener.OnNetworkChange()
+	}
+}
+
+// Subscribe registers the listener to be notified of network changes, until the returned subscription is canceled.
+func (m *NetworkMonitor) Subscribe(listener NetworkChangeListener) *NetworkSubscription {
+	s := &NetworkSubscription{monitor: m}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners[s] = listener
+	return s
+}
+
+// Check asks the monitor to check the network state soon. Apps can call it when they learn about a
+// network change from the platform, for instance from Android's ConnectivityManager callbacks.
+func (m *NetworkMonitor) Check() {
+	select {
+	case m.check <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the monitor. No notifications are delivered after it returns.
+func (m *NetworkMonitor) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+	<-m.stopped
+	return nil
+}
+
+// networkState returns a description of the active network interfaces and their addresses, which changes
+// when the network changes.
+func networkState() (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	var entries []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return "", err
+		}
+		addrTexts := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			addrTexts = append(addrTexts, addr.String())
+		}
+		slices.Sort(addrTexts)
+		entries = append(entries, fmt.Sprintf("%v/%v: %v", iface.Index, iface.Name, strings.Join(addrTexts, ",")))
+	}
+	slices.Sort(entries)
+	return strings.Join(entries, "\n"), nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchSystemNetwork calls onChange when the routing socket reports interface, address or route changes.
+func watchSystemNetwork(onChange func()) (stop func(), err error) {
+	fd, err := unix.Socket(unix.AF_ROUTE, unix.SOCK_RAW, unix.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	unix.CloseOnExec(fd)
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("setnonblock", err)
+	}
+	// The non-blocking file uses the runtime poller, so Close unblocks the pending Read.
+	file := os.NewFile(uintptr(fd), "route")
+	go func() {
+		buf := make([]byte, os.Getpagesize())
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+			// The message type follows the message length and version. See rt_msghdr in <net/route.h>.
+			if n < 4 {
+				continue
+			}
+			switch buf[3] {
+			case unix.RTM_ADD, unix.RTM_DELETE, unix.RTM_CHANGE, unix.RTM_NEWADDR, unix.RTM_DELADDR, unix.RTM_IFINFO:
+				onChange()
+			}
+		}
+	}()
+	return func() { file.Close() }, nil
+}
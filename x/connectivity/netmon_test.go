@@ -0,0 +1,92 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkMonitor_NotifiesOnStateChange(t *testing.T) {
+	var state atomic.Value
+	state.Store("wifi")
+	m := newNetworkMonitor(func() (string, error) {
+		return state.Load().(string), nil
+	})
+	require.NoError(t, m.start(time.Hour, func() {}))
+	defer m.Close()
+
+	changes := make(chan struct{}, 10)
+	m.Subscribe(NetworkChangeFunc(func() { changes <- struct{}{} }))
+
+	// No change in state, no notification.
+	m.Check()
+	select {
+	case <-changes:
+		t.Fatal("unexpected notification")
+	case <-time.After(netmonDebounceDelay + 100*time.Millisecond):
+	}
+
+	state.Store("cellular")
+	m.Check()
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("missing notification")
+	}
+}
+
+func TestNetworkMonitor_Cancel(t *testing.T) {
+	m := newNetworkMonitor(func() (string, error) { return "", nil })
+	var calls atomic.Int32
+	s := m.Subscribe(NetworkChangeFunc(func() { calls.Add(1) }))
+	m.notify()
+	require.Equal(t, int32(1), calls.Load())
+	s.Cancel()
+	m.notify()
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestNetworkMonitor_Polls(t *testing.T) {
+	var calls atomic.Int32
+	m := newNetworkMonitor(func() (string, error) {
+		return string(rune('a' + calls.Add(1))), nil
+	})
+	changes := make(chan struct{}, 10)
+	m.Subscribe(NetworkChangeFunc(func() { changes <- struct{}{} }))
+	require.NoError(t, m.start(10*time.Millisecond, func() {}))
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("missing notification")
+	}
+	require.NoError(t, m.Close())
+}
+
+func TestNewNetworkMonitor(t *testing.T) {
+	m, err := NewNetworkMonitor()
+	require.NoError(t, err)
+	require.NoError(t, m.Close())
+	// Close is idempotent.
+	require.NoError(t, m.Close())
+}
+
+func TestNetworkState(t *testing.T) {
+	_, err := networkState()
+	require.NoError(t, err)
+}
@@ -0,0 +1,387 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// OONIDataFormatVersion is the version of the OONI base data format of the measurements.
+	OONIDataFormatVersion = "0.2.0"
+	// OONIResolverTestName is the test name of measurements of [TestConnectivityWithResolver].
+	OONIResolverTestName = "outline_resolver_connectivity"
+	// OONIBisectTestName is the test name of measurements of [Bisector.Bisect].
+	OONIBisectTestName = "outline_bisect"
+
+	ooniTestVersion = "0.1.0"
+	ooniTimeFormat  = "2006-01-02 15:04:05"
+)
+
+// OONIMeasurement is a measurement in the [OONI data format], so that results of the connectivity tests can be
+// submitted to or compared against OONI datasets. The test keys follow the DNS (df-002), TCP connect (df-005),
+// TLS handshake (df-006) and network events (df-008) formats, with failures named as in df-007.
+//
+// [OONI data format]: https://github.com/ooni/spec/tree/master/data-formats
+type OONIMeasurement struct {
+	Annotations          map[string]string `json:"annotations"`
+	DataFormatVersion    string            `json:"data_format_version"`
+	Input                string            `json:"input"`
+	MeasurementStartTime string            `json:"measurement_start_time"`
+	ProbeASN             string            `json:"probe_asn"`
+	ProbeCC              string            `json:"probe_cc"`
+	ProbeIP              string            `json:"probe_ip"`
+	ReportID             string            `json:"report_id"`
+	SoftwareName         string            `json:"software_name"`
+	SoftwareVersion      string            `json:"software_version"`
+	TestName             string            `json:"test_name"`
+	TestRuntime          float64           `json:"test_runtime"`
+	TestStartTime        string            `json:"test_start_time"`
+	TestVersion          string            `json:"test_version"`
+	TestKeys             OONITestKeys      `json:"test_keys"`
+}
+
+// IsSuccess returns whether the test found connectivity. It implements the report.HasSuccess interface, so
+// measurements can be sampled by success.
+func (m *OONIMeasurement) IsSuccess() bool {
+	return m.TestKeys.Failure == nil
+}
+
+// OONITestKeys are the observations of an [OONIMeasurement].
+type OONITestKeys struct {
+	Queries       []OONIDNSQuery     `json:"queries"`
+	TCPConnect    []OONITCPConnect   `json:"tcp_connect"`
+	TLSHandshakes []OONITLSHandshake `json:"tls_handshakes"`
+	NetworkEvents []OONINetworkEvent `json:"network_events"`
+	// Failure is the failure of the test as a whole, or nil on success.
+	Failure *string `json:"failure"`
+	// Cause is the cause found by [Bisector], if the measurement comes from a bisection.
+	Cause InterferenceCause `json:"outline_cause,omitempty"`
+}
+
+// OONIDNSQuery is a DNS query, in the df-002 format.
+type OONIDNSQuery struct {
+	Answers         []OONIDNSAnswer `json:"answers"`
+	Engine          string          `json:"engine"`
+	Failure         *string         `json:"failure"`
+	Hostname        string          `json:"hostname"`
+	QueryType       string          `json:"query_type"`
+	ResolverAddress string          `json:"resolver_address"`
+	T               float64         `json:"t"`
+	Tags            []string        `json:"tags,omitempty"`
+}
+
+// OONIDNSAnswer is an answer of a [OONIDNSQuery].
+type OONIDNSAnswer struct {
+	AnswerType string `json:"answer_type"`
+	IPv4       string `json:"ipv4,omitempty"`
+	IPv6       string `json:"ipv6,omitempty"`
+}
+
+// OONITCPConnect is a TCP connection attempt, in the df-005 format.
+type OONITCPConnect struct {
+	IP     string               `json:"ip"`
+	Port   int                  `json:"port"`
+	Status OONITCPConnectStatus `json:"status"`
+	T      float64              `json:"t"`
+	Tags   []string             `json:"tags,omitempty"`
+}
+
+// OONITCPConnectStatus is the outcome of a [OONITCPConnect].
+type OONITCPConnectStatus struct {
+	Failure *string `json:"failure"`
+	Success bool    `json:"success"`
+}
+
+// OONITLSHandshake is a TLS handshake, in the df-006 format.
+type OONITLSHandshake struct {
+	Address     string   `json:"address"`
+	Failure     *string  `json:"failure"`
+	NoTLSVerify bool     `json:"no_tls_verify"`
+	ServerName  string   `json:"server_name"`
+	T           float64  `json:"t"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// OONINetworkEvent is a network event, in the df-008 format.
+type OONINetworkEvent struct {
+	Address   string   `json:"address,omitempty"`
+	Failure   *string  `json:"failure"`
+	Operation string   `json:"operation"`
+	Proto     string   `json:"proto,omitempty"`
+	T         float64  `json:"t"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// OONIProbeInfo describes the software and network that ran the tests, for the header of an [OONIMeasurement].
+type OONIProbeInfo struct {
+	// SoftwareName and SoftwareVersion identify the app running the test.
+	SoftwareName    string
+	SoftwareVersion string
+	// ProbeASN is the autonomous system number of the network, or zero if unknown.
+	ProbeASN uint
+	// ProbeCC is the two-letter country code of the network. If empty, "ZZ" (unknown) is used.
+	ProbeCC string
+	// Annotations are free-form key-values added to the measurement, such as the sanitized transport config.
+	Annotations map[string]string
+}
+
+// ResolverTest describes a run of [TestConnectivityWithResolver].
+type ResolverTest struct {
+	// Domain is the test domain that was resolved.
+	Domain string
+	// ResolverAddress is the host:port of the resolver.
+	ResolverAddress string
+	// Proto is the protocol used to reach the resolver, "tcp" or "udp".
+	Proto string
+	// StartTime and Duration are when the test started and how long it took.
+	StartTime time.Time
+	Duration  time.Duration
+	// Result is the result returned by the test.
+	Result *ConnectivityError
+}
+
+func newOONIMeasurement(info *OONIProbeInfo, testName string, input string, start time.Time, runtime time.Duration) *OONIMeasurement {
+	m := &OONIMeasurement{
+		Annotations:          map[string]string{},
+		DataFormatVersion:    OONIDataFormatVersion,
+		Input:                input,
+		MeasurementStartTime: start.UTC().Format(ooniTimeFormat),
+		ProbeASN:             "AS0",
+		ProbeCC:              "ZZ",
+		// OONI always redacts the probe IP to this value.
+		ProbeIP:         "127.0.0.1",
+		TestName:        testName,
+		TestRuntime:     runtime.Seconds(),
+		TestStartTime:   start.UTC().Format(ooniTimeFormat),
+		TestVersion:     ooniTestVersion,
+		SoftwareName:    "outline-sdk",
+		SoftwareVersion: "unknown",
+		TestKeys: OONITestKeys{
+			Queries:       []OONIDNSQuery{},
+			TCPConnect:    []OONITCPConnect{},
+			TLSHandshakes: []OONITLSHandshake{},
+			NetworkEvents: []OONINetworkEvent{},
+		},
+	}
+	if info == nil {
+		return m
+	}
+	for key, value := range info.Annotations {
+		m.Annotations[key] = value
+	}
+	if info.SoftwareName != "" {
+		m.SoftwareName = info.SoftwareName
+	}
+	if info.SoftwareVersion != "" {
+		m.SoftwareVersion = info.SoftwareVersion
+	}
+	if info.ProbeASN != 0 {
+		m.ProbeASN = fmt.Sprintf("AS%d", info.ProbeASN)
+	}
+	if info.ProbeCC != "" {
+		m.ProbeCC = strings.ToUpper(info.ProbeCC)
+	}
+	return m
+}
+
+// NewOONIResolverMeasurement converts the run of [TestConnectivityWithResolver] to an [OONIMeasurement].
+// The info may be nil.
+func NewOONIResolverMeasurement(info *OONIProbeInfo, test *ResolverTest) *OONIMeasurement {
+	m := newOONIMeasurement(info, OONIResolverTestName, test.Domain, test.StartTime, test.Duration)
+	m.Annotations["resolver_proto"] = test.Proto
+	failure := OONIFailure(test.Result)
+	m.TestKeys.Failure = failure
+	m.TestKeys.Queries = append(m.TestKeys.Queries, OONIDNSQuery{
+		Answers:         []OONIDNSAnswer{},
+		Engine:          test.Proto,
+		Failure:         failure,
+		Hostname:        test.Domain,
+		QueryType:       "A",
+		ResolverAddress: test.ResolverAddress,
+		T:               test.Duration.Seconds(),
+	})
+	operation := "resolve_done"
+	if test.Result != nil {
+		operation = test.Result.Op
+	}
+	m.TestKeys.NetworkEvents = append(m.TestKeys.NetworkEvents, OONINetworkEvent{
+		Address:   test.ResolverAddress,
+		Failure:   failure,
+		Operation: operation,
+		Proto:     test.Proto,
+		T:         test.Duration.Seconds(),
+	})
+	return m
+}
+
+// NewOONIBisectMeasurement converts the diagnosis of a [Bisector] started at the given time to an [OONIMeasurement].
+// Each probe is tagged with its name. The info may be nil.
+func NewOONIBisectMeasurement(info *OONIProbeInfo, diagnosis *Diagnosis, start time.Time) *OONIMeasurement {
+	var runtime time.Duration
+	for _, probe := range diagnosis.Probes {
+		runtime += probe.Duration
+	}
+	m := newOONIMeasurement(info, OONIBisectTestName, diagnosis.Domain, start, runtime)
+	m.TestKeys.Cause = diagnosis.Cause
+	if diagnosis.Cause != CauseNone {
+		failure := string(diagnosis.Cause) + "_interference"
+		if diagnosis.Cause == CauseTarget {
+			failure = "target_unreachable"
+		}
+		m.TestKeys.Failure = &failure
+	}
+
+	// The probes run sequentially, so the end time of each is the sum of the durations so far.
+	var elapsed time.Duration
+	for _, probe := range diagnosis.Probes {
+		elapsed += probe.Duration
+		t := elapsed.Seconds()
+		tags := []string{probe.Name}
+		failure := OONIFailure(probe.Error)
+		event := OONINetworkEvent{Address: probe.Address, Failure: failure, Proto: "tcp", T: t, Tags: tags}
+		switch {
+		case strings.HasSuffix(probe.Name, "-dns"):
+			ips := diagnosis.DirectIPs
+			if strings.HasPrefix(probe.Name, "trusted") {
+				ips = diagnosis.TrustedIPs
+			}
+			if failure != nil {
+				ips = nil
+			}
+			m.TestKeys.Queries = append(m.TestKeys.Queries, OONIDNSQuery{
+				Answers:   ooniAnswers(ips),
+				Failure:   failure,
+				Hostname:  probe.Address,
+				QueryType: "A",
+				T:         t,
+				Tags:      tags,
+			})
+			event.Operation = "resolve_done"
+			event.Proto = ""
+		case strings.HasSuffix(probe.Name, "-tcp"):
+			host, port := splitOONIAddress(probe.Address)
+			m.TestKeys.TCPConnect = append(m.TestKeys.TCPConnect, OONITCPConnect{
+				IP:     host,
+				Port:   port,
+				Status: OONITCPConnectStatus{Failure: failure, Success: failure == nil},
+				T:      t,
+				Tags:   tags,
+			})
+			event.Operation = "connect"
+		default:
+			m.TestKeys.TLSHandshakes = append(m.TestKeys.TLSHandshakes, OONITLSHandshake{
+				Address:     probe.Address,
+				Failure:     failure,
+				NoTLSVerify: probe.SNI == "",
+				ServerName:  probe.SNI,
+				T:           t,
+				Tags:        tags,
+			})
+			event.Operation = "tls_handshake_done"
+		}
+		m.TestKeys.NetworkEvents = append(m.TestKeys.NetworkEvents, event)
+	}
+	return m
+}
+
+func ooniAnswers(ips []netip.Addr) []OONIDNSAnswer {
+	answers := make([]OONIDNSAnswer, 0, len(ips))
+	for _, ip := range ips {
+		if ip.Is4() {
+			answers = append(answers, OONIDNSAnswer{AnswerType: "A", IPv4: ip.String()})
+		} else {
+			answers = append(answers, OONIDNSAnswer{AnswerType: "AAAA", IPv6: ip.String()})
+		}
+	}
+	return answers
+}
+
+func splitOONIAddress(address string) (string, int) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return address, 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+// OONIFailure returns the OONI failure string (df-007) for the connectivity error, or nil if the error is nil.
+// Errors without an OONI equivalent are reported as "unknown_failure: " followed by the innermost error message.
+func OONIFailure(err *ConnectivityError) *string {
+	if err == nil {
+		return nil
+	}
+	failure := ooniFailureString(err)
+	return &failure
+}
+
+func ooniFailureString(err *ConnectivityError) string {
+	switch err.PosixError {
+	case "ECONNREFUSED":
+		return "connection_refused"
+	case "ECONNRESET":
+		return "connection_reset"
+	case "ECONNABORTED":
+		return "connection_aborted"
+	case "ETIMEDOUT":
+		return "generic_timeout_error"
+	case "EHOSTUNREACH":
+		return "host_unreachable"
+	case "ENETUNREACH":
+		return "network_unreachable"
+	}
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var certErr x509.CertificateInvalidError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err.Err, errNoAddresses):
+		return "dns_no_answer"
+	case errors.As(err.Err, &dnsErr) && dnsErr.IsNotFound:
+		return "dns_nxdomain_error"
+	case errors.As(err.Err, &hostnameErr):
+		return "ssl_invalid_hostname"
+	case errors.As(err.Err, &authorityErr):
+		return "ssl_unknown_authority"
+	case errors.As(err.Err, &certErr):
+		return "ssl_invalid_certificate"
+	case errors.Is(err.Err, io.EOF), errors.Is(err.Err, io.ErrUnexpectedEOF):
+		return "eof_error"
+	}
+	if err.Op == "tls" {
+		return "ssl_failed_handshake"
+	}
+	innermost := err.Err
+	for {
+		unwrapped := errors.Unwrap(innermost)
+		if unwrapped == nil {
+			break
+		}
+		innermost = unwrapped
+	}
+	if innermost == nil {
+		return "unknown_failure"
+	}
+	return "unknown_failure: " + innermost.Error()
+}
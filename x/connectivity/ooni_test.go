@@ -0,0 +1,149 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/netip"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOONIFailure(t *testing.T) {
+	require.Nil(t, OONIFailure(nil))
+	for _, tc := range []struct {
+		err      *ConnectivityError
+		expected string
+	}{
+		{makeConnectivityError("connect", syscall.ECONNREFUSED), "connection_refused"},
+		{makeConnectivityError("receive", syscall.ECONNRESET), "connection_reset"},
+		{&ConnectivityError{Op: "connect", PosixError: "ETIMEDOUT", Err: errors.New("i/o timeout")}, "generic_timeout_error"},
+		{makeConnectivityError("resolve", errNoAddresses), "dns_no_answer"},
+		{makeConnectivityError("receive", io.ErrUnexpectedEOF), "eof_error"},
+		{makeConnectivityError("tls", errors.New("bad record")), "ssl_failed_handshake"},
+		{makeConnectivityError("send", errors.New("outer: inner")), "unknown_failure: outer: inner"},
+	} {
+		failure := OONIFailure(tc.err)
+		require.NotNil(t, failure)
+		require.Equal(t, tc.expected, *failure)
+	}
+}
+
+func TestNewOONIResolverMeasurement(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := NewOONIResolverMeasurement(&OONIProbeInfo{
+		SoftwareName:    "test-connectivity",
+		SoftwareVersion: "1.0",
+		ProbeASN:        13335,
+		ProbeCC:         "br",
+		Annotations:     map[string]string{"transport": "split:2"},
+	}, &ResolverTest{
+		Domain:          "example.com.",
+		ResolverAddress: "8.8.8.8:53",
+		Proto:           "tcp",
+		StartTime:       start,
+		Duration:        1500 * time.Millisecond,
+		Result:          makeConnectivityError("connect", syscall.ECONNREFUSED),
+	})
+	require.False(t, m.IsSuccess())
+
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, "0.2.0", decoded["data_format_version"])
+	require.Equal(t, "2025-01-02 03:04:05", decoded["measurement_start_time"])
+	require.Equal(t, "AS13335", decoded["probe_asn"])
+	require.Equal(t, "BR", decoded["probe_cc"])
+	require.Equal(t, "example.com.", decoded["input"])
+	require.Equal(t, 1.5, decoded["test_runtime"])
+	require.Equal(t, map[string]any{"transport": "split:2", "resolver_proto": "tcp"}, decoded["annotations"])
+	testKeys := decoded["test_keys"].(map[string]any)
+	require.Equal(t, "connection_refused", testKeys["failure"])
+	require.Equal(t, []any{map[string]any{
+		"answers":          []any{},
+		"engine":           "tcp",
+		"failure":          "connection_refused",
+		"hostname":         "example.com.",
+		"query_type":       "A",
+		"resolver_address": "8.8.8.8:53",
+		"t":                1.5,
+	}}, testKeys["queries"])
+	require.Equal(t, []any{map[string]any{
+		"address":   "8.8.8.8:53",
+		"failure":   "connection_refused",
+		"operation": "connect",
+		"proto":     "tcp",
+		"t":         1.5,
+	}}, testKeys["network_events"])
+	require.Equal(t, []any{}, testKeys["tcp_connect"])
+}
+
+func TestNewOONIBisectMeasurement(t *testing.T) {
+	diagnosis := &Diagnosis{
+		Domain:    "blocked.example",
+		Cause:     CauseSNI,
+		DirectIPs: []netip.Addr{netip.MustParseAddr("192.0.2.1")},
+		Probes: []ProbeResult{
+			{Name: "direct-dns", Address: "blocked.example.", Duration: time.Second},
+			{Name: "direct-tls", Address: "192.0.2.1:443", SNI: "blocked.example", Duration: time.Second,
+				Error: makeConnectivityError("tls", syscall.ECONNRESET)},
+			{Name: "direct-tcp", Address: "192.0.2.1:443", Duration: time.Second},
+			{Name: "direct-tls-control", Address: "192.0.2.1:443", Duration: time.Second},
+		},
+	}
+	m := NewOONIBisectMeasurement(nil, diagnosis, time.Now())
+	require.Equal(t, OONIBisectTestName, m.TestName)
+	require.Equal(t, "ZZ", m.ProbeCC)
+	require.Equal(t, 4.0, m.TestRuntime)
+	require.False(t, m.IsSuccess())
+	require.Equal(t, "sni_interference", *m.TestKeys.Failure)
+	require.Equal(t, CauseSNI, m.TestKeys.Cause)
+
+	require.Equal(t, []OONIDNSQuery{{
+		Answers:   []OONIDNSAnswer{{AnswerType: "A", IPv4: "192.0.2.1"}},
+		Hostname:  "blocked.example.",
+		QueryType: "A",
+		T:         1,
+		Tags:      []string{"direct-dns"},
+	}}, m.TestKeys.Queries)
+	require.Equal(t, []OONITCPConnect{{
+		IP:     "192.0.2.1",
+		Port:   443,
+		Status: OONITCPConnectStatus{Success: true},
+		T:      3,
+		Tags:   []string{"direct-tcp"},
+	}}, m.TestKeys.TCPConnect)
+	require.Len(t, m.TestKeys.TLSHandshakes, 2)
+	require.Equal(t, "connection_reset", *m.TestKeys.TLSHandshakes[0].Failure)
+	require.Equal(t, "blocked.example", m.TestKeys.TLSHandshakes[0].ServerName)
+	require.False(t, m.TestKeys.TLSHandshakes[0].NoTLSVerify)
+	require.Nil(t, m.TestKeys.TLSHandshakes[1].Failure)
+	require.True(t, m.TestKeys.TLSHandshakes[1].NoTLSVerify)
+
+	operations := []string{}
+	for _, event := range m.TestKeys.NetworkEvents {
+		operations = append(operations, event.Operation)
+	}
+	require.Equal(t, []string{"resolve_done", "tls_handshake_done", "connect", "tls_handshake_done"}, operations)
+
+	success := NewOONIBisectMeasurement(nil, &Diagnosis{Domain: "example.com", Cause: CauseNone}, time.Now())
+	require.True(t, success.IsSuccess())
+}
@@ -0,0 +1,193 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	defaultScheduleInterval = 15 * time.Minute
+	defaultMaxBackoffFactor = 8
+	defaultScheduleTimeout  = 10 * time.Second
+)
+
+// ScheduledTest is a named test of the suite run by a [Scheduler].
+type ScheduledTest struct {
+	// Name identifies the test in the [TestRecord].
+	Name string
+	// Test runs the test. Like [TestConnectivityWithResolver], it returns (nil, nil) if there's connectivity,
+	// (*ConnectivityError, nil) if there isn't, and (nil, error) if the test is invalid.
+	Test func(ctx context.Context) (*ConnectivityError, error)
+}
+
+// Scheduler runs a suite of connectivity tests periodically in the background, and stores the results in
+// a [HistoryStore].
+//
+// After a round with failures, the interval doubles on each consecutive failed round, up to MaxInterval, so
+// the tests don't drain the battery or the data plan while the network is down. A network change reported by
+// the Monitor resets the backoff and runs the suite right away.
+type Scheduler struct {
+	// Tests is the suite to run. The tests of a round run sequentially, in order.
+	Tests []ScheduledTest
+	// Store receives the test records. It must not be nil.
+	Store *HistoryStore
+	// Interval is the time between rounds. If zero, 15 minutes is used.
+	Interval time.Duration
+	// MaxInterval caps the interval after failed rounds. If zero, 8 times the Interval is used.
+	MaxInterval time.Duration
+	// Timeout limits each test. If zero, 10 seconds is used.
+	Timeout time.Duration
+	// Monitor, if not nil, triggers a round when the network changes.
+	Monitor *NetworkMonitor
+	// NetworkType returns the type of the current network, like "wifi" or "cellular", to label the records
+	// and select the interval. If nil, the network type is empty.
+	NetworkType func() string
+	// NetworkIntervals overrides the Interval for the given network types. A negative interval disables the
+	// tests on that network type, for instance to save data on cellular networks.
+	NetworkIntervals map[string]time.Duration
+}
+
+// RunOnce runs the suite once on the current network, adds the records to the store and returns them.
+// It returns nil if the tests are disabled on the current network type.
+func (s *Scheduler) RunOnce(ctx context.Context) []TestRecord {
+	network := s.networkType()
+	if s.interval(network) < 0 {
+		return nil
+	}
+	return s.runRound(ctx, network)
+}
+
+// Run runs the suite periodically until the context is done, then returns the context error.
+// The first round runs right away.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if s.Store == nil {
+		return errors.New("argument Store must not be nil")
+	}
+	changes := make(chan struct{}, 1)
+	if s.Monitor != nil {
+		subscription := s.Monitor.Subscribe(NetworkChangeFunc(func() {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}))
+		defer subscription.Cancel()
+	}
+
+	failedRounds := 0
+	for {
+		network := s.networkType()
+		interval := s.interval(network)
+		if interval >= 0 {
+			if roundFailed(s.runRound(ctx, network)) {
+				failedRounds++
+			} else {
+				failedRounds = 0
+			}
+			interval = s.backoff(interval, failedRounds)
+		} else {
+			// Tests are disabled on this network. Check again later, in case the network type changes
+			// without a notification.
+			interval = s.baseInterval()
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changes:
+			timer.Stop()
+			failedRounds = 0
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Scheduler) networkType() string {
+	if s.NetworkType == nil {
+		return ""
+	}
+	return s.NetworkType()
+}
+
+// interval returns the base interval for the network type.
+func (s *Scheduler) interval(network string) time.Duration {
+	if interval, ok := s.NetworkIntervals[network]; ok && interval != 0 {
+		return interval
+	}
+	return s.baseInterval()
+}
+
+func (s *Scheduler) baseInterval() time.Duration {
+	if s.Interval > 0 {
+		return s.Interval
+	}
+	return defaultScheduleInterval
+}
+
+// backoff returns the interval after the given number of consecutive failed rounds.
+func (s *Scheduler) backoff(interval time.Duration, failedRounds int) time.Duration {
+	maxInterval := s.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultMaxBackoffFactor * interval
+	}
+	for i := 0; i < failedRounds && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
+
+func (s *Scheduler) runRound(ctx context.Context, network string) []TestRecord {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultScheduleTimeout
+	}
+	records := make([]TestRecord, 0, len(s.Tests))
+	for _, test := range s.Tests {
+		if ctx.Err() != nil {
+			break
+		}
+		testCtx, cancel := context.WithTimeout(ctx, timeout)
+		record := TestRecord{Name: test.Name, Network: network, Time: time.Now()}
+		record.Result, record.Err = test.Test(testCtx)
+		record.Duration = time.Since(record.Time)
+		cancel()
+		if ctx.Err() != nil {
+			// Don't record tests interrupted by the caller.
+			break
+		}
+		if s.Store != nil {
+			s.Store.Add(record)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func roundFailed(records []TestRecord) bool {
+	for i := range records {
+		if !records[i].OK() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_RunOnce(t *testing.T) {
+	store := NewHistoryStore(10)
+	s := &Scheduler{
+		Tests: []ScheduledTest{
+			{Name: "ok", Test: func(context.Context) (*ConnectivityError, error) { return nil, nil }},
+			{Name: "blocked", Test: func(context.Context) (*ConnectivityError, error) {
+				return makeConnectivityError("connect", errors.New("refused")), nil
+			}},
+			{Name: "invalid", Test: func(context.Context) (*ConnectivityError, error) { return nil, errors.New("bad test") }},
+		},
+		Store:       store,
+		NetworkType: func() string { return "wifi" },
+	}
+	records := s.RunOnce(context.Background())
+	require.Len(t, records, 3)
+	require.True(t, records[0].OK())
+	require.Equal(t, "connect", records[1].Result.Op)
+	require.Error(t, records[2].Err)
+	for _, record := range records {
+		require.Equal(t, "wifi", record.Network)
+	}
+	require.Equal(t, records, store.Query(time.Time{}))
+}
+
+func TestScheduler_RunOnceDisabledNetwork(t *testing.T) {
+	var calls atomic.Int32
+	s := &Scheduler{
+		Tests:            []ScheduledTest{{Name: "ok", Test: countingTest(&calls, nil)}},
+		Store:            NewHistoryStore(10),
+		NetworkType:      func() string { return "cellular" },
+		NetworkIntervals: map[string]time.Duration{"cellular": -1},
+	}
+	require.Nil(t, s.RunOnce(context.Background()))
+	require.Equal(t, int32(0), calls.Load())
+	require.Equal(t, 0, s.Store.Len())
+}
+
+func TestScheduler_Timeout(t *testing.T) {
+	s := &Scheduler{
+		Tests: []ScheduledTest{{Name: "slow", Test: func(ctx context.Context) (*ConnectivityError, error) {
+			<-ctx.Done()
+			return makeConnectivityError("connect", ctx.Err()), nil
+		}}},
+		Store:   NewHistoryStore(10),
+		Timeout: 10 * time.Millisecond,
+	}
+	records := s.RunOnce(context.Background())
+	require.Len(t, records, 1)
+	require.Equal(t, "ETIMEDOUT", records[0].Result.PosixError)
+}
+
+func TestScheduler_Backoff(t *testing.T) {
+	s := &Scheduler{Interval: time.Minute}
+	require.Equal(t, time.Minute, s.backoff(time.Minute, 0))
+	require.Equal(t, 2*time.Minute, s.backoff(time.Minute, 1))
+	require.Equal(t, 4*time.Minute, s.backoff(time.Minute, 2))
+	require.Equal(t, 8*time.Minute, s.backoff(time.Minute, 10))
+
+	s.MaxInterval = 3 * time.Minute
+	require.Equal(t, 3*time.Minute, s.backoff(time.Minute, 10))
+}
+
+func TestScheduler_RunPeriodically(t *testing.T) {
+	var calls atomic.Int32
+	s := &Scheduler{
+		Tests:    []ScheduledTest{{Name: "ok", Test: countingTest(&calls, nil)}},
+		Store:    NewHistoryStore(100),
+		Interval: 5 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	require.Eventually(t, func() bool { return calls.Load() >= 3 }, 5*time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.GreaterOrEqual(t, s.Store.Len(), 3)
+}
+
+func TestScheduler_RunsOnNetworkChange(t *testing.T) {
+	m := newNetworkMonitor(func() (string, error) { return "", nil })
+	var calls atomic.Int32
+	s := &Scheduler{
+		Tests:    []ScheduledTest{{Name: "blocked", Test: countingTest(&calls, makeConnectivityError("connect", errors.New("refused")))}},
+		Store:    NewHistoryStore(10),
+		Interval: time.Hour,
+		Monitor:  m,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 5*time.Second, time.Millisecond)
+
+	m.notify()
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, 5*time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestScheduler_RunRequiresStore(t *testing.T) {
+	require.Error(t, (&Scheduler{}).Run(context.Background()))
+}
+
+/********** Test Utilities **********/
+
+func countingTest(calls *atomic.Int32, result *ConnectivityError) func(context.Context) (*ConnectivityError, error) {
+	return func(context.Context) (*ConnectivityError, error) {
+		calls.Add(1)
+		return result, nil
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnstest
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var testZone = Zone{
+	Origin: "example.com",
+	Records: []dnsmessage.Resource{
+		NewRecord("example.com.", 3600, &dnsmessage.SOAResource{
+			NS:     dnsmessage.MustNewName("ns.example.com."),
+			MBox:   dnsmessage.MustNewName("admin.example.com."),
+			MinTTL: 300,
+		}),
+		NewRecord("WWW.example.com.", 300, &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}),
+		NewRecord("www.example.com.", 300, &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr("2001:db8::1").As16()}),
+		NewRecord("alias.example.com.", 300, &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("www.example.com.")}),
+		NewRecord("a.b.example.com.", 300, &dnsmessage.TXTResource{TXT: []string{"deep"}}),
+	},
+}
+
+func TestServer_Answer(t *testing.T) {
+	server := startServer(t, Config{Zones: []Zone{testZone}})
+	for name, resolver := range map[string]dns.Resolver{
+		"UDP": dns.NewUDPResolver(&transport.UDPDialer{}, server.Addr()),
+		"TCP": dns.NewTCPResolver(&transport.TCPDialer{}, server.Addr()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			msg := query(t, resolver, "www.example.com.", dnsmessage.TypeA)
+			require.True(t, msg.Authoritative)
+			require.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+			require.Len(t, msg.Answers, 1)
+			require.Equal(t, [4]byte{192, 0, 2, 1}, msg.Answers[0].Body.(*dnsmessage.AResource).A)
+
+			msg = query(t, resolver, "www.EXAMPLE.com.", dnsmessage.TypeAAAA)
+			require.Len(t, msg.Answers, 1)
+			require.Equal(t, netip.MustParseAddr("2001:db8::1").As16(), msg.Answers[0].Body.(*dnsmessage.AAAAResource).AAAA)
+		})
+	}
+}
+
+func TestServer_CNAME(t *testing.T) {
+	server := startServer(t, Config{Zones: []Zone{testZone}})
+	resolver := dns.NewUDPResolver(&transport.UDPDialer{}, server.Addr())
+
+	msg := query(t, resolver, "alias.example.com.", dnsmessage.TypeA)
+	require.Len(t, msg.Answers, 2)
+	require.Equal(t, dnsmessage.TypeCNAME, msg.Answers[0].Header.Type)
+	require.Equal(t, dnsmessage.TypeA, msg.Answers[1].Header.Type)
+
+	msg = query(t, resolver, "alias.example.com.", dnsmessage.TypeCNAME)
+	require.Len(t, msg.Answers, 1)
+	require.Equal(t, dnsmessage.TypeCNAME, msg.Answers[0].Header.Type)
+}
+
+func TestServer_NegativeAnswers(t *testing.T) {
+	server := startServer(t, Config{Zones: []Zone{testZone}})
+	resolver := dns.NewUDPResolver(&transport.UDPDialer{}, server.Addr())
+
+	// The name doesn't exist.
+	msg := query(t, resolver, "missing.example.com.", dnsmessage.TypeA)
+	require.Equal(t, dnsmessage.RCodeNameError, msg.RCode)
+	require.Empty(t, msg.Answers)
+	require.Len(t, msg.Authorities, 1)
+	require.Equal(t, dnsmessage.TypeSOA, msg.Authorities[0].Header.Type)
+
+	// The name exists without records of the type.
+	msg = query(t, resolver, "www.example.com.", dnsmessage.TypeTXT)
+	require.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+	require.Empty(t, msg.Answers)
+	require.Len(t, msg.Authorities, 1)
+
+	// The name exists because a descendant has records.
+	msg = query(t, resolver, "b.example.com.", dnsmessage.TypeTXT)
+	require.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+	require.Empty(t, msg.Answers)
+
+	// The server is not authoritative for the name.
+	msg = query(t, resolver, "example.org.", dnsmessage.TypeA)
+	require.Equal(t, dnsmessage.RCodeRefused, msg.RCode)
+	require.False(t, msg.Authoritative)
+
+	require.Len(t, server.Queries(), 4)
+	require.Equal(t, "example.org.", server.Queries()[3].Name.String())
+}
+
+func TestServer_RcodeRules(t *testing.T) {
+	server := startServer(t, Config{
+		Zones: []Zone{testZone},
+		Rules: []Rule{
+			{Name: "www.example.com", Type: dnsmessage.TypeAAAA, Action: ServFail},
+			{Name: "www.example.com", Action: NXDomain},
+			{Name: "example.com", Action: Refuse},
+		},
+	})
+	resolver := dns.NewUDPResolver(&transport.UDPDialer{}, server.Addr())
+	require.Equal(t, dnsmessage.RCodeServerFailure, query(t, resolver, "www.example.com.", dnsmessage.TypeAAAA).RCode)
+	require.Equal(t, dnsmessage.RCodeNameError, query(t, resolver, "www.example.com.", dnsmessage.TypeA).RCode)
+	require.Equal(t, dnsmessage.RCodeRefused, query(t, resolver, "alias.example.com.", dnsmessage.TypeA).RCode)
+}
+
+func TestServer_Poison(t *testing.T) {
+	// A captive portal resolves all the names to itself.
+	portal := netip.MustParseAddr("10.0.0.1")
+	server := startServer(t, Config{Rules: []Rule{{Action: Poison, Addrs: []netip.Addr{portal}}}})
+	resolver := dns.NewTCPResolver(&transport.TCPDialer{}, server.Addr())
+
+	msg := query(t, resolver, "anything.example.org.", dnsmessage.TypeA)
+	require.Len(t, msg.Answers, 1)
+	require.Equal(t, uint32(PoisonTTL), msg.Answers[0].Header.TTL)
+	require.Equal(t, portal.As4(), msg.Answers[0].Body.(*dnsmessage.AResource).A)
+
+	msg = query(t, resolver, "anything.example.org.", dnsmessage.TypeAAAA)
+	require.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+	require.Empty(t, msg.Answers)
+}
+
+func TestServer_Inject(t *testing.T) {
+	server := startServer(t, Config{
+		Zones: []Zone{testZone},
+		Rules: []Rule{{Name: "www.example.com", Action: Inject, Addrs: []netip.Addr{netip.MustParseAddr("10.10.10.10")}}},
+		Delay: 10 * time.Millisecond,
+	})
+
+	// Over UDP, the forged response comes first, followed by the correct one.
+	responses := exchangeUDP(t, server.Addr(), "www.example.com.", 2)
+	require.Equal(t, [4]byte{10, 10, 10, 10}, responses[0].Answers[0].Body.(*dnsmessage.AResource).A)
+	require.Equal(t, [4]byte{192, 0, 2, 1}, responses[1].Answers[0].Body.(*dnsmessage.AResource).A)
+
+	// Over TCP, the connection is closed.
+	resolver := dns.NewTCPResolver(&transport.TCPDialer{}, server.Addr())
+	q, err := dns.NewQuestion("www.example.com.", dnsmessage.TypeA)
+	require.NoError(t, err)
+	_, err = resolver.Query(context.Background(), *q)
+	require.Error(t, err)
+}
+
+func TestServer_Truncate(t *testing.T) {
+	server := startServer(t, Config{Zones: []Zone{testZone}, Rules: []Rule{{Action: Truncate}}})
+
+	responses := exchangeUDP(t, server.Addr(), "www.example.com.", 1)
+	require.True(t, responses[0].Truncated)
+	require.Empty(t, responses[0].Answers)
+
+	resolver := dns.NewTCPResolver(&transport.TCPDialer{}, server.Addr())
+	msg := query(t, resolver, "www.example.com.", dnsmessage.TypeA)
+	require.False(t, msg.Truncated)
+	require.Len(t, msg.Answers, 1)
+}
+
+func TestServer_LargeResponse(t *testing.T) {
+	zone := Zone{Origin: "example.com."}
+	for i := 0; i < 40; i++ {
+		zone.Records = append(zone.Records, NewRecord("www.example.com.", 300, &dnsmessage.AResource{A: [4]byte{192, 0, 2, byte(i)}}))
+	}
+	server := startServer(t, Config{Zones: []Zone{zone}})
+
+	responses := exchangeUDP(t, server.Addr(), "www.example.com.", 1)
+	require.True(t, responses[0].Truncated)
+
+	resolver := dns.NewTCPResolver(&transport.TCPDialer{}, server.Addr())
+	require.Len(t, query(t, resolver, "www.example.com.", dnsmessage.TypeA).Answers, 40)
+}
+
+func TestServer_DropAndSlow(t *testing.T) {
+	server := startServer(t, Config{
+		Zones: []Zone{testZone},
+		Rules: []Rule{
+			{Name: "www.example.com", Action: Drop},
+			{Name: "alias.example.com", Action: Slow},
+		},
+		Delay: 50 * time.Millisecond,
+	})
+	resolver := dns.NewUDPResolver(&transport.UDPDialer{}, server.Addr())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	q, err := dns.NewQuestion("www.example.com.", dnsmessage.TypeA)
+	require.NoError(t, err)
+	_, err = resolver.Query(ctx, *q)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	start := time.Now()
+	msg := query(t, resolver, "alias.example.com.", dnsmessage.TypeA)
+	require.Len(t, msg.Answers, 2)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestNewServer_InvalidZone(t *testing.T) {
+	_, err := NewServer(Config{Zones: []Zone{{
+		Origin:  "example.com.",
+		Records: []dnsmessage.Resource{NewRecord("www.example.org.", 300, &dnsmessage.AResource{})},
+	}}})
+	require.Error(t, err)
+}
+
+func TestAction_String(t *testing.T) {
+	require.Equal(t, "Inject", Inject.String())
+	require.Equal(t, "Action(100)", Action(100).String())
+}
+
+/********** Test Utilities **********/
+
+func startServer(t *testing.T, config Config) *Server {
+	server, err := NewServer(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func query(t *testing.T, resolver dns.Resolver, name string, qtype dnsmessage.Type) *dnsmessage.Message {
+	q, err := dns.NewQuestion(name, qtype)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := resolver.Query(ctx, *q)
+	require.NoError(t, err)
+	return msg
+}
+
+// exchangeUDP sends an A query for the name and returns the given number of responses.
+func exchangeUDP(t *testing.T, addr string, name string, count int) []*dnsmessage.Message {
+	conn, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	q, err := dns.NewQuestion(name, dnsmessage.TypeA)
+	require.NoError(t, err)
+	request, err := (&dnsmessage.Message{Header: dnsmessage.Header{ID: 1}, Questions: []dnsmessage.Question{*q}}).Pack()
+	require.NoError(t, err)
+	_, err = conn.Write(request)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var responses []*dnsmessage.Message
+	buf := make([]byte, maxMessageSize)
+	for len(responses) < count {
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		msg := new(dnsmessage.Message)
+		require.NoError(t, msg.Unpack(buf[:n]))
+		require.Equal(t, uint16(1), msg.ID)
+		responses = append(responses, msg)
+	}
+	return responses
+}
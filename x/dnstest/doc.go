@@ -0,0 +1,41 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package dnstest provides a local authoritative DNS server for tests, with tampering rules, so applications can test
+how they handle DNS censorship, captive portals and misbehaving resolvers.
+
+The server answers queries over UDP and TCP on the same port from the configured zones, unless a [Rule] says otherwise:
+
+	server, err := dnstest.NewServer(dnstest.Config{
+		Zones: []dnstest.Zone{{
+			Origin: "example.com.",
+			Records: []dnsmessage.Resource{
+				dnstest.NewRecord("www.example.com.", 300, &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}),
+			},
+		}},
+		Rules: []dnstest.Rule{{Name: "blocked.example.com.", Action: dnstest.Inject, Addrs: []netip.Addr{netip.MustParseAddr("10.10.10.10")}}},
+	})
+	if err != nil {
+		// handle error
+	}
+	defer server.Close()
+	resolver := dns.NewUDPResolver(&transport.UDPDialer{}, server.Addr())
+
+Captive portals, which resolve every name to the portal, can be simulated with a [Poison] rule without a name.
+
+The server listens on the loopback interface by default. Set [Config.Address] to make it reachable by other
+devices, like a phone under QA that uses it as its resolver.
+*/
+package dnstest
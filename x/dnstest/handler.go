@@ -0,0 +1,255 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnstest
+
+import (
+	"fmt"
+	"net/netip"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// maxMessageSize is the maximum size of a DNS message.
+	maxMessageSize = 65535
+	// minUDPSize is the maximum size of UDP responses to queries without EDNS(0).
+	// See https://datatracker.ietf.org/doc/html/rfc1035#section-2.3.4.
+	minUDPSize = 512
+	// maxCNAMEChain is the maximum number of CNAME records the server follows in a response.
+	maxCNAMEChain = 8
+)
+
+// zone is a [Zone] indexed for lookups.
+type zone struct {
+	origin string
+	// records are the records by canonical name.
+	records map[string][]dnsmessage.Resource
+	// names are the names that exist in the zone, including the ones without records but with descendants that
+	// have records.
+	names map[string]bool
+	soa   *dnsmessage.Resource
+}
+
+func newZone(config Zone) (*zone, error) {
+	z := &zone{
+		origin:  canonicalName(config.Origin),
+		records: make(map[string][]dnsmessage.Resource),
+		names:   make(map[string]bool),
+	}
+	z.names[z.origin] = true
+	for _, record := range config.Records {
+		if record.Body == nil {
+			return nil, fmt.Errorf("record %v has no body", record.Header.Name)
+		}
+		if record.Header.Type == 0 {
+			return nil, fmt.Errorf("record %v has no type", record.Header.Name)
+		}
+		name := canonicalName(record.Header.Name.String())
+		if !inDomain(name, z.origin) {
+			return nil, fmt.Errorf("record %v is outside the zone", name)
+		}
+		z.records[name] = append(z.records[name], record)
+		if record.Header.Type == dnsmessage.TypeSOA && z.soa == nil {
+			z.soa = &z.records[name][len(z.records[name])-1]
+		}
+		for ; name != z.origin; name = parentName(name) {
+			z.names[name] = true
+		}
+	}
+	return z, nil
+}
+
+// parentName returns the parent of the canonical name, which must not be the root.
+func parentName(name string) string {
+	for i := 0; i < len(name)-1; i++ {
+		if name[i] == '.' {
+			return name[i+1:]
+		}
+	}
+	return "."
+}
+
+// findZone returns the most specific zone for the canonical name, or nil if the server is not authoritative for it.
+func (s *Server) findZone(name string) *zone {
+	var found *zone
+	for _, z := range s.zones {
+		if inDomain(name, z.origin) && (found == nil || len(z.origin) > len(found.origin)) {
+			found = z
+		}
+	}
+	return found
+}
+
+// findRule returns the first rule that matches the question, or nil if there's none.
+func (s *Server) findRule(q dnsmessage.Question) *Rule {
+	name := canonicalName(q.Name.String())
+	for i := range s.config.Rules {
+		rule := &s.config.Rules[i]
+		if inDomain(name, canonicalName(rule.Name)) && (rule.Type == 0 || rule.Type == q.Type) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// handle returns the parsed query and the responses to send. Nil responses mean the query is not answered and
+// stream connections must be closed, while empty ones mean the query is silently ignored. The parsed query is nil
+// if the packet is not a valid query.
+func (s *Server) handle(packet []byte, stream bool) (*dnsmessage.Message, []response) {
+	query := new(dnsmessage.Message)
+	if err := query.Unpack(packet); err != nil || query.Response {
+		return nil, nil
+	}
+	header := dnsmessage.Header{
+		ID:               query.ID,
+		Response:         true,
+		OpCode:           query.OpCode,
+		RecursionDesired: query.RecursionDesired,
+	}
+	if len(query.Questions) != 1 {
+		header.RCode = dnsmessage.RCodeFormatError
+		return query, []response{{msg: &dnsmessage.Message{Header: header, Questions: query.Questions}}}
+	}
+	if query.OpCode != 0 {
+		header.RCode = dnsmessage.RCodeNotImplemented
+		return query, []response{{msg: &dnsmessage.Message{Header: header, Questions: query.Questions}}}
+	}
+	q := query.Questions[0]
+	s.mu.Lock()
+	s.queries = append(s.queries, q)
+	s.mu.Unlock()
+
+	rule := s.findRule(q)
+	if rule == nil {
+		return query, []response{{msg: s.answer(header, q)}}
+	}
+	switch rule.Action {
+	case Drop:
+		return query, []response{}
+	case NXDomain:
+		return query, []response{{msg: rcodeMessage(header, q, dnsmessage.RCodeNameError)}}
+	case Refuse:
+		return query, []response{{msg: rcodeMessage(header, q, dnsmessage.RCodeRefused)}}
+	case ServFail:
+		return query, []response{{msg: rcodeMessage(header, q, dnsmessage.RCodeServerFailure)}}
+	case Poison:
+		return query, []response{{msg: poisonedMessage(header, q, rule.Addrs)}}
+	case Inject:
+		if stream {
+			return query, nil
+		}
+		return query, []response{
+			{msg: poisonedMessage(header, q, rule.Addrs)},
+			{delay: s.config.Delay, msg: s.answer(header, q)},
+		}
+	case Truncate:
+		if stream {
+			return query, []response{{msg: s.answer(header, q)}}
+		}
+		header.Truncated = true
+		return query, []response{{msg: &dnsmessage.Message{Header: header, Questions: query.Questions}}}
+	case Slow:
+		return query, []response{{delay: s.config.Delay, msg: s.answer(header, q)}}
+	default:
+		return query, []response{{msg: s.answer(header, q)}}
+	}
+}
+
+// answer returns the authoritative response to the question from the zones, following CNAME records within them.
+func (s *Server) answer(header dnsmessage.Header, q dnsmessage.Question) *dnsmessage.Message {
+	msg := &dnsmessage.Message{Header: header, Questions: []dnsmessage.Question{q}}
+	name := canonicalName(q.Name.String())
+	z := s.findZone(name)
+	if z == nil {
+		msg.RCode = dnsmessage.RCodeRefused
+		return msg
+	}
+	msg.Authoritative = true
+	for i := 0; i <= maxCNAMEChain; i++ {
+		var cname *dnsmessage.Resource
+		found := false
+		for j, record := range z.records[name] {
+			if record.Header.Type == q.Type || q.Type == dnsmessage.TypeALL {
+				msg.Answers = append(msg.Answers, record)
+				found = true
+			} else if record.Header.Type == dnsmessage.TypeCNAME {
+				cname = &z.records[name][j]
+			}
+		}
+		if found {
+			return msg
+		}
+		if cname == nil || i == maxCNAMEChain {
+			if !z.names[name] {
+				msg.RCode = dnsmessage.RCodeNameError
+			}
+			if z.soa != nil {
+				msg.Authorities = append(msg.Authorities, *z.soa)
+			}
+			return msg
+		}
+		msg.Answers = append(msg.Answers, *cname)
+		name = canonicalName(cname.Body.(*dnsmessage.CNAMEResource).CNAME.String())
+		if z = s.findZone(name); z == nil {
+			// The client resolves the rest of the chain elsewhere.
+			return msg
+		}
+	}
+	return msg
+}
+
+func rcodeMessage(header dnsmessage.Header, q dnsmessage.Question, rcode dnsmessage.RCode) *dnsmessage.Message {
+	header.RCode = rcode
+	return &dnsmessage.Message{Header: header, Questions: []dnsmessage.Question{q}}
+}
+
+// poisonedMessage returns a response to the question with the addresses of its type.
+func poisonedMessage(header dnsmessage.Header, q dnsmessage.Question, addrs []netip.Addr) *dnsmessage.Message {
+	msg := &dnsmessage.Message{Header: header, Questions: []dnsmessage.Question{q}}
+	for _, addr := range addrs {
+		resourceHeader := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: PoisonTTL}
+		switch {
+		case q.Type == dnsmessage.TypeA && addr.Is4():
+			resourceHeader.Type = dnsmessage.TypeA
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: resourceHeader, Body: &dnsmessage.AResource{A: addr.As4()}})
+		case q.Type == dnsmessage.TypeAAAA && addr.Is6() && !addr.Is4In6():
+			resourceHeader.Type = dnsmessage.TypeAAAA
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: resourceHeader, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+		}
+	}
+	return msg
+}
+
+// udpSizeLimit returns the maximum size of a UDP response to the query, as advertised by its EDNS(0) record.
+func udpSizeLimit(query *dnsmessage.Message) int {
+	for _, record := range query.Additionals {
+		if record.Header.Type == dnsmessage.TypeOPT && int(record.Header.Class) > minUDPSize {
+			return int(record.Header.Class)
+		}
+	}
+	return minUDPSize
+}
+
+// packUDP packs the message for UDP. If it doesn't fit in the limit, it's sent without records and with the
+// truncated flag, so the client retries over TCP.
+func packUDP(msg *dnsmessage.Message, limit int) ([]byte, error) {
+	packed, err := msg.Pack()
+	if err != nil || len(packed) <= limit {
+		return packed, err
+	}
+	truncated := &dnsmessage.Message{Header: msg.Header, Questions: msg.Questions}
+	truncated.Truncated = true
+	return truncated.Pack()
+}
@@ -0,0 +1,388 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnstest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Action is how the server handles the queries that match a [Rule].
+type Action int
+
+const (
+	// Answer answers the query from the zones, like a correct server.
+	Answer Action = iota
+	// Drop ignores the query, so the client times out.
+	Drop
+	// NXDomain responds that the name doesn't exist, even if it does.
+	NXDomain
+	// Refuse responds with the Refused code.
+	Refuse
+	// ServFail responds with the Server Failure code.
+	ServFail
+	// Poison answers A and AAAA queries with the [Rule.Addrs] of their family instead of the zone records.
+	// Queries of other types get an empty answer.
+	Poison
+	// Inject simulates an on-path injector. Over UDP, it sends a response like [Poison] right away, and the correct
+	// one after [Config.Delay]. Over TCP, it closes the connection without responding, like a reset.
+	Inject
+	// Truncate responds over UDP with the truncated flag and no records, so clients retry over TCP, where the query
+	// is answered from the zones.
+	Truncate
+	// Slow answers the query from the zones after [Config.Delay].
+	Slow
+)
+
+// String returns the name of the action.
+func (a Action) String() string {
+	switch a {
+	case Answer:
+		return "Answer"
+	case Drop:
+		return "Drop"
+	case NXDomain:
+		return "NXDomain"
+	case Refuse:
+		return "Refuse"
+	case ServFail:
+		return "ServFail"
+	case Poison:
+		return "Poison"
+	case Inject:
+		return "Inject"
+	case Truncate:
+		return "Truncate"
+	case Slow:
+		return "Slow"
+	default:
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+}
+
+// DefaultDelay is the delay of [Inject] and [Slow] if [Config.Delay] is not set.
+const DefaultDelay = 100 * time.Millisecond
+
+// PoisonTTL is the TTL of the records of [Poison] and [Inject] responses.
+const PoisonTTL = 60
+
+// Zone is a DNS zone the server is authoritative for.
+type Zone struct {
+	// Origin is the name of the zone, like "example.com.".
+	Origin string
+	// Records are the resource records of the zone. Names that have no records and no descendants with records
+	// don't exist. Include a SOA record to have it in the negative responses.
+	Records []dnsmessage.Resource
+}
+
+// Rule makes the server tamper with the queries for a name.
+type Rule struct {
+	// Name is the domain the rule applies to, along with its subdomains. If empty, it applies to all the names.
+	Name string
+	// Type is the query type the rule applies to. If zero, it applies to all the types.
+	Type dnsmessage.Type
+	// Action is what the server does with the matching queries.
+	Action Action
+	// Addrs are the addresses of the [Poison] and [Inject] responses.
+	Addrs []netip.Addr
+}
+
+// Config configures a test DNS server.
+type Config struct {
+	// Address is the address to listen on, for both UDP and TCP. If empty, it's "127.0.0.1:0", a random port
+	// on the loopback interface.
+	Address string
+	// Zones are the zones the server is authoritative for. Queries for names outside them are refused.
+	Zones []Zone
+	// Rules are the tampering rules. The first rule that matches a query applies.
+	Rules []Rule
+	// Delay is how long [Inject] and [Slow] wait. If zero, [DefaultDelay] is used.
+	Delay time.Duration
+}
+
+// Server is a running test DNS server.
+type Server struct {
+	config     Config
+	zones      []*zone
+	packetConn net.PacketConn
+	listener   net.Listener
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	queries []dnsmessage.Question
+	wg      sync.WaitGroup
+}
+
+// NewRecord returns a resource record for the name, with the type of the body and the Internet class.
+func NewRecord(name string, ttl uint32, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(canonicalName(name)),
+			Type:  recordType(body),
+			Class: dnsmessage.ClassINET,
+			TTL:   ttl,
+		},
+		Body: body,
+	}
+}
+
+// recordType returns the type of the resource body, or zero if it's not known.
+func recordType(body dnsmessage.ResourceBody) dnsmessage.Type {
+	switch body.(type) {
+	case *dnsmessage.AResource:
+		return dnsmessage.TypeA
+	case *dnsmessage.AAAAResource:
+		return dnsmessage.TypeAAAA
+	case *dnsmessage.CNAMEResource:
+		return dnsmessage.TypeCNAME
+	case *dnsmessage.MXResource:
+		return dnsmessage.TypeMX
+	case *dnsmessage.NSResource:
+		return dnsmessage.TypeNS
+	case *dnsmessage.PTRResource:
+		return dnsmessage.TypePTR
+	case *dnsmessage.SOAResource:
+		return dnsmessage.TypeSOA
+	case *dnsmessage.SRVResource:
+		return dnsmessage.TypeSRV
+	case *dnsmessage.TXTResource:
+		return dnsmessage.TypeTXT
+	default:
+		return 0
+	}
+}
+
+// NewServer starts a DNS server that listens on UDP and TCP, on the same port.
+func NewServer(config Config) (*Server, error) {
+	if config.Address == "" {
+		config.Address = "127.0.0.1:0"
+	}
+	if config.Delay == 0 {
+		config.Delay = DefaultDelay
+	}
+	zones := make([]*zone, 0, len(config.Zones))
+	for _, zoneConfig := range config.Zones {
+		z, err := newZone(zoneConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zone %v: %w", zoneConfig.Origin, err)
+		}
+		zones = append(zones, z)
+	}
+	packetConn, listener, err := listen(config.Address)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		config:     config,
+		zones:      zones,
+		packetConn: packetConn,
+		listener:   listener,
+		ctx:        ctx,
+		cancel:     cancel,
+		conns:      make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(2)
+	go s.servePackets()
+	go s.serveStreams()
+	return s, nil
+}
+
+// listen listens on UDP and TCP on the same port. If the port is zero, it retries with other random ports in case
+// the TCP port is taken.
+func listen(address string) (net.PacketConn, net.Listener, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid address: %w", err)
+	}
+	for attempt := 0; ; attempt++ {
+		packetConn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to listen on UDP: %w", err)
+		}
+		boundPort := packetConn.LocalAddr().(*net.UDPAddr).Port
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, fmt.Sprint(boundPort)))
+		if err == nil {
+			return packetConn, listener, nil
+		}
+		packetConn.Close()
+		if port != "0" || attempt == 10 {
+			return nil, nil, fmt.Errorf("failed to listen on TCP: %w", err)
+		}
+	}
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.packetConn.LocalAddr().String()
+}
+
+// Queries returns the questions the server received so far, in order.
+func (s *Server) Queries() []dnsmessage.Question {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]dnsmessage.Question(nil), s.queries...)
+}
+
+// Close stops the server and closes all its connections.
+func (s *Server) Close() error {
+	s.cancel()
+	err := errors.Join(s.packetConn.Close(), s.listener.Close())
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// response is a DNS response to send after a delay.
+type response struct {
+	delay time.Duration
+	msg   *dnsmessage.Message
+}
+
+func (s *Server) servePackets() {
+	defer s.wg.Done()
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		query, responses := s.handle(buf[:n], false)
+		if len(responses) == 0 {
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for _, r := range responses {
+				if !s.delay(r.delay) {
+					return
+				}
+				packet, err := packUDP(r.msg, udpSizeLimit(query))
+				if err != nil {
+					continue
+				}
+				s.packetConn.WriteTo(packet, addr)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveStreams() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.ctx.Err() != nil {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			s.serveStream(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// serveStream answers the queries on the connection, in order, with the length-prefixed format of
+// https://datatracker.ietf.org/doc/html/rfc1035#section-4.2.2.
+func (s *Server) serveStream(conn net.Conn) {
+	var lengthBuf [2]byte
+	buf := make([]byte, maxMessageSize)
+	for {
+		if _, err := io.ReadFull(conn, lengthBuf[:]); err != nil {
+			return
+		}
+		query := buf[:binary.BigEndian.Uint16(lengthBuf[:])]
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		_, responses := s.handle(query, true)
+		if responses == nil {
+			// Reset the connection, since the query will not be answered.
+			return
+		}
+		for _, r := range responses {
+			if !s.delay(r.delay) {
+				return
+			}
+			packed, err := r.msg.Pack()
+			if err != nil {
+				return
+			}
+			out := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(packed)), uint16(len(packed)))
+			if _, err := conn.Write(append(out, packed...)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// delay waits for the given duration. It returns false if the server is closed in the meantime.
+func (s *Server) delay(d time.Duration) bool {
+	if d <= 0 {
+		return s.ctx.Err() == nil
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// canonicalName returns the name in lower case, as a fully-qualified name.
+func canonicalName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// inDomain returns whether the canonical name is the domain or one of its subdomains.
+func inDomain(name string, domain string) bool {
+	return domain == "." || name == domain || strings.HasSuffix(name, "."+domain)
+}
@@ -0,0 +1,331 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnstunnel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/kcp"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ErrPacketTooLarge is returned when a packet doesn't fit in a query name.
+var ErrPacketTooLarge = errors.New("packet too large for the tunnel")
+
+const (
+	// DefaultPollInterval is the default time between polls when there's no data.
+	DefaultPollInterval = 200 * time.Millisecond
+	// defaultSenders is the number of queries with data that can be in flight at the same time.
+	defaultSenders = 4
+	// queryTimeout bounds each query, which the server may hold to wait for data.
+	queryTimeout = 5 * time.Second
+	// sendQueueSize is the number of packets waiting to be sent. Packets are dropped when it's full.
+	sendQueueSize = 64
+	// receiveQueueSize is the number of packets waiting to be read. Packets are dropped when it's full.
+	receiveQueueSize = 256
+)
+
+type options struct {
+	pollInterval time.Duration
+	kcpConfig    *kcp.Config
+}
+
+// Option for building the tunnel endpoints.
+type Option func(o *options)
+
+// WithPollInterval sets the time between polls for downstream data when the tunnel is idle.
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.pollInterval = interval
+	}
+}
+
+// WithKCPConfig sets the configuration of the KCP sessions of the stream endpoint. If the MTU is not set, it's
+// set to the capacity of the query names.
+func WithKCPConfig(config *kcp.Config) Option {
+	return func(o *options) {
+		o.kcpConfig = config
+	}
+}
+
+// NewPacketEndpoint creates an endpoint that tunnels packets to a [Server] for the domain, by querying the
+// resolver. Each connection is a new tunnel. Like UDP, packets may be lost, and Write fails with
+// [ErrPacketTooLarge] for packets larger than the capacity of a query.
+func NewPacketEndpoint(resolver dns.Resolver, domain string, opts ...Option) (func(context.Context) (net.Conn, error), error) {
+	if resolver == nil {
+		return nil, errors.New("argument resolver must not be nil")
+	}
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	resolved := resolveOptions(opts)
+	return func(ctx context.Context) (net.Conn, error) {
+		return newClientConn(resolver, domain, resolved.pollInterval)
+	}, nil
+}
+
+// NewStreamEndpoint creates an endpoint that creates streams to a [Listener] of a [Server] for the domain, by
+// querying the resolver. The streams are multiplexed on a KCP session over a tunnel.
+func NewStreamEndpoint(resolver dns.Resolver, domain string, opts ...Option) (func(context.Context) (transport.StreamConn, error), error) {
+	packetEndpoint, err := NewPacketEndpoint(resolver, domain, opts...)
+	if err != nil {
+		return nil, err
+	}
+	domain, _ = normalizeDomain(domain)
+	resolved := resolveOptions(opts)
+	var config kcp.Config
+	if resolved.kcpConfig != nil {
+		config = *resolved.kcpConfig
+	} else {
+		config = defaultKCPConfig
+	}
+	if config.MTU == 0 {
+		config.MTU = maxUpstreamData(domain) - upstreamHeaderSize
+	}
+	dialer, err := kcp.NewStreamDialer(transport.FuncPacketDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return packetEndpoint(ctx)
+	}), &config)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) (transport.StreamConn, error) {
+		return dialer.DialStream(ctx, domain)
+	}, nil
+}
+
+// defaultKCPConfig is the default KCP configuration on both ends. It uses bare segments, since the protocol over
+// the streams is expected to provide integrity and confidentiality, which also makes compression pointless.
+// Forward error correction is disabled, since the small upstream packets can't afford its overhead.
+var defaultKCPConfig = kcp.Config{Crypt: "null", AckNoDelay: true, DataShards: -1, NoComp: true}
+
+func resolveOptions(opts []Option) options {
+	resolved := options{pollInterval: DefaultPollInterval}
+	for _, opt := range opts {
+		opt(&resolved)
+	}
+	return resolved
+}
+
+// clientConn is the client side of a tunnel. It's safe for concurrent use.
+type clientConn struct {
+	resolver     dns.Resolver
+	domain       string
+	id           clientID
+	maxPacket    int
+	pollInterval time.Duration
+	sendCh       chan []byte
+	receiveCh    chan []byte
+	ctx          context.Context
+	cancel       context.CancelFunc
+
+	mu           sync.Mutex
+	readDeadline time.Time
+	// deadlineChanged is closed and replaced when the read deadline changes.
+	deadlineChanged chan struct{}
+}
+
+var _ net.Conn = (*clientConn)(nil)
+
+func newClientConn(resolver dns.Resolver, domain string, pollInterval time.Duration) (*clientConn, error) {
+	c := &clientConn{
+		resolver:        resolver,
+		domain:          domain,
+		maxPacket:       maxUpstreamData(domain) - upstreamHeaderSize,
+		pollInterval:    pollInterval,
+		sendCh:          make(chan []byte, sendQueueSize),
+		receiveCh:       make(chan []byte, receiveQueueSize),
+		deadlineChanged: make(chan struct{}),
+	}
+	if _, err := rand.Read(c.id[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate client ID: %w", err)
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	for i := 0; i < defaultSenders; i++ {
+		go c.sendLoop()
+	}
+	go c.pollLoop()
+	return c, nil
+}
+
+// sendLoop sends the queued packets.
+func (c *clientConn) sendLoop() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case packet := <-c.sendCh:
+			c.exchange(packet)
+		}
+	}
+}
+
+// pollLoop polls for downstream data, right away if the last poll returned data, or after the poll interval
+// otherwise.
+func (c *clientConn) pollLoop() {
+	for {
+		received := c.exchange(nil)
+		if received > 0 {
+			continue
+		}
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+// exchange sends the packet, which may be empty, in a query and queues the packets in the response.
+// It returns the number of packets received.
+func (c *clientConn) exchange(packet []byte) int {
+	data := make([]byte, 0, upstreamHeaderSize+len(packet))
+	data = append(data, c.id[:]...)
+	data = append(data, make([]byte, nonceSize)...)
+	rand.Read(data[clientIDSize:])
+	data = append(data, packet...)
+	name, err := dnsmessage.NewName(encodeName(data, c.domain))
+	if err != nil {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, queryTimeout)
+	defer cancel()
+	response, err := c.resolver.Query(ctx, dnsmessage.Question{Name: name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET})
+	if err != nil {
+		return 0
+	}
+	received := 0
+	for _, answer := range response.Answers {
+		txt, ok := answer.Body.(*dnsmessage.TXTResource)
+		if !ok {
+			continue
+		}
+		var payload []byte
+		for _, s := range txt.TXT {
+			payload = append(payload, s...)
+		}
+		for len(payload) >= 2 {
+			size := int(binary.BigEndian.Uint16(payload))
+			if len(payload) < 2+size {
+				break
+			}
+			select {
+			case c.receiveCh <- payload[2 : 2+size]:
+				received++
+			default:
+			}
+			payload = payload[2+size:]
+		}
+	}
+	return received
+}
+
+// Read reads the next packet. The rest of the packet is discarded if it doesn't fit in b.
+func (c *clientConn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		deadline, changed := c.readDeadline, c.deadlineChanged
+		c.mu.Unlock()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		var n int
+		var err error
+		done := true
+		select {
+		case packet := <-c.receiveCh:
+			n = copy(b, packet)
+		case <-c.ctx.Done():
+			err = net.ErrClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		case <-changed:
+			done = false
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if done {
+			return n, err
+		}
+	}
+}
+
+// Write queues the packet to be sent. The packet is dropped if the queue is full.
+func (c *clientConn) Write(b []byte) (int, error) {
+	if c.ctx.Err() != nil {
+		return 0, net.ErrClosed
+	}
+	if len(b) > c.maxPacket {
+		return 0, fmt.Errorf("%w: %v bytes is over %v", ErrPacketTooLarge, len(b), c.maxPacket)
+	}
+	select {
+	case c.sendCh <- append([]byte(nil), b...):
+	default:
+	}
+	return len(b), nil
+}
+
+// Close stops the tunnel.
+func (c *clientConn) Close() error {
+	if c.ctx.Err() != nil {
+		return net.ErrClosed
+	}
+	c.cancel()
+	return nil
+}
+
+func (c *clientConn) LocalAddr() net.Addr {
+	return clientAddr(c.id)
+}
+
+func (c *clientConn) RemoteAddr() net.Addr {
+	return tunnelAddr(c.domain)
+}
+
+func (c *clientConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *clientConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline does nothing, since writes don't block.
+func (c *clientConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dnstunnel provides an experimental transport that tunnels data in DNS queries and responses, for
+// networks where only DNS traffic escapes.
+//
+// The client encodes each packet in the name of a TXT query under a domain delegated to a cooperating
+// authoritative server, and sends the query through any [dns.Resolver], usually the resolver of the network.
+// The server answers with the packets queued for that client in the TXT records of the response. Since responses
+// only come back for queries, the client keeps polling for downstream data, and the server holds polls for a
+// short time until data is available.
+//
+// DNS is lossy and has small messages, so streams are multiplexed on [kcp] sessions on top of the tunnel. Upstream packets
+// are especially small: a little over 100 bytes, depending on the length of the domain. Expect low throughput.
+//
+// The tunnel is not encrypted or authenticated, and the domain is visible to the resolvers on the path, so run an
+// encrypted protocol like Shadowsocks over the streams. A deployment looks like:
+//
+//	client: shadowsocks over [NewStreamEndpoint] -> network resolver -> [Server] -> [NewListener] -> shadowsocks server
+//
+// The domain must be delegated to the server with NS records, like "t.example.com. NS tunnel.example.com.", where
+// tunnel.example.com points to the host running the server.
+package dnstunnel
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	// clientIDSize is the size of the random ID that identifies each tunnel on the server.
+	clientIDSize = 8
+	// nonceSize is the size of the random nonce in each query, which defeats resolver caches.
+	nonceSize = 2
+	// upstreamHeaderSize is the size of the header of the data encoded in query names.
+	upstreamHeaderSize = clientIDSize + nonceSize
+
+	maxNameLength  = 253
+	maxLabelLength = 63
+)
+
+type clientID [clientIDSize]byte
+
+// tunnelAddr is the address of the server side of the tunnels, which is the tunnel domain.
+type tunnelAddr string
+
+func (a tunnelAddr) Network() string { return "dnstunnel" }
+func (a tunnelAddr) String() string  { return string(a) }
+
+// clientAddr is the address of the client side of a tunnel, which is the client ID.
+type clientAddr clientID
+
+func (a clientAddr) Network() string { return "dnstunnel" }
+func (a clientAddr) String() string  { return hex.EncodeToString(a[:]) }
+
+// nameEncoding is lowercase base32 without padding, which survives the case randomization of some resolvers
+// since decoding ignores the case.
+var nameEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var errNotInDomain = errors.New("name is not in the tunnel domain")
+
+// normalizeDomain lowercases the domain and removes the trailing dot.
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain == "" || len(domain) > maxNameLength-2 {
+		return "", errors.New("invalid tunnel domain")
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > maxLabelLength {
+			return "", errors.New("invalid tunnel domain")
+		}
+	}
+	return domain, nil
+}
+
+// encodedNameLength returns the length of the name that encodes n bytes under the domain, not including the
+// trailing dot.
+func encodedNameLength(n int, domain string) int {
+	encoded := nameEncoding.EncodedLen(n)
+	labels := (encoded + maxLabelLength - 1) / maxLabelLength
+	return encoded + labels + len(domain)
+}
+
+// maxUpstreamData returns how many bytes fit in a query name under the domain, including the header.
+func maxUpstreamData(domain string) int {
+	n := (maxNameLength - len(domain)) * 5 / 8
+	for n > 0 && encodedNameLength(n, domain) > maxNameLength {
+		n--
+	}
+	return n
+}
+
+// encodeName encodes the data as the labels of a name under the domain. The name is fully qualified.
+func encodeName(data []byte, domain string) string {
+	encoded := strings.ToLower(nameEncoding.EncodeToString(data))
+	var b strings.Builder
+	for len(encoded) > 0 {
+		n := len(encoded)
+		if n > maxLabelLength {
+			n = maxLabelLength
+		}
+		b.WriteString(encoded[:n])
+		b.WriteByte('.')
+		encoded = encoded[n:]
+	}
+	b.WriteString(domain)
+	b.WriteByte('.')
+	return b.String()
+}
+
+// decodeName returns the data encoded in the name under the domain.
+func decodeName(name string, domain string) ([]byte, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	prefix, ok := strings.CutSuffix(name, "."+domain)
+	if !ok {
+		return nil, errNotInDomain
+	}
+	return nameEncoding.DecodeString(strings.ToUpper(strings.ReplaceAll(prefix, ".", "")))
+}
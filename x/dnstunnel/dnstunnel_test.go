@@ -0,0 +1,188 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnstunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestEncodeName(t *testing.T) {
+	domain := "t.example.com"
+	max := maxUpstreamData(domain)
+	require.Greater(t, max, 100)
+	data := make([]byte, max)
+	rand.Read(data)
+	name := encodeName(data, domain)
+	require.LessOrEqual(t, len(name), maxNameLength+1)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		require.LessOrEqual(t, len(label), maxLabelLength)
+	}
+	require.Greater(t, encodedNameLength(max+1, domain), maxNameLength)
+	_, err := dnsmessage.NewName(name)
+	require.NoError(t, err)
+
+	decoded, err := decodeName(name, domain)
+	require.NoError(t, err)
+	require.Equal(t, data, decoded)
+
+	// Resolvers may randomize the case.
+	decoded, err = decodeName(strings.ToUpper(name), domain)
+	require.NoError(t, err)
+	require.Equal(t, data, decoded)
+
+	_, err = decodeName(name, "other.com")
+	require.ErrorIs(t, err, errNotInDomain)
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	domain, err := normalizeDomain("T.Example.COM.")
+	require.NoError(t, err)
+	require.Equal(t, "t.example.com", domain)
+	for _, invalid := range []string{"", ".", "a..b", strings.Repeat("a", 64) + ".com"} {
+		_, err := normalizeDomain(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestServer_HandleQueryOutsideDomain(t *testing.T) {
+	server, err := NewServer("t.example.com")
+	require.NoError(t, err)
+	defer server.Close()
+	for _, q := range []dnsmessage.Question{
+		{Name: dnsmessage.MustNewName("www.example.com."), Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET},
+		{Name: dnsmessage.MustNewName("aaaa.t.example.com."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+	} {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 7, RecursionDesired: true})
+		b.StartQuestions()
+		b.Question(q)
+		query, err := b.Finish()
+		require.NoError(t, err)
+
+		var response dnsmessage.Message
+		require.NoError(t, response.Unpack(server.handleQuery(query)))
+		require.Equal(t, uint16(7), response.Header.ID)
+		require.True(t, response.Header.Response)
+		require.Equal(t, dnsmessage.RCodeNameError, response.Header.RCode)
+		require.Equal(t, []dnsmessage.Question{q}, response.Questions)
+	}
+}
+
+// startServer runs a tunnel server for the domain on a local UDP socket, and returns a resolver that queries it.
+func startServer(t *testing.T, domain string) (*Server, dns.Resolver) {
+	server, err := NewServer(domain)
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.ServeDNS(pc)
+	return server, dns.NewUDPResolver(&transport.UDPDialer{}, pc.LocalAddr().String())
+}
+
+func TestPacketEndpoint(t *testing.T) {
+	server, resolver := startServer(t, "t.example.com")
+	go func() {
+		buf := make([]byte, 2000)
+		for {
+			n, addr, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			server.WriteTo(append([]byte("echo: "), buf[:n]...), addr)
+		}
+	}()
+
+	endpoint, err := NewPacketEndpoint(resolver, "T.EXAMPLE.COM", WithPollInterval(20*time.Millisecond))
+	require.NoError(t, err)
+	conn, err := endpoint(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "t.example.com", conn.RemoteAddr().String())
+
+	_, err = conn.Write(make([]byte, 1000))
+	require.ErrorIs(t, err, ErrPacketTooLarge)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2000)
+	// Packets may be dropped, so retry.
+	for {
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+			continue
+		}
+		require.Equal(t, "echo: hello", string(buf[:n]))
+		break
+	}
+	require.NoError(t, conn.Close())
+	_, err = conn.Read(buf)
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestStreamEndpoint(t *testing.T) {
+	server, resolver := startServer(t, "t.example.com")
+	listener, err := NewListener(server, nil)
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	endpoint, err := NewStreamEndpoint(resolver, "t.example.com", WithPollInterval(20*time.Millisecond))
+	require.NoError(t, err)
+	conn, err := endpoint(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	data := make([]byte, 20_000)
+	rand.Read(data)
+	go conn.Write(data)
+	conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+	received := make([]byte, len(data))
+	_, err = io.ReadFull(conn, received)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(data, received))
+}
+
+func TestNewStreamEndpoint_Invalid(t *testing.T) {
+	_, err := NewStreamEndpoint(nil, "t.example.com")
+	require.Error(t, err)
+	_, err = NewStreamEndpoint(dns.NewUDPResolver(&transport.UDPDialer{}, "127.0.0.1"), "")
+	require.Error(t, err)
+}
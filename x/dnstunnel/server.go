@@ -0,0 +1,395 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dnstunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/x/kcp"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// maxResponseDelay is how long the server holds a poll while there's no data for the client.
+	maxResponseDelay = 500 * time.Millisecond
+	// clientIdleTimeout is how long the server keeps the state of a client that stopped querying.
+	clientIdleTimeout = 2 * time.Minute
+	// clientQueueSize is the number of packets queued for each client. Packets are dropped when it's full.
+	clientQueueSize = 128
+	// incomingQueueSize is the number of packets waiting for ReadFrom. Packets are dropped when it's full.
+	incomingQueueSize = 256
+	// minUDPSize is the response size limit when the query has no EDNS(0) option.
+	minUDPSize = 512
+	// maxUDPSize caps the response size advertised by the query.
+	maxUDPSize = 4096
+	// DefaultServerMTU is the default KCP MTU of [NewListener], which fits the responses of resolvers that
+	// advertise the common EDNS(0) size of 1232 bytes.
+	DefaultServerMTU = 900
+)
+
+type incomingPacket struct {
+	id     clientID
+	packet []byte
+}
+
+type clientState struct {
+	queue    [][]byte
+	lastSeen time.Time
+	// ready is closed and replaced when packets are queued.
+	ready chan struct{}
+}
+
+// Server is the authoritative server side of the tunnels. It answers the DNS queries of clients, and implements
+// [net.PacketConn] for the tunneled packets, where the addresses identify the clients. Use [NewListener] to
+// accept streams.
+type Server struct {
+	domain   string
+	incoming chan incomingPacket
+	done     chan struct{}
+
+	mu           sync.Mutex
+	clients      map[clientID]*clientState
+	lastSweep    time.Time
+	closed       bool
+	readDeadline time.Time
+	// deadlineChanged is closed and replaced when the read deadline changes.
+	deadlineChanged chan struct{}
+}
+
+var _ net.PacketConn = (*Server)(nil)
+
+// NewServer creates a [Server] for the tunnels under domain.
+func NewServer(domain string) (*Server, error) {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		domain:          domain,
+		incoming:        make(chan incomingPacket, incomingQueueSize),
+		done:            make(chan struct{}),
+		clients:         make(map[clientID]*clientState),
+		deadlineChanged: make(chan struct{}),
+	}, nil
+}
+
+// NewListener returns a listener of the streams of [NewStreamEndpoint] clients on the server.
+// The config may be nil to use the defaults.
+func NewListener(server *Server, config *kcp.Config) (*kcp.Listener, error) {
+	if server == nil {
+		return nil, errors.New("argument server must not be nil")
+	}
+	var resolved kcp.Config
+	if config != nil {
+		resolved = *config
+	} else {
+		resolved = defaultKCPConfig
+	}
+	if resolved.MTU == 0 {
+		resolved.MTU = DefaultServerMTU
+	}
+	return kcp.NewListener(server, &resolved)
+}
+
+// ServeDNS answers the DNS queries that arrive on pc, until pc is closed or the server is closed.
+// It can be called on multiple connections.
+func (s *Server) ServeDNS(pc net.PacketConn) error {
+	go func() {
+		<-s.done
+		pc.Close()
+	}()
+	buf := make([]byte, 0xffff)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+				return net.ErrClosed
+			default:
+				return err
+			}
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			if response := s.handleQuery(query); response != nil {
+				pc.WriteTo(response, addr)
+			}
+		}()
+	}
+}
+
+// handleQuery returns the response to the query, or nil if it should be ignored.
+func (s *Server) handleQuery(query []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil || header.Response {
+		return nil
+	}
+	question, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	p.SkipAllQuestions()
+	p.SkipAllAnswers()
+	p.SkipAllAuthorities()
+	udpSize := minUDPSize
+	for {
+		rh, err := p.AdditionalHeader()
+		if err != nil {
+			break
+		}
+		if rh.Type == dnsmessage.TypeOPT {
+			udpSize = int(rh.Class)
+		}
+		p.SkipAdditional()
+	}
+	if udpSize < minUDPSize {
+		udpSize = minUDPSize
+	} else if udpSize > maxUDPSize {
+		udpSize = maxUDPSize
+	}
+
+	responseHeader := dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		OpCode:           header.OpCode,
+		Authoritative:    true,
+		RecursionDesired: header.RecursionDesired,
+		RCode:            dnsmessage.RCodeSuccess,
+	}
+	var data []byte
+	if question.Type == dnsmessage.TypeTXT && question.Class == dnsmessage.ClassINET {
+		data, err = decodeName(question.Name.String(), s.domain)
+	} else {
+		err = errNotInDomain
+	}
+	if err != nil || len(data) < upstreamHeaderSize {
+		responseHeader.RCode = dnsmessage.RCodeNameError
+		return buildResponse(responseHeader, question, nil)
+	}
+	var id clientID
+	copy(id[:], data)
+	// Register the client before delivering the packet, so the replies to it are queued.
+	s.touchClient(id)
+	packet := data[upstreamHeaderSize:]
+	if len(packet) > 0 {
+		select {
+		case s.incoming <- incomingPacket{id, packet}:
+		default:
+		}
+	}
+
+	// Room for the packets, after the header, the question, the answer with a compressed name and the TXT string
+	// lengths, and the OPT record.
+	room := udpSize - 12 - (len(question.Name.String()) + 1 + 4) - (2 + 10) - 11
+	room -= room/256 + 1
+	payload := s.takePackets(id, room, len(packet) == 0)
+	var txt []string
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > 255 {
+			n = 255
+		}
+		txt = append(txt, string(payload[:n]))
+		payload = payload[n:]
+	}
+	if len(txt) == 0 {
+		txt = []string{""}
+	}
+	return buildResponse(responseHeader, question, &dnsmessage.TXTResource{TXT: txt})
+}
+
+// touchClient registers the client, or updates the time it was last seen, and forgets the idle clients.
+func (s *Server) touchClient(id clientID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) > clientIdleTimeout {
+		for id, client := range s.clients {
+			if now.Sub(client.lastSeen) > clientIdleTimeout {
+				delete(s.clients, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	client := s.clients[id]
+	if client == nil {
+		client = &clientState{ready: make(chan struct{})}
+		s.clients[id] = client
+	}
+	client.lastSeen = now
+}
+
+// takePackets returns the packets queued for the client that fit in room bytes, each prefixed with its length.
+// If wait is true, it waits a little for packets when there are none.
+func (s *Server) takePackets(id clientID, room int, wait bool) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client := s.clients[id]
+	if client == nil {
+		return nil
+	}
+	if wait && len(client.queue) == 0 && !s.closed {
+		ready := client.ready
+		s.mu.Unlock()
+		timer := time.NewTimer(maxResponseDelay)
+		select {
+		case <-ready:
+		case <-timer.C:
+		case <-s.done:
+		}
+		timer.Stop()
+		s.mu.Lock()
+	}
+	var payload []byte
+	for len(client.queue) > 0 {
+		packet := client.queue[0]
+		if 2+len(packet) > room-len(payload) {
+			if len(payload) == 0 {
+				// It will never fit.
+				client.queue = client.queue[1:]
+				continue
+			}
+			break
+		}
+		payload = binary.BigEndian.AppendUint16(payload, uint16(len(packet)))
+		payload = append(payload, packet...)
+		client.queue = client.queue[1:]
+	}
+	return payload
+}
+
+func buildResponse(header dnsmessage.Header, question dnsmessage.Question, txt *dnsmessage.TXTResource) []byte {
+	b := dnsmessage.NewBuilder(nil, header)
+	b.EnableCompression()
+	b.StartQuestions()
+	b.Question(question)
+	if txt != nil {
+		b.StartAnswers()
+		if err := b.TXTResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET}, *txt); err != nil {
+			return nil
+		}
+	}
+	b.StartAdditionals()
+	var rh dnsmessage.ResourceHeader
+	rh.SetEDNS0(maxUDPSize, dnsmessage.RCodeSuccess, false)
+	b.OPTResource(rh, dnsmessage.OPTResource{})
+	response, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return response
+}
+
+// ReadFrom reads the next packet from a client. The address identifies the client.
+func (s *Server) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		s.mu.Lock()
+		deadline, changed := s.readDeadline, s.deadlineChanged
+		s.mu.Unlock()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		var n int
+		var addr net.Addr
+		var err error
+		done := true
+		select {
+		case in := <-s.incoming:
+			n, addr = copy(b, in.packet), clientAddr(in.id)
+		case <-s.done:
+			err = net.ErrClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		case <-changed:
+			done = false
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if done {
+			return n, addr, err
+		}
+	}
+}
+
+// WriteTo queues the packet for the client, to be sent in the responses to its next queries. The packet is
+// dropped if the client is unknown or its queue is full.
+func (s *Server) WriteTo(b []byte, addr net.Addr) (int, error) {
+	id, ok := addr.(clientAddr)
+	if !ok {
+		return 0, errors.New("address is not a tunnel client")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, net.ErrClosed
+	}
+	client := s.clients[clientID(id)]
+	if client == nil || len(client.queue) >= clientQueueSize {
+		return len(b), nil
+	}
+	client.queue = append(client.queue, append([]byte(nil), b...))
+	close(client.ready)
+	client.ready = make(chan struct{})
+	return len(b), nil
+}
+
+// Close stops the server, and closes the connections passed to ServeDNS.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return net.ErrClosed
+	}
+	s.closed = true
+	close(s.done)
+	return nil
+}
+
+// LocalAddr returns the tunnel domain as the address.
+func (s *Server) LocalAddr() net.Addr {
+	return tunnelAddr(s.domain)
+}
+
+func (s *Server) SetDeadline(t time.Time) error {
+	return s.SetReadDeadline(t)
+}
+
+func (s *Server) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDeadline = t
+	close(s.deadlineChanged)
+	s.deadlineChanged = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline does nothing, since writes don't block.
+func (s *Server) SetWriteDeadline(t time.Time) error {
+	return nil
+}
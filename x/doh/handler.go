@@ -0,0 +1,189 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package doh provides a [DNS-over-HTTPS] server that answers queries with any [dns.Resolver].
+
+Gateway deployments can use it to offer the DNS resolution of the tunnel to the clients in the local network over
+HTTPS. For example, to serve the queries with a resolver that goes through the tunnel:
+
+	resolver := dns.NewTCPResolver(tunnelDialer, "8.8.8.8:53")
+	mux := http.NewServeMux()
+	mux.Handle("/dns-query", &doh.Handler{Resolver: resolver})
+	err := http.ListenAndServeTLS(":443", certFile, keyFile, mux)
+
+The [Handler] supports GET and POST requests as per RFC 8484, with a single question per query.
+
+[DNS-over-HTTPS]: https://datatracker.ietf.org/doc/html/rfc8484
+*/
+package doh
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultQueryTimeout is the time limit to answer a query when [Handler].QueryTimeout is zero.
+const DefaultQueryTimeout = 5 * time.Second
+
+const (
+	dnsMessageType = "application/dns-message"
+	// maxMessageSize is the maximum size of a DNS message.
+	maxMessageSize = 65535
+)
+
+// Handler is a [http.Handler] that answers DNS-over-HTTPS queries with a [dns.Resolver].
+//
+// Queries that fail to resolve are answered with a server failure response, so clients don't wait for their timeout.
+// The Cache-Control max-age of the responses is the minimum TTL of their records.
+type Handler struct {
+	// Resolver answers the queries. It must not be nil.
+	Resolver dns.Resolver
+	// QueryTimeout is the time limit to answer each query. If zero, it's DefaultQueryTimeout.
+	QueryTimeout time.Duration
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+func (h *Handler) queryTimeout() time.Duration {
+	if h.QueryTimeout <= 0 {
+		return DefaultQueryTimeout
+	}
+	return h.QueryTimeout
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query, status, err := readQuery(r)
+	if err != nil {
+		if status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", "GET, POST")
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		http.Error(w, "Invalid DNS message", http.StatusBadRequest)
+		return
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		http.Error(w, "Invalid DNS message", http.StatusBadRequest)
+		return
+	}
+	if header.Response || len(questions) != 1 {
+		// The resolver takes a single question, so we can't answer other queries.
+		writeMessage(w, &dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: header.ID, Response: true, OpCode: header.OpCode, RCode: dnsmessage.RCodeFormatError},
+			Questions: questions,
+		})
+		return
+	}
+	if header.OpCode != 0 {
+		writeMessage(w, &dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: header.ID, Response: true, OpCode: header.OpCode, RCode: dnsmessage.RCodeNotImplemented},
+			Questions: questions,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.queryTimeout())
+	defer cancel()
+	msg, err := h.Resolver.Query(ctx, questions[0])
+	if err != nil {
+		msg = &dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RecursionAvailable: true, RCode: dnsmessage.RCodeServerFailure},
+			Questions: questions,
+		}
+	}
+	msg.ID = header.ID
+	msg.RecursionDesired = header.RecursionDesired
+	writeMessage(w, msg)
+}
+
+// readQuery returns the DNS query in the request, or the HTTP status and error to respond with.
+func readQuery(r *http.Request) ([]byte, int, error) {
+	switch r.Method {
+	case http.MethodGet:
+		encoded := r.URL.Query().Get("dns")
+		if encoded == "" {
+			return nil, http.StatusBadRequest, errors.New("missing dns parameter")
+		}
+		query, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid dns parameter: %w", err)
+		}
+		return query, http.StatusOK, nil
+	case http.MethodPost:
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != dnsMessageType {
+			return nil, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be %v", dnsMessageType)
+		}
+		query, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("failed to read query: %w", err)
+		}
+		if len(query) > maxMessageSize {
+			return nil, http.StatusRequestEntityTooLarge, errors.New("query is too large")
+		}
+		return query, http.StatusOK, nil
+	default:
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("method %v is not supported", r.Method)
+	}
+}
+
+// writeMessage writes the DNS message as the response, with a max-age of its minimum TTL.
+func writeMessage(w http.ResponseWriter, msg *dnsmessage.Message) {
+	response, err := msg.Pack()
+	if err != nil {
+		http.Error(w, "Failed to pack DNS response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", dnsMessageType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", minTTL(msg)))
+	w.Write(response)
+}
+
+// minTTL returns the minimum TTL of the records of the message, excluding the OPT pseudo-record, or 0 if there
+// are no records.
+func minTTL(msg *dnsmessage.Message) uint32 {
+	ttl := uint32(math.MaxUint32)
+	for _, sections := range [][]dnsmessage.Resource{msg.Answers, msg.Authorities, msg.Additionals} {
+		for _, resource := range sections {
+			if resource.Header.Type == dnsmessage.TypeOPT {
+				continue
+			}
+			if resource.Header.TTL < ttl {
+				ttl = resource.Header.TTL
+			}
+		}
+	}
+	if ttl == math.MaxUint32 {
+		return 0
+	}
+	return ttl
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func newAnswerResolver(ttl uint32) dns.Resolver {
+	return dns.FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		return &dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RecursionAvailable: true},
+			Questions: []dnsmessage.Question{q},
+			Answers: []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+				Body:   &dnsmessage.AResource{A: netip.MustParseAddr("192.0.2.1").As4()},
+			}},
+		}, nil
+	})
+}
+
+func packQuery(t *testing.T, id uint16, domain string) []byte {
+	q, err := dns.NewQuestion(domain, dnsmessage.TypeA)
+	require.NoError(t, err)
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{*q},
+	}
+	query, err := msg.Pack()
+	require.NoError(t, err)
+	return query
+}
+
+func unpackResponse(t *testing.T, resp *http.Response) *dnsmessage.Message {
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/dns-message", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(body))
+	return &msg
+}
+
+func TestHandler_Post(t *testing.T) {
+	h := &Handler{Resolver: newAnswerResolver(300)}
+	req := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(packQuery(t, 0, "example.com")))
+	req.Header.Set("Content-Type", "application/dns-message")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	resp := rec.Result()
+	require.Equal(t, "max-age=300", resp.Header.Get("Cache-Control"))
+	msg := unpackResponse(t, resp)
+	require.Equal(t, uint16(0), msg.ID)
+	require.True(t, msg.RecursionDesired)
+	require.Len(t, msg.Answers, 1)
+	require.Equal(t, "example.com.", msg.Answers[0].Header.Name.String())
+}
+
+func TestHandler_Get(t *testing.T) {
+	h := &Handler{Resolver: newAnswerResolver(60)}
+	encoded := base64.RawURLEncoding.EncodeToString(packQuery(t, 1234, "example.com"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dns-query?dns="+encoded, nil))
+
+	msg := unpackResponse(t, rec.Result())
+	require.Equal(t, uint16(1234), msg.ID)
+	require.Len(t, msg.Answers, 1)
+}
+
+func TestHandler_ResolverError(t *testing.T) {
+	h := &Handler{Resolver: dns.FuncResolver(func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+		return nil, errors.New("failed")
+	})}
+	encoded := base64.RawURLEncoding.EncodeToString(packQuery(t, 7, "example.com"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dns-query?dns="+encoded, nil))
+
+	resp := rec.Result()
+	require.Equal(t, "max-age=0", resp.Header.Get("Cache-Control"))
+	msg := unpackResponse(t, resp)
+	require.Equal(t, uint16(7), msg.ID)
+	require.Equal(t, dnsmessage.RCodeServerFailure, msg.RCode)
+	require.Len(t, msg.Questions, 1)
+}
+
+func TestHandler_MultipleQuestions(t *testing.T) {
+	h := &Handler{Resolver: newAnswerResolver(60)}
+	q, err := dns.NewQuestion("example.com", dnsmessage.TypeA)
+	require.NoError(t, err)
+	query, err := (&dnsmessage.Message{Questions: []dnsmessage.Question{*q, *q}}).Pack()
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(query), nil))
+
+	msg := unpackResponse(t, rec.Result())
+	require.Equal(t, dnsmessage.RCodeFormatError, msg.RCode)
+}
+
+func TestHandler_BadRequests(t *testing.T) {
+	h := &Handler{Resolver: newAnswerResolver(60)}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dns-query", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dns-query?dns=!!!", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dns-query?dns=AAAA", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/dns-query", strings.NewReader("query"))
+	req.Header.Set("Content-Type", "text/plain")
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(make([]byte, maxMessageSize+1)))
+	req.Header.Set("Content-Type", "application/dns-message")
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/dns-query", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, "GET, POST", rec.Header().Get("Allow"))
+}
+
+func TestHandler_WithHTTPSResolver(t *testing.T) {
+	server := httptest.NewServer(&Handler{Resolver: newAnswerResolver(60)})
+	defer server.Close()
+
+	resolver := dns.NewHTTPSResolver(&transport.TCPDialer{}, server.Listener.Addr().String(), server.URL+"/dns-query")
+	q, err := dns.NewQuestion("example.com", dnsmessage.TypeA)
+	require.NoError(t, err)
+	msg, err := resolver.Query(context.Background(), *q)
+	require.NoError(t, err)
+	require.Len(t, msg.Answers, 1)
+	require.Equal(t, [4]byte{192, 0, 2, 1}, msg.Answers[0].Body.(*dnsmessage.AResource).A)
+}
+
+func TestMinTTL(t *testing.T) {
+	require.Equal(t, uint32(0), minTTL(&dnsmessage.Message{}))
+
+	var opt dnsmessage.ResourceHeader
+	require.NoError(t, opt.SetEDNS0(1232, dnsmessage.RCodeSuccess, false))
+	msg := &dnsmessage.Message{
+		Answers:     []dnsmessage.Resource{{Header: dnsmessage.ResourceHeader{TTL: 300}}},
+		Authorities: []dnsmessage.Resource{{Header: dnsmessage.ResourceHeader{TTL: 100}}},
+		Additionals: []dnsmessage.Resource{{Header: opt}},
+	}
+	require.Equal(t, uint32(100), minTTL(msg))
+}
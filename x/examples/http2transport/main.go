@@ -26,12 +26,14 @@ import (
 
 	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
 	"github.com/Jigsaw-Code/outline-sdk/x/httpproxy"
+	"github.com/Jigsaw-Code/outline-sdk/x/proxyproto"
 )
 
 func main() {
 	transportFlag := flag.String("transport", "", "Transport config")
 	addrFlag := flag.String("localAddr", "localhost:1080", "Local proxy address")
 	urlProxyPrefixFlag := flag.String("urlProxyPrefix", "/proxy", "Path where to run the URL proxy. Set to empty (\"\") to disable it.")
+	proxyProtocolFlag := flag.Bool("proxyProtocol", false, "Expect a PROXY protocol header on incoming connections, as sent by load balancers")
 	flag.Parse()
 
 	dialer, err := configurl.NewDefaultProviders().NewStreamDialer(context.Background(), *transportFlag)
@@ -44,6 +46,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Could not listen on address %v: %v", *addrFlag, err)
 	}
+	if *proxyProtocolFlag {
+		listener = proxyproto.NewListener(listener)
+	}
 	defer listener.Close()
 	log.Printf("Proxy listening on %v", listener.Addr().String())
 
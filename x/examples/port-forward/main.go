@@ -0,0 +1,85 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+	"github.com/Jigsaw-Code/outline-sdk/x/forwarder"
+)
+
+func main() {
+	transportFlag := flag.String("transport", "", "Transport config")
+	localAddrFlag := flag.String("localAddr", "localhost:8080", "Local address to listen on")
+	remoteAddrFlag := flag.String("remoteAddr", "", "Remote address to forward to, in host:port format")
+	protoFlag := flag.String("proto", "tcp", "Protocol to forward: \"tcp\" or \"udp\"")
+	flag.Parse()
+
+	if *remoteAddrFlag == "" {
+		log.Fatal("Must specify flag -remoteAddr")
+	}
+	providers := configurl.NewDefaultProviders()
+
+	switch *protoFlag {
+	case "tcp":
+		dialer, err := providers.NewStreamDialer(context.Background(), *transportFlag)
+		if err != nil {
+			log.Fatalf("Could not create dialer: %v", err)
+		}
+		f, err := forwarder.NewStreamForwarder(dialer, *remoteAddrFlag)
+		if err != nil {
+			log.Fatalf("Could not create forwarder: %v", err)
+		}
+		listener, err := net.Listen("tcp", *localAddrFlag)
+		if err != nil {
+			log.Fatalf("Could not listen on address %v: %v", *localAddrFlag, err)
+		}
+		defer listener.Close()
+		log.Printf("Forwarding TCP %v to %v", listener.Addr(), *remoteAddrFlag)
+		go f.Serve(listener)
+
+	case "udp":
+		dialer, err := providers.NewPacketDialer(context.Background(), *transportFlag)
+		if err != nil {
+			log.Fatalf("Could not create dialer: %v", err)
+		}
+		f, err := forwarder.NewPacketForwarder(dialer, *remoteAddrFlag)
+		if err != nil {
+			log.Fatalf("Could not create forwarder: %v", err)
+		}
+		pc, err := net.ListenPacket("udp", *localAddrFlag)
+		if err != nil {
+			log.Fatalf("Could not listen on address %v: %v", *localAddrFlag, err)
+		}
+		defer pc.Close()
+		log.Printf("Forwarding UDP %v to %v", pc.LocalAddr(), *remoteAddrFlag)
+		go f.Serve(pc)
+
+	default:
+		log.Fatalf(`Invalid proto %q. Must be "tcp" or "udp"`, *protoFlag)
+	}
+
+	// Wait for interrupt signal to stop forwarding.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+	log.Print("Shutting down")
+}
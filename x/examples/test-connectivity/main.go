@@ -24,6 +24,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptrace"
+	"net/netip"
 	"net/url"
 	"os"
 	"path"
@@ -35,6 +36,7 @@ import (
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
 	"github.com/Jigsaw-Code/outline-sdk/x/connectivity"
+	"github.com/Jigsaw-Code/outline-sdk/x/geoip"
 	"github.com/Jigsaw-Code/outline-sdk/x/report"
 	"github.com/lmittmann/tint"
 	"golang.org/x/term"
@@ -72,6 +74,9 @@ type tcpReport struct {
 	IP       string `json:"ip"`
 	Port     string `json:"port"`
 	Error    string `json:"error"`
+	// Country and ASN of the IP, when a GeoIP database is provided.
+	Country string `json:"country,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
 }
 
 type errorJSON struct {
@@ -171,6 +176,8 @@ func main() {
 	reportToFlag := flag.String("report-to", "", "URL to send JSON error reports to")
 	reportSuccessFlag := flag.Float64("report-success-rate", 0.1, "Report success to collector with this probability - must be between 0 and 1")
 	reportFailureFlag := flag.Float64("report-failure-rate", 1, "Report failure to collector with this probability - must be between 0 and 1")
+	geoipFlag := flag.String("geoip-db", "", "Path to a MaxMind DB file (country or ASN) used to annotate the reported connections")
+	ooniFlag := flag.Bool("ooni", false, "Emit the reports as measurements in the OONI data format")
 
 	flag.Parse()
 
@@ -196,6 +203,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	var geoipReader *geoip.Reader
+	if *geoipFlag != "" {
+		var err error
+		geoipReader, err = geoip.Open(*geoipFlag)
+		if err != nil {
+			slog.Error("Failed to open GeoIP database", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	var reportCollector report.Collector
 	if *reportToFlag != "" {
 		collectorURL, err := url.Parse(*reportToFlag)
@@ -278,6 +295,12 @@ func main() {
 					if connErr != nil {
 						report.Error = connErr.Error()
 					}
+					if geoipReader != nil {
+						if ipAddr, err := netip.ParseAddr(ip); err == nil {
+							report.Country = geoipReader.CountryCode(ipAddr)
+							report.ASN, _, _ = geoipReader.ASN(ipAddr)
+						}
+					}
 					mu.Lock()
 					tcpReports = append(tcpReports, report)
 					mu.Unlock()
@@ -324,18 +347,33 @@ func main() {
 				slog.Error("Failed to sanitize config", "error", err)
 				os.Exit(1)
 			}
-			var r report.Report = connectivityReport{
-				Test: testReport{
-					Resolver: resolverAddress,
-					Proto:    proto,
-					Time:     startTime.UTC().Truncate(time.Second),
-					// TODO(fortuna): Add sanitized config:
-					Transport:  sanitizedConfig,
-					DurationMs: testDuration.Milliseconds(),
-					Error:      makeErrorRecord(result),
-				},
-				DNSQueries:     dnsReports,
-				TCPConnections: tcpReports,
+			var r report.Report
+			if *ooniFlag {
+				r = connectivity.NewOONIResolverMeasurement(&connectivity.OONIProbeInfo{
+					SoftwareName: "outline-sdk-test-connectivity",
+					Annotations:  map[string]string{"transport": sanitizedConfig},
+				}, &connectivity.ResolverTest{
+					Domain:          *domainFlag,
+					ResolverAddress: resolverAddress,
+					Proto:           proto,
+					StartTime:       startTime,
+					Duration:        testDuration,
+					Result:          result,
+				})
+			} else {
+				r = connectivityReport{
+					Test: testReport{
+						Resolver: resolverAddress,
+						Proto:    proto,
+						Time:     startTime.UTC().Truncate(time.Second),
+						// TODO(fortuna): Add sanitized config:
+						Transport:  sanitizedConfig,
+						DurationMs: testDuration.Milliseconds(),
+						Error:      makeErrorRecord(result),
+					},
+					DNSQueries:     dnsReports,
+					TCPConnections: tcpReports,
+				}
 			}
 			if reportCollector != nil {
 				err = reportCollector.Collect(context.Background(), r)
@@ -0,0 +1,195 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamForwarder(t *testing.T) {
+	// Echo server.
+	target, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.AcceptTCP()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+				conn.CloseWrite()
+			}()
+		}
+	}()
+
+	f, err := NewStreamForwarder(&transport.TCPDialer{}, target.Addr().String())
+	require.NoError(t, err)
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	var running sync.WaitGroup
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		require.ErrorIs(t, f.Serve(listener), net.ErrClosed)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("Request"))
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "Request", string(response))
+	conn.Close()
+
+	// Closing the listener closes the active connections.
+	conn, err = net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("x"))
+	require.NoError(t, err)
+	listener.Close()
+	running.Wait()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	// The connection may end with EOF or a reset, but must not time out.
+	_, err = io.ReadAll(conn)
+	var netErr net.Error
+	require.False(t, errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func TestPacketForwarder(t *testing.T) {
+	// Echo server.
+	target, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer target.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := target.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			target.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	f, err := NewPacketForwarder(&transport.UDPDialer{}, target.LocalAddr().String())
+	require.NoError(t, err)
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	var running sync.WaitGroup
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		require.ErrorIs(t, f.Serve(pc), net.ErrClosed)
+	}()
+
+	for _, payload := range []string{"first", "second"} {
+		client, err := net.Dial("udp", pc.LocalAddr().String())
+		require.NoError(t, err)
+		_, err = client.Write([]byte(payload))
+		require.NoError(t, err)
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 1500)
+		n, err := client.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, payload, string(buf[:n]))
+		client.Close()
+	}
+
+	pc.Close()
+	running.Wait()
+}
+
+func TestPacketForwarder_SlowDial(t *testing.T) {
+	target, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer target.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := target.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			target.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	// The first dial only returns when Serve stops.
+	var dials atomic.Int32
+	dialer := transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		if dials.Add(1) == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return (&transport.UDPDialer{}).DialPacket(ctx, addr)
+	})
+	f, err := NewPacketForwarder(dialer, target.LocalAddr().String())
+	require.NoError(t, err)
+	f.DialTimeout = time.Hour
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	var running sync.WaitGroup
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		require.ErrorIs(t, f.Serve(pc), net.ErrClosed)
+	}()
+
+	slowClient, err := net.Dial("udp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	defer slowClient.Close()
+	_, err = slowClient.Write([]byte("slow"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return dials.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Other senders are not held by the slow dial.
+	client, err := net.Dial("udp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("fast"))
+	require.NoError(t, err)
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, err := client.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "fast", string(buf[:n]))
+
+	// Closing cancels the pending dial.
+	pc.Close()
+	running.Wait()
+}
+
+func TestNewForwarder_NilDialer(t *testing.T) {
+	_, err := NewStreamForwarder(nil, "example.com:443")
+	require.Error(t, err)
+	_, err = NewPacketForwarder(nil, "8.8.8.8:53")
+	require.Error(t, err)
+}
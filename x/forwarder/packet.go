@@ -0,0 +1,157 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// DefaultPacketIdleTimeout is the default [PacketForwarder.IdleTimeout].
+const DefaultPacketIdleTimeout = time.Minute
+
+// DefaultPacketDialTimeout is the default [PacketForwarder.DialTimeout].
+const DefaultPacketDialTimeout = 10 * time.Second
+
+// maxPacketSize is the largest UDP payload.
+const maxPacketSize = 65507
+
+// maxPendingPackets is how many packets from a sender are queued while its association is dialed or busy.
+// Later packets are dropped.
+const maxPendingPackets = 64
+
+// PacketForwarder relays the datagrams received on a [net.PacketConn] to a fixed remote address, and the responses
+// back to the senders. Each sender gets its own association with the remote address.
+type PacketForwarder struct {
+	dialer     transport.PacketDialer
+	remoteAddr string
+	// IdleTimeout is how long an association is kept without traffic in either direction.
+	// If zero, [DefaultPacketIdleTimeout] is used.
+	IdleTimeout time.Duration
+	// DialTimeout limits the dial of each association. If zero, [DefaultPacketDialTimeout] is used.
+	DialTimeout time.Duration
+}
+
+// NewPacketForwarder creates a [PacketForwarder] that uses the dialer to send to remoteAddr.
+func NewPacketForwarder(dialer transport.PacketDialer, remoteAddr string) (*PacketForwarder, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	return &PacketForwarder{dialer: dialer, remoteAddr: remoteAddr}, nil
+}
+
+// Serve relays the datagrams received on pc until it's closed. Then it closes the associations and returns the
+// error from ReadFrom.
+//
+// The associations are dialed in the background, so a slow dial doesn't hold the other senders. The packets of a
+// sender are queued while its association is dialed.
+func (f *PacketForwarder) Serve(pc net.PacketConn) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	sessions := make(map[string]chan []byte)
+	var running sync.WaitGroup
+	defer func() {
+		cancel()
+		running.Wait()
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, clientAddr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		key := clientAddr.String()
+		mu.Lock()
+		packets, ok := sessions[key]
+		if !ok {
+			packets = make(chan []byte, maxPendingPackets)
+			sessions[key] = packets
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				f.relay(ctx, pc, clientAddr, packets)
+				mu.Lock()
+				delete(sessions, key)
+				mu.Unlock()
+			}()
+		}
+		mu.Unlock()
+		select {
+		case packets <- append([]byte(nil), buf[:n]...):
+		default:
+			// The association is not keeping up.
+		}
+	}
+}
+
+// relay dials the association for clientAddr and relays the packets until it's idle, fails or ctx is done.
+func (f *PacketForwarder) relay(ctx context.Context, pc net.PacketConn, clientAddr net.Addr, packets <-chan []byte) {
+	idleTimeout := f.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = DefaultPacketIdleTimeout
+	}
+	dialTimeout := f.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = DefaultPacketDialTimeout
+	}
+	dialCtx, cancelDial := context.WithTimeout(ctx, dialTimeout)
+	targetConn, err := f.dialer.DialPacket(dialCtx, f.remoteAddr)
+	cancelDial()
+	if err != nil {
+		return
+	}
+	responsesDone := make(chan struct{})
+	go func() {
+		defer close(responsesDone)
+		relayResponses(targetConn, pc, clientAddr, idleTimeout)
+	}()
+	defer func() {
+		targetConn.Close()
+		<-responsesDone
+	}()
+	for {
+		select {
+		case packet := <-packets:
+			targetConn.SetReadDeadline(time.Now().Add(idleTimeout))
+			targetConn.Write(packet)
+		case <-responsesDone:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// relayResponses writes the packets from targetConn to clientAddr until targetConn is idle or fails.
+func relayResponses(targetConn net.Conn, pc net.PacketConn, clientAddr net.Addr, idleTimeout time.Duration) {
+	defer targetConn.Close()
+	buf := make([]byte, maxPacketSize)
+	for {
+		targetConn.SetReadDeadline(time.Now().Add(idleTimeout))
+		n, err := targetConn.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := pc.WriteTo(buf[:n], clientAddr); err != nil {
+			return
+		}
+	}
+}
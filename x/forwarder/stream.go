@@ -0,0 +1,103 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package forwarder relays connections and datagrams accepted on local ports to fixed remote endpoints,
+// through any dialer, much like "ssh -L". It's useful to proxy applications that don't support SOCKS or HTTP proxies.
+//
+// For example, to make a local DNS resolver that forwards to 8.8.8.8 over a Shadowsocks server:
+//
+//	dialer, _ := configurl.NewDefaultProviders().NewPacketDialer(ctx, "ss://...")
+//	f, _ := forwarder.NewPacketForwarder(dialer, "8.8.8.8:53")
+//	pc, _ := net.ListenPacket("udp", "127.0.0.1:5353")
+//	f.Serve(pc)
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// StreamForwarder relays the connections accepted from a listener to a fixed remote address.
+type StreamForwarder struct {
+	dialer     transport.StreamDialer
+	remoteAddr string
+}
+
+// NewStreamForwarder creates a [StreamForwarder] that uses the dialer to connect to remoteAddr.
+func NewStreamForwarder(dialer transport.StreamDialer, remoteAddr string) (*StreamForwarder, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	return &StreamForwarder{dialer: dialer, remoteAddr: remoteAddr}, nil
+}
+
+// Serve accepts connections from the listener and relays them to the remote address until the listener is closed.
+// Then it closes the active connections and returns the error from Accept.
+func (f *StreamForwarder) Serve(listener net.Listener) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	var running sync.WaitGroup
+	defer func() {
+		cancel()
+		running.Wait()
+	}()
+	for {
+		clientConn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			f.relay(ctx, clientConn)
+		}()
+	}
+}
+
+func (f *StreamForwarder) relay(ctx context.Context, clientConn net.Conn) {
+	defer clientConn.Close()
+	stopClose := context.AfterFunc(ctx, func() { clientConn.Close() })
+	defer stopClose()
+
+	targetConn, err := f.dialer.DialStream(ctx, f.remoteAddr)
+	if err != nil {
+		return
+	}
+	defer targetConn.Close()
+	stopTargetClose := context.AfterFunc(ctx, func() { targetConn.Close() })
+	defer stopTargetClose()
+
+	copyDone := make(chan struct{})
+	go func() {
+		defer close(copyDone)
+		io.Copy(clientConn, targetConn)
+		closeWrite(clientConn)
+	}()
+	io.Copy(targetConn, clientConn)
+	targetConn.CloseWrite()
+	<-copyDone
+}
+
+// closeWrite closes the write end of conn, if supported, or the whole connection otherwise.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	conn.Close()
+}
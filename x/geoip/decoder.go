@@ -0,0 +1,272 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Data types from https://maxmind.github.io/MaxMind-DB/#output-data-section.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// maxDecodeDepth and maxDecodeCost limit the nesting and amount of data decoded for a record,
+// to protect against malicious databases. Each value costs one unit, plus its length for strings and bytes.
+const (
+	maxDecodeDepth = 32
+	maxDecodeCost  = 1 << 20
+)
+
+var (
+	errShortData   = errors.New("unexpected end of data")
+	errTooMuchData = errors.New("record has too much data")
+)
+
+// decoder decodes values from the data section of a database.
+type decoder struct {
+	buffer []byte
+}
+
+// decode decodes the value at offset, and returns it with the offset after it.
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	budget := maxDecodeCost
+	return d.decodeDepth(offset, 0, &budget)
+}
+
+func (d *decoder) decodeDepth(offset uint, depth int, budget *int) (any, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("data is nested too deeply")
+	}
+	if *budget--; *budget < 0 {
+		return nil, 0, errTooMuchData
+	}
+	dataType, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if dataType == typePointer {
+		pointer, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decodeDepth(pointer, depth+1, budget)
+		return value, next, err
+	}
+	return d.decodeValue(dataType, size, offset, depth, budget)
+}
+
+// decodeControl decodes the control byte and the size that follows it.
+func (d *decoder) decodeControl(offset uint) (dataType byte, size uint, next uint, err error) {
+	if offset >= uint(len(d.buffer)) {
+		return 0, 0, 0, errShortData
+	}
+	control := d.buffer[offset]
+	offset++
+	dataType = control >> 5
+	if dataType == typeExtended {
+		if offset >= uint(len(d.buffer)) {
+			return 0, 0, 0, errShortData
+		}
+		dataType = 7 + d.buffer[offset]
+		offset++
+	}
+	size = uint(control & 0x1f)
+	if dataType == typePointer {
+		return dataType, size, offset, nil
+	}
+	if size >= 29 {
+		extraBytes := size - 28
+		if offset+extraBytes > uint(len(d.buffer)) {
+			return 0, 0, 0, errShortData
+		}
+		extra := uint(0)
+		for _, b := range d.buffer[offset : offset+extraBytes] {
+			extra = extra<<8 | uint(b)
+		}
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+		offset += extraBytes
+	}
+	return dataType, size, offset, nil
+}
+
+// decodePointer decodes a pointer whose control byte had the given size bits.
+func (d *decoder) decodePointer(sizeBits uint, offset uint) (uint, uint, error) {
+	pointerSize := (sizeBits >> 3) & 0x3
+	numBytes := pointerSize + 1
+	if offset+numBytes > uint(len(d.buffer)) {
+		return 0, 0, errShortData
+	}
+	value := uint(0)
+	if pointerSize != 3 {
+		value = sizeBits & 0x7
+	}
+	for _, b := range d.buffer[offset : offset+numBytes] {
+		value = value<<8 | uint(b)
+	}
+	switch pointerSize {
+	case 1:
+		value += 2048
+	case 2:
+		value += 526336
+	}
+	return value, offset + numBytes, nil
+}
+
+func (d *decoder) bytesAt(offset, size uint) ([]byte, error) {
+	if offset+size > uint(len(d.buffer)) || offset+size < offset {
+		return nil, errShortData
+	}
+	return d.buffer[offset : offset+size], nil
+}
+
+func (d *decoder) decodeValue(dataType byte, size uint, offset uint, depth int, budget *int) (any, uint, error) {
+	switch dataType {
+	case typeString:
+		b, err := d.bytesAt(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		if *budget -= len(b); *budget < 0 {
+			return nil, 0, errTooMuchData
+		}
+		return string(b), offset + size, nil
+	case typeBytes:
+		b, err := d.bytesAt(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		if *budget -= len(b); *budget < 0 {
+			return nil, 0, errTooMuchData
+		}
+		return append([]byte(nil), b...), offset + size, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %v", size)
+		}
+		b, err := d.bytesAt(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset + size, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %v", size)
+		}
+		b, err := d.bytesAt(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset + size, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %v", size)
+		}
+		b, err := d.bytesAt(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		value := uint64(0)
+		for _, v := range b {
+			value = value<<8 | uint64(v)
+		}
+		return value, offset + size, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %v", size)
+		}
+		b, err := d.bytesAt(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		value := uint32(0)
+		for _, v := range b {
+			value = value<<8 | uint32(v)
+		}
+		return int64(int32(value)), offset + size, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %v", size)
+		}
+		b, err := d.bytesAt(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return new(big.Int).SetBytes(b), offset + size, nil
+	case typeBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("invalid boolean value %v", size)
+		}
+		return size == 1, offset, nil
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decodeDepth(offset, depth+1, budget)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			value, next, err := d.decodeDepth(next, depth+1, budget)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[keyStr] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		array := make([]any, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decodeDepth(offset, depth+1, budget)
+			if err != nil {
+				return nil, 0, err
+			}
+			array = append(array, value)
+			offset = next
+		}
+		return array, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %v", dataType)
+	}
+}
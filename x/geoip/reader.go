@@ -0,0 +1,236 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package geoip reads IP geolocation databases in the [MaxMind DB] format, as distributed by MaxMind and DB-IP,
+// to annotate IP addresses with their country and autonomous system (ASN).
+//
+// The package doesn't include any database. Apps must supply their own, and comply with its license.
+// Country information is read from the GeoIP2/GeoLite2 Country and City layouts, and ASN information
+// from the GeoLite2 ASN layout, which are also used by the DB-IP Lite databases.
+//
+// [MaxMind DB]: https://maxmind.github.io/MaxMind-DB/
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+)
+
+// metadataStartMarker precedes the metadata section at the end of the file.
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparatorSize is the size of the zeroed separator between the search tree and the data section.
+const dataSectionSeparatorSize = 16
+
+// ErrInvalidDatabase is returned, wrapped, when the database is malformed.
+var ErrInvalidDatabase = errors.New("invalid MaxMind DB database")
+
+// Metadata describes the database.
+type Metadata struct {
+	DatabaseType string
+	// IPVersion is 4 if the database only has IPv4 addresses, or 6 if it has both.
+	IPVersion  uint
+	NodeCount  uint
+	RecordSize uint
+	// BuildEpoch is the database build time, in seconds since the Unix epoch.
+	BuildEpoch uint64
+}
+
+// Reader looks up IP addresses in a MaxMind DB database loaded in memory.
+//
+// Multiple goroutines may invoke methods on a Reader simultaneously.
+type Reader struct {
+	tree     []byte
+	data     decoder
+	metadata Metadata
+	// ipv4Start is the node where IPv4 lookups start, after the ::/96 prefix in IPv6 databases.
+	ipv4Start uint
+}
+
+// Open reads the database file at path into memory.
+func Open(path string) (*Reader, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(buffer)
+}
+
+// NewReader creates a [Reader] for the database in buffer. The buffer must not be modified afterwards.
+func NewReader(buffer []byte) (*Reader, error) {
+	markerIndex := bytes.LastIndex(buffer, metadataStartMarker)
+	if markerIndex < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalidDatabase)
+	}
+	metadataDecoder := decoder{buffer: buffer[markerIndex+len(metadataStartMarker):]}
+	rawMetadata, _, err := metadataDecoder.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode metadata: %w", ErrInvalidDatabase, err)
+	}
+	metadataMap, ok := rawMetadata.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+	metadata := Metadata{
+		NodeCount:  uint(asUint(metadataMap["node_count"])),
+		RecordSize: uint(asUint(metadataMap["record_size"])),
+		IPVersion:  uint(asUint(metadataMap["ip_version"])),
+		BuildEpoch: asUint(metadataMap["build_epoch"]),
+	}
+	metadata.DatabaseType, _ = metadataMap["database_type"].(string)
+	if metadata.RecordSize != 24 && metadata.RecordSize != 28 && metadata.RecordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %v", ErrInvalidDatabase, metadata.RecordSize)
+	}
+	if metadata.IPVersion != 4 && metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %v", ErrInvalidDatabase, metadata.IPVersion)
+	}
+	if metadata.NodeCount > uint(markerIndex) {
+		return nil, fmt.Errorf("%w: search tree is larger than the file", ErrInvalidDatabase)
+	}
+	treeSize := metadata.NodeCount * metadata.RecordSize / 4
+	if treeSize+dataSectionSeparatorSize > uint(markerIndex) {
+		return nil, fmt.Errorf("%w: search tree is larger than the file", ErrInvalidDatabase)
+	}
+	r := &Reader{
+		tree:     buffer[:treeSize],
+		data:     decoder{buffer: buffer[treeSize+dataSectionSeparatorSize : markerIndex]},
+		metadata: metadata,
+	}
+	if metadata.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < metadata.NodeCount; i++ {
+			node = r.readRecord(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Metadata returns the metadata of the database.
+func (r *Reader) Metadata() Metadata {
+	return r.metadata
+}
+
+// readRecord returns the left (bit 0) or right (bit 1) record of the node.
+func (r *Reader) readRecord(node uint, bit byte) uint {
+	switch r.metadata.RecordSize {
+	case 24:
+		offset := node*6 + uint(bit)*3
+		b := r.tree[offset : offset+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7 : node*7+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		offset := node*8 + uint(bit)*4
+		b := r.tree[offset : offset+4]
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+	}
+}
+
+// Lookup returns the record for the IP address, decoded as maps, slices, strings, numbers and booleans,
+// or nil if the address is not in the database.
+func (r *Reader) Lookup(ip netip.Addr) (any, error) {
+	ip = ip.Unmap()
+	if !ip.IsValid() {
+		return nil, errors.New("invalid IP address")
+	}
+	node := uint(0)
+	if ip.Is4() && r.metadata.IPVersion == 6 {
+		node = r.ipv4Start
+	} else if ip.Is6() && r.metadata.IPVersion == 4 {
+		return nil, nil
+	}
+	ipBytes := ip.AsSlice()
+	nodeCount := r.metadata.NodeCount
+	for i := 0; i < len(ipBytes)*8 && node < nodeCount; i++ {
+		bit := (ipBytes[i/8] >> (7 - i%8)) & 1
+		node = r.readRecord(node, bit)
+	}
+	if node == nodeCount {
+		return nil, nil
+	}
+	if node < nodeCount {
+		return nil, fmt.Errorf("%w: search tree is too deep", ErrInvalidDatabase)
+	}
+	offset := node - nodeCount - dataSectionSeparatorSize
+	value, _, err := r.data.decode(offset)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode record: %w", ErrInvalidDatabase, err)
+	}
+	return value, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 country code of the IP address, or an empty string if unknown.
+// It falls back to the registered country if the location country is not available.
+func (r *Reader) Country(ip netip.Addr) (string, error) {
+	record, err := r.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		if code, ok := lookupPath(record, key, "iso_code").(string); ok && code != "" {
+			return code, nil
+		}
+	}
+	return "", nil
+}
+
+// CountryCode is like [Reader.Country], but returns an empty string on errors.
+// Its signature matches the country lookup function of the rules engine.
+func (r *Reader) CountryCode(ip netip.Addr) string {
+	code, _ := r.Country(ip)
+	return code
+}
+
+// ASN returns the autonomous system number and organization of the IP address, or zero if unknown.
+func (r *Reader) ASN(ip netip.Addr) (uint, string, error) {
+	record, err := r.Lookup(ip)
+	if err != nil {
+		return 0, "", err
+	}
+	asn := uint(asUint(lookupPath(record, "autonomous_system_number")))
+	org, _ := lookupPath(record, "autonomous_system_organization").(string)
+	return asn, org, nil
+}
+
+// lookupPath follows the map keys in the decoded record.
+func lookupPath(record any, keys ...string) any {
+	for _, key := range keys {
+		m, ok := record.(map[string]any)
+		if !ok {
+			return nil
+		}
+		record = m[key]
+	}
+	return record
+}
+
+func asUint(value any) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int64:
+		if v >= 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,266 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encodeValue encodes a value in the MaxMind DB data format. It supports the types used by the tests.
+func encodeValue(b []byte, value any) []byte {
+	switch v := value.(type) {
+	case string:
+		b = encodeControl(b, typeString, uint(len(v)))
+		return append(b, v...)
+	case uint16:
+		return encodeUint(b, typeUint16, uint64(v))
+	case uint32:
+		return encodeUint(b, typeUint32, uint64(v))
+	case uint64:
+		return encodeUint(b, typeUint64, v)
+	case map[string]any:
+		b = encodeControl(b, typeMap, uint(len(v)))
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			b = encodeValue(b, key)
+			b = encodeValue(b, v[key])
+		}
+		return b
+	default:
+		panic("unsupported type")
+	}
+}
+
+func encodeUint(b []byte, dataType byte, v uint64) []byte {
+	var digits []byte
+	for ; v > 0; v >>= 8 {
+		digits = append([]byte{byte(v)}, digits...)
+	}
+	b = encodeControl(b, dataType, uint(len(digits)))
+	return append(b, digits...)
+}
+
+func encodeControl(b []byte, dataType byte, size uint) []byte {
+	var control byte
+	extended := dataType > 7
+	if !extended {
+		control = dataType << 5
+	}
+	if size < 29 {
+		control |= byte(size)
+		b = append(b, control)
+		if extended {
+			b = append(b, dataType-7)
+		}
+		return b
+	}
+	control |= 29
+	b = append(b, control)
+	if extended {
+		b = append(b, dataType-7)
+	}
+	return append(b, byte(size-29))
+}
+
+type trieNode struct {
+	children [2]*trieNode
+	data     int
+	hasData  bool
+	index    uint
+}
+
+// buildDatabase creates a database with the given networks and records.
+func buildDatabase(t *testing.T, ipVersion uint16, recordSize uint16, networks map[string]map[string]any) []byte {
+	root := &trieNode{}
+	var data []byte
+	for prefixStr, record := range networks {
+		prefix := netip.MustParsePrefix(prefixStr)
+		ipBytes := prefix.Addr().AsSlice()
+		bits := prefix.Bits()
+		if ipVersion == 6 && prefix.Addr().Is4() {
+			ipBytes = append(make([]byte, 12), ipBytes...)
+			bits += 96
+		}
+		node := root
+		for i := 0; i < bits; i++ {
+			bit := (ipBytes[i/8] >> (7 - i%8)) & 1
+			if node.children[bit] == nil {
+				node.children[bit] = &trieNode{}
+			}
+			node = node.children[bit]
+		}
+		node.hasData = true
+		node.data = len(data)
+		data = encodeValue(data, record)
+	}
+	// Number the internal nodes.
+	var nodes []*trieNode
+	var number func(n *trieNode)
+	number = func(n *trieNode) {
+		if n == nil || n.hasData {
+			return
+		}
+		n.index = uint(len(nodes))
+		nodes = append(nodes, n)
+		number(n.children[0])
+		number(n.children[1])
+	}
+	number(root)
+	nodeCount := uint(len(nodes))
+	recordValue := func(n *trieNode) uint {
+		switch {
+		case n == nil:
+			return nodeCount
+		case n.hasData:
+			return nodeCount + dataSectionSeparatorSize + uint(n.data)
+		default:
+			return n.index
+		}
+	}
+	var buffer []byte
+	for _, n := range nodes {
+		left, right := recordValue(n.children[0]), recordValue(n.children[1])
+		switch recordSize {
+		case 24:
+			buffer = append(buffer, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			buffer = append(buffer, byte(left>>16), byte(left>>8), byte(left), byte((left>>24)<<4|(right>>24)&0x0F), byte(right>>16), byte(right>>8), byte(right))
+		default:
+			buffer = append(buffer, byte(left>>24), byte(left>>16), byte(left>>8), byte(left), byte(right>>24), byte(right>>16), byte(right>>8), byte(right))
+		}
+	}
+	buffer = append(buffer, make([]byte, dataSectionSeparatorSize)...)
+	buffer = append(buffer, data...)
+	buffer = append(buffer, metadataStartMarker...)
+	buffer = encodeValue(buffer, map[string]any{
+		"node_count":    uint32(nodeCount),
+		"record_size":   recordSize,
+		"ip_version":    ipVersion,
+		"database_type": "Test-Country-ASN",
+		"build_epoch":   uint64(1700000000),
+	})
+	return buffer
+}
+
+var testNetworks = map[string]map[string]any{
+	"1.2.3.0/24": {
+		"country":                        map[string]any{"iso_code": "AU"},
+		"autonomous_system_number":       uint32(13335),
+		"autonomous_system_organization": "Example Org",
+	},
+	"5.6.0.0/16": {
+		"registered_country": map[string]any{"iso_code": "IR"},
+	},
+	"2001:db8::/32": {
+		"country": map[string]any{"iso_code": "BR", "names": map[string]any{"en": "Brazil"}},
+	},
+}
+
+func TestReader(t *testing.T) {
+	for _, recordSize := range []uint16{24, 28, 32} {
+		reader, err := NewReader(buildDatabase(t, 6, recordSize, testNetworks))
+		require.NoError(t, err)
+		require.Equal(t, "Test-Country-ASN", reader.Metadata().DatabaseType)
+		require.Equal(t, uint(recordSize), reader.Metadata().RecordSize)
+		require.Equal(t, uint64(1700000000), reader.Metadata().BuildEpoch)
+
+		country, err := reader.Country(netip.MustParseAddr("1.2.3.4"))
+		require.NoError(t, err)
+		require.Equal(t, "AU", country)
+		require.Equal(t, "AU", reader.CountryCode(netip.MustParseAddr("::ffff:1.2.3.255")))
+		require.Equal(t, "IR", reader.CountryCode(netip.MustParseAddr("5.6.7.8")))
+		require.Equal(t, "BR", reader.CountryCode(netip.MustParseAddr("2001:db8::1")))
+		require.Equal(t, "", reader.CountryCode(netip.MustParseAddr("8.8.8.8")))
+
+		asn, org, err := reader.ASN(netip.MustParseAddr("1.2.3.4"))
+		require.NoError(t, err)
+		require.Equal(t, uint(13335), asn)
+		require.Equal(t, "Example Org", org)
+
+		record, err := reader.Lookup(netip.MustParseAddr("2001:db8::1"))
+		require.NoError(t, err)
+		require.Equal(t, "Brazil", lookupPath(record, "country", "names", "en"))
+		record, err = reader.Lookup(netip.MustParseAddr("2001:db9::1"))
+		require.NoError(t, err)
+		require.Nil(t, record)
+	}
+}
+
+func TestReader_IPv4Database(t *testing.T) {
+	reader, err := NewReader(buildDatabase(t, 4, 24, map[string]map[string]any{
+		"1.2.3.0/24": {"country": map[string]any{"iso_code": "AU"}},
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "AU", reader.CountryCode(netip.MustParseAddr("1.2.3.4")))
+	require.Equal(t, "", reader.CountryCode(netip.MustParseAddr("2001:db8::1")))
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	require.NoError(t, os.WriteFile(path, buildDatabase(t, 6, 24, testNetworks), 0o600))
+	reader, err := Open(path)
+	require.NoError(t, err)
+	require.Equal(t, "AU", reader.CountryCode(netip.MustParseAddr("1.2.3.4")))
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	require.Error(t, err)
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+	_, err := NewReader([]byte("not a database"))
+	require.ErrorIs(t, err, ErrInvalidDatabase)
+
+	// Truncated search tree.
+	db := buildDatabase(t, 6, 24, testNetworks)
+	_, err = NewReader(append([]byte(nil), db[len(db)-200:]...))
+	require.ErrorIs(t, err, ErrInvalidDatabase)
+}
+
+func TestDecoder_Pointer(t *testing.T) {
+	// A map whose value is a pointer to a string at offset 0.
+	buffer := encodeValue(nil, "value")
+	mapOffset := uint(len(buffer))
+	buffer = encodeControl(buffer, typeMap, 1)
+	buffer = encodeValue(buffer, "key")
+	buffer = append(buffer, typePointer<<5, 0)
+	d := decoder{buffer: buffer}
+	value, next, err := d.decode(mapOffset)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"key": "value"}, value)
+	require.Equal(t, uint(len(buffer)), next)
+}
+
+func FuzzNewReader(f *testing.F) {
+	f.Add([]byte(nil))
+	f.Add(buildDatabase(nil, 6, 24, testNetworks))
+	f.Fuzz(func(t *testing.T, buffer []byte) {
+		reader, err := NewReader(buffer)
+		if err != nil {
+			return
+		}
+		reader.Lookup(netip.MustParseAddr("1.2.3.4"))
+		reader.Lookup(netip.MustParseAddr("2001:db8::1"))
+	})
+}
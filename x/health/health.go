@@ -0,0 +1,285 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package health tracks the health of upstream endpoints, like proxy servers, so that dialers can skip the ones that are
+down instead of waiting for their timeouts.
+
+A [Breaker] is a circuit breaker for one upstream. It becomes [Unavailable] after consecutive failures, lets a trial
+dial through after a cooldown, and becomes [Available] again when a dial or a probe succeeds. [NewStreamDialer] wraps
+the dialer of an upstream with its breaker, a [Checker] probes the upstream periodically, and [NewFailoverStreamDialer]
+uses the first upstream that is not down:
+
+	breakers := []*health.Breaker{{OnStateChange: showState}, {OnStateChange: showState}}
+	dialer := health.NewFailoverStreamDialer(
+		health.NewStreamDialer(primary, breakers[0]),
+		health.NewStreamDialer(backup, breakers[1]),
+	)
+	checker := &health.Checker{Interval: time.Minute}
+	go checker.Run(ctx, health.TCPProbe(primary, primaryAddress), breakers[0])
+	go checker.Run(ctx, health.TCPProbe(backup, backupAddress), breakers[1])
+*/
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+const (
+	// DefaultFailureThreshold is the FailureThreshold of a [Breaker] if zero.
+	DefaultFailureThreshold = 3
+	// DefaultCooldown is the Cooldown of a [Breaker] if zero.
+	DefaultCooldown = 30 * time.Second
+)
+
+// ErrUnavailable is returned by the dialers of [NewStreamDialer] when their upstream is unavailable.
+var ErrUnavailable = errors.New("upstream is unavailable")
+
+// State is the health state of an upstream.
+type State int
+
+const (
+	// Available means the upstream is working, or hasn't failed enough times to be considered down.
+	Available State = iota
+	// Unavailable means the upstream is down, so dials fail right away.
+	Unavailable
+	// Probing means a trial dial to an unavailable upstream is in progress, and other dials fail right away.
+	Probing
+)
+
+func (s State) String() string {
+	switch s {
+	case Available:
+		return "available"
+	case Unavailable:
+		return "unavailable"
+	case Probing:
+		return "probing"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Breaker is a circuit breaker that tracks the health of an upstream. The zero value is an available breaker with
+// the default settings. It's safe for concurrent use, but the fields must not be changed after first use.
+type Breaker struct {
+	// FailureThreshold is the number of consecutive failures that make the upstream unavailable.
+	// If zero, DefaultFailureThreshold is used.
+	FailureThreshold int
+	// Cooldown is how long the upstream stays unavailable before a trial dial. If zero, DefaultCooldown is used.
+	Cooldown time.Duration
+	// OnStateChange, if not nil, is called after each state transition, for instance to display the state.
+	// It's called without holding locks, so transitions that happen close together may be reported out of order.
+	OnStateChange func(from, to State)
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	lastError error
+	// now returns the current time. It's time.Now if nil.
+	now func() time.Time
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown == 0 {
+		return DefaultCooldown
+	}
+	return b.Cooldown
+}
+
+func (b *Breaker) failureThreshold() int {
+	if b.FailureThreshold == 0 {
+		return DefaultFailureThreshold
+	}
+	return b.FailureThreshold
+}
+
+func (b *Breaker) timeNow() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// State returns the current state of the upstream.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// LastError returns the error of the last failure, or nil if the last result was a success.
+func (b *Breaker) LastError() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastError
+}
+
+// Allow reports whether a dial to the upstream should be attempted. After the cooldown, it allows a single trial dial
+// and moves to [Probing]. Every allowed dial must be followed by a call to Report.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	switch b.state {
+	case Available:
+		b.mu.Unlock()
+		return true
+	case Unavailable:
+		if b.timeNow().Sub(b.openedAt) >= b.cooldown() {
+			b.setStateLocked(Probing)
+			return true
+		}
+	}
+	b.mu.Unlock()
+	return false
+}
+
+// Report records the result of a dial or probe. A success makes the upstream available, and a failure counts towards
+// the threshold, or makes a probing upstream unavailable again.
+func (b *Breaker) Report(err error) {
+	b.mu.Lock()
+	b.lastError = err
+	if err == nil {
+		b.failures = 0
+		b.setStateLocked(Available)
+		return
+	}
+	b.failures++
+	if b.state == Probing || b.failures >= b.failureThreshold() {
+		b.openedAt = b.timeNow()
+		b.setStateLocked(Unavailable)
+		return
+	}
+	b.mu.Unlock()
+}
+
+// release ends a trial dial that had no result, for instance because it was canceled, so the next dial is a trial.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	if b.state != Probing {
+		b.mu.Unlock()
+		return
+	}
+	b.openedAt = b.timeNow().Add(-b.cooldown())
+	b.setStateLocked(Unavailable)
+}
+
+// setStateLocked sets the state, unlocks mu and calls OnStateChange if the state changed.
+func (b *Breaker) setStateLocked(state State) {
+	from := b.state
+	b.state = state
+	b.mu.Unlock()
+	if from != state && b.OnStateChange != nil {
+		b.OnStateChange(from, state)
+	}
+}
+
+// NewStreamDialer returns a dialer that dials with the dialer while the breaker allows it, and reports the results
+// to the breaker. Otherwise it fails with [ErrUnavailable] without dialing. Dials canceled by the caller are not
+// reported.
+func NewStreamDialer(dialer transport.StreamDialer, breaker *Breaker) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		if !breaker.Allow() {
+			return nil, ErrUnavailable
+		}
+		conn, err := dialer.DialStream(ctx, addr)
+		if err != nil && ctx.Err() != nil {
+			breaker.release()
+			return nil, err
+		}
+		breaker.Report(err)
+		return conn, err
+	})
+}
+
+// NewFailoverStreamDialer returns a dialer that tries the dialers in order, and returns the first connection.
+// Dialers created with [NewStreamDialer] for unavailable upstreams fail right away, so the next one is tried without
+// delay. If all fail, it returns the errors of all of them.
+func NewFailoverStreamDialer(dialers ...transport.StreamDialer) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		var errs []error
+		for i, dialer := range dialers {
+			conn, err := dialer.DialStream(ctx, addr)
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, fmt.Errorf("dialer %d failed: %w", i, err))
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if len(errs) == 0 {
+			return nil, errors.New("no dialers")
+		}
+		return nil, errors.Join(errs...)
+	})
+}
+
+// Probe checks whether an upstream works.
+type Probe func(ctx context.Context) error
+
+// TCPProbe returns a [Probe] that connects to the address with the dialer. For a proxy, use the base dialer and the
+// address of the proxy server, or the proxy dialer and a destination to check the proxy end to end.
+func TCPProbe(dialer transport.StreamDialer, address string) Probe {
+	return func(ctx context.Context) error {
+		conn, err := dialer.DialStream(ctx, address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// Checker runs probes periodically.
+type Checker struct {
+	// Interval is the time between probes. If zero, one minute is used.
+	Interval time.Duration
+	// Timeout limits each probe. If zero, 10 seconds is used.
+	Timeout time.Duration
+}
+
+// Run probes the upstream every interval, starting right away, and reports the results to the breaker until the
+// context is done. Successful probes make an unavailable upstream available without waiting for the cooldown.
+func (c *Checker) Run(ctx context.Context, probe Probe, breaker *Breaker) {
+	interval := c.Interval
+	if interval == 0 {
+		interval = time.Minute
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := probe(probeCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		breaker.Report(err)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a manually advanced clock for breakers.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	var transitions []string
+	b := &Breaker{FailureThreshold: 2, Cooldown: time.Second, now: clock.Now, OnStateChange: func(from, to State) {
+		transitions = append(transitions, from.String()+"->"+to.String())
+	}}
+	errDial := errors.New("dial failed")
+
+	require.True(t, b.Allow())
+	b.Report(errDial)
+	require.Equal(t, Available, b.State())
+	require.True(t, b.Allow())
+	b.Report(errDial)
+	require.Equal(t, Unavailable, b.State())
+	require.ErrorIs(t, b.LastError(), errDial)
+	require.False(t, b.Allow())
+
+	// A single trial after the cooldown.
+	clock.now = clock.now.Add(time.Second)
+	require.True(t, b.Allow())
+	require.Equal(t, Probing, b.State())
+	require.False(t, b.Allow())
+	b.Report(errDial)
+	require.Equal(t, Unavailable, b.State())
+	require.False(t, b.Allow())
+
+	clock.now = clock.now.Add(time.Second)
+	require.True(t, b.Allow())
+	b.Report(nil)
+	require.Equal(t, Available, b.State())
+	require.NoError(t, b.LastError())
+
+	require.Equal(t, []string{"available->unavailable", "unavailable->probing", "probing->unavailable", "unavailable->probing", "probing->available"}, transitions)
+	require.Equal(t, "State(9)", State(9).String())
+}
+
+func TestBreaker_Release(t *testing.T) {
+	b := &Breaker{FailureThreshold: 1, Cooldown: time.Hour}
+	b.Report(errors.New("failed"))
+	b.openedAt = b.openedAt.Add(-time.Hour)
+	require.True(t, b.Allow())
+	b.release()
+	require.Equal(t, Unavailable, b.State())
+	// The next dial is a trial, without waiting for another cooldown.
+	require.True(t, b.Allow())
+}
+
+// fakeConn is a connection that does nothing.
+type fakeConn struct {
+	net.TCPConn
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func TestFailoverStreamDialer(t *testing.T) {
+	var mu sync.Mutex
+	var dials []string
+	newDialer := func(name string, err error) transport.StreamDialer {
+		return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+			mu.Lock()
+			dials = append(dials, name)
+			mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return &fakeConn{}, nil
+		})
+	}
+	primaryBreaker := &Breaker{FailureThreshold: 1, Cooldown: time.Hour}
+	dialer := NewFailoverStreamDialer(
+		NewStreamDialer(newDialer("primary", errors.New("down")), primaryBreaker),
+		NewStreamDialer(newDialer("backup", nil), &Breaker{}),
+	)
+	for i := 0; i < 2; i++ {
+		conn, err := dialer.DialStream(context.Background(), "example.com:443")
+		require.NoError(t, err)
+		conn.Close()
+	}
+	// The primary is skipped once it's unavailable.
+	require.Equal(t, []string{"primary", "backup", "backup"}, dials)
+	require.Equal(t, Unavailable, primaryBreaker.State())
+
+	_, err := NewFailoverStreamDialer().DialStream(context.Background(), "example.com:443")
+	require.Error(t, err)
+}
+
+func TestStreamDialer_CanceledDialNotReported(t *testing.T) {
+	breaker := &Breaker{FailureThreshold: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dialer := NewStreamDialer(transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		return nil, ctx.Err()
+	}), breaker)
+	_, err := dialer.DialStream(ctx, "example.com:443")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, Available, breaker.State())
+}
+
+func TestChecker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	breaker := &Breaker{FailureThreshold: 1, Cooldown: time.Hour}
+	breaker.Report(errors.New("failed"))
+	require.Equal(t, Unavailable, breaker.State())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		(&Checker{Interval: 10 * time.Millisecond}).Run(ctx, TCPProbe(&transport.TCPDialer{}, address), breaker)
+	}()
+	// A successful probe makes it available without waiting for the cooldown.
+	require.Eventually(t, func() bool { return breaker.State() == Available }, 5*time.Second, 5*time.Millisecond)
+
+	listener.Close()
+	require.Eventually(t, func() bool { return breaker.State() == Unavailable }, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpconnect
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// maxAuthRounds limits the number of challenges in an authentication. NTLM takes two, and Negotiate up to three.
+const maxAuthRounds = 4
+
+// Authenticator authenticates the CONNECT requests with a connection-based challenge-response scheme, like NTLM or
+// Negotiate (Kerberos, with NTLM as fallback), which Windows enterprise proxies commonly require. The challenges and
+// responses are exchanged on the connection that is then used for the tunnel.
+//
+// Use [NewSSPIAuthenticator] on Windows to authenticate as the current user.
+type Authenticator interface {
+	// Scheme returns the authentication scheme of the Proxy-Authorization header, like "Negotiate" or "NTLM".
+	Scheme() string
+	// NewSession starts the authentication of a new connection to the proxy at proxyAddr.
+	NewSession(proxyAddr string) (AuthSession, error)
+}
+
+// AuthSession is the authentication state of a connection to the proxy.
+type AuthSession interface {
+	// Next returns the token to send in response to the challenge of the proxy, or the initial token if challenge
+	// is nil.
+	Next(challenge []byte) ([]byte, error)
+	// Close releases the resources of the session.
+	Close() error
+}
+
+// ErrProxyAuthRejected is returned when the proxy rejects the authentication.
+var ErrProxyAuthRejected = errors.New("proxy rejected the authentication")
+
+// WithAuthenticator authenticates the CONNECT requests with auth. The headers set with [WithHeaders] are sent with
+// every request of the authentication, except for Proxy-Authorization.
+func WithAuthenticator(auth Authenticator) ClientOption {
+	return func(c *connectClient) {
+		c.auth = auth
+	}
+}
+
+// doAuthenticatedConnect sends the CONNECT request on conn, and answers the challenges of the proxy until it
+// accepts or rejects the request.
+func (cc *connectClient) doAuthenticatedConnect(ctx context.Context, remoteAddr string, conn transport.StreamConn) (transport.StreamConn, error) {
+	session, err := cc.auth.NewSession(cc.proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %v authentication: %w", cc.auth.Scheme(), err)
+	}
+	defer session.Close()
+
+	// Unblock the exchange if the context is cancelled.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	token, err := session.Next(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %v token: %w", cc.auth.Scheme(), err)
+	}
+	reader := bufio.NewReader(conn)
+	for round := 0; ; round++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodConnect, "http://"+remoteAddr, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		mergeHeaders(req.Header, cc.headers)
+		req.Header.Set("Proxy-Authorization", cc.auth.Scheme()+" "+base64.StdEncoding.EncodeToString(token))
+		if err := req.Write(conn); err != nil {
+			return nil, fmt.Errorf("failed to write request: %w", err)
+		}
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, fmt.Errorf("%w: %w", ctxErr, err)
+			}
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			// The response to CONNECT has no body, and the buffered data belongs to the tunnel.
+			conn.SetDeadline(time.Time{})
+			return transport.WrapConn(conn, reader, conn), nil
+		}
+		// Consume the body, so the next response can be read.
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		if resp.StatusCode != http.StatusProxyAuthRequired {
+			return nil, statusError(resp.StatusCode)
+		}
+		challenge, ok := findChallenge(resp.Header, cc.auth.Scheme())
+		if !ok || len(challenge) == 0 {
+			return nil, fmt.Errorf("%w: %v", ErrProxyAuthRejected, resp.Status)
+		}
+		if resp.Close {
+			return nil, errors.New("proxy closed the connection during the authentication")
+		}
+		if round+1 >= maxAuthRounds {
+			return nil, fmt.Errorf("%w: too many challenges", ErrProxyAuthRejected)
+		}
+		if token, err = session.Next(challenge); err != nil {
+			return nil, fmt.Errorf("failed to answer %v challenge: %w", cc.auth.Scheme(), err)
+		}
+	}
+}
+
+// findChallenge returns the decoded challenge of the scheme in the Proxy-Authenticate headers. It returns an empty
+// challenge if the scheme is offered without one, and false if it's not offered.
+func findChallenge(header http.Header, scheme string) ([]byte, bool) {
+	for _, value := range header.Values("Proxy-Authenticate") {
+		name, data, _ := strings.Cut(strings.TrimSpace(value), " ")
+		if !strings.EqualFold(name, scheme) {
+			continue
+		}
+		challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return nil, true
+		}
+		return challenge, true
+	}
+	return nil, false
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpconnect
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectClient_Authenticator(t *testing.T) {
+	proxyAddr := startChallengeProxy(t, true)
+	auth := &testAuthenticator{}
+	client, err := NewConnectClient(&transport.TCPDialer{}, proxyAddr, WithAuthenticator(auth),
+		WithHeaders(http.Header{"X-Test": []string{"1"}}))
+	require.NoError(t, err)
+
+	conn, err := client.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	defer conn.Close()
+	// The proxy sends a greeting right after the response, which must not be lost in the buffer.
+	greeting := make([]byte, len("tunnel:example.com:443"))
+	_, err = io.ReadFull(conn, greeting)
+	require.NoError(t, err)
+	require.Equal(t, "tunnel:example.com:443", string(greeting))
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	echo := make([]byte, 4)
+	_, err = io.ReadFull(conn, echo)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(echo))
+	require.Equal(t, 1, auth.closed)
+}
+
+func TestConnectClient_AuthenticatorRejected(t *testing.T) {
+	proxyAddr := startChallengeProxy(t, false)
+	client, err := NewConnectClient(&transport.TCPDialer{}, proxyAddr, WithAuthenticator(&testAuthenticator{}))
+	require.NoError(t, err)
+	_, err = client.DialStream(context.Background(), "example.com:443")
+	require.ErrorIs(t, err, ErrProxyAuthRejected)
+}
+
+func TestConnectClient_AuthenticatorSessionError(t *testing.T) {
+	proxyAddr := startChallengeProxy(t, true)
+	sessionErr := errors.New("no credentials")
+	client, err := NewConnectClient(&transport.TCPDialer{}, proxyAddr, WithAuthenticator(&testAuthenticator{err: sessionErr}))
+	require.NoError(t, err)
+	_, err = client.DialStream(context.Background(), "example.com:443")
+	require.ErrorIs(t, err, sessionErr)
+}
+
+func TestFindChallenge(t *testing.T) {
+	header := http.Header{}
+	header.Add("Proxy-Authenticate", "Basic realm=\"proxy\"")
+	header.Add("Proxy-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString([]byte("challenge")))
+	challenge, ok := findChallenge(header, "ntlm")
+	require.True(t, ok)
+	require.Equal(t, "challenge", string(challenge))
+
+	header = http.Header{"Proxy-Authenticate": []string{"Negotiate"}}
+	challenge, ok = findChallenge(header, "Negotiate")
+	require.True(t, ok)
+	require.Empty(t, challenge)
+	_, ok = findChallenge(header, "NTLM")
+	require.False(t, ok)
+}
+
+/********** Test Utilities **********/
+
+// testAuthenticator is a two-round scheme: it sends "hello", and answers the challenge with "answer:" + challenge.
+type testAuthenticator struct {
+	err    error
+	closed int
+}
+
+func (a *testAuthenticator) Scheme() string {
+	return "Test"
+}
+
+func (a *testAuthenticator) NewSession(proxyAddr string) (AuthSession, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	return &testSession{auth: a}, nil
+}
+
+type testSession struct {
+	auth *testAuthenticator
+}
+
+func (s *testSession) Next(challenge []byte) ([]byte, error) {
+	if challenge == nil {
+		return []byte("hello"), nil
+	}
+	return append([]byte("answer:"), challenge...), nil
+}
+
+func (s *testSession) Close() error {
+	s.auth.closed++
+	return nil
+}
+
+// startChallengeProxy runs a proxy that challenges the "hello" token, and accepts the right answer if accept is true.
+// On success, it writes "tunnel:" and the target, and echoes the data.
+func startChallengeProxy(t *testing.T, accept bool) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveChallenge(conn, accept)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveChallenge(conn net.Conn, accept bool) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+		switch req.Header.Get("Proxy-Authorization") {
+		case "Test " + base64.StdEncoding.EncodeToString([]byte("hello")):
+			challenge := base64.StdEncoding.EncodeToString([]byte("nonce"))
+			fmt.Fprintf(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Test %v\r\nContent-Length: 6\r\n\r\ndenied", challenge)
+		case "Test " + base64.StdEncoding.EncodeToString([]byte("answer:nonce")):
+			if !accept || req.Header.Get("X-Test") != "1" {
+				fmt.Fprint(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+				return
+			}
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\n\r\ntunnel:%v", req.Host)
+			io.Copy(conn, reader)
+			return
+		default:
+			fmt.Fprint(conn, "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n")
+			return
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/tls"
 	"io"
 	"net"
 	"net/http"
@@ -31,6 +32,8 @@ type connectClient struct {
 	proxyAddr string
 
 	headers http.Header
+	auth    Authenticator
+	h2c     bool
 }
 
 var _ transport.StreamDialer = (*connectClient)(nil)
@@ -55,6 +58,9 @@ func NewConnectClient(dialer transport.StreamDialer, proxyAddr string, opts ...C
 	for _, opt := range opts {
 		opt(cc)
 	}
+	if cc.h2c && cc.auth != nil {
+		return nil, errH2CWithAuthenticator
+	}
 
 	return cc, nil
 }
@@ -76,7 +82,7 @@ func (cc *connectClient) DialStream(ctx context.Context, remoteAddr string) (tra
 	conn, err := cc.doConnect(ctx, remoteAddr, innerConn)
 	if err != nil {
 		_ = innerConn.Close()
-		return nil, fmt.Errorf("doConnect %s: %w", remoteAddr, err)
+		return nil, transport.NewHandshakeError(fmt.Errorf("doConnect %s: %w", remoteAddr, err), transport.ErrProxyHandshake)
 	}
 
 	return conn, nil
@@ -87,6 +93,12 @@ func (cc *connectClient) doConnect(ctx context.Context, remoteAddr string, conn
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse remote address %s: %w", remoteAddr, err)
 	}
+	if cc.auth != nil {
+		return cc.doAuthenticatedConnect(ctx, remoteAddr, conn)
+	}
+	if cc.h2c || tls.NegotiatedProtocol(conn) == "h2" {
+		return cc.doConnectHTTP2(ctx, remoteAddr, conn)
+	}
 
 	pr, pw := io.Pipe()
 
@@ -98,9 +110,8 @@ func (cc *connectClient) doConnect(ctx context.Context, remoteAddr string, conn
 	mergeHeaders(req.Header, cc.headers)
 
 	tr := &http.Transport{
-		// TODO: HTTP/2 support with [http2.ConfigureTransport]
 		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return conn, nil
+			return &bodyClosingConn{StreamConn: conn, body: pw}, nil
 		},
 	}
 
@@ -114,7 +125,7 @@ func (cc *connectClient) doConnect(ctx context.Context, remoteAddr string, conn
 	}
 	if resp.StatusCode != http.StatusOK {
 		_ = resp.Body.Close()
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, statusError(resp.StatusCode)
 	}
 
 	return &pipeConn{
@@ -124,6 +135,30 @@ func (cc *connectClient) doConnect(ctx context.Context, remoteAddr string, conn
 	}, nil
 }
 
+// statusError returns the error for an unexpected status code of the CONNECT response. Gateway errors mean the proxy
+// couldn't reach the destination.
+func statusError(statusCode int) error {
+	err := fmt.Errorf("unexpected status code: %d", statusCode)
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return transport.WithErrorClass(err, transport.ErrUpstreamUnreachable)
+	default:
+		return transport.WithErrorClass(err, transport.ErrProxyHandshake)
+	}
+}
+
+// bodyClosingConn closes the request body when the connection is closed. Otherwise the transport
+// would wait forever for the body if the proxy closes the connection before responding.
+type bodyClosingConn struct {
+	transport.StreamConn
+	body *io.PipeWriter
+}
+
+func (c *bodyClosingConn) Close() error {
+	c.body.CloseWithError(net.ErrClosed)
+	return c.StreamConn.Close()
+}
+
 func mergeHeaders(dst http.Header, src http.Header) {
 	for k, v := range src {
 		dst[k] = append(dst[k], v...)
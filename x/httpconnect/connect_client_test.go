@@ -20,12 +20,14 @@ import (
 	"encoding/base64"
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 	"github.com/Jigsaw-Code/outline-sdk/x/httpproxy"
+	"github.com/Jigsaw-Code/outline-sdk/x/proxytest"
 	"github.com/stretchr/testify/require"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 func TestConnectClientOk(t *testing.T) {
@@ -106,4 +108,41 @@ func TestConnectClientFail(t *testing.T) {
 
 	_, err = connClient.DialStream(context.Background(), targetURL)
 	require.Error(t, err, "unexpected status code: 400")
+	require.Equal(t, transport.ErrProxyHandshake, transport.ErrorClass(err))
+}
+
+func TestConnectClientBadGateway(t *testing.T) {
+	t.Parallel()
+
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxySrv.Close()
+
+	proxyURL, err := url.Parse(proxySrv.URL)
+	require.NoError(t, err, "Parse")
+	connClient, err := NewConnectClient(&transport.TCPDialer{}, proxyURL.Host)
+	require.NoError(t, err, "NewConnectClient")
+
+	_, err = connClient.DialStream(context.Background(), "somehost:1234")
+	require.ErrorIs(t, err, transport.ErrUpstreamUnreachable)
+	require.NotErrorIs(t, err, transport.ErrProxyHandshake)
+}
+
+func TestConnectClientTruncatedResponse(t *testing.T) {
+	t.Parallel()
+
+	proxySrv, err := proxytest.NewHTTPConnectServer(proxytest.Config{Fault: proxytest.TruncatedReply})
+	require.NoError(t, err)
+	defer proxySrv.Close()
+
+	connClient, err := NewConnectClient(&transport.TCPDialer{}, proxySrv.Addr())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = connClient.DialStream(ctx, "example.com:443")
+	require.Error(t, err)
+	require.NoError(t, ctx.Err(), "DialStream must fail without waiting for the timeout")
+	require.ErrorIs(t, err, transport.ErrProxyHandshake)
 }
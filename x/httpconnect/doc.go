@@ -13,4 +13,12 @@
 // limitations under the License.
 
 // Package httpconnect contains an HTTP CONNECT client implementation.
+//
+// The client sends the CONNECT requests with HTTP/2 if the connection to the proxy is a TLS connection that negotiated
+// "h2" with ALPN (see [github.com/Jigsaw-Code/outline-sdk/transport/tls.WithALPN]), or if [WithH2C] is set for
+// cleartext HTTP/2 proxies. Otherwise it uses HTTP/1.1.
+//
+// Proxies that require a connection-based authentication, like NTLM or Negotiate on Windows enterprise networks, are
+// supported with [WithAuthenticator]. Use [NewSSPIAuthenticator] to authenticate as the current Windows user, and
+// [github.com/Jigsaw-Code/outline-sdk/x/npipe] to reach local proxies that listen on named pipes.
 package httpconnect
@@ -0,0 +1,83 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"golang.org/x/net/http2"
+)
+
+var errH2CWithAuthenticator = errors.New("h2c can't be used with an authenticator")
+
+// WithH2C sends the CONNECT requests with HTTP/2 over cleartext (h2c), with prior knowledge that the proxy supports it.
+// Without it, HTTP/2 is only used if the connection to the proxy is a TLS connection that negotiated "h2" with ALPN.
+// It can't be combined with [WithAuthenticator], since the connection-based authentications require HTTP/1.1.
+func WithH2C() ClientOption {
+	return func(c *connectClient) {
+		c.h2c = true
+	}
+}
+
+// doConnectHTTP2 sends the CONNECT request on a new HTTP/2 stream over conn, as specified in
+// https://datatracker.ietf.org/doc/html/rfc9113#section-8.5.
+func (cc *connectClient) doConnectHTTP2(ctx context.Context, remoteAddr string, conn transport.StreamConn) (transport.StreamConn, error) {
+	pr, pw := io.Pipe()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodConnect, "http://"+remoteAddr, pr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.ContentLength = -1 // -1 means length unknown
+	mergeHeaders(req.Header, cc.headers)
+
+	clientConn, err := (&http2.Transport{}).NewClientConn(&bodyClosingConn{StreamConn: conn, body: pw})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start HTTP/2: %w", err)
+	}
+	resp, err := clientConn.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("do: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, statusError(resp.StatusCode)
+	}
+
+	return &http2Conn{pipeConn{
+		reader:     resp.Body,
+		writer:     pw,
+		StreamConn: conn,
+	}}, nil
+}
+
+// http2Conn is a [transport.StreamConn] over an HTTP/2 stream. The half-closes only apply to the stream, since the
+// connection still carries the frames of the other direction.
+type http2Conn struct {
+	pipeConn
+}
+
+func (c *http2Conn) CloseRead() error {
+	return c.reader.Close()
+}
+
+func (c *http2Conn) CloseWrite() error {
+	return c.writer.Close()
+}
@@ -0,0 +1,132 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpconnect
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/tls"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func TestConnectClientH2C(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: http.HandlerFunc(echoConnectHandler)})
+		}
+	}()
+
+	connClient, err := NewConnectClient(&transport.TCPDialer{}, listener.Addr().String(), WithH2C())
+	require.NoError(t, err, "NewConnectClient")
+	conn, err := connClient.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err, "DialStream")
+	defer conn.Close()
+	require.Equal(t, "HTTP/2.0 example.com:443 Request", requestEcho(t, conn))
+}
+
+func TestConnectClientH2C_WithAuthenticator(t *testing.T) {
+	_, err := NewConnectClient(&transport.TCPDialer{}, "proxy.example:8080", WithH2C(), WithAuthenticator(&testAuthenticator{}))
+	require.ErrorIs(t, err, errH2CWithAuthenticator)
+}
+
+func TestConnectClientTLSALPN(t *testing.T) {
+	t.Parallel()
+
+	proxySrv := httptest.NewUnstartedServer(http.HandlerFunc(echoConnectHandler))
+	proxySrv.EnableHTTP2 = true
+	proxySrv.StartTLS()
+	defer proxySrv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(proxySrv.Certificate())
+	proxyAddr := proxySrv.Listener.Addr().String()
+
+	for _, protocol := range []string{"h2", "http/1.1"} {
+		protocol := protocol
+		t.Run(protocol, func(t *testing.T) {
+			tlsDialer, err := tls.NewStreamDialer(&transport.TCPDialer{},
+				tls.WithALPN([]string{protocol}),
+				tls.WithCertVerifier(&tls.StandardCertVerifier{CertificateName: "127.0.0.1", Roots: roots}))
+			require.NoError(t, err)
+			connClient, err := NewConnectClient(tlsDialer, proxyAddr)
+			require.NoError(t, err, "NewConnectClient")
+			conn, err := connClient.DialStream(context.Background(), "example.com:443")
+			require.NoError(t, err, "DialStream")
+			defer conn.Close()
+			proto := "HTTP/2.0"
+			if protocol == "http/1.1" {
+				proto = "HTTP/1.1"
+			}
+			require.Equal(t, proto+" example.com:443 Request", requestEcho(t, conn))
+		})
+	}
+}
+
+/********** Test Utilities **********/
+
+// echoConnectHandler accepts CONNECT requests, and writes back the protocol and target followed by the echoed data.
+func echoConnectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.ProtoMajor == 1 {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\n"+r.Proto+" "+r.Host+" ")
+		io.Copy(conn, conn)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, r.Proto+" "+r.Host+" ")
+	w.(http.Flusher).Flush()
+	buf := make([]byte, 1024)
+	for {
+		n, err := r.Body.Read(buf)
+		w.Write(buf[:n])
+		w.(http.Flusher).Flush()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func requestEcho(t *testing.T, conn transport.StreamConn) string {
+	_, err := conn.Write([]byte("Request"))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(response)
+}
@@ -0,0 +1,26 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+
+package httpconnect
+
+import "errors"
+
+// NewSSPIAuthenticator returns an [Authenticator] that authenticates as the current Windows user with the SSPI. The
+// scheme is "Negotiate", which uses Kerberos with the service principal name HTTP/[proxy host] and falls back to
+// NTLM, or "NTLM". It's only supported on Windows.
+func NewSSPIAuthenticator(scheme string) (Authenticator, error) {
+	return nil, errors.New("SSPI authentication is only supported on Windows")
+}
@@ -0,0 +1,119 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpconnect
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/alexbrainman/sspi"
+	"github.com/alexbrainman/sspi/negotiate"
+	"github.com/alexbrainman/sspi/ntlm"
+)
+
+type sspiAuthenticator struct {
+	scheme string
+}
+
+// NewSSPIAuthenticator returns an [Authenticator] that authenticates as the current Windows user with the SSPI. The
+// scheme is "Negotiate", which uses Kerberos with the service principal name HTTP/[proxy host] and falls back to
+// NTLM, or "NTLM". It's only supported on Windows.
+func NewSSPIAuthenticator(scheme string) (Authenticator, error) {
+	switch {
+	case strings.EqualFold(scheme, "Negotiate"):
+		return &sspiAuthenticator{scheme: "Negotiate"}, nil
+	case strings.EqualFold(scheme, "NTLM"):
+		return &sspiAuthenticator{scheme: "NTLM"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported SSPI scheme %q", scheme)
+	}
+}
+
+func (a *sspiAuthenticator) Scheme() string {
+	return a.scheme
+}
+
+func (a *sspiAuthenticator) NewSession(proxyAddr string) (AuthSession, error) {
+	host, _, err := net.SplitHostPort(proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if a.scheme == "NTLM" {
+		cred, err := ntlm.AcquireCurrentUserCredentials()
+		if err != nil {
+			return nil, err
+		}
+		return &ntlmSession{cred: cred}, nil
+	}
+	cred, err := negotiate.AcquireCurrentUserCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return &negotiateSession{cred: cred, targetName: "HTTP/" + host}, nil
+}
+
+type negotiateSession struct {
+	cred       *sspi.Credentials
+	targetName string
+	ctx        *negotiate.ClientContext
+}
+
+func (s *negotiateSession) Next(challenge []byte) ([]byte, error) {
+	if s.ctx == nil {
+		ctx, token, err := negotiate.NewClientContext(s.cred, s.targetName)
+		if err != nil {
+			return nil, err
+		}
+		s.ctx = ctx
+		return token, nil
+	}
+	_, token, err := s.ctx.Update(challenge)
+	return token, err
+}
+
+func (s *negotiateSession) Close() error {
+	var err error
+	if s.ctx != nil {
+		err = s.ctx.Release()
+	}
+	return errors.Join(err, s.cred.Release())
+}
+
+type ntlmSession struct {
+	cred *sspi.Credentials
+	ctx  *ntlm.ClientContext
+}
+
+func (s *ntlmSession) Next(challenge []byte) ([]byte, error) {
+	if s.ctx == nil {
+		ctx, negotiateMessage, err := ntlm.NewClientContext(s.cred)
+		if err != nil {
+			return nil, err
+		}
+		s.ctx = ctx
+		return negotiateMessage, nil
+	}
+	return s.ctx.Update(challenge)
+}
+
+func (s *ntlmSession) Close() error {
+	var err error
+	if s.ctx != nil {
+		err = s.ctx.Release()
+	}
+	return errors.Join(err, s.cred.Release())
+}
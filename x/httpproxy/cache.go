@@ -0,0 +1,495 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpproxy
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseCache is an in-memory private HTTP cache, following the caching rules of [RFC 9111].
+// Responses are keyed by URL, and the least recently used entries are evicted when the size limit is reached.
+// It is safe for concurrent use.
+//
+// Only responses to GET requests are stored. Responses with a Set-Cookie header are never stored, so that
+// session state is not shared between requests.
+//
+// [RFC 9111]: https://www.rfc-editor.org/rfc/rfc9111.html
+type ResponseCache struct {
+	maxBytes      int64
+	maxEntryBytes int64
+	// now returns the current time. It's overridden in tests.
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds the *cacheEntry values, with the most recently used at the front.
+	lru  *list.List
+	size int64
+}
+
+// NewResponseCache creates a [ResponseCache] that holds at most maxBytes, and doesn't store responses larger than maxEntryBytes.
+func NewResponseCache(maxBytes int64, maxEntryBytes int64) *ResponseCache {
+	if maxEntryBytes > maxBytes {
+		maxEntryBytes = maxBytes
+	}
+	return &ResponseCache{
+		maxBytes:      maxBytes,
+		maxEntryBytes: maxEntryBytes,
+		now:           time.Now,
+		entries:       make(map[string]*list.Element),
+		lru:           list.New(),
+	}
+}
+
+// Len returns the number of responses in the cache.
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Size returns the approximate number of bytes used by the cached responses.
+func (c *ResponseCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Clear removes all the responses from the cache.
+func (c *ResponseCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+}
+
+// cacheEntry is a stored response. It's immutable once stored.
+type cacheEntry struct {
+	key        string
+	statusCode int
+	header     http.Header
+	body       []byte
+	// varyHeader holds the request header values selected by the Vary response header.
+	varyHeader   http.Header
+	requestTime  time.Time
+	responseTime time.Time
+}
+
+func (e *cacheEntry) size() int64 {
+	size := int64(len(e.key) + len(e.body))
+	for key, values := range e.header {
+		for _, value := range values {
+			size += int64(len(key) + len(value))
+		}
+	}
+	return size
+}
+
+// matches returns whether the entry can be used for the given request, according to the Vary header.
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for key, values := range e.varyHeader {
+		if strings.Join(req.Header.Values(key), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// currentAge computes the age of the response as per https://www.rfc-editor.org/rfc/rfc9111.html#section-4.2.3.
+func (e *cacheEntry) currentAge(now time.Time) time.Duration {
+	var apparentAge time.Duration
+	if date, err := http.ParseTime(e.header.Get("Date")); err == nil && e.responseTime.After(date) {
+		apparentAge = e.responseTime.Sub(date)
+	}
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(e.header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+	correctedAge := ageValue + e.responseTime.Sub(e.requestTime)
+	initialAge := apparentAge
+	if correctedAge > initialAge {
+		initialAge = correctedAge
+	}
+	return initialAge + now.Sub(e.responseTime)
+}
+
+// freshnessLifetime computes how long the response is fresh for, as per https://www.rfc-editor.org/rfc/rfc9111.html#section-4.2.1.
+func (e *cacheEntry) freshnessLifetime() time.Duration {
+	responseCC := parseCacheControl(e.header)
+	if maxAge, ok := responseCC.seconds("max-age"); ok {
+		return maxAge
+	}
+	date, err := http.ParseTime(e.header.Get("Date"))
+	if err != nil {
+		date = e.responseTime
+	}
+	if expiresValue := e.header.Get("Expires"); expiresValue != "" {
+		expires, err := http.ParseTime(expiresValue)
+		if err != nil {
+			// Invalid dates represent a time in the past.
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	// Heuristic freshness of 10% of the time since the last modification, capped at one day.
+	// See https://www.rfc-editor.org/rfc/rfc9111.html#section-4.2.2.
+	if !heuristicallyCacheable[e.statusCode] {
+		return 0
+	}
+	lastModified, err := http.ParseTime(e.header.Get("Last-Modified"))
+	if err != nil || !date.After(lastModified) {
+		return 0
+	}
+	lifetime := date.Sub(lastModified) / 10
+	if lifetime > 24*time.Hour {
+		lifetime = 24 * time.Hour
+	}
+	return lifetime
+}
+
+// isFresh returns whether the entry can be served without validation for a request with the given Cache-Control.
+func (e *cacheEntry) isFresh(now time.Time, requestCC cacheControl) bool {
+	if parseCacheControl(e.header).has("no-cache") || requestCC.has("no-cache") {
+		return false
+	}
+	age := e.currentAge(now)
+	if maxAge, ok := requestCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	remaining := e.freshnessLifetime() - age
+	if minFresh, ok := requestCC.seconds("min-fresh"); ok && remaining < minFresh {
+		return false
+	}
+	return remaining > 0
+}
+
+// response creates a new response for the request from the entry.
+func (e *cacheEntry) response(req *http.Request, now time.Time) *http.Response {
+	header := e.header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(e.currentAge(now)/time.Second), 10))
+	resp := &http.Response{
+		Status:        strconv.Itoa(e.statusCode) + " " + http.StatusText(e.statusCode),
+		StatusCode:    e.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+	if etag := e.header.Get("ETag"); etag != "" && matchesETag(req.Header.Get("If-None-Match"), etag) {
+		resp.Status = "304 " + http.StatusText(http.StatusNotModified)
+		resp.StatusCode = http.StatusNotModified
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+		resp.Header.Del("Content-Length")
+	}
+	return resp
+}
+
+// matchesETag implements the weak comparison of If-None-Match.
+func matchesETag(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the entry for the request, or nil if there's none.
+func (c *ResponseCache) get(key string, req *http.Request) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cacheEntry)
+	if !entry.matches(req) {
+		return nil
+	}
+	c.lru.MoveToFront(element)
+	return entry
+}
+
+// put stores the entry, replacing any previous one for the same key and evicting entries as needed.
+func (c *ResponseCache) put(entry *cacheEntry) {
+	entrySize := entry.size()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(entry.key)
+	if entrySize > c.maxEntryBytes {
+		return
+	}
+	for c.size+entrySize > c.maxBytes {
+		c.removeLocked(c.lru.Back().Value.(*cacheEntry).key)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += entrySize
+}
+
+func (c *ResponseCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+}
+
+func (c *ResponseCache) removeLocked(key string) {
+	element, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.lru.Remove(element)
+	delete(c.entries, key)
+	c.size -= element.Value.(*cacheEntry).size()
+}
+
+// Status codes that are heuristically cacheable, as per https://www.rfc-editor.org/rfc/rfc9110.html#section-15.1.
+var heuristicallyCacheable = map[int]bool{
+	200: true, 203: true, 204: true, 206: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// cacheControl holds the parsed Cache-Control directives.
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	// Pragma: no-cache is equivalent to Cache-Control: no-cache when there's no Cache-Control.
+	if len(cc) == 0 && strings.EqualFold(strings.TrimSpace(header.Get("Pragma")), "no-cache") {
+		cc["no-cache"] = ""
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	arg, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+type cachingTransport struct {
+	base  http.RoundTripper
+	cache *ResponseCache
+}
+
+var _ http.RoundTripper = (*cachingTransport)(nil)
+
+// NewCachingTransport creates a [http.RoundTripper] that serves responses from the given cache when possible,
+// and stores the responses from the base [http.RoundTripper] in the cache.
+func NewCachingTransport(base http.RoundTripper, cache *ResponseCache) http.RoundTripper {
+	return &cachingTransport{base: base, cache: cache}
+}
+
+func cacheKey(req *http.Request) string {
+	u := *req.URL
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+func hasConditionals(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" ||
+		req.Header.Get("If-Match") != "" || req.Header.Get("If-Unmodified-Since") != "" || req.Header.Get("If-Range") != ""
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := cacheKey(req)
+	if req.Method != http.MethodGet {
+		resp, err := t.base.RoundTrip(req)
+		// Unsafe methods invalidate the stored responses on success.
+		// See https://www.rfc-editor.org/rfc/rfc9111.html#section-4.4.
+		if err == nil && !isSafeMethod(req.Method) && resp.StatusCode < 400 {
+			t.cache.remove(key)
+		}
+		return resp, err
+	}
+	requestCC := parseCacheControl(req.Header)
+	if requestCC.has("no-store") || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	entry := t.cache.get(key, req)
+	if entry != nil && entry.isFresh(t.cache.now(), requestCC) {
+		return entry.response(req, t.cache.now()), nil
+	}
+	if requestCC.has("only-if-cached") {
+		return gatewayTimeoutResponse(req), nil
+	}
+
+	etag, lastModified := "", ""
+	if entry != nil {
+		etag, lastModified = entry.header.Get("ETag"), entry.header.Get("Last-Modified")
+	}
+	revalidate := entry != nil && !hasConditionals(req) && (etag != "" || lastModified != "")
+	targetReq := req
+	if revalidate {
+		targetReq = req.Clone(req.Context())
+		if etag != "" {
+			targetReq.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			targetReq.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	requestTime := t.cache.now()
+	resp, err := t.base.RoundTrip(targetReq)
+	if err != nil {
+		return nil, err
+	}
+	if revalidate && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		// Update the stored response with the new metadata.
+		// See https://www.rfc-editor.org/rfc/rfc9111.html#section-4.3.4.
+		updated := *entry
+		updated.header = entry.header.Clone()
+		for name, values := range resp.Header {
+			if name == "Content-Length" {
+				continue
+			}
+			updated.header[name] = values
+		}
+		updated.requestTime = requestTime
+		updated.responseTime = t.cache.now()
+		t.cache.put(&updated)
+		return updated.response(req, t.cache.now()), nil
+	}
+	return t.store(key, req, resp, requestTime), nil
+}
+
+// store arranges for the response to be stored once its body is fully read, if it's cacheable.
+func (t *cachingTransport) store(key string, req *http.Request, resp *http.Response, requestTime time.Time) *http.Response {
+	// Partial responses are not stored.
+	if !heuristicallyCacheable[resp.StatusCode] || resp.StatusCode == http.StatusPartialContent {
+		return resp
+	}
+	responseCC := parseCacheControl(resp.Header)
+	if responseCC.has("no-store") || resp.Header.Get("Set-Cookie") != "" || resp.ContentLength > t.cache.maxEntryBytes {
+		return resp
+	}
+	entry := &cacheEntry{
+		key:          key,
+		statusCode:   resp.StatusCode,
+		header:       resp.Header.Clone(),
+		varyHeader:   http.Header{},
+		requestTime:  requestTime,
+		responseTime: t.cache.now(),
+	}
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return resp
+			}
+			if name != "" {
+				entry.varyHeader[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+			}
+		}
+	}
+	// Only store responses that can be served fresh or revalidated.
+	if entry.freshnessLifetime() <= 0 && entry.header.Get("ETag") == "" && entry.header.Get("Last-Modified") == "" {
+		return resp
+	}
+	resp.Body = &cachingBody{ReadCloser: resp.Body, limit: t.cache.maxEntryBytes, onDone: func(body []byte) {
+		entry.body = body
+		t.cache.put(entry)
+	}}
+	return resp
+}
+
+func gatewayTimeoutResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 " + http.StatusText(http.StatusGatewayTimeout),
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// cachingBody records the body as it's read, and calls onDone with the full body when it reaches EOF.
+// It stops recording if the body exceeds the limit.
+type cachingBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+	onDone   func(body []byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.overflow {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.overflow && b.onDone != nil {
+		b.onDone(b.buf.Bytes())
+		b.onDone = nil
+	}
+	return n, err
+}
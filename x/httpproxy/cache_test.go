@@ -0,0 +1,311 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRoundTripper struct {
+	requests []*http.Request
+	handler  http.HandlerFunc
+}
+
+func (rt *fakeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.requests = append(rt.requests, req)
+	recorder := httptest.NewRecorder()
+	rt.handler(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+func newTestCache(now *time.Time) *ResponseCache {
+	cache := NewResponseCache(1000, 500)
+	cache.now = func() time.Time { return *now }
+	return cache
+}
+
+func fetch(t *testing.T, rt http.RoundTripper, method string, url string, header http.Header) (*http.Response, string) {
+	req := httptest.NewRequest(method, url, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(body)
+}
+
+func TestCachingTransport_MaxAge(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "asset")
+	}}
+	cache := newTestCache(&now)
+	rt := NewCachingTransport(base, cache)
+
+	_, body := fetch(t, rt, "GET", "http://example.com/app.js", nil)
+	require.Equal(t, "asset", body)
+	require.Equal(t, 1, cache.Len())
+
+	now = now.Add(30 * time.Second)
+	resp, body := fetch(t, rt, "GET", "http://example.com/app.js", nil)
+	require.Equal(t, "asset", body)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "30", resp.Header.Get("Age"))
+	require.Len(t, base.requests, 1)
+
+	// The request can ask for a fresher response.
+	fetch(t, rt, "GET", "http://example.com/app.js", http.Header{"Cache-Control": {"max-age=10"}})
+	require.Len(t, base.requests, 2)
+
+	// Stale entries without validators are fetched again.
+	now = now.Add(61 * time.Second)
+	fetch(t, rt, "GET", "http://example.com/app.js", nil)
+	require.Len(t, base.requests, 3)
+}
+
+func TestCachingTransport_Revalidate(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("X-Revalidated", "true")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "page")
+	}}
+	rt := NewCachingTransport(base, newTestCache(&now))
+
+	fetch(t, rt, "GET", "http://example.com/", nil)
+	resp, body := fetch(t, rt, "GET", "http://example.com/", nil)
+	require.Len(t, base.requests, 2)
+	require.Equal(t, `"v1"`, base.requests[1].Header.Get("If-None-Match"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "page", body)
+	require.Equal(t, "true", resp.Header.Get("X-Revalidated"))
+	// The request from the client is not modified.
+	require.Empty(t, resp.Request.Header.Get("If-None-Match"))
+}
+
+func TestCachingTransport_ClientConditional(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `W/"v1"`)
+		io.WriteString(w, "image")
+	}}
+	rt := NewCachingTransport(base, newTestCache(&now))
+
+	fetch(t, rt, "GET", "http://example.com/logo.png", nil)
+	resp, body := fetch(t, rt, "GET", "http://example.com/logo.png", http.Header{"If-None-Match": {`"v0", W/"v1"`}})
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+	require.Empty(t, body)
+	require.Len(t, base.requests, 1)
+}
+
+func TestCachingTransport_HeuristicFreshness(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+		w.Header().Set("Last-Modified", now.Add(-100*time.Minute).UTC().Format(http.TimeFormat))
+		io.WriteString(w, "style")
+	}}
+	rt := NewCachingTransport(base, newTestCache(&now))
+
+	fetch(t, rt, "GET", "http://example.com/style.css", nil)
+	now = now.Add(9 * time.Minute)
+	fetch(t, rt, "GET", "http://example.com/style.css", nil)
+	require.Len(t, base.requests, 1)
+
+	now = now.Add(2 * time.Minute)
+	fetch(t, rt, "GET", "http://example.com/style.css", nil)
+	require.Len(t, base.requests, 2)
+	require.NotEmpty(t, base.requests[1].Header.Get("If-Modified-Since"))
+}
+
+func TestCachingTransport_NotStored(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	for _, tc := range []struct {
+		name           string
+		requestHeader  http.Header
+		responseHeader http.Header
+		status         int
+	}{
+		{name: "no-store", responseHeader: http.Header{"Cache-Control": {"max-age=60, no-store"}}},
+		{name: "request no-store", requestHeader: http.Header{"Cache-Control": {"no-store"}}, responseHeader: http.Header{"Cache-Control": {"max-age=60"}}},
+		{name: "set-cookie", responseHeader: http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"id=1"}}},
+		{name: "vary star", responseHeader: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}},
+		{name: "no freshness", responseHeader: http.Header{}},
+		{name: "range", requestHeader: http.Header{"Range": {"bytes=0-1"}}, responseHeader: http.Header{"Cache-Control": {"max-age=60"}}},
+		{name: "uncacheable status", responseHeader: http.Header{"Cache-Control": {"max-age=60"}}, status: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {
+				for key, values := range tc.responseHeader {
+					w.Header()[key] = values
+				}
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+				}
+				io.WriteString(w, "data")
+			}}
+			cache := newTestCache(&now)
+			rt := NewCachingTransport(base, cache)
+			fetch(t, rt, "GET", "http://example.com/", tc.requestHeader)
+			require.Equal(t, 0, cache.Len())
+		})
+	}
+}
+
+func TestCachingTransport_Vary(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Encoding")
+		io.WriteString(w, "encoding:"+r.Header.Get("Accept-Encoding"))
+	}}
+	rt := NewCachingTransport(base, newTestCache(&now))
+
+	_, body := fetch(t, rt, "GET", "http://example.com/", http.Header{"Accept-Encoding": {"gzip"}})
+	require.Equal(t, "encoding:gzip", body)
+	_, body = fetch(t, rt, "GET", "http://example.com/", nil)
+	require.Equal(t, "encoding:", body)
+	require.Len(t, base.requests, 2)
+	_, body = fetch(t, rt, "GET", "http://example.com/", nil)
+	require.Equal(t, "encoding:", body)
+	require.Len(t, base.requests, 2)
+}
+
+func TestCachingTransport_UnsafeMethodInvalidates(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+	}}
+	cache := newTestCache(&now)
+	rt := NewCachingTransport(base, cache)
+
+	fetch(t, rt, "GET", "http://example.com/item", nil)
+	require.Equal(t, 1, cache.Len())
+	fetch(t, rt, "HEAD", "http://example.com/item", nil)
+	require.Equal(t, 1, cache.Len())
+	fetch(t, rt, "POST", "http://example.com/item", nil)
+	require.Equal(t, 0, cache.Len())
+}
+
+func TestCachingTransport_OnlyIfCached(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {}}
+	rt := NewCachingTransport(base, newTestCache(&now))
+	resp, _ := fetch(t, rt, "GET", "http://example.com/", http.Header{"Cache-Control": {"only-if-cached"}})
+	require.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	require.Empty(t, base.requests)
+}
+
+func TestResponseCache_SizeLimits(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, strings.Repeat("x", len(r.URL.Path)*100))
+	}}
+	cache := NewResponseCache(1500, 500)
+	cache.now = func() time.Time { return now }
+	rt := NewCachingTransport(base, cache)
+
+	// Larger than the entry limit.
+	fetch(t, rt, "GET", "http://example.com/aaaaaa", nil)
+	require.Equal(t, 0, cache.Len())
+
+	fetch(t, rt, "GET", "http://example.com/bbb", nil)
+	fetch(t, rt, "GET", "http://example.com/ccc", nil)
+	fetch(t, rt, "GET", "http://example.com/ddd", nil)
+	require.Equal(t, 3, cache.Len())
+	// Use the oldest so it's not evicted.
+	fetch(t, rt, "GET", "http://example.com/bbb", nil)
+	require.Len(t, base.requests, 4)
+
+	fetch(t, rt, "GET", "http://example.com/eee", nil)
+	require.Equal(t, 3, cache.Len())
+	require.LessOrEqual(t, cache.Size(), int64(1500))
+	fetch(t, rt, "GET", "http://example.com/bbb", nil)
+	require.Len(t, base.requests, 5)
+	fetch(t, rt, "GET", "http://example.com/ccc", nil)
+	require.Len(t, base.requests, 6)
+
+	cache.Clear()
+	require.Equal(t, 0, cache.Len())
+	require.Equal(t, int64(0), cache.Size())
+}
+
+func TestCachingTransport_PartialRead(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	base := &fakeRoundTripper{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "incomplete")
+	}}
+	cache := newTestCache(&now)
+	rt := NewCachingTransport(base, cache)
+	resp, err := rt.RoundTrip(httptest.NewRequest("GET", "http://example.com/", nil))
+	require.NoError(t, err)
+	_, err = resp.Body.Read(make([]byte, 2))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 0, cache.Len())
+}
+
+func TestProxyHandler_SetResponseCache(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "missing")
+	}))
+	defer server.Close()
+
+	dialer := &transport.TCPDialer{}
+	handler := NewProxyHandler(transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		return dialer.DialStream(ctx, addr)
+	}))
+	handler.SetResponseCache(NewResponseCache(1<<20, 1<<10))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", server.URL+"/missing", nil)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusNotFound, resp.Code)
+		require.Equal(t, "missing", resp.Body.String())
+	}
+	require.Equal(t, 1, requests)
+
+	handler.SetResponseCache(nil)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", server.URL+"/missing", nil))
+	require.Equal(t, 2, requests)
+}
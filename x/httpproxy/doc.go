@@ -15,6 +15,24 @@
 /*
 Package httpproxy provides HTTP handlers for routing HTTP traffic through a local web proxy.
 
+# Response caching
+
+[ProxyHandler] can optionally cache responses to plain HTTP requests in a [ResponseCache], which reduces data usage
+over slow tunnels when an app repeatedly loads the same static assets. Use [ProxyHandler.SetResponseCache] to enable it,
+or [NewCachingTransport] to add the same caching to your own [net/http.Client].
+
+# Block page detection
+
+[ProxyHandler.SetBlockPageCallback] makes the proxy inspect the responses to plain HTTP requests for signs that the
+network injected them, like known block pages or redirects to private addresses, so that apps can tell the user that
+a site is blocked.
+
+# Protocol upgrades
+
+[ProxyHandler] forwards plain HTTP requests that ask to switch protocols, like WebSocket or h2c upgrades, to the
+target without caching them. If the target responds with 101 Switching Protocols, the proxy forwards the response and
+then relays the raw connection in both directions.
+
 # Important Security Considerations
 
 This package is designed primarily for use with private, internal forward proxies typically integrated within an application.
@@ -15,6 +15,7 @@
 package httpproxy
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -23,10 +24,18 @@ import (
 	"strings"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/connectivity"
 )
 
+// maxInspectedBodySize is how much of the response body is inspected for block pages.
+const maxInspectedBodySize = 8 * 1024
+
 type forwardHandler struct {
-	client http.Client
+	// transport is the base transport, without caching.
+	transport http.RoundTripper
+	client    http.Client
+	// onBlockPage is called with the responses that look injected by the network, if not nil.
+	onBlockPage func(*http.Request, *connectivity.HTTPInspection)
 }
 
 var _ http.Handler = (*forwardHandler)(nil)
@@ -47,31 +56,149 @@ func (h *forwardHandler) ServeHTTP(proxyResp http.ResponseWriter, proxyReq *http
 			targetReq.Header.Add(key, value)
 		}
 	}
+	if isUpgradeRequest(proxyReq) {
+		h.serveUpgrade(proxyResp, proxyReq, targetReq)
+		return
+	}
 	targetResp, err := h.client.Do(targetReq)
 	if err != nil {
 		http.Error(proxyResp, "Failed to fetch destination", http.StatusServiceUnavailable)
 		return
 	}
 	defer targetResp.Body.Close()
+	body := io.Reader(targetResp.Body)
+	if h.onBlockPage != nil {
+		body = h.inspect(proxyReq, targetResp)
+	}
 	for key, values := range targetResp.Header {
 		for _, value := range values {
 			proxyResp.Header().Add(key, value)
 		}
 	}
-	_, err = io.Copy(proxyResp, targetResp.Body)
+	proxyResp.WriteHeader(targetResp.StatusCode)
+	_, err = io.Copy(proxyResp, body)
 	if err != nil {
 		http.Error(proxyResp, "Failed write response", http.StatusServiceUnavailable)
 		return
 	}
 }
 
+// inspect calls onBlockPage if the response looks injected by the network, and returns the reader of the whole body.
+// Compressed bodies are not inspected, so only their headers are.
+func (h *forwardHandler) inspect(req *http.Request, resp *http.Response) io.Reader {
+	var prefix []byte
+	if encoding := resp.Header.Get("Content-Encoding"); encoding == "" || strings.EqualFold(encoding, "identity") {
+		// Read errors are returned again when reading the rest of the body.
+		prefix, _ = io.ReadAll(io.LimitReader(resp.Body, maxInspectedBodySize))
+	}
+	if inspection := connectivity.InspectHTTPResponse(resp, prefix, nil); inspection.LikelyInjected() {
+		h.onBlockPage(req, inspection)
+	}
+	return io.MultiReader(bytes.NewReader(prefix), resp.Body)
+}
+
+// isUpgradeRequest returns whether the request asks to switch protocols, like WebSocket or h2c.
+func isUpgradeRequest(req *http.Request) bool {
+	if req.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveUpgrade forwards a protocol upgrade request and, if the target switches protocols, relays the raw
+// connection in both directions. Upgrade requests bypass the cache and redirects, since the response is specific
+// to the connection.
+func (h *forwardHandler) serveUpgrade(proxyResp http.ResponseWriter, proxyReq *http.Request, targetReq *http.Request) {
+	targetResp, err := h.transport.RoundTrip(targetReq)
+	if err != nil {
+		http.Error(proxyResp, "Failed to fetch destination", http.StatusServiceUnavailable)
+		return
+	}
+	defer targetResp.Body.Close()
+	for key, values := range targetResp.Header {
+		for _, value := range values {
+			proxyResp.Header().Add(key, value)
+		}
+	}
+	if targetResp.StatusCode != http.StatusSwitchingProtocols {
+		// The target refused the upgrade, so we forward its response as usual.
+		proxyResp.WriteHeader(targetResp.StatusCode)
+		io.Copy(proxyResp, targetResp.Body)
+		return
+	}
+	// The http.Transport returns the upgraded connection as the body of 101 responses.
+	targetConn, ok := targetResp.Body.(io.ReadWriteCloser)
+	if !ok {
+		http.Error(proxyResp, "Target connection doesn't support upgrades", http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := proxyResp.(http.Hijacker)
+	if !ok {
+		http.Error(proxyResp, "Webserver doesn't support hijacking", http.StatusInternalServerError)
+		return
+	}
+	httpConn, clientRW, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(proxyResp, "Failed to hijack connection", http.StatusInternalServerError)
+		return
+	}
+	defer httpConn.Close()
+	// TODO(fortuna): Use context.AfterFunc after we migrate to Go 1.21.
+	go func() {
+		// Same as in the connectHandler, we let the HTTP server control the request lifetime.
+		<-proxyReq.Context().Done()
+		httpConn.Close()
+	}()
+
+	// Forward the 101 response. After that, the connection belongs to the new protocol.
+	fmt.Fprintf(clientRW, "HTTP/1.1 %v\r\n", targetResp.Status)
+	proxyResp.Header().Write(clientRW)
+	clientRW.WriteString("\r\n")
+	if err := clientRW.Flush(); err != nil {
+		return
+	}
+
+	// Relay data between client and target in both directions.
+	go func() {
+		io.Copy(targetConn, clientRW)
+		if cw, ok := targetConn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+	}()
+	// bufio.Writer.ReadFrom flushes the writes, unlike io.Copy into a bufio.ReadWriter.
+	clientRW.ReadFrom(targetConn)
+	clientRW.Flush()
+}
+
 // NewForwardHandler creates a [http.Handler] that handles absolute HTTP requests using the given [http.Client].
 func NewForwardHandler(dialer transport.StreamDialer) http.Handler {
+	return newForwardHandler(dialer)
+}
+
+func newForwardHandler(dialer transport.StreamDialer) *forwardHandler {
 	dialContext := func(ctx context.Context, network, addr string) (net.Conn, error) {
 		if !strings.HasPrefix(network, "tcp") {
 			return nil, fmt.Errorf("protocol not supported: %v", network)
 		}
 		return dialer.DialStream(ctx, addr)
 	}
-	return &forwardHandler{http.Client{Transport: &http.Transport{DialContext: dialContext}}}
+	baseTransport := &http.Transport{DialContext: dialContext}
+	return &forwardHandler{transport: baseTransport, client: http.Client{Transport: baseTransport}}
+}
+
+// setResponseCache makes the handler use the given cache, or no cache if nil.
+func (h *forwardHandler) setResponseCache(cache *ResponseCache) {
+	if cache == nil {
+		h.client.Transport = h.transport
+		return
+	}
+	h.client.Transport = NewCachingTransport(h.transport, cache)
 }
@@ -0,0 +1,186 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpproxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/connectivity"
+	"github.com/stretchr/testify/require"
+)
+
+// newEchoUpgradeServer returns a server that switches to an echo protocol on upgrade requests.
+func newEchoUpgradeServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			http.Error(w, "Unsupported upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		rw.ReadFrom(rw.Reader)
+		rw.Flush()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestProxy(t *testing.T) *httptest.Server {
+	proxy := httptest.NewServer(NewProxyHandler(&transport.TCPDialer{}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestForwardHandler_Upgrade(t *testing.T) {
+	target := newEchoUpgradeServer(t)
+	proxy := newTestProxy(t)
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req, err := http.NewRequest(http.MethodGet, target.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	require.NoError(t, req.WriteProxy(conn))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, "echo", resp.Header.Get("Upgrade"))
+
+	// The connection is now relayed as is.
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(reader, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf))
+
+	_, err = conn.Write([]byte("world"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(reader, buf)
+	require.NoError(t, err)
+	require.Equal(t, "world", string(buf))
+}
+
+func TestForwardHandler_UpgradeRefused(t *testing.T) {
+	target := newEchoUpgradeServer(t)
+	proxy := newTestProxy(t)
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req, err := http.NewRequest(http.MethodGet, target.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "unknown")
+	require.NoError(t, req.WriteProxy(conn))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "Unsupported upgrade\n", string(body))
+}
+
+func TestForwardHandler_UpgradeBypassesCache(t *testing.T) {
+	target := newEchoUpgradeServer(t)
+	handler := NewProxyHandler(&transport.TCPDialer{})
+	handler.SetResponseCache(NewResponseCache(1<<20, 1<<20))
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, target.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "echo")
+		require.NoError(t, req.WriteProxy(conn))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		conn.Close()
+	}
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	require.False(t, isUpgradeRequest(req))
+
+	req.Header.Set("Upgrade", "websocket")
+	require.False(t, isUpgradeRequest(req))
+
+	req.Header.Set("Connection", "keep-alive, upgrade")
+	require.True(t, isUpgradeRequest(req))
+
+	req.Header.Del("Upgrade")
+	require.False(t, isUpgradeRequest(req))
+}
+
+func TestProxyHandler_BlockPageCallback(t *testing.T) {
+	blockPage := `<html><iframe src="http://10.10.34.34?type=Invalid Site"></iframe></html>`
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blocked" {
+			w.Write([]byte(blockPage))
+			return
+		}
+		w.Write([]byte("welcome"))
+	}))
+	defer target.Close()
+
+	handler := NewProxyHandler(&transport.TCPDialer{})
+	var blocked []string
+	handler.SetBlockPageCallback(func(req *http.Request, inspection *connectivity.HTTPInspection) {
+		blocked = append(blocked, req.URL.Path)
+		require.Equal(t, "ir-iframe", inspection.BlockPage)
+		require.Contains(t, inspection.Indicators, connectivity.IndicatorReservedFrame)
+	})
+	proxy := httptest.NewServer(handler)
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	for path, expected := range map[string]string{"/blocked": blockPage, "/ok": "welcome"} {
+		resp, err := client.Get(target.URL + path)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		// The response is forwarded as received.
+		require.Equal(t, expected, string(body))
+	}
+	require.Equal(t, []string{"/blocked"}, blocked)
+}
@@ -18,6 +18,7 @@ import (
 	"net/http"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/connectivity"
 )
 
 type ProxyHandler struct {
@@ -25,7 +26,28 @@ type ProxyHandler struct {
 	// If FallbackHandler is absent, ProxyHandler returns a 404.
 	FallbackHandler http.Handler
 	connectHandler  http.Handler
-	forwardHandler  http.Handler
+	forwardHandler  *forwardHandler
+}
+
+// SetResponseCache makes the handler serve absolute URL requests from the given cache when possible, and store
+// cacheable responses in it. This reduces data usage for repeated fetches of static assets over slow tunnels.
+// A nil cache disables caching, which is the default. It must be called before the handler starts serving requests.
+//
+// CONNECT requests, including all HTTPS traffic, are not cached, since the proxy can't see their content.
+func (h *ProxyHandler) SetResponseCache(cache *ResponseCache) {
+	h.forwardHandler.setResponseCache(cache)
+}
+
+// SetBlockPageCallback makes the handler inspect the responses to absolute URL requests with
+// [connectivity.InspectHTTPResponse], and call callback with the ones that were likely injected by the network,
+// so that the app can tell the user that the site is blocked. The responses are still forwarded as received.
+// A nil callback disables the inspection, which is the default. It must be called before the handler starts
+// serving requests.
+//
+// The inspection reads up to the first 8 KiB of the body before forwarding the response. CONNECT requests,
+// including all HTTPS traffic, are not inspected, since the proxy can't see their content.
+func (h *ProxyHandler) SetBlockPageCallback(callback func(req *http.Request, inspection *connectivity.HTTPInspection)) {
+	h.forwardHandler.onBlockPage = callback
 }
 
 // ServeHTTP implements [http.Handler].ServeHTTP for CONNECT and absolute URL requests, using the internal [transport.StreamDialer].
@@ -51,6 +73,6 @@ func (h *ProxyHandler) ServeHTTP(proxyResp http.ResponseWriter, proxyReq *http.R
 func NewProxyHandler(dialer transport.StreamDialer) *ProxyHandler {
 	return &ProxyHandler{
 		connectHandler: NewConnectHandler(dialer),
-		forwardHandler: NewForwardHandler(dialer),
+		forwardHandler: newForwardHandler(dialer),
 	}
 }
@@ -0,0 +1,125 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ssurl parses the Shadowsocks URLs in the [SIP002] and legacy formats. It's shared by the packages that
+// parse Shadowsocks configs and access keys, so they accept the same URLs.
+//
+// [SIP002]: https://shadowsocks.org/doc/sip002.html
+package ssurl
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Key has the parts of a Shadowsocks URL.
+type Key struct {
+	Cipher string
+	Secret string
+	// Address is the HOST:PORT of the server, as written in the URL.
+	Address string
+	// Query has the options of the URL, like the prefix.
+	Query url.Values
+}
+
+// ParseSIP002 parses a URL in the SIP002 format, ss://[USERINFO]@[HOST]:[PORT]/?[QUERY], where the user info is
+// CIPHER:SECRET, either in plain text or Base64-encoded.
+func ParseSIP002(u *url.URL) (*Key, error) {
+	if u.Host == "" {
+		return nil, errors.New("host not specified")
+	}
+	if u.User == nil {
+		return nil, errors.New("user info not specified")
+	}
+	cipherInfo := u.User.Username()
+	if password, hasPassword := u.User.Password(); hasPassword {
+		// Plain user info, as used by AEAD-2022 ciphers.
+		cipherInfo += ":" + password
+	} else if decoded, err := DecodeBase64(cipherInfo); err == nil {
+		cipherInfo = decoded
+	} else {
+		return nil, fmt.Errorf("failed to decode user info: %w", err)
+	}
+	cipher, secret, found := strings.Cut(cipherInfo, ":")
+	if !found {
+		return nil, errors.New("invalid cipher info: no ':' separator")
+	}
+	return &Key{Cipher: cipher, Secret: secret, Address: u.Host, Query: u.Query()}, nil
+}
+
+// ParseLegacy parses the Base64 text of a URL in the legacy format, ss://[BASE64(CIPHER:SECRET@HOST:PORT)], given
+// without the scheme and the fragment. The decoded text may have a query, as in "CIPHER:SECRET@HOST:PORT/?[QUERY]".
+func ParseLegacy(encoded string) (*Key, error) {
+	if encoded == "" {
+		return nil, errors.New("host not specified")
+	}
+	decoded, err := DecodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode legacy key: %w", err)
+	}
+	// The secret may have any character, including '@' and ':', so the address is after the last '@', and
+	// the cipher is before the first ':'.
+	at := strings.LastIndex(decoded, "@")
+	if at == -1 {
+		return nil, errors.New("missing user info")
+	}
+	cipher, secret, found := strings.Cut(decoded[:at], ":")
+	if !found {
+		return nil, errors.New("invalid cipher info: no ':' separator")
+	}
+	address, rawQuery, _ := strings.Cut(decoded[at+1:], "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	return &Key{Cipher: cipher, Secret: secret, Address: strings.TrimSuffix(address, "/"), Query: query}, nil
+}
+
+// DecodeBase64 decodes Base64 strings in either the URL or standard alphabets, with or without padding.
+func DecodeBase64(s string) (string, error) {
+	s = strings.TrimRight(s, "=")
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+// ParsePrefix converts the prefix option, where each character is a byte value, to bytes.
+func ParsePrefix(prefixStr string) ([]byte, error) {
+	runes := []rune(prefixStr)
+	rawBytes := make([]byte, len(runes))
+	for i, r := range runes {
+		if (r & 0xFF) != r {
+			return nil, fmt.Errorf("character out of range: %d", r)
+		}
+		rawBytes[i] = byte(r)
+	}
+	return rawBytes, nil
+}
+
+// FormatPrefix converts the prefix bytes to the prefix option, the inverse of [ParsePrefix].
+func FormatPrefix(prefix []byte) string {
+	runes := make([]rune, len(prefix))
+	for i, b := range prefix {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
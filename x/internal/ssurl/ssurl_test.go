@@ -0,0 +1,78 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssurl
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSIP002(t *testing.T) {
+	for _, keyStr := range []string{
+		"ss://YWVzLTI1Ni1nY206c2VjcmV0@example.com:443/?prefix=HTTP%2F1.1%20",
+		"ss://YWVzLTI1Ni1nY206c2VjcmV0==@example.com:443/?prefix=HTTP%2F1.1%20",
+		"ss://aes-256-gcm:secret@example.com:443/?prefix=HTTP%2F1.1%20",
+	} {
+		u, err := url.Parse(keyStr)
+		require.NoError(t, err)
+		key, err := ParseSIP002(u)
+		require.NoError(t, err, keyStr)
+		require.Equal(t, "aes-256-gcm", key.Cipher, keyStr)
+		require.Equal(t, "secret", key.Secret, keyStr)
+		require.Equal(t, "example.com:443", key.Address, keyStr)
+		require.Equal(t, "HTTP/1.1 ", key.Query.Get("prefix"), keyStr)
+	}
+	for _, keyStr := range []string{
+		"ss://example.com:443",
+		"ss://YWVzLTI1Ni1nY20@example.com:443",
+		"ss://not-base64!@example.com:443",
+	} {
+		u, err := url.Parse(keyStr)
+		require.NoError(t, err)
+		_, err = ParseSIP002(u)
+		require.Error(t, err, keyStr)
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	// The secret has '@' and ':', and the standard alphabet has '/' and '+'.
+	encoded := base64.StdEncoding.EncodeToString([]byte("aes-256-gcm:s@c:r?t>>>@example.com:443/?prefix=HTTP%2F1.1%20"))
+	key, err := ParseLegacy(encoded)
+	require.NoError(t, err)
+	require.Equal(t, &Key{
+		Cipher:  "aes-256-gcm",
+		Secret:  "s@c:r?t>>>",
+		Address: "example.com:443",
+		Query:   url.Values{"prefix": {"HTTP/1.1 "}},
+	}, key)
+
+	for _, decoded := range []string{"", "aes-256-gcm:secret", "aes-256-gcm@example.com:443"} {
+		_, err := ParseLegacy(base64.RawURLEncoding.EncodeToString([]byte(decoded)))
+		require.Error(t, err, decoded)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	prefix, err := ParsePrefix("\x16\x03\x01ÿ")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x16, 0x03, 0x01, 0xff}, prefix)
+	require.Equal(t, "\x16\x03\x01ÿ", FormatPrefix(prefix))
+
+	_, err = ParsePrefix("€")
+	require.Error(t, err)
+}
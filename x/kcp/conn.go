@@ -0,0 +1,361 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// closeLinger is how long a closed session keeps delivering the data already written.
+const closeLinger = time.Minute
+
+// conn is a KCP session over packets. It's safe for concurrent use.
+type conn struct {
+	params     *sessionParams
+	messages   bool
+	send       func(packet []byte) error
+	release    func()
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	start      time.Time
+	done       chan struct{}
+
+	mu sync.Mutex
+	// changed is closed and replaced whenever the state changes, to wake up blocked calls.
+	changed    chan struct{}
+	kcp        *session
+	fecEncoder *fecEncoder
+	fecDecoder *fecDecoder
+	// pending is the rest of a segment that didn't fit in the last Read, in stream mode.
+	pending       []byte
+	readClosed    bool
+	closed        bool
+	closedAt      time.Time
+	released      bool
+	err           error
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+var _ transport.StreamConn = (*conn)(nil)
+
+func newConn(conv uint32, params *sessionParams, messages bool, send func([]byte) error, release func(), localAddr, remoteAddr net.Addr) *conn {
+	c := &conn{
+		params:     params,
+		messages:   messages,
+		send:       send,
+		release:    release,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		start:      time.Now(),
+		done:       make(chan struct{}),
+		changed:    make(chan struct{}),
+	}
+	c.kcp = newSession(conv, c.output)
+	c.kcp.stream = !messages
+	c.kcp.setMTU(params.mtu - params.packetOverhead())
+	if params.fec != nil {
+		c.fecEncoder = newFECEncoder(params.fec)
+		c.fecDecoder = newFECDecoder(params.fec)
+	}
+	c.kcp.setWindows(params.sndWnd, params.rcvWnd)
+	c.kcp.setNoDelay(params.nodelay, uint32(params.interval/time.Millisecond), params.resend, params.nocwnd)
+	go c.updateLoop()
+	return c
+}
+
+// output sends the segments from the session. It's called with the lock held.
+func (c *conn) output(segments []byte) {
+	packets := [][]byte{segments}
+	if c.fecEncoder != nil {
+		packets = c.fecEncoder.encode(segments)
+	}
+	for _, packet := range packets {
+		packet, err := c.params.crypt.seal(packet)
+		if err == nil {
+			err = c.send(packet)
+		}
+		if err != nil {
+			c.failLocked(err)
+			return
+		}
+	}
+}
+
+// now returns the session clock in milliseconds.
+func (c *conn) now() uint32 {
+	return uint32(time.Since(c.start) / time.Millisecond)
+}
+
+func (c *conn) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// waitLocked waits for a state change or the deadline. The lock is released while waiting.
+func (c *conn) waitLocked(deadline time.Time) error {
+	return waitForChange(&c.mu, c.changed, deadline)
+}
+
+// waitForChange waits for changed to be closed or the deadline, with mu released while waiting.
+func waitForChange(mu *sync.Mutex, changed <-chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	mu.Unlock()
+	defer mu.Lock()
+	select {
+	case <-changed:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+func (c *conn) updateLoop() {
+	ticker := time.NewTicker(c.params.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		c.flushLocked()
+		if c.err == nil && c.closed && (c.kcp.waitSend() == 0 || time.Since(c.closedAt) > closeLinger) {
+			c.failLocked(net.ErrClosed)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *conn) flushLocked() {
+	if c.err != nil {
+		return
+	}
+	waiting := c.kcp.waitSend()
+	c.kcp.flush(c.now())
+	if c.kcp.dead {
+		c.failLocked(ErrRetransmitTimeout)
+		return
+	}
+	if c.kcp.waitSend() != waiting {
+		c.notifyLocked()
+	}
+}
+
+// input processes a packet from the peer.
+func (c *conn) input(packet []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	segments, ok := c.params.crypt.open(packet)
+	if !ok {
+		return
+	}
+	c.kcp.current = c.now()
+	accepted := false
+	if _, ok := isFECPacket(segments); c.fecDecoder != nil && ok {
+		for _, data := range c.fecDecoder.decode(segments, time.Now()) {
+			if c.kcp.input(data) {
+				accepted = true
+			}
+		}
+	} else {
+		accepted = c.kcp.input(segments)
+	}
+	if !accepted {
+		return
+	}
+	if c.readClosed || c.closed {
+		c.discardReceivedLocked()
+	}
+	if c.params.ackNoDelay && len(c.kcp.acklist) > 0 {
+		c.flushLocked()
+	}
+	c.notifyLocked()
+}
+
+// fail terminates the session with the given error.
+func (c *conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failLocked(err)
+}
+
+func (c *conn) failLocked(err error) {
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+	c.notifyLocked()
+	if !c.released {
+		c.released = true
+		c.release()
+	}
+}
+
+// Read implements [io.Reader]. In message mode, each Read returns one message, and the part of the message that
+// doesn't fit in b is discarded.
+func (c *conn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if c.closed || c.readClosed {
+			return 0, net.ErrClosed
+		}
+		if len(c.pending) > 0 {
+			n := copy(b, c.pending)
+			c.pending = c.pending[n:]
+			return n, nil
+		}
+		if msg := c.kcp.recv(); msg != nil {
+			n := copy(b, msg)
+			if !c.messages {
+				c.pending = msg[n:]
+			}
+			return n, nil
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		if err := c.waitLocked(c.readDeadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write implements [io.Writer]. It returns once the data is queued, without waiting for it to be acknowledged.
+// In message mode, each Write sends one message.
+func (c *conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if c.closed {
+			return 0, net.ErrClosed
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		// Allow queueing up to a window on top of the segments in flight.
+		if c.kcp.waitSend() < 2*c.params.sndWnd {
+			break
+		}
+		if err := c.waitLocked(c.writeDeadline); err != nil {
+			return 0, err
+		}
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if err := c.kcp.send(b); err != nil {
+		return 0, err
+	}
+	c.flushLocked()
+	return len(b), nil
+}
+
+// CloseWrite is not supported, since KCP has no way to signal the end of a stream. The streams of
+// [StreamDialer] and [Listener] support it, since they are multiplexed with smux.
+func (c *conn) CloseWrite() error {
+	return errors.ErrUnsupported
+}
+
+// CloseRead discards the received data. Further reads fail.
+func (c *conn) CloseRead() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.readClosed = true
+	c.pending = nil
+	c.discardReceivedLocked()
+	c.notifyLocked()
+	return nil
+}
+
+// discardReceivedLocked drops the received messages, so the receive window stays open.
+func (c *conn) discardReceivedLocked() {
+	for c.kcp.recv() != nil {
+	}
+}
+
+// Close closes the session. The data already written is still delivered in the background, and the resources
+// are released once the peer acknowledges it or stops responding.
+func (c *conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.closed = true
+	c.closedAt = time.Now()
+	c.pending = nil
+	if c.kcp.waitSend() == 0 || c.err != nil {
+		c.failLocked(net.ErrClosed)
+	}
+	c.notifyLocked()
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.notifyLocked()
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.notifyLocked()
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	c.notifyLocked()
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	nonceSize = 16
+	crcSize   = 4
+	// cryptHeaderSize is the size of the header that kcp-go adds to packets when a crypt is configured.
+	cryptHeaderSize = nonceSize + crcSize
+
+	// keySalt and keyIterations are the PBKDF2 parameters kcptun uses to derive the key from the passphrase.
+	keySalt       = "kcp-go"
+	keyIterations = 4096
+)
+
+// initialVector is the fixed CFB initialization vector of kcp-go. The random nonce at the start of each packet
+// makes the ciphertexts differ.
+var initialVector = []byte{167, 115, 79, 156, 18, 172, 27, 1, 164, 21, 242, 193, 252, 120, 230, 107}
+
+// packetCrypt implements the packet encryption of kcp-go, the KCP library of kcptun. Packets have the format
+//
+//	+-------+-------+------------------+
+//	| nonce | crc32 | KCP segments ... |
+//	+-------+-------+------------------+
+//	|  16   |   4   |     variable     |
+//	+-------+-------+------------------+
+//
+// where the nonce is random, the crc32 is the IEEE checksum of the segments in little-endian, and the whole packet
+// is encrypted in CFB mode. A nil packetCrypt sends the bare segments, which is the "null" crypt of kcptun.
+type packetCrypt struct {
+	// block is nil for the "none" crypt, which has the header but no encryption.
+	block cipher.Block
+}
+
+// newPacketCrypt creates the packet crypt for the kcptun crypt name and passphrase.
+func newPacketCrypt(name string, key string) (*packetCrypt, error) {
+	var keySize int
+	switch name {
+	case "null":
+		return nil, nil
+	case "none":
+		return &packetCrypt{}, nil
+	case "aes":
+		keySize = 32
+	case "aes-192":
+		keySize = 24
+	case "aes-128":
+		keySize = 16
+	default:
+		return nil, fmt.Errorf("unsupported crypt %q", name)
+	}
+	derived := pbkdf2.Key([]byte(key), []byte(keySalt), keyIterations, 32, sha1.New)
+	block, err := aes.NewCipher(derived[:keySize])
+	if err != nil {
+		return nil, err
+	}
+	return &packetCrypt{block: block}, nil
+}
+
+// overhead returns the number of bytes the crypt adds to each packet.
+func (c *packetCrypt) overhead() int {
+	if c == nil {
+		return 0
+	}
+	return cryptHeaderSize
+}
+
+// seal returns the packet that carries the segments.
+func (c *packetCrypt) seal(segments []byte) ([]byte, error) {
+	if c == nil {
+		return append([]byte(nil), segments...), nil
+	}
+	packet := make([]byte, cryptHeaderSize+len(segments))
+	if _, err := rand.Read(packet[:nonceSize]); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint32(packet[nonceSize:], crc32.ChecksumIEEE(segments))
+	copy(packet[cryptHeaderSize:], segments)
+	if c.block != nil {
+		cipher.NewCFBEncrypter(c.block, initialVector).XORKeyStream(packet, packet)
+	}
+	return packet, nil
+}
+
+// open returns the segments in the packet, or false if the packet is not valid. It decrypts in place.
+func (c *packetCrypt) open(packet []byte) ([]byte, bool) {
+	if c == nil {
+		return packet, true
+	}
+	if len(packet) < cryptHeaderSize {
+		return nil, false
+	}
+	if c.block != nil {
+		cipher.NewCFBDecrypter(c.block, initialVector).XORKeyStream(packet, packet)
+	}
+	segments := packet[cryptHeaderSize:]
+	if binary.LittleEndian.Uint32(packet[nonceSize:]) != crc32.ChecksumIEEE(segments) {
+		return nil, false
+	}
+	return segments, true
+}
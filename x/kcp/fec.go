@@ -0,0 +1,246 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// fecHeaderSize is the size of the FEC header of kcp-go: the sequence number of the shard and its type.
+	fecHeaderSize = 6
+	// fecOverhead is the size of the FEC header plus the size field of the data shards.
+	fecOverhead = fecHeaderSize + 2
+
+	fecTypeData   = 0xf1
+	fecTypeParity = 0xf2
+
+	// fecExpire is how long the decoder keeps the shards of a group that can't be recovered yet.
+	fecExpire = time.Minute
+	// fecMaxGroups is the maximum number of groups the decoder keeps. The oldest ones are dropped first.
+	fecMaxGroups = 8
+)
+
+// fecEncoder adds the forward error correction of kcp-go to the packets of a session. Packets have the format
+//
+//	+-------+------+------+------------------+
+//	| seqid | type | size | KCP segments ... |
+//	+-------+------+------+------------------+
+//	|   4   |  2   |  2   |     variable     |
+//	+-------+------+------+------------------+
+//
+// in little-endian, where size counts itself and the segments. Every dataShards data packets are followed by
+// parityShards parity packets, which carry the Reed-Solomon parity of the data packets from the size field on,
+// padded with zeros to the longest one. The sequence numbers are consecutive, so the group of a packet is its
+// sequence number divided by the number of shards of a group.
+type fecEncoder struct {
+	rs         *reedSolomon
+	groupSize  uint32
+	wrapAround uint32
+	next       uint32
+	// shards are the data shards of the current group, from the size field on.
+	shards  [][]byte
+	maxSize int
+}
+
+func newFECEncoder(rs *reedSolomon) *fecEncoder {
+	groupSize := uint32(rs.dataShards + rs.parityShards)
+	return &fecEncoder{
+		rs:         rs,
+		groupSize:  groupSize,
+		wrapAround: 0xffffffff / groupSize * groupSize,
+		shards:     make([][]byte, 0, rs.dataShards),
+	}
+}
+
+func (e *fecEncoder) mark(packet []byte, shardType uint16) {
+	binary.LittleEndian.PutUint32(packet, e.next)
+	binary.LittleEndian.PutUint16(packet[4:], shardType)
+	e.next = (e.next + 1) % e.wrapAround
+}
+
+// encode returns the data packet with the segments, followed by the parity packets if it completes a group.
+func (e *fecEncoder) encode(segments []byte) [][]byte {
+	packet := make([]byte, fecOverhead+len(segments))
+	e.mark(packet, fecTypeData)
+	binary.LittleEndian.PutUint16(packet[fecHeaderSize:], uint16(len(packet)-fecHeaderSize))
+	copy(packet[fecOverhead:], segments)
+	packets := [][]byte{packet}
+
+	e.shards = append(e.shards, packet[fecHeaderSize:])
+	if size := len(packet) - fecHeaderSize; size > e.maxSize {
+		e.maxSize = size
+	}
+	if len(e.shards) < e.rs.dataShards {
+		return packets
+	}
+	shards := make([][]byte, 0, e.groupSize)
+	for _, shard := range e.shards {
+		padded := make([]byte, e.maxSize)
+		copy(padded, shard)
+		shards = append(shards, padded)
+	}
+	parityPackets := make([][]byte, e.rs.parityShards)
+	for i := range parityPackets {
+		parityPackets[i] = make([]byte, fecHeaderSize+e.maxSize)
+		shards = append(shards, parityPackets[i][fecHeaderSize:])
+	}
+	e.rs.encode(shards)
+	for _, parityPacket := range parityPackets {
+		e.mark(parityPacket, fecTypeParity)
+	}
+	e.shards = e.shards[:0]
+	e.maxSize = 0
+	return append(packets, parityPackets...)
+}
+
+// isFECPacket returns whether the packet has an FEC header, and of which type.
+func isFECPacket(packet []byte) (shardType uint16, ok bool) {
+	if len(packet) < fecHeaderSize {
+		return 0, false
+	}
+	shardType = binary.LittleEndian.Uint16(packet[4:])
+	return shardType, shardType == fecTypeData || shardType == fecTypeParity
+}
+
+// dataShardSegments returns the segments in a data shard, which starts at the size field.
+func dataShardSegments(shard []byte) ([]byte, bool) {
+	if len(shard) < 2 {
+		return nil, false
+	}
+	size := int(binary.LittleEndian.Uint16(shard))
+	if size < 2 || size > len(shard) {
+		return nil, false
+	}
+	return shard[2:size], true
+}
+
+// fecGroup holds the received shards of a group until it's recovered.
+type fecGroup struct {
+	created time.Time
+	// shards are nil once the group is complete.
+	shards [][]byte
+	count  int
+}
+
+// fecDecoder recovers the data packets lost in groups that are otherwise complete. See [fecEncoder].
+type fecDecoder struct {
+	rs        *reedSolomon
+	groupSize uint32
+	groups    map[uint32]*fecGroup
+}
+
+func newFECDecoder(rs *reedSolomon) *fecDecoder {
+	return &fecDecoder{
+		rs:        rs,
+		groupSize: uint32(rs.dataShards + rs.parityShards),
+		groups:    make(map[uint32]*fecGroup),
+	}
+}
+
+// decode returns the segments of the packet, if it's a data packet, followed by the segments of the data packets
+// it recovers.
+func (d *fecDecoder) decode(packet []byte, now time.Time) [][]byte {
+	shardType, ok := isFECPacket(packet)
+	if !ok {
+		return nil
+	}
+	var segments [][]byte
+	shard := packet[fecHeaderSize:]
+	if shardType == fecTypeData {
+		data, ok := dataShardSegments(shard)
+		if !ok {
+			return nil
+		}
+		segments = append(segments, data)
+	}
+
+	seqid := binary.LittleEndian.Uint32(packet)
+	groupID, index := seqid/d.groupSize, seqid%d.groupSize
+	if (shardType == fecTypeData) != (int(index) < d.rs.dataShards) {
+		// The shard type doesn't match the configuration.
+		return segments
+	}
+	group := d.groups[groupID]
+	if group == nil {
+		d.expire(now)
+		group = &fecGroup{created: now, shards: make([][]byte, d.groupSize)}
+		d.groups[groupID] = group
+	}
+	if group.shards == nil || group.shards[index] != nil {
+		return segments
+	}
+	group.shards[index] = append([]byte(nil), shard...)
+	group.count++
+	if group.count < d.rs.dataShards {
+		return segments
+	}
+	shards := group.shards
+	group.shards = nil
+	missing := false
+	maxSize := 0
+	for i, shard := range shards {
+		if shard == nil && i < d.rs.dataShards {
+			missing = true
+		}
+		if len(shard) > maxSize {
+			maxSize = len(shard)
+		}
+	}
+	if !missing {
+		return segments
+	}
+	for i, shard := range shards {
+		if shard != nil && len(shard) < maxSize {
+			shards[i] = append(shard, make([]byte, maxSize-len(shard))...)
+		}
+	}
+	present := make([]bool, d.rs.dataShards)
+	for i := range present {
+		present[i] = shards[i] != nil
+	}
+	if err := d.rs.reconstructData(shards); err != nil {
+		return segments
+	}
+	for i, wasPresent := range present {
+		if wasPresent {
+			continue
+		}
+		if data, ok := dataShardSegments(shards[i]); ok {
+			segments = append(segments, data)
+		}
+	}
+	return segments
+}
+
+// expire drops the groups that are too old, and the oldest groups if there are too many.
+func (d *fecDecoder) expire(now time.Time) {
+	for id, group := range d.groups {
+		if now.Sub(group.created) > fecExpire {
+			delete(d.groups, id)
+		}
+	}
+	for len(d.groups) >= fecMaxGroups {
+		var oldestID uint32
+		var oldest *fecGroup
+		for id, group := range d.groups {
+			if oldest == nil || group.created.Before(oldest.created) {
+				oldestID, oldest = id, group
+			}
+		}
+		delete(d.groups, oldestID)
+	}
+}
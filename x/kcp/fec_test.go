@@ -0,0 +1,133 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReedSolomon_Matrix(t *testing.T) {
+	// With 2 data shards, the Vandermonde rows are [1 0], [1 1] and [1 2], and the top square is its own inverse,
+	// so the parity row is [1^2 2] = [3 2].
+	rs, err := newReedSolomon(2, 1)
+	require.NoError(t, err)
+	shards := [][]byte{{1, 0x80}, {1, 0x80}, make([]byte, 2)}
+	rs.encode(shards)
+	require.Equal(t, []byte{gfMul(3, 1) ^ gfMul(2, 1), gfMul(3, 0x80) ^ gfMul(2, 0x80)}, shards[2])
+	require.Equal(t, []byte{1, 0x80}, shards[0])
+}
+
+func TestReedSolomon_Reconstruct(t *testing.T) {
+	rs, err := newReedSolomon(10, 3)
+	require.NoError(t, err)
+	shards := make([][]byte, 13)
+	for i := range shards {
+		shards[i] = make([]byte, 100)
+		if i < 10 {
+			rand.Read(shards[i])
+		}
+	}
+	rs.encode(shards)
+	for _, missing := range [][]int{{0}, {9}, {0, 1, 2}, {3, 10, 12}, {5, 7}, {10, 11, 12}} {
+		damaged := make([][]byte, len(shards))
+		for i := range shards {
+			damaged[i] = append([]byte(nil), shards[i]...)
+		}
+		for _, i := range missing {
+			damaged[i] = nil
+		}
+		require.NoError(t, rs.reconstructData(damaged), "missing %v", missing)
+		for i := 0; i < 10; i++ {
+			require.Equal(t, shards[i], damaged[i], "missing %v", missing)
+		}
+	}
+	damaged := append([][]byte(nil), shards...)
+	damaged[0], damaged[1], damaged[2], damaged[3] = nil, nil, nil, nil
+	require.Error(t, rs.reconstructData(damaged))
+}
+
+func TestFEC_Format(t *testing.T) {
+	rs, err := newReedSolomon(2, 1)
+	require.NoError(t, err)
+	encoder := newFECEncoder(rs)
+	packets := encoder.encode([]byte("a"))
+	require.Equal(t, [][]byte{{0, 0, 0, 0, 0xf1, 0, 3, 0, 'a'}}, packets)
+	packets = encoder.encode([]byte("bcd"))
+	require.Len(t, packets, 2)
+	require.Equal(t, []byte{1, 0, 0, 0, 0xf1, 0, 5, 0, 'b', 'c', 'd'}, packets[0])
+	// The parity of the shards from the size field on, padded to the longest one.
+	parity := packets[1]
+	require.Equal(t, []byte{2, 0, 0, 0, 0xf2, 0}, parity[:fecHeaderSize])
+	require.Len(t, parity, fecHeaderSize+5)
+	shards := [][]byte{{3, 0, 'a', 0, 0}, {5, 0, 'b', 'c', 'd'}, make([]byte, 5)}
+	rs.encode(shards)
+	require.Equal(t, shards[2], parity[fecHeaderSize:])
+	require.Equal(t, uint32(3), binary.LittleEndian.Uint32(encoder.encode(nil)[0]))
+}
+
+func TestFEC_Recover(t *testing.T) {
+	rs, err := newReedSolomon(10, 3)
+	require.NoError(t, err)
+	encoder := newFECEncoder(rs)
+	decoder := newFECDecoder(rs)
+	var sent, received [][]byte
+	for group := 0; group < 3; group++ {
+		var packets [][]byte
+		for i := 0; i < 10; i++ {
+			segments := make([]byte, 1+group*10+i)
+			rand.Read(segments)
+			sent = append(sent, segments)
+			packets = append(packets, encoder.encode(segments)...)
+		}
+		require.Len(t, packets, 13)
+		// Lose 3 packets of each group, including the last data packet.
+		for i, packet := range packets {
+			if i == 9 || i == group || i == 11 {
+				continue
+			}
+			received = append(received, decoder.decode(packet, time.Now())...)
+		}
+	}
+	require.Len(t, received, len(sent))
+	for _, segments := range sent {
+		found := false
+		for _, r := range received {
+			found = found || bytes.Equal(segments, r)
+		}
+		require.True(t, found)
+	}
+}
+
+func TestFEC_Expire(t *testing.T) {
+	rs, err := newReedSolomon(2, 1)
+	require.NoError(t, err)
+	decoder := newFECDecoder(rs)
+	encoder := newFECEncoder(rs)
+	now := time.Now()
+	for i := 0; i < 2*fecMaxGroups; i++ {
+		// Only the first packet of each group arrives.
+		decoder.decode(encoder.encode([]byte("x"))[0], now)
+		encoder.encode([]byte("y"))
+	}
+	require.Len(t, decoder.groups, fecMaxGroups)
+	decoder.decode(encoder.encode([]byte("x"))[0], now.Add(2*fecExpire))
+	require.Len(t, decoder.groups, 1)
+}
@@ -0,0 +1,558 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kcp provides reliable connections over packet connections with the [KCP protocol], for high-latency,
+// lossy links where the congestion control of TCP underperforms. KCP trades bandwidth for latency: it retransmits
+// lost segments faster and more aggressively than TCP, and can be configured to ignore congestion altogether.
+//
+// The streams are compatible with [kcptun]: the [StreamDialer] can connect to a kcptun server, and the [Listener]
+// accepts the streams of kcptun clients. As in kcptun, the packets carry:
+//   - The KCP segments, with the mode presets "normal", "fast", "fast2" and "fast3", or "manual" with explicit
+//     NoDelay, Interval, Resend and NoCongestion options, and the MTU and the send and receive windows.
+//   - The Reed-Solomon forward error correction of kcp-go, the KCP library of kcptun, with the DataShards and
+//     ParityShards options.
+//   - The "null", "none", "aes", "aes-128" and "aes-192" crypts, with the key derived from a passphrase as in
+//     kcp-go. The other crypts of kcptun are not supported.
+//
+// The streams are multiplexed with [smux] on a single KCP session per address, compressed with [snappy] unless
+// NoComp is set. The [PacketDialer] and the [Listener] from [NewPacketListener] instead run a bare KCP session
+// in message mode per connection, which is specific to this package.
+//
+// [KCP protocol]: https://github.com/skywind3000/kcp/blob/master/protocol.txt
+// [kcptun]: https://github.com/xtaci/kcptun
+// [smux]: https://github.com/xtaci/smux
+// [snappy]: https://github.com/google/snappy/blob/main/framing_format.txt
+package kcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// ErrRetransmitTimeout is returned when the peer doesn't acknowledge data after repeated retransmissions.
+var ErrRetransmitTimeout = errors.New("peer stopped acknowledging data")
+
+// ErrMessageTooLong is returned when a message doesn't fit in the fragments of a KCP message.
+var ErrMessageTooLong = errMessageTooLong
+
+// Defaults, which follow the defaults of kcptun.
+const (
+	DefaultMode       = "fast"
+	DefaultMTU        = 1350
+	DefaultSendWindow = 128
+	DefaultRecvWindow = 512
+	DefaultCrypt      = "aes"
+	// DefaultDataShards and DefaultParityShards configure the forward error correction.
+	DefaultDataShards   = 10
+	DefaultParityShards = 3
+	// DefaultKey is the passphrase kcptun uses when none is given. It offers no confidentiality.
+	DefaultKey = "it's a secrect"
+)
+
+// Config configures the KCP sessions. The zero value uses the defaults.
+type Config struct {
+	// Mode is the mode preset, as in kcptun: "normal", "fast", "fast2", "fast3", or "manual" to use the NoDelay, Interval,
+	// Resend and NoCongestion options. If empty, [DefaultMode] is used.
+	Mode string
+	// NoDelay lowers the minimum retransmission timeout and makes its backoff less aggressive.
+	NoDelay bool
+	// Interval is how often the session flushes and checks for retransmissions. It's clamped to [10ms, 5s].
+	Interval time.Duration
+	// Resend is the number of skipping acknowledgments that triggers a fast retransmission. Zero disables it.
+	Resend int
+	// NoCongestion disables the congestion window, so only the send and receive windows limit the flow.
+	NoCongestion bool
+
+	// MTU is the maximum size of the packets, including the crypt header. If zero, [DefaultMTU] is used.
+	MTU int
+	// SendWindow is the maximum number of segments in flight. If zero, [DefaultSendWindow] is used.
+	SendWindow int
+	// RecvWindow is the number of segments buffered for reading. If zero, [DefaultRecvWindow] is used.
+	RecvWindow int
+	// AckNoDelay sends acknowledgments as soon as packets arrive, instead of on the next interval.
+	AckNoDelay bool
+
+	// Crypt is the packet crypt, as in kcptun: "null" for bare segments, "none" for the integrity header only, or "aes",
+	// "aes-192", "aes-128". If empty, [DefaultCrypt] is used.
+	Crypt string
+	// Key is the passphrase for the crypt. If empty, [DefaultKey] is used.
+	Key string
+
+	// DataShards and ParityShards configure the forward error correction, as the datashard and parityshard options
+	// of kcptun: each group of DataShards packets is followed by ParityShards parity packets, which recover up to
+	// ParityShards lost packets of the group. If both are zero, [DefaultDataShards] and [DefaultParityShards] are
+	// used. If either is negative, the forward error correction is disabled.
+	DataShards   int
+	ParityShards int
+
+	// NoComp disables the compression of the streams, as the nocomp option of kcptun.
+	NoComp bool
+	// SmuxVersion is the version of the smux protocol of the streams, 1 or 2, as the smuxver option of kcptun.
+	// If zero, 1 is used.
+	SmuxVersion int
+}
+
+// sessionParams are the resolved parameters of a [Config].
+type sessionParams struct {
+	nodelay    bool
+	interval   time.Duration
+	resend     int
+	nocwnd     bool
+	mtu        int
+	sndWnd     int
+	rcvWnd     int
+	ackNoDelay bool
+	crypt      *packetCrypt
+	// fec is nil if the forward error correction is disabled.
+	fec         *reedSolomon
+	noComp      bool
+	smuxVersion byte
+}
+
+// packetOverhead returns the size of the headers in front of the KCP segments.
+func (p *sessionParams) packetOverhead() int {
+	if p.fec == nil {
+		return p.crypt.overhead()
+	}
+	return p.crypt.overhead() + fecOverhead
+}
+
+// segments returns the KCP segments in a decrypted packet, which are empty for FEC parity packets.
+func (p *sessionParams) segments(packet []byte) ([]byte, bool) {
+	shardType, ok := isFECPacket(packet)
+	if p.fec == nil || !ok {
+		return packet, true
+	}
+	if shardType == fecTypeParity {
+		return nil, true
+	}
+	return dataShardSegments(packet[fecHeaderSize:])
+}
+
+func (c *Config) params() (*sessionParams, error) {
+	var config Config
+	if c != nil {
+		config = *c
+	}
+	p := &sessionParams{
+		mtu:        config.MTU,
+		sndWnd:     config.SendWindow,
+		rcvWnd:     config.RecvWindow,
+		ackNoDelay: config.AckNoDelay,
+		noComp:     config.NoComp,
+	}
+	if config.Mode == "" {
+		config.Mode = DefaultMode
+	}
+	switch config.Mode {
+	case "normal":
+		p.nodelay, p.interval, p.resend, p.nocwnd = false, 40*time.Millisecond, 2, true
+	case "fast":
+		p.nodelay, p.interval, p.resend, p.nocwnd = false, 30*time.Millisecond, 2, true
+	case "fast2":
+		p.nodelay, p.interval, p.resend, p.nocwnd = true, 20*time.Millisecond, 2, true
+	case "fast3":
+		p.nodelay, p.interval, p.resend, p.nocwnd = true, 10*time.Millisecond, 2, true
+	case "manual":
+		p.nodelay, p.interval, p.resend, p.nocwnd = config.NoDelay, config.Interval, config.Resend, config.NoCongestion
+		if p.resend < 0 {
+			return nil, fmt.Errorf("resend must not be negative")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported mode %q", config.Mode)
+	}
+	if p.interval < 10*time.Millisecond {
+		p.interval = 10 * time.Millisecond
+	} else if p.interval > 5*time.Second {
+		p.interval = 5 * time.Second
+	}
+	if p.sndWnd <= 0 {
+		p.sndWnd = DefaultSendWindow
+	}
+	if p.rcvWnd <= 0 {
+		p.rcvWnd = DefaultRecvWindow
+	}
+	if p.sndWnd > 0xffff || p.rcvWnd > 0xffff {
+		return nil, errors.New("windows must fit in 16 bits")
+	}
+	if config.Crypt == "" {
+		config.Crypt = DefaultCrypt
+	}
+	if config.Key == "" {
+		config.Key = DefaultKey
+	}
+	crypt, err := newPacketCrypt(config.Crypt, config.Key)
+	if err != nil {
+		return nil, err
+	}
+	p.crypt = crypt
+	if config.DataShards == 0 && config.ParityShards == 0 {
+		config.DataShards, config.ParityShards = DefaultDataShards, DefaultParityShards
+	}
+	if config.DataShards > 0 && config.ParityShards > 0 {
+		if config.DataShards+config.ParityShards > 0xff {
+			return nil, errors.New("there must be at most 255 shards")
+		}
+		if p.fec, err = newReedSolomon(config.DataShards, config.ParityShards); err != nil {
+			return nil, err
+		}
+	}
+	switch config.SmuxVersion {
+	case 0, 1:
+		p.smuxVersion = 1
+	case 2:
+		p.smuxVersion = 2
+	default:
+		return nil, fmt.Errorf("unsupported smux version %v", config.SmuxVersion)
+	}
+	if p.mtu <= 0 {
+		p.mtu = DefaultMTU
+	}
+	if p.mtu-p.packetOverhead() <= overhead {
+		return nil, fmt.Errorf("MTU %v is too small", p.mtu)
+	}
+	return p, nil
+}
+
+// StreamDialer is a [transport.StreamDialer] that multiplexes streams on KCP sessions over packet connections
+// from a [transport.PacketDialer].
+type StreamDialer struct {
+	dialer transport.PacketDialer
+	params *sessionParams
+
+	mu       sync.Mutex
+	sessions map[string]*muxSession
+}
+
+var _ transport.StreamDialer = (*StreamDialer)(nil)
+
+// NewStreamDialer creates a [StreamDialer] that multiplexes the streams to each address on a KCP session in stream
+// mode, on a packet connection from the dialer, as kcptun does. The session is created on the first stream, and
+// closed after it has no streams for a minute or the peer stops responding. The config may be nil to use the
+// defaults.
+func NewStreamDialer(dialer transport.PacketDialer, config *Config) (*StreamDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	params, err := config.params()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &StreamDialer{dialer: dialer, params: params, sessions: make(map[string]*muxSession)}, nil
+}
+
+// DialStream implements [transport.StreamDialer]. The peer at the address must run a kcptun server, a [Listener],
+// or a compatible implementation. DialStream doesn't wait for the peer, since opening a stream has no handshake.
+func (d *StreamDialer) DialStream(ctx context.Context, address string) (transport.StreamConn, error) {
+	d.mu.Lock()
+	session := d.sessions[address]
+	d.mu.Unlock()
+	if session != nil {
+		if stream, err := session.openStream(); err == nil {
+			return stream, nil
+		}
+	}
+	session, err := d.dialMuxSession(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := session.openStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// dialMuxSession creates a session for the address, unless another call already replaced a closed one.
+func (d *StreamDialer) dialMuxSession(ctx context.Context, address string) (*muxSession, error) {
+	c, err := dialSession(ctx, d.dialer, address, d.params, false)
+	if err != nil {
+		return nil, err
+	}
+	session := newStreamSession(c, d.params, true)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if current := d.sessions[address]; current != nil && !current.isClosed() {
+		session.fail(net.ErrClosed)
+		return current, nil
+	}
+	d.sessions[address] = session
+	go func() {
+		<-session.done
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.sessions[address] == session {
+			delete(d.sessions, address)
+		}
+	}()
+	return session, nil
+}
+
+// newStreamSession starts the smux session of the streams on a KCP session, with the snappy compression unless
+// disabled.
+func newStreamSession(c *conn, params *sessionParams, client bool) *muxSession {
+	var rw io.ReadWriteCloser = c
+	if !params.noComp {
+		rw = newCompStream(c)
+	}
+	return newMuxSession(rw, params.smuxVersion, client, c.LocalAddr(), c.RemoteAddr())
+}
+
+// PacketDialer is a [transport.PacketDialer] that creates KCP sessions in message mode over packet connections
+// from another [transport.PacketDialer]. The messages are delivered reliably and in order, and each message is
+// read whole by a single Read, as long as the buffer fits it.
+type PacketDialer struct {
+	dialer transport.PacketDialer
+	params *sessionParams
+}
+
+var _ transport.PacketDialer = (*PacketDialer)(nil)
+
+// NewPacketDialer creates a [PacketDialer] that runs each connection as a KCP session in message mode on its own
+// packet connection from the dialer. The config may be nil to use the defaults.
+func NewPacketDialer(dialer transport.PacketDialer, config *Config) (*PacketDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	params, err := config.params()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &PacketDialer{dialer: dialer, params: params}, nil
+}
+
+// DialPacket implements [transport.PacketDialer]. Messages longer than the receive window or 255 segments fail
+// with [ErrMessageTooLong].
+func (d *PacketDialer) DialPacket(ctx context.Context, address string) (net.Conn, error) {
+	c, err := dialSession(ctx, d.dialer, address, d.params, true)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func dialSession(ctx context.Context, dialer transport.PacketDialer, address string, params *sessionParams, messages bool) (*conn, error) {
+	var convBytes [4]byte
+	if _, err := rand.Read(convBytes[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate conversation ID: %w", err)
+	}
+	pc, err := dialer.DialPacket(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	send := func(packet []byte) error {
+		_, err := pc.Write(packet)
+		return err
+	}
+	release := func() { pc.Close() }
+	c := newConn(binary.LittleEndian.Uint32(convBytes[:]), params, messages, send, release, pc.LocalAddr(), pc.RemoteAddr())
+	go func() {
+		buf := make([]byte, 0xffff)
+		for {
+			n, err := pc.Read(buf)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			c.input(buf[:n])
+		}
+	}()
+	return c, nil
+}
+
+// acceptQueueSize is the number of connections that can wait for Accept. In message mode, new sessions are dropped
+// when it's full.
+const acceptQueueSize = 32
+
+// Listener accepts connections from peers on a [net.PacketConn]. It implements [net.Listener].
+type Listener struct {
+	pc       net.PacketConn
+	params   *sessionParams
+	messages bool
+	acceptCh chan net.Conn
+	done     chan struct{}
+
+	mu sync.Mutex
+	// sessions has the KCP session of each peer address. As in kcp-go, a new conversation from an address replaces
+	// its session.
+	sessions map[string]*conn
+	err      error
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// NewListener creates a [Listener] that accepts the streams of peers that use [StreamDialer] or kcptun, and starts
+// reading from pc. The accepted connections are [transport.StreamConn]. The config may be nil to use the defaults,
+// and must match the config of the peers.
+func NewListener(pc net.PacketConn, config *Config) (*Listener, error) {
+	return newListener(pc, config, false)
+}
+
+// NewPacketListener creates a [Listener] that serves the sessions on pc in message mode, for peers that use
+// [PacketDialer], and starts reading from it. The config may be nil to use the defaults.
+func NewPacketListener(pc net.PacketConn, config *Config) (*Listener, error) {
+	return newListener(pc, config, true)
+}
+
+func newListener(pc net.PacketConn, config *Config, messages bool) (*Listener, error) {
+	if pc == nil {
+		return nil, errors.New("argument pc must not be nil")
+	}
+	params, err := config.params()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	l := &Listener{
+		pc:       pc,
+		params:   params,
+		messages: messages,
+		acceptCh: make(chan net.Conn, acceptQueueSize),
+		done:     make(chan struct{}),
+		sessions: make(map[string]*conn),
+	}
+	go l.serve()
+	return l, nil
+}
+
+func (l *Listener) serve() {
+	buf := make([]byte, 0xffff)
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			l.closeWithError(err)
+			return
+		}
+		packet := buf[:n]
+		// The conn decrypts the packet again, so decrypt a copy.
+		decrypted, ok := l.params.crypt.open(append([]byte(nil), packet...))
+		if !ok {
+			continue
+		}
+		segments, ok := l.params.segments(decrypted)
+		if !ok {
+			continue
+		}
+		address := addr.String()
+		l.mu.Lock()
+		c := l.sessions[address]
+		var replaced *conn
+		// Only data starts new sessions, so stray acknowledgments don't.
+		if len(segments) >= overhead && segments[4] == cmdPush {
+			if conv := binary.LittleEndian.Uint32(segments); c == nil || c.kcp.conv != conv {
+				replaced = c
+				c = l.newSessionLocked(address, conv, addr)
+				if !l.messages {
+					go l.acceptStreams(c)
+				} else {
+					select {
+					case l.acceptCh <- c:
+					default:
+						delete(l.sessions, address)
+						c = nil
+					}
+				}
+			}
+		}
+		l.mu.Unlock()
+		// The conns are called without the listener lock, since releasing a conn takes the lock.
+		if replaced != nil {
+			replaced.fail(net.ErrClosed)
+		}
+		if c != nil {
+			c.input(packet)
+		}
+	}
+}
+
+func (l *Listener) newSessionLocked(address string, conv uint32, addr net.Addr) *conn {
+	var c *conn
+	send := func(packet []byte) error {
+		_, err := l.pc.WriteTo(packet, addr)
+		return err
+	}
+	release := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.sessions[address] == c {
+			delete(l.sessions, address)
+		}
+	}
+	c = newConn(conv, l.params, l.messages, send, release, l.pc.LocalAddr(), addr)
+	l.sessions[address] = c
+	return c
+}
+
+// acceptStreams queues the streams the peer opens on the session.
+func (l *Listener) acceptStreams(c *conn) {
+	session := newStreamSession(c, l.params, false)
+	for {
+		stream, err := session.accept()
+		if err != nil {
+			return
+		}
+		select {
+		case l.acceptCh <- stream:
+		case <-l.done:
+			session.fail(net.ErrClosed)
+			return
+		}
+	}
+}
+
+func (l *Listener) closeWithError(err error) {
+	l.mu.Lock()
+	if l.err != nil {
+		l.mu.Unlock()
+		return
+	}
+	l.err = err
+	close(l.done)
+	sessions := l.sessions
+	l.sessions = make(map[string]*conn)
+	l.mu.Unlock()
+	for _, c := range sessions {
+		c.fail(net.ErrClosed)
+	}
+}
+
+// Accept waits for and returns the next stream, or the next session in message mode.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.acceptCh:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener, closes the packet connection, and aborts the sessions.
+func (l *Listener) Close() error {
+	err := l.pc.Close()
+	l.closeWithError(net.ErrClosed)
+	return err
+}
+
+// Addr returns the local address of the packet connection.
+func (l *Listener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
@@ -0,0 +1,434 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	mrand "math/rand"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// lossyPacketConn drops outgoing packets at random.
+type lossyPacketConn struct {
+	net.PacketConn
+	mu       sync.Mutex
+	rand     *mrand.Rand
+	dropRate float64
+}
+
+func (c *lossyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	drop := c.rand.Float64() < c.dropRate
+	c.mu.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+// lossyConn drops outgoing packets of a connected net.Conn at random.
+type lossyConn struct {
+	net.Conn
+	mu       sync.Mutex
+	rand     *mrand.Rand
+	dropRate float64
+}
+
+func (c *lossyConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	drop := c.rand.Float64() < c.dropRate
+	c.mu.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+func newUDPPacketConn(t *testing.T) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return pc
+}
+
+// startEchoServer runs a listener that echoes each session back.
+func startEchoServer(t *testing.T, listener *Listener) {
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 0xffff)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					if _, err := conn.Write(buf[:n]); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+}
+
+func echoStream(t *testing.T, dialer transport.StreamDialer, address string, size int) {
+	conn, err := dialer.DialStream(context.Background(), address)
+	require.NoError(t, err)
+	defer conn.Close()
+	data := make([]byte, size)
+	rand.Read(data)
+
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(data)
+		writeErr <- err
+	}()
+	conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+	received := make([]byte, size)
+	_, err = io.ReadFull(conn, received)
+	require.NoError(t, err)
+	require.NoError(t, <-writeErr)
+	require.True(t, bytes.Equal(data, received))
+}
+
+func TestStreamDialer_Echo(t *testing.T) {
+	listener, err := NewListener(newUDPPacketConn(t), nil)
+	require.NoError(t, err)
+	startEchoServer(t, listener)
+	dialer, err := NewStreamDialer(&transport.UDPDialer{}, nil)
+	require.NoError(t, err)
+	echoStream(t, dialer, listener.Addr().String(), 1<<20)
+}
+
+// Talks to the dialer with packets written by hand from the descriptions of the KCP protocol, the FEC of kcp-go,
+// the snappy framing format and smux, instead of with this package, to catch changes that would only be
+// compatible with itself.
+func TestStreamDialer_RawPeer(t *testing.T) {
+	peer := newUDPPacketConn(t)
+	defer peer.Close()
+	dialer, err := NewStreamDialer(&transport.UDPDialer{}, &Config{Crypt: "null"})
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), peer.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	// The stream arrives in PUSH segments, in FEC data packets followed by parity packets.
+	smuxSYN := []byte{1, 0, 0, 0, 3, 0, 0, 0}
+	smuxPSH := append([]byte{1, 2, 5, 0, 3, 0, 0, 0}, "hello"...)
+	var expected []byte
+	expected = append(expected, 0xff, 6, 0, 0)
+	expected = append(expected, "sNaPpY"...)
+	// The frames are too short to compress.
+	for _, frame := range [][]byte{smuxSYN, smuxPSH} {
+		expected = append(expected, 0x01, byte(4+len(frame)), 0, 0)
+		expected = binary.LittleEndian.AppendUint32(expected, maskedCRC32C(frame))
+		expected = append(expected, frame...)
+	}
+	buf := make([]byte, 1500)
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var conv uint32
+	var acks []byte
+	var clientAddr net.Addr
+	var received []byte
+	for nextSN := uint32(0); len(received) < len(expected); {
+		n, addr, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		clientAddr = addr
+		packet := buf[:n]
+		require.GreaterOrEqual(t, len(packet), 6)
+		flag := binary.LittleEndian.Uint16(packet[4:6])
+		if flag == 0xf2 {
+			continue
+		}
+		require.Equal(t, uint16(0xf1), flag)
+		size := int(binary.LittleEndian.Uint16(packet[6:8]))
+		require.LessOrEqual(t, 6+size, len(packet))
+		for packet = packet[8 : 6+size]; len(packet) > 0; {
+			require.GreaterOrEqual(t, len(packet), 24)
+			length := int(binary.LittleEndian.Uint32(packet[20:24]))
+			require.GreaterOrEqual(t, len(packet), 24+length)
+			if packet[4] == 81 {
+				conv = binary.LittleEndian.Uint32(packet[0:4])
+				ts := binary.LittleEndian.Uint32(packet[8:12])
+				sn := binary.LittleEndian.Uint32(packet[12:16])
+				if sn == nextSN {
+					received = append(received, packet[24:24+length]...)
+					nextSN++
+				}
+				acks = appendSegment(acks, conv, 82, ts, sn, nextSN, nil)
+			}
+			packet = packet[24+length:]
+		}
+	}
+	require.Equal(t, expected, received)
+
+	// Acknowledge it and send data back in the same packet.
+	smuxReply := append([]byte{1, 2, 5, 0, 3, 0, 0, 0}, "world"...)
+	var stream []byte
+	stream = append(stream, 0xff, 6, 0, 0)
+	stream = append(stream, "sNaPpY"...)
+	stream = append(stream, 0x01, byte(4+len(smuxReply)), 0, 0)
+	stream = binary.LittleEndian.AppendUint32(stream, maskedCRC32C(smuxReply))
+	stream = append(stream, smuxReply...)
+	segments := appendSegment(acks, conv, 81, 0, 0, 2, stream)
+	reply := binary.LittleEndian.AppendUint32(nil, 0)
+	reply = binary.LittleEndian.AppendUint16(reply, 0xf1)
+	reply = binary.LittleEndian.AppendUint16(reply, uint16(2+len(segments)))
+	reply = append(reply, segments...)
+	_, err = peer.WriteTo(reply, clientAddr)
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data := make([]byte, 5)
+	_, err = io.ReadFull(conn, data)
+	require.NoError(t, err)
+	require.Equal(t, "world", string(data))
+}
+
+func TestStreamDialer_Lossy(t *testing.T) {
+	config := &Config{Mode: "fast3", Crypt: "none"}
+	serverPC := &lossyPacketConn{PacketConn: newUDPPacketConn(t), rand: mrand.New(mrand.NewSource(1)), dropRate: 0.2}
+	listener, err := NewListener(serverPC, config)
+	require.NoError(t, err)
+	startEchoServer(t, listener)
+
+	rng := mrand.New(mrand.NewSource(2))
+	lossyDialer := transport.FuncPacketDialer(func(ctx context.Context, address string) (net.Conn, error) {
+		conn, err := (&transport.UDPDialer{}).DialPacket(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		return &lossyConn{Conn: conn, rand: rng, dropRate: 0.2}, nil
+	})
+	dialer, err := NewStreamDialer(lossyDialer, config)
+	require.NoError(t, err)
+	echoStream(t, dialer, listener.Addr().String(), 200_000)
+}
+
+func TestStreamDialer_Concurrent(t *testing.T) {
+	config := &Config{Crypt: "null", AckNoDelay: true}
+	listener, err := NewListener(newUDPPacketConn(t), config)
+	require.NoError(t, err)
+	startEchoServer(t, listener)
+	dialer, err := NewStreamDialer(&transport.UDPDialer{}, config)
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			echoStream(t, dialer, listener.Addr().String(), 50_000)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPacketDialer_Messages(t *testing.T) {
+	listener, err := NewPacketListener(newUDPPacketConn(t), nil)
+	require.NoError(t, err)
+	startEchoServer(t, listener)
+	dialer, err := NewPacketDialer(&transport.UDPDialer{}, nil)
+	require.NoError(t, err)
+	conn, err := dialer.DialPacket(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sizes := []int{1, 100, 5000, 1, 20_000}
+	for _, size := range sizes {
+		msg := make([]byte, size)
+		rand.Read(msg)
+		_, err := conn.Write(msg)
+		require.NoError(t, err)
+	}
+	_, err = conn.Write(make([]byte, 1<<20))
+	require.ErrorIs(t, err, ErrMessageTooLong)
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	buf := make([]byte, 0xffff)
+	for _, size := range sizes {
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, size, n)
+	}
+
+	// Messages that don't fit are truncated.
+	_, err = conn.Write([]byte("truncated"))
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("next"))
+	require.NoError(t, err)
+	n, err := conn.Read(buf[:5])
+	require.NoError(t, err)
+	require.Equal(t, "trunc", string(buf[:n]))
+	n, err = conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "next", string(buf[:n]))
+}
+
+func TestStreamDialer_WrongKey(t *testing.T) {
+	listener, err := NewListener(newUDPPacketConn(t), &Config{Key: "server"})
+	require.NoError(t, err)
+	startEchoServer(t, listener)
+	dialer, err := NewStreamDialer(&transport.UDPDialer{}, &Config{Key: "client"})
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	_, err = conn.Read(make([]byte, 10))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestConn_Close(t *testing.T) {
+	listener, err := NewListener(newUDPPacketConn(t), nil)
+	require.NoError(t, err)
+	startEchoServer(t, listener)
+	dialer, err := NewStreamDialer(&transport.UDPDialer{}, nil)
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+
+	// The echo server closes the stream when it reads the end of it.
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	_, err = conn.Write([]byte("x"))
+	require.ErrorIs(t, err, net.ErrClosed)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	received, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(received))
+
+	require.NoError(t, conn.Close())
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, net.ErrClosed)
+	_, err = conn.Write([]byte("x"))
+	require.ErrorIs(t, err, net.ErrClosed)
+	require.ErrorIs(t, conn.Close(), net.ErrClosed)
+}
+
+func TestPacketDialer_CloseWrite(t *testing.T) {
+	dialer, err := NewPacketDialer(&transport.UDPDialer{}, nil)
+	require.NoError(t, err)
+	conn, err := dialer.DialPacket(context.Background(), "127.0.0.1:9")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.ErrorIs(t, conn.(transport.StreamConn).CloseWrite(), errors.ErrUnsupported)
+}
+
+func TestStreamDialer_SharedSession(t *testing.T) {
+	config := &Config{SmuxVersion: 2}
+	listener, err := NewListener(newUDPPacketConn(t), config)
+	require.NoError(t, err)
+	defer listener.Close()
+	dialer, err := NewStreamDialer(&transport.UDPDialer{}, config)
+	require.NoError(t, err)
+
+	var addrs []string
+	for i := 0; i < 3; i++ {
+		conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
+		accepted, err := listener.Accept()
+		require.NoError(t, err)
+		defer accepted.Close()
+		addrs = append(addrs, accepted.RemoteAddr().String())
+	}
+	require.Equal(t, addrs[0], addrs[1])
+	require.Equal(t, addrs[0], addrs[2])
+}
+
+func TestConfig_Invalid(t *testing.T) {
+	for _, config := range []*Config{
+		{Mode: "turbo"},
+		{Crypt: "xor"},
+		{MTU: 30},
+		{Mode: "manual", Resend: -1},
+		{SendWindow: 1 << 16},
+		{DataShards: 200, ParityShards: 100},
+		{SmuxVersion: 3},
+	} {
+		_, err := NewStreamDialer(&transport.UDPDialer{}, config)
+		require.Error(t, err, "config %+v", config)
+	}
+	_, err := NewStreamDialer(nil, nil)
+	require.Error(t, err)
+}
+
+func TestConfig_Modes(t *testing.T) {
+	params, err := (*Config)(nil).params()
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Millisecond, params.interval)
+	require.False(t, params.nodelay)
+	require.Equal(t, DefaultMTU, params.mtu)
+	require.NotNil(t, params.crypt)
+	require.Equal(t, DefaultDataShards, params.fec.dataShards)
+	require.Equal(t, DefaultParityShards, params.fec.parityShards)
+	require.Equal(t, byte(1), params.smuxVersion)
+
+	params, err = (&Config{DataShards: -1}).params()
+	require.NoError(t, err)
+	require.Nil(t, params.fec)
+
+	params, err = (&Config{Mode: "fast3"}).params()
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Millisecond, params.interval)
+	require.True(t, params.nodelay)
+
+	params, err = (&Config{Mode: "manual", Interval: time.Millisecond, Resend: 3}).params()
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Millisecond, params.interval)
+	require.Equal(t, 3, params.resend)
+	require.False(t, params.nocwnd)
+}
+
+func appendSegment(b []byte, conv uint32, cmd byte, ts, sn, una uint32, data []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, conv)
+	b = append(b, cmd, 0)
+	b = binary.LittleEndian.AppendUint16(b, 128)
+	b = binary.LittleEndian.AppendUint32(b, ts)
+	b = binary.LittleEndian.AppendUint32(b, sn)
+	b = binary.LittleEndian.AppendUint32(b, una)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// maskedCRC32C is the checksum of the snappy framing format.
+func maskedCRC32C(b []byte) uint32 {
+	c := crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli))
+	return (c>>15 | c<<17) + 0xa282ead8
+}
@@ -0,0 +1,221 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import "errors"
+
+// The Galois field GF(2^8) of the Reed-Solomon codes of kcp-go, with the reducing polynomial x^8+x^4+x^3+x^2+1
+// and generator 2.
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfExp[i+255] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfPow returns a to the power of n, with 0^0 = 1.
+func gfPow(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])*n%255]
+}
+
+// gfMulAdd adds c times in to out.
+func gfMulAdd(c byte, in, out []byte) {
+	if c == 0 {
+		return
+	}
+	logC := int(gfLog[c])
+	for i, v := range in {
+		if v != 0 {
+			out[i] ^= gfExp[logC+int(gfLog[v])]
+		}
+	}
+}
+
+type gfMatrix [][]byte
+
+func newGFMatrix(rows, cols int) gfMatrix {
+	m := make(gfMatrix, rows)
+	for r := range m {
+		m[r] = make([]byte, cols)
+	}
+	return m
+}
+
+func (m gfMatrix) multiply(other gfMatrix) gfMatrix {
+	result := newGFMatrix(len(m), len(other[0]))
+	for r, row := range m {
+		for c := range result[r] {
+			var v byte
+			for i, a := range row {
+				v ^= gfMul(a, other[i][c])
+			}
+			result[r][c] = v
+		}
+	}
+	return result
+}
+
+var errSingularMatrix = errors.New("matrix is singular")
+
+// invert returns the inverse of the square matrix with Gauss-Jordan elimination.
+func (m gfMatrix) invert() (gfMatrix, error) {
+	n := len(m)
+	work := newGFMatrix(n, 2*n)
+	for r := range m {
+		copy(work[r], m[r])
+		work[r][n+r] = 1
+	}
+	for c := 0; c < n; c++ {
+		pivot := c
+		for pivot < n && work[pivot][c] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errSingularMatrix
+		}
+		work[c], work[pivot] = work[pivot], work[c]
+		if v := work[c][c]; v != 1 {
+			scale := gfInv(v)
+			for i := range work[c] {
+				work[c][i] = gfMul(work[c][i], scale)
+			}
+		}
+		for r := 0; r < n; r++ {
+			if r != c && work[r][c] != 0 {
+				gfMulAdd(work[r][c], work[c], work[r])
+			}
+		}
+	}
+	inverse := newGFMatrix(n, n)
+	for r := range inverse {
+		copy(inverse[r], work[r][n:])
+	}
+	return inverse, nil
+}
+
+// reedSolomon is the systematic Reed-Solomon erasure code of kcp-go, which uses the default encoding matrix of
+// github.com/klauspost/reedsolomon: a Vandermonde matrix multiplied by the inverse of its top square, so that
+// the data shards are unchanged and any dataShards of the shards recover the others.
+type reedSolomon struct {
+	dataShards   int
+	parityShards int
+	// matrix has a row per shard, and a column per data shard.
+	matrix gfMatrix
+}
+
+func newReedSolomon(dataShards, parityShards int) (*reedSolomon, error) {
+	if dataShards <= 0 || parityShards <= 0 || dataShards+parityShards > 256 {
+		return nil, errors.New("invalid number of shards")
+	}
+	total := dataShards + parityShards
+	vandermonde := newGFMatrix(total, dataShards)
+	for r := range vandermonde {
+		for c := range vandermonde[r] {
+			vandermonde[r][c] = gfPow(byte(r), c)
+		}
+	}
+	topInverse, err := vandermonde[:dataShards].invert()
+	if err != nil {
+		return nil, err
+	}
+	return &reedSolomon{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		matrix:       vandermonde.multiply(topInverse),
+	}, nil
+}
+
+// encode computes the parity shards from the data shards. All the shards must have the same size.
+func (rs *reedSolomon) encode(shards [][]byte) {
+	for p := 0; p < rs.parityShards; p++ {
+		parity := shards[rs.dataShards+p]
+		for i := range parity {
+			parity[i] = 0
+		}
+		for d, coefficient := range rs.matrix[rs.dataShards+p] {
+			gfMulAdd(coefficient, shards[d], parity)
+		}
+	}
+}
+
+// reconstructData fills in the missing data shards, which are nil, from at least dataShards present shards
+// of the same size. The parity shards are not reconstructed.
+func (rs *reedSolomon) reconstructData(shards [][]byte) error {
+	size := -1
+	rows := make([]int, 0, rs.dataShards)
+	for i, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		if size == -1 {
+			size = len(shard)
+		} else if len(shard) != size {
+			return errors.New("shards have different sizes")
+		}
+		if len(rows) < rs.dataShards {
+			rows = append(rows, i)
+		}
+	}
+	if len(rows) < rs.dataShards {
+		return errors.New("too few shards")
+	}
+	decode := newGFMatrix(rs.dataShards, rs.dataShards)
+	for i, row := range rows {
+		copy(decode[i], rs.matrix[row])
+	}
+	decodeInverse, err := decode.invert()
+	if err != nil {
+		return err
+	}
+	for d := 0; d < rs.dataShards; d++ {
+		if shards[d] != nil {
+			continue
+		}
+		shard := make([]byte, size)
+		for i, row := range rows {
+			gfMulAdd(decodeInverse[d][i], shards[row], shard)
+		}
+		shards[d] = shard
+	}
+	return nil
+}
@@ -0,0 +1,650 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// KCP commands.
+const (
+	cmdPush = 81 // Data.
+	cmdAck  = 82 // Acknowledgment.
+	cmdWask = 83 // Window probe request.
+	cmdWins = 84 // Window size announcement.
+)
+
+// Probe flags.
+const (
+	askSend = 1 // Ask the peer for its window size.
+	askTell = 2 // Tell the peer our window size.
+)
+
+const (
+	// overhead is the size of the segment header.
+	overhead = 24
+
+	rtoNoDelay = 30
+	rtoMin     = 100
+	rtoDefault = 200
+	rtoMax     = 60000
+
+	threshInit = 2
+	threshMin  = 2
+
+	probeInit  = 7000
+	probeLimit = 120000
+
+	// deadLink is the number of transmissions of a segment after which the peer is considered gone.
+	deadLink = 20
+	// maxFragments is the maximum number of fragments of a message, since the fragment index is a single byte.
+	maxFragments = 255
+)
+
+var (
+	errEmptyMessage   = errors.New("empty message")
+	errMessageTooLong = errors.New("message too long")
+)
+
+// segment is a KCP segment. The wire format is little-endian:
+//
+//	+------+-----+-----+-----+----+----+-----+-----+------+
+//	| conv | cmd | frg | wnd | ts | sn | una | len | data |
+//	+------+-----+-----+-----+----+----+-----+-----+------+
+//	|  4   |  1  |  1  |  2  | 4  | 4  |  4  |  4  | len  |
+//	+------+-----+-----+-----+----+----+-----+-----+------+
+type segment struct {
+	conv uint32
+	cmd  uint8
+	frg  uint8
+	wnd  uint16
+	ts   uint32
+	sn   uint32
+	una  uint32
+	data []byte
+
+	// Sender state.
+	resendts uint32
+	rto      uint32
+	fastack  uint32
+	xmit     uint32
+}
+
+func (seg *segment) appendHeader(b []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, seg.conv)
+	b = append(b, seg.cmd, seg.frg)
+	b = binary.LittleEndian.AppendUint16(b, seg.wnd)
+	b = binary.LittleEndian.AppendUint32(b, seg.ts)
+	b = binary.LittleEndian.AppendUint32(b, seg.sn)
+	b = binary.LittleEndian.AppendUint32(b, seg.una)
+	return binary.LittleEndian.AppendUint32(b, uint32(len(seg.data)))
+}
+
+type ackItem struct {
+	sn uint32
+	ts uint32
+}
+
+// timeDiff returns the signed difference of two timestamps that may wrap around.
+func timeDiff(later, earlier uint32) int32 {
+	return int32(later - earlier)
+}
+
+// session is the KCP protocol state machine, ported from the reference implementation at
+// https://github.com/skywind3000/kcp. It doesn't do I/O or keep time: packets come in with input, go out through
+// output, and flush must be called periodically with the current time in milliseconds.
+// It's not safe for concurrent use.
+type session struct {
+	conv   uint32
+	mtu    uint32
+	mss    uint32
+	stream bool
+	output func(packet []byte)
+
+	sndUna   uint32
+	sndNxt   uint32
+	rcvNxt   uint32
+	ssthresh uint32
+	rxRttval int32
+	rxSrtt   int32
+	rxRto    uint32
+	rxMinrto uint32
+	sndWnd   uint32
+	rcvWnd   uint32
+	rmtWnd   uint32
+	cwnd     uint32
+	incr     uint32
+	probe    uint32
+
+	current   uint32
+	interval  uint32
+	tsProbe   uint32
+	probeWait uint32
+
+	nodelay    bool
+	fastresend uint32
+	nocwnd     bool
+	dead       bool
+
+	sndQueue []*segment
+	sndBuf   []*segment
+	rcvQueue []*segment
+	rcvBuf   []*segment
+	acklist  []ackItem
+
+	buf []byte
+}
+
+func newSession(conv uint32, output func([]byte)) *session {
+	s := &session{
+		conv:     conv,
+		output:   output,
+		sndWnd:   32,
+		rcvWnd:   128,
+		rmtWnd:   128,
+		rxRto:    rtoDefault,
+		rxMinrto: rtoMin,
+		interval: 100,
+		ssthresh: threshInit,
+		cwnd:     1,
+	}
+	s.setMTU(1400)
+	return s
+}
+
+func (s *session) setMTU(mtu int) {
+	s.mtu = uint32(mtu)
+	s.mss = s.mtu - overhead
+	s.incr = s.mss
+	s.buf = make([]byte, 0, mtu)
+}
+
+func (s *session) setWindows(sndWnd, rcvWnd int) {
+	if sndWnd > 0 {
+		s.sndWnd = uint32(sndWnd)
+	}
+	if rcvWnd > 0 {
+		s.rcvWnd = uint32(rcvWnd)
+	}
+}
+
+func (s *session) setNoDelay(nodelay bool, interval uint32, resend int, nocwnd bool) {
+	s.nodelay = nodelay
+	if nodelay {
+		s.rxMinrto = rtoNoDelay
+	} else {
+		s.rxMinrto = rtoMin
+	}
+	if interval < 10 {
+		interval = 10
+	} else if interval > 5000 {
+		interval = 5000
+	}
+	s.interval = interval
+	if resend >= 0 {
+		s.fastresend = uint32(resend)
+	}
+	s.nocwnd = nocwnd
+}
+
+// peekSize returns the size of the next message, or -1 if none is complete.
+func (s *session) peekSize() int {
+	if len(s.rcvQueue) == 0 {
+		return -1
+	}
+	seg := s.rcvQueue[0]
+	if seg.frg == 0 {
+		return len(seg.data)
+	}
+	if len(s.rcvQueue) < int(seg.frg)+1 {
+		return -1
+	}
+	length := 0
+	for _, seg := range s.rcvQueue {
+		length += len(seg.data)
+		if seg.frg == 0 {
+			break
+		}
+	}
+	return length
+}
+
+// recv returns the next message, or nil if none is complete. In stream mode, the messages are the data
+// of each segment.
+func (s *session) recv() []byte {
+	size := s.peekSize()
+	if size < 0 {
+		return nil
+	}
+	wasFull := len(s.rcvQueue) >= int(s.rcvWnd)
+	msg := make([]byte, 0, size)
+	n := 0
+	for _, seg := range s.rcvQueue {
+		msg = append(msg, seg.data...)
+		n++
+		if seg.frg == 0 {
+			break
+		}
+	}
+	s.rcvQueue = s.rcvQueue[n:]
+	s.moveReceived()
+	if len(s.rcvQueue) < int(s.rcvWnd) && wasFull {
+		// Tell the peer the window is open again, so it doesn't wait for its probe.
+		s.probe |= askTell
+	}
+	return msg
+}
+
+// moveReceived moves the in-order segments from the receive buffer to the receive queue.
+func (s *session) moveReceived() {
+	n := 0
+	for _, seg := range s.rcvBuf {
+		if seg.sn != s.rcvNxt || len(s.rcvQueue) >= int(s.rcvWnd) {
+			break
+		}
+		s.rcvQueue = append(s.rcvQueue, seg)
+		s.rcvNxt++
+		n++
+	}
+	s.rcvBuf = s.rcvBuf[n:]
+}
+
+// send queues the data. In message mode, the data is delivered as a single message.
+func (s *session) send(data []byte) error {
+	if len(data) == 0 {
+		return errEmptyMessage
+	}
+	if s.stream && len(s.sndQueue) > 0 {
+		// Fill up the last segment.
+		last := s.sndQueue[len(s.sndQueue)-1]
+		if room := int(s.mss) - len(last.data); room > 0 {
+			if room > len(data) {
+				room = len(data)
+			}
+			last.data = append(last.data, data[:room]...)
+			data = data[room:]
+		}
+		if len(data) == 0 {
+			return nil
+		}
+	}
+	count := (len(data) + int(s.mss) - 1) / int(s.mss)
+	if !s.stream && (count > maxFragments || count >= int(s.rcvWnd)) {
+		return errMessageTooLong
+	}
+	for i := 0; i < count; i++ {
+		size := len(data)
+		if size > int(s.mss) {
+			size = int(s.mss)
+		}
+		seg := &segment{data: make([]byte, size, s.mss)}
+		copy(seg.data, data)
+		if !s.stream {
+			seg.frg = uint8(count - i - 1)
+		}
+		s.sndQueue = append(s.sndQueue, seg)
+		data = data[size:]
+	}
+	return nil
+}
+
+// waitSend returns the number of segments waiting to be sent or acknowledged.
+func (s *session) waitSend() int {
+	return len(s.sndBuf) + len(s.sndQueue)
+}
+
+func (s *session) updateAck(rtt int32) {
+	if s.rxSrtt == 0 {
+		s.rxSrtt = rtt
+		s.rxRttval = rtt / 2
+	} else {
+		delta := rtt - s.rxSrtt
+		if delta < 0 {
+			delta = -delta
+		}
+		s.rxRttval = (3*s.rxRttval + delta) / 4
+		s.rxSrtt = (7*s.rxSrtt + rtt) / 8
+		if s.rxSrtt < 1 {
+			s.rxSrtt = 1
+		}
+	}
+	variance := uint32(4 * s.rxRttval)
+	if variance < s.interval {
+		variance = s.interval
+	}
+	rto := uint32(s.rxSrtt) + variance
+	if rto < s.rxMinrto {
+		rto = s.rxMinrto
+	} else if rto > rtoMax {
+		rto = rtoMax
+	}
+	s.rxRto = rto
+}
+
+func (s *session) shrinkBuf() {
+	if len(s.sndBuf) > 0 {
+		s.sndUna = s.sndBuf[0].sn
+	} else {
+		s.sndUna = s.sndNxt
+	}
+}
+
+func (s *session) parseAck(sn uint32) {
+	if timeDiff(sn, s.sndUna) < 0 || timeDiff(sn, s.sndNxt) >= 0 {
+		return
+	}
+	for i, seg := range s.sndBuf {
+		if sn == seg.sn {
+			s.sndBuf = append(s.sndBuf[:i], s.sndBuf[i+1:]...)
+			break
+		}
+		if timeDiff(sn, seg.sn) < 0 {
+			break
+		}
+	}
+}
+
+func (s *session) parseUna(una uint32) {
+	n := 0
+	for _, seg := range s.sndBuf {
+		if timeDiff(una, seg.sn) <= 0 {
+			break
+		}
+		n++
+	}
+	s.sndBuf = s.sndBuf[n:]
+}
+
+func (s *session) parseFastack(sn uint32) {
+	if timeDiff(sn, s.sndUna) < 0 || timeDiff(sn, s.sndNxt) >= 0 {
+		return
+	}
+	for _, seg := range s.sndBuf {
+		if timeDiff(sn, seg.sn) < 0 {
+			break
+		}
+		if sn != seg.sn {
+			seg.fastack++
+		}
+	}
+}
+
+func (s *session) parseData(newseg *segment) {
+	sn := newseg.sn
+	if timeDiff(sn, s.rcvNxt+s.rcvWnd) >= 0 || timeDiff(sn, s.rcvNxt) < 0 {
+		return
+	}
+	// Find the insertion point from the end, since segments usually arrive in order.
+	i := len(s.rcvBuf)
+	for ; i > 0; i-- {
+		seg := s.rcvBuf[i-1]
+		if seg.sn == sn {
+			// Duplicate.
+			return
+		}
+		if timeDiff(sn, seg.sn) > 0 {
+			break
+		}
+	}
+	s.rcvBuf = append(s.rcvBuf, nil)
+	copy(s.rcvBuf[i+1:], s.rcvBuf[i:])
+	s.rcvBuf[i] = newseg
+	s.moveReceived()
+}
+
+// input processes a packet from the peer. It returns false if the packet is malformed or belongs to another
+// conversation.
+func (s *session) input(data []byte) bool {
+	if len(data) < overhead {
+		return false
+	}
+	prevUna := s.sndUna
+	var maxack uint32
+	hasAck := false
+	for len(data) >= overhead {
+		conv := binary.LittleEndian.Uint32(data)
+		if conv != s.conv {
+			return false
+		}
+		cmd := data[4]
+		frg := data[5]
+		wnd := binary.LittleEndian.Uint16(data[6:])
+		ts := binary.LittleEndian.Uint32(data[8:])
+		sn := binary.LittleEndian.Uint32(data[12:])
+		una := binary.LittleEndian.Uint32(data[16:])
+		length := binary.LittleEndian.Uint32(data[20:])
+		data = data[overhead:]
+		if uint32(len(data)) < length {
+			return false
+		}
+		if cmd < cmdPush || cmd > cmdWins {
+			return false
+		}
+		s.rmtWnd = uint32(wnd)
+		s.parseUna(una)
+		s.shrinkBuf()
+		switch cmd {
+		case cmdAck:
+			if rtt := timeDiff(s.current, ts); rtt >= 0 {
+				s.updateAck(rtt)
+			}
+			s.parseAck(sn)
+			s.shrinkBuf()
+			if !hasAck || timeDiff(sn, maxack) > 0 {
+				hasAck = true
+				maxack = sn
+			}
+		case cmdPush:
+			if timeDiff(sn, s.rcvNxt+s.rcvWnd) < 0 {
+				s.acklist = append(s.acklist, ackItem{sn, ts})
+				if timeDiff(sn, s.rcvNxt) >= 0 {
+					seg := &segment{conv: conv, cmd: cmd, frg: frg, wnd: wnd, ts: ts, sn: sn, una: una}
+					seg.data = append([]byte(nil), data[:length]...)
+					s.parseData(seg)
+				}
+			}
+		case cmdWask:
+			s.probe |= askTell
+		case cmdWins:
+			// The window was already updated.
+		}
+		data = data[length:]
+	}
+	if hasAck {
+		s.parseFastack(maxack)
+	}
+
+	if timeDiff(s.sndUna, prevUna) > 0 && s.cwnd < s.rmtWnd {
+		// Grow the congestion window.
+		mss := s.mss
+		if s.cwnd < s.ssthresh {
+			s.cwnd++
+			s.incr += mss
+		} else {
+			if s.incr < mss {
+				s.incr = mss
+			}
+			s.incr += (mss*mss)/s.incr + (mss / 16)
+			if (s.cwnd+1)*mss <= s.incr {
+				s.cwnd = (s.incr + mss - 1) / mss
+			}
+		}
+		if s.cwnd > s.rmtWnd {
+			s.cwnd = s.rmtWnd
+			s.incr = s.rmtWnd * mss
+		}
+	}
+	return true
+}
+
+func (s *session) wndUnused() uint16 {
+	if len(s.rcvQueue) < int(s.rcvWnd) {
+		return uint16(s.rcvWnd - uint32(len(s.rcvQueue)))
+	}
+	return 0
+}
+
+// appendSegment appends the segment to the output buffer, flushing the buffer first if it would exceed the MTU.
+func (s *session) appendSegment(seg *segment) {
+	if len(s.buf)+overhead+len(seg.data) > int(s.mtu) {
+		s.flushBuffer()
+	}
+	s.buf = seg.appendHeader(s.buf)
+	s.buf = append(s.buf, seg.data...)
+}
+
+func (s *session) flushBuffer() {
+	if len(s.buf) > 0 {
+		s.output(s.buf)
+		s.buf = s.buf[:0]
+	}
+}
+
+// flush sends the pending acknowledgments, probes and segments, and retransmits the segments that timed out or
+// were skipped by the peer. The current time is in milliseconds.
+func (s *session) flush(current uint32) {
+	s.current = current
+	seg := segment{conv: s.conv, cmd: cmdAck, wnd: s.wndUnused(), una: s.rcvNxt}
+
+	for _, ack := range s.acklist {
+		seg.sn, seg.ts = ack.sn, ack.ts
+		s.appendSegment(&seg)
+	}
+	s.acklist = s.acklist[:0]
+
+	if s.rmtWnd == 0 {
+		// Probe the peer window until it opens.
+		if s.probeWait == 0 {
+			s.probeWait = probeInit
+			s.tsProbe = current + s.probeWait
+		} else if timeDiff(current, s.tsProbe) >= 0 {
+			if s.probeWait < probeInit {
+				s.probeWait = probeInit
+			}
+			s.probeWait += s.probeWait / 2
+			if s.probeWait > probeLimit {
+				s.probeWait = probeLimit
+			}
+			s.tsProbe = current + s.probeWait
+			s.probe |= askSend
+		}
+	} else {
+		s.tsProbe = 0
+		s.probeWait = 0
+	}
+	seg.sn, seg.ts = 0, 0
+	if s.probe&askSend != 0 {
+		seg.cmd = cmdWask
+		s.appendSegment(&seg)
+	}
+	if s.probe&askTell != 0 {
+		seg.cmd = cmdWins
+		s.appendSegment(&seg)
+	}
+	s.probe = 0
+
+	cwnd := s.sndWnd
+	if s.rmtWnd < cwnd {
+		cwnd = s.rmtWnd
+	}
+	if !s.nocwnd && s.cwnd < cwnd {
+		cwnd = s.cwnd
+	}
+	n := 0
+	for _, newseg := range s.sndQueue {
+		if timeDiff(s.sndNxt, s.sndUna+cwnd) >= 0 {
+			break
+		}
+		newseg.conv = s.conv
+		newseg.cmd = cmdPush
+		newseg.sn = s.sndNxt
+		s.sndNxt++
+		s.sndBuf = append(s.sndBuf, newseg)
+		n++
+	}
+	s.sndQueue = s.sndQueue[n:]
+
+	resent := uint32(0xffffffff)
+	if s.fastresend > 0 {
+		resent = s.fastresend
+	}
+	var rtomin uint32
+	if !s.nodelay {
+		rtomin = s.rxRto >> 3
+	}
+	change, lost := false, false
+	for _, seg := range s.sndBuf {
+		needsend := false
+		if seg.xmit == 0 {
+			needsend = true
+			seg.xmit++
+			seg.rto = s.rxRto
+			seg.resendts = current + seg.rto + rtomin
+		} else if timeDiff(current, seg.resendts) >= 0 {
+			needsend = true
+			seg.xmit++
+			if !s.nodelay {
+				if seg.rto > s.rxRto {
+					seg.rto += seg.rto
+				} else {
+					seg.rto += s.rxRto
+				}
+			} else {
+				seg.rto += seg.rto / 2
+			}
+			seg.resendts = current + seg.rto
+			lost = true
+		} else if seg.fastack >= resent {
+			needsend = true
+			seg.xmit++
+			seg.fastack = 0
+			seg.resendts = current + seg.rto
+			change = true
+		}
+		if needsend {
+			seg.ts = current
+			seg.wnd = s.wndUnused()
+			seg.una = s.rcvNxt
+			s.appendSegment(seg)
+			if seg.xmit >= deadLink {
+				s.dead = true
+			}
+		}
+	}
+	s.flushBuffer()
+
+	if change {
+		inflight := s.sndNxt - s.sndUna
+		s.ssthresh = inflight / 2
+		if s.ssthresh < threshMin {
+			s.ssthresh = threshMin
+		}
+		s.cwnd = s.ssthresh + resent
+		s.incr = s.cwnd * s.mss
+	}
+	if lost {
+		s.ssthresh = cwnd / 2
+		if s.ssthresh < threshMin {
+			s.ssthresh = threshMin
+		}
+		s.cwnd = 1
+		s.incr = s.mss
+	}
+	if s.cwnd < 1 {
+		s.cwnd = 1
+		s.incr = s.mss
+	}
+}
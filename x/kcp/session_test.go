@@ -0,0 +1,196 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"bytes"
+	mrand "math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sessionPair connects two sessions in memory. Packets are delivered on deliver, so tests can drop or reorder them.
+type sessionPair struct {
+	a, b       *session
+	toA, toB   [][]byte
+	clock      uint32
+	dropFilter func(packet []byte) bool
+}
+
+func newSessionPair(stream bool) *sessionPair {
+	p := &sessionPair{}
+	p.a = newSession(1, func(packet []byte) { p.toB = append(p.toB, append([]byte(nil), packet...)) })
+	p.b = newSession(1, func(packet []byte) { p.toA = append(p.toA, append([]byte(nil), packet...)) })
+	for _, s := range []*session{p.a, p.b} {
+		s.stream = stream
+		s.setNoDelay(true, 10, 2, true)
+	}
+	return p
+}
+
+// step advances the clock, flushes both sessions and delivers the packets.
+func (p *sessionPair) step() {
+	p.clock += 10
+	p.a.flush(p.clock)
+	p.b.flush(p.clock)
+	toA, toB := p.toA, p.toB
+	p.toA, p.toB = nil, nil
+	for _, packet := range toB {
+		if p.dropFilter == nil || !p.dropFilter(packet) {
+			p.b.current = p.clock
+			p.b.input(packet)
+		}
+	}
+	for _, packet := range toA {
+		if p.dropFilter == nil || !p.dropFilter(packet) {
+			p.a.current = p.clock
+			p.a.input(packet)
+		}
+	}
+}
+
+func TestSegment_WireFormat(t *testing.T) {
+	seg := &segment{conv: 0x01020304, cmd: cmdPush, frg: 2, wnd: 0x0506, ts: 0x0708090a, sn: 0x0b0c0d0e, una: 0x0f101112, data: []byte("hi")}
+	encoded := append(seg.appendHeader(nil), seg.data...)
+	require.Equal(t, []byte{
+		0x04, 0x03, 0x02, 0x01, // conv
+		81, 2, // cmd, frg
+		0x06, 0x05, // wnd
+		0x0a, 0x09, 0x08, 0x07, // ts
+		0x0e, 0x0d, 0x0c, 0x0b, // sn
+		0x12, 0x11, 0x10, 0x0f, // una
+		2, 0, 0, 0, // len
+		'h', 'i',
+	}, encoded)
+
+	s := newSession(0x01020304, func([]byte) {})
+	seg.sn = 0
+	require.True(t, s.input(append(seg.appendHeader(nil), seg.data...)))
+	require.Equal(t, []ackItem{{sn: 0, ts: 0x0708090a}}, s.acklist)
+	require.Equal(t, uint32(0x0506), s.rmtWnd)
+
+	// Another conversation.
+	require.False(t, newSession(7, func([]byte) {}).input(encoded))
+	// Truncated data.
+	require.False(t, s.input(encoded[:len(encoded)-1]))
+}
+
+func TestSession_Messages(t *testing.T) {
+	p := newSessionPair(false)
+	small := []byte("small")
+	large := bytes.Repeat([]byte("0123456789"), 1000)
+	require.NoError(t, p.a.send(small))
+	require.NoError(t, p.a.send(large))
+	require.ErrorIs(t, p.a.send(nil), errEmptyMessage)
+	require.ErrorIs(t, p.a.send(make([]byte, int(p.a.mss)*int(p.a.rcvWnd))), errMessageTooLong)
+	for i := 0; i < 20 && p.a.waitSend() > 0; i++ {
+		p.step()
+	}
+	require.Equal(t, 0, p.a.waitSend())
+	require.Equal(t, small, p.b.recv())
+	require.Equal(t, large, p.b.recv())
+	require.Nil(t, p.b.recv())
+}
+
+func TestSession_StreamCoalesces(t *testing.T) {
+	p := newSessionPair(true)
+	require.NoError(t, p.a.send([]byte("hello, ")))
+	require.NoError(t, p.a.send([]byte("world")))
+	require.Len(t, p.a.sndQueue, 1)
+	p.step()
+	require.Equal(t, []byte("hello, world"), p.b.recv())
+}
+
+func TestSession_LossAndReordering(t *testing.T) {
+	p := newSessionPair(true)
+	rng := mrand.New(mrand.NewSource(1))
+	p.dropFilter = func([]byte) bool {
+		return rng.Float64() < 0.3
+	}
+	data := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz"), 5000)
+	require.NoError(t, p.a.send(data))
+	var received []byte
+	for i := 0; i < 2000 && len(received) < len(data); i++ {
+		p.step()
+		for msg := p.b.recv(); msg != nil; msg = p.b.recv() {
+			received = append(received, msg...)
+		}
+	}
+	require.Equal(t, data, received)
+	require.False(t, p.a.dead)
+}
+
+func TestSession_FastResend(t *testing.T) {
+	p := newSessionPair(true)
+	// Two skipping acknowledgments trigger the fast resend.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.a.send(bytes.Repeat([]byte{byte(i)}, int(p.a.mss))))
+		p.a.flush(p.clock)
+		if i > 0 {
+			// Drop the first segment only.
+			for _, packet := range p.toB {
+				p.b.input(packet)
+			}
+		}
+		p.toB = nil
+		p.b.flush(p.clock)
+		for _, packet := range p.toA {
+			p.a.input(packet)
+		}
+		p.toA = nil
+	}
+	// The acknowledgments of the later segments skip the first, which is resent before its timeout.
+	require.GreaterOrEqual(t, p.a.sndBuf[0].fastack, p.a.fastresend)
+	p.a.flush(p.clock)
+	require.Equal(t, uint32(2), p.a.sndBuf[0].xmit)
+	require.Len(t, p.toB, 1)
+	p.b.input(p.toB[0])
+	require.Len(t, p.b.rcvQueue, 3)
+}
+
+func TestSession_DeadLink(t *testing.T) {
+	p := newSessionPair(true)
+	p.dropFilter = func([]byte) bool { return true }
+	require.NoError(t, p.a.send([]byte("lost")))
+	for i := 0; i < 100000 && !p.a.dead; i++ {
+		p.step()
+	}
+	require.True(t, p.a.dead)
+}
+
+func TestSession_WindowProbe(t *testing.T) {
+	p := newSessionPair(true)
+	p.b.rcvWnd = 4
+	// Fill the receiver window without reading.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, p.a.send(bytes.Repeat([]byte{byte(i)}, int(p.a.mss))))
+	}
+	for i := 0; i < 10; i++ {
+		p.step()
+	}
+	require.Equal(t, uint32(0), p.a.rmtWnd)
+	require.Len(t, p.b.rcvQueue, 4)
+	// Reading announces the open window, so the sender resumes without waiting for its probe.
+	received := 0
+	for i := 0; i < 100 && received < 10; i++ {
+		for msg := p.b.recv(); msg != nil; msg = p.b.recv() {
+			received++
+		}
+		p.step()
+	}
+	require.Equal(t, 10, received)
+	require.Equal(t, 0, p.a.waitSend())
+}
@@ -0,0 +1,593 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// The frame commands of smux, which kcptun uses to multiplex streams on a KCP session.
+// See https://github.com/xtaci/smux.
+const (
+	muxCmdSYN byte = iota // opens a stream
+	muxCmdFIN             // ends the writes of a stream
+	muxCmdPSH             // carries data
+	muxCmdNOP             // keeps the session alive
+	muxCmdUPD             // updates the window of a stream, in version 2
+)
+
+const (
+	// muxHeaderSize is the size of the frame header: version, command, payload length and stream ID, in little-endian.
+	muxHeaderSize = 8
+	// muxMaxFrameSize is the maximum payload of the data frames.
+	muxMaxFrameSize = 32768
+	// muxKeepAliveInterval and muxKeepAliveTimeout follow the keepalive option of kcptun and the smux default.
+	muxKeepAliveInterval = 10 * time.Second
+	muxKeepAliveTimeout  = 30 * time.Second
+	// muxMaxReceiveBuffer is how much data the session buffers for its streams before it stops reading, as the smuxbuf
+	// option of kcptun.
+	muxMaxReceiveBuffer = 4 << 20
+	// muxMaxStreamBuffer is the window of each stream in version 2, as the streambuf option of kcptun.
+	muxMaxStreamBuffer = 2 << 20
+	// muxInitialPeerWindow is the window of a stream until the peer announces it, in version 2.
+	muxInitialPeerWindow = 262144
+	// muxAcceptBacklog is the number of streams that can wait to be accepted before the session stops reading.
+	muxAcceptBacklog = 1024
+	// muxIdleTimeout is how long a client session without streams is kept for new streams.
+	muxIdleTimeout = time.Minute
+)
+
+var (
+	errMuxInvalidProtocol = errors.New("invalid smux frame")
+	errMuxTimeout         = errors.New("smux session timed out")
+	errMuxGoAway          = errors.New("smux stream IDs exhausted")
+)
+
+// muxSession multiplexes streams on a connection with smux. It's safe for concurrent use.
+type muxSession struct {
+	conn       io.ReadWriteCloser
+	version    byte
+	client     bool
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	acceptCh   chan *muxStream
+	done       chan struct{}
+	received   atomic.Bool
+
+	// wmu serializes the frames.
+	wmu sync.Mutex
+
+	mu sync.Mutex
+	// bufferFreed is signaled when the streams consume buffered data.
+	bufferFreed *sync.Cond
+	streams     map[uint32]*muxStream
+	nextID      uint32
+	buffered    int
+	idleSince   time.Time
+	err         error
+}
+
+// newMuxSession starts a session on conn. Only server sessions accept the streams the peer opens.
+func newMuxSession(conn io.ReadWriteCloser, version byte, client bool, localAddr, remoteAddr net.Addr) *muxSession {
+	s := &muxSession{
+		conn:       conn,
+		version:    version,
+		client:     client,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		done:       make(chan struct{}),
+		streams:    make(map[uint32]*muxStream),
+		idleSince:  time.Now(),
+	}
+	s.bufferFreed = sync.NewCond(&s.mu)
+	if client {
+		// Clients use odd stream IDs, starting at 3 as in smux.
+		s.nextID = 1
+	} else {
+		s.acceptCh = make(chan *muxStream, muxAcceptBacklog)
+	}
+	go s.recvLoop()
+	go s.keepAliveLoop()
+	return s
+}
+
+// openStream opens a new stream to the peer.
+func (s *muxSession) openStream() (*muxStream, error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	s.nextID += 2
+	if s.nextID < 2 {
+		s.mu.Unlock()
+		s.fail(errMuxGoAway)
+		return nil, errMuxGoAway
+	}
+	stream := newMuxStream(s, s.nextID)
+	s.streams[stream.id] = stream
+	s.mu.Unlock()
+	if err := s.writeFrame(muxCmdSYN, stream.id, nil); err != nil {
+		s.removeStream(stream.id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// accept waits for a stream opened by the peer.
+func (s *muxSession) accept() (*muxStream, error) {
+	select {
+	case stream := <-s.acceptCh:
+		return stream, nil
+	case <-s.done:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return nil, s.err
+	}
+}
+
+func (s *muxSession) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *muxSession) writeFrame(cmd byte, id uint32, payload []byte) error {
+	frame := make([]byte, muxHeaderSize+len(payload))
+	frame[0] = s.version
+	frame[1] = cmd
+	binary.LittleEndian.PutUint16(frame[2:], uint16(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:], id)
+	copy(frame[muxHeaderSize:], payload)
+	s.wmu.Lock()
+	_, err := s.conn.Write(frame)
+	s.wmu.Unlock()
+	if err != nil {
+		s.fail(err)
+	}
+	return err
+}
+
+func (s *muxSession) writeUpdate(id uint32, consumed, window uint32) error {
+	var payload [8]byte
+	binary.LittleEndian.PutUint32(payload[:], consumed)
+	binary.LittleEndian.PutUint32(payload[4:], window)
+	return s.writeFrame(muxCmdUPD, id, payload[:])
+}
+
+func (s *muxSession) stream(id uint32) *muxStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+func (s *muxSession) removeStream(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+	if len(s.streams) == 0 {
+		s.idleSince = time.Now()
+	}
+}
+
+// releaseBuffer returns the space of data consumed by a stream to the session.
+func (s *muxSession) releaseBuffer(n int) {
+	if n == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffered -= n
+	s.bufferFreed.Broadcast()
+}
+
+func (s *muxSession) recvLoop() {
+	var header [muxHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(s.conn, header[:]); err != nil {
+			s.fail(err)
+			return
+		}
+		if header[0] != s.version {
+			s.fail(errMuxInvalidProtocol)
+			return
+		}
+		s.received.Store(true)
+		cmd := header[1]
+		length := int(binary.LittleEndian.Uint16(header[2:]))
+		id := binary.LittleEndian.Uint32(header[4:])
+		if length > 0 && cmd != muxCmdPSH && cmd != muxCmdUPD {
+			s.fail(errMuxInvalidProtocol)
+			return
+		}
+		switch cmd {
+		case muxCmdNOP:
+		case muxCmdSYN:
+			if s.acceptCh == nil {
+				continue
+			}
+			s.mu.Lock()
+			if _, ok := s.streams[id]; ok {
+				s.mu.Unlock()
+				continue
+			}
+			stream := newMuxStream(s, id)
+			s.streams[id] = stream
+			s.mu.Unlock()
+			select {
+			case s.acceptCh <- stream:
+			case <-s.done:
+				return
+			}
+		case muxCmdFIN:
+			if stream := s.stream(id); stream != nil {
+				stream.receiveFIN()
+			}
+		case muxCmdPSH:
+			data := make([]byte, length)
+			if _, err := io.ReadFull(s.conn, data); err != nil {
+				s.fail(err)
+				return
+			}
+			if stream := s.stream(id); stream != nil && stream.push(data) {
+				s.mu.Lock()
+				s.buffered += len(data)
+				for s.buffered > muxMaxReceiveBuffer && s.err == nil {
+					s.bufferFreed.Wait()
+				}
+				s.mu.Unlock()
+			}
+		case muxCmdUPD:
+			if s.version < 2 || length != 8 {
+				s.fail(errMuxInvalidProtocol)
+				return
+			}
+			var payload [8]byte
+			if _, err := io.ReadFull(s.conn, payload[:]); err != nil {
+				s.fail(err)
+				return
+			}
+			if stream := s.stream(id); stream != nil {
+				stream.update(binary.LittleEndian.Uint32(payload[:]), binary.LittleEndian.Uint32(payload[4:]))
+			}
+		default:
+			s.fail(errMuxInvalidProtocol)
+			return
+		}
+	}
+}
+
+func (s *muxSession) keepAliveLoop() {
+	ping := time.NewTicker(muxKeepAliveInterval)
+	defer ping.Stop()
+	timeout := time.NewTicker(muxKeepAliveTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ping.C:
+			s.writeFrame(muxCmdNOP, 0, nil)
+		case <-timeout.C:
+			if !s.received.Swap(false) {
+				s.fail(errMuxTimeout)
+				return
+			}
+			s.mu.Lock()
+			idle := s.client && len(s.streams) == 0 && time.Since(s.idleSince) > muxIdleTimeout
+			s.mu.Unlock()
+			if idle {
+				s.fail(net.ErrClosed)
+				return
+			}
+		}
+	}
+}
+
+// fail terminates the session and its streams with the given error, and closes the connection.
+func (s *muxSession) fail(err error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.err = err
+	close(s.done)
+	streams := s.streams
+	s.streams = make(map[uint32]*muxStream)
+	s.bufferFreed.Broadcast()
+	s.mu.Unlock()
+	s.conn.Close()
+	for _, stream := range streams {
+		stream.sessionFailed(err)
+	}
+}
+
+// muxStream is a stream of a [muxSession]. It's safe for concurrent use.
+type muxStream struct {
+	session *muxSession
+	id      uint32
+	// wmu keeps the frames of a Write together.
+	wmu sync.Mutex
+
+	mu sync.Mutex
+	// changed is closed and replaced whenever the state changes, to wake up blocked calls.
+	changed     chan struct{}
+	buffer      [][]byte
+	finReceived bool
+	finSent     bool
+	readClosed  bool
+	closed      bool
+	err         error
+	// The flow control of version 2: the data read and not yet announced to the peer, and the data written and
+	// consumed by the peer.
+	numRead       uint32
+	unannounced   uint32
+	numWritten    uint32
+	peerConsumed  uint32
+	peerWindow    uint32
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+var _ transport.StreamConn = (*muxStream)(nil)
+
+func newMuxStream(session *muxSession, id uint32) *muxStream {
+	return &muxStream{
+		session:    session,
+		id:         id,
+		changed:    make(chan struct{}),
+		peerWindow: muxInitialPeerWindow,
+	}
+}
+
+func (s *muxStream) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// push buffers data from the peer. It returns false if the data is discarded.
+func (s *muxStream) push(data []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.readClosed || len(data) == 0 {
+		return false
+	}
+	s.buffer = append(s.buffer, data)
+	s.notifyLocked()
+	return true
+}
+
+func (s *muxStream) receiveFIN() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finReceived = true
+	s.notifyLocked()
+}
+
+func (s *muxStream) update(consumed, window uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peerConsumed = consumed
+	s.peerWindow = window
+	s.notifyLocked()
+}
+
+func (s *muxStream) sessionFailed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.notifyLocked()
+}
+
+// discardLocked drops the buffered data and returns its size.
+func (s *muxStream) discardLocked() int {
+	n := 0
+	for _, data := range s.buffer {
+		n += len(data)
+	}
+	s.buffer = nil
+	return n
+}
+
+// Read implements [io.Reader]. It returns [io.EOF] once the peer ends its writes and the data is consumed.
+func (s *muxStream) Read(b []byte) (int, error) {
+	s.mu.Lock()
+	for {
+		if s.closed || s.readClosed {
+			s.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		if len(s.buffer) > 0 {
+			n := copy(b, s.buffer[0])
+			if s.buffer[0] = s.buffer[0][n:]; len(s.buffer[0]) == 0 {
+				s.buffer = s.buffer[1:]
+			}
+			announce := false
+			if s.session.version >= 2 {
+				// Announce the window on the first read, and then whenever half of it has been consumed, as smux does.
+				s.numRead += uint32(n)
+				s.unannounced += uint32(n)
+				if s.unannounced >= muxMaxStreamBuffer/2 || s.numRead == uint32(n) {
+					announce = true
+					s.unannounced = 0
+				}
+			}
+			consumed := s.numRead
+			s.mu.Unlock()
+			s.session.releaseBuffer(n)
+			if announce {
+				s.session.writeUpdate(s.id, consumed, muxMaxStreamBuffer)
+			}
+			return n, nil
+		}
+		if s.finReceived {
+			s.mu.Unlock()
+			return 0, io.EOF
+		}
+		if s.err != nil {
+			s.mu.Unlock()
+			return 0, s.err
+		}
+		if err := waitForChange(&s.mu, s.changed, s.readDeadline); err != nil {
+			s.mu.Unlock()
+			return 0, err
+		}
+	}
+}
+
+// Write implements [io.Writer]. It returns once the data is queued on the session.
+func (s *muxStream) Write(b []byte) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	written := 0
+	for {
+		s.mu.Lock()
+		n := 0
+		for {
+			if s.closed || s.finSent {
+				s.mu.Unlock()
+				return written, net.ErrClosed
+			}
+			if s.err != nil {
+				s.mu.Unlock()
+				return written, s.err
+			}
+			n = min(len(b)-written, muxMaxFrameSize)
+			if s.session.version < 2 || n == 0 {
+				break
+			}
+			if window := int32(s.peerWindow - (s.numWritten - s.peerConsumed)); window > 0 {
+				n = min(n, int(window))
+				s.numWritten += uint32(n)
+				break
+			}
+			if err := waitForChange(&s.mu, s.changed, s.writeDeadline); err != nil {
+				s.mu.Unlock()
+				return written, err
+			}
+		}
+		s.mu.Unlock()
+		if n == 0 {
+			return written, nil
+		}
+		if err := s.session.writeFrame(muxCmdPSH, s.id, b[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+}
+
+// CloseWrite sends a FIN to the peer, which reads the end of the stream once it consumes the data.
+func (s *muxStream) CloseWrite() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	if s.finSent {
+		s.mu.Unlock()
+		return nil
+	}
+	s.finSent = true
+	s.notifyLocked()
+	s.mu.Unlock()
+	// Wait for a pending Write, so the FIN follows its data.
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.session.writeFrame(muxCmdFIN, s.id, nil)
+}
+
+// CloseRead discards the buffered data. Further reads fail, and the data that arrives is discarded.
+func (s *muxStream) CloseRead() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	s.readClosed = true
+	n := s.discardLocked()
+	s.notifyLocked()
+	s.mu.Unlock()
+	s.session.releaseBuffer(n)
+	return nil
+}
+
+// Close sends a FIN to the peer if CloseWrite wasn't called, and removes the stream from the session.
+func (s *muxStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	s.closed = true
+	sendFIN := !s.finSent && s.err == nil
+	s.finSent = true
+	n := s.discardLocked()
+	s.notifyLocked()
+	s.mu.Unlock()
+	s.session.releaseBuffer(n)
+	if sendFIN {
+		s.session.writeFrame(muxCmdFIN, s.id, nil)
+	}
+	s.session.removeStream(s.id)
+	return nil
+}
+
+func (s *muxStream) LocalAddr() net.Addr {
+	return s.session.localAddr
+}
+
+func (s *muxStream) RemoteAddr() net.Addr {
+	return s.session.remoteAddr
+}
+
+func (s *muxStream) SetDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDeadline = t
+	s.writeDeadline = t
+	s.notifyLocked()
+	return nil
+}
+
+func (s *muxStream) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDeadline = t
+	s.notifyLocked()
+	return nil
+}
+
+func (s *muxStream) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeDeadline = t
+	s.notifyLocked()
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newMuxSessionPair(t *testing.T, version byte) (client, server *muxSession) {
+	a, b := net.Pipe()
+	client = newMuxSession(a, version, true, a.LocalAddr(), a.RemoteAddr())
+	server = newMuxSession(b, version, false, b.LocalAddr(), b.RemoteAddr())
+	t.Cleanup(func() {
+		client.fail(net.ErrClosed)
+		server.fail(net.ErrClosed)
+	})
+	return client, server
+}
+
+func TestMuxSession_Transfer(t *testing.T) {
+	for _, version := range []byte{1, 2} {
+		client, server := newMuxSessionPair(t, version)
+		data := make([]byte, 3*muxMaxStreamBuffer)
+		rand.Read(data)
+		go func() {
+			stream, err := server.accept()
+			if err != nil {
+				return
+			}
+			defer stream.Close()
+			io.Copy(stream, stream)
+		}()
+		stream, err := client.openStream()
+		require.NoError(t, err)
+		go func() {
+			stream.Write(data)
+			stream.CloseWrite()
+		}()
+		stream.SetReadDeadline(time.Now().Add(10 * time.Second))
+		received, err := io.ReadAll(stream)
+		require.NoError(t, err, "version %v", version)
+		require.True(t, bytes.Equal(data, received), "version %v", version)
+		require.NoError(t, stream.Close())
+	}
+}
+
+func TestMuxSession_Format(t *testing.T) {
+	a, b := net.Pipe()
+	client := newMuxSession(a, 2, true, nil, nil)
+	defer client.fail(net.ErrClosed)
+	defer b.Close()
+	go func() {
+		stream, err := client.openStream()
+		if err != nil {
+			return
+		}
+		stream.Write([]byte("hello"))
+		stream.Close()
+	}()
+	frames := make([]byte, 8+13+8)
+	_, err := io.ReadFull(b, frames)
+	require.NoError(t, err)
+	require.Equal(t, []byte{2, muxCmdSYN, 0, 0, 3, 0, 0, 0}, frames[:8])
+	require.Equal(t, append([]byte{2, muxCmdPSH, 5, 0, 3, 0, 0, 0}, "hello"...), frames[8:21])
+	require.Equal(t, []byte{2, muxCmdFIN, 0, 0, 3, 0, 0, 0}, frames[21:])
+}
+
+func TestMuxSession_Window(t *testing.T) {
+	client, server := newMuxSessionPair(t, 2)
+	stream, err := client.openStream()
+	require.NoError(t, err)
+	data := make([]byte, muxInitialPeerWindow+1)
+	// Nothing is read on the server, so the writes stop at the initial window of the peer.
+	stream.SetWriteDeadline(time.Now().Add(200 * time.Millisecond))
+	n, err := stream.Write(data)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.Equal(t, muxInitialPeerWindow, n)
+
+	accepted, err := server.accept()
+	require.NoError(t, err)
+	_, err = io.ReadFull(accepted, make([]byte, 10))
+	require.NoError(t, err)
+	// The first read announces the window of the stream.
+	stream.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err = stream.Write(data[n:])
+	require.NoError(t, err)
+}
+
+func TestMuxSession_Close(t *testing.T) {
+	client, server := newMuxSessionPair(t, 1)
+	stream, err := client.openStream()
+	require.NoError(t, err)
+	accepted, err := server.accept()
+	require.NoError(t, err)
+
+	require.NoError(t, accepted.CloseRead())
+	_, err = accepted.Read(make([]byte, 1))
+	require.ErrorIs(t, err, net.ErrClosed)
+	require.NoError(t, accepted.Close())
+	require.ErrorIs(t, accepted.Close(), net.ErrClosed)
+	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = stream.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+
+	// Closing the session fails the streams.
+	other, err := client.openStream()
+	require.NoError(t, err)
+	server.fail(net.ErrClosed)
+	other.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = other.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+	_, err = client.openStream()
+	require.Error(t, err)
+}
+
+func TestMuxSession_InvalidVersion(t *testing.T) {
+	a, b := net.Pipe()
+	server := newMuxSession(b, 1, false, nil, nil)
+	go a.Write([]byte{2, muxCmdSYN, 0, 0, 3, 0, 0, 0})
+	_, err := server.accept()
+	require.ErrorIs(t, err, errMuxInvalidProtocol)
+	a.Close()
+}
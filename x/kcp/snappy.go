@@ -0,0 +1,280 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// The snappy framing format, which kcptun uses to compress the streams unless nocomp is set.
+// See https://github.com/google/snappy/blob/main/framing_format.txt.
+const (
+	snappyChunkCompressed   = 0x00
+	snappyChunkUncompressed = 0x01
+	snappyChunkPadding      = 0xfe
+	snappyChunkStreamID     = 0xff
+
+	snappyStreamID = "sNaPpY"
+	// snappyMaxBlockSize is the maximum uncompressed size of a chunk.
+	snappyMaxBlockSize = 65536
+	// snappyMaxChunkSize is the maximum size of a chunk body: the checksum and the encoded block, which is at
+	// most 32 + n + n/6 bytes long.
+	snappyMaxChunkSize = 4 + 32 + snappyMaxBlockSize + snappyMaxBlockSize/6
+)
+
+var errSnappyCorrupt = errors.New("corrupt snappy stream")
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+func snappyChecksum(b []byte) uint32 {
+	c := crc32.Checksum(b, crc32c)
+	return (c>>15 | c<<17) + 0xa282ead8
+}
+
+// compStream compresses the data written to conn with the snappy framing format, and decompresses the data read.
+// Each Write is sent as whole chunks.
+type compStream struct {
+	conn io.ReadWriteCloser
+
+	wmu         sync.Mutex
+	wroteHeader bool
+
+	readHeader bool
+	pending    []byte
+	chunk      []byte
+}
+
+func newCompStream(conn io.ReadWriteCloser) *compStream {
+	return &compStream{conn: conn}
+}
+
+func (s *compStream) Write(b []byte) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	var frame []byte
+	if !s.wroteHeader {
+		frame = append(frame, snappyChunkStreamID, byte(len(snappyStreamID)), 0, 0)
+		frame = append(frame, snappyStreamID...)
+	}
+	for rest := b; len(rest) > 0; {
+		block := rest[:min(len(rest), snappyMaxBlockSize)]
+		rest = rest[len(block):]
+		chunkType := byte(snappyChunkCompressed)
+		body := snappyEncode(block)
+		if len(body) >= len(block)-len(block)/8 {
+			chunkType, body = snappyChunkUncompressed, block
+		}
+		size := 4 + len(body)
+		frame = append(frame, chunkType, byte(size), byte(size>>8), byte(size>>16))
+		frame = binary.LittleEndian.AppendUint32(frame, snappyChecksum(block))
+		frame = append(frame, body...)
+	}
+	if _, err := s.conn.Write(frame); err != nil {
+		return 0, err
+	}
+	s.wroteHeader = true
+	return len(b), nil
+}
+
+// Read must not be called concurrently.
+func (s *compStream) Read(b []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if err := s.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *compStream) readChunk() error {
+	var header [4]byte
+	if _, err := io.ReadFull(s.conn, header[:]); err != nil {
+		return err
+	}
+	chunkType := header[0]
+	size := int(header[1]) | int(header[2])<<8 | int(header[3])<<16
+	if !s.readHeader && chunkType != snappyChunkStreamID {
+		return errSnappyCorrupt
+	}
+	if size > snappyMaxChunkSize {
+		return fmt.Errorf("%w: chunk of %v bytes", errSnappyCorrupt, size)
+	}
+	if cap(s.chunk) < size {
+		s.chunk = make([]byte, size)
+	}
+	body := s.chunk[:size]
+	if _, err := io.ReadFull(s.conn, body); err != nil {
+		return err
+	}
+	switch {
+	case chunkType == snappyChunkStreamID:
+		if string(body) != snappyStreamID {
+			return errSnappyCorrupt
+		}
+		s.readHeader = true
+	case chunkType == snappyChunkCompressed || chunkType == snappyChunkUncompressed:
+		if size < 4 {
+			return errSnappyCorrupt
+		}
+		block := body[4:]
+		if chunkType == snappyChunkCompressed {
+			var err error
+			if block, err = snappyDecode(block); err != nil {
+				return err
+			}
+		} else if len(block) > snappyMaxBlockSize {
+			return errSnappyCorrupt
+		} else {
+			block = append([]byte(nil), block...)
+		}
+		if snappyChecksum(block) != binary.LittleEndian.Uint32(body) {
+			return fmt.Errorf("%w: checksum mismatch", errSnappyCorrupt)
+		}
+		s.pending = block
+	case chunkType == snappyChunkPadding || chunkType >= 0x80:
+		// Skippable.
+	default:
+		return fmt.Errorf("%w: unsupported chunk type %#x", errSnappyCorrupt, chunkType)
+	}
+	return nil
+}
+
+func (s *compStream) Close() error {
+	return s.conn.Close()
+}
+
+// snappyEncode returns the snappy block with src, which must be at most [snappyMaxBlockSize] long. It finds
+// matches of at least 4 bytes with a hash table, and doesn't try as hard as the reference implementation.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, 32+len(src)+len(src)/6), uint64(len(src)))
+	const tableBits = 14
+	var table [1 << tableBits]int32
+	literal := 0
+	for i := 0; i+4 <= len(src); {
+		word := binary.LittleEndian.Uint32(src[i:])
+		hash := (word * 0x1e35a7bd) >> (32 - tableBits)
+		candidate := int(table[hash]) - 1
+		table[hash] = int32(i + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != word {
+			i++
+			continue
+		}
+		length := 4
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		dst = snappyEmitLiteral(dst, src[literal:i])
+		for rest := length; rest > 0; {
+			// A copy with a 2-byte offset, as offsets are below snappyMaxBlockSize.
+			n := min(rest, 64)
+			offset := i - candidate
+			dst = append(dst, byte(n-1)<<2|2, byte(offset), byte(offset>>8))
+			rest -= n
+		}
+		i += length
+		literal = i
+	}
+	return snappyEmitLiteral(dst, src[literal:])
+}
+
+func snappyEmitLiteral(dst, literal []byte) []byte {
+	if len(literal) == 0 {
+		return dst
+	}
+	switch n := len(literal) - 1; {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	default:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	}
+	return append(dst, literal...)
+}
+
+// snappyDecode returns the data of a snappy block of at most [snappyMaxBlockSize] bytes.
+func snappyDecode(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 || size > snappyMaxBlockSize {
+		return nil, errSnappyCorrupt
+	}
+	dst := make([]byte, 0, size)
+	src = src[n:]
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				extra := length - 59
+				if len(src) < extra {
+					return nil, errSnappyCorrupt
+				}
+				length = 0
+				for i := 0; i < extra; i++ {
+					length |= int(src[i]) << (8 * i)
+				}
+				src = src[extra:]
+			}
+			length++
+			if length > len(src) || len(dst)+length > int(size) {
+				return nil, errSnappyCorrupt
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errSnappyCorrupt
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, errSnappyCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || len(dst)+length > int(size) {
+			return nil, errSnappyCorrupt
+		}
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if len(dst) != int(size) {
+		return nil, errSnappyCorrupt
+	}
+	return dst, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnappy_RoundTrip(t *testing.T) {
+	random := make([]byte, 5000)
+	rand.Read(random)
+	for _, data := range [][]byte{
+		{},
+		[]byte("a"),
+		bytes.Repeat([]byte("a"), snappyMaxBlockSize),
+		bytes.Repeat([]byte("abcdefgh12345"), 1000),
+		append(bytes.Repeat(random[:100], 5), random...),
+	} {
+		encoded := snappyEncode(data)
+		decoded, err := snappyDecode(encoded)
+		require.NoError(t, err)
+		require.Equal(t, len(data), len(decoded))
+		require.True(t, bytes.Equal(data, decoded))
+	}
+	require.Less(t, len(snappyEncode(bytes.Repeat([]byte("abcdefgh12345"), 1000))), 1000)
+}
+
+func TestSnappy_Decode(t *testing.T) {
+	// "abcabcabcd": a literal, a 1-byte offset copy of 6 bytes, and a literal, as the reference encoder writes it.
+	decoded, err := snappyDecode([]byte{10, 2 << 2, 'a', 'b', 'c', 1 | 2<<2, 3, 0, 'd'})
+	require.NoError(t, err)
+	require.Equal(t, "abcabcabcd", string(decoded))
+
+	for _, corrupt := range [][]byte{
+		{},
+		{5, 0, 'a'},
+		{3, 0, 'a', 1, 2},
+		{4, 0, 'a', 2 | 2<<2, 2, 0},
+		{1, 60 << 2},
+	} {
+		_, err := snappyDecode(corrupt)
+		require.ErrorIs(t, err, errSnappyCorrupt, "block %v", corrupt)
+	}
+}
+
+func TestCompStream(t *testing.T) {
+	a, b := net.Pipe()
+	writer, reader := newCompStream(a), newCompStream(b)
+	data := bytes.Repeat([]byte("compressible "), 10_000)
+	go func() {
+		writer.Write(data[:10])
+		writer.Write(data[10:])
+		writer.Close()
+	}()
+	received, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, data, received)
+}
+
+func TestCompStream_Format(t *testing.T) {
+	a, b := net.Pipe()
+	go func() {
+		newCompStream(a).Write([]byte("hi"))
+		a.Close()
+	}()
+	written, _ := io.ReadAll(b)
+	expected := append([]byte{0xff, 6, 0, 0}, "sNaPpY"...)
+	expected = append(expected, 0x01, 6, 0, 0)
+	expected = binary.LittleEndian.AppendUint32(expected, maskedCRC32C([]byte("hi")))
+	expected = append(expected, "hi"...)
+	require.Equal(t, expected, written)
+}
+
+func TestCompStream_Corrupt(t *testing.T) {
+	for _, stream := range [][]byte{
+		// Missing stream identifier.
+		{0x01, 5, 0, 0, 0, 0, 0, 0, 'x'},
+		// Wrong checksum.
+		append(append([]byte{0xff, 6, 0, 0}, "sNaPpY"...), 0x01, 5, 0, 0, 0, 0, 0, 0, 'x'),
+		// Reserved unskippable chunk.
+		append(append([]byte{0xff, 6, 0, 0}, "sNaPpY"...), 0x02, 0, 0, 0),
+	} {
+		a, b := net.Pipe()
+		go func() {
+			a.Write(stream)
+			a.Close()
+		}()
+		_, err := newCompStream(b).Read(make([]byte, 10))
+		require.ErrorIs(t, err, errSnappyCorrupt)
+		b.Close()
+	}
+}
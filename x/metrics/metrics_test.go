@@ -0,0 +1,164 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	registry := NewRegistry()
+	requests, err := registry.NewCounterVec("requests_total", "Requests\nserved.", "path")
+	require.NoError(t, err)
+	inflight, err := registry.NewGaugeVec("inflight", "In flight.")
+	require.NoError(t, err)
+	_, err = registry.NewGaugeVec("empty", "Not written.")
+	require.NoError(t, err)
+
+	requests.With(`/b"\`).Add(2)
+	requests.With("/a").Inc()
+	inflight.With().Inc()
+	inflight.With().Inc()
+	inflight.With().Dec()
+
+	var text strings.Builder
+	require.NoError(t, registry.WriteText(&text))
+	require.Equal(t, `# HELP requests_total Requests\nserved.
+# TYPE requests_total counter
+requests_total{path="/a"} 1
+requests_total{path="/b\"\\"} 2
+# HELP inflight In flight.
+# TYPE inflight gauge
+inflight 1
+`, text.String())
+}
+
+func TestRegistry_Invalid(t *testing.T) {
+	registry := NewRegistry()
+	_, err := registry.NewCounterVec("bad-name", "")
+	require.Error(t, err)
+	_, err = registry.NewCounterVec("ok", "", "__reserved")
+	require.Error(t, err)
+	_, err = registry.NewCounterVec("ok", "")
+	require.NoError(t, err)
+	_, err = registry.NewGaugeVec("ok", "")
+	require.Error(t, err)
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	counter, err := registry.NewCounterVec("hits_total", "Hits.")
+	require.NoError(t, err)
+	counter.With().Inc()
+
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, TextContentType, resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "hits_total 1\n")
+
+	resp, err = http.Post(server.URL, "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestServerMetrics_Listener(t *testing.T) {
+	registry := NewRegistry()
+	m, err := NewServerMetrics(registry, func(ip netip.Addr) string {
+		require.Equal(t, netip.MustParseAddr("127.0.0.1"), ip)
+		return "BR"
+	})
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener = m.WrapListener("echo", listener)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	_, err = clientConn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(clientConn, buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), m.activeConns.With("echo", "BR").Value())
+
+	clientConn.Close()
+	require.Eventually(t, func() bool { return m.activeConns.With("echo", "BR").Value() == 0 }, time.Second, time.Millisecond)
+	require.Equal(t, uint64(1), m.connections.With("echo", "BR").Value())
+	require.Equal(t, uint64(5), m.bytes.With("echo", "received").Value())
+	require.Equal(t, uint64(5), m.bytes.With("echo", "sent").Value())
+
+	m.AddHandshakeError("echo")
+	m.AddAuthFailure("echo")
+	var text strings.Builder
+	require.NoError(t, registry.WriteText(&text))
+	require.Contains(t, text.String(), `outline_server_connections_total{server="echo",country="BR"} 1`)
+	require.Contains(t, text.String(), `outline_server_handshake_errors_total{server="echo"} 1`)
+	require.Contains(t, text.String(), `outline_server_auth_failures_total{server="echo"} 1`)
+}
+
+func TestServerMetrics_UnknownCountry(t *testing.T) {
+	m, err := NewServerMetrics(NewRegistry(), nil)
+	require.NoError(t, err)
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := m.WrapConn("pipe", server)
+	require.Equal(t, int64(1), m.activeConns.With("pipe", UnknownCountry).Value())
+	require.NoError(t, conn.Close())
+	require.NoError(t, conn.Close())
+	require.Equal(t, int64(0), m.activeConns.With("pipe", UnknownCountry).Value())
+}
+
+func TestServerMetrics_PacketConn(t *testing.T) {
+	m, err := NewServerMetrics(NewRegistry(), nil)
+	require.NoError(t, err)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	pc = m.WrapPacketConn("udp", pc)
+	defer pc.Close()
+
+	_, err = pc.WriteTo([]byte("ping"), pc.LocalAddr())
+	require.NoError(t, err)
+	buf := make([]byte, 10)
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, uint64(4), m.bytes.With("udp", "sent").Value())
+	require.Equal(t, uint64(4), m.bytes.With("udp", "received").Value())
+}
@@ -0,0 +1,274 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package metrics collects metrics of the servers and relays, and exports them in the Prometheus text format, with no
+dependency on the Prometheus client.
+
+Metrics are opt-in: create a [Registry] and a [ServerMetrics], wrap the listeners of the servers to instrument, and
+serve the [Registry] on an HTTP endpoint:
+
+	registry := metrics.NewRegistry()
+	serverMetrics, _ := metrics.NewServerMetrics(registry, geoipReader.CountryCode)
+	listener = serverMetrics.WrapListener("socks", listener)
+	go http.ListenAndServe("127.0.0.1:9090", registry)
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// TextContentType is the content type of the Prometheus text format.
+const TextContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Registry holds metric families, and exports them in the Prometheus text format.
+// It implements [http.Handler] to serve the metrics.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+var _ http.Handler = (*Registry)(nil)
+
+// NewRegistry creates an empty [Registry].
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type family struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	newValue   func() valuer
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       valuer
+}
+
+type valuer interface {
+	text() string
+}
+
+func (r *Registry) register(name, help, metricType string, labelNames []string, newValue func() valuer) (*family, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid metric name %q", name)
+	}
+	for _, label := range labelNames {
+		if !namePattern.MatchString(label) || strings.Contains(label, ":") || strings.HasPrefix(label, "__") {
+			return nil, fmt.Errorf("invalid label name %q", label)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		if f.name == name {
+			return nil, fmt.Errorf("metric %q is already registered", name)
+		}
+	}
+	f := &family{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		newValue:   newValue,
+		series:     make(map[string]*series),
+	}
+	r.families = append(r.families, f)
+	return f, nil
+}
+
+// get returns the series for the label values, creating it if needed. It panics if the number of values is wrong,
+// since that's a programming error.
+func (f *family) get(labelValues []string) valuer {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %v has %v labels, got %v values", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...), value: f.newValue()}
+		f.series[key] = s
+	}
+	return s.value
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Add increases the counter by n.
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+// Inc increases the counter by one.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Value returns the current value.
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+func (c *Counter) text() string {
+	return fmt.Sprint(c.Value())
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	value atomic.Int64
+}
+
+// Add adds n, which may be negative, to the gauge.
+func (g *Gauge) Add(n int64) {
+	g.value.Add(n)
+}
+
+// Inc increases the gauge by one.
+func (g *Gauge) Inc() {
+	g.value.Add(1)
+}
+
+// Dec decreases the gauge by one.
+func (g *Gauge) Dec() {
+	g.value.Add(-1)
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+func (g *Gauge) text() string {
+	return fmt.Sprint(g.Value())
+}
+
+// CounterVec is a family of [Counter] metrics, one per combination of label values.
+type CounterVec struct {
+	family *family
+}
+
+// NewCounterVec registers a counter family. The name should end in "_total".
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) (*CounterVec, error) {
+	f, err := r.register(name, help, "counter", labelNames, func() valuer { return &Counter{} })
+	if err != nil {
+		return nil, err
+	}
+	return &CounterVec{family: f}, nil
+}
+
+// With returns the counter for the label values, in the order of the label names.
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	return v.family.get(labelValues).(*Counter)
+}
+
+// GaugeVec is a family of [Gauge] metrics, one per combination of label values.
+type GaugeVec struct {
+	family *family
+}
+
+// NewGaugeVec registers a gauge family.
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) (*GaugeVec, error) {
+	f, err := r.register(name, help, "gauge", labelNames, func() valuer { return &Gauge{} })
+	if err != nil {
+		return nil, err
+	}
+	return &GaugeVec{family: f}, nil
+}
+
+// With returns the gauge for the label values, in the order of the label names.
+func (v *GaugeVec) With(labelValues ...string) *Gauge {
+	return v.family.get(labelValues).(*Gauge)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// WriteText writes the metrics in the Prometheus text format. Families are written in the order they were
+// registered, and the series of a family are sorted by label values.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.mu.Lock()
+		seriesList := make([]*series, 0, len(f.series))
+		for _, s := range f.series {
+			seriesList = append(seriesList, s)
+		}
+		f.mu.Unlock()
+		if len(seriesList) == 0 {
+			continue
+		}
+		sort.Slice(seriesList, func(i, j int) bool {
+			return strings.Join(seriesList[i].labelValues, "\xff") < strings.Join(seriesList[j].labelValues, "\xff")
+		})
+		fmt.Fprintf(bw, "# HELP %v %v\n# TYPE %v %v\n", f.name, helpEscaper.Replace(f.help), f.name, f.metricType)
+		for _, s := range seriesList {
+			bw.WriteString(f.name)
+			if len(f.labelNames) > 0 {
+				bw.WriteByte('{')
+				for i, label := range f.labelNames {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, `%v="%v"`, label, labelEscaper.Replace(s.labelValues[i]))
+				}
+				bw.WriteByte('}')
+			}
+			fmt.Fprintf(bw, " %v\n", s.value.text())
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp.Header().Set("Allow", "GET, HEAD")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp.Header().Set("Content-Type", TextContentType)
+	if req.Method == http.MethodHead {
+		return
+	}
+	// Errors mean the client went away, and the headers are already sent, so there's nothing to report.
+	r.WriteText(resp)
+}
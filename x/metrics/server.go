@@ -0,0 +1,189 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+)
+
+// UnknownCountry is the country label of clients whose country can't be found.
+const UnknownCountry = "ZZ"
+
+// ServerMetrics collects the standard metrics of servers and relays. The server label identifies the instrumented
+// server, like "socks" or "http:127.0.0.1:8080". The metrics are:
+//
+//   - outline_server_active_connections{server,country}: connections currently open.
+//   - outline_server_connections_total{server,country}: connections accepted, to count clients per country.
+//   - outline_server_bytes_total{server,direction}: bytes "received" from or "sent" to the clients.
+//   - outline_server_handshake_errors_total{server}: failed protocol handshakes, like TLS or WebSocket.
+//   - outline_server_auth_failures_total{server}: clients that failed the authentication.
+type ServerMetrics struct {
+	countryLookup   func(ip netip.Addr) string
+	activeConns     *GaugeVec
+	connections     *CounterVec
+	bytes           *CounterVec
+	handshakeErrors *CounterVec
+	authFailures    *CounterVec
+}
+
+// NewServerMetrics registers the server metrics in the registry. countryLookup returns the ISO country code of
+// client IPs, for instance [github.com/Jigsaw-Code/outline-sdk/x/geoip.Reader.CountryCode]. If it's nil, or returns
+// an empty code, [UnknownCountry] is used.
+func NewServerMetrics(registry *Registry, countryLookup func(ip netip.Addr) string) (*ServerMetrics, error) {
+	if registry == nil {
+		return nil, errors.New("argument registry must not be nil")
+	}
+	m := &ServerMetrics{countryLookup: countryLookup}
+	var err error
+	if m.activeConns, err = registry.NewGaugeVec("outline_server_active_connections", "Connections currently open.", "server", "country"); err != nil {
+		return nil, err
+	}
+	if m.connections, err = registry.NewCounterVec("outline_server_connections_total", "Connections accepted.", "server", "country"); err != nil {
+		return nil, err
+	}
+	if m.bytes, err = registry.NewCounterVec("outline_server_bytes_total", "Bytes received from or sent to the clients.", "server", "direction"); err != nil {
+		return nil, err
+	}
+	if m.handshakeErrors, err = registry.NewCounterVec("outline_server_handshake_errors_total", "Failed protocol handshakes.", "server"); err != nil {
+		return nil, err
+	}
+	if m.authFailures, err = registry.NewCounterVec("outline_server_auth_failures_total", "Clients that failed the authentication.", "server"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *ServerMetrics) country(addr net.Addr) string {
+	if m.countryLookup == nil || addr == nil {
+		return UnknownCountry
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return UnknownCountry
+	}
+	if country := m.countryLookup(addrPort.Addr().Unmap()); country != "" {
+		return country
+	}
+	return UnknownCountry
+}
+
+// AddHandshakeError records a failed handshake of the server.
+func (m *ServerMetrics) AddHandshakeError(server string) {
+	m.handshakeErrors.With(server).Inc()
+}
+
+// AddAuthFailure records a client of the server that failed the authentication.
+func (m *ServerMetrics) AddAuthFailure(server string) {
+	m.authFailures.With(server).Inc()
+}
+
+// WrapListener returns a listener that records the accepted connections and their bytes.
+func (m *ServerMetrics) WrapListener(server string, listener net.Listener) net.Listener {
+	return &metricsListener{Listener: listener, metrics: m, server: server}
+}
+
+// WrapConn records the connection and its bytes, until it's closed. Use it for connections that don't come from a
+// wrapped listener, like the ones of a relay.
+func (m *ServerMetrics) WrapConn(server string, conn net.Conn) net.Conn {
+	country := m.country(conn.RemoteAddr())
+	active := m.activeConns.With(server, country)
+	m.connections.With(server, country).Inc()
+	active.Inc()
+	return &metricsConn{
+		Conn:     conn,
+		active:   active,
+		received: m.bytes.With(server, "received"),
+		sent:     m.bytes.With(server, "sent"),
+	}
+}
+
+// WrapPacketConn returns a packet conn that records the bytes of the datagrams.
+func (m *ServerMetrics) WrapPacketConn(server string, conn net.PacketConn) net.PacketConn {
+	return &metricsPacketConn{PacketConn: conn, received: m.bytes.With(server, "received"), sent: m.bytes.With(server, "sent")}
+}
+
+type metricsListener struct {
+	net.Listener
+	metrics *ServerMetrics
+	server  string
+}
+
+func (l *metricsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.metrics.WrapConn(l.server, conn), nil
+}
+
+type metricsConn struct {
+	net.Conn
+	active    *Gauge
+	received  *Counter
+	sent      *Counter
+	closeOnce sync.Once
+}
+
+func (c *metricsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received.Add(uint64(n))
+	return n, err
+}
+
+func (c *metricsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sent.Add(uint64(n))
+	return n, err
+}
+
+func (c *metricsConn) Close() error {
+	c.closeOnce.Do(c.active.Dec)
+	return c.Conn.Close()
+}
+
+func (c *metricsConn) CloseRead() error {
+	if cr, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+func (c *metricsConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
+
+type metricsPacketConn struct {
+	net.PacketConn
+	received *Counter
+	sent     *Counter
+}
+
+func (c *metricsPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	c.received.Add(uint64(n))
+	return n, addr, err
+}
+
+func (c *metricsPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(b, addr)
+	c.sent.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,146 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobileproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/smart"
+)
+
+// DialerListener receives the progress and the result of an asynchronous dialer creation.
+// Its methods are called from a background goroutine, so implementations must not block the
+// UI thread and should dispatch to it if needed.
+// Exactly one of OnSuccess or OnFailure is called for each operation.
+type DialerListener interface {
+	// OnProgress reports a human-readable message about the progress of the operation.
+	OnProgress(message string)
+	// OnSuccess is called with the created dialer.
+	OnSuccess(dialer *StreamDialer)
+	// OnFailure is called with the error that made the operation fail, including cancelation.
+	OnFailure(err error)
+}
+
+// Task is a handle to an asynchronous operation.
+type Task struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Cancel cancels the operation. The listener's OnFailure is called if the operation had not finished yet.
+// It's safe to call Cancel multiple times and after the operation finishes.
+func (t *Task) Cancel() {
+	t.cancel()
+}
+
+// Wait blocks until the operation finishes and the listener has been called.
+// Mobile apps should not call it from the UI thread.
+func (t *Task) Wait() {
+	<-t.done
+}
+
+// runTask runs build in a goroutine and reports its result to the listener.
+func runTask(listener DialerListener, build func(ctx context.Context) (transport.StreamDialer, error)) *Task {
+	ctx, cancel := context.WithCancel(context.Background())
+	task := &Task{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(task.done)
+		defer cancel()
+		dialer, err := build(ctx)
+		if err == nil && ctx.Err() != nil {
+			// Honor cancelation even if the operation completed, releasing the dialer nobody will get.
+			if closer, ok := dialer.(io.Closer); ok {
+				closer.Close()
+			}
+			err = ctx.Err()
+		}
+		if err != nil {
+			listener.OnFailure(err)
+			return
+		}
+		listener.OnSuccess(&StreamDialer{dialer})
+	}()
+	return task
+}
+
+// NewStreamDialerFromConfigAsync is the asynchronous version of [NewStreamDialerFromConfig].
+// The result is delivered to the listener.
+func NewStreamDialerFromConfigAsync(transportConfig string, listener DialerListener) (*Task, error) {
+	if listener == nil {
+		return nil, errors.New("listener must not be nil")
+	}
+	return runTask(listener, func(ctx context.Context) (transport.StreamDialer, error) {
+		listener.OnProgress("Creating dialer from config")
+		return configModule.NewStreamDialer(ctx, transportConfig)
+	}), nil
+}
+
+// NewSmartStreamDialerAsync is the asynchronous version of [NewSmartStreamDialer].
+// Each log line of the strategy search is reported to the listener as progress, in addition to the logWriter.
+// Canceling the task stops the search.
+func NewSmartStreamDialerAsync(testDomains *StringList, searchConfig string, logWriter LogWriter, listener DialerListener) (*Task, error) {
+	if listener == nil {
+		return nil, errors.New("listener must not be nil")
+	}
+	if testDomains == nil {
+		return nil, errors.New("testDomains must not be nil")
+	}
+	return runTask(listener, func(ctx context.Context) (transport.StreamDialer, error) {
+		progressWriter := &progressWriter{listener: listener}
+		var logBytesWriter io.Writer = progressWriter
+		if w := toWriter(logWriter); w != nil {
+			logBytesWriter = io.MultiWriter(w, progressWriter)
+		}
+		finder := smart.StrategyFinder{
+			LogWriter:    logBytesWriter,
+			TestTimeout:  5 * time.Second,
+			StreamDialer: &transport.TCPDialer{},
+			PacketDialer: &transport.UDPDialer{},
+		}
+		return finder.NewDialer(ctx, testDomains.list, []byte(searchConfig))
+	}), nil
+}
+
+// progressWriter reports each line written to it as progress to the listener.
+type progressWriter struct {
+	listener DialerListener
+	mu       sync.Mutex
+	pending  strings.Builder
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending.Write(b)
+	text := w.pending.String()
+	lastNewLine := strings.LastIndexByte(text, '\n')
+	if lastNewLine < 0 {
+		return len(b), nil
+	}
+	w.pending.Reset()
+	w.pending.WriteString(text[lastNewLine+1:])
+	for _, line := range strings.Split(text[:lastNewLine], "\n") {
+		if line != "" {
+			w.listener.OnProgress(line)
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobileproxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+type testListener struct {
+	mu       sync.Mutex
+	progress []string
+	dialer   *StreamDialer
+	err      error
+	calls    int
+}
+
+func (l *testListener) OnProgress(message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.progress = append(l.progress, message)
+}
+
+func (l *testListener) OnSuccess(dialer *StreamDialer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dialer = dialer
+	l.calls++
+}
+
+func (l *testListener) OnFailure(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+	l.calls++
+}
+
+func TestNewStreamDialerFromConfigAsync(t *testing.T) {
+	listener := &testListener{}
+	task, err := NewStreamDialerFromConfigAsync("split:2", listener)
+	require.NoError(t, err)
+	task.Wait()
+	require.Equal(t, 1, listener.calls)
+	require.NoError(t, listener.err)
+	require.NotNil(t, listener.dialer)
+	require.NotEmpty(t, listener.progress)
+}
+
+func TestNewStreamDialerFromConfigAsync_Error(t *testing.T) {
+	listener := &testListener{}
+	task, err := NewStreamDialerFromConfigAsync("unknown:", listener)
+	require.NoError(t, err)
+	task.Wait()
+	require.Equal(t, 1, listener.calls)
+	require.Error(t, listener.err)
+	require.Nil(t, listener.dialer)
+}
+
+func TestNewSmartStreamDialerAsync_Cancel(t *testing.T) {
+	listener := &testListener{}
+	task, err := NewSmartStreamDialerAsync(NewListFromLines("www.example.com"), `{"dns": [{"system": {}}]}`, nil, listener)
+	require.NoError(t, err)
+	task.Cancel()
+	task.Wait()
+	task.Cancel()
+	require.Equal(t, 1, listener.calls)
+	require.Error(t, listener.err)
+}
+
+type closerDialer struct {
+	transport.StreamDialer
+	closed bool
+}
+
+func (d *closerDialer) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestRunTask_CancelClosesDialer(t *testing.T) {
+	listener := &testListener{}
+	dialer := &closerDialer{StreamDialer: &transport.TCPDialer{}}
+	built := make(chan struct{})
+	task := runTask(listener, func(ctx context.Context) (transport.StreamDialer, error) {
+		// Cancel after the dialer is created, but before it's delivered.
+		<-built
+		return dialer, nil
+	})
+	task.Cancel()
+	close(built)
+	task.Wait()
+	require.Equal(t, 1, listener.calls)
+	require.ErrorIs(t, listener.err, context.Canceled)
+	require.Nil(t, listener.dialer)
+	require.True(t, dialer.closed)
+}
+
+func TestProgressWriter(t *testing.T) {
+	listener := &testListener{}
+	w := &progressWriter{listener: listener}
+	w.Write([]byte("first line\nsecond "))
+	w.Write([]byte("line\n\nthird"))
+	require.Equal(t, []string{"first line", "second line"}, listener.progress)
+}
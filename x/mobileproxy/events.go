@@ -0,0 +1,130 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobileproxy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+)
+
+// ConnectionEvent describes a connection made through a [StreamDialer], for traffic logs and anomaly detection.
+// Times are in milliseconds, since Go Mobile doesn't support [time.Time].
+type ConnectionEvent struct {
+	// ID identifies the connection in the events of the process.
+	ID int64
+	// Destination is the host:port address requested by the app.
+	Destination string
+	// Chain is the sanitized config of the dialer, without secrets, or empty if the dialer was not created
+	// from a config.
+	Chain string
+	// StartTimeMillis is the Unix time, in milliseconds, when the dial started.
+	StartTimeMillis int64
+	// DurationMillis is how long the dial took in the opened and failed events, and how long the connection
+	// was open in the closed event.
+	DurationMillis int64
+	// BytesSent is the number of bytes written by the app. It's only set in the closed event.
+	BytesSent int64
+	// BytesReceived is the number of bytes read by the app. It's only set in the closed event.
+	BytesReceived int64
+	// Error is the dial error in the failed event, and empty otherwise.
+	Error string
+}
+
+// ConnectionEventListener receives the events of the connections of a [StreamDialer].
+// Its methods are called from the goroutines of the connections, so implementations must not block.
+type ConnectionEventListener interface {
+	// OnConnectionOpened is called when a connection is established.
+	OnConnectionOpened(event *ConnectionEvent)
+	// OnConnectionClosed is called once when an opened connection is closed.
+	OnConnectionClosed(event *ConnectionEvent)
+	// OnConnectionFailed is called when a connection can't be established.
+	OnConnectionFailed(event *ConnectionEvent)
+}
+
+// lastConnectionID is the ID of the last connection with events.
+var lastConnectionID atomic.Int64
+
+// WithConnectionEventListener returns a [StreamDialer] that dials with this dialer and reports the events
+// of its connections to the listener.
+func (d *StreamDialer) WithConnectionEventListener(listener ConnectionEventListener) *StreamDialer {
+	if listener == nil {
+		return d
+	}
+	chain := ""
+	if desc := configurl.Describe(d.StreamDialer); desc != nil {
+		chain = desc.String()
+	}
+	return &StreamDialer{transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		start := time.Now()
+		event := ConnectionEvent{
+			ID:              lastConnectionID.Add(1),
+			Destination:     addr,
+			Chain:           chain,
+			StartTimeMillis: start.UnixMilli(),
+		}
+		conn, err := d.StreamDialer.DialStream(ctx, addr)
+		event.DurationMillis = time.Since(start).Milliseconds()
+		if err != nil {
+			event.Error = err.Error()
+			listener.OnConnectionFailed(&event)
+			return nil, err
+		}
+		opened := event
+		listener.OnConnectionOpened(&opened)
+		return &eventConn{StreamConn: conn, listener: listener, event: event, openedAt: time.Now()}, nil
+	})}
+}
+
+// eventConn counts the bytes of a connection and reports its closing.
+type eventConn struct {
+	transport.StreamConn
+	listener      ConnectionEventListener
+	event         ConnectionEvent
+	openedAt      time.Time
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	closeOnce     sync.Once
+}
+
+var _ transport.StreamConn = (*eventConn)(nil)
+
+func (c *eventConn) Read(b []byte) (int, error) {
+	n, err := c.StreamConn.Read(b)
+	c.bytesReceived.Add(int64(n))
+	return n, err
+}
+
+func (c *eventConn) Write(b []byte) (int, error) {
+	n, err := c.StreamConn.Write(b)
+	c.bytesSent.Add(int64(n))
+	return n, err
+}
+
+func (c *eventConn) Close() error {
+	err := c.StreamConn.Close()
+	c.closeOnce.Do(func() {
+		closed := c.event
+		closed.DurationMillis = time.Since(c.openedAt).Milliseconds()
+		closed.BytesSent = c.bytesSent.Load()
+		closed.BytesReceived = c.bytesReceived.Load()
+		c.listener.OnConnectionClosed(&closed)
+	})
+	return err
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobileproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testEventListener struct {
+	mu     sync.Mutex
+	opened []ConnectionEvent
+	closed []ConnectionEvent
+	failed []ConnectionEvent
+}
+
+func (l *testEventListener) OnConnectionOpened(event *ConnectionEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.opened = append(l.opened, *event)
+}
+
+func (l *testEventListener) OnConnectionClosed(event *ConnectionEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = append(l.closed, *event)
+}
+
+func (l *testEventListener) OnConnectionFailed(event *ConnectionEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failed = append(l.failed, *event)
+}
+
+func TestStreamDialer_WithConnectionEventListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	dialer, err := NewStreamDialerFromConfig("split:2")
+	require.NoError(t, err)
+	events := &testEventListener{}
+	dialer = dialer.WithConnectionEventListener(events)
+
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	require.Len(t, events.opened, 1)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	conn.Close()
+
+	require.Len(t, events.closed, 1)
+	opened, closed := events.opened[0], events.closed[0]
+	require.Equal(t, listener.Addr().String(), opened.Destination)
+	require.Equal(t, "split:2", opened.Chain)
+	require.Zero(t, opened.BytesSent)
+	require.Equal(t, opened.ID, closed.ID)
+	require.Equal(t, opened.StartTimeMillis, closed.StartTimeMillis)
+	require.Equal(t, int64(5), closed.BytesSent)
+	require.Equal(t, int64(5), closed.BytesReceived)
+	require.Empty(t, closed.Error)
+
+	// Connect to the closed listener to fail.
+	listener.Close()
+	_, err = dialer.DialStream(context.Background(), listener.Addr().String())
+	require.Error(t, err)
+	require.Len(t, events.failed, 1)
+	require.NotEmpty(t, events.failed[0].Error)
+	require.Greater(t, events.failed[0].ID, closed.ID)
+}
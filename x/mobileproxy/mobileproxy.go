@@ -106,12 +106,22 @@ func (p *Proxy) Stop(timeoutSeconds int) {
 // RunProxy runs a local web proxy that listens on localAddress, and handles proxy requests by
 // establishing connections to requested destination using the [StreamDialer].
 func RunProxy(localAddress string, dialer *StreamDialer) (*Proxy, error) {
+	return runProxy(localAddress, dialer, nil)
+}
+
+// runProxy runs the local proxy on a listener for localAddress, which is wrapped with wrapListener if not nil.
+func runProxy(localAddress string, dialer *StreamDialer, wrapListener func(net.Listener) net.Listener) (*Proxy, error) {
+	if dialer == nil {
+		return nil, errors.New("dialer must not be nil. Please create and pass a valid StreamDialer")
+	}
 	listener, err := net.Listen("tcp", localAddress)
 	if err != nil {
 		return nil, fmt.Errorf("could not listen on address %v: %v", localAddress, err)
 	}
-	if dialer == nil {
-		return nil, errors.New("dialer must not be nil. Please create and pass a valid StreamDialer")
+	// Keep the address of the TCP listener, since it's the same for wrapped listeners.
+	listenerAddr := listener.Addr()
+	if wrapListener != nil {
+		listener = wrapListener(listener)
 	}
 
 	// The default http.Server doesn't close hijacked connections or cancel in-flight request contexts during
@@ -131,9 +141,9 @@ func RunProxy(localAddress string, dialer *StreamDialer) (*Proxy, error) {
 	})
 	go server.Serve(listener)
 
-	host, portStr, err := net.SplitHostPort(listener.Addr().String())
+	host, portStr, err := net.SplitHostPort(listenerAddr.String())
 	if err != nil {
-		return nil, fmt.Errorf("could not parse proxy address '%v': %v", listener.Addr().String(), err)
+		return nil, fmt.Errorf("could not parse proxy address '%v': %v", listenerAddr.String(), err)
 	}
 	port, err := strconv.Atoi(portStr)
 	if err != nil {
@@ -0,0 +1,53 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobileproxy
+
+import (
+	"github.com/Jigsaw-Code/outline-sdk/x/connectivity"
+)
+
+// NetworkChangeListener is notified when the device network changes, for instance when switching from Wi-Fi
+// to cellular. Apps can use it to find a new dialer, since the best strategy depends on the network.
+type NetworkChangeListener interface {
+	// OnNetworkChange is called from a background thread.
+	OnNetworkChange()
+}
+
+// NetworkMonitor watches the device network and notifies a [NetworkChangeListener] of changes.
+type NetworkMonitor struct {
+	monitor *connectivity.NetworkMonitor
+}
+
+// NewNetworkMonitor starts monitoring the network, notifying the listener of changes until
+// [NetworkMonitor.Stop] is called.
+func NewNetworkMonitor(listener NetworkChangeListener) (*NetworkMonitor, error) {
+	monitor, err := connectivity.NewNetworkMonitor()
+	if err != nil {
+		return nil, err
+	}
+	monitor.Subscribe(listener)
+	return &NetworkMonitor{monitor: monitor}, nil
+}
+
+// Check asks the monitor to look for changes now. Call it when the platform reports a network change,
+// such as a ConnectivityManager callback on Android or NWPathMonitor update on iOS.
+func (m *NetworkMonitor) Check() {
+	m.monitor.Check()
+}
+
+// Stop stops monitoring the network.
+func (m *NetworkMonitor) Stop() {
+	m.monitor.Close()
+}
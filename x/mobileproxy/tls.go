@@ -0,0 +1,150 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobileproxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// defaultCertificateValidityDays is the validity of generated certificates when none is given. Apple platforms
+// reject server certificates valid for more than 825 days.
+const defaultCertificateValidityDays = 365
+
+// Certificate is a TLS certificate with its private key, for the local proxy to serve TLS.
+type Certificate struct {
+	certPEM []byte
+	keyPEM  []byte
+	tlsCert tls.Certificate
+}
+
+// NewCertificate creates a [Certificate] from a PEM-encoded certificate chain and private key provided by the app.
+func NewCertificate(certPEM []byte, keyPEM []byte) (*Certificate, error) {
+	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate or key: %w", err)
+	}
+	return &Certificate{certPEM: certPEM, keyPEM: keyPEM, tlsCert: tlsCert}, nil
+}
+
+// GenerateCertificate generates a self-signed certificate for the given host names and IP addresses, valid for
+// validityDays days. If hosts is nil or empty, the certificate is for localhost and the loopback addresses. If
+// validityDays is not positive, the certificate is valid for a year.
+//
+// The app must trust the certificate in its network security configuration, for instance by pinning
+// [Certificate.PublicKeyPin].
+func GenerateCertificate(hosts *StringList, validityDays int) (*Certificate, error) {
+	var names []string
+	if hosts != nil {
+		for _, host := range hosts.list {
+			if host = strings.TrimSpace(host); host != "" {
+				names = append(names, host)
+			}
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	if validityDays <= 0 {
+		validityDays = defaultCertificateValidityDays
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: names[0]},
+		// Tolerate clocks that are a little behind.
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Duration(validityDays) * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return NewCertificate(certPEM, keyPEM)
+}
+
+// CertificatePEM returns the PEM-encoded certificate chain.
+func (c *Certificate) CertificatePEM() []byte {
+	return c.certPEM
+}
+
+// PrivateKeyPEM returns the PEM-encoded private key.
+func (c *Certificate) PrivateKeyPEM() []byte {
+	return c.keyPEM
+}
+
+// PublicKeyPin returns the base64-encoded SHA-256 digest of the public key of the leaf certificate, in the format
+// of the pin-set of Android network security configurations and of HTTP public key pinning.
+func (c *Certificate) PublicKeyPin() string {
+	leaf, err := x509.ParseCertificate(c.tlsCert.Certificate[0])
+	if err != nil {
+		return ""
+	}
+	digest := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// RunTLSProxy is like [RunProxy], but the local proxy serves TLS with the certificate, so it can be used as an
+// HTTPS proxy by clients that refuse cleartext proxies.
+func RunTLSProxy(localAddress string, dialer *StreamDialer, cert *Certificate) (*Proxy, error) {
+	if cert == nil {
+		return nil, errors.New("cert must not be nil. Please create and pass a valid Certificate")
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert.tlsCert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"http/1.1"},
+	}
+	return runProxy(localAddress, dialer, func(listener net.Listener) net.Listener {
+		return tls.NewListener(listener, tlsConfig)
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mobileproxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateCertificate(t *testing.T) {
+	cert, err := GenerateCertificate(NewListFromLines("example.test\n10.0.0.1"), 10)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(cert.CertificatePEM())
+	require.NotNil(t, block)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.test"}, leaf.DNSNames)
+	require.Len(t, leaf.IPAddresses, 1)
+	require.Equal(t, "10.0.0.1", leaf.IPAddresses[0].String())
+	require.InDelta(t, float64(10*24), leaf.NotAfter.Sub(leaf.NotBefore).Hours(), 2)
+
+	digest := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	require.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), cert.PublicKeyPin())
+
+	// The PEM output can be loaded back.
+	loaded, err := NewCertificate(cert.CertificatePEM(), cert.PrivateKeyPEM())
+	require.NoError(t, err)
+	require.Equal(t, cert.PublicKeyPin(), loaded.PublicKeyPin())
+}
+
+func TestGenerateCertificate_Defaults(t *testing.T) {
+	cert, err := GenerateCertificate(nil, 0)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.tlsCert.Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, []string{"localhost"}, leaf.DNSNames)
+	require.Len(t, leaf.IPAddresses, 2)
+}
+
+func TestNewCertificate_Invalid(t *testing.T) {
+	_, err := NewCertificate([]byte("not a cert"), []byte("not a key"))
+	require.Error(t, err)
+}
+
+func TestRunTLSProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer target.Close()
+
+	cert, err := GenerateCertificate(nil, 1)
+	require.NoError(t, err)
+	dialer, err := NewStreamDialerFromConfig("")
+	require.NoError(t, err)
+	proxy, err := RunTLSProxy("127.0.0.1:0", dialer, cert)
+	require.NoError(t, err)
+	defer proxy.Stop(1)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(cert.CertificatePEM()))
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(&url.URL{Scheme: "https", Host: proxy.Address()}),
+		TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"},
+	}}
+	resp, err := client.Get(target.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(body))
+
+	// The proxy doesn't accept cleartext requests.
+	conn, err := net.Dial("tcp", proxy.Address())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET "+target.URL+" HTTP/1.1\r\nHost: "+target.Listener.Addr().String()+"\r\n\r\n")
+	require.NoError(t, err)
+	response, _ := io.ReadAll(conn)
+	require.NotContains(t, string(response), "hello")
+}
+
+func TestRunTLSProxy_NilCertificate(t *testing.T) {
+	dialer, err := NewStreamDialerFromConfig("")
+	require.NoError(t, err)
+	_, err = RunTLSProxy("127.0.0.1:0", dialer, nil)
+	require.Error(t, err)
+}
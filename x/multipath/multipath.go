@@ -0,0 +1,220 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package multipath provides experimental dialers that spread traffic across two or more paths, like two servers or
+the Wi-Fi and cellular networks, for resilience against the throttling or blocking of a single path.
+
+The paths are independent dialers, and the destinations don't need to support multipath. Since a stream can't be
+split across paths without the cooperation of the server, the stream dialer schedules each connection on a path,
+while the packet dialer schedules each datagram.
+
+The scheduling [Policy] can be:
+  - [Redundant]: streams race on all paths and use the first connection, and datagrams are sent on all paths, with
+    duplicate responses dropped.
+  - [RoundRobin]: streams and datagrams rotate over the paths.
+  - [LowestRTT]: streams and datagrams use the path with the lowest round-trip time, measured from the connection
+    times for streams, and from the time between a datagram and the next response for packets.
+
+With all policies, streams fall back to the other paths if the connection fails.
+*/
+package multipath
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// Policy is the scheduling policy of a multipath dialer.
+type Policy int
+
+const (
+	// Redundant sends the traffic on all paths.
+	Redundant Policy = iota
+	// RoundRobin rotates over the paths.
+	RoundRobin
+	// LowestRTT uses the path with the lowest round-trip time.
+	LowestRTT
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Redundant:
+		return "redundant"
+	case RoundRobin:
+		return "round-robin"
+	case LowestRTT:
+		return "lowest-rtt"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// rttAlpha is the weight of new samples in the smoothed round-trip times, as in TCP.
+const rttAlpha = 0.125
+
+// scheduler picks the paths according to the policy.
+type scheduler struct {
+	policy Policy
+
+	mu   sync.Mutex
+	next int
+	// rtts are the smoothed round-trip times of the paths, or zero if not measured yet.
+	rtts []time.Duration
+}
+
+func newScheduler(policy Policy, numPaths int) (*scheduler, error) {
+	if policy < Redundant || policy > LowestRTT {
+		return nil, fmt.Errorf("unsupported policy %v", policy)
+	}
+	if numPaths < 1 {
+		return nil, errors.New("at least one path is required")
+	}
+	return &scheduler{policy: policy, rtts: make([]time.Duration, numPaths)}, nil
+}
+
+// order returns the path indices in the order to try them, for policies other than [Redundant].
+func (s *scheduler) order() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order := make([]int, len(s.rtts))
+	for i := range order {
+		order[i] = (s.next + i) % len(order)
+	}
+	switch s.policy {
+	case RoundRobin:
+		s.next = (s.next + 1) % len(order)
+	case LowestRTT:
+		// Paths without measurements go first, so they get measured.
+		sort.SliceStable(order, func(i, j int) bool { return s.rtts[order[i]] < s.rtts[order[j]] })
+	}
+	return order
+}
+
+// addSample updates the smoothed round-trip time of the path.
+func (s *scheduler) addSample(path int, rtt time.Duration) {
+	if rtt <= 0 {
+		rtt = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rtts[path] == 0 {
+		s.rtts[path] = rtt
+		return
+	}
+	s.rtts[path] += time.Duration(rttAlpha * float64(rtt-s.rtts[path]))
+}
+
+// RTTs returns the smoothed round-trip times of the paths, with zero for the paths without measurements.
+func (s *scheduler) RTTs() []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Duration(nil), s.rtts...)
+}
+
+// StreamDialer is a [transport.StreamDialer] that schedules each connection on one of its paths.
+type StreamDialer struct {
+	*scheduler
+	dialers []transport.StreamDialer
+}
+
+var _ transport.StreamDialer = (*StreamDialer)(nil)
+
+// NewStreamDialer creates a [StreamDialer] that schedules the connections over the dialers with the policy.
+func NewStreamDialer(policy Policy, dialers ...transport.StreamDialer) (*StreamDialer, error) {
+	for _, d := range dialers {
+		if d == nil {
+			return nil, errors.New("dialers must not be nil")
+		}
+	}
+	s, err := newScheduler(policy, len(dialers))
+	if err != nil {
+		return nil, err
+	}
+	return &StreamDialer{scheduler: s, dialers: dialers}, nil
+}
+
+// DialStream implements [transport.StreamDialer].
+func (d *StreamDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	if d.policy == Redundant {
+		return d.race(ctx, addr)
+	}
+	var errs []error
+	for _, path := range d.order() {
+		conn, err := d.dial(ctx, path, addr)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (d *StreamDialer) dial(ctx context.Context, path int, addr string) (transport.StreamConn, error) {
+	start := time.Now()
+	conn, err := d.dialers[path].DialStream(ctx, addr)
+	if err != nil {
+		// Penalize failing paths, so they go last.
+		if ctx.Err() == nil {
+			d.addSample(path, time.Minute)
+		}
+		return nil, fmt.Errorf("path %d failed: %w", path, err)
+	}
+	d.addSample(path, time.Since(start))
+	return conn, nil
+}
+
+// race dials all paths at the same time, and returns the first connection.
+func (d *StreamDialer) race(ctx context.Context, addr string) (transport.StreamConn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		conn transport.StreamConn
+		err  error
+	}
+	results := make(chan result, len(d.dialers))
+	for path := range d.dialers {
+		go func() {
+			conn, err := d.dial(ctx, path, addr)
+			results <- result{conn, err}
+		}()
+	}
+	var errs []error
+	for pending := len(d.dialers); pending > 0; pending-- {
+		r := <-results
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		// Close the connections of the paths that lose the race.
+		go func() {
+			for pending--; pending > 0; pending-- {
+				if r := <-results; r.err == nil {
+					r.conn.Close()
+				}
+			}
+		}()
+		return r.conn, nil
+	}
+	return nil, errors.Join(errs...)
+}
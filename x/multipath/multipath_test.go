@@ -0,0 +1,236 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multipath
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStreamDialer counts the dials, and fails if err is set.
+type countingStreamDialer struct {
+	dials atomic.Int32
+	delay time.Duration
+	err   error
+}
+
+func (d *countingStreamDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	d.dials.Add(1)
+	select {
+	case <-time.After(d.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return &pipeConn{client}, nil
+}
+
+type pipeConn struct {
+	net.Conn
+}
+
+func (c *pipeConn) CloseRead() error  { return nil }
+func (c *pipeConn) CloseWrite() error { return nil }
+
+func TestPolicyString(t *testing.T) {
+	require.Equal(t, "redundant", Redundant.String())
+	require.Equal(t, "round-robin", RoundRobin.String())
+	require.Equal(t, "lowest-rtt", LowestRTT.String())
+	require.Equal(t, "Policy(7)", Policy(7).String())
+}
+
+func TestNewStreamDialerErrors(t *testing.T) {
+	_, err := NewStreamDialer(RoundRobin)
+	require.Error(t, err)
+	_, err = NewStreamDialer(Policy(7), &countingStreamDialer{})
+	require.Error(t, err)
+	_, err = NewStreamDialer(RoundRobin, nil)
+	require.Error(t, err)
+}
+
+func TestStreamDialerRoundRobin(t *testing.T) {
+	a, b := &countingStreamDialer{}, &countingStreamDialer{}
+	d, err := NewStreamDialer(RoundRobin, a, b)
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		conn, err := d.DialStream(context.Background(), "example.com:443")
+		require.NoError(t, err)
+		conn.Close()
+	}
+	require.Equal(t, int32(2), a.dials.Load())
+	require.Equal(t, int32(2), b.dials.Load())
+}
+
+func TestStreamDialerFailover(t *testing.T) {
+	failing, working := &countingStreamDialer{err: errors.New("blocked")}, &countingStreamDialer{}
+	d, err := NewStreamDialer(RoundRobin, failing, working)
+	require.NoError(t, err)
+	conn, err := d.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, int32(1), failing.dials.Load())
+	require.Equal(t, int32(1), working.dials.Load())
+
+	d, err = NewStreamDialer(LowestRTT, failing, &countingStreamDialer{err: errors.New("blocked")})
+	require.NoError(t, err)
+	_, err = d.DialStream(context.Background(), "example.com:443")
+	require.ErrorContains(t, err, "blocked")
+}
+
+func TestStreamDialerLowestRTT(t *testing.T) {
+	slow, fast := &countingStreamDialer{delay: 50 * time.Millisecond}, &countingStreamDialer{delay: time.Millisecond}
+	d, err := NewStreamDialer(LowestRTT, slow, fast)
+	require.NoError(t, err)
+	// The first two dials measure the paths.
+	for i := 0; i < 5; i++ {
+		conn, err := d.DialStream(context.Background(), "example.com:443")
+		require.NoError(t, err)
+		conn.Close()
+	}
+	require.Equal(t, int32(1), slow.dials.Load())
+	require.Equal(t, int32(4), fast.dials.Load())
+	rtts := d.RTTs()
+	require.Greater(t, rtts[0], rtts[1])
+}
+
+func TestStreamDialerRedundant(t *testing.T) {
+	slow, fast := &countingStreamDialer{delay: time.Second}, &countingStreamDialer{}
+	d, err := NewStreamDialer(Redundant, slow, fast)
+	require.NoError(t, err)
+	start := time.Now()
+	conn, err := d.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	conn.Close()
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.Equal(t, int32(1), fast.dials.Load())
+	// The slow path may start after the fast one wins.
+	require.Eventually(t, func() bool { return slow.dials.Load() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+// startUDPEchoServer runs a UDP server that echoes the packets it receives, and counts them.
+func startUDPEchoServer(t *testing.T) (string, *atomic.Int32) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	var received atomic.Int32
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			received.Add(1)
+			server.WriteTo(buf[:n], addr)
+		}
+	}()
+	return server.LocalAddr().String(), &received
+}
+
+func readWithTimeout(t *testing.T, conn net.Conn) string {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestPacketDialerRedundant(t *testing.T) {
+	addr, received := startUDPEchoServer(t)
+	d, err := NewPacketDialer(Redundant, &transport.UDPDialer{}, &transport.UDPDialer{})
+	require.NoError(t, err)
+	conn, err := d.DialPacket(context.Background(), addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", readWithTimeout(t, conn))
+	require.Eventually(t, func() bool { return received.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+	// The duplicate response is dropped.
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 1024))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestPacketDialerRoundRobin(t *testing.T) {
+	addr, received := startUDPEchoServer(t)
+	d, err := NewPacketDialer(RoundRobin, &transport.UDPDialer{}, &transport.UDPDialer{})
+	require.NoError(t, err)
+	conn, err := d.DialPacket(context.Background(), addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		_, err = conn.Write([]byte(msg))
+		require.NoError(t, err)
+		require.Equal(t, msg, readWithTimeout(t, conn))
+	}
+	require.Equal(t, int32(4), received.Load())
+	// Both paths got measured.
+	for _, rtt := range d.RTTs() {
+		require.NotZero(t, rtt)
+	}
+}
+
+func TestPacketDialerSkipsFailedPaths(t *testing.T) {
+	addr, _ := startUDPEchoServer(t)
+	failing := transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return nil, errors.New("no network")
+	})
+	d, err := NewPacketDialer(LowestRTT, failing, &transport.UDPDialer{})
+	require.NoError(t, err)
+	conn, err := d.DialPacket(context.Background(), addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", readWithTimeout(t, conn))
+
+	d, err = NewPacketDialer(LowestRTT, failing, failing)
+	require.NoError(t, err)
+	_, err = d.DialPacket(context.Background(), addr)
+	require.ErrorContains(t, err, "no network")
+}
+
+func TestPacketConnClose(t *testing.T) {
+	addr, _ := startUDPEchoServer(t)
+	d, err := NewPacketDialer(RoundRobin, &transport.UDPDialer{})
+	require.NoError(t, err)
+	conn, err := d.DialPacket(context.Background(), addr)
+	require.NoError(t, err)
+	readErr := make(chan error)
+	go func() {
+		_, err := conn.Read(make([]byte, 10))
+		readErr <- err
+	}()
+	require.NoError(t, conn.Close())
+	require.ErrorIs(t, <-readErr, net.ErrClosed)
+	require.ErrorIs(t, conn.Close(), net.ErrClosed)
+	_, err = conn.Write([]byte("hello"))
+	require.ErrorIs(t, err, net.ErrClosed)
+}
@@ -0,0 +1,327 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multipath
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// dedupWindow is how many recent datagrams are remembered to drop duplicates with the [Redundant] policy.
+const dedupWindow = 64
+
+// PacketDialer is a [transport.PacketDialer] that schedules each datagram on one of its paths.
+type PacketDialer struct {
+	*scheduler
+	dialers []transport.PacketDialer
+}
+
+var _ transport.PacketDialer = (*PacketDialer)(nil)
+
+// NewPacketDialer creates a [PacketDialer] that schedules the datagrams over the dialers with the policy.
+// The round-trip times are shared by all the connections of the dialer.
+func NewPacketDialer(policy Policy, dialers ...transport.PacketDialer) (*PacketDialer, error) {
+	for _, d := range dialers {
+		if d == nil {
+			return nil, errors.New("dialers must not be nil")
+		}
+	}
+	s, err := newScheduler(policy, len(dialers))
+	if err != nil {
+		return nil, err
+	}
+	return &PacketDialer{scheduler: s, dialers: dialers}, nil
+}
+
+// DialPacket implements [transport.PacketDialer]. It dials all the paths, and fails only if all of them fail.
+func (d *PacketDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	conns := make([]net.Conn, len(d.dialers))
+	errs := make([]error, len(d.dialers))
+	var wg sync.WaitGroup
+	for path, dialer := range d.dialers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conns[path], errs[path] = dialer.DialPacket(ctx, addr)
+			if errs[path] != nil {
+				errs[path] = fmt.Errorf("path %d failed: %w", path, errs[path])
+			}
+		}()
+	}
+	wg.Wait()
+	c := &packetConn{
+		scheduler: d.scheduler,
+		paths:     make([]*packetPath, len(conns)),
+		packets:   make(chan []byte),
+		done:      make(chan struct{}),
+		deadlineC: make(chan struct{}),
+	}
+	numPaths := 0
+	for path, conn := range conns {
+		if conn != nil {
+			c.paths[path] = &packetPath{index: path, conn: conn}
+			numPaths++
+		}
+	}
+	if numPaths == 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, p := range c.paths {
+		if p != nil {
+			go c.readLoop(p)
+		}
+	}
+	return c, nil
+}
+
+// packetPath is a connection of a multipath packet connection.
+type packetPath struct {
+	index int
+	conn  net.Conn
+
+	mu sync.Mutex
+	// sentAt is the time of the oldest datagram without a response, for the round-trip time.
+	sentAt time.Time
+}
+
+type packetConn struct {
+	*scheduler
+	// paths has nil entries for the paths that failed to dial.
+	paths   []*packetPath
+	packets chan []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+
+	mu sync.Mutex
+	// dedup holds the hashes of the recent datagrams, for the [Redundant] policy.
+	dedup      map[uint64]struct{}
+	dedupOrder []uint64
+	// readDeadline is the deadline of Read, and deadlineC is closed when it changes.
+	readDeadline time.Time
+	deadlineC    chan struct{}
+}
+
+var _ net.Conn = (*packetConn)(nil)
+
+func (c *packetConn) readLoop(p *packetPath) {
+	buf := make([]byte, 65536)
+	for {
+		n, err := p.conn.Read(buf)
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			// ICMP errors don't break the path.
+			continue
+		}
+		if err != nil {
+			// Stop reading from the broken path. The other paths keep working.
+			return
+		}
+		p.mu.Lock()
+		if !p.sentAt.IsZero() {
+			c.addSample(p.index, time.Since(p.sentAt))
+			p.sentAt = time.Time{}
+		}
+		p.mu.Unlock()
+		packet := append([]byte(nil), buf[:n]...)
+		if c.policy == Redundant && c.isDuplicate(packet) {
+			continue
+		}
+		select {
+		case c.packets <- packet:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// isDuplicate reports whether the packet was received recently on another path.
+func (c *packetConn) isDuplicate(packet []byte) bool {
+	h := fnv.New64a()
+	h.Write(packet)
+	sum := h.Sum64()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.dedup[sum]; ok {
+		return true
+	}
+	if c.dedup == nil {
+		c.dedup = make(map[uint64]struct{}, dedupWindow)
+	}
+	if len(c.dedupOrder) == dedupWindow {
+		delete(c.dedup, c.dedupOrder[0])
+		c.dedupOrder = c.dedupOrder[1:]
+	}
+	c.dedup[sum] = struct{}{}
+	c.dedupOrder = append(c.dedupOrder, sum)
+	return false
+}
+
+func (c *packetConn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		deadline, deadlineC := c.readDeadline, c.deadlineC
+		c.mu.Unlock()
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		n, err, done := 0, error(nil), true
+		select {
+		case packet := <-c.packets:
+			n = copy(b, packet)
+		case <-c.done:
+			err = net.ErrClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		case <-deadlineC:
+			// The deadline changed.
+			done = false
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if done {
+			return n, err
+		}
+	}
+}
+
+func (c *packetConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	if c.policy == Redundant {
+		var errs []error
+		for _, p := range c.paths {
+			if p == nil {
+				continue
+			}
+			if _, err := c.writePath(p, b); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) == c.numPaths() {
+			return 0, errors.Join(errs...)
+		}
+		return len(b), nil
+	}
+	var errs []error
+	for _, path := range c.order() {
+		p := c.paths[path]
+		if p == nil {
+			continue
+		}
+		n, err := c.writePath(p, b)
+		if err == nil {
+			return n, nil
+		}
+		errs = append(errs, err)
+	}
+	return 0, errors.Join(errs...)
+}
+
+func (c *packetConn) writePath(p *packetPath, b []byte) (int, error) {
+	p.mu.Lock()
+	if p.sentAt.IsZero() {
+		p.sentAt = time.Now()
+	}
+	p.mu.Unlock()
+	return p.conn.Write(b)
+}
+
+func (c *packetConn) numPaths() int {
+	n := 0
+	for _, p := range c.paths {
+		if p != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *packetConn) firstPath() *packetPath {
+	for _, p := range c.paths {
+		if p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+func (c *packetConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.done)
+		var errs []error
+		for _, p := range c.paths {
+			if p != nil {
+				errs = append(errs, p.conn.Close())
+			}
+		}
+		err = errors.Join(errs...)
+	})
+	return err
+}
+
+// LocalAddr returns the local address of the first path.
+func (c *packetConn) LocalAddr() net.Addr {
+	return c.firstPath().conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the first path.
+func (c *packetConn) RemoteAddr() net.Addr {
+	return c.firstPath().conn.RemoteAddr()
+}
+
+func (c *packetConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *packetConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	close(c.deadlineC)
+	c.deadlineC = make(chan struct{})
+	return nil
+}
+
+func (c *packetConn) SetWriteDeadline(t time.Time) error {
+	var errs []error
+	for _, p := range c.paths {
+		if p != nil {
+			errs = append(errs, p.conn.SetWriteDeadline(t))
+		}
+	}
+	return errors.Join(errs...)
+}
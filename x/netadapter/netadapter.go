@@ -0,0 +1,82 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package netadapter adapts the SDK transports to the interfaces of the Go standard library, so that code that uses
+[net.Dialer] or [http.Client] can use any [transport.StreamDialer] with one call:
+
+	client := netadapter.NewHTTPClient(dialer)
+	resp, err := client.Get("https://example.com/")
+
+The adapters pass host names to the dialer unresolved, so that proxies resolve them, and DNS doesn't leak outside
+the transport. Use [NewResolver] for lookups over the transport.
+
+Conversely, [FromDialContext], [FromProxyDialer] and [FromConnFactory] turn third-party dialers into SDK
+transports, so they can be part of SDK chains.
+
+For packets, [NewPacketConn] turns a [transport.PacketDialer] into a [net.PacketConn], and [NewBatchPacketConn]
+adds the batch methods that QUIC and WireGuard implementations use.
+*/
+package netadapter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// DialContextFunc is the signature of [net.Dialer.DialContext], as used by [http.Transport] and other libraries.
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewDialContext returns a [DialContextFunc] that dials TCP connections with the dialer. It fails for other networks.
+func NewDialContext(dialer transport.StreamDialer) DialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if !strings.HasPrefix(network, "tcp") {
+			return nil, fmt.Errorf("protocol not supported: %v", network)
+		}
+		return dialer.DialStream(ctx, addr)
+	}
+}
+
+// NewHTTPTransport returns an [http.Transport] that connects with the dialer. It has the settings of
+// [http.DefaultTransport], except that it doesn't use the proxy from the environment, since the dialer determines
+// the route, and it attempts HTTP/2 over TLS.
+func NewHTTPTransport(dialer transport.StreamDialer) *http.Transport {
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	httpTransport.Proxy = nil
+	httpTransport.DialContext = NewDialContext(dialer)
+	httpTransport.ForceAttemptHTTP2 = true
+	return httpTransport
+}
+
+// NewHTTPClient returns an [http.Client] that connects with the dialer, using [NewHTTPTransport].
+func NewHTTPClient(dialer transport.StreamDialer) *http.Client {
+	return &http.Client{Transport: NewHTTPTransport(dialer)}
+}
+
+// NewResolver returns a [net.Resolver] that sends the DNS queries over TCP to the DNS server at dnsAddress, such as
+// "8.8.8.8:53", with the dialer. Use it to resolve names without leaking the queries outside the transport.
+func NewResolver(dialer transport.StreamDialer, dnsAddress string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		// The resolver uses DNS over TCP with stream connections, regardless of the network.
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialStream(ctx, dnsAddress)
+		},
+	}
+}
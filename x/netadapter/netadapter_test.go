@@ -0,0 +1,138 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netadapter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// countingDialer counts the dials and sends them all to a fixed address.
+type countingDialer struct {
+	address string
+	dials   atomic.Int32
+}
+
+func (d *countingDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	d.dials.Add(1)
+	return (&transport.TCPDialer{}).DialStream(ctx, d.address)
+}
+
+func TestNewDialContext(t *testing.T) {
+	dialContext := NewDialContext(&transport.TCPDialer{})
+	_, err := dialContext(context.Background(), "udp", "127.0.0.1:53")
+	require.Error(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	conn, err := dialContext(context.Background(), "tcp4", listener.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestNewHTTPClient_HTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	dialer := &countingDialer{address: server.Listener.Addr().String()}
+	client := NewHTTPClient(dialer)
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	// The name is not resolved locally.
+	resp, err := client.Get("https://example.com/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/2.0", string(body))
+	require.Equal(t, int32(1), dialer.dials.Load())
+}
+
+// startTCPDNSServer runs a DNS-over-TCP server that answers all A queries with 192.0.2.1.
+func startTCPDNSServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var length uint16
+					if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+						return
+					}
+					query := make([]byte, length)
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					var request dnsmessage.Message
+					if err := request.Unpack(query); err != nil || len(request.Questions) == 0 {
+						return
+					}
+					response := dnsmessage.Message{
+						Header:    dnsmessage.Header{ID: request.ID, Response: true, RCode: dnsmessage.RCodeSuccess},
+						Questions: request.Questions,
+					}
+					if request.Questions[0].Type == dnsmessage.TypeA {
+						response.Answers = []dnsmessage.Resource{{
+							Header: dnsmessage.ResourceHeader{Name: request.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+							Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+						}}
+					}
+					packed, err := response.AppendPack(make([]byte, 2))
+					if err != nil {
+						return
+					}
+					binary.BigEndian.PutUint16(packed, uint16(len(packed)-2))
+					if _, err := conn.Write(packed); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestNewResolver(t *testing.T) {
+	dnsAddress := startTCPDNSServer(t)
+	dialer := &countingDialer{address: dnsAddress}
+	resolver := NewResolver(dialer, "ignored.example:53")
+	ips, err := resolver.LookupIP(context.Background(), "ip4", "example.com")
+	require.NoError(t, err)
+	require.Len(t, ips, 1)
+	require.Equal(t, "192.0.2.1", ips[0].String())
+	require.NotZero(t, dialer.dials.Load())
+}
@@ -0,0 +1,337 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netadapter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// maxPacketSize is the largest packet received by the [NewPacketConn] connections.
+const maxPacketSize = 64 * 1024
+
+// incomingQueueSize is the number of packets the [NewPacketConn] connections buffer before dropping packets.
+const incomingQueueSize = 128
+
+type packet struct {
+	payload []byte
+	addr    net.Addr
+}
+
+// packetConn is a [net.PacketConn] that sends the packets to each destination on its own connection from a
+// [transport.PacketDialer].
+type packetConn struct {
+	dialer    transport.PacketDialer
+	localAddr net.Addr
+	incoming  chan packet
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu            sync.Mutex
+	conns         map[string]net.Conn
+	readDeadline  time.Time
+	writeDeadline time.Time
+	// deadlineChanged is closed when the read deadline changes, to wake up the readers.
+	deadlineChanged chan struct{}
+}
+
+var _ net.PacketConn = (*packetConn)(nil)
+
+// NewPacketConn returns a [net.PacketConn] that sends the packets with the dialer, for libraries that need a
+// [net.PacketConn], such as QUIC implementations. It dials a connection for each destination on the first write,
+// and keeps it until the [net.PacketConn] is closed. Packets received from a destination are reported with the
+// address used to write to it. If the reader falls behind, incoming packets are dropped.
+func NewPacketConn(dialer transport.PacketDialer) (net.PacketConn, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	return &packetConn{
+		dialer:          dialer,
+		localAddr:       &net.UDPAddr{IP: net.IPv4zero},
+		incoming:        make(chan packet, incomingQueueSize),
+		done:            make(chan struct{}),
+		conns:           make(map[string]net.Conn),
+		deadlineChanged: make(chan struct{}),
+	}, nil
+}
+
+func (c *packetConn) connFor(addr net.Addr) (net.Conn, error) {
+	key := addr.String()
+	c.mu.Lock()
+	conn, ok := c.conns[key]
+	c.mu.Unlock()
+	if ok {
+		return conn, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	conn, err := c.dialer.DialPacket(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		conn.Close()
+		return nil, net.ErrClosed
+	default:
+	}
+	if existing, ok := c.conns[key]; ok {
+		// Another writer dialed first.
+		conn.Close()
+		return existing, nil
+	}
+	conn.SetWriteDeadline(c.writeDeadline)
+	c.conns[key] = conn
+	go c.readLoop(key, conn, addr)
+	return conn, nil
+}
+
+func (c *packetConn) readLoop(key string, conn net.Conn, addr net.Addr) {
+	defer func() {
+		c.mu.Lock()
+		if c.conns[key] == conn {
+			delete(c.conns, key)
+		}
+		c.mu.Unlock()
+		conn.Close()
+	}()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case c.incoming <- packet{payload: append([]byte(nil), buf[:n]...), addr: addr}:
+		case <-c.done:
+			return
+		default:
+			// Drop the packet, like a full socket buffer would.
+		}
+	}
+}
+
+// ReadFrom implements [net.PacketConn].ReadFrom.
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		select {
+		case <-c.done:
+			return 0, nil, net.ErrClosed
+		default:
+		}
+		c.mu.Lock()
+		deadline := c.readDeadline
+		deadlineChanged := c.deadlineChanged
+		c.mu.Unlock()
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case p := <-c.incoming:
+			stopTimer(timer)
+			return copy(b, p.payload), p.addr, nil
+		case <-c.done:
+			stopTimer(timer)
+			return 0, nil, net.ErrClosed
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-deadlineChanged:
+			stopTimer(timer)
+		}
+	}
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+// WriteTo implements [net.PacketConn].WriteTo.
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	conn, err := c.connFor(addr)
+	if err != nil {
+		return 0, err
+	}
+	return conn.Write(b)
+}
+
+// Close implements [net.PacketConn].Close. It closes all the connections.
+func (c *packetConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, conn := range c.conns {
+			conn.Close()
+		}
+	})
+	return nil
+}
+
+// LocalAddr implements [net.PacketConn].LocalAddr. It returns the unspecified address, since each destination has
+// its own connection.
+func (c *packetConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// SetDeadline implements [net.PacketConn].SetDeadline.
+func (c *packetConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements [net.PacketConn].SetReadDeadline.
+func (c *packetConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline implements [net.PacketConn].SetWriteDeadline.
+func (c *packetConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	for _, conn := range c.conns {
+		conn.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// BatchPacketConn is a [net.PacketConn] with the batch methods of [ipv4.PacketConn] and [ipv6.PacketConn], as used
+// by QUIC and WireGuard implementations to send and receive multiple packets per system call.
+type BatchPacketConn interface {
+	net.PacketConn
+	// ReadBatch reads at least one message. It returns the number of messages read.
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	// WriteBatch writes the messages. It returns the number of messages written.
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// NewBatchPacketConn returns conn as a [BatchPacketConn]. UDP sockets use the system batch calls where available.
+// Other connections read and write one message per call.
+func NewBatchPacketConn(conn net.PacketConn) BatchPacketConn {
+	if batchConn, ok := conn.(BatchPacketConn); ok {
+		return batchConn
+	}
+	if udpConn, ok := conn.(*net.UDPConn); ok {
+		if addr, ok := udpConn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+			return &ipv6BatchConn{PacketConn: conn, batch: ipv6.NewPacketConn(udpConn)}
+		}
+		return &ipv4BatchConn{PacketConn: conn, batch: ipv4.NewPacketConn(udpConn)}
+	}
+	return &singleBatchConn{PacketConn: conn}
+}
+
+type ipv4BatchConn struct {
+	net.PacketConn
+	batch *ipv4.PacketConn
+}
+
+func (c *ipv4BatchConn) ReadBatch(ms []ipv4.Message, flags int) (int, error) {
+	return c.batch.ReadBatch(ms, flags)
+}
+
+func (c *ipv4BatchConn) WriteBatch(ms []ipv4.Message, flags int) (int, error) {
+	return c.batch.WriteBatch(ms, flags)
+}
+
+type ipv6BatchConn struct {
+	net.PacketConn
+	batch *ipv6.PacketConn
+}
+
+func (c *ipv6BatchConn) ReadBatch(ms []ipv4.Message, flags int) (int, error) {
+	return c.batch.ReadBatch(ms, flags)
+}
+
+func (c *ipv6BatchConn) WriteBatch(ms []ipv4.Message, flags int) (int, error) {
+	return c.batch.WriteBatch(ms, flags)
+}
+
+// singleBatchConn implements the batch methods with one message per call.
+type singleBatchConn struct {
+	net.PacketConn
+}
+
+func (c *singleBatchConn) ReadBatch(ms []ipv4.Message, flags int) (int, error) {
+	if len(ms) == 0 {
+		return 0, nil
+	}
+	if len(ms[0].Buffers) == 0 {
+		return 0, errors.New("message has no buffers")
+	}
+	n, addr, err := c.ReadFrom(ms[0].Buffers[0])
+	if err != nil {
+		return 0, err
+	}
+	ms[0].N = n
+	ms[0].NN = 0
+	ms[0].Flags = 0
+	ms[0].Addr = addr
+	return 1, nil
+}
+
+func (c *singleBatchConn) WriteBatch(ms []ipv4.Message, flags int) (int, error) {
+	for i := range ms {
+		var payload []byte
+		if len(ms[i].Buffers) == 1 {
+			payload = ms[i].Buffers[0]
+		} else {
+			for _, buf := range ms[i].Buffers {
+				payload = append(payload, buf...)
+			}
+		}
+		n, err := c.WriteTo(payload, ms[i].Addr)
+		if err != nil {
+			return i, err
+		}
+		ms[i].N = n
+	}
+	return len(ms), nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netadapter
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
+)
+
+// startUDPEchoServer echoes each packet back with the given prefix.
+func startUDPEchoServer(t *testing.T, prefix string) *net.UDPAddr {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(append([]byte(prefix), buf[:n]...), addr)
+		}
+	}()
+	return pc.LocalAddr().(*net.UDPAddr)
+}
+
+func TestNewPacketConn(t *testing.T) {
+	addr1 := startUDPEchoServer(t, "one:")
+	addr2 := startUDPEchoServer(t, "two:")
+	pc, err := NewPacketConn(&transport.UDPDialer{})
+	require.NoError(t, err)
+	defer pc.Close()
+
+	for _, addr := range []*net.UDPAddr{addr1, addr2, addr1} {
+		_, err := pc.WriteTo([]byte("ping"), addr)
+		require.NoError(t, err)
+	}
+	require.NoError(t, pc.SetReadDeadline(time.Now().Add(5*time.Second)))
+	received := map[string]int{}
+	buf := make([]byte, 100)
+	for i := 0; i < 3; i++ {
+		n, addr, err := pc.ReadFrom(buf)
+		require.NoError(t, err)
+		received[addr.String()+" "+string(buf[:n])]++
+	}
+	require.Equal(t, map[string]int{
+		addr1.String() + " one:ping": 2,
+		addr2.String() + " two:ping": 1,
+	}, received)
+
+	require.NoError(t, pc.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, _, err = pc.ReadFrom(buf)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	require.NoError(t, pc.Close())
+	_, _, err = pc.ReadFrom(buf)
+	require.ErrorIs(t, err, net.ErrClosed)
+	_, err = pc.WriteTo(buf, addr1)
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestNewPacketConn_DeadlineChange(t *testing.T) {
+	pc, err := NewPacketConn(&transport.UDPDialer{})
+	require.NoError(t, err)
+	defer pc.Close()
+	readErr := make(chan error, 1)
+	go func() {
+		_, _, err := pc.ReadFrom(make([]byte, 10))
+		readErr <- err
+	}()
+	// A blocked read gets the new deadline.
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, pc.SetReadDeadline(time.Now()))
+	select {
+	case err := <-readErr:
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read didn't return after the deadline change")
+	}
+}
+
+func testBatch(t *testing.T, conn BatchPacketConn, addr net.Addr) {
+	messages := []ipv4.Message{
+		{Buffers: [][]byte{[]byte("a")}, Addr: addr},
+		{Buffers: [][]byte{[]byte("b"), []byte("c")}, Addr: addr},
+	}
+	n, err := conn.WriteBatch(messages, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var received []string
+	for len(received) < 2 {
+		messages := []ipv4.Message{{Buffers: [][]byte{make([]byte, 100)}}, {Buffers: [][]byte{make([]byte, 100)}}}
+		n, err := conn.ReadBatch(messages, 0)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, n, 1)
+		for _, m := range messages[:n] {
+			require.Equal(t, addr.String(), m.Addr.String())
+			received = append(received, string(m.Buffers[0][:m.N]))
+		}
+	}
+	require.Equal(t, []string{"x:a", "x:bc"}, received)
+}
+
+func TestNewBatchPacketConn_UDP(t *testing.T) {
+	addr := startUDPEchoServer(t, "x:")
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+	conn := NewBatchPacketConn(pc)
+	require.IsType(t, &ipv4BatchConn{}, conn)
+	testBatch(t, conn, addr)
+}
+
+func TestNewBatchPacketConn_Fallback(t *testing.T) {
+	addr := startUDPEchoServer(t, "x:")
+	pc, err := NewPacketConn(&transport.UDPDialer{})
+	require.NoError(t, err)
+	defer pc.Close()
+	conn := NewBatchPacketConn(pc)
+	require.IsType(t, &singleBatchConn{}, conn)
+	testBatch(t, conn, addr)
+}
@@ -0,0 +1,117 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netadapter
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"golang.org/x/net/proxy"
+)
+
+// FromDialContext returns a [transport.StreamDialer] that dials TCP connections with dialContext, such as
+// [net.Dialer.DialContext] or the dial function of a third-party library, so that it can be part of SDK chains.
+func FromDialContext(dialContext DialContextFunc) (transport.StreamDialer, error) {
+	if dialContext == nil {
+		return nil, errors.New("argument dialContext must not be nil")
+	}
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		conn, err := dialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return ToStreamConn(conn), nil
+	}), nil
+}
+
+// FromProxyDialer returns a [transport.StreamDialer] that dials TCP connections with a [proxy.Dialer]. It uses
+// the context if the dialer implements [proxy.ContextDialer]. Otherwise, the dial is abandoned, but not stopped,
+// when the context is done.
+func FromProxyDialer(dialer proxy.Dialer) (transport.StreamDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+		return FromDialContext(contextDialer.DialContext)
+	}
+	return FromDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		type dialResult struct {
+			conn net.Conn
+			err  error
+		}
+		resultCh := make(chan dialResult, 1)
+		go func() {
+			conn, err := dialer.Dial(network, addr)
+			resultCh <- dialResult{conn, err}
+		}()
+		select {
+		case result := <-resultCh:
+			return result.conn, result.err
+		case <-ctx.Done():
+			go func() {
+				if result := <-resultCh; result.conn != nil {
+					result.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	})
+}
+
+// FromConnFactory returns a [transport.StreamEndpoint] that connects with newConn, for connections that are not
+// dialed by address, such as in-memory pipes or connections from a third-party tunnel.
+func FromConnFactory(newConn func(ctx context.Context) (net.Conn, error)) (transport.StreamEndpoint, error) {
+	if newConn == nil {
+		return nil, errors.New("argument newConn must not be nil")
+	}
+	return transport.FuncStreamEndpoint(func(ctx context.Context) (transport.StreamConn, error) {
+		conn, err := newConn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return ToStreamConn(conn), nil
+	}), nil
+}
+
+// ToStreamConn returns conn as a [transport.StreamConn]. If conn doesn't support CloseRead or CloseWrite, they
+// return [errors.ErrUnsupported].
+func ToStreamConn(conn net.Conn) transport.StreamConn {
+	if streamConn, ok := conn.(transport.StreamConn); ok {
+		return streamConn
+	}
+	return &streamConn{Conn: conn}
+}
+
+type streamConn struct {
+	net.Conn
+}
+
+var _ transport.StreamConn = (*streamConn)(nil)
+
+func (c *streamConn) CloseRead() error {
+	if cr, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+func (c *streamConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
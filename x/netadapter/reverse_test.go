@@ -0,0 +1,115 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netadapter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/proxy"
+)
+
+func startEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestFromDialContext(t *testing.T) {
+	address := startEchoServer(t)
+	dialer, err := FromDialContext((&net.Dialer{}).DialContext)
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), address)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	// TCP connections support half-close.
+	require.NoError(t, conn.CloseWrite())
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	_, err = FromDialContext(nil)
+	require.Error(t, err)
+}
+
+// blockingProxyDialer is a [proxy.Dialer] without context support that blocks until released.
+type blockingProxyDialer struct {
+	release chan struct{}
+}
+
+func (d *blockingProxyDialer) Dial(network, addr string) (net.Conn, error) {
+	<-d.release
+	return nil, errors.New("released")
+}
+
+func TestFromProxyDialer(t *testing.T) {
+	address := startEchoServer(t)
+	dialer, err := FromProxyDialer(proxy.Direct)
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), address)
+	require.NoError(t, err)
+	conn.Close()
+
+	blocking := &blockingProxyDialer{release: make(chan struct{})}
+	defer close(blocking.release)
+	dialer, err = FromProxyDialer(blocking)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = dialer.DialStream(ctx, address)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFromConnFactory(t *testing.T) {
+	var server net.Conn
+	endpoint, err := FromConnFactory(func(ctx context.Context) (net.Conn, error) {
+		var client net.Conn
+		client, server = net.Pipe()
+		return client, nil
+	})
+	require.NoError(t, err)
+	conn, err := endpoint.ConnectStream(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	defer server.Close()
+	// Pipes don't support half-close.
+	require.ErrorIs(t, conn.CloseWrite(), errors.ErrUnsupported)
+	require.ErrorIs(t, conn.CloseRead(), errors.ErrUnsupported)
+	go conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(server, buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf))
+}
@@ -0,0 +1,57 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package npipe connects to Windows named pipes, like the ones local proxies and helper daemons listen on, such as
+// `\\.\pipe\proxy`. Named pipes can only be reached by local processes, and are protected by Windows access control.
+//
+// Named pipes don't support half-close, so the CloseRead and CloseWrite methods of the connections return
+// [errors.ErrUnsupported]. Deadlines are applied to the reads and writes that start after they are set.
+//
+// Named pipes are only supported on Windows. On other platforms, [Dial] returns an error.
+package npipe
+
+import (
+	"context"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// Endpoint is a [transport.StreamEndpoint] that connects to the named pipe at Path.
+type Endpoint struct {
+	// Path is the path of the pipe, like `\\.\pipe\proxy`.
+	Path string
+}
+
+var _ transport.StreamEndpoint = (*Endpoint)(nil)
+
+// ConnectStream implements [transport.StreamEndpoint].ConnectStream.
+func (e *Endpoint) ConnectStream(ctx context.Context) (transport.StreamConn, error) {
+	return Dial(ctx, e.Path)
+}
+
+// Addr is the address of a named pipe.
+type Addr string
+
+var _ net.Addr = Addr("")
+
+// Network returns "pipe".
+func (a Addr) Network() string {
+	return "pipe"
+}
+
+// String returns the path of the pipe.
+func (a Addr) String() string {
+	return string(a)
+}
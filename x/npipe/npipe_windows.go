@@ -0,0 +1,210 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package npipe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"golang.org/x/sys/windows"
+)
+
+// busyRetryInterval is the time between attempts to connect to a busy pipe.
+const busyRetryInterval = 10 * time.Millisecond
+
+// Dial connects to the named pipe at path. If all the instances of the pipe are busy, it retries until ctx is done.
+func Dial(ctx context.Context, path string) (transport.StreamConn, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		handle, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+			windows.OPEN_EXISTING, windows.FILE_FLAG_OVERLAPPED, 0)
+		if err == nil {
+			return &pipeConn{handle: handle, addr: Addr(path)}, nil
+		}
+		if !errors.Is(err, windows.ERROR_PIPE_BUSY) {
+			return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: Addr(path), Err: os.NewSyscallError("CreateFile", err)}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: Addr(path), Err: ctx.Err()}
+		case <-time.After(busyRetryInterval):
+		}
+	}
+}
+
+// pipeConn is a connection to a named pipe, opened for overlapped I/O so that the reads and writes can be
+// cancelled by Close and by the deadlines.
+type pipeConn struct {
+	handle windows.Handle
+	addr   Addr
+
+	// mu protects ops, the number of operations in progress, and closed. The handle is only closed after the
+	// operations return.
+	mu     sync.Mutex
+	ops    int
+	closed bool
+
+	readDeadline  atomic.Pointer[time.Time]
+	writeDeadline atomic.Pointer[time.Time]
+}
+
+var _ transport.StreamConn = (*pipeConn)(nil)
+
+// do runs an overlapped operation, waiting for it to complete, for the connection to be closed, or for the deadline.
+func (c *pipeConn) do(op string, deadline *atomic.Pointer[time.Time], start func(*windows.Overlapped, *uint32) error) (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, c.opError(op, net.ErrClosed)
+	}
+	c.ops++
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.ops--
+		c.mu.Unlock()
+	}()
+	timeout := uint32(windows.INFINITE)
+	if d := deadline.Load(); d != nil && !d.IsZero() {
+		remaining := time.Until(*d)
+		if remaining <= 0 {
+			return 0, c.opError(op, os.ErrDeadlineExceeded)
+		}
+		timeout = uint32(min(remaining.Milliseconds()+1, math.MaxUint32-1))
+	}
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, c.opError(op, os.NewSyscallError("CreateEvent", err))
+	}
+	defer windows.CloseHandle(event)
+	overlapped := windows.Overlapped{HEvent: event}
+	var n uint32
+	err = start(&overlapped, &n)
+	timedOut := false
+	if errors.Is(err, windows.ERROR_IO_PENDING) {
+		if result, _ := windows.WaitForSingleObject(event, timeout); result == uint32(windows.WAIT_TIMEOUT) {
+			timedOut = true
+			windows.CancelIoEx(c.handle, &overlapped)
+		}
+		err = windows.GetOverlappedResult(c.handle, &overlapped, &n, true)
+	}
+	switch {
+	case err == nil:
+		return int(n), nil
+	case errors.Is(err, windows.ERROR_BROKEN_PIPE) || errors.Is(err, windows.ERROR_PIPE_NOT_CONNECTED):
+		if op == "read" {
+			return int(n), io.EOF
+		}
+		return int(n), c.opError(op, err)
+	case errors.Is(err, windows.ERROR_OPERATION_ABORTED):
+		if timedOut {
+			return int(n), c.opError(op, os.ErrDeadlineExceeded)
+		}
+		return int(n), c.opError(op, net.ErrClosed)
+	default:
+		return int(n), c.opError(op, os.NewSyscallError(op, err))
+	}
+}
+
+func (c *pipeConn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "pipe", Addr: c.addr, Err: err}
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	return c.do("read", &c.readDeadline, func(overlapped *windows.Overlapped, n *uint32) error {
+		return windows.ReadFile(c.handle, b, n, overlapped)
+	})
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := c.do("write", &c.writeDeadline, func(overlapped *windows.Overlapped, n *uint32) error {
+			return windows.WriteFile(c.handle, b[written:], n, overlapped)
+		})
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Close cancels the operations in progress and closes the pipe.
+func (c *pipeConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	c.closed = true
+	// Keep cancelling, since operations that were starting may not have been pending at the first cancellation.
+	for c.ops > 0 {
+		c.mu.Unlock()
+		windows.CancelIoEx(c.handle, nil)
+		time.Sleep(time.Millisecond)
+		c.mu.Lock()
+	}
+	c.mu.Unlock()
+	return windows.CloseHandle(c.handle)
+}
+
+// CloseRead returns [errors.ErrUnsupported], since pipes don't support half-close.
+func (c *pipeConn) CloseRead() error {
+	return errors.ErrUnsupported
+}
+
+// CloseWrite returns [errors.ErrUnsupported], since pipes don't support half-close.
+func (c *pipeConn) CloseWrite() error {
+	return errors.ErrUnsupported
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.readDeadline.Store(&t)
+	c.writeDeadline.Store(&t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Store(&t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Store(&t)
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package npipe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
+)
+
+// startEchoPipe creates a pipe that echoes the data of one client.
+func startEchoPipe(t *testing.T) string {
+	path := fmt.Sprintf(`\\.\pipe\outline-sdk-test-%d`, time.Now().UnixNano())
+	name, err := windows.UTF16PtrFromString(path)
+	require.NoError(t, err)
+	handle, err := windows.CreateNamedPipe(name, windows.PIPE_ACCESS_DUPLEX, windows.PIPE_TYPE_BYTE|windows.PIPE_WAIT, 1, 4096, 4096, 0, nil)
+	require.NoError(t, err)
+	server := os.NewFile(uintptr(handle), path)
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		if err := windows.ConnectNamedPipe(handle, nil); err != nil && !errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
+			return
+		}
+		io.Copy(server, server)
+	}()
+	return path
+}
+
+func TestDial_Echo(t *testing.T) {
+	path := startEchoPipe(t)
+	conn, err := (&Endpoint{Path: path}).ConnectStream(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "pipe", conn.RemoteAddr().Network())
+	require.Equal(t, path, conn.RemoteAddr().String())
+
+	_, err = conn.Write([]byte("Request"))
+	require.NoError(t, err)
+	response := make([]byte, 7)
+	_, err = io.ReadFull(conn, response)
+	require.NoError(t, err)
+	require.Equal(t, "Request", string(response))
+	require.ErrorIs(t, conn.CloseWrite(), errors.ErrUnsupported)
+}
+
+func TestDial_NotFound(t *testing.T) {
+	_, err := Dial(context.Background(), `\\.\pipe\outline-sdk-test-missing`)
+	require.ErrorIs(t, err, windows.ERROR_FILE_NOT_FOUND)
+}
+
+func TestConn_ReadDeadline(t *testing.T) {
+	conn, err := Dial(context.Background(), startEchoPipe(t))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 10))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestConn_CloseUnblocksRead(t *testing.T) {
+	conn, err := Dial(context.Background(), startEchoPipe(t))
+	require.NoError(t, err)
+	time.AfterFunc(50*time.Millisecond, func() { conn.Close() })
+	_, err = conn.Read(make([]byte, 10))
+	require.ErrorIs(t, err, net.ErrClosed)
+	require.ErrorIs(t, conn.Close(), net.ErrClosed)
+}
@@ -0,0 +1,276 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package outbound provides dialers that apply the outbound address policies of proxy servers, such as a SOCKS5
+server, running on multi-homed hosts: which IP family to prefer for the targets, and which source address or
+network interface to use for each request.
+
+Server handlers pass the [Dialer] to relay the client requests, attaching the client address to the context, so
+the policy can depend on the client:
+
+	dialer := &outbound.Dialer{
+		IPPreference: outbound.PreferIPv6,
+		Bind: func(ctx context.Context, req *outbound.Request) (outbound.Binding, error) {
+			if req.ClientAddr != nil && strings.HasPrefix(req.ClientAddr.String(), "10.1.") {
+				return outbound.Binding{Interface: "eth1"}, nil
+			}
+			return outbound.Binding{}, nil
+		},
+	}
+	target, err := dialer.DialStream(outbound.WithClientAddr(ctx, clientConn.RemoteAddr()), "example.com:443")
+*/
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// IPPreference selects the IP families of the target addresses, and the order in which they are tried.
+type IPPreference int
+
+const (
+	// PreferSystem tries the addresses in the order returned by the resolver.
+	PreferSystem IPPreference = iota
+	// PreferIPv4 tries the IPv4 addresses first.
+	PreferIPv4
+	// PreferIPv6 tries the IPv6 addresses first.
+	PreferIPv6
+	// IPv4Only only uses IPv4 addresses.
+	IPv4Only
+	// IPv6Only only uses IPv6 addresses.
+	IPv6Only
+)
+
+// String returns the name of the preference.
+func (p IPPreference) String() string {
+	switch p {
+	case PreferSystem:
+		return "PreferSystem"
+	case PreferIPv4:
+		return "PreferIPv4"
+	case PreferIPv6:
+		return "PreferIPv6"
+	case IPv4Only:
+		return "IPv4Only"
+	case IPv6Only:
+		return "IPv6Only"
+	default:
+		return fmt.Sprintf("IPPreference(%d)", int(p))
+	}
+}
+
+// ErrNoAddress is returned when the policy leaves no address to connect to.
+var ErrNoAddress = errors.New("no target address allowed by the policy")
+
+// Request describes an outbound connection attempt, for the [Dialer.Bind] and [Dialer.Preference] callbacks.
+type Request struct {
+	// Network is "tcp" or "udp".
+	Network string
+	// Address is the host:port requested by the client.
+	Address string
+	// Target is the resolved target address being tried. It's invalid in [Dialer.Preference].
+	Target netip.AddrPort
+	// ClientAddr is the client address attached with [WithClientAddr], or nil.
+	ClientAddr net.Addr
+}
+
+// Binding is where to bind the outbound socket. The zero value lets the system choose.
+type Binding struct {
+	// Addr is the source IP address. It must be of the same family as the target.
+	Addr netip.Addr
+	// Interface is the name of the network interface whose address of the target family is used as the source,
+	// if Addr is not set.
+	Interface string
+}
+
+type clientAddrKey struct{}
+
+// WithClientAddr returns a context that carries the client address of the request, for the policy callbacks.
+func WithClientAddr(ctx context.Context, clientAddr net.Addr) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, clientAddr)
+}
+
+// ClientAddrFromContext returns the client address attached with [WithClientAddr], or nil.
+func ClientAddrFromContext(ctx context.Context) net.Addr {
+	clientAddr, _ := ctx.Value(clientAddrKey{}).(net.Addr)
+	return clientAddr
+}
+
+// Dialer is a [transport.StreamDialer] and [transport.PacketDialer] that connects to the targets directly, applying
+// the outbound address policies. Target host names are resolved, and the addresses allowed by the preference are
+// tried in order until one connects.
+type Dialer struct {
+	// IPPreference is the default IP family preference.
+	IPPreference IPPreference
+	// Preference, if not nil, overrides IPPreference for each request.
+	Preference func(ctx context.Context, req *Request) IPPreference
+	// Bind, if not nil, returns the source binding for each target address tried. Returning an error skips the
+	// address.
+	Bind func(ctx context.Context, req *Request) (Binding, error)
+	// Resolver resolves the target host names. If nil, [net.DefaultResolver] is used.
+	Resolver *net.Resolver
+	// Dialer is the base dialer. Its LocalAddr is replaced by the binding.
+	Dialer net.Dialer
+}
+
+var _ transport.StreamDialer = (*Dialer)(nil)
+var _ transport.PacketDialer = (*Dialer)(nil)
+
+// DialStream implements [transport.StreamDialer].
+func (d *Dialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	conn, err := d.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+// DialPacket implements [transport.PacketDialer].
+func (d *Dialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	return d.dial(ctx, "udp", addr)
+}
+
+func (d *Dialer) dial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	req := &Request{Network: network, Address: addr, ClientAddr: ClientAddrFromContext(ctx)}
+	targets, err := d.targets(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, target := range targets {
+		req.Target = target
+		conn, err := d.dialTarget(ctx, req)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// targets resolves the address and returns the target addresses allowed by the preference, in order.
+func (d *Dialer) targets(ctx context.Context, req *Request) ([]netip.AddrPort, error) {
+	host, portStr, err := net.SplitHostPort(req.Address)
+	if err != nil {
+		return nil, err
+	}
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	port, err := resolver.LookupPort(ctx, req.Network, portStr)
+	if err != nil {
+		return nil, err
+	}
+	var ips []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = []netip.Addr{ip}
+	} else if ips, err = resolver.LookupNetIP(ctx, "ip", host); err != nil {
+		return nil, err
+	}
+
+	preference := d.IPPreference
+	if d.Preference != nil {
+		preference = d.Preference(ctx, req)
+	}
+	targets := orderTargets(ips, uint16(port), preference)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrNoAddress, req.Address)
+	}
+	return targets, nil
+}
+
+// orderTargets returns the addresses allowed by the preference, in the order they should be tried.
+func orderTargets(ips []netip.Addr, port uint16, preference IPPreference) []netip.AddrPort {
+	targets := make([]netip.AddrPort, 0, len(ips))
+	for _, ip := range ips {
+		ip = ip.Unmap()
+		if (preference == IPv4Only && !ip.Is4()) || (preference == IPv6Only && !ip.Is6()) {
+			continue
+		}
+		targets = append(targets, netip.AddrPortFrom(ip, port))
+	}
+	switch preference {
+	case PreferIPv4:
+		sort.SliceStable(targets, func(i, j int) bool { return targets[i].Addr().Is4() && !targets[j].Addr().Is4() })
+	case PreferIPv6:
+		sort.SliceStable(targets, func(i, j int) bool { return targets[i].Addr().Is6() && !targets[j].Addr().Is6() })
+	}
+	return targets
+}
+
+// dialTarget connects to req.Target from the source address of the binding.
+func (d *Dialer) dialTarget(ctx context.Context, req *Request) (net.Conn, error) {
+	dialer := d.Dialer
+	dialer.LocalAddr = nil
+	if d.Bind != nil {
+		binding, err := d.Bind(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to bind for %v: %w", req.Target, err)
+		}
+		source, err := bindingAddr(binding, req.Target.Addr().Is4())
+		if err != nil {
+			return nil, err
+		}
+		if source.IsValid() {
+			if source.Is4() != req.Target.Addr().Is4() {
+				return nil, fmt.Errorf("source address %v does not match the family of %v", source, req.Target)
+			}
+			if req.Network == "tcp" {
+				dialer.LocalAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(source, 0))
+			} else {
+				dialer.LocalAddr = net.UDPAddrFromAddrPort(netip.AddrPortFrom(source, 0))
+			}
+		}
+	}
+	return dialer.DialContext(ctx, req.Network, req.Target.String())
+}
+
+// bindingAddr returns the source address of the binding for the IP family, or the zero address if unset.
+func bindingAddr(binding Binding, is4 bool) (netip.Addr, error) {
+	if binding.Addr.IsValid() || binding.Interface == "" {
+		return binding.Addr.Unmap(), nil
+	}
+	iface, err := net.InterfaceByName(binding.Interface)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	for _, addr := range addrs {
+		prefix, err := netip.ParsePrefix(addr.String())
+		if err != nil {
+			continue
+		}
+		ip := prefix.Addr().Unmap()
+		// Link-local IPv6 addresses need a zone and can't reach global targets.
+		if ip.Is4() == is4 && !ip.IsLinkLocalUnicast() {
+			return ip, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("interface %v has no usable address of the target family", binding.Interface)
+}
@@ -0,0 +1,195 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbound
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderTargets(t *testing.T) {
+	v4a := netip.MustParseAddr("192.0.2.1")
+	v6 := netip.MustParseAddr("2001:db8::1")
+	v4b := netip.MustParseAddr("::ffff:192.0.2.2")
+	ips := []netip.Addr{v4a, v6, v4b}
+	addrs := func(targets []netip.AddrPort) []string {
+		var result []string
+		for _, target := range targets {
+			result = append(result, target.String())
+		}
+		return result
+	}
+	require.Equal(t, []string{"192.0.2.1:53", "[2001:db8::1]:53", "192.0.2.2:53"}, addrs(orderTargets(ips, 53, PreferSystem)))
+	require.Equal(t, []string{"192.0.2.1:53", "192.0.2.2:53", "[2001:db8::1]:53"}, addrs(orderTargets(ips, 53, PreferIPv4)))
+	require.Equal(t, []string{"[2001:db8::1]:53", "192.0.2.1:53", "192.0.2.2:53"}, addrs(orderTargets(ips, 53, PreferIPv6)))
+	require.Equal(t, []string{"192.0.2.1:53", "192.0.2.2:53"}, addrs(orderTargets(ips, 53, IPv4Only)))
+	require.Equal(t, []string{"[2001:db8::1]:53"}, addrs(orderTargets(ips, 53, IPv6Only)))
+}
+
+func startEchoServer(t *testing.T, address string) string {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("can't listen on %v: %v", address, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// Echo the client address back.
+			conn.Write([]byte(conn.RemoteAddr().String()))
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDialer_DialStreamBind(t *testing.T) {
+	serverAddr := startEchoServer(t, "127.0.0.1:0")
+	clientAddr := &net.TCPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 4567}
+	var bindRequest *Request
+	dialer := &Dialer{
+		Bind: func(ctx context.Context, req *Request) (Binding, error) {
+			bindRequest = req
+			return Binding{Addr: netip.MustParseAddr("127.0.0.2")}, nil
+		},
+	}
+	conn, err := dialer.DialStream(WithClientAddr(context.Background(), clientAddr), serverAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+	seen, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	host, _, err := net.SplitHostPort(string(seen))
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.2", host)
+
+	require.Equal(t, "tcp", bindRequest.Network)
+	require.Equal(t, serverAddr, bindRequest.Address)
+	require.Equal(t, serverAddr, bindRequest.Target.String())
+	require.Equal(t, clientAddr, bindRequest.ClientAddr)
+}
+
+func TestDialer_DialStreamInterface(t *testing.T) {
+	loopback, err := loopbackInterface()
+	if err != nil {
+		t.Skip(err)
+	}
+	serverAddr := startEchoServer(t, "127.0.0.1:0")
+	dialer := &Dialer{
+		Bind: func(ctx context.Context, req *Request) (Binding, error) {
+			return Binding{Interface: loopback}, nil
+		},
+	}
+	conn, err := dialer.DialStream(context.Background(), serverAddr)
+	require.NoError(t, err)
+	conn.Close()
+
+	dialer.Bind = func(ctx context.Context, req *Request) (Binding, error) {
+		return Binding{Interface: "no-such-interface"}, nil
+	}
+	_, err = dialer.DialStream(context.Background(), serverAddr)
+	require.Error(t, err)
+}
+
+func loopbackInterface() (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface.Name, nil
+		}
+	}
+	return "", errors.New("no loopback interface")
+}
+
+func TestDialer_BindError(t *testing.T) {
+	serverAddr := startEchoServer(t, "127.0.0.1:0")
+	bindErr := errors.New("not allowed")
+	dialer := &Dialer{
+		Bind: func(ctx context.Context, req *Request) (Binding, error) {
+			return Binding{}, bindErr
+		},
+	}
+	_, err := dialer.DialStream(context.Background(), serverAddr)
+	require.ErrorIs(t, err, bindErr)
+}
+
+func TestDialer_FamilyMismatch(t *testing.T) {
+	serverAddr := startEchoServer(t, "127.0.0.1:0")
+	dialer := &Dialer{
+		Bind: func(ctx context.Context, req *Request) (Binding, error) {
+			return Binding{Addr: netip.IPv6Loopback()}, nil
+		},
+	}
+	_, err := dialer.DialStream(context.Background(), serverAddr)
+	require.ErrorContains(t, err, "does not match the family")
+}
+
+func TestDialer_Preference(t *testing.T) {
+	serverAddr := startEchoServer(t, "127.0.0.1:0")
+	var seenRequest *Request
+	dialer := &Dialer{
+		Preference: func(ctx context.Context, req *Request) IPPreference {
+			seenRequest = req
+			return IPv6Only
+		},
+	}
+	_, err := dialer.DialStream(context.Background(), serverAddr)
+	require.ErrorIs(t, err, ErrNoAddress)
+	require.False(t, seenRequest.Target.IsValid())
+
+	dialer.Preference = nil
+	dialer.IPPreference = IPv4Only
+	conn, err := dialer.DialStream(context.Background(), serverAddr)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestDialer_DialPacket(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+	dialer := &Dialer{
+		Bind: func(ctx context.Context, req *Request) (Binding, error) {
+			require.Equal(t, "udp", req.Network)
+			return Binding{Addr: netip.MustParseAddr("127.0.0.3")}, nil
+		},
+	}
+	conn, err := dialer.DialPacket(context.Background(), server.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 10)
+	n, from, err := server.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf[:n]))
+	require.Equal(t, "127.0.0.3", from.(*net.UDPAddr).IP.String())
+}
+
+func TestIPPreference_String(t *testing.T) {
+	require.Equal(t, "PreferIPv6", PreferIPv6.String())
+	require.Equal(t, "IPPreference(9)", IPPreference(9).String())
+}
@@ -0,0 +1,289 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outlinekey parses, validates and serializes Outline access keys.
+//
+// Static access keys are Shadowsocks URLs in the [SIP002] format, or in the legacy format where the
+// whole key is Base64-encoded:
+//
+//	ss://[BASE64(CIPHER:SECRET)]@[HOST]:[PORT]/?prefix=[PREFIX]&plugin=[PLUGIN]#[NAME]
+//	ss://[BASE64(CIPHER:SECRET@HOST:PORT)]#[NAME]
+//
+// Dynamic access keys point to a location serving the key over HTTPS, and use the ssconf scheme:
+//
+//	ssconf://[HOST]/[PATH]#[NAME]
+//
+// Keys can be wrapped in outline:// links with [Link], and shared as QR codes with [QRCode]:
+//
+//	outline://[ESCAPED KEY]
+//
+// [SIP002]: https://shadowsocks.org/doc/sip002.html
+package outlinekey
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks"
+	"github.com/Jigsaw-Code/outline-sdk/x/internal/ssurl"
+	"github.com/Jigsaw-Code/outline-sdk/x/qrcode"
+)
+
+// ErrInvalidKey is returned, wrapped, when an access key is malformed.
+var ErrInvalidKey = errors.New("invalid access key")
+
+func invalidKeyError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidKey, fmt.Sprintf(format, args...))
+}
+
+// StaticKey is a static access key with the Shadowsocks parameters to connect to a server.
+type StaticKey struct {
+	// Host is the host name or IP address of the server, without brackets.
+	Host string
+	// Port is the port of the server.
+	Port uint16
+	// Cipher is the Shadowsocks cipher name, such as "chacha20-ietf-poly1305".
+	Cipher string
+	// Secret is the Shadowsocks password.
+	Secret string
+	// Prefix is the optional prefix to use in the salt of connections.
+	Prefix []byte
+	// Plugin is the optional SIP003 plugin specification.
+	Plugin string
+	// Name is the optional human-readable name of the key.
+	Name string
+}
+
+// Address returns the host:port address of the server.
+func (k *StaticKey) Address() string {
+	return net.JoinHostPort(k.Host, strconv.Itoa(int(k.Port)))
+}
+
+// Validate checks that the key has all the fields needed to connect and that the cipher is supported.
+func (k *StaticKey) Validate() error {
+	if k.Host == "" {
+		return invalidKeyError("host must not be empty")
+	}
+	if k.Port == 0 {
+		return invalidKeyError("port must not be zero")
+	}
+	if k.Secret == "" {
+		return invalidKeyError("secret must not be empty")
+	}
+	if _, err := shadowsocks.NewEncryptionKey(k.Cipher, k.Secret); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+	return nil
+}
+
+// EncryptionKey returns the Shadowsocks encryption key for the key's cipher and secret.
+func (k *StaticKey) EncryptionKey() (*shadowsocks.EncryptionKey, error) {
+	return shadowsocks.NewEncryptionKey(k.Cipher, k.Secret)
+}
+
+// String serializes the key in the SIP002 format, with the user info Base64URL-encoded.
+func (k *StaticKey) String() string {
+	userInfo := base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(k.Cipher + ":" + k.Secret))
+	keyURL := url.URL{
+		Scheme:   "ss",
+		User:     url.User(userInfo),
+		Host:     k.Address(),
+		Fragment: k.Name,
+	}
+	query := url.Values{}
+	if len(k.Prefix) > 0 {
+		query.Set("prefix", ssurl.FormatPrefix(k.Prefix))
+	}
+	if k.Plugin != "" {
+		query.Set("plugin", k.Plugin)
+	}
+	if len(query) > 0 {
+		keyURL.Path = "/"
+		keyURL.RawQuery = query.Encode()
+	}
+	return keyURL.String()
+}
+
+// LegacyString serializes the key in the legacy format, where the cipher, secret and address are Base64-encoded together,
+// for clients that don't support SIP002. The legacy format has no place for the prefix and plugin, so they are
+// not included.
+func (k *StaticKey) LegacyString() string {
+	keyURL := url.URL{
+		Scheme:   "ss",
+		Host:     base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(k.Cipher + ":" + k.Secret + "@" + k.Address())),
+		Fragment: k.Name,
+	}
+	return keyURL.String()
+}
+
+// GenerateStaticKey creates a key for the server at host:port with the given cipher and a random secret.
+func GenerateStaticKey(host string, port uint16, cipher string) (*StaticKey, error) {
+	var secretBytes [16]byte
+	if _, err := rand.Read(secretBytes[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	key := &StaticKey{
+		Host:   host,
+		Port:   port,
+		Cipher: cipher,
+		Secret: base64.RawURLEncoding.EncodeToString(secretBytes[:]),
+	}
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ParseStaticKey parses and validates a static access key in the SIP002 or legacy format.
+func ParseStaticKey(keyStr string) (*StaticKey, error) {
+	keyStr = strings.TrimSpace(keyStr)
+	scheme, rest, found := strings.Cut(keyStr, "://")
+	if !found || !strings.EqualFold(scheme, "ss") {
+		return nil, invalidKeyError("unsupported scheme %q", scheme)
+	}
+	var parsed *ssurl.Key
+	var name string
+	var err error
+	if body, fragment, _ := strings.Cut(rest, "#"); !strings.Contains(body, "@") {
+		// Legacy format, with everything Base64-encoded. The standard alphabet may have '/' and '+', so it's not
+		// parsed as a URL.
+		if name, err = url.PathUnescape(fragment); err != nil {
+			return nil, invalidKeyError("invalid name: %v", err)
+		}
+		if parsed, err = ssurl.ParseLegacy(body); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+	} else {
+		keyURL, err := url.Parse(keyStr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		name = keyURL.Fragment
+		if parsed, err = ssurl.ParseSIP002(keyURL); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+	}
+
+	key := &StaticKey{Cipher: parsed.Cipher, Secret: parsed.Secret, Name: name, Plugin: parsed.Query.Get("plugin")}
+	address := url.URL{Host: parsed.Address}
+	key.Host = address.Hostname()
+	if key.Port, err = parsePort(address.Port()); err != nil {
+		return nil, err
+	}
+	if prefixStr := parsed.Query.Get("prefix"); prefixStr != "" {
+		key.Prefix, err = ssurl.ParsePrefix(prefixStr)
+		if err != nil {
+			return nil, invalidKeyError("invalid prefix: %v", err)
+		}
+	}
+
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func parsePort(portStr string) (uint16, error) {
+	if portStr == "" {
+		return 0, invalidKeyError("port not specified")
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return 0, invalidKeyError("invalid port %q", portStr)
+	}
+	return uint16(port), nil
+}
+
+// DynamicKey is an access key that points to a location serving the key.
+type DynamicKey struct {
+	// URL is the HTTPS URL to fetch the key from.
+	URL *url.URL
+	// Name is the optional human-readable name of the key.
+	Name string
+}
+
+// String serializes the key with the ssconf scheme.
+func (k *DynamicKey) String() string {
+	keyURL := *k.URL
+	keyURL.Scheme = "ssconf"
+	keyURL.Fragment = k.Name
+	return keyURL.String()
+}
+
+// ParseDynamicKey parses a dynamic access key with the ssconf scheme. The returned URL uses the https scheme.
+func ParseDynamicKey(keyStr string) (*DynamicKey, error) {
+	keyURL, err := url.Parse(strings.TrimSpace(keyStr))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+	if !strings.EqualFold(keyURL.Scheme, "ssconf") {
+		return nil, invalidKeyError("unsupported scheme %q", keyURL.Scheme)
+	}
+	if keyURL.Host == "" {
+		return nil, invalidKeyError("host not specified")
+	}
+	if keyURL.User != nil {
+		return nil, invalidKeyError("user info is not allowed")
+	}
+	key := &DynamicKey{Name: keyURL.Fragment}
+	keyURL.Scheme = "https"
+	keyURL.Fragment = ""
+	keyURL.RawFragment = ""
+	key.URL = keyURL
+	return key, nil
+}
+
+// Link returns the outline:// link of the key, which has the serialized key, as returned by its String method,
+// escaped in its path. Links let apps that register the outline scheme open the key directly.
+func Link(key fmt.Stringer) string {
+	return "outline://" + url.PathEscape(key.String())
+}
+
+// ParseLink returns the access key in an outline:// link, to be parsed with [ParseStaticKey] or [ParseDynamicKey].
+// The key may be escaped, as [Link] does, or not.
+func ParseLink(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	scheme, keyStr, found := strings.Cut(link, "://")
+	if !found || !strings.EqualFold(scheme, "outline") {
+		return "", invalidKeyError("unsupported scheme %q", scheme)
+	}
+	if !hasKeyScheme(keyStr) {
+		unescaped, err := url.PathUnescape(keyStr)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		keyStr = unescaped
+	}
+	if !hasKeyScheme(keyStr) {
+		return "", invalidKeyError("link has no ss:// or ssconf:// key")
+	}
+	return keyStr, nil
+}
+
+func hasKeyScheme(keyStr string) bool {
+	scheme, _, found := strings.Cut(keyStr, "://")
+	return found && (strings.EqualFold(scheme, "ss") || strings.EqualFold(scheme, "ssconf"))
+}
+
+// QRCode encodes the serialized key, as returned by its String method, in a QR code that Outline and Shadowsocks
+// clients can scan. Use [qrcode.Code.PNG] to get an image of the code.
+func QRCode(key fmt.Stringer) (*qrcode.Code, error) {
+	return qrcode.Encode([]byte(key.String()), qrcode.LevelM)
+}
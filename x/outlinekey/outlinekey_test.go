@@ -0,0 +1,201 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outlinekey
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/x/qrcode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStaticKey_SIP002(t *testing.T) {
+	key, err := ParseStaticKey("ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpzZWNyZXQ@example.com:443/?outline=1&prefix=HTTP%2F1.1%20#My%20Server")
+	require.NoError(t, err)
+	require.Equal(t, &StaticKey{
+		Host:   "example.com",
+		Port:   443,
+		Cipher: "chacha20-ietf-poly1305",
+		Secret: "secret",
+		Prefix: []byte("HTTP/1.1 "),
+		Name:   "My Server",
+	}, key)
+	require.Equal(t, "example.com:443", key.Address())
+}
+
+func TestParseStaticKey_StdBase64(t *testing.T) {
+	userInfo := base64.StdEncoding.EncodeToString([]byte("aes-256-gcm:shadowsocks"))
+	key, err := ParseStaticKey("ss://" + userInfo + "@[2001:db8::1]:8388")
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8::1", key.Host)
+	require.Equal(t, "[2001:db8::1]:8388", key.Address())
+	require.Equal(t, "aes-256-gcm", key.Cipher)
+	require.Equal(t, "shadowsocks", key.Secret)
+}
+
+func TestParseStaticKey_PlainUserInfo(t *testing.T) {
+	key, err := ParseStaticKey("ss://aes-128-gcm:p%40ss@1.2.3.4:8388/?plugin=obfs-local%3Bobfs%3Dhttp")
+	require.NoError(t, err)
+	require.Equal(t, "aes-128-gcm", key.Cipher)
+	require.Equal(t, "p@ss", key.Secret)
+	require.Equal(t, "obfs-local;obfs=http", key.Plugin)
+}
+
+func TestParseStaticKey_Legacy(t *testing.T) {
+	encoded := base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte("aes-256-gcm:1234567@example.com:1234"))
+	key, err := ParseStaticKey("ss://" + encoded + "#legacy")
+	require.NoError(t, err)
+	require.Equal(t, &StaticKey{Host: "example.com", Port: 1234, Cipher: "aes-256-gcm", Secret: "1234567", Name: "legacy"}, key)
+}
+
+func TestParseStaticKey_LegacyStdBase64(t *testing.T) {
+	// The password has characters with special meanings in URLs, and the encoding has '/' and '+'.
+	decoded := "aes-256-gcm:p/a?s@s:w#o>d???~~@[2001:db8::1]:1234"
+	encoded := base64.StdEncoding.EncodeToString([]byte(decoded))
+	require.Contains(t, encoded, "/")
+	require.Contains(t, encoded, "+")
+	key, err := ParseStaticKey("ss://" + encoded + "#My%20Server")
+	require.NoError(t, err)
+	require.Equal(t, &StaticKey{Host: "2001:db8::1", Port: 1234, Cipher: "aes-256-gcm", Secret: "p/a?s@s:w#o>d???~~", Name: "My Server"}, key)
+}
+
+func TestParseStaticKey_LegacyErrors(t *testing.T) {
+	for _, decoded := range []string{
+		"aes-256-gcm:secret",
+		"aes-256-gcm@example.com:1234",
+		"aes-256-gcm:secret@example.com",
+		"aes-256-gcm:secret@example.com:http",
+	} {
+		t.Run(decoded, func(t *testing.T) {
+			_, err := ParseStaticKey("ss://" + base64.RawURLEncoding.EncodeToString([]byte(decoded)))
+			require.ErrorIs(t, err, ErrInvalidKey)
+		})
+	}
+}
+
+func TestParseStaticKey_Errors(t *testing.T) {
+	for _, keyStr := range []string{
+		"",
+		"http://example.com",
+		"ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpzZWNyZXQ@example.com",
+		"ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpzZWNyZXQ@example.com:0",
+		"ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpzZWNyZXQ@example.com:99999",
+		"ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNQ@example.com:443",
+		"ss://" + base64.RawURLEncoding.EncodeToString([]byte("rc4-md5:secret")) + "@example.com:443",
+		"ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-256-gcm:")) + "@example.com:443",
+		"ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpzZWNyZXQ@example.com:443/?prefix=%E2%82%AC",
+		"ss://not-base64!@example.com:443",
+	} {
+		t.Run(keyStr, func(t *testing.T) {
+			_, err := ParseStaticKey(keyStr)
+			require.ErrorIs(t, err, ErrInvalidKey)
+		})
+	}
+}
+
+func TestStaticKey_RoundTrip(t *testing.T) {
+	key := &StaticKey{
+		Host:   "2001:db8::1",
+		Port:   8388,
+		Cipher: "chacha20-ietf-poly1305",
+		Secret: "s3cr3t:with:colons",
+		Prefix: []byte{0x16, 0x03, 0x01, 0xff},
+		Plugin: "v2ray-plugin;tls",
+		Name:   "Test #1",
+	}
+	keyStr := key.String()
+	parsed, err := ParseStaticKey(keyStr)
+	require.NoError(t, err)
+	require.Equal(t, key, parsed)
+}
+
+func TestStaticKey_StringNoQuery(t *testing.T) {
+	key := &StaticKey{Host: "example.com", Port: 443, Cipher: "chacha20-ietf-poly1305", Secret: "secret"}
+	require.Equal(t, "ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpzZWNyZXQ@example.com:443", key.String())
+}
+
+func TestGenerateStaticKey(t *testing.T) {
+	key1, err := GenerateStaticKey("example.com", 443, "chacha20-ietf-poly1305")
+	require.NoError(t, err)
+	key2, err := GenerateStaticKey("example.com", 443, "chacha20-ietf-poly1305")
+	require.NoError(t, err)
+	require.NotEqual(t, key1.Secret, key2.Secret)
+	_, err = key1.EncryptionKey()
+	require.NoError(t, err)
+
+	_, err = GenerateStaticKey("example.com", 443, "unknown")
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestParseDynamicKey(t *testing.T) {
+	key, err := ParseDynamicKey("ssconf://example.com/path/key.json?id=1#My%20Key")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/path/key.json?id=1", key.URL.String())
+	require.Equal(t, "My Key", key.Name)
+	require.Equal(t, "ssconf://example.com/path/key.json?id=1#My%20Key", key.String())
+
+	_, err = ParseDynamicKey("https://example.com/key")
+	require.ErrorIs(t, err, ErrInvalidKey)
+	_, err = ParseDynamicKey("ssconf:///key")
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestStaticKey_LegacyString(t *testing.T) {
+	key := &StaticKey{Host: "example.com", Port: 1234, Cipher: "aes-256-gcm", Secret: "1234567", Name: "legacy key"}
+	keyStr := key.LegacyString()
+	require.Equal(t, "ss://"+base64.RawURLEncoding.EncodeToString([]byte("aes-256-gcm:1234567@example.com:1234"))+"#legacy%20key", keyStr)
+	parsed, err := ParseStaticKey(keyStr)
+	require.NoError(t, err)
+	require.Equal(t, key, parsed)
+}
+
+func TestLink(t *testing.T) {
+	key := &StaticKey{Host: "example.com", Port: 443, Cipher: "chacha20-ietf-poly1305", Secret: "secret", Name: "My Server"}
+	link := Link(key)
+	require.True(t, strings.HasPrefix(link, "outline://ss:"))
+	require.NotContains(t, link, "#")
+	keyStr, err := ParseLink(link)
+	require.NoError(t, err)
+	require.Equal(t, key.String(), keyStr)
+	parsed, err := ParseStaticKey(keyStr)
+	require.NoError(t, err)
+	require.Equal(t, key, parsed)
+
+	// Unescaped links are accepted as is.
+	keyStr, err = ParseLink("OUTLINE://ssconf://example.com/key%20path#Name")
+	require.NoError(t, err)
+	require.Equal(t, "ssconf://example.com/key%20path#Name", keyStr)
+
+	for _, link := range []string{"", "ss://example.com", "outline://", "outline://example.com", "outline://%zz"} {
+		_, err := ParseLink(link)
+		require.ErrorIs(t, err, ErrInvalidKey, link)
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	key := &StaticKey{Host: "example.com", Port: 443, Cipher: "chacha20-ietf-poly1305", Secret: "secret"}
+	code, err := QRCode(key)
+	require.NoError(t, err)
+	require.Equal(t, qrcode.LevelM, code.Level)
+	_, err = code.PNG(4)
+	require.NoError(t, err)
+
+	dynamicKey, err := ParseDynamicKey("ssconf://example.com/key.json")
+	require.NoError(t, err)
+	_, err = QRCode(dynamicKey)
+	require.NoError(t, err)
+}
@@ -0,0 +1,335 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package porthop changes the destination port of UDP transports on a schedule, to defeat networks that throttle or
+block long-lived flows to a single port.
+
+The server must accept the traffic on all the ports of the range, for instance with a firewall rule that redirects
+them to the port it listens on. Each hop dials a new connection to a random port of the range with the base dialer,
+so with Shadowsocks or other proxies each hop is a new association, and the protocol on top must tolerate the
+change of the local address, like QUIC or WireGuard do. The connection keeps receiving on the previous port for
+one more interval, so responses in flight are not lost.
+
+	ports, err := porthop.ParsePortRange("20000-50000")
+	// ...
+	dialer, err := porthop.NewPacketDialer(&transport.UDPDialer{}, ports, 30*time.Second)
+*/
+package porthop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// hopTimeout limits the dial of each hop.
+const hopTimeout = 10 * time.Second
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	First uint16
+	Last  uint16
+}
+
+// ParsePortRange parses a range in the form "FIRST-LAST", or a single port.
+func ParsePortRange(text string) (PortRange, error) {
+	first, last, found := strings.Cut(text, "-")
+	if !found {
+		last = first
+	}
+	firstPort, err := strconv.ParseUint(strings.TrimSpace(first), 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid first port %q: %w", first, err)
+	}
+	lastPort, err := strconv.ParseUint(strings.TrimSpace(last), 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid last port %q: %w", last, err)
+	}
+	r := PortRange{First: uint16(firstPort), Last: uint16(lastPort)}
+	if err := r.validate(); err != nil {
+		return PortRange{}, err
+	}
+	return r, nil
+}
+
+func (r PortRange) validate() error {
+	if r.First == 0 || r.First > r.Last {
+		return fmt.Errorf("invalid port range %v", r)
+	}
+	return nil
+}
+
+// String returns the range in the format of [ParsePortRange].
+func (r PortRange) String() string {
+	if r.First == r.Last {
+		return strconv.Itoa(int(r.First))
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// size returns the number of ports in the range.
+func (r PortRange) size() int {
+	return int(r.Last) - int(r.First) + 1
+}
+
+// PacketDialer is a [transport.PacketDialer] whose connections hop to a random port of a range on a schedule.
+type PacketDialer struct {
+	base     transport.PacketDialer
+	ports    PortRange
+	interval time.Duration
+	// randomPort returns a random index in [0, n).
+	randomPort func(n int) int
+}
+
+var _ transport.PacketDialer = (*PacketDialer)(nil)
+
+// NewPacketDialer creates a [PacketDialer] that dials with base, and hops to a new port of the range every interval.
+func NewPacketDialer(base transport.PacketDialer, ports PortRange, interval time.Duration) (*PacketDialer, error) {
+	if base == nil {
+		return nil, errors.New("argument base must not be nil")
+	}
+	if err := ports.validate(); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	return &PacketDialer{base: base, ports: ports, interval: interval, randomPort: rand.Intn}, nil
+}
+
+// DialPacket implements [transport.PacketDialer]. The port of addr is ignored, and the connection starts on a
+// random port of the range.
+func (d *PacketDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &hopConn{
+		dialer:    d,
+		host:      host,
+		port:      -1,
+		packets:   make(chan []byte),
+		done:      make(chan struct{}),
+		deadlineC: make(chan struct{}),
+	}
+	if err := c.hop(ctx); err != nil {
+		return nil, err
+	}
+	go c.hopLoop()
+	return c, nil
+}
+
+type hopConn struct {
+	dialer  *PacketDialer
+	host    string
+	packets chan []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+
+	mu sync.Mutex
+	// port is the index of the current port in the range.
+	port int
+	// current receives the writes, and previous is still read until the next hop.
+	current  net.Conn
+	previous net.Conn
+	// writeDeadline is applied to the new connections.
+	writeDeadline time.Time
+	// readDeadline is the deadline of Read, and deadlineC is closed when it changes.
+	readDeadline time.Time
+	deadlineC    chan struct{}
+}
+
+var _ net.Conn = (*hopConn)(nil)
+
+// hop dials a new port, which becomes the current connection.
+func (c *hopConn) hop(ctx context.Context) error {
+	c.mu.Lock()
+	port := c.nextPort()
+	c.mu.Unlock()
+	addr := net.JoinHostPort(c.host, strconv.Itoa(int(c.dialer.ports.First)+port))
+	conn, err := c.dialer.base.DialPacket(ctx, addr)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		conn.Close()
+		return net.ErrClosed
+	default:
+	}
+	conn.SetWriteDeadline(c.writeDeadline)
+	stale := c.previous
+	c.previous, c.current, c.port = c.current, conn, port
+	c.mu.Unlock()
+	if stale != nil {
+		stale.Close()
+	}
+	go c.readLoop(conn)
+	return nil
+}
+
+// nextPort returns a random port index different from the current one, if possible. It must be called with mu held.
+func (c *hopConn) nextPort() int {
+	n := c.dialer.ports.size()
+	if c.port < 0 || n == 1 {
+		return c.dialer.randomPort(n)
+	}
+	return (c.port + 1 + c.dialer.randomPort(n-1)) % n
+}
+
+func (c *hopConn) hopLoop() {
+	ticker := time.NewTicker(c.dialer.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), hopTimeout)
+			// If the hop fails, the connection stays on the current port until the next one.
+			c.hop(ctx)
+			cancel()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *hopConn) readLoop(conn net.Conn) {
+	buf := make([]byte, 65536)
+	for {
+		n, err := conn.Read(buf)
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			// ICMP errors don't break the connection.
+			continue
+		}
+		if err != nil {
+			// The connection was closed after a hop, or is broken.
+			return
+		}
+		select {
+		case c.packets <- append([]byte(nil), buf[:n]...):
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *hopConn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		deadline, deadlineC := c.readDeadline, c.deadlineC
+		c.mu.Unlock()
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		n, err, done := 0, error(nil), true
+		select {
+		case packet := <-c.packets:
+			n = copy(b, packet)
+		case <-c.done:
+			err = net.ErrClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		case <-deadlineC:
+			// The deadline changed.
+			done = false
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if done {
+			return n, err
+		}
+	}
+}
+
+func (c *hopConn) currentConn() net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current
+}
+
+func (c *hopConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	return c.currentConn().Write(b)
+}
+
+func (c *hopConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		close(c.done)
+		err = c.current.Close()
+		if c.previous != nil {
+			c.previous.Close()
+		}
+	})
+	return err
+}
+
+// LocalAddr returns the local address of the current connection.
+func (c *hopConn) LocalAddr() net.Addr {
+	return c.currentConn().LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the current connection, with the current port.
+func (c *hopConn) RemoteAddr() net.Addr {
+	return c.currentConn().RemoteAddr()
+}
+
+func (c *hopConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *hopConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	close(c.deadlineC)
+	c.deadlineC = make(chan struct{})
+	return nil
+}
+
+func (c *hopConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return c.current.SetWriteDeadline(t)
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package porthop
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePortRange(t *testing.T) {
+	r, err := ParsePortRange("20000-50000")
+	require.NoError(t, err)
+	require.Equal(t, PortRange{First: 20000, Last: 50000}, r)
+	require.Equal(t, "20000-50000", r.String())
+
+	r, err = ParsePortRange("443")
+	require.NoError(t, err)
+	require.Equal(t, PortRange{First: 443, Last: 443}, r)
+	require.Equal(t, "443", r.String())
+
+	for _, text := range []string{"", "0-10", "10-5", "a-10", "10-70000", "-"} {
+		_, err = ParsePortRange(text)
+		require.Error(t, err, text)
+	}
+}
+
+func TestNewPacketDialer(t *testing.T) {
+	_, err := NewPacketDialer(nil, PortRange{First: 1, Last: 2}, time.Second)
+	require.Error(t, err)
+	_, err = NewPacketDialer(&transport.UDPDialer{}, PortRange{First: 2, Last: 1}, time.Second)
+	require.Error(t, err)
+	_, err = NewPacketDialer(&transport.UDPDialer{}, PortRange{First: 1, Last: 2}, 0)
+	require.Error(t, err)
+}
+
+// startEchoServers listens on consecutive UDP ports, and echoes the datagrams prefixed with the port they arrived on.
+func startEchoServers(t *testing.T, count int) PortRange {
+	var listeners []net.PacketConn
+	// Find a run of free consecutive ports.
+	for first := 40000; len(listeners) < count && first < 60000; first += count {
+		for _, l := range listeners {
+			l.Close()
+		}
+		listeners = nil
+		for port := first; port < first+count; port++ {
+			l, err := net.ListenPacket("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+			if err != nil {
+				break
+			}
+			listeners = append(listeners, l)
+		}
+	}
+	require.Len(t, listeners, count)
+	for _, l := range listeners {
+		t.Cleanup(func() { l.Close() })
+		_, port, _ := net.SplitHostPort(l.LocalAddr().String())
+		go func() {
+			buf := make([]byte, 1500)
+			for {
+				n, addr, err := l.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				l.WriteTo(append([]byte(port+":"), buf[:n]...), addr)
+			}
+		}()
+	}
+	_, port, _ := net.SplitHostPort(listeners[0].LocalAddr().String())
+	first, _ := strconv.Atoi(port)
+	return PortRange{First: uint16(first), Last: uint16(first + count - 1)}
+}
+
+func TestPacketDialer_Hops(t *testing.T) {
+	ports := startEchoServers(t, 3)
+	dialer, err := NewPacketDialer(&transport.UDPDialer{}, ports, 50*time.Millisecond)
+	require.NoError(t, err)
+	dialer.randomPort = func(n int) int { return 0 }
+
+	conn, err := dialer.DialPacket(context.Background(), "127.0.0.1:1")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	seen := make(map[string]bool)
+	buf := make([]byte, 1500)
+	require.Eventually(t, func() bool {
+		_, err := conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		port, payload, _ := strings.Cut(string(buf[:n]), ":")
+		require.Equal(t, "ping", payload)
+		seen[port] = true
+		return len(seen) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPacketDialer_ReadsPreviousPort(t *testing.T) {
+	ports := startEchoServers(t, 2)
+	dialer, err := NewPacketDialer(&transport.UDPDialer{}, ports, time.Hour)
+	require.NoError(t, err)
+	dialer.randomPort = func(n int) int { return 0 }
+	conn, err := dialer.DialPacket(context.Background(), "127.0.0.1:1")
+	require.NoError(t, err)
+	defer conn.Close()
+	c := conn.(*hopConn)
+	require.Equal(t, strconv.Itoa(int(ports.First)), portOf(t, c.RemoteAddr()))
+
+	// Send on the first port, then hop before the response is read.
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	require.NoError(t, c.hop(context.Background()))
+	require.Equal(t, strconv.Itoa(int(ports.Last)), portOf(t, c.RemoteAddr()))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(int(ports.First))+":ping", string(buf[:n]))
+}
+
+func portOf(t *testing.T, addr net.Addr) string {
+	_, port, err := net.SplitHostPort(addr.String())
+	require.NoError(t, err)
+	return port
+}
+
+func TestHopConn_ReadDeadlineAndClose(t *testing.T) {
+	ports := startEchoServers(t, 1)
+	dialer, err := NewPacketDialer(&transport.UDPDialer{}, ports, time.Hour)
+	require.NoError(t, err)
+	conn, err := dialer.DialPacket(context.Background(), "127.0.0.1:1")
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 10))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	require.NoError(t, conn.Close())
+	_, err = conn.Write([]byte("ping"))
+	require.ErrorIs(t, err, net.ErrClosed)
+	require.ErrorIs(t, conn.Close(), net.ErrClosed)
+}
@@ -0,0 +1,265 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proxyproto implements the [PROXY protocol] used by HAProxy and most load balancers to convey
+// the original client address of a proxied connection.
+//
+// Use [NewStreamDialer] to send the header on outbound connections, and [NewListener] to accept connections from
+// a load balancer, so that servers built with the SDK (for instance with [net/http] and the httpproxy handlers) see
+// the real client addresses.
+//
+// [PROXY protocol]: https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidHeader is returned when the connection doesn't start with a valid PROXY protocol header.
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// Version is the version of the PROXY protocol header format.
+type Version byte
+
+const (
+	// Version1 is the human-readable format.
+	Version1 Version = 1
+	// Version2 is the binary format.
+	Version2 Version = 2
+)
+
+// Header is the information in a PROXY protocol header.
+type Header struct {
+	// Network is the transport protocol of the original connection, "tcp" or "udp". It's empty when the
+	// addresses are unknown, as in health checks from the load balancer, in which case the
+	// connection endpoints should be used as the addresses.
+	Network string
+	// Source is the address of the original client.
+	Source netip.AddrPort
+	// Destination is the address the original client connected to.
+	Destination netip.AddrPort
+}
+
+// v2Signature starts every version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	// maxV1Length is the maximum length of a version 1 header, including the CRLF.
+	maxV1Length = 107
+	v2Local     = 0x20
+	v2Proxy     = 0x21
+)
+
+// AppendHeader appends the encoding of the header in the given version to b.
+func AppendHeader(b []byte, version Version, h Header) ([]byte, error) {
+	if h.Network != "" {
+		if h.Network != "tcp" && h.Network != "udp" {
+			return nil, fmt.Errorf("unsupported network %q", h.Network)
+		}
+		src, dst := h.Source.Addr().Unmap(), h.Destination.Addr().Unmap()
+		if !src.IsValid() || !dst.IsValid() {
+			return nil, errors.New("source and destination addresses must be valid")
+		}
+		// Mixed families are sent as IPv6, with IPv4-mapped addresses.
+		if src.Is4() != dst.Is4() {
+			src, dst = netip.AddrFrom16(src.As16()), netip.AddrFrom16(dst.As16())
+		}
+		h.Source = netip.AddrPortFrom(src, h.Source.Port())
+		h.Destination = netip.AddrPortFrom(dst, h.Destination.Port())
+	}
+	switch version {
+	case Version1:
+		return appendV1(b, h)
+	case Version2:
+		return appendV2(b, h), nil
+	default:
+		return nil, fmt.Errorf("unsupported version %v", version)
+	}
+}
+
+func appendV1(b []byte, h Header) ([]byte, error) {
+	if h.Network == "" {
+		return append(b, "PROXY UNKNOWN\r\n"...), nil
+	}
+	if h.Network != "tcp" {
+		return nil, errors.New("version 1 only supports tcp")
+	}
+	family := "TCP4"
+	if h.Source.Addr().Is6() {
+		family = "TCP6"
+	}
+	return fmt.Appendf(b, "PROXY %v %v %v %v %v\r\n", family, h.Source.Addr(), h.Destination.Addr(),
+		h.Source.Port(), h.Destination.Port()), nil
+}
+
+func appendV2(b []byte, h Header) []byte {
+	b = append(b, v2Signature...)
+	if h.Network == "" {
+		return append(b, v2Local, 0, 0, 0)
+	}
+	family := byte(0x10)
+	if h.Source.Addr().Is6() {
+		family = 0x20
+	}
+	if h.Network == "tcp" {
+		family |= 0x1
+	} else {
+		family |= 0x2
+	}
+	src, dst := h.Source.Addr().AsSlice(), h.Destination.Addr().AsSlice()
+	b = append(b, v2Proxy, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(2*len(src)+4))
+	b = append(b, src...)
+	b = append(b, dst...)
+	b = binary.BigEndian.AppendUint16(b, h.Source.Port())
+	return binary.BigEndian.AppendUint16(b, h.Destination.Port())
+}
+
+// ReadHeader reads a version 1 or 2 header from r. It doesn't consume data after the header.
+func ReadHeader(r *bufio.Reader) (Header, error) {
+	// The first byte tells the versions apart, since version 2 starts with CR.
+	first, err := r.Peek(1)
+	if err != nil {
+		return Header{}, noEOF(err)
+	}
+	if first[0] == v2Signature[0] {
+		return readV2(r)
+	}
+	return readV1(r)
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func readV1(r *bufio.Reader) (Header, error) {
+	// Fail early without consuming data from connections without a header.
+	prefix, err := r.Peek(len("PROXY "))
+	if err != nil {
+		return Header{}, noEOF(err)
+	}
+	if string(prefix) != "PROXY " {
+		return Header{}, fmt.Errorf("%w: missing PROXY prefix", ErrInvalidHeader)
+	}
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= maxV1Length {
+			return Header{}, fmt.Errorf("%w: line is too long", ErrInvalidHeader)
+		}
+		c, err := r.ReadByte()
+		if err != nil {
+			return Header{}, noEOF(err)
+		}
+		line = append(line, c)
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return Header{}, fmt.Errorf("%w: missing protocol", ErrInvalidHeader)
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return Header{}, nil
+	case "TCP4", "TCP6":
+	default:
+		return Header{}, fmt.Errorf("%w: unsupported protocol %q", ErrInvalidHeader, fields[1])
+	}
+	if len(fields) != 6 {
+		return Header{}, fmt.Errorf("%w: wrong number of fields", ErrInvalidHeader)
+	}
+	src, err := parseV1Address(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return Header{}, err
+	}
+	dst, err := parseV1Address(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return Header{}, err
+	}
+	return Header{Network: "tcp", Source: src, Destination: dst}, nil
+}
+
+func parseV1Address(ipText, portText string, is4 bool) (netip.AddrPort, error) {
+	ip, err := netip.ParseAddr(ipText)
+	if err != nil || ip.Is4() != is4 || ip.Zone() != "" {
+		return netip.AddrPort{}, fmt.Errorf("%w: invalid address %q", ErrInvalidHeader, ipText)
+	}
+	// Ports must not have leading zeros.
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil || (len(portText) > 1 && portText[0] == '0') {
+		return netip.AddrPort{}, fmt.Errorf("%w: invalid port %q", ErrInvalidHeader, portText)
+	}
+	return netip.AddrPortFrom(ip, uint16(port)), nil
+}
+
+func readV2(r *bufio.Reader) (Header, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return Header{}, noEOF(err)
+	}
+	if !bytes.Equal(fixed[:12], v2Signature) {
+		return Header{}, fmt.Errorf("%w: bad signature", ErrInvalidHeader)
+	}
+	command, family := fixed[12], fixed[13]
+	length := int(binary.BigEndian.Uint16(fixed[14:]))
+	// The payload includes the addresses and optional TLVs, which we skip.
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Header{}, noEOF(err)
+	}
+	switch command {
+	case v2Local:
+		return Header{}, nil
+	case v2Proxy:
+	default:
+		return Header{}, fmt.Errorf("%w: unsupported version and command 0x%02x", ErrInvalidHeader, command)
+	}
+	var h Header
+	switch family & 0x0f {
+	case 0x1:
+		h.Network = "tcp"
+	case 0x2:
+		h.Network = "udp"
+	default:
+		// Unspecified or unsupported protocol: the receiver must ignore the addresses.
+		return Header{}, nil
+	}
+	var addrSize int
+	switch family >> 4 {
+	case 0x1:
+		addrSize = 4
+	case 0x2:
+		addrSize = 16
+	default:
+		return Header{}, nil
+	}
+	if len(payload) < 2*addrSize+4 {
+		return Header{}, fmt.Errorf("%w: address block is too short", ErrInvalidHeader)
+	}
+	src, _ := netip.AddrFromSlice(payload[:addrSize])
+	dst, _ := netip.AddrFromSlice(payload[addrSize : 2*addrSize])
+	ports := payload[2*addrSize:]
+	h.Source = netip.AddrPortFrom(src, binary.BigEndian.Uint16(ports))
+	h.Destination = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(ports[2:]))
+	return h, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendHeader_V1(t *testing.T) {
+	b, err := AppendHeader(nil, Version1, Header{
+		Network:     "tcp",
+		Source:      netip.MustParseAddrPort("192.0.2.1:56324"),
+		Destination: netip.MustParseAddrPort("198.51.100.2:443"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "PROXY TCP4 192.0.2.1 198.51.100.2 56324 443\r\n", string(b))
+
+	b, err = AppendHeader(nil, Version1, Header{
+		Network:     "tcp",
+		Source:      netip.MustParseAddrPort("[2001:db8::1]:56324"),
+		Destination: netip.MustParseAddrPort("[2001:db8::2]:443"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", string(b))
+
+	b, err = AppendHeader(nil, Version1, Header{})
+	require.NoError(t, err)
+	require.Equal(t, "PROXY UNKNOWN\r\n", string(b))
+
+	_, err = AppendHeader(nil, Version1, Header{
+		Network:     "udp",
+		Source:      netip.MustParseAddrPort("192.0.2.1:53"),
+		Destination: netip.MustParseAddrPort("198.51.100.2:53"),
+	})
+	require.Error(t, err)
+}
+
+func TestAppendHeader_V2(t *testing.T) {
+	b, err := AppendHeader(nil, Version2, Header{
+		Network:     "tcp",
+		Source:      netip.MustParseAddrPort("192.0.2.1:256"),
+		Destination: netip.MustParseAddrPort("198.51.100.2:443"),
+	})
+	require.NoError(t, err)
+	expected := append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x21, 0x11, 0, 12, 192, 0, 2, 1, 198, 51, 100, 2, 1, 0, 1, 187)
+	require.Equal(t, expected, b)
+
+	b, err = AppendHeader(nil, Version2, Header{})
+	require.NoError(t, err)
+	require.Equal(t, append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x20, 0, 0, 0), b)
+}
+
+func TestAppendHeader_Invalid(t *testing.T) {
+	_, err := AppendHeader(nil, Version(3), Header{})
+	require.Error(t, err)
+	_, err = AppendHeader(nil, Version2, Header{Network: "tcp"})
+	require.Error(t, err)
+	_, err = AppendHeader(nil, Version2, Header{
+		Network:     "sctp",
+		Source:      netip.MustParseAddrPort("192.0.2.1:53"),
+		Destination: netip.MustParseAddrPort("198.51.100.2:53"),
+	})
+	require.Error(t, err)
+}
+
+func TestHeader_RoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		version Version
+		header  Header
+	}{
+		{"v1/tcp4", Version1, Header{"tcp", netip.MustParseAddrPort("192.0.2.1:1234"), netip.MustParseAddrPort("198.51.100.2:443")}},
+		{"v1/tcp6", Version1, Header{"tcp", netip.MustParseAddrPort("[2001:db8::1]:1234"), netip.MustParseAddrPort("[2001:db8::2]:443")}},
+		{"v1/unknown", Version1, Header{}},
+		{"v2/tcp4", Version2, Header{"tcp", netip.MustParseAddrPort("192.0.2.1:1234"), netip.MustParseAddrPort("198.51.100.2:443")}},
+		{"v2/udp6", Version2, Header{"udp", netip.MustParseAddrPort("[2001:db8::1]:1234"), netip.MustParseAddrPort("[2001:db8::2]:53")}},
+		{"v2/local", Version2, Header{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := AppendHeader(nil, tc.version, tc.header)
+			require.NoError(t, err)
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(b), bytes.NewReader([]byte("payload"))))
+			header, err := ReadHeader(r)
+			require.NoError(t, err)
+			require.Equal(t, tc.header, header)
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, "payload", string(rest))
+		})
+	}
+}
+
+func TestAppendHeader_MixedFamilies(t *testing.T) {
+	b, err := AppendHeader(nil, Version2, Header{
+		Network:     "tcp",
+		Source:      netip.MustParseAddrPort("192.0.2.1:1234"),
+		Destination: netip.MustParseAddrPort("[2001:db8::2]:443"),
+	})
+	require.NoError(t, err)
+	header, err := ReadHeader(bufio.NewReader(bytes.NewReader(b)))
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParseAddrPort("[::ffff:192.0.2.1]:1234"), header.Source)
+}
+
+func TestReadHeader_V2SkipsTLVs(t *testing.T) {
+	b := append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x21, 0x11, 0, 12+4, 192, 0, 2, 1, 198, 51, 100, 2, 0, 1, 0, 2)
+	b = append(b, 0x04, 0, 1, 'x')
+	r := bufio.NewReader(io.MultiReader(bytes.NewReader(b), bytes.NewReader([]byte("payload"))))
+	header, err := ReadHeader(r)
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParseAddrPort("192.0.2.1:1"), header.Source)
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "payload", string(rest))
+}
+
+func TestReadHeader_Invalid(t *testing.T) {
+	for _, input := range []string{
+		"GET / HTTP/1.1\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.2 1234\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.2 1234 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.2 01234 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.2 65536 443\r\n",
+		"PROXY UDP4 192.0.2.1 198.51.100.2 1234 443\r\n",
+		"PROXY TCP4 " + string(bytes.Repeat([]byte("1"), 200)) + "\r\n",
+		"\r\n\r\n\x00\r\nQUIX\n\x21\x11\x00\x00",
+		"\r\n\r\n\x00\r\nQUIT\n\x31\x11\x00\x00",
+		"\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x04\x01\x02\x03\x04",
+	} {
+		_, err := ReadHeader(bufio.NewReader(bytes.NewReader([]byte(input))))
+		require.ErrorIs(t, err, ErrInvalidHeader, "input %q", input)
+	}
+}
+
+func TestReadHeader_Truncated(t *testing.T) {
+	for _, input := range []string{"", "PROXY TCP4 192.0.2.1", "\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c\x01"} {
+		_, err := ReadHeader(bufio.NewReader(bytes.NewReader([]byte(input))))
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF, "input %q", input)
+	}
+}
+
+func FuzzReadHeader(f *testing.F) {
+	f.Add([]byte("PROXY TCP4 192.0.2.1 198.51.100.2 1234 443\r\n"))
+	f.Add(append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x21, 0x11, 0, 12, 192, 0, 2, 1, 198, 51, 100, 2, 1, 0, 1, 187))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := ReadHeader(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil || header.Network != "tcp" {
+			return
+		}
+		// Valid TCP headers must round trip.
+		b, err := AppendHeader(nil, Version2, header)
+		require.NoError(t, err)
+		decoded, err := ReadHeader(bufio.NewReader(bytes.NewReader(b)))
+		require.NoError(t, err)
+		require.Equal(t, header, decoded)
+	})
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxyproto
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// DefaultReadHeaderTimeout is the [Listener] timeout to read the PROXY header, if not set.
+const DefaultReadHeaderTimeout = 10 * time.Second
+
+// Listener is a [net.Listener] for connections that start with a PROXY protocol header, as sent by a
+// load balancer. The accepted connections report the client address from the header as their remote address.
+//
+// The header is read on the first call to Read, RemoteAddr or LocalAddr on the connection, so that slow clients don't
+// block Accept. Connections without a valid header fail on Read.
+type Listener struct {
+	net.Listener
+	// ReadHeaderTimeout is the time allowed to read the header. If zero, [DefaultReadHeaderTimeout] is used.
+	ReadHeaderTimeout time.Duration
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// NewListener creates a [Listener] that accepts connections from the given listener.
+func NewListener(listener net.Listener) *Listener {
+	return &Listener{Listener: listener}
+}
+
+// Accept implements [net.Listener].Accept. The returned connection is a [*Conn].
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	timeout := l.ReadHeaderTimeout
+	if timeout == 0 {
+		timeout = DefaultReadHeaderTimeout
+	}
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Conn is a connection accepted by a [Listener].
+type Conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once      sync.Once
+	header    Header
+	headerErr error
+}
+
+var _ transport.StreamConn = (*Conn)(nil)
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.header, c.headerErr = ReadHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+// Header reads the PROXY header, if not read yet, and returns it.
+func (c *Conn) Header() (Header, error) {
+	c.readHeader()
+	return c.header, c.headerErr
+}
+
+// Read implements [net.Conn].Read.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address in the header, or the address of the peer if the header doesn't have one.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.headerErr == nil && c.header.Network != "" {
+		return toNetAddr(c.header.Network, c.header.Source)
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address in the header, or the local address if the header doesn't have one.
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.headerErr == nil && c.header.Network != "" {
+		return toNetAddr(c.header.Network, c.header.Destination)
+	}
+	return c.Conn.LocalAddr()
+}
+
+func toNetAddr(network string, addr netip.AddrPort) net.Addr {
+	if network == "udp" {
+		return net.UDPAddrFromAddrPort(addr)
+	}
+	return net.TCPAddrFromAddrPort(addr)
+}
+
+// CloseRead implements [transport.StreamConn].CloseRead, if supported by the accepted connection.
+func (c *Conn) CloseRead() error {
+	if cr, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+// CloseWrite implements [transport.StreamConn].CloseWrite, if supported by the accepted connection.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxyproto
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamDialerAndListener(t *testing.T) {
+	for _, version := range []Version{Version1, Version2} {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		listener := NewListener(tcpListener)
+		defer listener.Close()
+
+		dialer, err := NewStreamDialer(&transport.TCPDialer{}, version)
+		require.NoError(t, err)
+		src := netip.MustParseAddrPort("192.0.2.1:1234")
+		conn, err := dialer.DialStream(WithSource(context.Background(), src), listener.Addr().String())
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("Request"))
+		require.NoError(t, err)
+		require.NoError(t, conn.CloseWrite())
+
+		serverConn, err := listener.Accept()
+		require.NoError(t, err)
+		require.Equal(t, src.String(), serverConn.RemoteAddr().String())
+		require.Equal(t, listener.Addr().String(), serverConn.LocalAddr().String())
+		request, err := io.ReadAll(serverConn)
+		require.NoError(t, err)
+		require.Equal(t, "Request", string(request))
+		require.NoError(t, serverConn.(*Conn).CloseWrite())
+		serverConn.Close()
+		conn.Close()
+	}
+}
+
+func TestStreamDialer_DefaultSource(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener := NewListener(tcpListener)
+	defer listener.Close()
+
+	dialer, err := NewStreamDialer(&transport.TCPDialer{}, Version2)
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	serverConn, err := listener.Accept()
+	require.NoError(t, err)
+	defer serverConn.Close()
+	header, err := serverConn.(*Conn).Header()
+	require.NoError(t, err)
+	require.Equal(t, conn.LocalAddr().String(), header.Source.String())
+	require.Equal(t, conn.RemoteAddr().String(), header.Destination.String())
+}
+
+func TestListener_MissingHeader(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener := NewListener(tcpListener)
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+
+	serverConn, err := listener.Accept()
+	require.NoError(t, err)
+	defer serverConn.Close()
+	_, err = serverConn.Read(make([]byte, 10))
+	require.ErrorIs(t, err, ErrInvalidHeader)
+	// Falls back to the peer address.
+	require.Equal(t, conn.LocalAddr().String(), serverConn.RemoteAddr().String())
+}
+
+func TestNewStreamDialer_Invalid(t *testing.T) {
+	_, err := NewStreamDialer(nil, Version1)
+	require.Error(t, err)
+	_, err = NewStreamDialer(&transport.TCPDialer{}, Version(0))
+	require.Error(t, err)
+}
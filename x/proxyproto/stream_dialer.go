@@ -0,0 +1,98 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+type sourceContextKey struct{}
+
+// WithSource returns a context that makes the [NewStreamDialer] dialers report src as the client address.
+// Servers use it to pass the address of the client they are relaying.
+func WithSource(ctx context.Context, src netip.AddrPort) context.Context {
+	return context.WithValue(ctx, sourceContextKey{}, src)
+}
+
+type streamDialer struct {
+	dialer  transport.StreamDialer
+	version Version
+}
+
+var _ transport.StreamDialer = (*streamDialer)(nil)
+
+// NewStreamDialer creates a [transport.StreamDialer] that sends a PROXY protocol header in the given version at
+// the start of each connection.
+//
+// The source address in the header is the one given with [WithSource], or the local address of the connection if
+// not set. The destination address is the dialed address if it's an IP address, or the remote address of the
+// connection otherwise. If the addresses are not known, the header tells the server to use the connection addresses.
+func NewStreamDialer(dialer transport.StreamDialer, version Version) (transport.StreamDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if version != Version1 && version != Version2 {
+		return nil, fmt.Errorf("unsupported version %v", version)
+	}
+	return &streamDialer{dialer: dialer, version: version}, nil
+}
+
+// DialStream implements [transport.StreamDialer].DialStream.
+func (d *streamDialer) DialStream(ctx context.Context, raddr string) (transport.StreamConn, error) {
+	conn, err := d.dialer.DialStream(ctx, raddr)
+	if err != nil {
+		return nil, err
+	}
+	src, ok := ctx.Value(sourceContextKey{}).(netip.AddrPort)
+	if !ok {
+		src = addrPortFromAddr(conn.LocalAddr())
+	}
+	dst, err := netip.ParseAddrPort(raddr)
+	if err != nil {
+		dst = addrPortFromAddr(conn.RemoteAddr())
+	}
+	header := Header{Network: "tcp", Source: src, Destination: dst}
+	if !src.IsValid() || !dst.IsValid() {
+		header = Header{}
+	}
+	b, err := AppendHeader(nil, d.version, header)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to encode PROXY header: %w", err)
+	}
+	if _, err := conn.Write(b); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to write PROXY header: %w", err)
+	}
+	return conn, nil
+}
+
+// addrPortFromAddr returns the IP and port of addr, or an invalid [netip.AddrPort] if it's not an IP address.
+func addrPortFromAddr(addr net.Addr) netip.AddrPort {
+	if addr == nil {
+		return netip.AddrPort{}
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.AddrPort{}
+	}
+	return addrPort
+}
@@ -0,0 +1,33 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package proxytest provides proxy servers for tests, with fault injection, so applications can test how they handle
+misbehaving proxies.
+
+The servers listen on the loopback interface and forward connections to their targets like the real thing, unless
+configured with a [Fault]:
+
+	server, err := proxytest.NewSOCKS5Server(proxytest.Config{Fault: proxytest.TruncatedReply})
+	if err != nil {
+		// handle error
+	}
+	defer server.Close()
+	client, err := socks5.NewClient(&transport.TCPEndpoint{Address: server.Addr()})
+	// The handshake will fail.
+	_, err = client.DialStream(ctx, "example.com:443")
+
+The available servers are [NewSOCKS5Server], [NewShadowsocksServer] and [NewHTTPConnectServer].
+*/
+package proxytest
@@ -0,0 +1,71 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+)
+
+// NewHTTPConnectServer starts an HTTP proxy server that supports the CONNECT method.
+//
+// The faults apply to the response to the CONNECT request. [WrongReply] sends a "403 Forbidden" response.
+func NewHTTPConnectServer(config Config) (*Server, error) {
+	return newServer(config, (*Server).handleHTTPConnect)
+}
+
+func (s *Server) handleHTTPConnect(ctx context.Context, conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return
+	}
+	if req.Method != http.MethodConnect {
+		io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+	target, err := s.dialTarget(ctx, req.Host)
+	if err != nil {
+		io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+	if target != nil {
+		defer target.Close()
+	}
+	if !s.writeReply(ctx, conn, []byte("HTTP/1.1 200 OK\r\n\r\n"), []byte("HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n")) {
+		return
+	}
+	// Include the data the client sent after the request, which may be buffered already.
+	relay(&bufferedConn{Conn: conn, reader: reader}, target)
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks"
+	"github.com/Jigsaw-Code/outline-sdk/transport/socks5"
+	"github.com/Jigsaw-Code/outline-sdk/x/bench"
+	"github.com/Jigsaw-Code/outline-sdk/x/httpconnect"
+	"github.com/stretchr/testify/require"
+)
+
+const testCipher = "chacha20-ietf-poly1305"
+const testSecret = "secret"
+
+type clientFactory func(t *testing.T, proxyAddr string) transport.StreamDialer
+
+var clients = map[string]struct {
+	newServer func(Config) (*Server, error)
+	newClient clientFactory
+}{
+	"SOCKS5": {
+		newServer: NewSOCKS5Server,
+		newClient: func(t *testing.T, proxyAddr string) transport.StreamDialer {
+			client, err := socks5.NewClient(&transport.TCPEndpoint{Address: proxyAddr})
+			require.NoError(t, err)
+			return client
+		},
+	},
+	"SOCKS5 with credentials": {
+		newServer: NewSOCKS5Server,
+		newClient: func(t *testing.T, proxyAddr string) transport.StreamDialer {
+			client, err := socks5.NewClient(&transport.TCPEndpoint{Address: proxyAddr})
+			require.NoError(t, err)
+			require.NoError(t, client.SetCredentials([]byte("user"), []byte("pass")))
+			return client
+		},
+	},
+	"Shadowsocks": {
+		newServer: func(config Config) (*Server, error) {
+			return NewShadowsocksServer(testCipher, testSecret, config)
+		},
+		newClient: func(t *testing.T, proxyAddr string) transport.StreamDialer {
+			key, err := shadowsocks.NewEncryptionKey(testCipher, testSecret)
+			require.NoError(t, err)
+			client, err := shadowsocks.NewStreamDialer(&transport.TCPEndpoint{Address: proxyAddr}, key)
+			require.NoError(t, err)
+			return client
+		},
+	},
+	"HTTP CONNECT": {
+		newServer: NewHTTPConnectServer,
+		newClient: func(t *testing.T, proxyAddr string) transport.StreamDialer {
+			client, err := httpconnect.NewConnectClient(&transport.TCPDialer{}, proxyAddr)
+			require.NoError(t, err)
+			return client
+		},
+	},
+}
+
+// echoRoundTrip sends a message through the dialer to the echo server, and checks the response.
+func echoRoundTrip(dialer transport.StreamDialer, addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dialer.DialStream(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		return err
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if string(buf) != "hello" {
+		return errors.New("echo mismatch")
+	}
+	return nil
+}
+
+func TestServers(t *testing.T) {
+	echo, err := bench.NewEchoServer()
+	require.NoError(t, err)
+	defer echo.Close()
+
+	for name, tc := range clients {
+		t.Run(name, func(t *testing.T) {
+			for _, fault := range []Fault{NoFault, SlowHandshake, TruncatedReply, WrongReply, GarbageReply} {
+				t.Run(fault.String(), func(t *testing.T) {
+					server, err := tc.newServer(Config{Fault: fault, Delay: 100 * time.Millisecond})
+					require.NoError(t, err)
+					defer server.Close()
+
+					start := time.Now()
+					err = echoRoundTrip(tc.newClient(t, server.Addr()), echo.StreamAddr())
+					switch fault {
+					case NoFault:
+						require.NoError(t, err)
+					case SlowHandshake:
+						require.NoError(t, err)
+						require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+					default:
+						require.Error(t, err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	// Closing the server must not wait for the slow handshakes.
+	server, err := NewSOCKS5Server(Config{Fault: SlowHandshake, Delay: time.Hour})
+	require.NoError(t, err)
+	client, err := socks5.NewClient(&transport.TCPEndpoint{Address: server.Addr()})
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() {
+		_, err := client.DialStream(context.Background(), "example.com:443")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, server.Close())
+	require.Error(t, <-done)
+}
+
+func TestFaultString(t *testing.T) {
+	require.Equal(t, "TruncatedReply", TruncatedReply.String())
+	require.Equal(t, "Fault(42)", Fault(42).String())
+}
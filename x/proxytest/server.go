@@ -0,0 +1,253 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Fault is a misbehavior of a test server.
+type Fault int
+
+const (
+	// NoFault makes the server behave correctly.
+	NoFault Fault = iota
+	// TruncatedReply makes the server close the connection in the middle of its handshake reply.
+	TruncatedReply
+	// WrongReply makes the server send a well-formed reply that fails the connection, such as an error code.
+	WrongReply
+	// SlowHandshake makes the server wait for [Config.Delay] before replying to the handshake.
+	SlowHandshake
+	// GarbageReply makes the server reply to the handshake with random bytes.
+	GarbageReply
+)
+
+// String returns the name of the fault.
+func (f Fault) String() string {
+	switch f {
+	case NoFault:
+		return "NoFault"
+	case TruncatedReply:
+		return "TruncatedReply"
+	case WrongReply:
+		return "WrongReply"
+	case SlowHandshake:
+		return "SlowHandshake"
+	case GarbageReply:
+		return "GarbageReply"
+	default:
+		return fmt.Sprintf("Fault(%d)", int(f))
+	}
+}
+
+// DefaultDelay is the delay of [SlowHandshake] if [Config.Delay] is not set.
+const DefaultDelay = 1 * time.Second
+
+// Config configures a test server.
+type Config struct {
+	// Fault is the misbehavior to inject.
+	Fault Fault
+	// Delay is how long to wait with [SlowHandshake]. If zero, [DefaultDelay] is used.
+	Delay time.Duration
+	// Dialer is used to connect to the targets. If nil, a zero [net.Dialer] is used.
+	Dialer *net.Dialer
+}
+
+// Server is a running test server.
+type Server struct {
+	listener net.Listener
+	config   Config
+	handle   func(ctx context.Context, conn net.Conn)
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+func newServer(config Config, handle func(s *Server, ctx context.Context, conn net.Conn)) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	if config.Delay == 0 {
+		config.Delay = DefaultDelay
+	}
+	if config.Dialer == nil {
+		config.Dialer = &net.Dialer{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{listener: listener, config: config, ctx: ctx, cancel: cancel, conns: make(map[net.Conn]struct{})}
+	s.handle = func(ctx context.Context, conn net.Conn) { handle(s, ctx, conn) }
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and closes all its connections.
+func (s *Server) Close() error {
+	s.cancel()
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.ctx.Err() != nil {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			s.handle(s.ctx, conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// dialTarget connects to the target address, unless the fault prevents the server from proceeding, in which
+// case it returns a nil connection.
+func (s *Server) dialTarget(ctx context.Context, addr string) (net.Conn, error) {
+	if s.config.Fault != NoFault && s.config.Fault != SlowHandshake {
+		return nil, nil
+	}
+	return s.config.Dialer.DialContext(ctx, "tcp", addr)
+}
+
+// writeReply writes the handshake reply, or the faulty version of it. It returns whether the server should
+// proceed with the connection.
+func (s *Server) writeReply(ctx context.Context, conn net.Conn, reply []byte, wrongReply []byte) bool {
+	switch s.config.Fault {
+	case SlowHandshake:
+		if !s.delay(ctx) {
+			return false
+		}
+	case TruncatedReply:
+		conn.Write(reply[:len(reply)/2])
+		return false
+	case WrongReply:
+		conn.Write(wrongReply)
+		return false
+	case GarbageReply:
+		garbage := make([]byte, max(len(reply), 16))
+		rand.Read(garbage)
+		conn.Write(garbage)
+		return false
+	}
+	_, err := conn.Write(reply)
+	return err == nil
+}
+
+// delay waits for the configured delay. It returns false if the server is closed in the meantime.
+func (s *Server) delay(ctx context.Context) bool {
+	select {
+	case <-time.After(s.config.Delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// relay copies data in both directions until both are done, propagating half-closes.
+func relay(left io.ReadWriter, right io.ReadWriter) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		io.Copy(right, left)
+		closeWrite(right)
+	}()
+	io.Copy(left, right)
+	closeWrite(left)
+	wg.Wait()
+}
+
+func closeWrite(w any) {
+	if cw, ok := w.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else if c, ok := w.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// readSOCKSAddr reads an address in the SOCKS5 format, also used by Shadowsocks.
+// See https://datatracker.ietf.org/doc/html/rfc1928#section-5.
+func readSOCKSAddr(r io.Reader) (string, error) {
+	var buf [1 + 255 + 2]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return "", err
+	}
+	var host string
+	switch buf[0] {
+	case 1:
+		if _, err := io.ReadFull(r, buf[:net.IPv4len]); err != nil {
+			return "", err
+		}
+		host = net.IP(buf[:net.IPv4len]).String()
+	case 3:
+		if _, err := io.ReadFull(r, buf[:1]); err != nil {
+			return "", err
+		}
+		nameLen := int(buf[0])
+		if _, err := io.ReadFull(r, buf[:nameLen]); err != nil {
+			return "", err
+		}
+		host = string(buf[:nameLen])
+	case 4:
+		if _, err := io.ReadFull(r, buf[:net.IPv6len]); err != nil {
+			return "", err
+		}
+		host = net.IP(buf[:net.IPv6len]).String()
+	default:
+		return "", errors.New("invalid address type")
+	}
+	if _, err := io.ReadFull(r, buf[:2]); err != nil {
+		return "", err
+	}
+	port := int(buf[0])<<8 | int(buf[1])
+	return net.JoinHostPort(host, fmt.Sprint(port)), nil
+}
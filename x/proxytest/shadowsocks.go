@@ -0,0 +1,96 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport/shadowsocks"
+)
+
+// NewShadowsocksServer starts a Shadowsocks server with the given cipher and secret.
+//
+// Shadowsocks servers don't reply to the handshake, so the faults apply to the first bytes the server sends.
+// [TruncatedReply] sends part of the salt, [WrongReply] sends data encrypted with a different secret, and
+// [SlowHandshake] waits before connecting to the target.
+func NewShadowsocksServer(cipherName string, secret string, config Config) (*Server, error) {
+	key, err := shadowsocks.NewEncryptionKey(cipherName, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key: %w", err)
+	}
+	wrongKey, err := shadowsocks.NewEncryptionKey(cipherName, secret+"-wrong")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key: %w", err)
+	}
+	return newServer(config, func(s *Server, ctx context.Context, conn net.Conn) {
+		s.handleShadowsocks(ctx, conn, key, wrongKey)
+	})
+}
+
+func (s *Server) handleShadowsocks(ctx context.Context, conn net.Conn, key, wrongKey *shadowsocks.EncryptionKey) {
+	reader := shadowsocks.NewReader(conn, key)
+	targetAddr, err := readSOCKSAddr(reader)
+	if err != nil {
+		return
+	}
+	switch s.config.Fault {
+	case TruncatedReply:
+		// Send half of the salt.
+		salt := make([]byte, 8)
+		rand.Read(salt)
+		conn.Write(salt)
+		return
+	case GarbageReply:
+		s.writeReply(ctx, conn, make([]byte, 64), nil)
+		return
+	case WrongReply:
+		key = wrongKey
+	case SlowHandshake:
+		if !s.delay(ctx) {
+			return
+		}
+	}
+	target, err := s.config.Dialer.DialContext(ctx, "tcp", targetAddr)
+	if err != nil {
+		return
+	}
+	defer target.Close()
+	relay(&shadowsocksConn{Conn: conn, reader: reader, writer: shadowsocks.NewWriter(conn, key)}, target)
+}
+
+// shadowsocksConn is the client side of a Shadowsocks connection, with the encryption applied.
+type shadowsocksConn struct {
+	net.Conn
+	reader shadowsocks.Reader
+	writer *shadowsocks.Writer
+}
+
+func (c *shadowsocksConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *shadowsocksConn) Write(b []byte) (int, error) {
+	return c.writer.Write(b)
+}
+
+func (c *shadowsocksConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"context"
+	"io"
+	"net"
+)
+
+// SOCKS5 reply codes. See https://datatracker.ietf.org/doc/html/rfc1928#section-6.
+const (
+	socksReplySucceeded           = 0x00
+	socksReplyGeneralFailure      = 0x01
+	socksReplyHostUnreachable     = 0x04
+	socksReplyCommandNotSupported = 0x07
+)
+
+// NewSOCKS5Server starts a SOCKS5 server that supports the CONNECT command. It accepts clients without
+// authentication, or with any username and password.
+//
+// The faults apply to the reply to the CONNECT request. [WrongReply] sends the "general SOCKS server failure" code.
+func NewSOCKS5Server(config Config) (*Server, error) {
+	return newServer(config, (*Server).handleSOCKS5)
+}
+
+func (s *Server) handleSOCKS5(ctx context.Context, conn net.Conn) {
+	// Method selection: VER, NMETHODS, METHODS.
+	var buf [2 + 255]byte
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil || buf[0] != 5 {
+		return
+	}
+	methods := buf[2 : 2+int(buf[1])]
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	method := byte(0xff)
+	for _, m := range methods {
+		if m == 0 || (m == 2 && method == 0xff) {
+			method = m
+		}
+	}
+	if _, err := conn.Write([]byte{5, method}); err != nil || method == 0xff {
+		return
+	}
+	if method == 2 {
+		// Username/password: VER, ULEN, UNAME, PLEN, PASSWD. See https://datatracker.ietf.org/doc/html/rfc1929.
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		usernameLen := int(buf[1])
+		if _, err := io.ReadFull(conn, buf[:usernameLen+1]); err != nil {
+			return
+		}
+		passwordLen := int(buf[usernameLen])
+		if _, err := io.ReadFull(conn, buf[:passwordLen]); err != nil {
+			return
+		}
+		if _, err := conn.Write([]byte{1, 0}); err != nil {
+			return
+		}
+	}
+
+	// Request: VER, CMD, RSV, DST.ADDR, DST.PORT.
+	if _, err := io.ReadFull(conn, buf[:3]); err != nil {
+		return
+	}
+	cmd := buf[1]
+	targetAddr, err := readSOCKSAddr(conn)
+	if err != nil {
+		return
+	}
+	if cmd != 1 {
+		conn.Write(socksReply(socksReplyCommandNotSupported))
+		return
+	}
+	target, err := s.dialTarget(ctx, targetAddr)
+	if err != nil {
+		conn.Write(socksReply(socksReplyHostUnreachable))
+		return
+	}
+	if target != nil {
+		defer target.Close()
+	}
+	if !s.writeReply(ctx, conn, socksReply(socksReplySucceeded), socksReply(socksReplyGeneralFailure)) {
+		return
+	}
+	relay(conn, target)
+}
+
+// socksReply returns a reply with the given code and an unspecified bound address.
+func socksReply(code byte) []byte {
+	// VER, REP, RSV, ATYP = IPv4, BND.ADDR, BND.PORT
+	return []byte{5, code, 0, 1, 0, 0, 0, 0, 0, 0}
+}
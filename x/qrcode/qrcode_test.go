@@ -0,0 +1,216 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// Version 1-M "HELLO WORLD" example from https://www.thonky.com/qr-code-tutorial/error-correction-coding.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	ecc := reedSolomonRemainder(data, reedSolomonDivisor(10))
+	require.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, ecc)
+}
+
+func TestCapacity(t *testing.T) {
+	require.Equal(t, 19, numDataCodewords(1, LevelL))
+	require.Equal(t, 16, numDataCodewords(1, LevelM))
+	require.Equal(t, 2956, numDataCodewords(40, LevelL))
+	require.Equal(t, 1276, numDataCodewords(40, LevelH))
+	require.Equal(t, []int{6, 34, 60, 86, 112, 138}, alignmentPatternPositions(32))
+
+	// Version 1-L holds up to 17 bytes.
+	code, err := Encode(make([]byte, 17), LevelL)
+	require.NoError(t, err)
+	require.Equal(t, 1, code.Version)
+	code, err = Encode(make([]byte, 18), LevelL)
+	require.NoError(t, err)
+	require.Equal(t, 2, code.Version)
+}
+
+// readFormat reads the first copy of the format information.
+func readFormat(code *Code) int {
+	bits := 0
+	set := func(i int, dark bool) {
+		if dark {
+			bits |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		set(i, code.Dark(8, i))
+	}
+	set(6, code.Dark(8, 7))
+	set(7, code.Dark(8, 8))
+	set(8, code.Dark(7, 8))
+	for i := 9; i < 15; i++ {
+		set(i, code.Dark(14-i, 8))
+	}
+	return bits
+}
+
+// decode reads the byte mode data back from the code, and checks the error correction codewords.
+func decode(t *testing.T, code *Code) []byte {
+	format := readFormat(code) ^ 0x5412
+	require.Equal(t, code.Level.formatBits(), format>>13)
+	require.Equal(t, code.Mask, (format>>10)&7)
+
+	// Read the codewords in the zigzag order, after removing the mask.
+	layout := newCode(code.Version, code.Level)
+	layout.drawFunctionPatterns()
+	var bits bitBuffer
+	for right := code.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < code.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = code.size - 1 - vert
+				}
+				if !layout.isFunction[y][x] {
+					bits = append(bits, code.Dark(x, y) != maskBit(code.Mask, x, y))
+				}
+			}
+		}
+	}
+	codewords := bits[:len(bits)/8*8].bytes()
+
+	// De-interleave and verify the blocks.
+	numBlocks := numErrorCorrectionBlocks[code.Level][code.Version]
+	eccLen := eccCodewordsPerBlock[code.Level][code.Version]
+	rawCodewords := numRawDataModules(code.Version) / 8
+	require.Len(t, codewords, rawCodewords)
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortDataLen := rawCodewords/numBlocks - eccLen
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortDataLen; i++ {
+		for j := range blocks {
+			if i < shortDataLen || j >= numShortBlocks {
+				blocks[j] = append(blocks[j], codewords[k])
+				k++
+			}
+		}
+	}
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, block...)
+	}
+	for i := 0; i < eccLen; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+	for _, block := range blocks {
+		dataLen := len(block) - eccLen
+		require.Equal(t, reedSolomonRemainder(block[:dataLen], reedSolomonDivisor(eccLen)), block[dataLen:])
+	}
+
+	// Parse the byte mode segment.
+	require.Equal(t, byte(0b0100), data[0]>>4)
+	var value, pos int
+	read := func(n int) int {
+		value = 0
+		for i := 0; i < n; i++ {
+			bit := (data[(4+pos)/8] >> (7 - (4+pos)%8)) & 1
+			value = value<<1 | int(bit)
+			pos++
+		}
+		return value
+	}
+	length := read(charCountBits(code.Version))
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = byte(read(8))
+	}
+	return result
+}
+
+func TestEncode(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		level   Level
+		version int
+	}{
+		{name: "empty", data: "", level: LevelM, version: 1},
+		{name: "v1", data: "hello", level: LevelL, version: 1},
+		{name: "key", data: "ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTpzZWNyZXQ@example.com:443/?outline=1#My%20Server", level: LevelM, version: 5},
+		{name: "version info", data: strings.Repeat("x", 200), level: LevelQ, version: 12},
+		{name: "largest", data: strings.Repeat("y", 2953), level: LevelL, version: 40},
+		{name: "high", data: strings.Repeat("z", 100), level: LevelH, version: 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code, err := Encode([]byte(tc.data), tc.level)
+			require.NoError(t, err)
+			require.Equal(t, tc.version, code.Version)
+			require.Equal(t, tc.version*4+17, code.Size())
+			require.Equal(t, tc.data, string(decode(t, code)))
+			// Timing pattern and dark module.
+			require.True(t, code.Dark(6, 8))
+			require.False(t, code.Dark(6, 9))
+			require.True(t, code.Dark(8, code.Size()-8))
+		})
+	}
+}
+
+func TestEncode_FormatBits(t *testing.T) {
+	code := newCode(1, LevelM)
+	code.drawFormatBits(0)
+	require.Equal(t, 0b101010000010010, readFormat(code))
+	code = newCode(1, LevelL)
+	code.drawFormatBits(4)
+	require.Equal(t, 0b110011000101111, readFormat(code))
+}
+
+func TestEncode_TooLong(t *testing.T) {
+	_, err := Encode(make([]byte, 2954), LevelL)
+	require.ErrorIs(t, err, ErrDataTooLong)
+	_, err = Encode(nil, Level(7))
+	require.Error(t, err)
+}
+
+func TestCode_PNG(t *testing.T) {
+	code, err := Encode([]byte("hello"), LevelM)
+	require.NoError(t, err)
+	pngBytes, err := code.PNG(4)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(pngBytes))
+	require.NoError(t, err)
+	require.Equal(t, (21+8)*4, img.Bounds().Dx())
+	// Top left corner of the finder pattern, after the quiet zone.
+	r, _, _, _ := img.At(16, 16).RGBA()
+	require.Equal(t, uint32(0), r)
+	r, _, _, _ = img.At(15, 15).RGBA()
+	require.Equal(t, uint32(0xffff), r)
+}
+
+func TestCode_String(t *testing.T) {
+	code, err := Encode([]byte("hello"), LevelM)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(code.String(), "\n"), "\n")
+	require.Len(t, lines, (21+8+1)/2)
+	require.Equal(t, 21+8, len([]rune(lines[0])))
+	require.Equal(t, strings.Repeat(" ", 4)+"█", string([]rune(lines[2])[:5]))
+}
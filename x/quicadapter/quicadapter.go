@@ -0,0 +1,149 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package quicadapter runs [quic-go] over SDK packet transports, so that QUIC and HTTP/3 connections can go through
+proxies that relay UDP, such as Shadowsocks or SOCKS5.
+
+A [Dialer] dials QUIC connections with a [transport.PacketDialer]. Its DialEarly method has the signature of the
+Dial field of the http3.Transport:
+
+	dialer, err := quicadapter.NewDialer(packetDialer)
+	if err != nil {
+		// handle error
+	}
+	defer dialer.Close()
+	client := &http.Client{Transport: &http3.Transport{Dial: dialer.DialEarly}}
+
+Proxied connections don't carry the ECN bits and packet info of the local socket, so quic-go must not use them.
+The transports created by this package only expose the plain [net.PacketConn] methods for proxied connections,
+which makes quic-go disable ECN, GSO and other socket options.
+
+[quic-go]: https://github.com/quic-go/quic-go
+*/
+package quicadapter
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/netadapter"
+	"github.com/quic-go/quic-go"
+)
+
+// basicPacketConn hides the OOB capabilities of a [net.PacketConn] from quic-go.
+type basicPacketConn struct {
+	net.PacketConn
+}
+
+// NewTransport creates a [quic.Transport] that sends the packets with the dialer, one connection per destination.
+// The transport doesn't use ECN or other socket options, since the packets may be proxied. Closing the transport
+// doesn't close its Conn, which must be closed after it.
+func NewTransport(dialer transport.PacketDialer) (*quic.Transport, error) {
+	pc, err := netadapter.NewPacketConn(dialer)
+	if err != nil {
+		return nil, err
+	}
+	return &quic.Transport{Conn: &basicPacketConn{pc}}, nil
+}
+
+// NewTransportFromListener creates a [quic.Transport] on a connection from the listener. It uses the OOB
+// capabilities of the socket only if the listener is a direct [transport.UDPListener]. Closing the transport doesn't
+// close its Conn, which must be closed after it.
+func NewTransportFromListener(ctx context.Context, listener transport.PacketListener) (*quic.Transport, error) {
+	if listener == nil {
+		return nil, errors.New("argument listener must not be nil")
+	}
+	pc, err := listener.ListenPacket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, direct := listener.(*transport.UDPListener); !direct {
+		pc = &basicPacketConn{pc}
+	}
+	return &quic.Transport{Conn: pc}, nil
+}
+
+// hostAddr is a [net.Addr] with an unresolved host name, so the name is resolved by the dialer, and not locally.
+type hostAddr string
+
+func (a hostAddr) Network() string { return "udp" }
+func (a hostAddr) String() string  { return string(a) }
+
+// Dialer dials QUIC connections with a [transport.PacketDialer].
+type Dialer struct {
+	transport *quic.Transport
+}
+
+// NewDialer creates a [Dialer] that uses the packet dialer, through a transport from [NewTransport].
+func NewDialer(dialer transport.PacketDialer) (*Dialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	quicTransport, err := NewTransport(dialer)
+	if err != nil {
+		return nil, err
+	}
+	return &Dialer{transport: quicTransport}, nil
+}
+
+// Transport returns the [quic.Transport] of the dialer, to configure it or to dial with other methods.
+func (d *Dialer) Transport() *quic.Transport {
+	return d.transport
+}
+
+// DialEarly dials a QUIC connection to the host:port address, which is passed to the packet dialer without
+// resolving it. The TLS ServerName defaults to the host. It has the signature of the Dial field of the http3.Transport.
+func (d *Dialer) DialEarly(ctx context.Context, addr string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlyConnection, error) {
+	tlsConf, err := withServerName(addr, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	return d.transport.DialEarly(ctx, hostAddr(addr), tlsConf, quicConf)
+}
+
+// Dial dials a QUIC connection to the host:port address, like [Dialer.DialEarly], but waits for the handshake to
+// complete.
+func (d *Dialer) Dial(ctx context.Context, addr string, tlsConf *tls.Config, quicConf *quic.Config) (quic.Connection, error) {
+	tlsConf, err := withServerName(addr, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	return d.transport.Dial(ctx, hostAddr(addr), tlsConf, quicConf)
+}
+
+// withServerName returns a copy of tlsConf with the ServerName set to the host of addr, if not already set.
+func withServerName(addr string, tlsConf *tls.Config) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf == nil {
+		tlsConf = &tls.Config{}
+	}
+	if tlsConf.ServerName != "" {
+		return tlsConf, nil
+	}
+	tlsConf = tlsConf.Clone()
+	tlsConf.ServerName = host
+	return tlsConf, nil
+}
+
+// Close closes the transport and its connections.
+func (d *Dialer) Close() error {
+	return errors.Join(d.transport.Close(), d.transport.Conn.Close())
+}
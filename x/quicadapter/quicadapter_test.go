@@ -0,0 +1,150 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicadapter
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "quic.example"},
+		DNSNames:     []string{"quic.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, roots
+}
+
+// startQUICEchoServer runs a QUIC server that echoes the first stream of each connection.
+func startQUICEchoServer(t *testing.T) (string, *x509.CertPool) {
+	cert, roots := newTestCertificate(t)
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"echo"}}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				io.Copy(stream, stream)
+				stream.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String(), roots
+}
+
+// hostPacketDialer maps a host name to the test server address and records the dialed addresses.
+type hostPacketDialer struct {
+	host    string
+	address string
+	dials   atomic.Int32
+}
+
+func (d *hostPacketDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host != d.host {
+		return nil, &net.DNSError{Err: "unexpected host", Name: host}
+	}
+	d.dials.Add(1)
+	return (&transport.UDPDialer{}).DialPacket(ctx, d.address)
+}
+
+func TestDialer(t *testing.T) {
+	address, roots := startQUICEchoServer(t)
+	packetDialer := &hostPacketDialer{host: "quic.example", address: address}
+	dialer, err := NewDialer(packetDialer)
+	require.NoError(t, err)
+	defer dialer.Close()
+	// The transport must not use the socket options.
+	_, isOOBCapable := dialer.Transport().Conn.(quic.OOBCapablePacketConn)
+	require.False(t, isOOBCapable)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := dialer.DialEarly(ctx, "quic.example:443", &tls.Config{RootCAs: roots, NextProtos: []string{"echo"}}, nil)
+	require.NoError(t, err)
+	defer conn.CloseWithError(0, "")
+	stream, err := conn.OpenStreamSync(ctx)
+	require.NoError(t, err)
+	_, err = stream.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	data, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	// The host name was passed to the dialer unresolved.
+	require.Equal(t, int32(1), packetDialer.dials.Load())
+
+	_, err = dialer.Dial(ctx, "no-port", &tls.Config{}, nil)
+	require.Error(t, err)
+}
+
+type funcPacketListener func(ctx context.Context) (net.PacketConn, error)
+
+func (f funcPacketListener) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	return f(ctx)
+}
+
+func TestNewTransportFromListener(t *testing.T) {
+	direct, err := NewTransportFromListener(context.Background(), &transport.UDPListener{Address: "127.0.0.1:0"})
+	require.NoError(t, err)
+	defer direct.Conn.Close()
+	_, isOOBCapable := direct.Conn.(quic.OOBCapablePacketConn)
+	require.True(t, isOOBCapable)
+
+	proxied, err := NewTransportFromListener(context.Background(), funcPacketListener(func(ctx context.Context) (net.PacketConn, error) {
+		return net.ListenPacket("udp", "127.0.0.1:0")
+	}))
+	require.NoError(t, err)
+	defer proxied.Conn.Close()
+	_, isOOBCapable = proxied.Conn.(quic.OOBCapablePacketConn)
+	require.False(t, isOOBCapable)
+}
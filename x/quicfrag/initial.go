@@ -0,0 +1,424 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicfrag
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/quic-go/quic-go/quicvarint"
+	"golang.org/x/crypto/hkdf"
+)
+
+// This file implements the parts of QUIC version 1 needed to read and write Initial packets.
+// See https://datatracker.ietf.org/doc/html/rfc9000#section-17.2 and https://datatracker.ietf.org/doc/html/rfc9001#section-5.
+
+const (
+	version1 = 1
+
+	packetTypeInitial = 0
+	packetTypeRetry   = 3
+
+	frameTypePadding      = 0x00
+	frameTypePing         = 0x01
+	frameTypeAck          = 0x02
+	frameTypeAckECN       = 0x03
+	frameTypeCrypto       = 0x06
+	frameTypeConnClose    = 0x1c
+	aeadTagLen            = 16
+	headerProtectionBytes = 16
+	// minInitialDatagramLen is the minimum size of client datagrams with Initial packets.
+	minInitialDatagramLen = 1200
+)
+
+var initialSaltV1 = []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a}
+
+var errTruncatedPacket = errors.New("truncated packet")
+
+// longHeader is the parsed long header of a QUIC packet, without header protection.
+type longHeader struct {
+	packetType byte
+	version    uint32
+	dcid       []byte
+	scid       []byte
+	// token is only set for Initial packets.
+	token []byte
+	// pnOffset is the offset of the packet number.
+	pnOffset int
+	// packetLen is the length of the whole packet, so the next coalesced packet starts at packetLen.
+	packetLen int
+}
+
+// isLongHeader reports whether the packet starts with a long header.
+func isLongHeader(b []byte) bool {
+	return len(b) > 0 && b[0]&0x80 != 0
+}
+
+// parseLongHeader parses the long header at the start of b. For unknown versions, only the version is set.
+func parseLongHeader(b []byte) (*longHeader, error) {
+	if len(b) < 7 {
+		return nil, errTruncatedPacket
+	}
+	hdr := &longHeader{packetType: (b[0] >> 4) & 0x3, version: binary.BigEndian.Uint32(b[1:5])}
+	if hdr.version != version1 {
+		hdr.packetLen = len(b)
+		return hdr, nil
+	}
+	pos := 5
+	readConnID := func() ([]byte, error) {
+		if pos >= len(b) || int(b[pos]) > 20 || pos+1+int(b[pos]) > len(b) {
+			return nil, errTruncatedPacket
+		}
+		id := b[pos+1 : pos+1+int(b[pos])]
+		pos += 1 + len(id)
+		return id, nil
+	}
+	var err error
+	if hdr.dcid, err = readConnID(); err != nil {
+		return nil, err
+	}
+	if hdr.scid, err = readConnID(); err != nil {
+		return nil, err
+	}
+	if hdr.packetType == packetTypeRetry {
+		hdr.packetLen = len(b)
+		return hdr, nil
+	}
+	if hdr.packetType == packetTypeInitial {
+		tokenLen, n, err := quicvarint.Parse(b[pos:])
+		if err != nil {
+			return nil, errTruncatedPacket
+		}
+		pos += n
+		if uint64(len(b)-pos) < tokenLen {
+			return nil, errTruncatedPacket
+		}
+		hdr.token = b[pos : pos+int(tokenLen)]
+		pos += int(tokenLen)
+	}
+	length, n, err := quicvarint.Parse(b[pos:])
+	if err != nil {
+		return nil, errTruncatedPacket
+	}
+	pos += n
+	if uint64(len(b)-pos) < length {
+		return nil, errTruncatedPacket
+	}
+	hdr.pnOffset = pos
+	hdr.packetLen = pos + int(length)
+	return hdr, nil
+}
+
+// appendHeader appends the unprotected long header for a packet with the given packet number and payload lengths.
+// The Length field always takes 2 bytes, so the header size doesn't depend on the payload.
+func (h *longHeader) appendHeader(b []byte, pn int64, pnLen int, payloadLen int) []byte {
+	b = append(b, 0xc0|h.packetType<<4|byte(pnLen-1))
+	b = binary.BigEndian.AppendUint32(b, h.version)
+	b = append(b, byte(len(h.dcid)))
+	b = append(b, h.dcid...)
+	b = append(b, byte(len(h.scid)))
+	b = append(b, h.scid...)
+	if h.packetType == packetTypeInitial {
+		b = quicvarint.Append(b, uint64(len(h.token)))
+		b = append(b, h.token...)
+	}
+	b = quicvarint.AppendWithLen(b, uint64(pnLen+payloadLen+aeadTagLen), 2)
+	for i := pnLen - 1; i >= 0; i-- {
+		b = append(b, byte(pn>>(8*i)))
+	}
+	return b
+}
+
+// headerLen returns the length of the header written by appendHeader, including the packet number.
+func (h *longHeader) headerLen(pnLen int) int {
+	n := 1 + 4 + 1 + len(h.dcid) + 1 + len(h.scid) + 2 + pnLen
+	if h.packetType == packetTypeInitial {
+		n += quicvarint.Len(uint64(len(h.token))) + len(h.token)
+	}
+	return n
+}
+
+// packetProtector protects and unprotects the packets sent by one of the endpoints.
+type packetProtector struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// newInitialProtectors derives the Initial packet protection of the client and server from the Destination
+// Connection ID of the first Initial packet sent by the client.
+func newInitialProtectors(dcid []byte) (client *packetProtector, server *packetProtector, err error) {
+	initialSecret := hkdf.Extract(sha256.New, dcid, initialSaltV1)
+	if client, err = newPacketProtector(hkdfExpandLabel(initialSecret, "client in", 32)); err != nil {
+		return nil, nil, err
+	}
+	if server, err = newPacketProtector(hkdfExpandLabel(initialSecret, "server in", 32)); err != nil {
+		return nil, nil, err
+	}
+	return client, server, nil
+}
+
+func newPacketProtector(secret []byte) (*packetProtector, error) {
+	block, err := aes.NewCipher(hkdfExpandLabel(secret, "quic key", 16))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(hkdfExpandLabel(secret, "quic hp", 16))
+	if err != nil {
+		return nil, err
+	}
+	return &packetProtector{aead: aead, iv: hkdfExpandLabel(secret, "quic iv", 12), hp: hp}, nil
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label from TLS 1.3 with an empty context.
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	info := make([]byte, 0, 4+6+len(label))
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(6+len(label)))
+	info = append(info, "tls13 "...)
+	info = append(info, label...)
+	info = append(info, 0)
+	out := make([]byte, length)
+	if _, err := hkdf.Expand(sha256.New, secret, info).Read(out); err != nil {
+		panic(fmt.Sprintf("hkdf expansion failed: %v", err))
+	}
+	return out
+}
+
+func (p *packetProtector) nonce(pn int64) []byte {
+	nonce := make([]byte, len(p.iv))
+	copy(nonce, p.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	return nonce
+}
+
+func (p *packetProtector) headerProtectionMask(sample []byte) []byte {
+	mask := make([]byte, headerProtectionBytes)
+	p.hp.Encrypt(mask, sample)
+	return mask
+}
+
+// open removes the protection of the packet described by hdr, and returns its full packet number, packet number
+// length and plaintext payload. largestPN is the largest packet number received so far in the packet number space,
+// or -1 if none. pkt is not modified.
+func (p *packetProtector) open(pkt []byte, hdr *longHeader, largestPN int64) (pn int64, pnLen int, plaintext []byte, err error) {
+	pkt = pkt[:hdr.packetLen]
+	if len(pkt) < hdr.pnOffset+4+headerProtectionBytes {
+		return 0, 0, nil, errTruncatedPacket
+	}
+	mask := p.headerProtectionMask(pkt[hdr.pnOffset+4 : hdr.pnOffset+4+headerProtectionBytes])
+	header := make([]byte, hdr.pnOffset+4)
+	copy(header, pkt)
+	header[0] ^= mask[0] & 0x0f
+	pnLen = int(header[0]&0x3) + 1
+	var truncated int64
+	for i := 0; i < pnLen; i++ {
+		header[hdr.pnOffset+i] ^= mask[1+i]
+		truncated = truncated<<8 | int64(header[hdr.pnOffset+i])
+	}
+	header = header[:hdr.pnOffset+pnLen]
+	pn = decodePacketNumber(largestPN, truncated, pnLen)
+	plaintext, err = p.aead.Open(nil, p.nonce(pn), pkt[hdr.pnOffset+pnLen:], header)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return pn, pnLen, plaintext, nil
+}
+
+// seal appends the protected packet with the header from hdr, the packet number and the payload to b.
+// The payload must be long enough for the header protection sample.
+func (p *packetProtector) seal(b []byte, hdr *longHeader, pn int64, pnLen int, payload []byte) []byte {
+	start := len(b)
+	b = hdr.appendHeader(b, pn, pnLen, len(payload))
+	pnOffset := len(b) - pnLen
+	b = p.aead.Seal(b, p.nonce(pn), payload, b[start:])
+	mask := p.headerProtectionMask(b[pnOffset+4 : pnOffset+4+headerProtectionBytes])
+	b[start] ^= mask[0] & 0x0f
+	for i := 0; i < pnLen; i++ {
+		b[pnOffset+i] ^= mask[1+i]
+	}
+	return b
+}
+
+// minPayloadLen returns the minimum payload length so that the packet has enough bytes for the header protection sample.
+func minPayloadLen(pnLen int) int {
+	return 4 + headerProtectionBytes - pnLen - aeadTagLen
+}
+
+// decodePacketNumber recovers the full packet number from its truncated encoding, as described in
+// https://datatracker.ietf.org/doc/html/rfc9000#appendix-A.3.
+func decodePacketNumber(largestPN int64, truncated int64, pnLen int) int64 {
+	expected := largestPN + 1
+	window := int64(1) << (pnLen * 8)
+	halfWindow := window / 2
+	candidate := (expected &^ (window - 1)) | truncated
+	if candidate <= expected-halfWindow && candidate < (1<<62)-window {
+		return candidate + window
+	}
+	if candidate > expected+halfWindow && candidate >= window {
+		return candidate - window
+	}
+	return candidate
+}
+
+// cryptoFrame is a CRYPTO frame, carrying part of the TLS handshake.
+type cryptoFrame struct {
+	offset uint64
+	data   []byte
+}
+
+func appendCryptoFrame(b []byte, f cryptoFrame) []byte {
+	b = append(b, frameTypeCrypto)
+	b = quicvarint.Append(b, f.offset)
+	b = quicvarint.Append(b, uint64(len(f.data)))
+	return append(b, f.data...)
+}
+
+// varintReader reads consecutive variable-length integers, and keeps the first error.
+type varintReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *varintReader) next() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n, err := quicvarint.Parse(r.b[r.pos:])
+	if err != nil {
+		r.err = errTruncatedPacket
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// skipBytes skips a length-prefixed byte string.
+func (r *varintReader) skipBytes() {
+	length := r.next()
+	if r.err == nil && uint64(len(r.b)-r.pos) < length {
+		r.err = errTruncatedPacket
+	}
+	if r.err == nil {
+		r.pos += int(length)
+	}
+}
+
+// nextFrame returns the type and length of the frame at the start of b. It supports the frames allowed in Initial packets.
+func nextFrame(b []byte) (frameType uint64, frameLen int, err error) {
+	r := &varintReader{b: b}
+	frameType = r.next()
+	switch {
+	case r.err != nil:
+	case frameType == frameTypePadding || frameType == frameTypePing:
+	case frameType == frameTypeAck || frameType == frameTypeAckECN:
+		_, _, frameLen, err = parseAckFrame(b)
+		return frameType, frameLen, err
+	case frameType == frameTypeCrypto:
+		r.next()
+		r.skipBytes()
+	case frameType == frameTypeConnClose:
+		r.next()
+		r.next()
+		r.skipBytes()
+	default:
+		return 0, 0, fmt.Errorf("unexpected frame type %#x in Initial packet", frameType)
+	}
+	return frameType, r.pos, r.err
+}
+
+// parseCryptoFrame parses the CRYPTO frame at the start of b.
+func parseCryptoFrame(b []byte) (cryptoFrame, error) {
+	r := &varintReader{b: b}
+	r.next()
+	offset := r.next()
+	length := r.next()
+	if r.err != nil {
+		return cryptoFrame{}, r.err
+	}
+	if uint64(len(b)-r.pos) < length {
+		return cryptoFrame{}, errTruncatedPacket
+	}
+	return cryptoFrame{offset: offset, data: b[r.pos : r.pos+int(length)]}, nil
+}
+
+// ackRange is a range of acknowledged packet numbers, from smallest to largest, inclusive.
+type ackRange struct {
+	smallest, largest int64
+}
+
+// parseAckFrame parses the ACK frame at the start of b, and returns its ranges in descending order, its ACK Delay
+// field and its length. The ECN counts of ACK frames with ECN are skipped.
+func parseAckFrame(b []byte) (ranges []ackRange, delay uint64, frameLen int, err error) {
+	r := &varintReader{b: b}
+	frameType := r.next()
+	largest := r.next()
+	delay = r.next()
+	rangeCount := r.next()
+	firstRange := r.next()
+	if r.err != nil {
+		return nil, 0, 0, r.err
+	}
+	if firstRange > largest || rangeCount > uint64(len(b)) {
+		return nil, 0, 0, errors.New("invalid ACK frame")
+	}
+	smallest := largest - firstRange
+	ranges = append(ranges, ackRange{int64(smallest), int64(largest)})
+	for i := uint64(0); i < rangeCount; i++ {
+		gap := r.next()
+		length := r.next()
+		if r.err != nil {
+			return nil, 0, 0, r.err
+		}
+		if smallest < gap+2 || smallest-gap-2 < length {
+			return nil, 0, 0, errors.New("invalid ACK frame")
+		}
+		largest = smallest - gap - 2
+		smallest = largest - length
+		ranges = append(ranges, ackRange{int64(smallest), int64(largest)})
+	}
+	if frameType == frameTypeAckECN {
+		r.next()
+		r.next()
+		r.next()
+	}
+	return ranges, delay, r.pos, r.err
+}
+
+// appendAckFrame appends an ACK frame without ECN counts for the ranges, which must be in descending order
+// and not adjacent.
+func appendAckFrame(b []byte, ranges []ackRange, delay uint64) []byte {
+	b = append(b, frameTypeAck)
+	b = quicvarint.Append(b, uint64(ranges[0].largest))
+	b = quicvarint.Append(b, delay)
+	b = quicvarint.Append(b, uint64(len(ranges)-1))
+	b = quicvarint.Append(b, uint64(ranges[0].largest-ranges[0].smallest))
+	for i := 1; i < len(ranges); i++ {
+		b = quicvarint.Append(b, uint64(ranges[i-1].smallest-ranges[i].largest-2))
+		b = quicvarint.Append(b, uint64(ranges[i].largest-ranges[i].smallest))
+	}
+	return b
+}
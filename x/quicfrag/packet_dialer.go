@@ -0,0 +1,309 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package quicfrag splits the QUIC Initial packets with the TLS Client Hello into multiple UDP datagrams, so that
+middleboxes that extract the SNI from the first datagram of a QUIC connection can't find it.
+
+The CRYPTO frames of each Initial packet sent by the client are cut in pieces of at most a given number of bytes,
+which are sent in separate Initial packets, each padded to the minimum size of 1200 bytes. The pieces keep their
+offsets, so the server reassembles the Client Hello as it would for a Client Hello that doesn't fit in a packet.
+
+Since the split creates packets that the QUIC client didn't send, the packet numbers of the Initial packets are
+rewritten, and the acknowledgements from the server are translated back to the packet numbers of the client. Only
+QUIC version 1 is supported. Other traffic is forwarded as is.
+*/
+package quicfrag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// NewPacketDialer creates a [transport.PacketDialer] that splits the CRYPTO frames of the QUIC Initial packets sent on
+// its connections into separate datagrams with at most maxCryptoLen bytes of handshake data each.
+func NewPacketDialer(dialer transport.PacketDialer, maxCryptoLen int) (transport.PacketDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if maxCryptoLen <= 0 {
+		return nil, fmt.Errorf("maxCryptoLen must be positive, got %d", maxCryptoLen)
+	}
+	return transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := dialer.DialPacket(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		return WrapConn(conn, maxCryptoLen), nil
+	}), nil
+}
+
+// WrapConn wraps a connected UDP [net.Conn] used by a QUIC client, and splits the CRYPTO frames of its Initial
+// packets into separate datagrams with at most maxCryptoLen bytes of handshake data each.
+func WrapConn(conn net.Conn, maxCryptoLen int) net.Conn {
+	return &fragConn{Conn: conn, maxCryptoLen: maxCryptoLen, largestClientPN: -1, largestServerPN: -1}
+}
+
+// sentPacket records the packet numbers used on the wire for an Initial packet of the client.
+type sentPacket struct {
+	clientPN int64
+	// The packet was sent with the wire packet numbers from firstWirePN to firstWirePN+count-1.
+	firstWirePN int64
+	count       int64
+}
+
+type fragConn struct {
+	net.Conn
+	maxCryptoLen int
+
+	mu sync.Mutex
+	// client and server protect the Initial packets. They are nil until the first Initial packet.
+	client, server  *packetProtector
+	largestClientPN int64
+	largestServerPN int64
+	nextWirePN      int64
+	sent            []sentPacket
+}
+
+var _ net.Conn = (*fragConn)(nil)
+
+// Write implements [net.Conn].Write. It sends the split Initial packets in separate datagrams.
+func (c *fragConn) Write(p []byte) (int, error) {
+	if !isInitialPacket(p) {
+		return c.Conn.Write(p)
+	}
+	datagrams := c.processOutgoing(p)
+	if datagrams == nil {
+		return c.Conn.Write(p)
+	}
+	for _, datagram := range datagrams {
+		if _, err := c.Conn.Write(datagram); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Read implements [net.Conn].Read. It translates the acknowledgements of the server Initial packets.
+func (c *fragConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err != nil || !isLongHeader(p[:n]) {
+		return n, err
+	}
+	c.mu.Lock()
+	handshaking := c.server != nil
+	c.mu.Unlock()
+	if !handshaking {
+		return n, nil
+	}
+	return copy(p, c.processIncoming(p[:n])), nil
+}
+
+// isInitialPacket reports whether b starts with a long header packet of type Initial.
+func isInitialPacket(b []byte) bool {
+	return isLongHeader(b) && (b[0]>>4)&0x3 == packetTypeInitial
+}
+
+// processOutgoing returns the datagrams to send for the datagram p that starts with an Initial packet,
+// or nil to send p as is.
+func (c *fragConn) processOutgoing(p []byte) [][]byte {
+	hdr, err := parseLongHeader(p)
+	if err != nil || hdr.version != version1 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil {
+		if c.client, c.server, err = newInitialProtectors(hdr.dcid); err != nil {
+			return nil
+		}
+	}
+	clientPN, _, plaintext, err := c.client.open(p, hdr, c.largestClientPN)
+	if err != nil {
+		return nil
+	}
+	if clientPN > c.largestClientPN {
+		c.largestClientPN = clientPN
+	}
+	payloads := c.splitPayload(plaintext)
+	coalesced := p[hdr.packetLen:]
+	const pnLen = 4
+	sent := sentPacket{clientPN: clientPN, firstWirePN: c.nextWirePN, count: int64(len(payloads))}
+	c.nextWirePN += sent.count
+	c.sent = append(c.sent, sent)
+
+	datagrams := make([][]byte, 0, len(payloads))
+	for i, payload := range payloads {
+		datagramLen := hdr.headerLen(pnLen) + len(payload) + aeadTagLen
+		if i == len(payloads)-1 {
+			datagramLen += len(coalesced)
+		}
+		if len(payloads) > 1 && datagramLen < minInitialDatagramLen {
+			payload = append(payload, make([]byte, minInitialDatagramLen-datagramLen)...)
+		}
+		if padding := minPayloadLen(pnLen) - len(payload); padding > 0 {
+			payload = append(payload, make([]byte, padding)...)
+		}
+		datagram := c.client.seal(nil, hdr, sent.firstWirePN+int64(i), pnLen, payload)
+		if i == len(payloads)-1 {
+			datagram = append(datagram, coalesced...)
+		}
+		datagrams = append(datagrams, datagram)
+	}
+	return datagrams
+}
+
+// splitPayload returns the payloads of the packets to send for the plaintext payload of a client Initial packet.
+// The CRYPTO frames are split in pieces of at most maxCryptoLen bytes, one per packet, and the other frames go
+// in the first packet. The PADDING frames are dropped, since the packets are padded later.
+func (c *fragConn) splitPayload(plaintext []byte) [][]byte {
+	var other []byte
+	var pieces []cryptoFrame
+	for b := plaintext; len(b) > 0; {
+		frameType, frameLen, err := nextFrame(b)
+		if err != nil {
+			return [][]byte{plaintext}
+		}
+		switch frameType {
+		case frameTypePadding:
+		case frameTypeCrypto:
+			frame, err := parseCryptoFrame(b)
+			if err != nil {
+				return [][]byte{plaintext}
+			}
+			for len(frame.data) > 0 {
+				pieceLen := c.maxCryptoLen
+				if pieceLen > len(frame.data) {
+					pieceLen = len(frame.data)
+				}
+				pieces = append(pieces, cryptoFrame{offset: frame.offset, data: frame.data[:pieceLen]})
+				frame.offset += uint64(pieceLen)
+				frame.data = frame.data[pieceLen:]
+			}
+		default:
+			other = append(other, b[:frameLen]...)
+		}
+		b = b[frameLen:]
+	}
+	if len(pieces) <= 1 {
+		return [][]byte{plaintext}
+	}
+	payloads := make([][]byte, len(pieces))
+	for i, piece := range pieces {
+		if i == 0 {
+			payloads[i] = append(payloads[i], other...)
+		}
+		payloads[i] = appendCryptoFrame(payloads[i], piece)
+	}
+	return payloads
+}
+
+// processIncoming returns the datagram with the acknowledgements in the server Initial packets translated to the
+// packet numbers of the client.
+func (c *fragConn) processIncoming(datagram []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []byte
+	for rest := datagram; len(rest) > 0; {
+		if !isLongHeader(rest) {
+			return append(out, rest...)
+		}
+		hdr, err := parseLongHeader(rest)
+		if err != nil || hdr.version != version1 {
+			return append(out, rest...)
+		}
+		packet := rest[:hdr.packetLen]
+		rest = rest[hdr.packetLen:]
+		switch {
+		case hdr.packetType == packetTypeRetry:
+			// The client will derive new Initial keys from the connection ID in the Retry packet.
+			c.client, c.server = nil, nil
+			c.largestServerPN = -1
+		case hdr.packetType == packetTypeInitial && c.server != nil:
+			if translated := c.translateServerInitial(packet, hdr); translated != nil {
+				out = append(out, translated...)
+				continue
+			}
+		}
+		out = append(out, packet...)
+	}
+	return out
+}
+
+// translateServerInitial returns the server Initial packet with its ACK frames translated, or nil if the packet
+// can't be decrypted.
+func (c *fragConn) translateServerInitial(packet []byte, hdr *longHeader) []byte {
+	pn, pnLen, plaintext, err := c.server.open(packet, hdr, c.largestServerPN)
+	if err != nil {
+		return nil
+	}
+	if pn > c.largestServerPN {
+		c.largestServerPN = pn
+	}
+	payload := make([]byte, 0, len(plaintext))
+	for b := plaintext; len(b) > 0; {
+		frameType, frameLen, err := nextFrame(b)
+		if err != nil {
+			return nil
+		}
+		if frameType == frameTypeAck || frameType == frameTypeAckECN {
+			ranges, delay, _, err := parseAckFrame(b)
+			if err != nil {
+				return nil
+			}
+			if clientRanges := c.clientAckRanges(ranges); len(clientRanges) > 0 {
+				payload = appendAckFrame(payload, clientRanges, delay)
+			}
+		} else {
+			payload = append(payload, b[:frameLen]...)
+		}
+		b = b[frameLen:]
+	}
+	if padding := minPayloadLen(pnLen) - len(payload); padding > 0 {
+		payload = append(payload, make([]byte, padding)...)
+	}
+	return c.server.seal(nil, hdr, pn, pnLen, payload)
+}
+
+// clientAckRanges translates the acknowledged wire packet numbers to client packet numbers. A client packet is
+// acknowledged only if all the packets it was split into are.
+func (c *fragConn) clientAckRanges(wireRanges []ackRange) []ackRange {
+	var clientRanges []ackRange
+	// c.sent is in ascending order, and the ranges must be in descending order.
+	for i := len(c.sent) - 1; i >= 0; i-- {
+		sent := c.sent[i]
+		lastWirePN := sent.firstWirePN + sent.count - 1
+		acked := false
+		for _, r := range wireRanges {
+			if r.smallest <= sent.firstWirePN && lastWirePN <= r.largest {
+				acked = true
+				break
+			}
+		}
+		if !acked {
+			continue
+		}
+		if n := len(clientRanges); n > 0 && clientRanges[n-1].smallest == sent.clientPN+1 {
+			clientRanges[n-1].smallest = sent.clientPN
+		} else {
+			clientRanges = append(clientRanges, ackRange{sent.clientPN, sent.clientPN})
+		}
+	}
+	return clientRanges
+}
@@ -0,0 +1,225 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicfrag
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/quicadapter"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// Test vectors from https://datatracker.ietf.org/doc/html/rfc9001#appendix-A.1.
+func TestInitialSecrets(t *testing.T) {
+	client, server, err := newInitialProtectors(mustDecodeHex(t, "8394c8f03e515708"))
+	require.NoError(t, err)
+	require.Equal(t, mustDecodeHex(t, "fa044b2f42a3fd3b46fb255c"), client.iv)
+	require.Equal(t, mustDecodeHex(t, "0ac1493ca1905853b0bba03e"), server.iv)
+
+	// The header protection mask of the sample in the client Initial packet of appendix A.2.
+	mask := client.headerProtectionMask(mustDecodeHex(t, "d1b1c98dd7689fb8ec11d242b123dc9b"))
+	require.Equal(t, mustDecodeHex(t, "437b9aec36"), mask[:5])
+}
+
+func TestSealOpen(t *testing.T) {
+	client, _, err := newInitialProtectors([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	require.NoError(t, err)
+	hdr := &longHeader{packetType: packetTypeInitial, version: version1, dcid: []byte{1, 2, 3, 4, 5, 6, 7, 8}, scid: []byte{9}, token: []byte{}}
+	payload := appendCryptoFrame(nil, cryptoFrame{offset: 3, data: []byte("hello")})
+	packet := client.seal(nil, hdr, 300, 2, payload)
+
+	parsed, err := parseLongHeader(packet)
+	require.NoError(t, err)
+	require.Equal(t, len(packet), parsed.packetLen)
+	require.Equal(t, hdr.dcid, parsed.dcid)
+	pn, pnLen, plaintext, err := client.open(packet, parsed, 299)
+	require.NoError(t, err)
+	require.Equal(t, int64(300), pn)
+	require.Equal(t, 2, pnLen)
+	require.Equal(t, payload, plaintext)
+
+	frame, err := parseCryptoFrame(plaintext)
+	require.NoError(t, err)
+	require.Equal(t, cryptoFrame{offset: 3, data: []byte("hello")}, frame)
+}
+
+func TestAckFrame(t *testing.T) {
+	ranges := []ackRange{{10, 12}, {5, 7}, {0, 0}}
+	frame := appendAckFrame(nil, ranges, 42)
+	frameType, frameLen, err := nextFrame(frame)
+	require.NoError(t, err)
+	require.Equal(t, uint64(frameTypeAck), frameType)
+	require.Equal(t, len(frame), frameLen)
+	parsed, delay, _, err := parseAckFrame(frame)
+	require.NoError(t, err)
+	require.Equal(t, ranges, parsed)
+	require.Equal(t, uint64(42), delay)
+}
+
+func TestClientAckRanges(t *testing.T) {
+	c := &fragConn{sent: []sentPacket{
+		{clientPN: 0, firstWirePN: 0, count: 3},
+		{clientPN: 1, firstWirePN: 3, count: 1},
+		{clientPN: 2, firstWirePN: 4, count: 2},
+	}}
+	// Packet 0 is fully acknowledged, packet 2 only in part.
+	require.Equal(t, []ackRange{{0, 1}}, c.clientAckRanges([]ackRange{{0, 4}}))
+	require.Equal(t, []ackRange{{2, 2}, {0, 0}}, c.clientAckRanges([]ackRange{{4, 5}, {0, 2}}))
+	require.Empty(t, c.clientAckRanges([]ackRange{{1, 2}}))
+}
+
+func TestNewPacketDialer(t *testing.T) {
+	_, err := NewPacketDialer(nil, 10)
+	require.Error(t, err)
+	_, err = NewPacketDialer(&transport.UDPDialer{}, 0)
+	require.Error(t, err)
+}
+
+// recordingConn records the datagrams written to the connection.
+type recordingConn struct {
+	net.Conn
+	mu        sync.Mutex
+	datagrams [][]byte
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	c.datagrams = append(c.datagrams, append([]byte{}, p...))
+	c.mu.Unlock()
+	return c.Conn.Write(p)
+}
+
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "quic.example"},
+		DNSNames:     []string{"quic.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, roots
+}
+
+func TestPacketDialerHandshake(t *testing.T) {
+	cert, roots := newTestCertificate(t)
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"echo"}}, nil)
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		io.Copy(stream, stream)
+		stream.Close()
+	}()
+
+	var recorder *recordingConn
+	const maxCryptoLen = 50
+	dialer, err := NewPacketDialer(transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := (&transport.UDPDialer{}).DialPacket(ctx, listener.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		recorder = &recordingConn{Conn: conn}
+		return recorder, nil
+	}), maxCryptoLen)
+	require.NoError(t, err)
+	quicDialer, err := quicadapter.NewDialer(dialer)
+	require.NoError(t, err)
+	defer quicDialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := quicDialer.Dial(ctx, "quic.example:443", &tls.Config{RootCAs: roots, NextProtos: []string{"echo"}}, nil)
+	require.NoError(t, err)
+	defer conn.CloseWithError(0, "")
+	stream, err := conn.OpenStreamSync(ctx)
+	require.NoError(t, err)
+	_, err = stream.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	data, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	// Check that the Client Hello was split in padded datagrams.
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	firstHdr, err := parseLongHeader(recorder.datagrams[0])
+	require.NoError(t, err)
+	client, _, err := newInitialProtectors(firstHdr.dcid)
+	require.NoError(t, err)
+	cryptoDatagrams := 0
+	for _, datagram := range recorder.datagrams {
+		if !isInitialPacket(datagram) {
+			continue
+		}
+		hdr, err := parseLongHeader(datagram)
+		require.NoError(t, err)
+		_, _, plaintext, err := client.open(datagram, hdr, -1)
+		require.NoError(t, err)
+		cryptoLen := 0
+		for b := plaintext; len(b) > 0; {
+			frameType, frameLen, err := nextFrame(b)
+			require.NoError(t, err)
+			if frameType == frameTypeCrypto {
+				frame, err := parseCryptoFrame(b)
+				require.NoError(t, err)
+				cryptoLen += len(frame.data)
+			}
+			b = b[frameLen:]
+		}
+		if cryptoLen > 0 {
+			cryptoDatagrams++
+			require.LessOrEqual(t, cryptoLen, maxCryptoLen)
+			require.GreaterOrEqual(t, len(datagram), minInitialDatagramLen)
+		}
+	}
+	require.Greater(t, cryptoDatagrams, 1)
+}
@@ -0,0 +1,74 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type clientContextKey struct{}
+
+// WithClient returns a context that identifies the client for the [NewStreamDialer] dialers.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, client)
+}
+
+// ClientFromContext returns the client set with [WithClient], if any.
+func ClientFromContext(ctx context.Context) (string, bool) {
+	client, ok := ctx.Value(clientContextKey{}).(string)
+	return client, ok
+}
+
+// ClientIP returns the IP of the client that sent the request, which is the default client key of [Handler].
+func ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// Handler is a [http.Handler] that applies the connection limits to the requests, and sets the client in the request
+// context for [NewStreamDialer] to apply the bandwidth limit. Requests over the limits get a 429 Too Many Requests response.
+type Handler struct {
+	limiter *Limiter
+	next    http.Handler
+	// ClientKey returns the key that identifies the client of the request. It's [ClientIP] by default.
+	// Set it to use the authenticated user instead, for example.
+	ClientKey func(req *http.Request) string
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// NewHandler creates a [Handler] that uses the limiter and forwards the allowed requests to next.
+// Each request counts as one connection while it's being served, which for CONNECT requests is the
+// lifetime of the tunnel.
+func NewHandler(limiter *Limiter, next http.Handler) *Handler {
+	return &Handler{limiter: limiter, next: next, ClientKey: ClientIP}
+}
+
+// ServeHTTP implements [http.Handler].ServeHTTP.
+func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	client := h.ClientKey(req)
+	release, err := h.limiter.Acquire(client)
+	if err != nil {
+		http.Error(resp, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+	h.next.ServeHTTP(resp, req.WithContext(WithClient(req.Context(), client)))
+}
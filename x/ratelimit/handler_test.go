@@ -0,0 +1,92 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	limiter, err := NewLimiter(Limits{MaxConnections: 1})
+	require.NoError(t, err)
+
+	var inner *http.Request
+	blocked := false
+	var handler *Handler
+	handler = NewHandler(limiter, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		inner = req
+		// A concurrent request from the same client is rejected.
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+		blocked = rec.Code == http.StatusTooManyRequests
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, blocked)
+	client, ok := ClientFromContext(inner.Context())
+	require.True(t, ok)
+	require.Equal(t, "192.0.2.1", client)
+
+	// The connection was released.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandler_ClientKey(t *testing.T) {
+	limiter, err := NewLimiter(Limits{})
+	require.NoError(t, err)
+	var client string
+	handler := NewHandler(limiter, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		client, _ = ClientFromContext(req.Context())
+	}))
+	handler.ClientKey = func(req *http.Request) string {
+		user, _, _ := req.BasicAuth()
+		return user
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	req.SetBasicAuth("alice", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, "alice", client)
+}
+
+func TestStreamDialer(t *testing.T) {
+	limiter, err := NewLimiter(Limits{BytesPerSecond: 1000})
+	require.NoError(t, err)
+	baseConn := &pipeConn{}
+	dialer, err := NewStreamDialer(transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		return baseConn, nil
+	}), limiter)
+	require.NoError(t, err)
+
+	conn, err := dialer.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, transport.StreamConn(baseConn), conn)
+
+	conn, err = dialer.DialStream(WithClient(context.Background(), "a"), "example.com:443")
+	require.NoError(t, err)
+	require.IsType(t, &limitedConn{}, conn)
+
+	_, err = NewStreamDialer(nil, limiter)
+	require.Error(t, err)
+}
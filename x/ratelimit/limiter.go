@@ -0,0 +1,229 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit provides per-client throttling for proxy servers, so that one client can't monopolize a shared
+// gateway.
+//
+// A [Limiter] tracks the connection rate, concurrent connections and bandwidth of each client, identified by a key
+// such as the client IP or the authenticated user. Use [NewHandler] to apply the limits to an HTTP proxy handler,
+// and [NewStreamDialer] to apply the bandwidth limit to the connections it dials. Other servers can call
+// [Limiter.Acquire] and [Limiter.WrapConn] directly.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"golang.org/x/time/rate"
+)
+
+// ErrLimitExceeded is returned by [Limiter.Acquire] when the client is over its limits.
+var ErrLimitExceeded = errors.New("client limit exceeded")
+
+// minByteBurst is the smallest bandwidth burst, so that reads and writes are not split into tiny pieces.
+const minByteBurst = 16 * 1024
+
+// Limits are the limits applied to each client. Zero values mean no limit.
+type Limits struct {
+	// ConnectionsPerSecond is the sustained rate of new connections.
+	ConnectionsPerSecond float64
+	// ConnectionBurst is the number of connections that can be opened at once, above the rate.
+	// If zero, it's ConnectionsPerSecond rounded up.
+	ConnectionBurst int
+	// MaxConnections is the maximum number of concurrent connections.
+	MaxConnections int
+	// BytesPerSecond is the bandwidth, shared by all the connections of the client, counting both directions.
+	BytesPerSecond int
+}
+
+// Limiter enforces [Limits] per client. It's safe for concurrent use.
+type Limiter struct {
+	limits Limits
+
+	mu      sync.Mutex
+	clients map[string]*clientState
+	// lastSweep is when idle clients were last removed.
+	lastSweep time.Time
+}
+
+type clientState struct {
+	connections *rate.Limiter
+	bytes       *rate.Limiter
+	active      int
+}
+
+// NewLimiter creates a [Limiter] with the given limits.
+func NewLimiter(limits Limits) (*Limiter, error) {
+	if limits.ConnectionsPerSecond < 0 || limits.ConnectionBurst < 0 || limits.MaxConnections < 0 || limits.BytesPerSecond < 0 {
+		return nil, errors.New("limits must not be negative")
+	}
+	return &Limiter{limits: limits, clients: make(map[string]*clientState)}, nil
+}
+
+func (l *Limiter) newClientState() *clientState {
+	state := &clientState{}
+	if l.limits.ConnectionsPerSecond > 0 {
+		burst := l.limits.ConnectionBurst
+		if burst == 0 {
+			burst = int(math.Ceil(l.limits.ConnectionsPerSecond))
+		}
+		state.connections = rate.NewLimiter(rate.Limit(l.limits.ConnectionsPerSecond), burst)
+	}
+	if l.limits.BytesPerSecond > 0 {
+		state.bytes = rate.NewLimiter(rate.Limit(l.limits.BytesPerSecond), max(l.limits.BytesPerSecond, minByteBurst))
+	}
+	return state
+}
+
+// isIdle returns whether the state has no connections and full buckets, in which case it can be dropped
+// without affecting the limits.
+func (s *clientState) isIdle(now time.Time) bool {
+	if s.active > 0 {
+		return false
+	}
+	for _, limiter := range []*rate.Limiter{s.connections, s.bytes} {
+		if limiter != nil && limiter.TokensAt(now) < float64(limiter.Burst()) {
+			return false
+		}
+	}
+	return true
+}
+
+// sweep removes the idle clients, at most once a minute. It must be called with the lock held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for client, state := range l.clients {
+		if state.isIdle(now) {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// Acquire registers a new connection for the client. It returns [ErrLimitExceeded] if the client is over the
+// connection rate or the maximum number of connections. Otherwise, the returned function must be called when the
+// connection is done.
+func (l *Limiter) Acquire(client string) (release func(), err error) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	state, ok := l.clients[client]
+	if !ok {
+		state = l.newClientState()
+		l.clients[client] = state
+	}
+	if l.limits.MaxConnections > 0 && state.active >= l.limits.MaxConnections {
+		return nil, ErrLimitExceeded
+	}
+	if state.connections != nil && !state.connections.AllowN(now, 1) {
+		return nil, ErrLimitExceeded
+	}
+	state.active++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			state.active--
+		})
+	}, nil
+}
+
+// bytesLimiter returns the bandwidth limiter of the client, or nil if there's no bandwidth limit.
+func (l *Limiter) bytesLimiter(client string) *rate.Limiter {
+	if l.limits.BytesPerSecond == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state, ok := l.clients[client]
+	if !ok {
+		state = l.newClientState()
+		l.clients[client] = state
+	}
+	return state.bytes
+}
+
+// WrapConn returns a connection that limits the bandwidth of conn to the client limit. Waits for bandwidth are
+// canceled when the context is done or the connection is closed.
+func (l *Limiter) WrapConn(ctx context.Context, client string, conn transport.StreamConn) transport.StreamConn {
+	limiter := l.bytesLimiter(client)
+	if limiter == nil {
+		return conn
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &limitedConn{
+		StreamConn: transport.WrapConn(conn, &limitedReader{ctx, conn, limiter}, &limitedWriter{ctx, conn, limiter}),
+		cancel:     cancel,
+	}
+}
+
+type limitedConn struct {
+	transport.StreamConn
+	cancel context.CancelFunc
+}
+
+func (c *limitedConn) Close() error {
+	c.cancel()
+	return c.StreamConn.Close()
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	conn    transport.StreamConn
+	limiter *rate.Limiter
+}
+
+func (r *limitedReader) Read(b []byte) (int, error) {
+	if len(b) > r.limiter.Burst() {
+		b = b[:r.limiter.Burst()]
+	}
+	n, err := r.conn.Read(b)
+	if n > 0 {
+		// We can only charge after reading, since we don't know how much we'll get.
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+type limitedWriter struct {
+	ctx     context.Context
+	conn    transport.StreamConn
+	limiter *rate.Limiter
+}
+
+func (w *limitedWriter) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		chunk := b[written:min(len(b), written+w.limiter.Burst())]
+		if err := w.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
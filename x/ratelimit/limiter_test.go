@@ -0,0 +1,151 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLimiter_Negative(t *testing.T) {
+	_, err := NewLimiter(Limits{MaxConnections: -1})
+	require.Error(t, err)
+}
+
+func TestLimiter_MaxConnections(t *testing.T) {
+	limiter, err := NewLimiter(Limits{MaxConnections: 2})
+	require.NoError(t, err)
+
+	release1, err := limiter.Acquire("a")
+	require.NoError(t, err)
+	release2, err := limiter.Acquire("a")
+	require.NoError(t, err)
+	_, err = limiter.Acquire("a")
+	require.ErrorIs(t, err, ErrLimitExceeded)
+
+	// Other clients are independent.
+	releaseB, err := limiter.Acquire("b")
+	require.NoError(t, err)
+	releaseB()
+
+	release1()
+	// Release is idempotent.
+	release1()
+	release3, err := limiter.Acquire("a")
+	require.NoError(t, err)
+	_, err = limiter.Acquire("a")
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	release2()
+	release3()
+}
+
+func TestLimiter_ConnectionRate(t *testing.T) {
+	limiter, err := NewLimiter(Limits{ConnectionsPerSecond: 0.001, ConnectionBurst: 3})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		release, err := limiter.Acquire("a")
+		require.NoError(t, err)
+		release()
+	}
+	_, err = limiter.Acquire("a")
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	_, err = limiter.Acquire("b")
+	require.NoError(t, err)
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	limiter, err := NewLimiter(Limits{MaxConnections: 1})
+	require.NoError(t, err)
+	release, err := limiter.Acquire("a")
+	require.NoError(t, err)
+	releaseB, err := limiter.Acquire("b")
+	require.NoError(t, err)
+	releaseB()
+
+	limiter.mu.Lock()
+	limiter.sweep(time.Now().Add(time.Hour))
+	_, hasA := limiter.clients["a"]
+	_, hasB := limiter.clients["b"]
+	limiter.mu.Unlock()
+	require.True(t, hasA)
+	require.False(t, hasB)
+	release()
+}
+
+func TestLimiter_WrapConn(t *testing.T) {
+	const rate = 100_000
+	limiter, err := NewLimiter(Limits{BytesPerSecond: rate})
+	require.NoError(t, err)
+
+	server, client := net.Pipe()
+	defer server.Close()
+	conn := limiter.WrapConn(context.Background(), "a", &pipeConn{client})
+	defer conn.Close()
+
+	// The first burst goes through, then the rest is throttled.
+	payload := make([]byte, 2*rate)
+	go func() {
+		io.Copy(io.Discard, server)
+	}()
+	start := time.Now()
+	n, err := conn.Write(payload)
+	require.NoError(t, err)
+	require.Equal(t, len(payload), n)
+	require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
+
+func TestLimiter_WrapConnCloseCancelsWait(t *testing.T) {
+	limiter, err := NewLimiter(Limits{BytesPerSecond: 1})
+	require.NoError(t, err)
+	server, client := net.Pipe()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+	conn := limiter.WrapConn(context.Background(), "a", &pipeConn{client})
+
+	done := make(chan error)
+	go func() {
+		_, err := conn.Write(make([]byte, 2*minByteBurst))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-done:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write was not canceled")
+	}
+}
+
+func TestLimiter_WrapConnNoLimit(t *testing.T) {
+	limiter, err := NewLimiter(Limits{})
+	require.NoError(t, err)
+	conn := &pipeConn{}
+	require.Equal(t, transport.StreamConn(conn), limiter.WrapConn(context.Background(), "a", conn))
+}
+
+// pipeConn adapts a [net.Pipe] connection to a [transport.StreamConn].
+type pipeConn struct {
+	net.Conn
+}
+
+func (c *pipeConn) CloseRead() error  { return nil }
+func (c *pipeConn) CloseWrite() error { return nil }
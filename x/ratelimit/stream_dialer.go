@@ -0,0 +1,58 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+type streamDialer struct {
+	dialer  transport.StreamDialer
+	limiter *Limiter
+}
+
+var _ transport.StreamDialer = (*streamDialer)(nil)
+
+// NewStreamDialer creates a [transport.StreamDialer] that limits the bandwidth of the connections dialed on behalf
+// of a client, as set in the context with [WithClient]. Connections without a client in the context are not limited.
+//
+// Note that the connections pooled by an HTTP client count towards the client that dialed them, even if reused
+// for other clients.
+func NewStreamDialer(dialer transport.StreamDialer, limiter *Limiter) (transport.StreamDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if limiter == nil {
+		return nil, errors.New("argument limiter must not be nil")
+	}
+	return &streamDialer{dialer: dialer, limiter: limiter}, nil
+}
+
+// DialStream implements [transport.StreamDialer].DialStream.
+func (d *streamDialer) DialStream(ctx context.Context, raddr string) (transport.StreamConn, error) {
+	conn, err := d.dialer.DialStream(ctx, raddr)
+	if err != nil {
+		return nil, err
+	}
+	client, ok := ClientFromContext(ctx)
+	if !ok {
+		return conn, nil
+	}
+	// The connection may outlive the dial context, as with pooled connections.
+	return d.limiter.WrapConn(context.WithoutCancel(ctx), client, conn), nil
+}
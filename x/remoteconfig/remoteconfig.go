@@ -0,0 +1,323 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package remoteconfig fetches signed configs, such as dialer configs for [configurl], so that a compromised
+distribution channel can't inject configs.
+
+The config is served over HTTPS along with a detached Ed25519 signature file, at the config URL with ".sig" appended.
+The signature file starts with the version of the config and its expiry time, followed by the base64-encoded
+signatures, one per line to support key rotation:
+
+	version: 3
+	expires: 2025-07-01T00:00:00Z
+	<base64 signature>
+
+Each signature covers the [SignedMessage] for the config URL, version, expiry and config bytes, so a config can't be
+served from another URL, or with a different version or expiry. The [Client] accepts the config if any signature
+verifies with any of its pinned public keys, it hasn't expired and its version is not lower than the version of the
+last good config, so old configs can't be replayed. It keeps the last good config in a cache to fall back to when
+the fetch fails.
+
+To sign a config, you can use OpenSSL with an Ed25519 key:
+
+	printf 'outline-remoteconfig\nurl: %s\nversion: %d\nexpires: %s\n\n' "$URL" 3 2025-07-01T00:00:00Z |
+	  cat - config.txt | openssl pkeyutl -sign -inkey key.pem -rawin | base64
+
+[configurl]: https://pkg.go.dev/github.com/Jigsaw-Code/outline-sdk/x/configurl
+*/
+package remoteconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxConfigSize is the maximum size of the config and signature downloads.
+const MaxConfigSize = 1 << 20
+
+// ErrInvalidSignature is returned when no signature of the config verifies with the pinned keys.
+var ErrInvalidSignature = errors.New("invalid config signature")
+
+// ErrExpired is returned when the config has expired.
+var ErrExpired = errors.New("config has expired")
+
+// ErrRollback is returned when the config version is lower than the version of the last good config.
+var ErrRollback = errors.New("config version is lower than the last good config")
+
+// Cache persists the last good config. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value for the key, and whether it was found.
+	Get(key string) (value []byte, ok bool)
+	// Put stores the value for the key. If value is nil, it removes the entry.
+	Put(key string, value []byte)
+}
+
+// Client fetches signed configs from a URL.
+type Client struct {
+	url        string
+	publicKeys []ed25519.PublicKey
+	// HTTPClient downloads the config. If nil, [http.DefaultClient] is used. Set it to fetch the config over a
+	// circumvention dialer.
+	HTTPClient *http.Client
+	// Cache keeps the last good config, if not nil.
+	Cache Cache
+	// now returns the current time. If nil, [time.Now] is used.
+	now func() time.Time
+}
+
+// NewClient creates a [Client] for the config at configURL, which must be an https URL, signed with the private key
+// of any of the publicKeys.
+func NewClient(configURL string, publicKeys ...ed25519.PublicKey) (*Client, error) {
+	parsedURL, err := url.Parse(configURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config URL: %w", err)
+	}
+	if parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("config URL must use https, found %q", parsedURL.Scheme)
+	}
+	if len(publicKeys) == 0 {
+		return nil, errors.New("at least one public key is required")
+	}
+	for _, key := range publicKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key size %v", len(key))
+		}
+	}
+	return &Client{url: configURL, publicKeys: publicKeys}, nil
+}
+
+// ParsePublicKey parses a base64-encoded Ed25519 public key, as embedded in apps.
+func ParsePublicKey(keyBase64 string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(keyBase64))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size %v", len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Result is the result of [Client.Fetch].
+type Result struct {
+	// Config is the verified config.
+	Config []byte
+	// Version is the version of the config.
+	Version uint64
+	// Expires is when the config expires.
+	Expires time.Time
+	// FromCache is whether Config is the last good config, because the fetch failed.
+	FromCache bool
+	// FetchErr is the error of the failed fetch, if FromCache is true.
+	FetchErr error
+}
+
+func (c *Client) configCacheKey() string {
+	return "remoteconfig:" + c.url
+}
+
+func (c *Client) signatureCacheKey() string {
+	return "remoteconfig:" + c.url + ".sig"
+}
+
+// Fetch downloads and verifies the config, and stores it in the cache. If that fails, it returns the last good
+// config from the cache, verified again, or the fetch error if there's none. It returns [ErrRollback] as the fetch
+// error if the downloaded config is older than the last good config.
+func (c *Client) Fetch(ctx context.Context) (*Result, error) {
+	config, err := c.fetchVerified(ctx)
+	if err == nil {
+		if c.Cache != nil {
+			c.Cache.Put(c.configCacheKey(), config.config)
+			c.Cache.Put(c.signatureCacheKey(), config.signatureFile)
+		}
+		return &Result{Config: config.config, Version: config.version, Expires: config.expires}, nil
+	}
+	if cached, ok := c.lastGood(); ok {
+		return &Result{
+			Config: cached.config, Version: cached.version, Expires: cached.expires, FromCache: true, FetchErr: err,
+		}, nil
+	}
+	return nil, err
+}
+
+// LastGood returns the last good config from the cache, if its signature still verifies and it hasn't expired.
+func (c *Client) LastGood() ([]byte, bool) {
+	cached, ok := c.lastGood()
+	if !ok {
+		return nil, false
+	}
+	return cached.config, true
+}
+
+func (c *Client) lastGood() (*signedConfig, bool) {
+	cached, err := c.cached()
+	if err != nil || cached == nil {
+		return nil, false
+	}
+	if c.checkExpiry(cached) != nil {
+		return nil, false
+	}
+	return cached, true
+}
+
+// cached returns the config in the cache, which may have expired, or nil if there's none.
+func (c *Client) cached() (*signedConfig, error) {
+	if c.Cache == nil {
+		return nil, nil
+	}
+	config, ok := c.Cache.Get(c.configCacheKey())
+	if !ok {
+		return nil, nil
+	}
+	signatureFile, ok := c.Cache.Get(c.signatureCacheKey())
+	if !ok {
+		return nil, nil
+	}
+	return c.verify(config, signatureFile)
+}
+
+func (c *Client) fetchVerified(ctx context.Context) (*signedConfig, error) {
+	config, err := c.download(ctx, c.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download config: %w", err)
+	}
+	signatureFile, err := c.download(ctx, c.url+".sig")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download signature: %w", err)
+	}
+	fetched, err := c.verify(config, signatureFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkExpiry(fetched); err != nil {
+		return nil, err
+	}
+	// Compare with the cached config even if it expired, since an expired config can't be older than the
+	// config it replaced.
+	if cached, err := c.cached(); err == nil && cached != nil && fetched.version < cached.version {
+		return nil, fmt.Errorf("%w: got version %v, last good version is %v", ErrRollback, fetched.version, cached.version)
+	}
+	return fetched, nil
+}
+
+func (c *Client) checkExpiry(config *signedConfig) error {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	if !now().Before(config.expires) {
+		return fmt.Errorf("%w: expired at %v", ErrExpired, config.expires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// signedConfig is a config with a verified signature file.
+type signedConfig struct {
+	config        []byte
+	signatureFile []byte
+	version       uint64
+	expires       time.Time
+}
+
+// SignedMessage returns the message that the config signatures cover, for a config at configURL with the given
+// version and expiry time. The expiry time is formatted in RFC 3339 in UTC, with no fractional seconds.
+func SignedMessage(configURL string, version uint64, expires time.Time, config []byte) []byte {
+	header := fmt.Sprintf("outline-remoteconfig\nurl: %s\nversion: %d\nexpires: %s\n\n",
+		configURL, version, expires.UTC().Format(time.RFC3339))
+	return append([]byte(header), config...)
+}
+
+// verify parses the signature file and checks that one of its signatures verifies the config with a pinned key.
+func (c *Client) verify(config []byte, signatureFile []byte) (*signedConfig, error) {
+	verified := &signedConfig{config: config, signatureFile: signatureFile}
+	var hasVersion, hasExpires bool
+	var signatures [][]byte
+	for _, line := range bytes.Split(signatureFile, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("version:")); ok {
+			version, err := strconv.ParseUint(string(bytes.TrimSpace(value)), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid version: %w", ErrInvalidSignature, err)
+			}
+			verified.version, hasVersion = version, true
+			continue
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("expires:")); ok {
+			expires, err := time.Parse(time.RFC3339, string(bytes.TrimSpace(value)))
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid expiry time: %w", ErrInvalidSignature, err)
+			}
+			verified.expires, hasExpires = expires, true
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil || len(signature) != ed25519.SignatureSize {
+			continue
+		}
+		signatures = append(signatures, signature)
+	}
+	if !hasVersion || !hasExpires {
+		return nil, fmt.Errorf("%w: signature file must have the version and expiry time", ErrInvalidSignature)
+	}
+	message := SignedMessage(c.url, verified.version, verified.expires, config)
+	for _, signature := range signatures {
+		for _, key := range c.publicKeys {
+			if ed25519.Verify(key, message, signature) {
+				return verified, nil
+			}
+		}
+	}
+	return nil, ErrInvalidSignature
+}
+
+func (c *Client) download(ctx context.Context, url string) ([]byte, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %v", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxConfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxConfigSize {
+		return nil, fmt.Errorf("response is larger than %v bytes", MaxConfigSize)
+	}
+	return body, nil
+}
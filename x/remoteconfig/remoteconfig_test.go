@@ -0,0 +1,281 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteconfig
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func (c *mapCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.entries[key]
+	return value, ok
+}
+
+func (c *mapCache) Put(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string][]byte)
+	}
+	if value == nil {
+		delete(c.entries, key)
+		return
+	}
+	c.entries[key] = value
+}
+
+// configServer serves a config and its signature file.
+type configServer struct {
+	mu        sync.Mutex
+	url       string
+	config    string
+	signature string
+	fail      bool
+}
+
+// set signs the config for a day.
+func (s *configServer) set(config string, version uint64, keys ...ed25519.PrivateKey) {
+	s.setWithExpiry(config, version, time.Now().Add(24*time.Hour), keys...)
+}
+
+func (s *configServer) setWithExpiry(config string, version uint64, expires time.Time, keys ...ed25519.PrivateKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+	s.signature = fmt.Sprintf("version: %v\nexpires: %v\n", version, expires.UTC().Format(time.RFC3339))
+	message := SignedMessage(s.url, version, expires, []byte(config))
+	for _, key := range keys {
+		s.signature += base64.StdEncoding.EncodeToString(ed25519.Sign(key, message)) + "\n"
+	}
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	switch r.URL.Path {
+	case "/config":
+		w.Write([]byte(s.config))
+	case "/config.sig":
+		w.Write([]byte(s.signature))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return publicKey, privateKey
+}
+
+func newTestClient(t *testing.T, server *configServer, keys ...ed25519.PublicKey) *Client {
+	httpServer := httptest.NewTLSServer(server)
+	t.Cleanup(httpServer.Close)
+	server.url = httpServer.URL + "/config"
+	client, err := NewClient(server.url, keys...)
+	require.NoError(t, err)
+	client.HTTPClient = httpServer.Client()
+	client.Cache = &mapCache{}
+	return client
+}
+
+func TestFetch(t *testing.T) {
+	publicKey, privateKey := newTestKey(t)
+	server := &configServer{}
+	client := newTestClient(t, server, publicKey)
+	server.set("split:2", 1, privateKey)
+
+	result, err := client.Fetch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "split:2", string(result.Config))
+	require.Equal(t, uint64(1), result.Version)
+	require.False(t, result.FromCache)
+	lastGood, ok := client.LastGood()
+	require.True(t, ok)
+	require.Equal(t, "split:2", string(lastGood))
+}
+
+func TestFetch_FallbackToLastGood(t *testing.T) {
+	publicKey, privateKey := newTestKey(t)
+	_, attackerKey := newTestKey(t)
+	server := &configServer{}
+	client := newTestClient(t, server, publicKey)
+	server.set("split:2", 1, privateKey)
+	_, err := client.Fetch(context.Background())
+	require.NoError(t, err)
+
+	// An injected config is rejected.
+	server.set("socks5://attacker.example:1080", 2, attackerKey)
+	result, err := client.Fetch(context.Background())
+	require.NoError(t, err)
+	require.True(t, result.FromCache)
+	require.ErrorIs(t, result.FetchErr, ErrInvalidSignature)
+	require.Equal(t, "split:2", string(result.Config))
+
+	// So is an unavailable server.
+	server.mu.Lock()
+	server.fail = true
+	server.mu.Unlock()
+	result, err = client.Fetch(context.Background())
+	require.NoError(t, err)
+	require.True(t, result.FromCache)
+	require.Error(t, result.FetchErr)
+	require.Equal(t, "split:2", string(result.Config))
+
+	// And a tampered cache.
+	client.Cache.Put(client.configCacheKey(), []byte("socks5://attacker.example:1080"))
+	_, err = client.Fetch(context.Background())
+	require.Error(t, err)
+}
+
+func TestFetch_KeyRotation(t *testing.T) {
+	oldPublicKey, oldPrivateKey := newTestKey(t)
+	newPublicKey, newPrivateKey := newTestKey(t)
+	server := &configServer{}
+	for _, key := range []ed25519.PublicKey{oldPublicKey, newPublicKey} {
+		client := newTestClient(t, server, key)
+		// The config is signed with both keys during the rotation.
+		server.set("tlsfrag:1", 1, oldPrivateKey, newPrivateKey)
+		result, err := client.Fetch(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "tlsfrag:1", string(result.Config))
+	}
+}
+
+func TestFetch_NoCache(t *testing.T) {
+	publicKey, _ := newTestKey(t)
+	_, otherKey := newTestKey(t)
+	server := &configServer{}
+	client := newTestClient(t, server, publicKey)
+	server.set("split:2", 1, otherKey)
+	client.Cache = nil
+	_, err := client.Fetch(context.Background())
+	require.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestFetch_Rollback(t *testing.T) {
+	publicKey, privateKey := newTestKey(t)
+	server := &configServer{}
+	client := newTestClient(t, server, publicKey)
+	server.set("split:2", 1, privateKey)
+	_, err := client.Fetch(context.Background())
+	require.NoError(t, err)
+	server.set("tlsfrag:1", 2, privateKey)
+	result, err := client.Fetch(context.Background())
+	require.NoError(t, err)
+	require.False(t, result.FromCache)
+	require.Equal(t, "tlsfrag:1", string(result.Config))
+
+	// The old config is still validly signed, but it can't be replayed.
+	server.set("split:2", 1, privateKey)
+	result, err = client.Fetch(context.Background())
+	require.NoError(t, err)
+	require.True(t, result.FromCache)
+	require.ErrorIs(t, result.FetchErr, ErrRollback)
+	require.Equal(t, "tlsfrag:1", string(result.Config))
+	require.Equal(t, uint64(2), result.Version)
+
+	// Not even after the last good config expires.
+	now := time.Now()
+	client.now = func() time.Time { return now.Add(48 * time.Hour) }
+	server.setWithExpiry("split:2", 1, now.Add(72*time.Hour), privateKey)
+	_, err = client.Fetch(context.Background())
+	require.ErrorIs(t, err, ErrRollback)
+}
+
+func TestFetch_Expired(t *testing.T) {
+	publicKey, privateKey := newTestKey(t)
+	server := &configServer{}
+	client := newTestClient(t, server, publicKey)
+	server.setWithExpiry("split:2", 1, time.Now().Add(-time.Minute), privateKey)
+	_, err := client.Fetch(context.Background())
+	require.ErrorIs(t, err, ErrExpired)
+
+	// The last good config isn't used after it expires.
+	now := time.Now()
+	server.setWithExpiry("split:2", 2, now.Add(time.Hour), privateKey)
+	_, err = client.Fetch(context.Background())
+	require.NoError(t, err)
+	server.mu.Lock()
+	server.fail = true
+	server.mu.Unlock()
+	client.now = func() time.Time { return now.Add(2 * time.Hour) }
+	_, ok := client.LastGood()
+	require.False(t, ok)
+	_, err = client.Fetch(context.Background())
+	require.Error(t, err)
+}
+
+func TestFetch_BoundToURL(t *testing.T) {
+	publicKey, privateKey := newTestKey(t)
+	server := &configServer{}
+	client := newTestClient(t, server, publicKey)
+	// A config signed for another URL is rejected.
+	server.url = "https://example.com/other-config"
+	server.set("split:2", 1, privateKey)
+	_, err := client.Fetch(context.Background())
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// So is a signature file with a different version than the one signed.
+	server.url = client.url
+	server.set("split:2", 1, privateKey)
+	server.mu.Lock()
+	server.signature = strings.Replace(server.signature, "version: 1", "version: 9", 1)
+	server.mu.Unlock()
+	_, err = client.Fetch(context.Background())
+	require.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestNewClient_Invalid(t *testing.T) {
+	publicKey, _ := newTestKey(t)
+	_, err := NewClient("http://example.com/config", publicKey)
+	require.Error(t, err)
+	_, err = NewClient("https://example.com/config")
+	require.Error(t, err)
+	_, err = NewClient("https://example.com/config", ed25519.PublicKey([]byte("short")))
+	require.Error(t, err)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	publicKey, _ := newTestKey(t)
+	parsed, err := ParsePublicKey(base64.StdEncoding.EncodeToString(publicKey) + "\n")
+	require.NoError(t, err)
+	require.Equal(t, publicKey, parsed)
+	_, err = ParsePublicKey("AAAA")
+	require.Error(t, err)
+}
@@ -0,0 +1,223 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueueCollector is a [Collector] that stores reports on disk and uploads them later with the
+// underlying Collector by calling [QueueCollector.Flush] or [QueueCollector.Run]. Each report is
+// uploaded with its own call to the underlying Collector, so a [RemoteCollector] sends one request
+// per report.
+//
+// It is meant for mobile clients, where connectivity test reports are mostly generated exactly
+// when the network is broken, and would otherwise be lost. The queue is bounded by number of
+// reports, total size and age, and the oldest reports are dropped first.
+//
+// Reports are stored as JSON, and are passed to the underlying Collector as [json.RawMessage], so
+// place sampling, like [SamplingCollector], before the queue rather than after it.
+type QueueCollector struct {
+	// Dir is the directory where queued reports are stored. It's created if it doesn't exist.
+	// It should be dedicated to the queue, since files in it may be deleted.
+	Dir string
+	// Collector uploads the queued reports.
+	Collector Collector
+	// MaxReports is the maximum number of queued reports. Zero means no limit.
+	MaxReports int
+	// MaxBytes is the maximum total size of the queued reports. Zero means no limit.
+	MaxBytes int64
+	// MaxAge is how long reports are kept before they expire. Zero means reports don't expire.
+	MaxAge time.Duration
+
+	mu sync.Mutex
+	// flushMu serializes flushes, so reports are not uploaded twice.
+	flushMu sync.Mutex
+}
+
+var _ Collector = (*QueueCollector)(nil)
+
+// queueFileExt is the extension of the queued report files.
+const queueFileExt = ".json"
+
+// queuedReport is a report file in the queue.
+type queuedReport struct {
+	name string
+	time time.Time
+	size int64
+}
+
+// Collect stores the report in the queue, dropping the oldest reports if the queue is over its limits.
+// It doesn't upload the report.
+func (c *QueueCollector) Collect(ctx context.Context, report Report) error {
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	now := time.Now()
+	// The name starts with the fixed-width timestamp, so the files sort chronologically.
+	name := fmt.Sprintf("%020d-%08x%s", now.UnixNano(), rand.Uint32(), queueFileExt)
+	// Write to a temporary file first, so that partial reports are never uploaded.
+	tmpPath := filepath.Join(c.Dir, name+".tmp")
+	if err := os.WriteFile(tmpPath, jsonData, 0o600); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(c.Dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to store report: %w", err)
+	}
+	_, err = c.trimLocked(now)
+	return err
+}
+
+// Len returns the number of reports in the queue.
+func (c *QueueCollector) Len() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reports, err := c.listLocked()
+	return len(reports), err
+}
+
+// Flush uploads the queued reports with the underlying Collector, oldest first, and removes them from the queue.
+// Reports rejected with a [BadRequestError] are dropped, since retrying won't help.
+// Flush stops at the first other error, which is returned, leaving the remaining reports for a later attempt.
+func (c *QueueCollector) Flush(ctx context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	reports, err := c.trimLocked(time.Now())
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, queued := range reports {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(c.Dir, queued.name)
+		jsonData, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Dropped by a concurrent Collect.
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to read report: %w", err)
+		}
+		err = c.Collector.Collect(ctx, json.RawMessage(jsonData))
+		var badRequest *BadRequestError
+		if err != nil && !errors.As(err, &badRequest) {
+			return fmt.Errorf("failed to upload report: %w", err)
+		}
+		c.mu.Lock()
+		err = os.Remove(path)
+		c.mu.Unlock()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove report: %w", err)
+		}
+	}
+	return nil
+}
+
+// Run flushes the queue every interval until the context is done, so reports are uploaded once
+// connectivity returns. Clients that get notified of network changes can also call [QueueCollector.Flush] directly.
+func (c *QueueCollector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.Flush(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// listLocked returns the queued reports, oldest first. A missing directory is an empty queue.
+func (c *QueueCollector) listLocked() ([]queuedReport, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list queue directory: %w", err)
+	}
+	reports := make([]queuedReport, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, queueFileExt) {
+			continue
+		}
+		timestamp, _, _ := strings.Cut(name, "-")
+		nanos, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		reports = append(reports, queuedReport{name: name, time: time.Unix(0, nanos), size: info.Size()})
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].name < reports[j].name })
+	return reports, nil
+}
+
+// trimLocked removes the expired reports and the oldest reports over the limits, and returns the remaining ones.
+func (c *QueueCollector) trimLocked(now time.Time) ([]queuedReport, error) {
+	reports, err := c.listLocked()
+	if err != nil {
+		return nil, err
+	}
+	var totalBytes int64
+	for _, r := range reports {
+		totalBytes += r.size
+	}
+	var errs []error
+	for len(reports) > 0 {
+		oldest := reports[0]
+		expired := c.MaxAge > 0 && now.Sub(oldest.time) > c.MaxAge
+		overCount := c.MaxReports > 0 && len(reports) > c.MaxReports
+		overSize := c.MaxBytes > 0 && totalBytes > c.MaxBytes
+		if !expired && !overCount && !overSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.Dir, oldest.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+		totalBytes -= oldest.size
+		reports = reports[1:]
+	}
+	if len(errs) > 0 {
+		return reports, fmt.Errorf("failed to remove old reports: %w", errors.Join(errs...))
+	}
+	return reports, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingCollector records the reports it collects, and fails with err if it's set.
+type recordingCollector struct {
+	reports []string
+	err     error
+}
+
+func (c *recordingCollector) Collect(ctx context.Context, report Report) error {
+	if c.err != nil {
+		return c.err
+	}
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	c.reports = append(c.reports, string(jsonData))
+	return nil
+}
+
+func collectN(t *testing.T, q *QueueCollector, n int) {
+	for i := 0; i < n; i++ {
+		require.NoError(t, q.Collect(context.Background(), map[string]int{"n": i}))
+	}
+}
+
+func requireLen(t *testing.T, q *QueueCollector, expected int) {
+	n, err := q.Len()
+	require.NoError(t, err)
+	require.Equal(t, expected, n)
+}
+
+func TestQueueCollector_Flush(t *testing.T) {
+	uploader := &recordingCollector{}
+	q := &QueueCollector{Dir: filepath.Join(t.TempDir(), "queue"), Collector: uploader}
+	requireLen(t, q, 0)
+	collectN(t, q, 3)
+	requireLen(t, q, 3)
+	require.Empty(t, uploader.reports)
+
+	require.NoError(t, q.Flush(context.Background()))
+	require.Equal(t, []string{`{"n":0}`, `{"n":1}`, `{"n":2}`}, uploader.reports)
+	requireLen(t, q, 0)
+}
+
+func TestQueueCollector_RetriesAfterFailure(t *testing.T) {
+	uploader := &recordingCollector{err: errors.New("network is unreachable")}
+	q := &QueueCollector{Dir: t.TempDir(), Collector: uploader}
+	collectN(t, q, 2)
+
+	require.ErrorContains(t, q.Flush(context.Background()), "network is unreachable")
+	requireLen(t, q, 2)
+
+	uploader.err = nil
+	require.NoError(t, q.Flush(context.Background()))
+	require.Equal(t, []string{`{"n":0}`, `{"n":1}`}, uploader.reports)
+	requireLen(t, q, 0)
+}
+
+func TestQueueCollector_DropsBadRequests(t *testing.T) {
+	uploader := &recordingCollector{err: &BadRequestError{Err: errors.New("http request failed with status code 400")}}
+	q := &QueueCollector{Dir: t.TempDir(), Collector: uploader}
+	collectN(t, q, 2)
+
+	require.NoError(t, q.Flush(context.Background()))
+	requireLen(t, q, 0)
+}
+
+func TestQueueCollector_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	collectN(t, &QueueCollector{Dir: dir}, 2)
+
+	uploader := &recordingCollector{}
+	q := &QueueCollector{Dir: dir, Collector: uploader}
+	requireLen(t, q, 2)
+	require.NoError(t, q.Flush(context.Background()))
+	require.Equal(t, []string{`{"n":0}`, `{"n":1}`}, uploader.reports)
+}
+
+func TestQueueCollector_MaxReports(t *testing.T) {
+	uploader := &recordingCollector{}
+	q := &QueueCollector{Dir: t.TempDir(), Collector: uploader, MaxReports: 2}
+	collectN(t, q, 4)
+	requireLen(t, q, 2)
+
+	require.NoError(t, q.Flush(context.Background()))
+	require.Equal(t, []string{`{"n":2}`, `{"n":3}`}, uploader.reports)
+}
+
+func TestQueueCollector_MaxBytes(t *testing.T) {
+	uploader := &recordingCollector{}
+	// Each report is 7 bytes.
+	q := &QueueCollector{Dir: t.TempDir(), Collector: uploader, MaxBytes: 20}
+	collectN(t, q, 4)
+	requireLen(t, q, 2)
+
+	require.NoError(t, q.Flush(context.Background()))
+	require.Equal(t, []string{`{"n":2}`, `{"n":3}`}, uploader.reports)
+}
+
+func TestQueueCollector_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	oldName := fmt.Sprintf("%020d-%08x%s", time.Now().Add(-2*time.Hour).UnixNano(), 0, queueFileExt)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, oldName), []byte(`{"old":true}`), 0o600))
+
+	uploader := &recordingCollector{}
+	q := &QueueCollector{Dir: dir, Collector: uploader, MaxAge: time.Hour}
+	collectN(t, q, 1)
+	requireLen(t, q, 1)
+
+	require.NoError(t, q.Flush(context.Background()))
+	require.Equal(t, []string{`{"n":0}`}, uploader.reports)
+}
+
+func TestQueueCollector_IgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "partial.json.tmp"), []byte("{"), 0o600))
+
+	uploader := &recordingCollector{}
+	q := &QueueCollector{Dir: dir, Collector: uploader}
+	requireLen(t, q, 0)
+	require.NoError(t, q.Flush(context.Background()))
+	require.Empty(t, uploader.reports)
+}
+
+func TestQueueCollector_Run(t *testing.T) {
+	uploader := &recordingCollector{}
+	q := &QueueCollector{Dir: t.TempDir(), Collector: uploader}
+	collectN(t, q, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx, time.Hour)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		n, err := q.Len()
+		return err == nil && n == 0
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	require.Equal(t, []string{`{"n":0}`}, uploader.reports)
+}
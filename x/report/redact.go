@@ -0,0 +1,181 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Redaction configures the details that a [RedactingCollector] removes from the reports before they leave the device.
+// The zero value keeps the reports as they are.
+type Redaction struct {
+	// IPv4PrefixLen and IPv6PrefixLen truncate the IP addresses found in the strings of the report, including
+	// error messages, to the network of the given prefix length, like 24 for IPv4 and 48 for IPv6.
+	// Zero keeps the addresses.
+	IPv4PrefixLen int
+	IPv6PrefixLen int
+	// HashFields lists the JSON field names whose string values, or arrays of strings, are replaced by a hash, like
+	// "domain" or "test_domains". They are hashed before the IP addresses are truncated.
+	HashFields []string
+	// HashKey is the HMAC-SHA256 key of the hashes. The same value has the same hash in the reports with the same key,
+	// so they can still be aggregated. Use a key the collector doesn't know, otherwise it can recover common values
+	// by hashing candidates.
+	HashKey []byte
+	// TimeGranularity truncates the timestamps of the report, in RFC 3339 format, to a multiple of it, like
+	// time.Hour. Zero keeps the timestamps.
+	TimeGranularity time.Duration
+}
+
+// Apply returns the report with the redaction applied, as a JSON object that implements [HasSuccess] if the report does.
+func (r *Redaction) Apply(report Report) (Report, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep the numbers as they are, instead of converting them to float64.
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	redacted, err := json.Marshal(r.redactValue(value, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	if hs, ok := report.(HasSuccess); ok {
+		return &redactedReport{RawMessage: redacted, success: hs.IsSuccess()}, nil
+	}
+	return json.RawMessage(redacted), nil
+}
+
+func (r *Redaction) redactValue(value any, hash bool) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			v[key] = r.redactValue(field, r.isHashField(key))
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = r.redactValue(item, hash)
+		}
+		return v
+	case string:
+		if hash {
+			return r.hash(v)
+		}
+		return r.redactString(v)
+	default:
+		return v
+	}
+}
+
+func (r *Redaction) isHashField(key string) bool {
+	for _, field := range r.HashFields {
+		if field == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redaction) hash(value string) string {
+	mac := hmac.New(sha256.New, r.HashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// ipCandidate matches the runs of characters that may form an IP address, optionally with a port.
+var ipCandidate = regexp.MustCompile(`[0-9A-Fa-f:.]*[:.][0-9A-Fa-f:.]*`)
+
+func (r *Redaction) redactString(value string) string {
+	if r.TimeGranularity > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t.Truncate(r.TimeGranularity).Format(time.RFC3339Nano)
+		}
+	}
+	if r.IPv4PrefixLen <= 0 && r.IPv6PrefixLen <= 0 {
+		return value
+	}
+	return ipCandidate.ReplaceAllStringFunc(value, func(candidate string) string {
+		// Leave out punctuation after the address, like in "to 10.0.0.1.".
+		token := strings.TrimRight(candidate, ".:")
+		suffix := candidate[len(token):]
+		if addrPort, err := netip.ParseAddrPort(token); err == nil {
+			return netip.AddrPortFrom(r.truncateAddr(addrPort.Addr()), addrPort.Port()).String() + suffix
+		}
+		if addr, err := netip.ParseAddr(token); err == nil {
+			return r.truncateAddr(addr).String() + suffix
+		}
+		return candidate
+	})
+}
+
+func (r *Redaction) truncateAddr(addr netip.Addr) netip.Addr {
+	addr = addr.Unmap().WithZone("")
+	bits := r.IPv6PrefixLen
+	if addr.Is4() {
+		bits = r.IPv4PrefixLen
+	}
+	if bits <= 0 {
+		return addr
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		// The prefix length is longer than the address, so there's nothing to truncate.
+		return addr
+	}
+	return prefix.Addr()
+}
+
+// redactedReport is a redacted report that keeps the success status of the original report.
+type redactedReport struct {
+	json.RawMessage
+	success bool
+}
+
+var _ HasSuccess = (*redactedReport)(nil)
+
+// IsSuccess implements [HasSuccess].
+func (r *redactedReport) IsSuccess() bool {
+	return r.success
+}
+
+// RedactingCollector is a [Collector] that applies the [Redaction] to the reports before passing them to the
+// underlying collector. The redacted reports keep the success status, so they can be sampled with a [SamplingCollector].
+type RedactingCollector struct {
+	Collector Collector
+	Redaction Redaction
+}
+
+// Collect implements [Collector].
+func (c *RedactingCollector) Collect(ctx context.Context, report Report) error {
+	redacted, err := c.Redaction.Apply(report)
+	if err != nil {
+		return fmt.Errorf("failed to redact report: %w", err)
+	}
+	return c.Collector.Collect(ctx, redacted)
+}
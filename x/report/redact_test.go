@@ -0,0 +1,138 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type attemptReport struct {
+	Domain    string    `json:"domain"`
+	Resolver  string    `json:"resolver"`
+	Time      time.Time `json:"time"`
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type testRedactionReport struct {
+	ClientIP    string          `json:"client_ip"`
+	TestDomains []string        `json:"test_domains"`
+	Attempts    []attemptReport `json:"attempts"`
+}
+
+func (r *testRedactionReport) IsSuccess() bool {
+	return len(r.Attempts) > 0 && r.Attempts[0].Error == ""
+}
+
+func TestRedaction_Apply(t *testing.T) {
+	redaction := &Redaction{
+		IPv4PrefixLen:   24,
+		IPv6PrefixLen:   48,
+		HashFields:      []string{"domain", "test_domains"},
+		HashKey:         []byte("key"),
+		TimeGranularity: time.Hour,
+	}
+	report := &testRedactionReport{
+		ClientIP:    "2001:db8:1234:5678::1",
+		TestDomains: []string{"example.com", "example.org"},
+		Attempts: []attemptReport{{
+			Domain:    "example.com",
+			Resolver:  "[2001:db8:1234:5678::53]:53",
+			Time:      time.Date(2025, 3, 4, 10, 42, 7, 123, time.UTC),
+			LatencyMs: 9007199254740993,
+			Error:     "dial tcp 192.168.7.42:443: connect: connection refused to 10.1.2.3.",
+		}},
+	}
+	redacted, err := redaction.Apply(report)
+	require.NoError(t, err)
+	require.False(t, redacted.(HasSuccess).IsSuccess())
+
+	data, err := json.Marshal(redacted)
+	require.NoError(t, err)
+	var got testRedactionReport
+	require.NoError(t, json.Unmarshal(data, &got))
+	require.Equal(t, "2001:db8:1234::", got.ClientIP)
+	require.Len(t, got.TestDomains, 2)
+	require.Len(t, got.TestDomains[0], 32)
+	require.NotEqual(t, got.TestDomains[0], got.TestDomains[1])
+	// The same value has the same hash, so the reports can be aggregated.
+	require.Equal(t, got.TestDomains[0], got.Attempts[0].Domain)
+	require.Equal(t, "[2001:db8:1234::]:53", got.Attempts[0].Resolver)
+	require.Equal(t, time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC), got.Attempts[0].Time)
+	require.Equal(t, int64(9007199254740993), got.Attempts[0].LatencyMs)
+	require.Equal(t, "dial tcp 192.168.7.0:443: connect: connection refused to 10.1.2.0.", got.Attempts[0].Error)
+
+	// A different key gives different hashes.
+	otherKey := *redaction
+	otherKey.HashKey = []byte("other key")
+	otherRedacted, err := otherKey.Apply(report)
+	require.NoError(t, err)
+	otherData, err := json.Marshal(otherRedacted)
+	require.NoError(t, err)
+	var otherGot testRedactionReport
+	require.NoError(t, json.Unmarshal(otherData, &otherGot))
+	require.NotEqual(t, got.TestDomains[0], otherGot.TestDomains[0])
+}
+
+func TestRedaction_ZeroValue(t *testing.T) {
+	report := map[string]any{
+		"address": "192.168.7.42:443",
+		"time":    "2025-03-04T10:42:07Z",
+	}
+	redacted, err := (&Redaction{}).Apply(report)
+	require.NoError(t, err)
+	// Reports without a success status stay without one.
+	_, ok := redacted.(HasSuccess)
+	require.False(t, ok)
+	data, err := json.Marshal(redacted)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"address": "192.168.7.42:443", "time": "2025-03-04T10:42:07Z"}`, string(data))
+}
+
+func TestRedactingCollector(t *testing.T) {
+	var collected Report
+	c := &RedactingCollector{
+		Collector: collectorFunc(func(ctx context.Context, report Report) error {
+			collected = report
+			return nil
+		}),
+		Redaction: Redaction{IPv4PrefixLen: 16},
+	}
+	err := c.Collect(context.Background(), &testRedactionReport{ClientIP: "192.168.7.42", Attempts: []attemptReport{{}}})
+	require.NoError(t, err)
+	require.True(t, collected.(HasSuccess).IsSuccess())
+	data, err := json.Marshal(collected)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"client_ip":"192.168.0.0"`)
+
+	err = c.Collect(context.Background(), func() {})
+	require.Error(t, err)
+	var unsupported *json.UnsupportedTypeError
+	require.True(t, errors.As(err, &unsupported))
+}
+
+/********** Test Utilities **********/
+
+type collectorFunc func(ctx context.Context, report Report) error
+
+func (f collectorFunc) Collect(ctx context.Context, report Report) error {
+	return f(ctx, report)
+}
@@ -4,6 +4,8 @@
 // It also defines a report type and a [HasSuccess] interface that is implemented by the report type.
 // The report type is used to represent a connectivity test report.
 // The [HasSuccess] interface is used to determine the success status of a report. This will be used to control [SamplingCollector] behavior.
+// [DiscoverNAT] finds the public address and NAT type with STUN, to annotate reports.
+// [RedactingCollector] truncates IP addresses, hashes destinations and coarsens timestamps before the reports leave the device.
 // The report package also defines a [BadRequestError] type that is used to represent an error that occurs when a sending the report to remote collector fails.
 package report
 
@@ -0,0 +1,296 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// NATType is the mapping behavior of the NAT between the client and the STUN servers, as defined in RFC 4787.
+type NATType string
+
+const (
+	// NATTypeUnknown means there were not enough responses to find the mapping behavior.
+	NATTypeUnknown NATType = "unknown"
+	// NATTypeNone means the public address is a local address, so there's no NAT on the direct path.
+	NATTypeNone NATType = "none"
+	// NATTypeEndpointIndependent means all servers saw the same public address (a "cone" NAT). UDP relays and
+	// peer-to-peer traffic usually work.
+	NATTypeEndpointIndependent NATType = "endpoint-independent"
+	// NATTypeAddressDependent means servers saw different public addresses (a "symmetric" NAT), which breaks
+	// protocols that expect the public address to be stable across destinations.
+	NATTypeAddressDependent NATType = "address-dependent"
+)
+
+// STUNMapping is the public address a STUN server observed.
+type STUNMapping struct {
+	// Server is the host:port of the STUN server.
+	Server string `json:"server"`
+	// MappedAddress is the public address seen by the server. It's invalid if the request failed.
+	MappedAddress netip.AddrPort `json:"mapped_address"`
+	// Error is the reason the request failed, or empty on success.
+	Error string `json:"error,omitempty"`
+}
+
+// STUNResult is the outcome of [DiscoverNAT]. It can be added to connectivity reports to annotate them.
+type STUNResult struct {
+	// PublicAddress is the public address seen by the first server that responded.
+	PublicAddress netip.AddrPort `json:"public_address"`
+	// NATType is the mapping behavior found by comparing the addresses seen by the servers.
+	NATType NATType `json:"nat_type"`
+	// Mappings lists the result of each server, in order.
+	Mappings []STUNMapping `json:"mappings"`
+}
+
+// DiscoverNAT sends STUN Binding requests (RFC 5389) to each of the servers from the same socket, created by the
+// listener, and returns the public address and the NAT type it finds. Pass a [transport.UDPListener] to test the
+// direct path, or a proxy's listener to find the public address of the proxy egress and debug UDP relay failures.
+// The NAT type needs at least two servers with different IP addresses, and is [NATTypeUnknown] otherwise.
+//
+// Server host names are resolved locally for direct listeners, and passed to the proxy otherwise.
+// Requests are retransmitted for about 3.5 seconds, within the context deadline, which bounds the whole discovery.
+// DiscoverNAT returns an error if no server responded.
+func DiscoverNAT(ctx context.Context, listener transport.PacketListener, servers ...string) (*STUNResult, error) {
+	if listener == nil {
+		return nil, errors.New("argument listener must not be nil")
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("must specify at least one STUN server")
+	}
+	conn, err := listener.ListenPacket(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create PacketConn: %w", err)
+	}
+	defer conn.Close()
+	_, isDirect := listener.(*transport.UDPListener)
+
+	result := &STUNResult{NATType: NATTypeUnknown, Mappings: make([]STUNMapping, 0, len(servers))}
+	var mapped []netip.AddrPort
+	for _, server := range servers {
+		mapping := STUNMapping{Server: server}
+		mapping.MappedAddress, err = stunBinding(ctx, conn, server, isDirect)
+		if err != nil {
+			mapping.Error = err.Error()
+		} else {
+			mapped = append(mapped, mapping.MappedAddress)
+		}
+		result.Mappings = append(result.Mappings, mapping)
+	}
+	if len(mapped) == 0 {
+		return result, errors.New("no STUN server responded")
+	}
+	result.PublicAddress = mapped[0]
+	switch {
+	case isDirect && isLocalAddress(result.PublicAddress, conn.LocalAddr()):
+		result.NATType = NATTypeNone
+	case len(mapped) > 1:
+		result.NATType = NATTypeEndpointIndependent
+		for _, addr := range mapped[1:] {
+			if addr != mapped[0] {
+				result.NATType = NATTypeAddressDependent
+			}
+		}
+	}
+	return result, nil
+}
+
+// isLocalAddress returns whether the public address is the local address of the socket, so there's no NAT.
+func isLocalAddress(public netip.AddrPort, local net.Addr) bool {
+	localAddr, ok := local.(*net.UDPAddr)
+	if !ok || localAddr.Port != int(public.Port()) {
+		return false
+	}
+	if localIP, ok := netip.AddrFromSlice(localAddr.IP); ok && !localIP.IsUnspecified() {
+		return localIP.Unmap() == public.Addr().Unmap()
+	}
+	interfaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, interfaceAddr := range interfaceAddrs {
+		if prefix, err := netip.ParsePrefix(interfaceAddr.String()); err == nil && prefix.Addr().Unmap() == public.Addr().Unmap() {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	stunHeaderLen            = 20
+	stunMagicCookie          = 0x2112A442
+	stunBindingRequest       = 0x0001
+	stunBindingSuccess       = 0x0101
+	stunAttrMappedAddress    = 0x0001
+	stunAttrXORMappedAddr    = 0x0020
+	stunInitialRTO           = 500 * time.Millisecond
+	stunMaxTransmissions     = 3
+	stunMaxResponseSize      = 1500
+	stunAddressFamilyIPv4    = 0x01
+	stunAddressFamilyIPv6    = 0x02
+	stunDefaultServerTimeout = 5 * time.Second
+)
+
+// stunBinding sends a Binding request to the server, with retransmissions, and returns the mapped address.
+func stunBinding(ctx context.Context, conn net.PacketConn, server string, resolve bool) (netip.AddrPort, error) {
+	var serverAddr net.Addr
+	if resolve {
+		udpAddr, err := net.ResolveUDPAddr("udp", server)
+		if err != nil {
+			return netip.AddrPort{}, err
+		}
+		serverAddr = udpAddr
+	} else {
+		var err error
+		serverAddr, err = transport.MakeNetAddr("udp", server)
+		if err != nil {
+			return netip.AddrPort{}, err
+		}
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, stunDefaultServerTimeout)
+		defer cancel()
+	}
+	var txID [12]byte
+	if _, err := rand.Read(txID[:]); err != nil {
+		return netip.AddrPort{}, err
+	}
+	request := make([]byte, stunHeaderLen)
+	binary.BigEndian.PutUint16(request[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	copy(request[8:], txID[:])
+
+	rto := stunInitialRTO
+	buf := make([]byte, stunMaxResponseSize)
+	for attempt := 0; attempt < stunMaxTransmissions; attempt++ {
+		if _, err := conn.WriteTo(request, serverAddr); err != nil {
+			return netip.AddrPort{}, fmt.Errorf("failed to send request: %w", err)
+		}
+		deadline := time.Now().Add(rto)
+		if ctxDeadline, _ := ctx.Deadline(); ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return netip.AddrPort{}, err
+		}
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return netip.AddrPort{}, fmt.Errorf("failed to receive response: %w", err)
+			}
+			// Ignore late responses to other requests.
+			if addr, err := parseSTUNResponse(buf[:n], txID); err == nil {
+				return addr, nil
+			} else if !errors.Is(err, errSTUNOtherTransaction) {
+				return netip.AddrPort{}, err
+			}
+		}
+		if ctx.Err() != nil {
+			return netip.AddrPort{}, ctx.Err()
+		}
+		rto *= 2
+	}
+	return netip.AddrPort{}, errors.New("STUN request timed out")
+}
+
+var errSTUNOtherTransaction = errors.New("response to another STUN transaction")
+
+// parseSTUNResponse returns the mapped address of a Binding success response with the given transaction ID.
+// It prefers the XOR-MAPPED-ADDRESS, and falls back to the MAPPED-ADDRESS of older servers.
+func parseSTUNResponse(msg []byte, txID [12]byte) (netip.AddrPort, error) {
+	if len(msg) < stunHeaderLen || binary.BigEndian.Uint32(msg[4:]) != stunMagicCookie || [12]byte(msg[8:20]) != txID {
+		return netip.AddrPort{}, errSTUNOtherTransaction
+	}
+	if msgType := binary.BigEndian.Uint16(msg[0:]); msgType != stunBindingSuccess {
+		return netip.AddrPort{}, fmt.Errorf("unexpected STUN message type 0x%04x", msgType)
+	}
+	attrs := msg[stunHeaderLen:]
+	if length := int(binary.BigEndian.Uint16(msg[2:])); length <= len(attrs) {
+		attrs = attrs[:length]
+	}
+	var mapped netip.AddrPort
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+attrLen > len(attrs) {
+			return netip.AddrPort{}, errors.New("truncated STUN attribute")
+		}
+		value := attrs[4 : 4+attrLen]
+		switch attrType {
+		case stunAttrXORMappedAddr:
+			return parseSTUNAddress(value, msg[4:20])
+		case stunAttrMappedAddress:
+			if addr, err := parseSTUNAddress(value, nil); err == nil {
+				mapped = addr
+			}
+		}
+		// Attributes are padded to a multiple of 4 bytes.
+		next := 4 + (attrLen+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	if !mapped.IsValid() {
+		return netip.AddrPort{}, errors.New("STUN response has no mapped address")
+	}
+	return mapped, nil
+}
+
+// parseSTUNAddress parses an address attribute. If xorKey is not nil, the address is XOR'ed with it, as in
+// XOR-MAPPED-ADDRESS, where the key is the magic cookie followed by the transaction ID.
+func parseSTUNAddress(value []byte, xorKey []byte) (netip.AddrPort, error) {
+	if len(value) < 4 {
+		return netip.AddrPort{}, errors.New("invalid STUN address")
+	}
+	family := value[1]
+	port := binary.BigEndian.Uint16(value[2:])
+	var ip []byte
+	switch family {
+	case stunAddressFamilyIPv4:
+		ip = append(ip, value[4:]...)
+		if len(ip) != 4 {
+			return netip.AddrPort{}, errors.New("invalid STUN IPv4 address")
+		}
+	case stunAddressFamilyIPv6:
+		ip = append(ip, value[4:]...)
+		if len(ip) != 16 {
+			return netip.AddrPort{}, errors.New("invalid STUN IPv6 address")
+		}
+	default:
+		return netip.AddrPort{}, fmt.Errorf("unknown STUN address family %d", family)
+	}
+	if xorKey != nil {
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= xorKey[i]
+		}
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return netip.AddrPortFrom(addr, port), nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// startSTUNServer runs a STUN server that responds with the mapped address returned by mapAddress.
+// If useXOR is false, it responds with a MAPPED-ADDRESS, like old servers.
+func startSTUNServer(t *testing.T, useXOR bool, mapAddress func(netip.AddrPort) netip.AddrPort) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, clientAddr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < stunHeaderLen || binary.BigEndian.Uint16(buf) != stunBindingRequest {
+				continue
+			}
+			mapped := mapAddress(clientAddr.(*net.UDPAddr).AddrPort())
+			ip := mapped.Addr().As4()
+			port := mapped.Port()
+			attrType := uint16(stunAttrMappedAddress)
+			if useXOR {
+				attrType = stunAttrXORMappedAddr
+				port ^= uint16(stunMagicCookie >> 16)
+				for i := range ip {
+					ip[i] ^= buf[4+i]
+				}
+			}
+			response := make([]byte, stunHeaderLen, stunHeaderLen+12+8)
+			binary.BigEndian.PutUint16(response[0:], stunBindingSuccess)
+			binary.BigEndian.PutUint16(response[2:], 12+8)
+			copy(response[4:], buf[4:20])
+			// An unknown attribute that must be skipped.
+			response = append(response, 0x80, 0x22, 0, 3, 'a', 'b', 'c', 0)
+			response = binary.BigEndian.AppendUint16(response, attrType)
+			response = binary.BigEndian.AppendUint16(response, 8)
+			response = append(response, 0, stunAddressFamilyIPv4)
+			response = binary.BigEndian.AppendUint16(response, port)
+			response = append(response, ip[:]...)
+			conn.WriteTo(response, clientAddr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func identityMapping(addr netip.AddrPort) netip.AddrPort {
+	return addr
+}
+
+func TestDiscoverNAT_None(t *testing.T) {
+	server1 := startSTUNServer(t, true, identityMapping)
+	server2 := startSTUNServer(t, false, identityMapping)
+	result, err := DiscoverNAT(context.Background(), &transport.UDPListener{Address: "127.0.0.1:0"}, server1, server2)
+	require.NoError(t, err)
+	require.Equal(t, NATTypeNone, result.NATType)
+	require.Equal(t, "127.0.0.1", result.PublicAddress.Addr().String())
+	require.Len(t, result.Mappings, 2)
+	require.Equal(t, result.PublicAddress, result.Mappings[1].MappedAddress)
+}
+
+func TestDiscoverNAT_EndpointIndependent(t *testing.T) {
+	publicIP := netip.MustParseAddr("203.0.113.1")
+	natMapping := func(addr netip.AddrPort) netip.AddrPort {
+		return netip.AddrPortFrom(publicIP, addr.Port())
+	}
+	server1 := startSTUNServer(t, true, natMapping)
+	server2 := startSTUNServer(t, true, natMapping)
+	result, err := DiscoverNAT(context.Background(), &transport.UDPListener{Address: "127.0.0.1:0"}, server1, server2)
+	require.NoError(t, err)
+	require.Equal(t, NATTypeEndpointIndependent, result.NATType)
+	require.Equal(t, publicIP, result.PublicAddress.Addr())
+}
+
+func TestDiscoverNAT_AddressDependent(t *testing.T) {
+	publicIP := netip.MustParseAddr("203.0.113.1")
+	server1 := startSTUNServer(t, true, func(addr netip.AddrPort) netip.AddrPort {
+		return netip.AddrPortFrom(publicIP, 1000)
+	})
+	server2 := startSTUNServer(t, true, func(addr netip.AddrPort) netip.AddrPort {
+		return netip.AddrPortFrom(publicIP, 2000)
+	})
+	result, err := DiscoverNAT(context.Background(), &transport.UDPListener{Address: "127.0.0.1:0"}, server1, server2)
+	require.NoError(t, err)
+	require.Equal(t, NATTypeAddressDependent, result.NATType)
+	require.Equal(t, netip.AddrPortFrom(publicIP, 1000), result.PublicAddress)
+}
+
+func TestDiscoverNAT_PartialFailure(t *testing.T) {
+	// Nothing listens on this address.
+	deadConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadServer := deadConn.LocalAddr().String()
+	deadConn.Close()
+	server := startSTUNServer(t, true, func(addr netip.AddrPort) netip.AddrPort {
+		return netip.AddrPortFrom(netip.MustParseAddr("203.0.113.1"), addr.Port())
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := DiscoverNAT(ctx, &transport.UDPListener{Address: "127.0.0.1:0"}, server, deadServer)
+	require.NoError(t, err)
+	require.Equal(t, NATTypeUnknown, result.NATType)
+	require.Empty(t, result.Mappings[0].Error)
+	require.NotEmpty(t, result.Mappings[1].Error)
+	require.False(t, result.Mappings[1].MappedAddress.IsValid())
+}
+
+func TestDiscoverNAT_NoResponse(t *testing.T) {
+	deadConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer deadConn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = DiscoverNAT(ctx, &transport.UDPListener{Address: "127.0.0.1:0"}, deadConn.LocalAddr().String())
+	require.Error(t, err)
+}
+
+func TestParseSTUNResponse_OtherTransaction(t *testing.T) {
+	msg := make([]byte, stunHeaderLen)
+	binary.BigEndian.PutUint16(msg, stunBindingSuccess)
+	binary.BigEndian.PutUint32(msg[4:], stunMagicCookie)
+	_, err := parseSTUNResponse(msg, [12]byte{1})
+	require.ErrorIs(t, err, errSTUNOtherTransaction)
+	_, err = parseSTUNResponse(msg, [12]byte{})
+	require.ErrorContains(t, err, "no mapped address")
+}
@@ -0,0 +1,395 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package roaming keeps UDP-based transports working when the client address changes, for instance when the device
+switches from Wi-Fi to cellular.
+
+After a network change, the sockets bound to the old network stop working, and the sessions on top of them hang until
+they time out. The dialer and listener in this package return connections that can be moved to a new socket with
+Rebind, while the transports on top of them keep using the same connection object. Whether the session on top
+survives the new address depends on the protocol: QUIC migrates the connection, WireGuard updates the peer endpoint,
+and Shadowsocks servers create a new association for the new address.
+
+The dialer and listener implement [connectivity.NetworkChangeListener], so they can rebind their connections on
+notifications from a [connectivity.NetworkMonitor]:
+
+	dialer := roaming.NewPacketDialer(&transport.UDPDialer{})
+	monitor, err := connectivity.NewNetworkMonitor()
+	// ...
+	monitor.Subscribe(dialer)
+*/
+package roaming
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/connectivity"
+)
+
+// DefaultRebindTimeout is the timeout of the rebinds started by OnNetworkChange.
+const DefaultRebindTimeout = 10 * time.Second
+
+// rebinder is a connection that can move to a new socket.
+type rebinder interface {
+	rebind(ctx context.Context) error
+}
+
+// connSet tracks the open connections of a dialer or listener, to rebind them.
+type connSet struct {
+	// OnRebind, if not nil, is called with the result of the rebinds started by OnNetworkChange.
+	OnRebind func(err error)
+
+	mu    sync.Mutex
+	conns map[rebinder]struct{}
+}
+
+func (s *connSet) add(c rebinder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[rebinder]struct{})
+	}
+	s.conns[c] = struct{}{}
+}
+
+func (s *connSet) remove(c rebinder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
+// Rebind moves all the open connections to new sockets. It returns the errors of the connections that failed
+// to rebind, which keep using their old socket.
+func (s *connSet) Rebind(ctx context.Context) error {
+	s.mu.Lock()
+	conns := make([]rebinder, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	errs := make([]error, len(conns))
+	var wg sync.WaitGroup
+	for i, c := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.rebind(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// OnNetworkChange implements [connectivity.NetworkChangeListener]. It rebinds the open connections in the background.
+func (s *connSet) OnNetworkChange() {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultRebindTimeout)
+		defer cancel()
+		err := s.Rebind(ctx)
+		if s.OnRebind != nil {
+			s.OnRebind(err)
+		}
+	}()
+}
+
+// PacketDialer is a [transport.PacketDialer] whose connections can be moved to new sockets with
+// [PacketDialer.Rebind], which dials the same address again with the base dialer.
+type PacketDialer struct {
+	connSet
+	base transport.PacketDialer
+}
+
+var _ transport.PacketDialer = (*PacketDialer)(nil)
+var _ connectivity.NetworkChangeListener = (*PacketDialer)(nil)
+
+// NewPacketDialer creates a [PacketDialer] that dials with base.
+func NewPacketDialer(base transport.PacketDialer) *PacketDialer {
+	return &PacketDialer{base: base}
+}
+
+// DialPacket implements [transport.PacketDialer].
+func (d *PacketDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return d.base.DialPacket(ctx, addr)
+	}
+	conn, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &roamingConn{dial: dial, conn: conn}
+	c.onClose = func() { d.remove(c) }
+	d.add(c)
+	return c, nil
+}
+
+// deadlines stores the deadlines of a connection, to apply them to the new sockets.
+type deadlines struct {
+	read, write time.Time
+}
+
+// roamingConn is a [net.Conn] that can move to a new connection from dial.
+type roamingConn struct {
+	dial    func(ctx context.Context) (net.Conn, error)
+	onClose func()
+	// rebindMu serializes the rebinds.
+	rebindMu sync.Mutex
+
+	mu        sync.RWMutex
+	conn      net.Conn
+	deadlines deadlines
+	closed    bool
+}
+
+var _ net.Conn = (*roamingConn)(nil)
+
+func (c *roamingConn) current() net.Conn {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+// retry reports whether an operation that failed on conn should be retried on the current connection,
+// because conn was replaced.
+func (c *roamingConn) retry(conn net.Conn) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.closed && c.conn != conn
+}
+
+func (c *roamingConn) rebind(ctx context.Context) error {
+	c.rebindMu.Lock()
+	defer c.rebindMu.Unlock()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return conn.Close()
+	}
+	setDeadlines(conn, c.deadlines)
+	old := c.conn
+	c.conn = conn
+	c.mu.Unlock()
+	// Unblock the reads on the old connection, so they continue on the new one.
+	return old.Close()
+}
+
+func setDeadlines(conn interface {
+	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
+}, d deadlines) {
+	conn.SetReadDeadline(d.read)
+	conn.SetWriteDeadline(d.write)
+}
+
+func (c *roamingConn) Read(p []byte) (int, error) {
+	for {
+		conn := c.current()
+		n, err := conn.Read(p)
+		if err != nil && c.retry(conn) {
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *roamingConn) Write(p []byte) (int, error) {
+	conn := c.current()
+	n, err := conn.Write(p)
+	if err != nil && c.retry(conn) {
+		return c.current().Write(p)
+	}
+	return n, err
+}
+
+func (c *roamingConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	c.closed = true
+	conn := c.conn
+	c.mu.Unlock()
+	c.onClose()
+	return conn.Close()
+}
+
+func (c *roamingConn) LocalAddr() net.Addr {
+	return c.current().LocalAddr()
+}
+
+func (c *roamingConn) RemoteAddr() net.Addr {
+	return c.current().RemoteAddr()
+}
+
+func (c *roamingConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadlines = deadlines{read: t, write: t}
+	return c.conn.SetDeadline(t)
+}
+
+func (c *roamingConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadlines.read = t
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *roamingConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadlines.write = t
+	return c.conn.SetWriteDeadline(t)
+}
+
+// PacketListener is a [transport.PacketListener] whose connections can be moved to new sockets with
+// [PacketListener.Rebind], which listens again with the base listener.
+type PacketListener struct {
+	connSet
+	base transport.PacketListener
+}
+
+var _ transport.PacketListener = (*PacketListener)(nil)
+var _ connectivity.NetworkChangeListener = (*PacketListener)(nil)
+
+// NewPacketListener creates a [PacketListener] that listens with base.
+func NewPacketListener(base transport.PacketListener) *PacketListener {
+	return &PacketListener{base: base}
+}
+
+// ListenPacket implements [transport.PacketListener].
+func (l *PacketListener) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	conn, err := l.base.ListenPacket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &roamingPacketConn{listen: l.base.ListenPacket, conn: conn}
+	c.onClose = func() { l.remove(c) }
+	l.add(c)
+	return c, nil
+}
+
+// roamingPacketConn is a [net.PacketConn] that can move to a new connection from listen.
+type roamingPacketConn struct {
+	listen  func(ctx context.Context) (net.PacketConn, error)
+	onClose func()
+	// rebindMu serializes the rebinds.
+	rebindMu sync.Mutex
+
+	mu        sync.RWMutex
+	conn      net.PacketConn
+	deadlines deadlines
+	closed    bool
+}
+
+var _ net.PacketConn = (*roamingPacketConn)(nil)
+
+func (c *roamingPacketConn) current() net.PacketConn {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+func (c *roamingPacketConn) retry(conn net.PacketConn) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.closed && c.conn != conn
+}
+
+func (c *roamingPacketConn) rebind(ctx context.Context) error {
+	c.rebindMu.Lock()
+	defer c.rebindMu.Unlock()
+	conn, err := c.listen(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return conn.Close()
+	}
+	setDeadlines(conn, c.deadlines)
+	old := c.conn
+	c.conn = conn
+	c.mu.Unlock()
+	return old.Close()
+}
+
+func (c *roamingPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		conn := c.current()
+		n, addr, err := conn.ReadFrom(p)
+		if err != nil && c.retry(conn) {
+			continue
+		}
+		return n, addr, err
+	}
+}
+
+func (c *roamingPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	conn := c.current()
+	n, err := conn.WriteTo(p, addr)
+	if err != nil && c.retry(conn) {
+		return c.current().WriteTo(p, addr)
+	}
+	return n, err
+}
+
+func (c *roamingPacketConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	c.closed = true
+	conn := c.conn
+	c.mu.Unlock()
+	c.onClose()
+	return conn.Close()
+}
+
+func (c *roamingPacketConn) LocalAddr() net.Addr {
+	return c.current().LocalAddr()
+}
+
+func (c *roamingPacketConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadlines = deadlines{read: t, write: t}
+	return c.conn.SetDeadline(t)
+}
+
+func (c *roamingPacketConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadlines.read = t
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *roamingPacketConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadlines.write = t
+	return c.conn.SetWriteDeadline(t)
+}
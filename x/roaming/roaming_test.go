@@ -0,0 +1,136 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roaming
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// startUDPEchoServer runs a UDP server that echoes the packets it receives.
+func startUDPEchoServer(t *testing.T) net.PacketConn {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			server.WriteTo(buf[:n], addr)
+		}
+	}()
+	return server
+}
+
+func requireEcho(t *testing.T, conn net.Conn, msg string) {
+	_, err := conn.Write([]byte(msg))
+	require.NoError(t, err)
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, string(buf[:n]))
+}
+
+func TestPacketDialerRebind(t *testing.T) {
+	server := startUDPEchoServer(t)
+	dialer := NewPacketDialer(&transport.UDPDialer{})
+	conn, err := dialer.DialPacket(context.Background(), server.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	requireEcho(t, conn, "before")
+	oldAddr := conn.LocalAddr().String()
+
+	require.NoError(t, dialer.Rebind(context.Background()))
+	require.NotEqual(t, oldAddr, conn.LocalAddr().String())
+	requireEcho(t, conn, "after")
+
+	require.NoError(t, conn.Close())
+	require.Empty(t, dialer.conns)
+}
+
+func TestPacketDialerRebindUnblocksRead(t *testing.T) {
+	server := startUDPEchoServer(t)
+	dialer := NewPacketDialer(&transport.UDPDialer{})
+	conn, err := dialer.DialPacket(context.Background(), server.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	read := make(chan string)
+	go func() {
+		buf := make([]byte, 1024)
+		n, _ := conn.Read(buf)
+		read <- string(buf[:n])
+	}()
+	// Give the Read time to block on the old socket.
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, dialer.Rebind(context.Background()))
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	select {
+	case msg := <-read:
+		require.Equal(t, "hello", msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read didn't continue on the new socket")
+	}
+}
+
+func TestPacketDialerOnNetworkChange(t *testing.T) {
+	server := startUDPEchoServer(t)
+	dialer := NewPacketDialer(&transport.UDPDialer{})
+	rebound := make(chan error, 1)
+	dialer.OnRebind = func(err error) { rebound <- err }
+	conn, err := dialer.DialPacket(context.Background(), server.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	oldAddr := conn.LocalAddr().String()
+
+	dialer.OnNetworkChange()
+	require.NoError(t, <-rebound)
+	require.NotEqual(t, oldAddr, conn.LocalAddr().String())
+	requireEcho(t, conn, "hello")
+}
+
+func TestPacketListenerRebind(t *testing.T) {
+	server := startUDPEchoServer(t)
+	listener := NewPacketListener(&transport.UDPListener{Address: "127.0.0.1:0"})
+	conn, err := listener.ListenPacket(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	oldAddr := conn.LocalAddr().String()
+
+	require.NoError(t, listener.Rebind(context.Background()))
+	require.NotEqual(t, oldAddr, conn.LocalAddr().String())
+	_, err = conn.WriteTo([]byte("hello"), server.LocalAddr())
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 1024)
+	n, addr, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf[:n]))
+	require.Equal(t, server.LocalAddr().String(), addr.String())
+
+	require.NoError(t, conn.Close())
+	require.ErrorIs(t, conn.Close(), net.ErrClosed)
+	require.Empty(t, listener.conns)
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+	"github.com/goccy/go-yaml"
+)
+
+// Config is the YAML configuration of the dialers and rules.
+type Config struct {
+	// Dialers maps dialer names to their configurl config.
+	Dialers map[string]string `yaml:"dialers"`
+	Rules   []RuleConfig      `yaml:"rules"`
+	// Default is the name of the dialer to use when no rule matches.
+	Default string `yaml:"default"`
+}
+
+// RuleConfig is the YAML configuration of a [Rule].
+type RuleConfig struct {
+	DomainSuffix  []string `yaml:"domain_suffix,omitempty"`
+	DomainKeyword []string `yaml:"domain_keyword,omitempty"`
+	CIDR          []string `yaml:"cidr,omitempty"`
+	Port          []uint16 `yaml:"port,omitempty"`
+	Country       []string `yaml:"country,omitempty"`
+	Dialer        string   `yaml:"dialer"`
+}
+
+// ParseConfig parses the YAML config. Unknown fields are rejected.
+func ParseConfig(configBytes []byte) (*Config, error) {
+	var config Config
+	if err := yaml.UnmarshalWithOptions(configBytes, &config, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("failed to parse rules config: %w", err)
+	}
+	return &config, nil
+}
+
+// NewRouter creates the [Router] for the config, using countryLookup for country rules. countryLookup may be nil.
+func (c *Config) NewRouter(countryLookup CountryLookup) (*Router, error) {
+	rules := make([]Rule, len(c.Rules))
+	for i, ruleConfig := range c.Rules {
+		rule := Rule{
+			DomainSuffixes: ruleConfig.DomainSuffix,
+			DomainKeywords: ruleConfig.DomainKeyword,
+			Ports:          ruleConfig.Port,
+			Countries:      ruleConfig.Country,
+			Dialer:         ruleConfig.Dialer,
+		}
+		for _, cidr := range ruleConfig.CIDR {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %v: invalid cidr: %w", i, err)
+			}
+			rule.CIDRs = append(rule.CIDRs, prefix.Masked())
+		}
+		if len(rule.Countries) > 0 && countryLookup == nil {
+			return nil, fmt.Errorf("rule %v: country rules require a country lookup", i)
+		}
+		rules[i] = rule
+	}
+	router, err := NewRouter(rules, c.Default)
+	if err != nil {
+		return nil, err
+	}
+	router.CountryLookup = countryLookup
+	return router, nil
+}
+
+// NewStreamDialer creates the routing [transport.StreamDialer] for the config, creating the dialers with providers.
+func (c *Config) NewStreamDialer(ctx context.Context, providers *configurl.ProviderContainer, countryLookup CountryLookup) (transport.StreamDialer, error) {
+	router, err := c.NewRouter(countryLookup)
+	if err != nil {
+		return nil, err
+	}
+	dialers := make(map[string]transport.StreamDialer, len(c.Dialers))
+	for name, dialerConfig := range c.Dialers {
+		dialers[name], err = providers.NewStreamDialer(ctx, dialerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stream dialer %q: %w", name, err)
+		}
+	}
+	return NewStreamDialer(router, dialers)
+}
+
+// NewPacketDialer creates the routing [transport.PacketDialer] for the config, creating the dialers with providers.
+func (c *Config) NewPacketDialer(ctx context.Context, providers *configurl.ProviderContainer, countryLookup CountryLookup) (transport.PacketDialer, error) {
+	router, err := c.NewRouter(countryLookup)
+	if err != nil {
+		return nil, err
+	}
+	dialers := make(map[string]transport.PacketDialer, len(c.Dialers))
+	for name, dialerConfig := range c.Dialers {
+		dialers[name], err = providers.NewPacketDialer(ctx, dialerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create packet dialer %q: %w", name, err)
+		}
+	}
+	return NewPacketDialer(router, dialers)
+}
@@ -0,0 +1,228 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rules implements a rule-based routing engine that selects the dialer to use for each connection
+// based on the destination domain, IP, port, or country.
+//
+// Rules are evaluated in order, and the first rule that matches selects the dialer. A rule matches when all of
+// its conditions match, and a condition matches when any of its values match. If no rule matches, the default
+// dialer is used.
+//
+// Rules can be loaded from a YAML config with [ParseConfig]:
+//
+//	dialers:
+//	  proxy: ss://[USERINFO]@[HOST]:[PORT]
+//	  direct: ""
+//	rules:
+//	  - domain_suffix: [blocked.example, another.example]
+//	    dialer: proxy
+//	  - country: [IR, RU]
+//	    port: [443]
+//	    dialer: proxy
+//	  - cidr: [10.0.0.0/8]
+//	    dialer: direct
+//	default: direct
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Rule selects a dialer for the connections that match all of its non-empty conditions.
+type Rule struct {
+	// DomainSuffixes matches domains equal to or subdomains of any of the suffixes.
+	DomainSuffixes []string
+	// DomainKeywords matches domains containing any of the keywords.
+	DomainKeywords []string
+	// CIDRs matches IP destinations in any of the prefixes.
+	CIDRs []netip.Prefix
+	// Ports matches destinations with any of the ports.
+	Ports []uint16
+	// Countries matches IP destinations located in any of the countries, as ISO 3166-1 alpha-2 codes.
+	// It requires a [CountryLookup] in the [Router].
+	Countries []string
+	// Dialer is the name of the dialer to use for matching connections.
+	Dialer string
+}
+
+// CountryLookup returns the ISO 3166-1 alpha-2 country code of the IP address, or an empty string if unknown.
+type CountryLookup func(ip netip.Addr) string
+
+// Destination is the destination of a connection, as seen by the rules.
+type Destination struct {
+	// Domain is the lowercase domain name without the trailing dot, or empty if the host is an IP address.
+	Domain string
+	// IP is the IP address, or invalid if the host is a domain name.
+	IP   netip.Addr
+	Port uint16
+}
+
+// ParseDestination parses a host:port address into a [Destination].
+func ParseDestination(address string) (Destination, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return Destination{}, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return Destination{}, fmt.Errorf("invalid port %q: %w", portStr, err)
+	}
+	dest := Destination{Port: uint16(port)}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		dest.IP = ip.Unmap()
+	} else {
+		dest.Domain = normalizeDomain(host)
+	}
+	return dest, nil
+}
+
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+// Router evaluates rules to select the dialer name for a destination.
+type Router struct {
+	rules         []Rule
+	defaultDialer string
+	// CountryLookup is used to evaluate country conditions. Rules with countries never match if it's nil.
+	CountryLookup CountryLookup
+}
+
+// NewRouter creates a [Router] with the given rules and the name of the dialer to use when no rule matches.
+func NewRouter(rules []Rule, defaultDialer string) (*Router, error) {
+	normalized := make([]Rule, len(rules))
+	for i, rule := range rules {
+		if rule.Dialer == "" {
+			return nil, fmt.Errorf("rule %v: dialer must not be empty", i)
+		}
+		if len(rule.DomainSuffixes)+len(rule.DomainKeywords)+len(rule.CIDRs)+len(rule.Ports)+len(rule.Countries) == 0 {
+			return nil, fmt.Errorf("rule %v: must have at least one condition", i)
+		}
+		rule.DomainSuffixes = normalizeList(rule.DomainSuffixes, normalizeDomain)
+		rule.DomainKeywords = normalizeList(rule.DomainKeywords, strings.ToLower)
+		rule.Countries = normalizeList(rule.Countries, strings.ToUpper)
+		normalized[i] = rule
+	}
+	if defaultDialer == "" {
+		return nil, errors.New("default dialer must not be empty")
+	}
+	return &Router{rules: normalized, defaultDialer: defaultDialer}, nil
+}
+
+func normalizeList(values []string, normalize func(string) string) []string {
+	if values == nil {
+		return nil
+	}
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = normalize(value)
+	}
+	return result
+}
+
+// Route returns the name of the dialer for the destination.
+func (r *Router) Route(dest Destination) string {
+	for _, rule := range r.rules {
+		if r.matches(&rule, dest) {
+			return rule.Dialer
+		}
+	}
+	return r.defaultDialer
+}
+
+func (r *Router) matches(rule *Rule, dest Destination) bool {
+	if len(rule.Ports) > 0 && !containsPort(rule.Ports, dest.Port) {
+		return false
+	}
+	if len(rule.DomainSuffixes) > 0 && !matchesSuffix(rule.DomainSuffixes, dest.Domain) {
+		return false
+	}
+	if len(rule.DomainKeywords) > 0 && !matchesKeyword(rule.DomainKeywords, dest.Domain) {
+		return false
+	}
+	if len(rule.CIDRs) > 0 && !matchesCIDR(rule.CIDRs, dest.IP) {
+		return false
+	}
+	if len(rule.Countries) > 0 {
+		if r.CountryLookup == nil || !dest.IP.IsValid() {
+			return false
+		}
+		if !containsString(rule.Countries, strings.ToUpper(r.CountryLookup(dest.IP))) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsPort(ports []uint16, port uint16) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesSuffix(suffixes []string, domain string) bool {
+	if domain == "" {
+		return false
+	}
+	for _, suffix := range suffixes {
+		if domain == suffix || strings.HasSuffix(domain, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesKeyword(keywords []string, domain string) bool {
+	if domain == "" {
+		return false
+	}
+	for _, keyword := range keywords {
+		if strings.Contains(domain, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesCIDR(prefixes []netip.Prefix, ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
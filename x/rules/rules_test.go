@@ -0,0 +1,152 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDestination(t *testing.T, address string) Destination {
+	dest, err := ParseDestination(address)
+	require.NoError(t, err)
+	return dest
+}
+
+func TestParseDestination(t *testing.T) {
+	require.Equal(t, Destination{Domain: "www.example.com", Port: 443}, mustDestination(t, "WWW.Example.com.:443"))
+	require.Equal(t, Destination{IP: netip.MustParseAddr("1.2.3.4"), Port: 53}, mustDestination(t, "[::ffff:1.2.3.4]:53"))
+	_, err := ParseDestination("example.com")
+	require.Error(t, err)
+	_, err = ParseDestination("example.com:https")
+	require.Error(t, err)
+}
+
+func TestRouter_Route(t *testing.T) {
+	router, err := NewRouter([]Rule{
+		{DomainSuffixes: []string{"Blocked.example"}, Dialer: "proxy"},
+		{DomainKeywords: []string{"video"}, Ports: []uint16{443}, Dialer: "proxy"},
+		{CIDRs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, Dialer: "local"},
+		{Countries: []string{"ir"}, Dialer: "proxy"},
+	}, "direct")
+	require.NoError(t, err)
+	router.CountryLookup = func(ip netip.Addr) string {
+		if ip == netip.MustParseAddr("5.5.5.5") {
+			return "IR"
+		}
+		return ""
+	}
+
+	for address, expected := range map[string]string{
+		"blocked.example:443":        "proxy",
+		"www.blocked.example:80":     "proxy",
+		"notblocked.example:443":     "direct",
+		"myvideosite.example:443":    "proxy",
+		"myvideosite.example:80":     "direct",
+		"10.1.2.3:22":                "local",
+		"11.1.2.3:22":                "direct",
+		"5.5.5.5:443":                "proxy",
+		"6.6.6.6:443":                "direct",
+		"[2001:db8::1]:443":          "direct",
+		"blocked.example.other:8080": "direct",
+	} {
+		require.Equal(t, expected, router.Route(mustDestination(t, address)), address)
+	}
+}
+
+func TestNewRouter_Errors(t *testing.T) {
+	_, err := NewRouter([]Rule{{Dialer: "proxy"}}, "direct")
+	require.Error(t, err)
+	_, err = NewRouter([]Rule{{Ports: []uint16{80}}}, "direct")
+	require.Error(t, err)
+	_, err = NewRouter(nil, "")
+	require.Error(t, err)
+}
+
+func namedDialer(name string, dialed *string) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		*dialed = name
+		return nil, errors.New("not implemented")
+	})
+}
+
+func TestNewStreamDialer(t *testing.T) {
+	router, err := NewRouter([]Rule{{DomainSuffixes: []string{"blocked.example"}, Dialer: "proxy"}}, "direct")
+	require.NoError(t, err)
+
+	_, err = NewStreamDialer(router, map[string]transport.StreamDialer{"direct": &transport.TCPDialer{}})
+	require.ErrorContains(t, err, "proxy")
+
+	var dialed string
+	dialer, err := NewStreamDialer(router, map[string]transport.StreamDialer{
+		"direct": namedDialer("direct", &dialed),
+		"proxy":  namedDialer("proxy", &dialed),
+	})
+	require.NoError(t, err)
+	dialer.DialStream(context.Background(), "www.blocked.example:443")
+	require.Equal(t, "proxy", dialed)
+	dialer.DialStream(context.Background(), "www.example.com:443")
+	require.Equal(t, "direct", dialed)
+}
+
+func TestConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+dialers:
+  direct: ""
+  split: "split:2"
+rules:
+  - domain_suffix: [blocked.example]
+    port: [443]
+    dialer: split
+  - cidr: [192.168.0.0/16]
+    dialer: direct
+default: direct
+`))
+	require.NoError(t, err)
+	require.Len(t, config.Rules, 2)
+	router, err := config.NewRouter(nil)
+	require.NoError(t, err)
+	require.Equal(t, "split", router.Route(mustDestination(t, "blocked.example:443")))
+
+	dialer, err := config.NewStreamDialer(context.Background(), configurl.NewDefaultProviders(), nil)
+	require.NoError(t, err)
+	require.NotNil(t, dialer)
+}
+
+func TestConfig_Errors(t *testing.T) {
+	_, err := ParseConfig([]byte(`unknown_field: 1`))
+	require.Error(t, err)
+
+	config, err := ParseConfig([]byte(`{rules: [{cidr: [not-a-cidr], dialer: direct}], default: direct}`))
+	require.NoError(t, err)
+	_, err = config.NewRouter(nil)
+	require.Error(t, err)
+
+	config, err = ParseConfig([]byte(`{rules: [{country: [IR], dialer: direct}], default: direct}`))
+	require.NoError(t, err)
+	_, err = config.NewRouter(nil)
+	require.Error(t, err)
+
+	config, err = ParseConfig([]byte(`{dialers: {direct: "unknown:"}, default: direct}`))
+	require.NoError(t, err)
+	_, err = config.NewStreamDialer(context.Background(), configurl.NewDefaultProviders(), nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+type routingDialer struct {
+	router  *Router
+	dialers map[string]transport.StreamDialer
+}
+
+var _ transport.StreamDialer = (*routingDialer)(nil)
+
+// NewStreamDialer creates a [transport.StreamDialer] that uses the router to select, for each connection,
+// which of the named dialers to use.
+func NewStreamDialer(router *Router, dialers map[string]transport.StreamDialer) (transport.StreamDialer, error) {
+	if router == nil {
+		return nil, errors.New("router must not be nil")
+	}
+	if err := checkDialerNames(router, dialers); err != nil {
+		return nil, err
+	}
+	return &routingDialer{router: router, dialers: dialers}, nil
+}
+
+// DialStream implements [transport.StreamDialer].DialStream.
+func (d *routingDialer) DialStream(ctx context.Context, remoteAddr string) (transport.StreamConn, error) {
+	dest, err := ParseDestination(remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	return d.dialers[d.router.Route(dest)].DialStream(ctx, remoteAddr)
+}
+
+type routingPacketDialer struct {
+	router  *Router
+	dialers map[string]transport.PacketDialer
+}
+
+var _ transport.PacketDialer = (*routingPacketDialer)(nil)
+
+// NewPacketDialer creates a [transport.PacketDialer] that uses the router to select, for each connection,
+// which of the named dialers to use.
+func NewPacketDialer(router *Router, dialers map[string]transport.PacketDialer) (transport.PacketDialer, error) {
+	if router == nil {
+		return nil, errors.New("router must not be nil")
+	}
+	if err := checkDialerNames(router, dialers); err != nil {
+		return nil, err
+	}
+	return &routingPacketDialer{router: router, dialers: dialers}, nil
+}
+
+// DialPacket implements [transport.PacketDialer].DialPacket.
+func (d *routingPacketDialer) DialPacket(ctx context.Context, remoteAddr string) (net.Conn, error) {
+	dest, err := ParseDestination(remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	return d.dialers[d.router.Route(dest)].DialPacket(ctx, remoteAddr)
+}
+
+// checkDialerNames makes sure all the dialers referenced by the router exist.
+func checkDialerNames[T any](router *Router, dialers map[string]T) error {
+	names := []string{router.defaultDialer}
+	for _, rule := range router.rules {
+		names = append(names, rule.Dialer)
+	}
+	for _, name := range names {
+		if _, ok := dialers[name]; !ok {
+			return fmt.Errorf("dialer %q is not defined", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scramble implements a keyed scrambling layer that masks the byte patterns of the
+// wrapped protocol.
+//
+// Scrambling is obfuscation, NOT encryption. It provides no integrity and no authentication,
+// and anyone who knows the key can unscramble the traffic. Only use it to wrap protocols that
+// are already encrypted, such as TLS or Shadowsocks, when the goal is to hide their signatures
+// from passive traffic classifiers.
+//
+// Each direction of a connection starts with a random 16-byte nonce, followed by the payload
+// XORed with an AES-CTR keystream derived from the key and the nonce. The two peers must use
+// the same key.
+package scramble
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// NonceSize is the size of the random nonce that prefixes each direction of the stream.
+const NonceSize = aes.BlockSize
+
+func newKeyStream(key []byte, nonce []byte) (cipher.Stream, error) {
+	// Hash the key so that keys of any length can be used.
+	derivedKey := sha256.Sum256(key)
+	block, err := aes.NewCipher(derivedKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, nonce), nil
+}
+
+func checkKey(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("scramble key must not be empty")
+	}
+	return nil
+}
+
+type scrambleWriter struct {
+	w      io.Writer
+	key    []byte
+	stream cipher.Stream
+}
+
+var _ io.Writer = (*scrambleWriter)(nil)
+
+// NewWriter returns an [io.Writer] that scrambles the data written to it with the given key
+// before writing it to w. The nonce is sent together with the first write.
+func NewWriter(w io.Writer, key []byte) (io.Writer, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return &scrambleWriter{w: w, key: key}, nil
+}
+
+func (sw *scrambleWriter) Write(data []byte) (int, error) {
+	var out []byte
+	if sw.stream == nil {
+		out = make([]byte, NonceSize+len(data))
+		nonce := out[:NonceSize]
+		if _, err := rand.Read(nonce); err != nil {
+			return 0, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		stream, err := newKeyStream(sw.key, nonce)
+		if err != nil {
+			return 0, err
+		}
+		sw.stream = stream
+		sw.stream.XORKeyStream(out[NonceSize:], data)
+	} else {
+		out = make([]byte, len(data))
+		sw.stream.XORKeyStream(out, data)
+	}
+	n, err := sw.w.Write(out)
+	// Report the number of payload bytes written, excluding the nonce.
+	n -= len(out) - len(data)
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+type scrambleReader struct {
+	r      io.Reader
+	key    []byte
+	stream cipher.Stream
+}
+
+var _ io.Reader = (*scrambleReader)(nil)
+
+// NewReader returns an [io.Reader] that unscrambles the data read from r with the given key.
+// It expects the stream to start with the nonce written by a writer created with [NewWriter].
+func NewReader(r io.Reader, key []byte) (io.Reader, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return &scrambleReader{r: r, key: key}, nil
+}
+
+func (sr *scrambleReader) Read(data []byte) (int, error) {
+	if sr.stream == nil {
+		nonce := make([]byte, NonceSize)
+		if _, err := io.ReadFull(sr.r, nonce); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return 0, fmt.Errorf("failed to read nonce: %w", err)
+			}
+			return 0, err
+		}
+		stream, err := newKeyStream(sr.key, nonce)
+		if err != nil {
+			return 0, err
+		}
+		sr.stream = stream
+	}
+	n, err := sr.r.Read(data)
+	sr.stream.XORKeyStream(data[:n], data[:n])
+	return n, err
+}
@@ -0,0 +1,69 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scramble
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+type scrambleDialer struct {
+	dialer transport.StreamDialer
+	key    []byte
+}
+
+var _ transport.StreamDialer = (*scrambleDialer)(nil)
+
+// NewStreamDialer creates a [transport.StreamDialer] that scrambles the connections created by dialer
+// with the given key. The server must unscramble the traffic with the same key.
+func NewStreamDialer(dialer transport.StreamDialer, key []byte) (transport.StreamDialer, error) {
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return &scrambleDialer{dialer: dialer, key: append([]byte(nil), key...)}, nil
+}
+
+// DialStream implements [transport.StreamDialer].DialStream.
+func (d *scrambleDialer) DialStream(ctx context.Context, remoteAddr string) (transport.StreamConn, error) {
+	innerConn, err := d.dialer.DialStream(ctx, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := WrapConn(innerConn, d.key)
+	if err != nil {
+		innerConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// WrapConn wraps conn so that its traffic is scrambled with the given key in both directions.
+// It can be used on both the client and the server side.
+func WrapConn(conn transport.StreamConn, key []byte) (transport.StreamConn, error) {
+	r, err := NewReader(conn, key)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(conn, key)
+	if err != nil {
+		return nil, err
+	}
+	return transport.WrapConn(conn, r, w), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scramble
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterReader_RoundTrip(t *testing.T) {
+	key := []byte("secret")
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, key)
+	require.NoError(t, err)
+	n, err := w.Write([]byte("Hello "))
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+	n, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+
+	require.Equal(t, NonceSize+11, buf.Len())
+	require.NotContains(t, buf.String(), "Hello")
+
+	r, err := NewReader(&buf, key)
+	require.NoError(t, err)
+	plain, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "Hello world", string(plain))
+}
+
+func TestWriter_RandomNonce(t *testing.T) {
+	var buf1, buf2 bytes.Buffer
+	w1, err := NewWriter(&buf1, []byte("key"))
+	require.NoError(t, err)
+	w2, err := NewWriter(&buf2, []byte("key"))
+	require.NoError(t, err)
+	_, err = w1.Write([]byte("same payload"))
+	require.NoError(t, err)
+	_, err = w2.Write([]byte("same payload"))
+	require.NoError(t, err)
+	require.NotEqual(t, buf1.Bytes(), buf2.Bytes())
+}
+
+func TestReader_WrongKey(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []byte("key1"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("payload"))
+	require.NoError(t, err)
+
+	r, err := NewReader(&buf, []byte("key2"))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NotEqual(t, "payload", string(plain))
+}
+
+func TestReader_ShortNonce(t *testing.T) {
+	r, err := NewReader(bytes.NewReader([]byte{1, 2, 3}), []byte("key"))
+	require.NoError(t, err)
+	_, err = r.Read(make([]byte, 10))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestNewStreamDialer_Errors(t *testing.T) {
+	_, err := NewStreamDialer(nil, []byte("key"))
+	require.Error(t, err)
+	_, err = NewStreamDialer(&transport.TCPDialer{}, nil)
+	require.Error(t, err)
+}
+
+func TestStreamDialer(t *testing.T) {
+	key := []byte("secret")
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		clientConn, err := listener.AcceptTCP()
+		if err != nil {
+			return
+		}
+		defer clientConn.Close()
+		conn, err := WrapConn(clientConn, key)
+		if err != nil {
+			return
+		}
+		io.Copy(conn, conn)
+		conn.CloseWrite()
+	}()
+
+	dialer, err := NewStreamDialer(&transport.TCPDialer{}, key)
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(response))
+}
@@ -0,0 +1,143 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Jigsaw-Code/outline-sdk/x/rules"
+	"github.com/goccy/go-yaml"
+)
+
+// Config is the YAML configuration of a [Service].
+type Config struct {
+	// Dialers maps dialer names to their configurl config. The empty config is the direct dialer.
+	Dialers map[string]string `yaml:"dialers"`
+	// Rules route the destinations to the dialers, as in the rules package.
+	Rules []rules.RuleConfig `yaml:"rules,omitempty"`
+	// Default is the name of the dialer to use when no rule matches.
+	Default string `yaml:"default"`
+	// Listeners are the local servers to run.
+	Listeners []ListenerConfig `yaml:"listeners"`
+}
+
+// ListenerType is the kind of local server.
+type ListenerType string
+
+const (
+	// ListenerHTTP is an HTTP proxy, supporting CONNECT and absolute requests.
+	ListenerHTTP ListenerType = "http"
+	// ListenerForward relays connections or datagrams to a fixed target, like "ssh -L".
+	ListenerForward ListenerType = "forward"
+	// ListenerMetrics serves the metrics of the other listeners in the Prometheus text format.
+	ListenerMetrics ListenerType = "metrics"
+)
+
+// ListenerConfig is the configuration of a local server.
+type ListenerConfig struct {
+	// Type is the kind of server.
+	Type ListenerType `yaml:"type"`
+	// Address is the local host:port to listen on, or the path of the socket for the "unix" network.
+	Address string `yaml:"address"`
+	// Network is "tcp", "udp" or "unix". Only forward listeners support "udp". If empty, "tcp" is used.
+	Network string `yaml:"network,omitempty"`
+	// Target is the host:port forward listeners relay to.
+	Target string `yaml:"target,omitempty"`
+	// Dialer is the name of the dialer to use, bypassing the rules. If empty, the rules are used.
+	Dialer string `yaml:"dialer,omitempty"`
+	// Path is the HTTP path of metrics listeners. If empty, "/metrics" is used.
+	Path string `yaml:"path,omitempty"`
+}
+
+// network returns the listener network, with the default applied.
+func (c *ListenerConfig) network() string {
+	if c.Network == "" {
+		return "tcp"
+	}
+	return strings.ToLower(c.Network)
+}
+
+// normalized returns a copy with the defaults applied, to compare configs.
+func (c ListenerConfig) normalized() ListenerConfig {
+	c.Network = c.network()
+	return c
+}
+
+// ParseConfig parses the YAML config. Unknown fields are rejected.
+func ParseConfig(configBytes []byte) (*Config, error) {
+	var config Config
+	if err := yaml.UnmarshalWithOptions(configBytes, &config, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("failed to parse service config: %w", err)
+	}
+	return &config, nil
+}
+
+// validate checks the listener configs, and that the dialer names they use are defined.
+func (c *Config) validate() error {
+	if len(c.Listeners) == 0 {
+		return errors.New("must specify at least one listener")
+	}
+	seen := make(map[ListenerConfig]bool, len(c.Listeners))
+	for i, listener := range c.Listeners {
+		if seen[listener.normalized()] {
+			return fmt.Errorf("listener %v: duplicate listener", i)
+		}
+		seen[listener.normalized()] = true
+		switch network := listener.network(); network {
+		case "tcp", "udp":
+			if _, _, err := net.SplitHostPort(listener.Address); err != nil {
+				return fmt.Errorf("listener %v: invalid address: %w", i, err)
+			}
+			if network == "udp" && listener.Type != ListenerForward {
+				return fmt.Errorf("listener %v: network udp requires type %v", i, ListenerForward)
+			}
+		case "unix":
+			if listener.Address == "" {
+				return fmt.Errorf("listener %v: must specify the socket path as the address", i)
+			}
+		default:
+			return fmt.Errorf("listener %v: unsupported network %q", i, network)
+		}
+		if listener.Path != "" && listener.Type != ListenerMetrics {
+			return fmt.Errorf("listener %v: only metrics listeners support path", i)
+		}
+		switch listener.Type {
+		case ListenerHTTP:
+			if listener.Target != "" {
+				return fmt.Errorf("listener %v: http listeners don't support target", i)
+			}
+		case ListenerForward:
+			if _, _, err := net.SplitHostPort(listener.Target); err != nil {
+				return fmt.Errorf("listener %v: invalid target: %w", i, err)
+			}
+		case ListenerMetrics:
+			if listener.Target != "" || listener.Dialer != "" {
+				return fmt.Errorf("listener %v: metrics listeners don't support target or dialer", i)
+			}
+			if listener.Path != "" && !strings.HasPrefix(listener.Path, "/") {
+				return fmt.Errorf("listener %v: path must start with /", i)
+			}
+		default:
+			return fmt.Errorf("listener %v: unsupported type %q", i, listener.Type)
+		}
+		if _, ok := c.Dialers[listener.Dialer]; listener.Dialer != "" && !ok {
+			return fmt.Errorf("listener %v: dialer %q is not defined", i, listener.Dialer)
+		}
+	}
+	return nil
+}
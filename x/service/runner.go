@@ -0,0 +1,122 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+	"github.com/Jigsaw-Code/outline-sdk/x/rules"
+)
+
+const (
+	// DefaultPollInterval is how often [Runner] checks the config file for changes if PollInterval is zero.
+	DefaultPollInterval = 5 * time.Second
+	// DefaultShutdownTimeout is how long [Runner] waits for the graceful shutdown if ShutdownTimeout is zero.
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+// Runner runs a [Service] from a config file. It reloads the config on SIGHUP, or when the file changes.
+type Runner struct {
+	// ConfigPath is the path to the YAML config file. It must not be empty.
+	ConfigPath string
+	// Providers creates the dialers. If nil, [configurl.NewDefaultProviders] is used.
+	Providers *configurl.ProviderContainer
+	// CountryLookup is used for the country rules. It may be nil.
+	CountryLookup rules.CountryLookup
+	// PollInterval is how often the config file is checked for changes. If zero, [DefaultPollInterval] is used.
+	// If negative, the file is only reloaded on SIGHUP.
+	PollInterval time.Duration
+	// ShutdownTimeout limits the graceful shutdown. If zero, [DefaultShutdownTimeout] is used.
+	ShutdownTimeout time.Duration
+	// OnReload, if not nil, is called after every reload with its error, or nil if it succeeded.
+	// A failed reload keeps the previous config running.
+	OnReload func(err error)
+}
+
+// Run starts the service with the config file, and runs it until ctx is done, when it shuts the service down.
+// It returns an error if the initial config can't be loaded, or if the shutdown fails.
+func (r *Runner) Run(ctx context.Context) error {
+	if r.ConfigPath == "" {
+		return errors.New("config path must not be empty")
+	}
+	configBytes, err := os.ReadFile(r.ConfigPath)
+	if err != nil {
+		return err
+	}
+	config, err := ParseConfig(configBytes)
+	if err != nil {
+		return err
+	}
+	svc := New(r.Providers, r.CountryLookup)
+	if err := svc.Reload(ctx, config); err != nil {
+		svc.Shutdown(context.Background())
+		return err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	var tick <-chan time.Time
+	pollInterval := r.PollInterval
+	if pollInterval == 0 {
+		pollInterval = DefaultPollInterval
+	}
+	if pollInterval > 0 {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	reload := func(force bool) {
+		newBytes, err := os.ReadFile(r.ConfigPath)
+		if err == nil && !force && bytes.Equal(newBytes, configBytes) {
+			return
+		}
+		if err == nil {
+			// Don't retry a broken config until it changes again.
+			configBytes = newBytes
+			config, err = ParseConfig(newBytes)
+		}
+		if err == nil {
+			err = svc.Reload(ctx, config)
+		}
+		if r.OnReload != nil {
+			r.OnReload(err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			timeout := r.ShutdownTimeout
+			if timeout == 0 {
+				timeout = DefaultShutdownTimeout
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return svc.Shutdown(shutdownCtx)
+		case <-hup:
+			reload(true)
+		case <-tick:
+			reload(false)
+		}
+	}
+}
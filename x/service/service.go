@@ -0,0 +1,367 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package service runs a combined proxy service from a single config: named client chains, routing rules between
+them, and local listeners, like HTTP proxies and port forwards. It's the basis for a daemon built on the SDK.
+
+The config is in YAML:
+
+	dialers:
+	  direct: ""
+	  proxy: ss://[USERINFO]@[HOST]:[PORT]
+	rules:
+	  - domain_suffix: [example.com]
+	    dialer: direct
+	default: proxy
+	listeners:
+	  - type: http
+	    address: 127.0.0.1:8080
+	  - type: forward
+	    network: udp
+	    address: 127.0.0.1:5353
+	    target: 8.8.8.8:53
+	  - type: metrics
+	    address: 127.0.0.1:9090
+
+Listeners with the "unix" network listen on the socket path in the address instead of a TCP port. The socket is only
+accessible to the user of the process, which is safer than the loopback interface on multi-user systems, and works
+in sandboxes that don't allow listening on ports.
+
+[Service.Reload] applies a new config without dropping connections: the dialers are swapped atomically, and only
+the listeners whose config changed are restarted. A [Runner] reloads the config file on SIGHUP or when it changes,
+and shuts the service down gracefully when its context is done.
+
+The service collects the metrics of its listeners, as described in [metrics.ServerMetrics], with the listener type
+and address as the server label. A metrics listener exposes them to Prometheus.
+*/
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+	"github.com/Jigsaw-Code/outline-sdk/x/forwarder"
+	"github.com/Jigsaw-Code/outline-sdk/x/httpproxy"
+	"github.com/Jigsaw-Code/outline-sdk/x/metrics"
+	"github.com/Jigsaw-Code/outline-sdk/x/rules"
+)
+
+// ErrShutdown is returned by [Service.Reload] after [Service.Shutdown].
+var ErrShutdown = errors.New("service is shut down")
+
+// Service runs the listeners of a [Config].
+type Service struct {
+	providers     *configurl.ProviderContainer
+	countryLookup rules.CountryLookup
+	dialers       atomic.Pointer[dialerSet]
+	registry      *metrics.Registry
+	metrics       *metrics.ServerMetrics
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[ListenerConfig]*runningListener
+	order     []*runningListener
+}
+
+// New creates a [Service] that creates the dialers with providers, and uses countryLookup for country rules.
+// If providers is nil, [configurl.NewDefaultProviders] is used. countryLookup may be nil. It's also used for the
+// client country in the metrics. Call [Service.Reload] to start it.
+func New(providers *configurl.ProviderContainer, countryLookup rules.CountryLookup) *Service {
+	if providers == nil {
+		providers = configurl.NewDefaultProviders()
+	}
+	registry := metrics.NewRegistry()
+	// The registry is new, so the registration can't fail.
+	serverMetrics, _ := metrics.NewServerMetrics(registry, countryLookup)
+	return &Service{
+		providers:     providers,
+		countryLookup: countryLookup,
+		registry:      registry,
+		metrics:       serverMetrics,
+		listeners:     make(map[ListenerConfig]*runningListener),
+	}
+}
+
+// Metrics returns the registry with the metrics of the listeners. It's kept across reloads.
+func (s *Service) Metrics() *metrics.Registry {
+	return s.registry
+}
+
+// dialerSet is the set of dialers of a config.
+type dialerSet struct {
+	streamRouter transport.StreamDialer
+	packetRouter transport.PacketDialer
+	streams      map[string]transport.StreamDialer
+	packets      map[string]transport.PacketDialer
+}
+
+func (s *Service) newDialerSet(ctx context.Context, config *Config) (*dialerSet, error) {
+	rulesConfig := &rules.Config{Dialers: config.Dialers, Rules: config.Rules, Default: config.Default}
+	set := &dialerSet{streams: make(map[string]transport.StreamDialer), packets: make(map[string]transport.PacketDialer)}
+	var err error
+	for name, dialerConfig := range config.Dialers {
+		if set.streams[name], err = s.providers.NewStreamDialer(ctx, dialerConfig); err != nil {
+			return nil, fmt.Errorf("failed to create stream dialer %q: %w", name, err)
+		}
+	}
+	router, err := rulesConfig.NewRouter(s.countryLookup)
+	if err != nil {
+		return nil, err
+	}
+	if set.streamRouter, err = rules.NewStreamDialer(router, set.streams); err != nil {
+		return nil, err
+	}
+	// Packet dialers are only created if needed, since some configs only support streams.
+	needsPacketRouter := false
+	for _, listener := range config.Listeners {
+		if listener.network() != "udp" {
+			continue
+		}
+		if listener.Dialer == "" {
+			needsPacketRouter = true
+			continue
+		}
+		if _, ok := set.packets[listener.Dialer]; ok {
+			continue
+		}
+		if set.packets[listener.Dialer], err = s.providers.NewPacketDialer(ctx, config.Dialers[listener.Dialer]); err != nil {
+			return nil, fmt.Errorf("failed to create packet dialer %q: %w", listener.Dialer, err)
+		}
+	}
+	if needsPacketRouter {
+		if set.packetRouter, err = rulesConfig.NewPacketDialer(ctx, s.providers, s.countryLookup); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// streamDialer returns a dialer that uses the current dialer with the name, or the router if the name is empty.
+func (s *Service) streamDialer(name string) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		set := s.dialers.Load()
+		dialer := set.streamRouter
+		if name != "" {
+			dialer = set.streams[name]
+		}
+		if dialer == nil {
+			return nil, fmt.Errorf("stream dialer %q is not available", name)
+		}
+		return dialer.DialStream(ctx, addr)
+	})
+}
+
+// packetDialer is like streamDialer, for packets.
+func (s *Service) packetDialer(name string) transport.PacketDialer {
+	return transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		set := s.dialers.Load()
+		dialer := set.packetRouter
+		if name != "" {
+			dialer = set.packets[name]
+		}
+		if dialer == nil {
+			return nil, fmt.Errorf("packet dialer %q is not available", name)
+		}
+		return dialer.DialPacket(ctx, addr)
+	})
+}
+
+// Reload applies the config. The first call starts the service. If the config or its dialers are invalid, the
+// running config is kept. Otherwise the new dialers are used for new connections, the listeners that are not in the
+// new config are stopped, and the new ones started. The ctx limits the creation of the dialers and the graceful
+// stop of the listeners. Errors starting listeners are returned, but don't stop the other listeners.
+func (s *Service) Reload(ctx context.Context, config *Config) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	set, err := s.newDialerSet(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrShutdown
+	}
+	s.dialers.Store(set)
+
+	wanted := make(map[ListenerConfig]bool, len(config.Listeners))
+	for _, listenerConfig := range config.Listeners {
+		wanted[listenerConfig.normalized()] = true
+	}
+	var errs []error
+	for key, listener := range s.listeners {
+		if !wanted[key] {
+			errs = append(errs, listener.stop(ctx))
+			delete(s.listeners, key)
+		}
+	}
+	order := make([]*runningListener, 0, len(config.Listeners))
+	for _, listenerConfig := range config.Listeners {
+		key := listenerConfig.normalized()
+		listener, ok := s.listeners[key]
+		if !ok {
+			listener, err = s.startListener(key)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to start %v listener on %v: %w", key.Type, key.Address, err))
+				continue
+			}
+			s.listeners[key] = listener
+		}
+		order = append(order, listener)
+	}
+	s.order = order
+	return errors.Join(errs...)
+}
+
+// Addrs returns the addresses of the running listeners, in the order of the config.
+func (s *Service) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := make([]net.Addr, len(s.order))
+	for i, listener := range s.order {
+		addrs[i] = listener.addr
+	}
+	return addrs
+}
+
+// Shutdown stops the listeners gracefully, waiting until ctx is done for the HTTP requests in progress to finish.
+// Forwarded connections are closed right away.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var errs []error
+	for key, listener := range s.listeners {
+		errs = append(errs, listener.stop(ctx))
+		delete(s.listeners, key)
+	}
+	s.order = nil
+	return errors.Join(errs...)
+}
+
+type runningListener struct {
+	addr net.Addr
+	stop func(ctx context.Context) error
+}
+
+func (s *Service) startListener(config ListenerConfig) (*runningListener, error) {
+	if config.Network == "udp" {
+		pc, err := net.ListenPacket("udp", config.Address)
+		if err != nil {
+			return nil, err
+		}
+		pc = s.metrics.WrapPacketConn(string(config.Type)+"/udp:"+config.Address, pc)
+		f, err := forwarder.NewPacketForwarder(s.packetDialer(config.Dialer), config.Target)
+		if err != nil {
+			pc.Close()
+			return nil, err
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			f.Serve(pc)
+		}()
+		return &runningListener{addr: pc.LocalAddr(), stop: func(ctx context.Context) error {
+			pc.Close()
+			return wait(ctx, done)
+		}}, nil
+	}
+
+	listener, err := listenStream(config)
+	if err != nil {
+		return nil, err
+	}
+	switch config.Type {
+	case ListenerMetrics:
+		path := config.Path
+		if path == "" {
+			path = "/metrics"
+		}
+		mux := http.NewServeMux()
+		mux.Handle(path, s.registry)
+		server := &http.Server{Handler: mux}
+		go server.Serve(listener)
+		return &runningListener{addr: listener.Addr(), stop: server.Shutdown}, nil
+	case ListenerHTTP:
+		listener = s.metrics.WrapListener(string(config.Type)+":"+config.Address, listener)
+		server := &http.Server{Handler: httpproxy.NewProxyHandler(s.streamDialer(config.Dialer))}
+		go server.Serve(listener)
+		return &runningListener{addr: listener.Addr(), stop: server.Shutdown}, nil
+	default:
+		f, err := forwarder.NewStreamForwarder(s.streamDialer(config.Dialer), config.Target)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		listener = s.metrics.WrapListener(string(config.Type)+":"+config.Address, listener)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			f.Serve(listener)
+		}()
+		return &runningListener{addr: listener.Addr(), stop: func(ctx context.Context) error {
+			listener.Close()
+			return wait(ctx, done)
+		}}, nil
+	}
+}
+
+// listenStream listens on the TCP address of the config, or on the socket path for the unix network. The socket is
+// only accessible to the user of the process, and a stale socket left by a previous run is replaced. The socket is
+// removed when the listener is closed.
+func listenStream(config ListenerConfig) (net.Listener, error) {
+	if config.Network != "unix" {
+		return net.Listen("tcp", config.Address)
+	}
+	if info, err := os.Lstat(config.Address); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		// Only remove sockets, so a wrong path can't delete other files.
+		if err := os.Remove(config.Address); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	listener, err := net.Listen("unix", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(config.Address, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// wait waits for done to be closed, or for ctx to be done.
+func wait(ctx context.Context, done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startTarget runs a TCP server that writes the greeting to every connection.
+func startTarget(t *testing.T, greeting string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(greeting))
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func readGreeting(t *testing.T, addr string) string {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	greeting, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(greeting)
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+dialers:
+  direct: ""
+default: direct
+listeners:
+  - type: forward
+    network: udp
+    address: 127.0.0.1:5353
+    target: 8.8.8.8:53
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"direct": ""}, config.Dialers)
+	require.Equal(t, []ListenerConfig{{Type: ListenerForward, Network: "udp", Address: "127.0.0.1:5353", Target: "8.8.8.8:53"}}, config.Listeners)
+	require.NoError(t, config.validate())
+
+	_, err = ParseConfig([]byte("unknown: 1"))
+	require.Error(t, err)
+}
+
+func TestConfig_Invalid(t *testing.T) {
+	for name, listener := range map[string]ListenerConfig{
+		"no address":     {Type: ListenerHTTP},
+		"bad type":       {Type: "socks", Address: ":0"},
+		"udp http":       {Type: ListenerHTTP, Address: ":0", Network: "udp"},
+		"bad network":    {Type: ListenerForward, Address: ":0", Network: "ip", Target: "a:1"},
+		"no target":      {Type: ListenerForward, Address: ":0"},
+		"http target":    {Type: ListenerHTTP, Address: ":0", Target: "a:1"},
+		"unknown dialer": {Type: ListenerHTTP, Address: ":0", Dialer: "proxy"},
+		"metrics target": {Type: ListenerMetrics, Address: ":0", Target: "a:1"},
+		"metrics path":   {Type: ListenerMetrics, Address: ":0", Path: "metrics"},
+		"http path":      {Type: ListenerHTTP, Address: ":0", Path: "/metrics"},
+		"no unix path":   {Type: ListenerHTTP, Network: "unix"},
+		"unix udp":       {Type: ListenerForward, Address: ":0", Network: "unixgram", Target: "a:1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := &Config{Dialers: map[string]string{"direct": ""}, Default: "direct", Listeners: []ListenerConfig{listener}}
+			require.Error(t, New(nil, nil).Reload(context.Background(), config))
+		})
+	}
+}
+
+func TestService_HTTPProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer target.Close()
+
+	svc := New(nil, nil)
+	require.NoError(t, svc.Reload(context.Background(), &Config{
+		Dialers:   map[string]string{"direct": ""},
+		Default:   "direct",
+		Listeners: []ListenerConfig{{Type: ListenerHTTP, Address: "127.0.0.1:0"}},
+	}))
+	defer svc.Shutdown(context.Background())
+
+	proxyURL := &url.URL{Scheme: "http", Host: svc.Addrs()[0].String()}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get(target.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(body))
+}
+
+func TestService_UnixHTTPProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer target.Close()
+
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+	// A stale socket from a previous run is replaced.
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	svc := New(nil, nil)
+	require.NoError(t, svc.Reload(context.Background(), &Config{
+		Dialers:   map[string]string{"direct": ""},
+		Default:   "direct",
+		Listeners: []ListenerConfig{{Type: ListenerHTTP, Network: "unix", Address: path}},
+	}))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: "proxy.local"}),
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get(target.URL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(body))
+
+	// The socket is removed on shutdown.
+	require.NoError(t, svc.Shutdown(context.Background()))
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestService_UnixKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0600))
+	svc := New(nil, nil)
+	err := svc.Reload(context.Background(), &Config{
+		Dialers:   map[string]string{"direct": ""},
+		Default:   "direct",
+		Listeners: []ListenerConfig{{Type: ListenerHTTP, Network: "unix", Address: path}},
+	})
+	require.Error(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "data", string(data))
+}
+
+func TestService_ReloadSwapsDialers(t *testing.T) {
+	target1 := startTarget(t, "one")
+	target2 := startTarget(t, "two")
+	_, port2, err := net.SplitHostPort(target2)
+	require.NoError(t, err)
+
+	config := &Config{
+		Dialers: map[string]string{
+			"direct":   "",
+			"override": "override:port=" + port2,
+		},
+		Default:   "direct",
+		Listeners: []ListenerConfig{{Type: ListenerForward, Address: "127.0.0.1:0", Target: target1}},
+	}
+	svc := New(nil, nil)
+	require.NoError(t, svc.Reload(context.Background(), config))
+	defer svc.Shutdown(context.Background())
+	addr := svc.Addrs()[0].String()
+	require.Equal(t, "one", readGreeting(t, addr))
+
+	// The listener config is the same, so it keeps running with the new dialers.
+	config.Default = "override"
+	require.NoError(t, svc.Reload(context.Background(), config))
+	require.Equal(t, addr, svc.Addrs()[0].String())
+	require.Equal(t, "two", readGreeting(t, addr))
+
+	// An invalid config keeps the previous one.
+	config.Default = "missing"
+	require.Error(t, svc.Reload(context.Background(), config))
+	require.Equal(t, "two", readGreeting(t, addr))
+}
+
+func TestService_ReloadReplacesListeners(t *testing.T) {
+	target := startTarget(t, "hi")
+	svc := New(nil, nil)
+	config := &Config{
+		Dialers:   map[string]string{"direct": ""},
+		Default:   "direct",
+		Listeners: []ListenerConfig{{Type: ListenerForward, Address: "127.0.0.1:0", Target: target}},
+	}
+	require.NoError(t, svc.Reload(context.Background(), config))
+	oldAddr := svc.Addrs()[0].String()
+
+	config.Listeners = []ListenerConfig{{Type: ListenerHTTP, Address: "127.0.0.1:0"}}
+	require.NoError(t, svc.Reload(context.Background(), config))
+	require.Len(t, svc.Addrs(), 1)
+	_, err := net.Dial("tcp", oldAddr)
+	require.Error(t, err)
+
+	require.NoError(t, svc.Shutdown(context.Background()))
+	require.Empty(t, svc.Addrs())
+	require.ErrorIs(t, svc.Reload(context.Background(), config), ErrShutdown)
+}
+
+func TestService_UDPForward(t *testing.T) {
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 100)
+		for {
+			n, addr, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	svc := New(nil, nil)
+	require.NoError(t, svc.Reload(context.Background(), &Config{
+		Dialers:   map[string]string{"direct": ""},
+		Default:   "direct",
+		Listeners: []ListenerConfig{{Type: ListenerForward, Network: "udp", Address: "127.0.0.1:0", Target: echo.LocalAddr().String(), Dialer: "direct"}},
+	}))
+	defer svc.Shutdown(context.Background())
+
+	conn, err := net.Dial("udp", svc.Addrs()[0].String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 100)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf[:n]))
+}
+
+func TestService_Metrics(t *testing.T) {
+	target := startTarget(t, "hi")
+	svc := New(nil, nil)
+	require.NoError(t, svc.Reload(context.Background(), &Config{
+		Dialers: map[string]string{"direct": ""},
+		Default: "direct",
+		Listeners: []ListenerConfig{
+			{Type: ListenerForward, Address: "127.0.0.1:0", Target: target},
+			{Type: ListenerMetrics, Address: "127.0.0.1:0", Path: "/stats"},
+		},
+	}))
+	defer svc.Shutdown(context.Background())
+	require.Equal(t, "hi", readGreeting(t, svc.Addrs()[0].String()))
+
+	// The bytes are counted after the write returns, so the client may see them first.
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + svc.Addrs()[1].String() + "/stats")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return strings.Contains(string(body), `outline_server_connections_total{server="forward:127.0.0.1:0",country="ZZ"} 1`) &&
+			strings.Contains(string(body), `outline_server_bytes_total{server="forward:127.0.0.1:0",direction="sent"} 2`)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRunner_ReloadsOnChange(t *testing.T) {
+	target1 := startTarget(t, "one")
+	target2 := startTarget(t, "two")
+	// Reserve a port for the listener, since the Runner doesn't expose the service.
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := reserved.Addr().String()
+	reserved.Close()
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(target string) {
+		config := fmt.Sprintf("dialers:\n  direct: \"\"\ndefault: direct\nlisteners:\n  - type: forward\n    address: %v\n    target: %v\n", addr, target)
+		// Replace the file atomically, so the runner doesn't read a partial write.
+		tmpPath := configPath + ".tmp"
+		require.NoError(t, os.WriteFile(tmpPath, []byte(config), 0o600))
+		require.NoError(t, os.Rename(tmpPath, configPath))
+	}
+	writeConfig(target1)
+
+	reloaded := make(chan error, 1)
+	runner := &Runner{
+		ConfigPath:   configPath,
+		PollInterval: 10 * time.Millisecond,
+		OnReload:     func(err error) { reloaded <- err },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- runner.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "one", readGreeting(t, addr))
+
+	writeConfig(target2)
+	require.NoError(t, <-reloaded)
+	require.Equal(t, "two", readGreeting(t, addr))
+
+	cancel()
+	require.NoError(t, <-done)
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+}
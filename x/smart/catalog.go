@@ -0,0 +1,286 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+//go:embed catalog.yaml
+var defaultCatalogYAML []byte
+
+const (
+	// catalogCacheKey is the key for storing the latest verified catalog in the [StrategyResultCache].
+	catalogCacheKey = "strategy_catalog"
+	// catalogSignatureCacheKey is the key for storing the signature of the cached catalog.
+	catalogSignatureCacheKey = "strategy_catalog_signature"
+	// maxCatalogSize limits the size of downloaded catalogs.
+	maxCatalogSize = 1 << 20
+)
+
+// ErrInvalidSignature is returned by [CatalogUpdater.Update] when the catalog signature doesn't verify.
+var ErrInvalidSignature = errors.New("invalid catalog signature")
+
+type catalogPresetConfig struct {
+	// Countries are ISO 3166-1 alpha-2 country codes.
+	Countries []string `yaml:"countries,omitempty"`
+	// ASNs are autonomous system numbers.
+	ASNs   []uint         `yaml:"asns,omitempty"`
+	Config map[string]any `yaml:"config"`
+}
+
+type catalogConfig struct {
+	Version int                   `yaml:"version"`
+	Default map[string]any        `yaml:"default"`
+	Presets []catalogPresetConfig `yaml:"presets,omitempty"`
+}
+
+type catalogPreset struct {
+	countries map[string]struct{}
+	asns      map[uint]struct{}
+	config    []byte
+}
+
+// Catalog is a set of strategy configs for [StrategyFinder.NewDialer], keyed by country and autonomous system, so
+// that each network gets the strategies known to work there.
+//
+// Catalogs are YAML documents with a version, a default config and a list of presets:
+//
+//	version: 2
+//	default:
+//	  dns: [{system: {}}]
+//	  tls: ["", "split:1"]
+//	presets:
+//	  - countries: [IR]
+//	    asns: [12880]
+//	    config:
+//	      dns: [{https: {name: 9.9.9.9}}]
+//	      tls: ["tlsfrag:1"]
+type Catalog struct {
+	version       int
+	defaultConfig []byte
+	presets       []catalogPreset
+}
+
+// ParseCatalog parses a catalog in YAML. It returns an error if any of the configs is invalid.
+func ParseCatalog(catalogYAML []byte) (*Catalog, error) {
+	var parsed catalogConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(catalogYAML), yaml.DisallowUnknownField())
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog: %w", err)
+	}
+	if parsed.Default == nil {
+		return nil, errors.New("catalog must have a default config")
+	}
+	catalog := &Catalog{version: parsed.Version}
+	var err error
+	if catalog.defaultConfig, err = strategyConfigYAML(parsed.Default); err != nil {
+		return nil, fmt.Errorf("invalid default config: %w", err)
+	}
+	for i, presetConfig := range parsed.Presets {
+		if len(presetConfig.Countries) == 0 && len(presetConfig.ASNs) == 0 {
+			return nil, fmt.Errorf("preset %v must have countries or asns", i)
+		}
+		preset := catalogPreset{countries: make(map[string]struct{}), asns: make(map[uint]struct{})}
+		for _, country := range presetConfig.Countries {
+			preset.countries[strings.ToUpper(country)] = struct{}{}
+		}
+		for _, asn := range presetConfig.ASNs {
+			preset.asns[asn] = struct{}{}
+		}
+		if preset.config, err = strategyConfigYAML(presetConfig.Config); err != nil {
+			return nil, fmt.Errorf("invalid config in preset %v: %w", i, err)
+		}
+		catalog.presets = append(catalog.presets, preset)
+	}
+	return catalog, nil
+}
+
+// strategyConfigYAML validates a strategy config and returns it in YAML.
+func strategyConfigYAML(config map[string]any) ([]byte, error) {
+	if config == nil {
+		return nil, errors.New("config is missing")
+	}
+	configYAML, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := (&StrategyFinder{}).parseConfig(configYAML); err != nil {
+		return nil, err
+	}
+	return configYAML, nil
+}
+
+// DefaultCatalog returns the catalog embedded in the package.
+func DefaultCatalog() *Catalog {
+	catalog, err := ParseCatalog(defaultCatalogYAML)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded catalog: %v", err))
+	}
+	return catalog
+}
+
+// Version returns the version of the catalog. Updates only replace catalogs with lower versions.
+func (c *Catalog) Version() int {
+	return c.version
+}
+
+// Config returns the strategy config for a network in the given country and autonomous system, to pass to
+// [StrategyFinder.NewDialer]. The country is an ISO 3166-1 alpha-2 code, and may be empty if unknown. The asn is
+// zero if unknown. You can find them from the public IP with a [geoip.Reader].
+//
+// Presets that match the ASN take precedence over presets that match the country, and earlier presets take precedence
+// over later ones. If no preset matches, it returns the default config.
+//
+// [geoip.Reader]: https://pkg.go.dev/github.com/Jigsaw-Code/outline-sdk/x/geoip#Reader
+func (c *Catalog) Config(country string, asn uint) []byte {
+	if asn != 0 {
+		for _, preset := range c.presets {
+			if _, ok := preset.asns[asn]; ok {
+				return preset.config
+			}
+		}
+	}
+	if country != "" {
+		country = strings.ToUpper(country)
+		for _, preset := range c.presets {
+			if _, ok := preset.countries[country]; ok {
+				return preset.config
+			}
+		}
+	}
+	return c.defaultConfig
+}
+
+// CatalogUpdater keeps the strategy catalog up to date from a remote URL, so that new strategies can be pushed to
+// the apps without releasing new versions.
+//
+// The catalog at URL must be signed with Ed25519. The base64-encoded signature of the catalog bytes is downloaded
+// from the URL with ".sig" appended.
+type CatalogUpdater struct {
+	// URL is the location of the catalog.
+	URL string
+	// PublicKey verifies the catalog signature.
+	PublicKey ed25519.PublicKey
+	// HTTPClient downloads the catalog. If nil, [http.DefaultClient] is used.
+	HTTPClient *http.Client
+	// Cache persists the latest verified catalog, if not nil. It can be the same cache as [StrategyFinder.Cache].
+	Cache StrategyResultCache
+}
+
+// Catalog returns the latest catalog, which is the cached catalog if its signature verifies and it's newer than the
+// embedded one, or the embedded catalog otherwise.
+func (u *CatalogUpdater) Catalog() *Catalog {
+	catalog := DefaultCatalog()
+	if u.Cache == nil {
+		return catalog
+	}
+	catalogYAML, ok := u.Cache.Get(catalogCacheKey)
+	if !ok {
+		return catalog
+	}
+	signature, ok := u.Cache.Get(catalogSignatureCacheKey)
+	if !ok {
+		return catalog
+	}
+	cached, err := u.verify(catalogYAML, signature)
+	if err != nil || cached.Version() <= catalog.Version() {
+		return catalog
+	}
+	return cached
+}
+
+// Update downloads the catalog and returns it if it's newer than the current one from [CatalogUpdater.Catalog],
+// after storing it in the cache. Otherwise, it returns the current catalog, so old catalogs can't be replayed.
+// It returns [ErrInvalidSignature] if the signature doesn't verify.
+func (u *CatalogUpdater) Update(ctx context.Context) (*Catalog, error) {
+	if u.URL == "" {
+		return nil, errors.New("catalog URL is not set")
+	}
+	catalogYAML, err := u.fetch(ctx, u.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download catalog: %w", err)
+	}
+	signature, err := u.fetch(ctx, u.URL+".sig")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download catalog signature: %w", err)
+	}
+	catalog, err := u.verify(catalogYAML, signature)
+	if err != nil {
+		return nil, err
+	}
+	current := u.Catalog()
+	if catalog.Version() <= current.Version() {
+		return current, nil
+	}
+	if u.Cache != nil {
+		u.Cache.Put(catalogCacheKey, catalogYAML)
+		u.Cache.Put(catalogSignatureCacheKey, signature)
+	}
+	return catalog, nil
+}
+
+// verify checks the base64-encoded signature of the catalog and parses it.
+func (u *CatalogUpdater) verify(catalogYAML []byte, signature []byte) (*Catalog, error) {
+	if len(u.PublicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	if !ed25519.Verify(u.PublicKey, catalogYAML, decoded) {
+		return nil, ErrInvalidSignature
+	}
+	return ParseCatalog(catalogYAML)
+}
+
+func (u *CatalogUpdater) fetch(ctx context.Context, url string) ([]byte, error) {
+	client := u.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %v", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCatalogSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxCatalogSize {
+		return nil, fmt.Errorf("response is larger than %v bytes", maxCatalogSize)
+	}
+	return body, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testCatalogYAML = `
+version: 5
+default:
+  tls: [""]
+presets:
+  - countries: [ir]
+    config:
+      tls: ["tlsfrag:1"]
+  - asns: [12345]
+    config:
+      tls: ["split:1"]
+  - countries: [RU]
+    asns: [999]
+    config:
+      dns: [{https: {name: 9.9.9.9}}]
+`
+
+func TestParseCatalog(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(testCatalogYAML))
+	require.NoError(t, err)
+	require.Equal(t, 5, catalog.Version())
+
+	configOf := func(country string, asn uint) configConfig {
+		config, err := (&StrategyFinder{}).parseConfig(catalog.Config(country, asn))
+		require.NoError(t, err)
+		return config
+	}
+	require.Equal(t, []string{"tlsfrag:1"}, configOf("IR", 0).TLS)
+	// The ASN takes precedence over the country.
+	require.Equal(t, []string{"split:1"}, configOf("IR", 12345).TLS)
+	require.Len(t, configOf("", 999).DNS, 1)
+	require.Len(t, configOf("ru", 0).DNS, 1)
+	require.Equal(t, []string{""}, configOf("US", 1).TLS)
+	require.Equal(t, []string{""}, configOf("", 0).TLS)
+}
+
+func TestParseCatalog_Invalid(t *testing.T) {
+	for _, catalogYAML := range []string{
+		"version: 1",
+		"version: 1\ndefault: {tls: [\"\"]}\nunknown: 1",
+		"version: 1\ndefault: {foo: 1}",
+		"version: 1\ndefault: {tls: [\"\"]}\npresets: [{config: {tls: [\"\"]}}]",
+		"version: 1\ndefault: {tls: [\"\"]}\npresets: [{countries: [IR]}]",
+	} {
+		_, err := ParseCatalog([]byte(catalogYAML))
+		require.Error(t, err, catalogYAML)
+	}
+}
+
+func TestDefaultCatalog(t *testing.T) {
+	catalog := DefaultCatalog()
+	config, err := (&StrategyFinder{}).parseConfig(catalog.Config("", 0))
+	require.NoError(t, err)
+	require.NotEmpty(t, config.DNS)
+	require.NotEmpty(t, config.TLS)
+}
+
+// startCatalogServer serves the catalog signed with the key, and returns its URL.
+func startCatalogServer(t *testing.T, key ed25519.PrivateKey, catalogYAML string) string {
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(catalogYAML)))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/catalog.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(catalogYAML))
+	})
+	mux.HandleFunc("/catalog.yaml.sig", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(signature + "\n"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL + "/catalog.yaml"
+}
+
+func TestCatalogUpdater(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	cache := mapCache{}
+	updater := &CatalogUpdater{
+		URL:       startCatalogServer(t, privateKey, testCatalogYAML),
+		PublicKey: publicKey,
+		Cache:     cache,
+	}
+	require.Equal(t, DefaultCatalog().Version(), updater.Catalog().Version())
+
+	catalog, err := updater.Update(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5, catalog.Version())
+	require.Equal(t, 5, updater.Catalog().Version())
+
+	// An older catalog doesn't replace the newer one.
+	updater.URL = startCatalogServer(t, privateKey, "version: 3\ndefault: {tls: [\"\"]}")
+	catalog, err = updater.Update(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5, catalog.Version())
+
+	// A tampered cache is ignored.
+	cache[catalogCacheKey] = []byte("version: 6\ndefault: {tls: [\"\"]}")
+	require.Equal(t, DefaultCatalog().Version(), updater.Catalog().Version())
+}
+
+func TestCatalogUpdater_InvalidSignature(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	cache := mapCache{}
+	updater := &CatalogUpdater{
+		URL:       startCatalogServer(t, otherKey, testCatalogYAML),
+		PublicKey: publicKey,
+		Cache:     cache,
+	}
+	_, err = updater.Update(context.Background())
+	require.ErrorIs(t, err, ErrInvalidSignature)
+	require.Empty(t, cache)
+}
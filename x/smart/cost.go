@@ -0,0 +1,180 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// CostModel configures how [StrategyFinder] selects among the strategies that work. Without a cost model, the
+// first strategy to pass the tests is selected, which may be a working but slow one. With it, the finder keeps
+// testing the strategies for a window after the first success, and selects the one with the lowest cost, computed
+// as the weighted sum of:
+//
+//   - the average time to complete the TLS handshakes with the test domains, in seconds;
+//   - the failure rate over the test domains, between 0 and 1;
+//   - the time it would take to receive a megabyte at the rate measured during the handshakes, in seconds;
+//   - the overhead of the transport, as the number of parts of the config, like "split:2" or a proxy.
+//
+// It applies to the TLS strategies and to the fallbacks. Set a weight to a negative value to ignore its component.
+type CostModel struct {
+	// LatencyWeight is the weight of the handshake latency. If zero, 1 is used.
+	LatencyWeight float64
+	// FailureWeight is the weight of the failure rate. If zero, 10 is used.
+	FailureWeight float64
+	// ThroughputWeight is the weight of the time to receive a megabyte. If zero, 0.1 is used.
+	ThroughputWeight float64
+	// OverheadWeight is the weight of the number of config parts. If zero, 0.1 is used.
+	OverheadWeight float64
+	// MinSuccessRate is the fraction of test domains a strategy must reach to be selected. If zero, 1 is used, so
+	// all the test domains must work, as without a cost model.
+	MinSuccessRate float64
+	// Window is how long to keep testing other strategies after the first success. If zero, 1 second is used.
+	Window time.Duration
+}
+
+func weightOrDefault(weight float64, defaultWeight float64) float64 {
+	switch {
+	case weight < 0:
+		return 0
+	case weight == 0:
+		return defaultWeight
+	default:
+		return weight
+	}
+}
+
+func (m *CostModel) minSuccessRate() float64 {
+	if m.MinSuccessRate <= 0 {
+		return 1
+	}
+	return m.MinSuccessRate
+}
+
+func (m *CostModel) window() time.Duration {
+	if m.Window <= 0 {
+		return time.Second
+	}
+	return m.Window
+}
+
+// cost returns the cost of the measured strategy with the given number of config parts.
+func (m *CostModel) cost(measurement *strategyMeasurement, parts int) float64 {
+	cost := weightOrDefault(m.FailureWeight, 10) * (1 - measurement.successRate())
+	cost += weightOrDefault(m.LatencyWeight, 1) * measurement.averageLatency().Seconds()
+	cost += weightOrDefault(m.ThroughputWeight, 0.1) * measurement.secondsPerMegabyte()
+	cost += weightOrDefault(m.OverheadWeight, 0.1) * float64(parts)
+	return cost
+}
+
+// configParts returns the number of parts of a config, or 1 for configs that are not config URLs, like Psiphon's.
+func configParts(config fallbackEntryConfig) int {
+	text, ok := config.(string)
+	if entry, isStruct := config.(fallbackEntryStructConfig); isStruct && entry.ConfigURL != "" {
+		text, ok = entry.ConfigURL, true
+	}
+	if !ok {
+		return 1
+	}
+	if strings.TrimSpace(text) == "" {
+		return 0
+	}
+	return len(strings.Split(text, "|"))
+}
+
+// handshakeMeasurement is the measurement of a successful test of a domain.
+type handshakeMeasurement struct {
+	Duration  time.Duration
+	BytesRead int64
+}
+
+// strategyMeasurement aggregates the tests of a strategy over the test domains.
+type strategyMeasurement struct {
+	tests      int
+	handshakes []handshakeMeasurement
+}
+
+func (m *strategyMeasurement) successRate() float64 {
+	if m.tests == 0 {
+		return 0
+	}
+	return float64(len(m.handshakes)) / float64(m.tests)
+}
+
+func (m *strategyMeasurement) averageLatency() time.Duration {
+	if len(m.handshakes) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, h := range m.handshakes {
+		total += h.Duration
+	}
+	return total / time.Duration(len(m.handshakes))
+}
+
+func (m *strategyMeasurement) secondsPerMegabyte() float64 {
+	var duration time.Duration
+	var bytes int64
+	for _, h := range m.handshakes {
+		duration += h.Duration
+		bytes += h.BytesRead
+	}
+	if bytes == 0 {
+		return 0
+	}
+	return duration.Seconds() * 1e6 / float64(bytes)
+}
+
+// measureDialer tests the dialer with all the test domains, and returns the measurement. Unlike
+// [StrategyFinder.testDialer], it doesn't stop at the first failure. It returns an error if the success rate is
+// below the minimum of the cost model.
+func (f *StrategyFinder) measureDialer(ctx context.Context, dialer transport.StreamDialer, testDomains []string, strategyType string, transportCfg string) (*strategyMeasurement, error) {
+	measurement := &strategyMeasurement{}
+	var lastErr error
+	for _, testDomain := range testDomains {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		measurement.tests++
+		handshake, err := f.testDomain(ctx, dialer, testDomain, strategyType, transportCfg)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		measurement.handshakes = append(measurement.handshakes, handshake)
+	}
+	if rate := measurement.successRate(); len(measurement.handshakes) == 0 || rate < f.CostModel.minSuccessRate() {
+		return nil, fmt.Errorf("success rate %.2f is below the minimum: %w", rate, lastErr)
+	}
+	return measurement, nil
+}
+
+// readCountingConn counts the bytes read from the connection, to measure the throughput.
+type readCountingConn struct {
+	transport.StreamConn
+	bytesRead atomic.Int64
+}
+
+func (c *readCountingConn) Read(b []byte) (int, error) {
+	n, err := c.StreamConn.Read(b)
+	c.bytesRead.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,81 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCostModel_Cost(t *testing.T) {
+	measurement := &strategyMeasurement{
+		tests: 2,
+		handshakes: []handshakeMeasurement{
+			{Duration: 200 * time.Millisecond, BytesRead: 5000},
+		},
+	}
+	require.Equal(t, 0.5, measurement.successRate())
+	require.Equal(t, 200*time.Millisecond, measurement.averageLatency())
+	require.InDelta(t, 40, measurement.secondsPerMegabyte(), 1e-9)
+
+	// 10*0.5 + 1*0.2 + 0.1*40 + 0.1*2
+	require.InDelta(t, 9.4, (&CostModel{}).cost(measurement, 2), 1e-9)
+	// Negative weights ignore the component.
+	model := &CostModel{LatencyWeight: 2, FailureWeight: -1, ThroughputWeight: -1, OverheadWeight: 1}
+	require.InDelta(t, 2.4, model.cost(measurement, 2), 1e-9)
+}
+
+func TestConfigParts(t *testing.T) {
+	require.Equal(t, 0, configParts(""))
+	require.Equal(t, 1, configParts("split:2"))
+	require.Equal(t, 2, configParts("split:2|ss://user:pass@example.com:1"))
+	require.Equal(t, 1, configParts(fallbackEntryStructConfig{}))
+}
+
+func TestRaceScoredTests(t *testing.T) {
+	costs := map[string]float64{"slow": 5, "fast": 1, "broken": 0}
+	delays := map[string]time.Duration{"slow": 0, "fast": 50 * time.Millisecond, "broken": 0}
+	test := func(entry string) (string, error) {
+		time.Sleep(delays[entry])
+		if entry == "broken" {
+			return "", errors.New("broken")
+		}
+		return entry, nil
+	}
+	cost := func(entry string) float64 { return costs[entry] }
+
+	// The slow one succeeds first, but the fast one finishes within the window.
+	result, err := raceScoredTests(context.Background(), 10*time.Millisecond, time.Second, []string{"slow", "broken", "fast"}, test, cost)
+	require.NoError(t, err)
+	require.Equal(t, "fast", result)
+
+	// The fast one finishes after the window.
+	result, err = raceScoredTests(context.Background(), 10*time.Millisecond, 10*time.Millisecond, []string{"slow", "fast"}, test, cost)
+	require.NoError(t, err)
+	require.Equal(t, "slow", result)
+
+	// Ties go to the earliest entry.
+	costs["fast"] = 5
+	result, err = raceScoredTests(context.Background(), 10*time.Millisecond, time.Second, []string{"slow", "fast"}, test, cost)
+	require.NoError(t, err)
+	require.Equal(t, "slow", result)
+
+	_, err = raceScoredTests(context.Background(), 10*time.Millisecond, time.Second, []string{"broken"}, test, cost)
+	require.Error(t, err)
+}
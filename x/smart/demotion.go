@@ -0,0 +1,190 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// DemotionPolicy configures when the dialer returned by [StrategyFinder.NewDialer] demotes its winning strategy
+// and searches again. The search runs in the background with the demoted strategy moved to the back of the race,
+// and the current strategy is used until a new one is found. If no strategy works, the current one is kept.
+//
+// The searches use the values of the context passed to NewDialer, but not its cancelation, since the dialer outlives
+// the call. The returned dialer implements [io.Closer] instead: Close cancels the running search, and stops the
+// demotions.
+type DemotionPolicy struct {
+	// Window is the number of most recent dials over which the failure rate is computed. If zero, 20 is used.
+	Window int
+	// MinDials is the number of dials in the window needed to evaluate the failure rate. If zero, half the
+	// window is used.
+	MinDials int
+	// MaxFailureRate is the failure rate above which the strategy is demoted, between 0 and 1. If zero, 0.5 is used.
+	MaxFailureRate float64
+	// TTL, if not zero, is how long a strategy is used before it's demoted, so that it's periodically raced
+	// against the others.
+	TTL time.Duration
+}
+
+func (p *DemotionPolicy) window() int {
+	if p.Window <= 0 {
+		return 20
+	}
+	return p.Window
+}
+
+func (p *DemotionPolicy) minDials() int {
+	if p.MinDials <= 0 {
+		return (p.window() + 1) / 2
+	}
+	return min(p.MinDials, p.window())
+}
+
+func (p *DemotionPolicy) maxFailureRate() float64 {
+	if p.MaxFailureRate <= 0 {
+		return 0.5
+	}
+	return p.MaxFailureRate
+}
+
+// demotingDialer dials with the current winning strategy, and replaces it when the [DemotionPolicy] demotes it.
+type demotingDialer struct {
+	finder *StrategyFinder
+	policy DemotionPolicy
+	// ctx is the context of the searches, which is canceled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// search races the strategies with the demoted winner at the back.
+	search func(ctx context.Context, demoted *winningConfig) (transport.StreamDialer, *winningConfig, error)
+
+	mu     sync.Mutex
+	dialer transport.StreamDialer
+	winner *winningConfig
+	// generation counts the strategy replacements, to ignore the outcomes of replaced ones.
+	generation int
+	selectedAt time.Time
+	searching  bool
+	// outcomes is a ring buffer of the recent dials, true for failures.
+	outcomes []bool
+	next     int
+	count    int
+	failures int
+}
+
+var (
+	_ transport.StreamDialer = (*demotingDialer)(nil)
+	_ io.Closer              = (*demotingDialer)(nil)
+)
+
+func newDemotingDialer(ctx context.Context, f *StrategyFinder, testDomains []string, config configConfig, dialer transport.StreamDialer, winner *winningConfig) *demotingDialer {
+	d := &demotingDialer{
+		finder:     f,
+		policy:     *f.Demotion,
+		dialer:     dialer,
+		winner:     winner,
+		selectedAt: time.Now(),
+		outcomes:   make([]bool, f.Demotion.window()),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	d.search = func(ctx context.Context, demoted *winningConfig) (transport.StreamDialer, *winningConfig, error) {
+		scoped := config.clone()
+		if demoted != nil {
+			demoted.demoteToBack(&scoped)
+		}
+		return f.searchStrategy(ctx, testDomains, scoped)
+	}
+	return d
+}
+
+// DialStream implements [transport.StreamDialer].
+func (d *demotingDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	d.mu.Lock()
+	dialer, generation := d.dialer, d.generation
+	d.mu.Unlock()
+	conn, err := dialer.DialStream(ctx, addr)
+	// Dials canceled by the caller say nothing about the strategy.
+	if ctx.Err() == nil || err == nil {
+		d.record(generation, err != nil)
+	}
+	return conn, err
+}
+
+// Close cancels the running search, if any, and stops the demotions. The current strategy is still used.
+func (d *demotingDialer) Close() error {
+	d.cancel()
+	return nil
+}
+
+// record adds the outcome of a dial with the strategy of the given generation, and starts a search if the
+// current strategy must be demoted.
+func (d *demotingDialer) record(generation int, failed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if generation != d.generation || d.searching || d.ctx.Err() != nil {
+		// The outcome is from a replaced strategy, the current one is already demoted, or the dialer is closed.
+		return
+	}
+	if d.count == len(d.outcomes) {
+		if d.outcomes[d.next] {
+			d.failures--
+		}
+	} else {
+		d.count++
+	}
+	d.outcomes[d.next] = failed
+	if failed {
+		d.failures++
+	}
+	d.next = (d.next + 1) % len(d.outcomes)
+
+	expired := d.policy.TTL > 0 && time.Since(d.selectedAt) > d.policy.TTL
+	failing := d.count >= d.policy.minDials() && float64(d.failures)/float64(d.count) > d.policy.maxFailureRate()
+	if !expired && !failing {
+		return
+	}
+	if failing {
+		d.finder.log("⬇️ demoting strategy with %v failures in %v dials\n", d.failures, d.count)
+	} else {
+		d.finder.log("⬇️ demoting strategy after %v\n", d.policy.TTL)
+	}
+	d.searching = true
+	go d.research(d.winner)
+}
+
+// research searches for a new strategy, and switches to it if found.
+func (d *demotingDialer) research(demoted *winningConfig) {
+	dialer, winner, err := d.search(d.ctx, demoted)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.searching = false
+	if d.ctx.Err() != nil {
+		// The dialer was closed during the search.
+		return
+	}
+	// Start a new window in either case, so a failed search is not retried on every dial.
+	d.count, d.next, d.failures = 0, 0, 0
+	d.selectedAt = time.Now()
+	if err != nil {
+		d.finder.log("❌ could not replace demoted strategy, keeping it: %v\n", err)
+		return
+	}
+	d.dialer, d.winner = dialer, winner
+	d.generation++
+}
@@ -0,0 +1,176 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+var errDialFailed = errors.New("dial failed")
+
+// fakeStrategyDialer fails when fail is true, and returns a pipe otherwise.
+func fakeStrategyDialer(fail bool) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		if fail {
+			return nil, errDialFailed
+		}
+		a, b := net.Pipe()
+		b.Close()
+		return &pipeStreamConn{a}, nil
+	})
+}
+
+type pipeStreamConn struct {
+	net.Conn
+}
+
+func (c *pipeStreamConn) CloseRead() error  { return nil }
+func (c *pipeStreamConn) CloseWrite() error { return nil }
+
+type searchCall struct {
+	demoted *winningConfig
+}
+
+func newTestDemotingDialer(policy DemotionPolicy, dialer transport.StreamDialer, searchResult transport.StreamDialer, searchErr error) (*demotingDialer, chan searchCall) {
+	finder := &StrategyFinder{Demotion: &policy}
+	winner := newProxylessWinningConfig(nil, "split:1")
+	d := newDemotingDialer(context.Background(), finder, []string{"example.com."}, configConfig{TLS: []string{"split:1", "split:2"}}, dialer, &winner)
+	calls := make(chan searchCall, 10)
+	d.search = func(ctx context.Context, demoted *winningConfig) (transport.StreamDialer, *winningConfig, error) {
+		calls <- searchCall{demoted}
+		if searchErr != nil {
+			return nil, nil, searchErr
+		}
+		newWinner := newProxylessWinningConfig(nil, "split:2")
+		return searchResult, &newWinner, nil
+	}
+	return d, calls
+}
+
+func isSearching(d *demotingDialer) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.searching
+}
+
+func TestDemotingDialer_DemotesOnFailureRate(t *testing.T) {
+	d, calls := newTestDemotingDialer(DemotionPolicy{Window: 4, MaxFailureRate: 0.5}, fakeStrategyDialer(true), fakeStrategyDialer(false), nil)
+
+	_, err := d.DialStream(context.Background(), "example.com:443")
+	require.ErrorIs(t, err, errDialFailed)
+	require.Empty(t, calls)
+	_, err = d.DialStream(context.Background(), "example.com:443")
+	require.ErrorIs(t, err, errDialFailed)
+
+	call := <-calls
+	require.Equal(t, []string{"split:1"}, call.demoted.TLS)
+	require.Eventually(t, func() bool { return !isSearching(d) }, time.Second, time.Millisecond)
+	conn, err := d.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, []string{"split:2"}, d.winner.TLS)
+}
+
+func TestDemotingDialer_KeepsHealthyStrategy(t *testing.T) {
+	failNext := false
+	dialer := transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		failNext = !failNext
+		return fakeStrategyDialer(failNext).DialStream(ctx, addr)
+	})
+	d, calls := newTestDemotingDialer(DemotionPolicy{Window: 10, MaxFailureRate: 0.5}, dialer, fakeStrategyDialer(false), nil)
+	// Half of the dials fail, which is not above the rate.
+	for i := 0; i < 30; i++ {
+		d.DialStream(context.Background(), "example.com:443")
+	}
+	require.Empty(t, calls)
+}
+
+func TestDemotingDialer_IgnoresCanceledDials(t *testing.T) {
+	d, calls := newTestDemotingDialer(DemotionPolicy{Window: 2}, fakeStrategyDialer(true), fakeStrategyDialer(false), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 5; i++ {
+		d.DialStream(ctx, "example.com:443")
+	}
+	require.Empty(t, calls)
+}
+
+func TestDemotingDialer_TTL(t *testing.T) {
+	d, calls := newTestDemotingDialer(DemotionPolicy{TTL: time.Millisecond}, fakeStrategyDialer(false), fakeStrategyDialer(false), nil)
+	time.Sleep(2 * time.Millisecond)
+	conn, err := d.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	conn.Close()
+	call := <-calls
+	require.Equal(t, []string{"split:1"}, call.demoted.TLS)
+}
+
+func TestDemotingDialer_FailedSearchKeepsStrategy(t *testing.T) {
+	d, calls := newTestDemotingDialer(DemotionPolicy{Window: 2}, fakeStrategyDialer(true), nil, errors.New("nothing works"))
+	d.DialStream(context.Background(), "example.com:443")
+	<-calls
+	require.Eventually(t, func() bool { return !isSearching(d) }, time.Second, time.Millisecond)
+	require.Equal(t, []string{"split:1"}, d.winner.TLS)
+	// The window restarts, so the next dial doesn't search again.
+	d.DialStream(context.Background(), "example.com:443")
+	require.Empty(t, calls)
+}
+
+func TestDemotingDialer_Close(t *testing.T) {
+	type ctxKey struct{}
+	finder := &StrategyFinder{Demotion: &DemotionPolicy{Window: 2}}
+	winner := newProxylessWinningConfig(nil, "split:1")
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+	d := newDemotingDialer(ctx, finder, []string{"example.com."}, configConfig{TLS: []string{"split:1", "split:2"}}, fakeStrategyDialer(true), &winner)
+	// The search outlives the context of NewDialer, but keeps its values.
+	cancel()
+	searchCtxs := make(chan context.Context, 10)
+	d.search = func(ctx context.Context, demoted *winningConfig) (transport.StreamDialer, *winningConfig, error) {
+		searchCtxs <- ctx
+		<-ctx.Done()
+		return nil, nil, ctx.Err()
+	}
+
+	d.DialStream(context.Background(), "example.com:443")
+	searchCtx := <-searchCtxs
+	require.NoError(t, searchCtx.Err())
+	require.Equal(t, "value", searchCtx.Value(ctxKey{}))
+
+	// Close cancels the search, and no other search starts.
+	require.NoError(t, d.Close())
+	require.Eventually(t, func() bool { return !isSearching(d) }, time.Second, time.Millisecond)
+	require.ErrorIs(t, searchCtx.Err(), context.Canceled)
+	for i := 0; i < 5; i++ {
+		d.DialStream(context.Background(), "example.com:443")
+	}
+	require.Empty(t, searchCtxs)
+	require.Equal(t, []string{"split:1"}, d.winner.TLS)
+}
+
+func TestDemotionPolicy_Defaults(t *testing.T) {
+	var p DemotionPolicy
+	require.Equal(t, 20, p.window())
+	require.Equal(t, 10, p.minDials())
+	require.Equal(t, 0.5, p.maxFailureRate())
+	p = DemotionPolicy{Window: 5, MinDials: 8}
+	require.Equal(t, 5, p.minDials())
+}
@@ -0,0 +1,70 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// fallbackConditionsConfig lists the conditions for a fallback to be enabled. All the conditions that have values
+// must match.
+type fallbackConditionsConfig struct {
+	// OS are values of runtime.GOOS, like "android" or "ios".
+	OS []string `yaml:"os,omitempty"`
+	// Countries are ISO 3166-1 alpha-2 country codes, matched against [StrategyFinder].Country.
+	Countries []string `yaml:"countries,omitempty"`
+	// ASNs are autonomous system numbers, matched against [StrategyFinder].ASN.
+	ASNs []uint `yaml:"asns,omitempty"`
+}
+
+// matches returns whether the conditions match the given environment.
+func (c *fallbackConditionsConfig) matches(goos string, country string, asn uint) bool {
+	if len(c.OS) > 0 && !slices.Contains(c.OS, goos) {
+		return false
+	}
+	if len(c.Countries) > 0 && !slices.ContainsFunc(c.Countries, func(entry string) bool {
+		return country != "" && strings.EqualFold(entry, country)
+	}) {
+		return false
+	}
+	if len(c.ASNs) > 0 && (asn == 0 || !slices.Contains(c.ASNs, asn)) {
+		return false
+	}
+	return true
+}
+
+// enabledFallbacks returns the fallbacks whose conditions match the environment of the finder, or nil if none do.
+func (f *StrategyFinder) enabledFallbacks(fallbacks []fallbackEntryConfig) []fallbackEntryConfig {
+	var enabled []fallbackEntryConfig
+	for _, fallback := range fallbacks {
+		entry, ok := fallback.(fallbackEntryStructConfig)
+		if ok && entry.EnabledIf != nil && !entry.EnabledIf.matches(runtime.GOOS, f.Country, f.ASN) {
+			f.log("⏭️ skipping fallback '%v': conditions don't match\n", fallbackName(entry))
+			continue
+		}
+		enabled = append(enabled, fallback)
+	}
+	return enabled
+}
+
+// fallbackName returns a name of the fallback for logs, without the secrets of Psiphon configs.
+func fallbackName(entry fallbackEntryStructConfig) string {
+	if entry.ConfigURL != "" {
+		return entry.ConfigURL
+	}
+	return "psiphon"
+}
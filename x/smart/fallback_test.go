@@ -0,0 +1,129 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig_FallbackConditions(t *testing.T) {
+	config := `
+fallback:
+  - ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTprSzdEdHQ0MkJLOE9hRjBKYjdpWGFK@1.2.3.4:9999/?outline=1
+  - configurl: override:host=cdn.example.com|tls:sni=front.example.com|ws:tcp_path=/tcp|ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTprSzdEdHQ0MkJLOE9hRjBKYjdpWGFK@server.example.com:443
+    enabled_if:
+      os: [android, ios]
+      countries: [IR]
+      asns: [12880, 58224]
+`
+	parsedConfig, err := (&StrategyFinder{}).parseConfig([]byte(config))
+	require.NoError(t, err)
+	require.Equal(t, configConfig{
+		Fallback: []fallbackEntryConfig{
+			"ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTprSzdEdHQ0MkJLOE9hRjBKYjdpWGFK@1.2.3.4:9999/?outline=1",
+			fallbackEntryStructConfig{
+				ConfigURL: "override:host=cdn.example.com|tls:sni=front.example.com|ws:tcp_path=/tcp|ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTprSzdEdHQ0MkJLOE9hRjBKYjdpWGFK@server.example.com:443",
+				EnabledIf: &fallbackConditionsConfig{
+					OS:        []string{"android", "ios"},
+					Countries: []string{"IR"},
+					ASNs:      []uint{12880, 58224},
+				},
+			},
+		},
+	}, parsedConfig)
+	require.Equal(t, 4, configParts(parsedConfig.Fallback[1]))
+
+	// The winner keeps its conditions through the cache.
+	data, err := newFallbackWinningConfig(parsedConfig.Fallback[1]).toYAML()
+	require.NoError(t, err)
+	cachedConfig, err := (&StrategyFinder{}).parseConfig(data)
+	require.NoError(t, err)
+	fallback, ok := winningConfig(cachedConfig).getFallbackIfExclusive(&parsedConfig)
+	require.True(t, ok)
+	require.Equal(t, parsedConfig.Fallback[1], fallback)
+}
+
+func TestParseConfig_InvalidFallback(t *testing.T) {
+	for _, config := range []string{
+		"fallback: [{enabled_if: {os: [android]}}]",
+		"fallback: [{configurl: 'split:1', psiphon: {SponsorId: FFFF}}]",
+		"fallback: [{configurl: 'split:1', enabled_if: {unknown: 1}}]",
+	} {
+		_, err := (&StrategyFinder{}).parseConfig([]byte(config))
+		require.Error(t, err, config)
+	}
+}
+
+func TestFallbackConditions_Matches(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		conditions fallbackConditionsConfig
+		goos       string
+		country    string
+		asn        uint
+		matches    bool
+	}{
+		{"no conditions", fallbackConditionsConfig{}, "linux", "", 0, true},
+		{"os", fallbackConditionsConfig{OS: []string{"android", "ios"}}, "android", "", 0, true},
+		{"other os", fallbackConditionsConfig{OS: []string{"android", "ios"}}, "linux", "", 0, false},
+		{"country", fallbackConditionsConfig{Countries: []string{"IR", "RU"}}, "linux", "ru", 0, true},
+		{"other country", fallbackConditionsConfig{Countries: []string{"IR"}}, "linux", "RU", 0, false},
+		{"unknown country", fallbackConditionsConfig{Countries: []string{"IR"}}, "linux", "", 0, false},
+		{"asn", fallbackConditionsConfig{ASNs: []uint{12880}}, "linux", "", 12880, true},
+		{"unknown asn", fallbackConditionsConfig{ASNs: []uint{12880}}, "linux", "", 0, false},
+		{"all", fallbackConditionsConfig{OS: []string{"ios"}, Countries: []string{"IR"}, ASNs: []uint{12880}}, "ios", "IR", 12880, true},
+		{"all but one", fallbackConditionsConfig{OS: []string{"ios"}, Countries: []string{"IR"}, ASNs: []uint{12880}}, "ios", "IR", 58224, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.matches, tc.conditions.matches(tc.goos, tc.country, tc.asn))
+		})
+	}
+}
+
+func TestStrategyFinder_EnabledFallbacks(t *testing.T) {
+	serverA := "ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTprSzdEdHQ0MkJLOE9hRjBKYjdpWGFK@1.2.3.4:9999"
+	serverB := fallbackEntryStructConfig{
+		ConfigURL: "ws:tcp_path=/tcp|ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTprSzdEdHQ0MkJLOE9hRjBKYjdpWGFK@5.6.7.8:443",
+		EnabledIf: &fallbackConditionsConfig{Countries: []string{"IR"}},
+	}
+	otherOS := fallbackEntryStructConfig{
+		ConfigURL: "socks5://192.168.1.10:1080",
+		EnabledIf: &fallbackConditionsConfig{OS: []string{runtime.GOOS + "-other"}},
+	}
+	fallbacks := []fallbackEntryConfig{serverA, serverB, otherOS}
+
+	finder := &StrategyFinder{Country: "IR"}
+	require.Equal(t, []fallbackEntryConfig{serverA, serverB}, finder.enabledFallbacks(fallbacks))
+	finder = &StrategyFinder{Country: "RU"}
+	require.Equal(t, []fallbackEntryConfig{serverA}, finder.enabledFallbacks(fallbacks))
+	require.Nil(t, finder.enabledFallbacks([]fallbackEntryConfig{serverB, otherOS}))
+}
+
+func TestMakeDialerFromConfig_RequiresProxy(t *testing.T) {
+	finder := &StrategyFinder{}
+	configModule := configurl.NewDefaultProviders()
+	_, _, err := finder.makeDialerFromConfig(context.Background(), configModule, "split:1")
+	require.ErrorIs(t, err, transport.ErrMissingCapability)
+
+	dialer, _, err := finder.makeDialerFromConfig(context.Background(), configModule, "tls:sni=front.example.com|ws:tcp_path=/tcp|socks5://proxy.example.com:1080")
+	require.NoError(t, err)
+	require.NotNil(t, dialer)
+}
@@ -79,3 +79,74 @@ func raceTests[E any, R any](ctx context.Context, maxWait time.Duration, entries
 	var empty R
 	return empty, errors.New("all tests failed")
 }
+
+// raceScoredTests is like [raceTests], but after the first success it keeps starting and collecting the tests for the
+// window, and returns the successful result with the lowest cost. Ties go to the earliest entry.
+func raceScoredTests[E any, R any](ctx context.Context, maxWait time.Duration, window time.Duration, entries []E, test func(entry E) (R, error), cost func(R) float64) (R, error) {
+	type testResult struct {
+		Index  int
+		Result R
+		Err    error
+	}
+	// Communicates the result of each test.
+	resultChan := make(chan testResult, len(entries))
+	waitCh := newClosedChanel()
+	// Closed at the end of the window after the first success.
+	var windowCh <-chan time.Time
+
+	var best *testResult
+	bestCost := 0.0
+	next := 0
+	for toTest := len(entries); toTest > 0; {
+		select {
+		// Search cancelled, quit.
+		case <-ctx.Done():
+			var empty R
+			return empty, ctx.Err()
+
+		case <-windowCh:
+			return best.Result, nil
+
+		// Ready to start testing another entry.
+		case <-waitCh:
+			index := next
+			next++
+
+			waitCtx, waitDone := context.WithTimeout(ctx, maxWait)
+			if next == len(entries) {
+				// Done with entries. No longer trigger on waitCh.
+				waitCh = nil
+			} else {
+				waitCh = waitCtx.Done()
+			}
+
+			go func(index int, testDone context.CancelFunc) {
+				defer testDone()
+				result, err := test(entries[index])
+				resultChan <- testResult{Index: index, Result: result, Err: err}
+			}(index, waitDone)
+
+		// Got a test result.
+		case result := <-resultChan:
+			toTest--
+			if result.Err != nil {
+				continue
+			}
+			resultCost := cost(result.Result)
+			if best == nil {
+				timer := time.NewTimer(window)
+				defer timer.Stop()
+				windowCh = timer.C
+			}
+			if best == nil || resultCost < bestCost || (resultCost == bestCost && result.Index < best.Index) {
+				best = &result
+				bestCost = resultCost
+			}
+		}
+	}
+	if best != nil {
+		return best.Result, nil
+	}
+	var empty R
+	return empty, errors.New("all tests failed")
+}
@@ -0,0 +1,166 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/dns"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/report"
+	"github.com/goccy/go-yaml"
+)
+
+// Strategy types in a [StrategyAttempt].
+const (
+	StrategyTypeDNS      = "dns"
+	StrategyTypeTLS      = "tls"
+	StrategyTypeFallback = "fallback"
+)
+
+// StrategyReport is a machine-readable record of a strategy search by [StrategyFinder.NewDialer].
+// It can be aggregated across many clients to learn which strategies work on each network.
+type StrategyReport struct {
+	StartTime   time.Time `json:"start_time"`
+	DurationMs  int64     `json:"duration_ms"`
+	TestDomains []string  `json:"test_domains"`
+	// Attempts lists every strategy test, in the order they finished.
+	Attempts []StrategyAttempt `json:"attempts"`
+	// Winner is the selected strategy, in the same YAML format as the config, or empty if none was found.
+	Winner string `json:"winner,omitempty"`
+	// FromCache is true if the winner was resumed from the [StrategyFinder.Cache].
+	FromCache bool   `json:"from_cache"`
+	Error     string `json:"error,omitempty"`
+}
+
+var _ report.HasSuccess = (*StrategyReport)(nil)
+
+// IsSuccess implements [report.HasSuccess].
+func (r *StrategyReport) IsSuccess() bool {
+	return r.Error == ""
+}
+
+// StrategyAttempt is the result of testing one strategy against one test domain.
+type StrategyAttempt struct {
+	// Type is one of [StrategyTypeDNS], [StrategyTypeTLS] or [StrategyTypeFallback].
+	Type string `json:"type"`
+	// Config is the strategy config, or its signature for Psiphon configs.
+	Config     string    `json:"config"`
+	Domain     string    `json:"domain,omitempty"`
+	StartTime  time.Time `json:"start_time"`
+	DurationMs int64     `json:"duration_ms"`
+	// ErrorClass is a coarse classification of Error, such as "timeout" or "blocked_suspected", that is stable
+	// across platforms and versions. It's empty on success.
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// strategyRecorder collects the attempts of one strategy search. It's passed down in the context.
+type strategyRecorder struct {
+	mu     sync.Mutex
+	report StrategyReport
+}
+
+type strategyRecorderKey struct{}
+
+func withStrategyRecorder(ctx context.Context, rec *strategyRecorder) context.Context {
+	return context.WithValue(ctx, strategyRecorderKey{}, rec)
+}
+
+// recordAttempt adds an attempt to the recorder in ctx, if any.
+func recordAttempt(ctx context.Context, strategyType string, config string, domain string, startTime time.Time, err error) {
+	rec, ok := ctx.Value(strategyRecorderKey{}).(*strategyRecorder)
+	if !ok {
+		return
+	}
+	attempt := StrategyAttempt{
+		Type:       strategyType,
+		Config:     config,
+		Domain:     domain,
+		StartTime:  startTime,
+		DurationMs: time.Since(startTime).Milliseconds(),
+	}
+	if err != nil {
+		attempt.ErrorClass = errorClass(err)
+		attempt.Error = err.Error()
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.report.Attempts = append(rec.report.Attempts, attempt)
+}
+
+// finish completes and returns the report.
+func (rec *strategyRecorder) finish(winner *winningConfig, fromCache bool, err error) *StrategyReport {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	r := rec.report
+	r.Attempts = append([]StrategyAttempt(nil), r.Attempts...)
+	r.DurationMs = time.Since(r.StartTime).Milliseconds()
+	if err != nil {
+		r.Error = err.Error()
+	} else if winner != nil {
+		if data, err := winner.toYAML(); err == nil {
+			r.Winner = strings.TrimSpace(string(data))
+		}
+		r.FromCache = fromCache
+	}
+	return &r
+}
+
+// dnsEntryID returns a one-line representation of the DNS entry for reports.
+func dnsEntryID(entry dnsEntryConfig) string {
+	data, err := yaml.MarshalWithOptions(entry, yaml.Flow(true))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// errorClass classifies err into a short, platform-independent category. Errors that are not specific to the
+// strategy tests use the class from [transport.ErrorClass].
+func errorClass(err error) string {
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var dnsErr *net.DNSError
+	var timeoutErr interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &timeoutErr) && timeoutErr.Timeout():
+		return "timeout"
+	case errors.As(err, &certErr):
+		return "tls_certificate"
+	case errors.As(err, &recordErr):
+		return "tls_bad_record"
+	case errors.As(err, &dnsErr), errors.Is(err, dns.ErrBadResponse):
+		return "dns_bad_response"
+	}
+	switch transport.ErrorClass(err) {
+	case transport.ErrBlockedSuspected:
+		return "blocked_suspected"
+	case transport.ErrUpstreamUnreachable:
+		return "upstream_unreachable"
+	case transport.ErrProxyHandshake:
+		return "proxy_handshake"
+	default:
+		return "other"
+	}
+}
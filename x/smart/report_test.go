@@ -0,0 +1,104 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smart
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/report"
+	"github.com/stretchr/testify/require"
+)
+
+type collectorFunc func(context.Context, report.Report) error
+
+func (f collectorFunc) Collect(ctx context.Context, r report.Report) error {
+	return f(ctx, r)
+}
+
+func TestNewDialer_ReportsFailedSearch(t *testing.T) {
+	var reports []*StrategyReport
+	finder := &StrategyFinder{
+		TestTimeout: 1 * time.Second,
+		StreamDialer: transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		}),
+		Reporter: collectorFunc(func(ctx context.Context, r report.Report) error {
+			reports = append(reports, r.(*StrategyReport))
+			return nil
+		}),
+	}
+	_, err := finder.NewDialer(context.Background(), []string{"example.com"}, []byte("dns: [{tcp: {address: 192.0.2.1}}]"))
+	require.Error(t, err)
+
+	require.Len(t, reports, 1)
+	r := reports[0]
+	require.False(t, r.IsSuccess())
+	require.Equal(t, err.Error(), r.Error)
+	require.Equal(t, []string{"example.com."}, r.TestDomains)
+	require.Empty(t, r.Winner)
+	require.Len(t, r.Attempts, 1)
+	require.Equal(t, StrategyTypeDNS, r.Attempts[0].Type)
+	require.Equal(t, "{tcp: {address: 192.0.2.1}}", r.Attempts[0].Config)
+	require.Equal(t, "example.com.", r.Attempts[0].Domain)
+	require.Equal(t, "upstream_unreachable", r.Attempts[0].ErrorClass)
+}
+
+func TestStrategyRecorder_Finish(t *testing.T) {
+	rec := &strategyRecorder{report: StrategyReport{StartTime: time.Now(), TestDomains: []string{"example.com."}}}
+	ctx := withStrategyRecorder(context.Background(), rec)
+	recordAttempt(ctx, StrategyTypeTLS, "split:1", "example.com.", time.Now(), transport.NewHandshakeError(io.EOF, transport.ErrProxyHandshake))
+	recordAttempt(ctx, StrategyTypeTLS, "split:2", "example.com.", time.Now(), nil)
+
+	winner := newProxylessWinningConfig(nil, "split:2")
+	r := rec.finish(&winner, false, nil)
+	require.True(t, r.IsSuccess())
+	require.Equal(t, `{tls: ["split:2"]}`, r.Winner)
+	require.Equal(t, []StrategyAttempt{
+		{Type: StrategyTypeTLS, Config: "split:1", Domain: "example.com.", StartTime: r.Attempts[0].StartTime, ErrorClass: "blocked_suspected", Error: "EOF"},
+		{Type: StrategyTypeTLS, Config: "split:2", Domain: "example.com.", StartTime: r.Attempts[1].StartTime},
+	}, r.Attempts)
+
+	// No recorder in the context is a no-op.
+	recordAttempt(context.Background(), StrategyTypeTLS, "", "", time.Now(), nil)
+}
+
+func TestErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected string
+	}{
+		{context.Canceled, "canceled"},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), "timeout"},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, "blocked_suspected"},
+		{&net.OpError{Op: "dial", Err: syscall.ENETUNREACH}, "upstream_unreachable"},
+		{transport.NewHandshakeError(io.ErrUnexpectedEOF, transport.ErrProxyHandshake), "blocked_suspected"},
+		{transport.WithErrorClass(errors.New("reply 5"), transport.ErrProxyHandshake), "proxy_handshake"},
+		{&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, "tls_certificate"},
+		{&net.DNSError{Err: "no such host"}, "dns_bad_response"},
+		{errors.New("something else"), "other"},
+	} {
+		require.Equal(t, tc.expected, errorClass(tc.err), tc.err.Error())
+	}
+}
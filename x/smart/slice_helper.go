@@ -21,3 +21,11 @@ func moveToFront[S ~[]E, E any](s S, idx int) {
 		s[0] = entry
 	}
 }
+
+func moveToBack[S ~[]E, E any](s S, idx int) {
+	if idx >= 0 && idx < len(s)-1 {
+		entry := s[idx]
+		copy(s[idx:], s[idx+1:])
+		s[len(s)-1] = entry
+	}
+}
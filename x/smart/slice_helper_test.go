@@ -93,3 +93,23 @@ func TestMoveToFront(t *testing.T) {
 		})
 	}
 }
+
+func TestMoveToBack(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		idx      int
+		expected []int
+	}{
+		{"negative", -1, []int{1, 2, 3, 4}},
+		{"first element", 0, []int{2, 3, 4, 1}},
+		{"middle element", 1, []int{1, 3, 4, 2}},
+		{"last element", 3, []int{1, 2, 3, 4}},
+		{"overflow", 4, []int{1, 2, 3, 4}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := []int{1, 2, 3, 4}
+			moveToBack(s, tc.idx)
+			require.Equal(t, tc.expected, s)
+		})
+	}
+}
@@ -91,6 +91,24 @@ func (w winningConfig) promoteProxylessToFront(cfg *configConfig) {
 	}
 }
 
+// demoteToBack reorders the DNS, TLS and fallback configs within the provided configConfig
+// to move the entries matching the winning strategy to the back, so the other strategies get a head start.
+func (w winningConfig) demoteToBack(cfg *configConfig) {
+	if len(w.DNS) == 1 {
+		moveToBack(cfg.DNS, slices.IndexFunc(cfg.DNS, func(e dnsEntryConfig) bool {
+			return reflect.DeepEqual(e, w.DNS[0])
+		}))
+	}
+	if len(w.TLS) == 1 {
+		moveToBack(cfg.TLS, slices.Index(cfg.TLS, w.TLS[0]))
+	}
+	if len(w.Fallback) == 1 {
+		moveToBack(cfg.Fallback, slices.IndexFunc(cfg.Fallback, func(e fallbackEntryConfig) bool {
+			return reflect.DeepEqual(e, w.Fallback[0])
+		}))
+	}
+}
+
 func (w winningConfig) toYAML() ([]byte, error) {
 	return yaml.MarshalWithOptions(w, yaml.Flow(true))
 }
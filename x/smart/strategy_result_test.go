@@ -267,3 +267,44 @@ func TestWinningStrategy_GetFallbackIfExclusive(t *testing.T) {
 		})
 	}
 }
+
+func TestWinningStrategy_DemoteToBack(t *testing.T) {
+	var (
+		httpsDNS = dnsEntryConfig{HTTPS: &httpsEntryConfig{Name: "h1.example.com", Address: "h1.example.com:443"}}
+		tcpDNS   = dnsEntryConfig{TCP: &tcpEntryConfig{Address: "12.34.43.21:53"}}
+		tcpSplit = "split:888"
+		tlsFrag  = "tlsfrag:-314"
+		ssURL    = "ss://Y2hhY2hhMjAtaWV0Zi1wb2x5MTMwNTprSzdEdHQ0MkJLOE9hRjBKYjdpWGFK@1.2.3.4:9999"
+		socksURL = "socks5://192.168.1.10:1080"
+	)
+	cases := []struct {
+		name     string
+		winner   string
+		input    configConfig
+		expected configConfig
+	}{{
+		name:     "Proxyless Winner",
+		winner:   `{dns: [{https: {name: "h1.example.com", address: "h1.example.com:443"}}], tls: ["tlsfrag:-314"]}`,
+		input:    configConfig{DNS: []dnsEntryConfig{httpsDNS, tcpDNS}, TLS: []string{tlsFrag, tcpSplit}},
+		expected: configConfig{DNS: []dnsEntryConfig{tcpDNS, httpsDNS}, TLS: []string{tcpSplit, tlsFrag}},
+	}, {
+		name:     "Fallback Winner",
+		winner:   `{fallback: ["` + ssURL + `"]}`,
+		input:    configConfig{Fallback: []fallbackEntryConfig{ssURL, socksURL}},
+		expected: configConfig{Fallback: []fallbackEntryConfig{socksURL, ssURL}},
+	}, {
+		name:     "Entries not Found",
+		winner:   `{tls: ["split:1"]}`,
+		input:    configConfig{TLS: []string{tlsFrag, tcpSplit}},
+		expected: configConfig{TLS: []string{tlsFrag, tcpSplit}},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			winner, err := (&StrategyFinder{}).parseConfig([]byte(tc.winner))
+			require.NoError(t, err)
+			winningConfig(winner).demoteToBack(&tc.input)
+			require.Equal(t, tc.expected, tc.input)
+		})
+	}
+}
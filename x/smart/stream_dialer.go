@@ -24,12 +24,14 @@ import (
 	"io"
 	"net"
 	"net/url"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/Jigsaw-Code/outline-sdk/dns"
 	"github.com/Jigsaw-Code/outline-sdk/transport"
 	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+	"github.com/Jigsaw-Code/outline-sdk/x/report"
 	"github.com/goccy/go-yaml"
 )
 
@@ -42,7 +44,23 @@ type StrategyFinder struct {
 	StreamDialer transport.StreamDialer
 	PacketDialer transport.PacketDialer
 	Cache        StrategyResultCache
-	logMu        sync.Mutex
+	// Reporter, if set, receives a [*StrategyReport] at the end of each [StrategyFinder.NewDialer] call.
+	// It's called before NewDialer returns, so it should not block for long.
+	Reporter report.Collector
+	// Demotion, if set, makes the dialers returned by [StrategyFinder.NewDialer] track the failures of their
+	// strategy, and replace it when the policy demotes it. The dialers then implement [io.Closer], to stop
+	// the background searches.
+	Demotion *DemotionPolicy
+	// CostModel, if set, makes the finder select the TLS strategy and fallback with the lowest cost among the ones
+	// that work, instead of the first one to pass the tests.
+	CostModel *CostModel
+	// Country is the ISO 3166-1 alpha-2 code of the country of the network, and ASN its autonomous system number,
+	// for instance from [geoip]. Fallbacks with country or ASN conditions are disabled if they are not set.
+	//
+	// [geoip]: https://pkg.go.dev/github.com/Jigsaw-Code/outline-sdk/x/geoip
+	Country string
+	ASN     uint
+	logMu   sync.Mutex
 }
 
 func (f *StrategyFinder) log(format string, a ...any) {
@@ -99,6 +117,10 @@ type dnsEntryConfig struct {
 
 type fallbackEntryStructConfig struct {
 	Psiphon any `yaml:"psiphon,omitempty"`
+	// ConfigURL is a config in the configurl format, like the string entries, but allows for EnabledIf.
+	ConfigURL string `yaml:"configurl,omitempty"`
+	// EnabledIf, if set, restricts the fallback to the environments that match it.
+	EnabledIf *fallbackConditionsConfig `yaml:"enabled_if,omitempty"`
 	// As we allow more fallback types beyond psiphon they will be added here
 }
 
@@ -112,6 +134,15 @@ type configConfig struct {
 	Fallback []fallbackEntryConfig `yaml:"fallback,omitempty"`
 }
 
+// clone returns a copy of the config that can be reordered without changing the original.
+func (c configConfig) clone() configConfig {
+	return configConfig{
+		DNS:      slices.Clone(c.DNS),
+		TLS:      slices.Clone(c.TLS),
+		Fallback: slices.Clone(c.Fallback),
+	}
+}
+
 // mapToAny marshalls a map into a struct. It's a helper for parsers that want to
 // map config maps into their config structures.
 func mapToAny(in map[string]any, out any) error {
@@ -243,32 +274,44 @@ func (f *StrategyFinder) dnsConfigToResolver(dnsConfig []dnsEntryConfig) ([]*sma
 }
 
 // Test that a dialer is able to access all the given test domains. Returns nil if all tests succeed
-func (f *StrategyFinder) testDialer(ctx context.Context, dialer transport.StreamDialer, testDomains []string, transportCfg string) error {
+func (f *StrategyFinder) testDialer(ctx context.Context, dialer transport.StreamDialer, testDomains []string, strategyType string, transportCfg string) error {
 	for _, testDomain := range testDomains {
-		startTime := time.Now()
-
-		testAddr := net.JoinHostPort(testDomain, "443")
-		f.logCtx(ctx, "🏃 running test: '%v' (domain: %v)\n", transportCfg, testDomain)
-
-		ctx, cancel := context.WithTimeout(ctx, f.TestTimeout)
-		defer cancel()
-		testConn, err := dialer.DialStream(ctx, testAddr)
-		if err != nil {
-			f.logCtx(ctx, "🏁 failed to dial: '%v' (domain: %v), duration=%v, dial_error=%v ❌\n", transportCfg, testDomain, time.Since(startTime), err)
+		if _, err := f.testDomain(ctx, dialer, testDomain, strategyType, transportCfg); err != nil {
 			return err
 		}
-		tlsConn := tls.Client(testConn, &tls.Config{ServerName: testDomain})
-		err = tlsConn.HandshakeContext(ctx)
-		tlsConn.Close()
-		if err != nil {
-			f.logCtx(ctx, "🏁 failed TLS handshake: '%v' (domain: %v), duration=%v, handshake=%v ❌\n", transportCfg, testDomain, time.Since(startTime), err)
-			return err
-		}
-		f.logCtx(ctx, "🏁 success: '%v' (domain: %v), duration=%v, status=ok ✅\n", transportCfg, testDomain, time.Since(startTime))
 	}
 	return nil
 }
 
+// testDomain tests that the dialer can complete a TLS handshake with the test domain, and measures the handshake.
+func (f *StrategyFinder) testDomain(ctx context.Context, dialer transport.StreamDialer, testDomain string, strategyType string, transportCfg string) (handshakeMeasurement, error) {
+	startTime := time.Now()
+
+	testAddr := net.JoinHostPort(testDomain, "443")
+	f.logCtx(ctx, "🏃 running test: '%v' (domain: %v)\n", transportCfg, testDomain)
+
+	ctx, cancel := context.WithTimeout(ctx, f.TestTimeout)
+	defer cancel()
+	testConn, err := dialer.DialStream(ctx, testAddr)
+	if err != nil {
+		f.logCtx(ctx, "🏁 failed to dial: '%v' (domain: %v), duration=%v, dial_error=%v ❌\n", transportCfg, testDomain, time.Since(startTime), err)
+		recordAttempt(ctx, strategyType, transportCfg, testDomain, startTime, err)
+		return handshakeMeasurement{}, err
+	}
+	countingConn := &readCountingConn{StreamConn: testConn}
+	tlsConn := tls.Client(countingConn, &tls.Config{ServerName: testDomain})
+	err = tlsConn.HandshakeContext(ctx)
+	tlsConn.Close()
+	if err != nil {
+		f.logCtx(ctx, "🏁 failed TLS handshake: '%v' (domain: %v), duration=%v, handshake=%v ❌\n", transportCfg, testDomain, time.Since(startTime), err)
+		recordAttempt(ctx, strategyType, transportCfg, testDomain, startTime, err)
+		return handshakeMeasurement{}, err
+	}
+	f.logCtx(ctx, "🏁 success: '%v' (domain: %v), duration=%v, status=ok ✅\n", transportCfg, testDomain, time.Since(startTime))
+	recordAttempt(ctx, strategyType, transportCfg, testDomain, startTime, nil)
+	return handshakeMeasurement{Duration: time.Since(startTime), BytesRead: countingConn.bytesRead.Load()}, nil
+}
+
 func (f *StrategyFinder) findDNS(ctx context.Context, testDomains []string, dnsConfig []dnsEntryConfig) (dns.Resolver, *dnsEntryConfig, error) {
 	resolvers, err := f.dnsConfigToResolver(dnsConfig)
 	if err != nil {
@@ -297,6 +340,7 @@ func (f *StrategyFinder) findDNS(ctx context.Context, testDomains []string, dnsC
 			}
 			// Only output log if the search is not done yet.
 			f.logCtx(ctx, "🏁 got DNS: %v (domain: %v), duration=%v, ips=%v, status=%v\n", resolver.ID, testDomain, duration, ips, status)
+			recordAttempt(ctx, StrategyTypeDNS, dnsEntryID(resolver.Config), testDomain, startTime, err)
 
 			if err != nil {
 				return nil, err
@@ -326,20 +370,36 @@ func (f *StrategyFinder) findTLS(
 	type SearchResult struct {
 		Dialer transport.StreamDialer
 		Config string
+		Cost   float64
 	}
-	result, err := raceTests(ctx, 250*time.Millisecond, tlsConfig, func(transportCfg string) (*SearchResult, error) {
+	test := func(transportCfg string) (*SearchResult, error) {
 		tlsDialer, err := configModule.NewStreamDialer(ctx, transportCfg)
 		if err != nil {
 			return nil, fmt.Errorf("WrapStreamDialer failed: %w", err)
 		}
 
-		err = f.testDialer(ctx, tlsDialer, testDomains, transportCfg)
+		if f.CostModel == nil {
+			err = f.testDialer(ctx, tlsDialer, testDomains, StrategyTypeTLS, transportCfg)
+			if err != nil {
+				return nil, err
+			}
+			return &SearchResult{tlsDialer, transportCfg, 0}, nil
+		}
+		measurement, err := f.measureDialer(ctx, tlsDialer, testDomains, StrategyTypeTLS, transportCfg)
 		if err != nil {
 			return nil, err
 		}
-
-		return &SearchResult{tlsDialer, transportCfg}, nil
-	})
+		cost := f.CostModel.cost(measurement, configParts(transportCfg))
+		f.logCtx(ctx, "📊 cost of TLS strategy '%v': %.3f\n", transportCfg, cost)
+		return &SearchResult{tlsDialer, transportCfg, cost}, nil
+	}
+	var result *SearchResult
+	var err error
+	if f.CostModel == nil {
+		result, err = raceTests(ctx, 250*time.Millisecond, tlsConfig, test)
+	} else {
+		result, err = raceScoredTests(ctx, 250*time.Millisecond, f.CostModel.window(), tlsConfig, test, func(r *SearchResult) float64 { return r.Cost })
+	}
 	if err != nil {
 		return nil, "", fmt.Errorf("could not find TLS strategy: %w", err)
 	}
@@ -366,6 +426,8 @@ type SearchResult struct {
 	Dialer          transport.StreamDialer
 	Config          fallbackEntryConfig
 	ConfigSignature string
+	// cost is the cost of the fallback if there's a [CostModel].
+	cost float64
 }
 
 // Make a fallback dialer (either from a configurl or a Psiphon config)
@@ -379,9 +441,16 @@ func (f *StrategyFinder) makeDialerFromConfig(ctx context.Context, configModule
 		if err != nil {
 			return nil, v, fmt.Errorf("getStreamDialer failed: %w", err)
 		}
+		// Fallbacks must be proxies that resolve the names, so they don't depend on the local DNS.
+		if err := transport.CheckCapabilities(dialer, transport.CapabilityRemoteDNS); err != nil {
+			return nil, v, fmt.Errorf("fallback is not a proxy: %w", err)
+		}
 		return dialer, v, nil
 
 	case fallbackEntryStructConfig:
+		if v.ConfigURL != "" {
+			return f.makeDialerFromConfig(ctx, configModule, v.ConfigURL)
+		}
 		if v.Psiphon != nil {
 			psiphonCfg := v.Psiphon
 
@@ -418,20 +487,38 @@ func (f *StrategyFinder) findFallback(
 
 	configModule := configurl.NewDefaultProviders()
 
-	fallback, err := raceTests(raceCtx, 250*time.Millisecond, fallbackConfigs, func(fallbackConfig fallbackEntryConfig) (*SearchResult, error) {
+	test := func(fallbackConfig fallbackEntryConfig) (*SearchResult, error) {
+		startTime := time.Now()
 		dialer, configSignature, err := f.makeDialerFromConfig(raceCtx, configModule, fallbackConfig)
 		if err != nil {
 			f.logCtx(raceCtx, "❌ Failed to start dialer: %v %v\n", configSignature, err)
+			recordAttempt(raceCtx, StrategyTypeFallback, configSignature, "", startTime, err)
 			return nil, err
 		}
 
-		err = f.testDialer(raceCtx, dialer, testDomains, configSignature)
+		result := &SearchResult{Dialer: dialer, Config: fallbackConfig, ConfigSignature: configSignature}
+		if f.CostModel == nil {
+			err = f.testDialer(raceCtx, dialer, testDomains, StrategyTypeFallback, configSignature)
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+		measurement, err := f.measureDialer(raceCtx, dialer, testDomains, StrategyTypeFallback, configSignature)
 		if err != nil {
 			return nil, err
 		}
-
-		return &SearchResult{dialer, fallbackConfig, configSignature}, nil
-	})
+		result.cost = f.CostModel.cost(measurement, configParts(fallbackConfig))
+		f.logCtx(raceCtx, "📊 cost of fallback '%v': %.3f\n", configSignature, result.cost)
+		return result, nil
+	}
+	var fallback *SearchResult
+	var err error
+	if f.CostModel == nil {
+		fallback, err = raceTests(raceCtx, 250*time.Millisecond, fallbackConfigs, test)
+	} else {
+		fallback, err = raceScoredTests(raceCtx, 250*time.Millisecond, f.CostModel.window(), fallbackConfigs, test, func(r *SearchResult) float64 { return r.cost })
+	}
 	if err != nil {
 		return nil, nil, fmt.Errorf("could not find a working fallback: %w", err)
 	}
@@ -465,13 +552,32 @@ func (f *StrategyFinder) newProxylessDialer(
 	if len(config.TLS) == 0 {
 		return dnsDialer, dnsConfig, "", nil
 	}
-	sd, tlsConfig, err := f.findTLS(ctx, testDomains, dnsDialer, config.TLS)
+	sd, tlsConfig, err := f.findTLS(ctx, testDomains, dnsDialer, withPassthroughFirst(config.TLS))
 	if err != nil {
 		return nil, nil, "", err
 	}
+	if tlsConfig == "" {
+		// TLS works without changes, so there's no need to transform the traffic.
+		f.log("🔓 TLS passthrough works, only DNS needs fixing\n")
+		return dnsDialer, dnsConfig, "", nil
+	}
 	return sd, dnsConfig, tlsConfig, err
 }
 
+// withPassthroughFirst returns the TLS strategies with the passthrough ("") one first, adding it if missing.
+// On networks where only DNS is blocked, that selects a DNS-only strategy instead of one that
+// unnecessarily transforms the TLS traffic, since it gets a head start in the race.
+func withPassthroughFirst(tlsConfig []string) []string {
+	result := make([]string, 0, len(tlsConfig)+1)
+	result = append(result, "")
+	for _, cfg := range tlsConfig {
+		if cfg != "" {
+			result = append(result, cfg)
+		}
+	}
+	return result
+}
+
 func (f *StrategyFinder) parseConfig(configBytes []byte) (configConfig, error) {
 	var parsedConfig configConfig
 	var configMap map[string]any
@@ -495,6 +601,9 @@ func (f *StrategyFinder) parseConfig(configBytes []byte) (configConfig, error) {
 			if err != nil {
 				return configConfig{}, fmt.Errorf("failed to parse fallback config: %w", err)
 			}
+			if (fallbackEntry.Psiphon == nil) == (fallbackEntry.ConfigURL == "") {
+				return configConfig{}, fmt.Errorf("fallback must have one of psiphon or configurl: %v", v)
+			}
 			parsedConfig.Fallback[i] = fallbackEntry
 		default:
 			return configConfig{}, fmt.Errorf("unknown fallback type: %v", v)
@@ -529,6 +638,18 @@ func (f *StrategyFinder) rankStrategiesFromCache(
 	return input, nil
 }
 
+// InvalidateCache removes the winning strategy from the [StrategyFinder.Cache], so the next call to
+// [StrategyFinder.NewDialer] searches all the strategies again. Call it when the network changes,
+// for instance from a [connectivity.NetworkMonitor] listener.
+//
+// [connectivity.NetworkMonitor]: https://pkg.go.dev/github.com/Jigsaw-Code/outline-sdk/x/connectivity#NetworkMonitor
+func (f *StrategyFinder) InvalidateCache() {
+	if f.Cache != nil {
+		f.Cache.Put(winningStrategyCacheKey, nil)
+		f.log("💾 strategy cache cleared\n")
+	}
+}
+
 // NewDialer uses the config in configBytes to search for a strategy that unblocks DNS and TLS for all of the testDomains, returning a dialer with the found strategy.
 // It returns an error if no strategy was found that unblocks the testDomains.
 // The testDomains must be domains with a TLS service running on port 443.
@@ -545,18 +666,52 @@ func (f *StrategyFinder) NewDialer(ctx context.Context, testDomains []string, co
 		testDomains[di] = makeFullyQualified(domain)
 	}
 
+	// The demoting dialer searches with the context of the caller, but not with the recorder of this search.
+	demotionCtx := ctx
+	var rec *strategyRecorder
+	if f.Reporter != nil {
+		rec = &strategyRecorder{report: StrategyReport{StartTime: time.Now(), TestDomains: testDomains}}
+		ctx = withStrategyRecorder(ctx, rec)
+	}
+	inputConfig.Fallback = f.enabledFallbacks(inputConfig.Fallback)
+	// findStrategy may reorder the entries of the config, so the demotion gets a copy of the original.
+	originalConfig := inputConfig.clone()
+	dialer, winner, fromCache, err := f.findStrategy(ctx, testDomains, inputConfig)
+	if rec != nil {
+		if reportErr := f.Reporter.Collect(context.WithoutCancel(ctx), rec.finish(winner, fromCache, err)); reportErr != nil {
+			f.log("⚠️ failed to report strategy search: %v\n", reportErr)
+		}
+	}
+	if err == nil && f.Demotion != nil {
+		dialer = newDemotingDialer(demotionCtx, f, testDomains, originalConfig, dialer, winner)
+	}
+	return dialer, err
+}
+
+// findStrategy searches for a working strategy, returning the dialer, the winning config and whether it was
+// resumed from the cache.
+func (f *StrategyFinder) findStrategy(ctx context.Context, testDomains []string, inputConfig configConfig) (transport.StreamDialer, *winningConfig, bool, error) {
 	// Fast resume the winning strategy from the cache
 	if f.Cache != nil {
 		rankedConfig, first2Try := f.rankStrategiesFromCache(inputConfig)
 		if first2Try != nil {
 			if dialer, _, err := f.findFallback(ctx, testDomains, []fallbackEntryConfig{first2Try}); err == nil {
-				return dialer, nil
+				winner := newFallbackWinningConfig(first2Try)
+				return dialer, &winner, true, nil
 			}
 		}
 		inputConfig = rankedConfig
 	}
 
-	// Find a working strategy and persist it to the cache
+	dialer, winner, err := f.searchStrategy(ctx, testDomains, inputConfig)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return dialer, winner, false, nil
+}
+
+// searchStrategy races the strategies in the order of the config, and persists the winner to the cache.
+func (f *StrategyFinder) searchStrategy(ctx context.Context, testDomains []string, inputConfig configConfig) (transport.StreamDialer, *winningConfig, error) {
 	var winner winningConfig
 	dialer, dnsConf, tlsConf, err := f.newProxylessDialer(ctx, testDomains, inputConfig)
 	if err == nil {
@@ -583,5 +738,8 @@ func (f *StrategyFinder) NewDialer(ctx context.Context, testDomains []string, co
 		}
 	}
 
-	return dialer, err
+	if err != nil {
+		return nil, nil, err
+	}
+	return dialer, &winner, nil
 }
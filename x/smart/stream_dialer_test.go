@@ -133,3 +133,35 @@ func Test_getPsiphonConfigSignature_InvalidJson(t *testing.T) {
 	actual := finder.getPsiphonConfigSignature(config)
 	require.Equal(t, expected, actual)
 }
+
+type mapCache map[string][]byte
+
+func (c mapCache) Get(key string) ([]byte, bool) {
+	value, ok := c[key]
+	return value, ok
+}
+
+func (c mapCache) Put(key string, value []byte) {
+	if value == nil {
+		delete(c, key)
+		return
+	}
+	c[key] = value
+}
+
+func TestInvalidateCache(t *testing.T) {
+	cache := mapCache{winningStrategyCacheKey: []byte("tls: [split:1]")}
+	finder := &StrategyFinder{Cache: cache}
+	finder.InvalidateCache()
+	_, ok := cache.Get(winningStrategyCacheKey)
+	require.False(t, ok)
+
+	// No cache is a no-op.
+	(&StrategyFinder{}).InvalidateCache()
+}
+
+func TestWithPassthroughFirst(t *testing.T) {
+	require.Equal(t, []string{"", "split:1", "tlsfrag:1"}, withPassthroughFirst([]string{"split:1", "tlsfrag:1"}))
+	require.Equal(t, []string{"", "split:1", "tlsfrag:1"}, withPassthroughFirst([]string{"split:1", "", "tlsfrag:1"}))
+	require.Equal(t, []string{""}, withPassthroughFirst([]string{""}))
+}
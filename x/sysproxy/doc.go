@@ -75,6 +75,16 @@
 //
 // after setting the proxy.
 //
+// To put back the settings the user had before, rather than disabling the proxy, save them with [SaveSettings] before
+// changing them, and restore them when done:
+//
+//	settings, err := SaveSettings()
+//	if err != nil {
+//		return err
+//	}
+//	defer settings.Restore()
+//	err = SetWebProxy("127.0.0.1", "8080")
+//
 // The section below provides platform-specific details on how the proxy settings are configured.
 //
 // # macOS
@@ -91,7 +101,10 @@
 //
 // # Linux
 //
-// Currently only GNOME is supported. This package uses gsettings untility to setup proxy settings. The following commands are used to set proxy settings:
+// GNOME and KDE Plasma are supported. KDE is detected with the XDG_CURRENT_DESKTOP environment variable, and the other
+// desktops use the GNOME settings, which many of them honor.
+//
+// On GNOME, this package uses gsettings untility to setup proxy settings. The following commands are used to set proxy settings:
 //
 //	gsetting set org.gnome.system.proxy.http host 'proxy.example.com'
 //	gsetting set org.gnome.system.proxy.http port 8080
@@ -104,6 +117,12 @@
 //
 // For more information, you can checkout the documentation for [gsettings] and its [configuration].
 //
+// On KDE, this package writes the "Proxy Settings" group of kioslaverc with kwriteconfig6 or kwriteconfig5, and notifies
+// the running apps with dbus-send:
+//
+//	kwriteconfig6 --file kioslaverc --group "Proxy Settings" --key httpProxy "http://127.0.0.1 8080"
+//	kwriteconfig6 --file kioslaverc --group "Proxy Settings" --key ProxyType 1
+//
 // # Windows
 //
 // On Windows, the package uses HKCU\Software\Microsoft\Windows\CurrentVersion\Internet Settings + InternetSetOptionW
@@ -245,7 +245,8 @@ func parseProxySettings(commandOutput string) (*proxySettings, error) {
 			}
 		}
 	}
-	if host == "" || port == "" {
+	// The host is empty if the proxy was never set.
+	if enabled && (host == "" || port == "") {
 		return nil, fmt.Errorf("failed to parse host and port from output")
 	}
 	return &proxySettings{host: host, port: port, enabled: enabled}, nil
@@ -287,3 +288,43 @@ func getSOCKSProxy() (host string, port string, enabled bool, err error) {
 
 	return socksSettings.host, socksSettings.port, socksSettings.enabled, nil
 }
+
+// Settings are the system proxy settings saved by [SaveSettings].
+type Settings struct {
+	networkService string
+	proxies        map[ProxyType]*proxySettings
+}
+
+// SaveSettings returns the current system proxy settings of the active network service, so they can be restored
+// with [Settings.Restore].
+func SaveSettings() (*Settings, error) {
+	activeInterface, err := getActiveNetworkInterface()
+	if err != nil {
+		return nil, err
+	}
+	s := &Settings{networkService: activeInterface, proxies: make(map[ProxyType]*proxySettings)}
+	for _, p := range []ProxyType{proxyTypeHTTP, proxyTypeHTTPS, proxyTypeSOCKS} {
+		if s.proxies[p], err = getProxySettings(p, activeInterface); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Restore sets the system proxy settings of the saved network service back to the saved values.
+func (s *Settings) Restore() error {
+	var errs []error
+	for p, settings := range s.proxies {
+		if settings.host != "" {
+			// Setting the proxy also enables it.
+			if err := setProxySettings(p, s.networkService, settings.host, settings.port); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if !settings.enabled {
+			errs = append(errs, disableProxy(p, s.networkService))
+		}
+	}
+	return errors.Join(errs...)
+}
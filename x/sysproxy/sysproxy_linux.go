@@ -19,6 +19,8 @@ package sysproxy
 import (
 	"errors"
 	"fmt"
+	"net"
+	"os"
 	"os/exec"
 	"strings"
 )
@@ -32,6 +34,15 @@ const (
 )
 
 func SetWebProxy(host string, port string) error {
+	if isKDE() {
+		if err := kdeSetProxy(proxyTypeHTTP, host, port); err != nil {
+			return err
+		}
+		if err := kdeSetProxy(proxyTypeHTTPS, host, port); err != nil {
+			return err
+		}
+		return kdeSetMode(kdeModeManual)
+	}
 	// Set HTTP and HTTPS proxy settings
 	if err := setProxySettings(proxyTypeHTTP, host, port); err != nil {
 		return err
@@ -46,10 +57,19 @@ func SetWebProxy(host string, port string) error {
 }
 
 func DisableWebProxy() error {
+	if isKDE() {
+		return kdeSetMode(kdeModeNone)
+	}
 	return gnomeSettingsSetString("org.gnome.system.proxy", "mode", "none")
 }
 
 func SetSOCKSProxy(host string, port string) error {
+	if isKDE() {
+		if err := kdeSetProxy(proxyTypeSOCKS, host, port); err != nil {
+			return err
+		}
+		return kdeSetMode(kdeModeManual)
+	}
 	// Set SOCKS proxy settings
 	if err := setProxySettings(proxyTypeSOCKS, host, port); err != nil {
 		return err
@@ -61,6 +81,9 @@ func SetSOCKSProxy(host string, port string) error {
 }
 
 func DisableSOCKSProxy() error {
+	if isKDE() {
+		return kdeSetMode(kdeModeNone)
+	}
 	return gnomeSettingsSetString("org.gnome.system.proxy", "mode", "none")
 }
 
@@ -104,6 +127,9 @@ func gnomeSettingsSetString(settings, key, value string) error {
 }
 
 func getWebProxy() (host string, port string, enabled bool, err error) {
+	if isKDE() {
+		return kdeGetProxy(proxyTypeHTTP)
+	}
 	httpHost, err := gnomeSettingsGetString("org.gnome.system.proxy.http", "host")
 	if err != nil {
 		return "", "", false, err
@@ -135,6 +161,9 @@ func getWebProxy() (host string, port string, enabled bool, err error) {
 }
 
 func getSOCKSProxy() (host string, port string, enabled bool, err error) {
+	if isKDE() {
+		return kdeGetProxy(proxyTypeSOCKS)
+	}
 
 	socksHost, err := gnomeSettingsGetString("org.gnome.system.proxy.socks", "host")
 	if err != nil {
@@ -158,3 +187,182 @@ func gnomeSettingsGetString(settings, key string) (string, error) {
 	trimmed := strings.TrimSpace(string(out))
 	return strings.Trim(string(trimmed), "'"), err
 }
+
+// gnomeSettingsKeys are the GNOME proxy settings saved by [SaveSettings].
+var gnomeSettingsKeys = [][2]string{
+	{"org.gnome.system.proxy", "mode"},
+	{"org.gnome.system.proxy.http", "host"},
+	{"org.gnome.system.proxy.http", "port"},
+	{"org.gnome.system.proxy.https", "host"},
+	{"org.gnome.system.proxy.https", "port"},
+	{"org.gnome.system.proxy.socks", "host"},
+	{"org.gnome.system.proxy.socks", "port"},
+}
+
+// kdeSettingsKeys are the KDE proxy settings saved by [SaveSettings].
+var kdeSettingsKeys = []string{"ProxyType", "httpProxy", "httpsProxy", "socksProxy"}
+
+// Settings are the system proxy settings saved by [SaveSettings].
+type Settings struct {
+	kde bool
+	// values maps the keys to their values, in the order of gnomeSettingsKeys or kdeSettingsKeys.
+	values []string
+}
+
+// SaveSettings returns the current system proxy settings, so they can be restored with [Settings.Restore].
+func SaveSettings() (*Settings, error) {
+	if isKDE() {
+		s := &Settings{kde: true}
+		for _, key := range kdeSettingsKeys {
+			value, err := kdeReadConfig(key)
+			if err != nil {
+				return nil, err
+			}
+			s.values = append(s.values, value)
+		}
+		return s, nil
+	}
+	s := &Settings{}
+	for _, key := range gnomeSettingsKeys {
+		value, err := gnomeSettingsGetString(key[0], key[1])
+		if err != nil {
+			return nil, fmt.Errorf("gsettings command failed: %w", err)
+		}
+		s.values = append(s.values, value)
+	}
+	return s, nil
+}
+
+// Restore sets the system proxy settings back to the saved values.
+func (s *Settings) Restore() error {
+	if s.kde {
+		for i, key := range kdeSettingsKeys {
+			if err := kdeWriteConfig(key, s.values[i]); err != nil {
+				return err
+			}
+		}
+		return kdeNotifyChange()
+	}
+	// Restore the mode last, so the proxy is not enabled with the wrong address.
+	var errs []error
+	for i := len(gnomeSettingsKeys) - 1; i >= 0; i-- {
+		key := gnomeSettingsKeys[i]
+		errs = append(errs, gnomeSettingsSetString(key[0], key[1], s.values[i]))
+	}
+	return errors.Join(errs...)
+}
+
+// isKDE reports whether the current desktop is KDE Plasma, which keeps its proxy settings in kioslaverc.
+// Other desktops use the GNOME settings.
+func isKDE() bool {
+	for _, desktop := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if strings.EqualFold(desktop, "KDE") {
+			return true
+		}
+	}
+	return false
+}
+
+// Values of the ProxyType key of KDE.
+const (
+	kdeModeNone   = "0"
+	kdeModeManual = "1"
+)
+
+// kdeProxyKeys maps the proxy types to their keys in kioslaverc.
+var kdeProxyKeys = map[ProxyType]string{
+	proxyTypeHTTP:  "httpProxy",
+	proxyTypeHTTPS: "httpsProxy",
+	proxyTypeSOCKS: "socksProxy",
+}
+
+func kdeSetMode(mode string) error {
+	if err := kdeWriteConfig("ProxyType", mode); err != nil {
+		return err
+	}
+	return kdeNotifyChange()
+}
+
+func kdeSetProxy(p ProxyType, host string, port string) error {
+	scheme := "http"
+	if p == proxyTypeSOCKS {
+		scheme = "socks"
+	}
+	// KDE uses a space to separate the port.
+	return kdeWriteConfig(kdeProxyKeys[p], fmt.Sprintf("%s://%s %s", scheme, host, port))
+}
+
+func kdeGetProxy(p ProxyType) (host string, port string, enabled bool, err error) {
+	value, err := kdeReadConfig(kdeProxyKeys[p])
+	if err != nil {
+		return "", "", false, err
+	}
+	mode, err := kdeReadConfig("ProxyType")
+	if err != nil {
+		return "", "", false, err
+	}
+	host, port, err = parseKDEProxy(value)
+	if err != nil {
+		return "", "", false, err
+	}
+	return host, port, mode == kdeModeManual, nil
+}
+
+// parseKDEProxy parses a proxy address of kioslaverc, like "http://127.0.0.1 8080" or "socks://[::1]:1080".
+func parseKDEProxy(value string) (host string, port string, err error) {
+	if _, rest, found := strings.Cut(value, "://"); found {
+		value = rest
+	}
+	if host, port, found := strings.Cut(value, " "); found {
+		return host, port, nil
+	}
+	return net.SplitHostPort(value)
+}
+
+// kdeConfigCommand returns the path of the KDE config tool with the prefix, for Plasma 6 or 5.
+func kdeConfigCommand(prefix string) (string, error) {
+	for _, version := range []string{"6", "5"} {
+		if path, err := exec.LookPath(prefix + version); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found", prefix)
+}
+
+func kdeReadConfig(key string) (string, error) {
+	command, err := kdeConfigCommand("kreadconfig")
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command(command, "--file", "kioslaverc", "--group", "Proxy Settings", "--key", key).Output()
+	if err != nil {
+		return "", fmt.Errorf("kreadconfig command failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func kdeWriteConfig(key string, value string) error {
+	command, err := kdeConfigCommand("kwriteconfig")
+	if err != nil {
+		return err
+	}
+	args := []string{"--file", "kioslaverc", "--group", "Proxy Settings", "--key", key}
+	if value == "" {
+		args = append(args, "--delete")
+	} else {
+		args = append(args, value)
+	}
+	if err := exec.Command(command, args...).Run(); err != nil {
+		return fmt.Errorf("kwriteconfig command failed: %w", err)
+	}
+	return nil
+}
+
+// kdeNotifyChange tells the running KDE apps to reload the proxy settings.
+func kdeNotifyChange() error {
+	err := exec.Command("dbus-send", "--type=signal", "/KIO/Scheduler", "org.kde.KIO.Scheduler.reparseSlaveConfiguration", "string:").Run()
+	if err != nil {
+		return fmt.Errorf("dbus-send command failed: %w", err)
+	}
+	return nil
+}
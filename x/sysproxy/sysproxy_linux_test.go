@@ -0,0 +1,44 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && !android
+
+package sysproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKDEProxy(t *testing.T) {
+	for value, want := range map[string][2]string{
+		"http://127.0.0.1 8080":  {"127.0.0.1", "8080"},
+		"socks://[::1]:1080":     {"::1", "1080"},
+		"proxy.example.com 3128": {"proxy.example.com", "3128"},
+	} {
+		host, port, err := parseKDEProxy(value)
+		require.NoError(t, err, value)
+		require.Equal(t, want, [2]string{host, port}, value)
+	}
+	_, _, err := parseKDEProxy("")
+	require.Error(t, err)
+}
+
+func TestIsKDE(t *testing.T) {
+	t.Setenv("XDG_CURRENT_DESKTOP", "ubuntu:GNOME")
+	require.False(t, isKDE())
+	t.Setenv("XDG_CURRENT_DESKTOP", "KDE")
+	require.True(t, isKDE())
+}
@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-//go:build !linux && !windows && !darwin
+//go:build !(linux && !android) && !windows && !(darwin && !ios)
 
 package sysproxy
 
@@ -37,3 +37,16 @@ func SetSOCKSProxy(ip string, port string) error {
 func DisableSOCKSProxy() error {
 	return errors.New("unsupported platform")
 }
+
+// Settings are the system proxy settings saved by [SaveSettings].
+type Settings struct{}
+
+// SaveSettings does nothing on unsupported platforms.
+func SaveSettings() (*Settings, error) {
+	return nil, errors.New("unsupported platform")
+}
+
+// Restore does nothing on unsupported platforms.
+func (s *Settings) Restore() error {
+	return errors.New("unsupported platform")
+}
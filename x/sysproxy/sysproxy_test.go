@@ -100,6 +100,23 @@ func TestClearSocksProxy(t *testing.T) {
 	require.Equal(t, false, enabled)
 }
 
+func TestSaveSettings(t *testing.T) {
+	require.NoError(t, SetWebProxy("127.0.0.1", "8080"))
+	settings, err := SaveSettings()
+	require.NoError(t, err)
+
+	require.NoError(t, SetWebProxy("127.0.0.2", "9090"))
+	require.NoError(t, settings.Restore())
+
+	h, p, e, err := getWebProxy()
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", h)
+	require.Equal(t, "8080", p)
+	require.True(t, e)
+
+	require.NoError(t, DisableWebProxy())
+}
+
 func generateRandomDomain() string {
 
 	// Define the characters allowed in the domain name
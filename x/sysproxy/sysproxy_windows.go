@@ -17,6 +17,7 @@
 package sysproxy
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"strings"
@@ -191,3 +192,63 @@ func getSOCKSProxy() (host string, port string, enabled bool, err error) {
 
 	return host, port, proxyEnable == 1, nil
 }
+
+// Settings are the system proxy settings saved by [SaveSettings].
+type Settings struct {
+	proxyEnable uint64
+	// proxyServer and proxyOverride are nil if the values don't exist.
+	proxyServer   *string
+	proxyOverride *string
+}
+
+// SaveSettings returns the current system proxy settings, so they can be restored with [Settings.Restore].
+func SaveSettings() (*Settings, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close()
+
+	s := &Settings{}
+	if s.proxyEnable, _, err = key.GetIntegerValue("ProxyEnable"); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return nil, err
+	}
+	for name, value := range map[string]**string{"ProxyServer": &s.proxyServer, "ProxyOverride": &s.proxyOverride} {
+		v, _, err := key.GetStringValue(name)
+		if errors.Is(err, registry.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		*value = &v
+	}
+	return s, nil
+}
+
+// Restore sets the system proxy settings back to the saved values.
+func (s *Settings) Restore() error {
+	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	for name, value := range map[string]*string{"ProxyServer": s.proxyServer, "ProxyOverride": s.proxyOverride} {
+		if value == nil {
+			err = key.DeleteValue(name)
+			if errors.Is(err, registry.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			err = key.SetStringValue(name, *value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err = key.SetDWordValue("ProxyEnable", uint32(s.proxyEnable)); err != nil {
+		return err
+	}
+	return notifyWinInetProxySettingsChanged()
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package tlslistener terminates TLS on the server side, as the counterpart of the TLS stream dialer, so servers can
+be composed like clients. For instance, to serve WebSocket over TLS:
+
+	tlsListener, err := tlslistener.NewListener(tcpListener, &tls.Config{Certificates: certs}, nil)
+	if err != nil {
+		// handle error
+	}
+	wsListener, err := websocket.NewListener(tlsListener, "/tcp")
+
+Handshakes run concurrently, with a timeout, so slow or idle clients don't block Accept.
+*/
+package tlslistener
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// DefaultHandshakeTimeout is the time clients have to complete the TLS handshake.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// Listener is a [net.Listener] that accepts the connections of the wrapped listener once they complete the TLS
+// handshake.
+type Listener struct {
+	listener         net.Listener
+	config           *tls.Config
+	onHandshakeError func(net.Addr, error)
+	accepted         chan *Conn
+	done             chan struct{}
+	closeOnce        sync.Once
+	err              error
+	closeErr         error
+	mu               sync.Mutex
+	closed           bool
+	handshaking      map[net.Conn]struct{}
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// NewListener creates a [Listener] that terminates TLS with the config on the connections of the listener.
+// The config must have a certificate, or a callback to get one. If not nil, onHandshakeError is called with the
+// client address and error of failed handshakes, for logging.
+func NewListener(listener net.Listener, config *tls.Config, onHandshakeError func(net.Addr, error)) (*Listener, error) {
+	if listener == nil {
+		return nil, errors.New("argument listener must not be nil")
+	}
+	if config == nil {
+		return nil, errors.New("argument config must not be nil")
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, errors.New("config must have a certificate")
+	}
+	l := &Listener{
+		listener:         listener,
+		config:           config,
+		onHandshakeError: onHandshakeError,
+		accepted:         make(chan *Conn),
+		done:             make(chan struct{}),
+		handshaking:      make(map[net.Conn]struct{}),
+	}
+	go l.acceptLoop()
+	return l, nil
+}
+
+// Accept implements [net.Listener].Accept. It returns the next connection that completed the handshake, which is a
+// [*Conn].
+func (l *Listener) Accept() (net.Conn, error) {
+	return l.AcceptStream()
+}
+
+// AcceptStream is like Accept, but returns a [transport.StreamConn].
+func (l *Listener) AcceptStream() (transport.StreamConn, error) {
+	select {
+	case conn := <-l.accepted:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Close implements [net.Listener].Close. It also closes the connections in the middle of the handshake.
+func (l *Listener) Close() error {
+	l.shutdown(net.ErrClosed)
+	return l.closeErr
+}
+
+// Addr implements [net.Listener].Addr.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *Listener) shutdown(err error) {
+	l.closeOnce.Do(func() {
+		l.err = err
+		close(l.done)
+		l.closeErr = l.listener.Close()
+		l.mu.Lock()
+		l.closed = true
+		for conn := range l.handshaking {
+			conn.Close()
+		}
+		l.mu.Unlock()
+	})
+}
+
+func (l *Listener) acceptLoop() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			l.shutdown(err)
+			return
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			conn.Close()
+			return
+		}
+		l.handshaking[conn] = struct{}{}
+		l.mu.Unlock()
+		go l.handshake(conn)
+	}
+}
+
+func (l *Listener) handshake(conn net.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultHandshakeTimeout)
+	defer cancel()
+	tlsConn := tls.Server(conn, l.config)
+	err := tlsConn.HandshakeContext(ctx)
+	l.mu.Lock()
+	delete(l.handshaking, conn)
+	l.mu.Unlock()
+	if err != nil {
+		if l.onHandshakeError != nil {
+			l.onHandshakeError(conn.RemoteAddr(), err)
+		}
+		conn.Close()
+		return
+	}
+	accepted := &Conn{Conn: tlsConn}
+	select {
+	case l.accepted <- accepted:
+	case <-l.done:
+		accepted.Close()
+	}
+}
+
+// Conn is a server TLS connection that implements [transport.StreamConn].
+type Conn struct {
+	*tls.Conn
+}
+
+var _ transport.StreamConn = (*Conn)(nil)
+
+// CloseRead closes the read side of the underlying connection, if supported. Otherwise it returns
+// [errors.ErrUnsupported].
+func (c *Conn) CloseRead() error {
+	if closer, ok := c.Conn.NetConn().(interface{ CloseRead() error }); ok {
+		return closer.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,170 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlslistener
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "server.example"},
+		DNSNames:     []string{"server.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	serverConfig := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	clientConfig := &tls.Config{ServerName: "server.example", RootCAs: roots}
+	return serverConfig, clientConfig
+}
+
+func serveEcho(listener interface {
+	AcceptStream() (transport.StreamConn, error)
+}) {
+	for {
+		conn, err := listener.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			io.Copy(conn, conn)
+			conn.CloseWrite()
+		}()
+	}
+}
+
+func TestListener(t *testing.T) {
+	serverConfig, clientConfig := newTestConfigs(t)
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	handshakeErrors := make(chan error, 1)
+	listener, err := NewListener(tcpListener, serverConfig, func(addr net.Addr, err error) {
+		handshakeErrors <- err
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveEcho(listener)
+
+	// A client that doesn't speak TLS doesn't block the others.
+	plainConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer plainConn.Close()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("Request"))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "Request", string(response))
+
+	_, err = plainConn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	select {
+	case err := <-handshakeErrors:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no handshake error reported")
+	}
+}
+
+func TestListener_Close(t *testing.T) {
+	serverConfig, _ := newTestConfigs(t)
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := NewListener(tcpListener, serverConfig, nil)
+	require.NoError(t, err)
+
+	// Closing the listener closes the connections in the middle of the handshake.
+	pending, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer pending.Close()
+	require.Eventually(t, func() bool {
+		listener.mu.Lock()
+		defer listener.mu.Unlock()
+		return len(listener.handshaking) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, listener.Close())
+	_, err = listener.Accept()
+	require.ErrorIs(t, err, net.ErrClosed)
+	pending.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = pending.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestNewListener_Validation(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcpListener.Close()
+	_, err = NewListener(nil, &tls.Config{}, nil)
+	require.Error(t, err)
+	_, err = NewListener(tcpListener, nil, nil)
+	require.Error(t, err)
+	_, err = NewListener(tcpListener, &tls.Config{}, nil)
+	require.ErrorContains(t, err, "certificate")
+}
+
+// TestWebSocketOverTLS composes the server listeners like the client dialers.
+func TestWebSocketOverTLS(t *testing.T) {
+	serverConfig, clientConfig := newTestConfigs(t)
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tlsListener, err := NewListener(tcpListener, serverConfig, nil)
+	require.NoError(t, err)
+	wsListener, err := websocket.NewListener(tlsListener, "/tcp")
+	require.NoError(t, err)
+	defer wsListener.Close()
+	go serveEcho(wsListener)
+
+	connect, err := websocket.NewStreamEndpoint("wss://server.example/tcp",
+		&transport.TCPEndpoint{Address: tcpListener.Addr().String()}, websocket.WithTLSConfig(clientConfig))
+	require.NoError(t, err)
+	conn, err := connect(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("Request"))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "Request", string(response))
+}
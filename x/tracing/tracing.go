@@ -0,0 +1,292 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package tracing emits spans for dials, so operators can see where connection latency is spent. It doesn't depend
+on OpenTelemetry: [Tracer] and [Span] are small interfaces that an OpenTelemetry tracer can implement with a thin
+adapter:
+
+	type otelTracer struct{ trace.Tracer }
+
+	func (t otelTracer) Start(ctx context.Context, name string, attributes ...tracing.Attribute) (context.Context, tracing.Span) {
+		kvs := make([]attribute.KeyValue, len(attributes))
+		for i, a := range attributes {
+			kvs[i] = attribute.String(a.Key, a.Value)
+		}
+		ctx, span := t.Tracer.Start(ctx, name, trace.WithAttributes(kvs...), trace.WithSpanKind(trace.SpanKindClient))
+		return ctx, otelSpan{span}
+	}
+
+	type otelSpan struct{ trace.Span }
+
+	func (s otelSpan) RecordError(err error) {
+		s.Span.RecordError(err)
+		s.Span.SetStatus(codes.Error, err.Error())
+	}
+
+	func (s otelSpan) End() { s.Span.End() }
+
+To trace the dialers created by [github.com/Jigsaw-Code/outline-sdk/x/configurl], pass the tracer in the context
+of the creation:
+
+	ctx = tracing.WithTracer(ctx, otelTracer{otel.Tracer("outline")})
+	dialer, err := providers.NewStreamDialer(ctx, "tls|ss://...")
+
+Each dial then has a root span with a child span per hop of the chain, named after the config type, like "ss"
+or "tls", down to the "tcp" or "udp" spans of the base dialer, which have "dns" and "connect" children.
+Spans of the same dial are nested through the context passed to the dial.
+*/
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// Attribute is a string attribute of a span.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	// Start starts a span that is a child of the span in ctx, if any, and returns a context with the new span.
+	Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	// RecordError records that the operation failed with err.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
+
+type tracerKey struct{}
+
+// WithTracer returns a context that carries the tracer.
+func WithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// TracerFromContext returns the tracer in ctx, or nil if there's none.
+func TracerFromContext(ctx context.Context) Tracer {
+	tracer, _ := ctx.Value(tracerKey{}).(Tracer)
+	return tracer
+}
+
+// trace runs f in a span with the given name, recording its error.
+func trace[T any](ctx context.Context, tracer Tracer, name string, addr string, f func(ctx context.Context) (T, error)) (T, error) {
+	ctx, span := tracer.Start(ctx, name, Attribute{Key: "address", Value: addr})
+	defer span.End()
+	result, err := f(ctx)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return result, err
+}
+
+// NewStreamDialer returns a dialer that runs each dial of dialer in a span with the given name.
+func NewStreamDialer(tracer Tracer, name string, dialer transport.StreamDialer) (transport.StreamDialer, error) {
+	if tracer == nil {
+		return nil, errors.New("argument tracer must not be nil")
+	}
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	return &tracedStreamDialer{tracer: tracer, name: name, dialer: dialer, dial: dialer.DialStream}, nil
+}
+
+// NewPacketDialer returns a dialer that runs each dial of dialer in a span with the given name.
+func NewPacketDialer(tracer Tracer, name string, dialer transport.PacketDialer) (transport.PacketDialer, error) {
+	if tracer == nil {
+		return nil, errors.New("argument tracer must not be nil")
+	}
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	return &tracedPacketDialer{tracer: tracer, name: name, dialer: dialer, dial: dialer.DialPacket}, nil
+}
+
+// NewTCPDialer returns a dialer that runs each dial of dialer in a "tcp" span. If the address has a host name,
+// the span has a "dns" child for the resolution and a "connect" child for the connection attempts.
+func NewTCPDialer(tracer Tracer, dialer *transport.TCPDialer) (transport.StreamDialer, error) {
+	if tracer == nil {
+		return nil, errors.New("argument tracer must not be nil")
+	}
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	dial := func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		netDialer := tracedNetDialer(ctx, tracer, &dialer.Dialer, addr)
+		conn, err := netDialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return conn.(*net.TCPConn), nil
+	}
+	return &tracedStreamDialer{tracer: tracer, name: "tcp", dialer: dialer, dial: dial}, nil
+}
+
+// NewUDPDialer is like [NewTCPDialer], with a "udp" span.
+func NewUDPDialer(tracer Tracer, dialer *transport.UDPDialer) (transport.PacketDialer, error) {
+	if tracer == nil {
+		return nil, errors.New("argument tracer must not be nil")
+	}
+	if dialer == nil {
+		return nil, errors.New("argument dialer must not be nil")
+	}
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		return tracedNetDialer(ctx, tracer, &dialer.Dialer, addr).DialContext(ctx, "udp", addr)
+	}
+	return &tracedPacketDialer{tracer: tracer, name: "udp", dialer: dialer, dial: dial}, nil
+}
+
+// tracedStreamDialer runs the dials in spans. It forwards the optional interfaces of the dialer, so tracing
+// doesn't change its capabilities.
+type tracedStreamDialer struct {
+	tracer Tracer
+	name   string
+	dialer transport.StreamDialer
+	// dial is the traced version of dialer.DialStream.
+	dial func(ctx context.Context, addr string) (transport.StreamConn, error)
+}
+
+var _ transport.DialAndWriter = (*tracedStreamDialer)(nil)
+var _ transport.CapabilityReporter = (*tracedStreamDialer)(nil)
+var _ transport.Pinger = (*tracedStreamDialer)(nil)
+
+func (d *tracedStreamDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	return trace(ctx, d.tracer, d.name, addr, func(ctx context.Context) (transport.StreamConn, error) {
+		return d.dial(ctx, addr)
+	})
+}
+
+// DialAndWrite implements [transport.DialAndWriter] with the fast path of the dialer, if it has one.
+// The span has no children, even for the TCP dialer.
+func (d *tracedStreamDialer) DialAndWrite(ctx context.Context, addr string, data []byte) (transport.StreamConn, error) {
+	return trace(ctx, d.tracer, d.name, addr, func(ctx context.Context) (transport.StreamConn, error) {
+		return transport.DialAndWrite(ctx, d.dialer, addr, data)
+	})
+}
+
+// Capabilities implements [transport.CapabilityReporter] with the capabilities of the dialer.
+func (d *tracedStreamDialer) Capabilities() transport.Capability {
+	return transport.Capabilities(d.dialer)
+}
+
+// Ping implements [transport.Pinger] by pinging the dialer.
+func (d *tracedStreamDialer) Ping(ctx context.Context) (time.Duration, error) {
+	return transport.Ping(ctx, d.dialer)
+}
+
+// tracedPacketDialer is like [tracedStreamDialer], for packet dialers.
+type tracedPacketDialer struct {
+	tracer Tracer
+	name   string
+	dialer transport.PacketDialer
+	// dial is the traced version of dialer.DialPacket.
+	dial func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+var _ transport.CapabilityReporter = (*tracedPacketDialer)(nil)
+var _ transport.Pinger = (*tracedPacketDialer)(nil)
+
+func (d *tracedPacketDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	return trace(ctx, d.tracer, d.name, addr, func(ctx context.Context) (net.Conn, error) {
+		return d.dial(ctx, addr)
+	})
+}
+
+// Capabilities implements [transport.CapabilityReporter] with the capabilities of the dialer.
+func (d *tracedPacketDialer) Capabilities() transport.Capability {
+	return transport.Capabilities(d.dialer)
+}
+
+// Ping implements [transport.Pinger] by pinging the dialer.
+func (d *tracedPacketDialer) Ping(ctx context.Context) (time.Duration, error) {
+	return transport.Ping(ctx, d.dialer)
+}
+
+// tracedNetDialer returns a copy of dialer that ends a "dns" span and starts a "connect" span when the first
+// connection attempt starts, which is after the resolution. The returned dialer must be used once.
+func tracedNetDialer(ctx context.Context, tracer Tracer, dialer *net.Dialer, addr string) *tracedDialer {
+	d := &tracedDialer{Dialer: *dialer, ctx: ctx, tracer: tracer, addr: addr}
+	if host, _, err := net.SplitHostPort(addr); err == nil && net.ParseIP(host) == nil {
+		_, d.dnsSpan = tracer.Start(ctx, "dns", Attribute{Key: "host", Value: host})
+	}
+	control := dialer.ControlContext
+	if control == nil && dialer.Control != nil {
+		control = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+			return dialer.Control(network, address, c)
+		}
+	}
+	d.Dialer.Control = nil
+	d.Dialer.ControlContext = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+		d.startConnect()
+		if control != nil {
+			return control(ctx, network, address, c)
+		}
+		return nil
+	}
+	return d
+}
+
+type tracedDialer struct {
+	net.Dialer
+	ctx    context.Context
+	tracer Tracer
+	addr   string
+
+	once        sync.Once
+	dnsSpan     Span
+	connectSpan Span
+}
+
+func (d *tracedDialer) startConnect() {
+	d.once.Do(func() {
+		if d.dnsSpan != nil {
+			d.dnsSpan.End()
+		}
+		_, d.connectSpan = d.tracer.Start(d.ctx, "connect", Attribute{Key: "address", Value: d.addr})
+	})
+}
+
+// DialContext dials with the spans. Failures before any attempt, like resolution errors, are recorded in the "dns"
+// span, and later ones in the "connect" span.
+func (d *tracedDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.DialContext(ctx, network, address)
+	var span Span
+	d.once.Do(func() {
+		// No connection was attempted.
+		span = d.dnsSpan
+	})
+	if span == nil {
+		span = d.connectSpan
+	}
+	if span != nil {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+	return conn, err
+}
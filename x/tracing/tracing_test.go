@@ -0,0 +1,235 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedSpan struct {
+	name   string
+	parent string
+	err    error
+	ended  bool
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type spanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name}
+	if parent != nil {
+		span.parent = parent.name
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), &recordingSpan{tracer: t, span: span}
+}
+
+// tree returns "name<parent" for each span, in start order.
+func (t *recordingTracer) tree() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tree := make([]string, len(t.spans))
+	for i, span := range t.spans {
+		tree[i] = span.name + "<" + span.parent
+	}
+	return tree
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	span   *recordedSpan
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.err = err
+}
+
+func (s *recordingSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.ended = true
+}
+
+func listen(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestWithTracer(t *testing.T) {
+	require.Nil(t, TracerFromContext(context.Background()))
+	tracer := &recordingTracer{}
+	require.Equal(t, tracer, TracerFromContext(WithTracer(context.Background(), tracer)))
+}
+
+func TestTCPDialer_HostName(t *testing.T) {
+	_, port, err := net.SplitHostPort(listen(t))
+	require.NoError(t, err)
+	tracer := &recordingTracer{}
+	dialer, err := NewTCPDialer(tracer, &transport.TCPDialer{})
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Skipf("localhost doesn't resolve to 127.0.0.1: %v", err)
+	}
+	conn.Close()
+	require.Equal(t, []string{"tcp<", "dns<tcp", "connect<tcp"}, tracer.tree())
+	for _, span := range tracer.spans {
+		require.True(t, span.ended, span.name)
+		require.NoError(t, span.err, span.name)
+	}
+}
+
+func TestTCPDialer_IP(t *testing.T) {
+	tracer := &recordingTracer{}
+	dialer, err := NewTCPDialer(tracer, &transport.TCPDialer{})
+	require.NoError(t, err)
+	conn, err := dialer.DialStream(context.Background(), listen(t))
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, []string{"tcp<", "connect<tcp"}, tracer.tree())
+}
+
+func TestTCPDialer_ResolutionError(t *testing.T) {
+	tracer := &recordingTracer{}
+	dialer, err := NewTCPDialer(tracer, &transport.TCPDialer{})
+	require.NoError(t, err)
+	_, err = dialer.DialStream(context.Background(), "invalid.invalid:443")
+	require.Error(t, err)
+	require.Equal(t, []string{"tcp<", "dns<tcp"}, tracer.tree())
+	require.Error(t, tracer.spans[0].err)
+	require.Error(t, tracer.spans[1].err)
+	require.True(t, tracer.spans[1].ended)
+}
+
+func TestStreamDialer_Nested(t *testing.T) {
+	tracer := &recordingTracer{}
+	inner, err := NewTCPDialer(tracer, &transport.TCPDialer{})
+	require.NoError(t, err)
+	outer, err := NewStreamDialer(tracer, "proxy", inner)
+	require.NoError(t, err)
+	root, err := NewStreamDialer(tracer, "DialStream", outer)
+	require.NoError(t, err)
+	conn, err := root.DialStream(context.Background(), listen(t))
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, []string{"DialStream<", "proxy<DialStream", "tcp<proxy", "connect<tcp"}, tracer.tree())
+}
+
+// zeroRTTDialer is a dialer with the optional interfaces that wrappers must forward.
+type zeroRTTDialer struct {
+	transport.StreamDialer
+	written []byte
+}
+
+func (d *zeroRTTDialer) DialAndWrite(ctx context.Context, addr string, data []byte) (transport.StreamConn, error) {
+	d.written = data
+	return d.DialStream(ctx, addr)
+}
+
+func (d *zeroRTTDialer) Capabilities() transport.Capability {
+	return transport.CapabilityStream | transport.CapabilityRemoteDNS | transport.CapabilityZeroRTT
+}
+
+func (d *zeroRTTDialer) Ping(ctx context.Context) (time.Duration, error) {
+	return time.Millisecond, nil
+}
+
+func TestStreamDialer_OptionalInterfaces(t *testing.T) {
+	tracer := &recordingTracer{}
+	base := &zeroRTTDialer{StreamDialer: &transport.TCPDialer{}}
+	dialer, err := NewStreamDialer(tracer, "proxy", base)
+	require.NoError(t, err)
+
+	require.Equal(t, base.Capabilities(), transport.Capabilities(dialer))
+	rtt, err := transport.Ping(context.Background(), dialer)
+	require.NoError(t, err)
+	require.Equal(t, time.Millisecond, rtt)
+
+	conn, err := transport.DialAndWrite(context.Background(), dialer, listen(t), []byte("hello"))
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, []byte("hello"), base.written)
+	require.Equal(t, []string{"proxy<"}, tracer.tree())
+}
+
+func TestStreamDialer_NoOptionalInterfaces(t *testing.T) {
+	dialer, err := NewStreamDialer(&recordingTracer{}, "proxy", transport.FuncStreamDialer(
+		func(ctx context.Context, addr string) (transport.StreamConn, error) {
+			return nil, errors.New("not used")
+		}))
+	require.NoError(t, err)
+	require.Equal(t, transport.CapabilityStream, transport.Capabilities(dialer))
+	_, err = transport.Ping(context.Background(), dialer)
+	require.ErrorIs(t, err, transport.ErrPingUnsupported)
+}
+
+func TestPacketDialer_Error(t *testing.T) {
+	tracer := &recordingTracer{}
+	dialErr := errors.New("failed")
+	dialer, err := NewPacketDialer(tracer, "fail", transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return nil, dialErr
+	}))
+	require.NoError(t, err)
+	_, err = dialer.DialPacket(context.Background(), "127.0.0.1:53")
+	require.ErrorIs(t, err, dialErr)
+	require.Equal(t, []string{"fail<"}, tracer.tree())
+	require.Equal(t, dialErr, tracer.spans[0].err)
+}
+
+func TestUDPDialer(t *testing.T) {
+	tracer := &recordingTracer{}
+	dialer, err := NewUDPDialer(tracer, &transport.UDPDialer{})
+	require.NoError(t, err)
+	conn, err := dialer.DialPacket(context.Background(), "127.0.0.1:53")
+	require.NoError(t, err)
+	conn.Close()
+	require.Equal(t, []string{"udp<", "connect<udp"}, tracer.tree())
+}
+
+func TestNew_NilArguments(t *testing.T) {
+	_, err := NewStreamDialer(nil, "x", &transport.TCPDialer{})
+	require.Error(t, err)
+	_, err = NewTCPDialer(&recordingTracer{}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vpn
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// maxPendingQueries bounds the queries remembered by a DNS session to restore the source of their responses.
+const maxPendingQueries = 256
+
+// newDNSStreamDialer returns a dialer that sends the connections to port 53 to the DNS server.
+func newDNSStreamDialer(server netip.AddrPort, dialer transport.StreamDialer) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		if _, port, err := net.SplitHostPort(addr); err == nil && port == "53" {
+			addr = server.String()
+		}
+		return dialer.DialStream(ctx, addr)
+	})
+}
+
+// dnsPacketProxy sends the packets to port 53 to the DNS server, and makes the responses look like they come from
+// the original destination, which the clients expect.
+type dnsPacketProxy struct {
+	server netip.AddrPort
+	proxy  network.PacketProxy
+}
+
+var _ network.PacketProxy = (*dnsPacketProxy)(nil)
+
+func newDNSPacketProxy(server netip.AddrPort, proxy network.PacketProxy) network.PacketProxy {
+	return &dnsPacketProxy{server: netip.AddrPortFrom(server.Addr().Unmap(), server.Port()), proxy: proxy}
+}
+
+// NewSession implements [network.PacketProxy].NewSession.
+func (p *dnsPacketProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	receiver := &dnsResponseReceiver{PacketResponseReceiver: respWriter, server: p.server}
+	sender, err := p.proxy.NewSession(receiver)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsRequestSender{PacketRequestSender: sender, receiver: receiver}, nil
+}
+
+type dnsRequestSender struct {
+	network.PacketRequestSender
+	receiver *dnsResponseReceiver
+}
+
+// WriteTo implements [network.PacketRequestSender].WriteTo.
+func (s *dnsRequestSender) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	if destination.Port() == 53 && len(p) >= 2 {
+		s.receiver.addQuery(binary.BigEndian.Uint16(p), destination)
+		destination = s.receiver.server
+	}
+	return s.PacketRequestSender.WriteTo(p, destination)
+}
+
+type dnsResponseReceiver struct {
+	network.PacketResponseReceiver
+	server netip.AddrPort
+
+	mu sync.Mutex
+	// destinations maps the IDs of the pending queries to their original destinations.
+	destinations map[uint16]netip.AddrPort
+}
+
+func (r *dnsResponseReceiver) addQuery(id uint16, destination netip.AddrPort) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.destinations == nil || len(r.destinations) >= maxPendingQueries {
+		// Drop the queries that never got a response.
+		r.destinations = make(map[uint16]netip.AddrPort)
+	}
+	r.destinations[id] = destination
+}
+
+// WriteFrom implements [network.PacketResponseReceiver].WriteFrom.
+func (r *dnsResponseReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	if udpAddr, ok := source.(*net.UDPAddr); ok && len(p) >= 2 {
+		sourceAddrPort := udpAddr.AddrPort()
+		if netip.AddrPortFrom(sourceAddrPort.Addr().Unmap(), sourceAddrPort.Port()) == r.server {
+			id := binary.BigEndian.Uint16(p)
+			r.mu.Lock()
+			destination, found := r.destinations[id]
+			delete(r.destinations, id)
+			r.mu.Unlock()
+			if found {
+				source = net.UDPAddrFromAddrPort(destination)
+			}
+		}
+	}
+	return r.PacketResponseReceiver.WriteFrom(p, source)
+}
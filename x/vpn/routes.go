@@ -0,0 +1,159 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vpn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// newExcludedRoutesStreamDialer returns a dialer that dials the excluded destinations with direct, and the others
+// with tunnel.
+func newExcludedRoutesStreamDialer(options *Options, direct, tunnel transport.StreamDialer) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		if addrPort, err := netip.ParseAddrPort(addr); err == nil && options.isExcluded(addrPort.Addr()) {
+			return direct.DialStream(ctx, addr)
+		}
+		return tunnel.DialStream(ctx, addr)
+	})
+}
+
+// Indices of the sessions of an excludedRoutesSession.
+const (
+	routeDirect = iota
+	routeTunnel
+	numRoutes
+)
+
+// excludedRoutesPacketProxy sends the packets to the excluded destinations with direct, and the others with tunnel.
+type excludedRoutesPacketProxy struct {
+	options *Options
+	proxies [numRoutes]network.PacketProxy
+}
+
+var _ network.PacketProxy = (*excludedRoutesPacketProxy)(nil)
+
+func newExcludedRoutesPacketProxy(options *Options, direct, tunnel network.PacketProxy) network.PacketProxy {
+	return &excludedRoutesPacketProxy{options: options, proxies: [numRoutes]network.PacketProxy{direct, tunnel}}
+}
+
+// NewSession implements [network.PacketProxy].NewSession. The sessions of the routes are created on the first packet.
+func (p *excludedRoutesPacketProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	return &excludedRoutesSession{proxy: p, respWriter: respWriter}, nil
+}
+
+type excludedRoutesSession struct {
+	proxy      *excludedRoutesPacketProxy
+	respWriter network.PacketResponseReceiver
+
+	mu        sync.Mutex
+	closed    bool
+	senders   [numRoutes]network.PacketRequestSender
+	receivers [numRoutes]*routeReceiver
+}
+
+// WriteTo implements [network.PacketRequestSender].WriteTo.
+func (s *excludedRoutesSession) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	route := routeTunnel
+	if s.proxy.options.isExcluded(destination.Addr()) {
+		route = routeDirect
+	}
+	sender, err := s.sender(route)
+	if err != nil {
+		return 0, err
+	}
+	return sender.WriteTo(p, destination)
+}
+
+func (s *excludedRoutesSession) sender(route int) (network.PacketRequestSender, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, network.ErrClosed
+	}
+	if s.senders[route] != nil {
+		return s.senders[route], nil
+	}
+	receiver := &routeReceiver{session: s, route: route}
+	sender, err := s.proxy.proxies[route].NewSession(receiver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	s.senders[route], s.receivers[route] = sender, receiver
+	return sender, nil
+}
+
+// Close implements [network.PacketRequestSender].Close. It closes the sessions of the routes and the receiver.
+func (s *excludedRoutesSession) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return network.ErrClosed
+	}
+	s.closed = true
+	senders, receivers := s.senders, s.receivers
+	s.mu.Unlock()
+
+	var errs []error
+	for route, sender := range senders {
+		if sender == nil {
+			continue
+		}
+		receivers[route].closed.Store(true)
+		if err := sender.Close(); err != nil && !errors.Is(err, network.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	if err := s.respWriter.Close(); err != nil && !errors.Is(err, network.ErrClosed) {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// routeReceiver forwards the responses of the session of a route. Closing it only ends the session of the route.
+type routeReceiver struct {
+	session *excludedRoutesSession
+	route   int
+	closed  atomic.Bool
+}
+
+// WriteFrom implements [network.PacketResponseReceiver].WriteFrom.
+func (r *routeReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	if r.closed.Load() {
+		return 0, network.ErrClosed
+	}
+	return r.session.respWriter.WriteFrom(p, source)
+}
+
+// Close implements [network.PacketResponseReceiver].Close. The next packet to the route creates a new session.
+func (r *routeReceiver) Close() error {
+	if !r.closed.CompareAndSwap(false, true) {
+		return network.ErrClosed
+	}
+	r.session.mu.Lock()
+	defer r.session.mu.Unlock()
+	if r.session.receivers[r.route] == r {
+		r.session.senders[r.route], r.session.receivers[r.route] = nil, nil
+	}
+	return nil
+}
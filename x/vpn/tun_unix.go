@@ -0,0 +1,40 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package vpn
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// StartTunnel starts forwarding the IP packets of the TUN file descriptor through the transport config, until
+// [Tunnel.Stop] is called. The tunnel takes ownership of the file descriptor, and closes it when stopped.
+// Only one tunnel can run at a time, so starting a new one stops the packet handling of the previous one.
+func StartTunnel(fd int, transportConfig string, options *Options) (*Tunnel, error) {
+	// Use non-blocking mode, so that closing the file interrupts the pending reads.
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		return nil, fmt.Errorf("failed to set non-blocking mode: %w", err)
+	}
+	tun := os.NewFile(uintptr(fd), "tun")
+	t, err := newTunnel(tun, transportConfig, options)
+	if err != nil {
+		tun.Close()
+		return nil, err
+	}
+	return t, nil
+}
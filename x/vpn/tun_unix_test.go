@@ -0,0 +1,115 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package vpn
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// makeUDPPacket returns an IPv4 UDP packet, without UDP checksum.
+func makeUDPPacket(source, destination netip.AddrPort, payload []byte) []byte {
+	packet := make([]byte, 28, 28+len(payload))
+	packet[0] = 0x45
+	binary.BigEndian.PutUint16(packet[2:], uint16(28+len(payload)))
+	packet[8] = 64
+	packet[9] = syscall.IPPROTO_UDP
+	src, dst := source.Addr().As4(), destination.Addr().As4()
+	copy(packet[12:], src[:])
+	copy(packet[16:], dst[:])
+	var sum uint32
+	for i := 0; i < 20; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(packet[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	binary.BigEndian.PutUint16(packet[10:], ^uint16(sum))
+	binary.BigEndian.PutUint16(packet[20:], source.Port())
+	binary.BigEndian.PutUint16(packet[22:], destination.Port())
+	binary.BigEndian.PutUint16(packet[24:], uint16(8+len(payload)))
+	return append(packet, payload...)
+}
+
+func TestStartTunnel_DNSInterception(t *testing.T) {
+	resolver, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer resolver.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		n, addr, err := resolver.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		resolver.WriteTo(append(buf[:n:n], []byte(" answer")...), addr)
+	}()
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	require.NoError(t, err)
+	app := os.NewFile(uintptr(fds[0]), "app")
+	defer app.Close()
+	options := NewOptions()
+	options.DNSServer = resolver.LocalAddr().String()
+	tunnel, err := StartTunnel(fds[1], "", options)
+	require.NoError(t, err)
+
+	client := netip.MustParseAddrPort("10.111.222.1:5000")
+	query := []byte{0xab, 0xcd, 'q'}
+	_, err = app.Write(makeUDPPacket(client, netip.MustParseAddrPort("8.8.8.8:53"), query))
+	require.NoError(t, err)
+	app.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, err := app.Read(buf)
+	require.NoError(t, err)
+	response := buf[:n]
+	require.GreaterOrEqual(t, len(response), 28)
+	// The response comes from the original destination.
+	require.Equal(t, []byte{8, 8, 8, 8}, response[12:16])
+	require.Equal(t, uint16(53), binary.BigEndian.Uint16(response[20:]))
+	require.Equal(t, uint16(5000), binary.BigEndian.Uint16(response[22:]))
+	require.Equal(t, "\xab\xcdq answer", string(response[28:]))
+
+	require.NoError(t, tunnel.SetTransport("split:2"))
+	require.Error(t, tunnel.SetTransport("unknown:"))
+
+	require.NoError(t, tunnel.Stop())
+	tunnel.Wait()
+	require.NoError(t, tunnel.Stop())
+}
+
+func TestStartTunnel_Errors(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	require.NoError(t, err)
+	defer syscall.Close(fds[0])
+	_, err = StartTunnel(fds[1], "unknown:", nil)
+	require.Error(t, err)
+	// The file descriptor was closed.
+	_, err = syscall.Write(fds[1], []byte{1})
+	require.Error(t, err)
+
+	options := NewOptions()
+	options.DNSServer = "dns.google:53"
+	_, err = newTunnel(nil, "", options)
+	require.Error(t, err)
+}
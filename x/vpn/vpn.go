@@ -0,0 +1,210 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package vpn connects the TUN device of a system VPN, like the one created by Android's VpnService, to the transports
+of a config, so VPN apps don't need to write the glue themselves. It's suitable for use with Go Mobile.
+
+A [Tunnel] reads the IP packets from the TUN file descriptor, terminates TCP and UDP with the
+[github.com/Jigsaw-Code/outline-sdk/network/lwip2transport] device, and sends the traffic through the transport
+config, as in [github.com/Jigsaw-Code/outline-sdk/x/configurl]. If the transport doesn't support UDP, DNS queries
+over UDP get truncated responses, so resolvers retry over TCP. The [Options] can send all the DNS queries to a
+resolver of choice, and exclude routes from the tunnel.
+
+On Android, create the TUN device with VpnService.Builder and pass the detached file descriptor:
+
+	val pfd = builder.addAddress("10.111.222.1", 24).addRoute("0.0.0.0", 0).establish()
+	val options = Vpn.newOptions().apply { dnsServer = "9.9.9.9:53" }
+	val tunnel = Vpn.startTunnel(pfd.detachFd().toLong(), transportConfig, options)
+	// ...
+	tunnel.stop()
+
+The connections of the transports are sockets of the app, so the app must keep them out of the VPN, for instance
+with VpnService.Builder.addDisallowedApplication for its own package, or they will loop back into the tunnel.
+*/
+package vpn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/Jigsaw-Code/outline-sdk/network/dnstruncate"
+	"github.com/Jigsaw-Code/outline-sdk/network/lwip2transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+)
+
+var configModule = configurl.NewDefaultProviders()
+
+// Options configures a [Tunnel]. Create them with [NewOptions].
+type Options struct {
+	// DNSServer, if not empty, is the IP:port address of the resolver that receives all the DNS queries over port 53,
+	// through the tunnel, regardless of their destination. This prevents the DNS leaks of resolvers configured
+	// outside of the VPN.
+	DNSServer string
+
+	excludedRoutes []netip.Prefix
+}
+
+// NewOptions returns the default options.
+func NewOptions() *Options {
+	return &Options{}
+}
+
+// AddExcludedRoute excludes the destinations in the CIDR, like "192.168.0.0/16", from the tunnel. Their traffic goes
+// directly to the network instead. Routes excluded in VpnService.Builder never reach the TUN device, so this is only
+// needed for routes that the system can't exclude.
+func (o *Options) AddExcludedRoute(cidr string) error {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid route %q: %w", cidr, err)
+	}
+	o.excludedRoutes = append(o.excludedRoutes, prefix.Masked())
+	return nil
+}
+
+// isExcluded reports whether the address is in one of the excluded routes.
+func (o *Options) isExcluded(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range o.excludedRoutes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tunnel forwards the traffic of a TUN device through a transport.
+type Tunnel struct {
+	tun    io.ReadWriteCloser
+	device network.IPDevice
+	// tunnelDialer is the dialer of the current transport, which can be replaced with SetTransport.
+	tunnelDialer atomic.Pointer[transport.StreamDialer]
+	tunnelProxy  network.DelegatePacketProxy
+
+	stopOnce sync.Once
+	stopErr  error
+	done     chan struct{}
+}
+
+func newTunnel(tun io.ReadWriteCloser, transportConfig string, options *Options) (*Tunnel, error) {
+	if options == nil {
+		options = NewOptions()
+	}
+	var dnsServer netip.AddrPort
+	if options.DNSServer != "" {
+		var err error
+		if dnsServer, err = netip.ParseAddrPort(options.DNSServer); err != nil {
+			return nil, fmt.Errorf("DNS server must be an IP:port address: %w", err)
+		}
+	}
+	t := &Tunnel{tun: tun, done: make(chan struct{})}
+	sd, pp, err := newTunnelTransport(transportConfig)
+	if err != nil {
+		return nil, err
+	}
+	t.tunnelDialer.Store(&sd)
+	if t.tunnelProxy, err = network.NewDelegatePacketProxy(pp); err != nil {
+		return nil, err
+	}
+
+	var streamDialer transport.StreamDialer = transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		return (*t.tunnelDialer.Load()).DialStream(ctx, addr)
+	})
+	var packetProxy network.PacketProxy = t.tunnelProxy
+	if len(options.excludedRoutes) > 0 {
+		directProxy, err := network.NewPacketProxyFromPacketListener(&transport.UDPListener{})
+		if err != nil {
+			return nil, err
+		}
+		streamDialer = newExcludedRoutesStreamDialer(options, &transport.TCPDialer{}, streamDialer)
+		packetProxy = newExcludedRoutesPacketProxy(options, directProxy, packetProxy)
+	}
+	if dnsServer.IsValid() {
+		streamDialer = newDNSStreamDialer(dnsServer, streamDialer)
+		packetProxy = newDNSPacketProxy(dnsServer, packetProxy)
+	}
+	if t.device, err = lwip2transport.ConfigureDevice(streamDialer, packetProxy); err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(t.device, tun)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(tun, t.device)
+	}()
+	go func() {
+		wg.Wait()
+		close(t.done)
+	}()
+	return t, nil
+}
+
+// newTunnelTransport creates the dialer and packet proxy of the transport config. If the config doesn't support
+// UDP, the packet proxy truncates the DNS responses, so they are retried over TCP.
+func newTunnelTransport(transportConfig string) (transport.StreamDialer, network.PacketProxy, error) {
+	sd, err := configModule.NewStreamDialer(context.Background(), transportConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create stream dialer: %w", err)
+	}
+	var pp network.PacketProxy
+	if pl, err := configModule.NewPacketListener(context.Background(), transportConfig); err == nil {
+		pp, err = network.NewPacketProxyFromPacketListener(pl)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create packet proxy: %w", err)
+		}
+	} else if pp, err = dnstruncate.NewPacketProxy(); err != nil {
+		return nil, nil, fmt.Errorf("failed to create DNS truncate proxy: %w", err)
+	}
+	return sd, pp, nil
+}
+
+// SetTransport switches the tunnel to a new transport config, for instance after finding a new strategy when the
+// network changes. The existing connections keep using the previous transport.
+func (t *Tunnel) SetTransport(transportConfig string) error {
+	sd, pp, err := newTunnelTransport(transportConfig)
+	if err != nil {
+		return err
+	}
+	if err := t.tunnelProxy.SetProxy(pp); err != nil {
+		return err
+	}
+	t.tunnelDialer.Store(&sd)
+	return nil
+}
+
+// Stop stops the tunnel and closes the TUN file descriptor. It's safe to call it multiple times.
+func (t *Tunnel) Stop() error {
+	t.stopOnce.Do(func() {
+		t.stopErr = errors.Join(t.device.Close(), t.tun.Close())
+	})
+	return t.stopErr
+}
+
+// Wait blocks until the tunnel stops, either because [Tunnel.Stop] was called or because the TUN device was closed.
+// Mobile apps should not call it from the UI thread.
+func (t *Tunnel) Wait() {
+	<-t.done
+}
@@ -0,0 +1,147 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vpn
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/network"
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions_AddExcludedRoute(t *testing.T) {
+	options := NewOptions()
+	require.NoError(t, options.AddExcludedRoute("192.168.1.7/16"))
+	require.NoError(t, options.AddExcludedRoute("fd00::/8"))
+	require.Error(t, options.AddExcludedRoute("192.168.0.0"))
+	require.True(t, options.isExcluded(netip.MustParseAddr("192.168.20.1")))
+	require.True(t, options.isExcluded(netip.MustParseAddr("::ffff:192.168.20.1")))
+	require.True(t, options.isExcluded(netip.MustParseAddr("fd12::1")))
+	require.False(t, options.isExcluded(netip.MustParseAddr("8.8.8.8")))
+}
+
+// recordingPacketProxy records the destinations of the packets, and keeps the receivers of its sessions.
+type recordingPacketProxy struct {
+	mu           sync.Mutex
+	destinations []netip.AddrPort
+	receivers    []network.PacketResponseReceiver
+}
+
+func (p *recordingPacketProxy) NewSession(respWriter network.PacketResponseReceiver) (network.PacketRequestSender, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.receivers = append(p.receivers, respWriter)
+	return &recordingSender{proxy: p}, nil
+}
+
+type recordingSender struct {
+	proxy *recordingPacketProxy
+}
+
+func (s *recordingSender) WriteTo(p []byte, destination netip.AddrPort) (int, error) {
+	s.proxy.mu.Lock()
+	defer s.proxy.mu.Unlock()
+	s.proxy.destinations = append(s.proxy.destinations, destination)
+	return len(p), nil
+}
+
+func (s *recordingSender) Close() error {
+	return nil
+}
+
+// recordingReceiver records the sources of the responses.
+type recordingReceiver struct {
+	sources []string
+	closed  bool
+}
+
+func (r *recordingReceiver) WriteFrom(p []byte, source net.Addr) (int, error) {
+	r.sources = append(r.sources, source.String())
+	return len(p), nil
+}
+
+func (r *recordingReceiver) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestDNSPacketProxy(t *testing.T) {
+	server := netip.MustParseAddrPort("9.9.9.9:53")
+	base := &recordingPacketProxy{}
+	receiver := &recordingReceiver{}
+	sender, err := newDNSPacketProxy(server, base).NewSession(receiver)
+	require.NoError(t, err)
+
+	_, err = sender.WriteTo([]byte{0x12, 0x34, 0}, netip.MustParseAddrPort("192.168.1.1:53"))
+	require.NoError(t, err)
+	_, err = sender.WriteTo([]byte{0x56, 0x78, 0}, netip.MustParseAddrPort("8.8.8.8:443"))
+	require.NoError(t, err)
+	require.Equal(t, []netip.AddrPort{server, netip.MustParseAddrPort("8.8.8.8:443")}, base.destinations)
+
+	// The response appears to come from the original destination.
+	_, err = base.receivers[0].WriteFrom([]byte{0x12, 0x34, 0}, net.UDPAddrFromAddrPort(server))
+	require.NoError(t, err)
+	// Unknown responses keep their source.
+	_, err = base.receivers[0].WriteFrom([]byte{0x12, 0x34, 0}, net.UDPAddrFromAddrPort(server))
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.168.1.1:53", "9.9.9.9:53"}, receiver.sources)
+}
+
+func TestDNSStreamDialer(t *testing.T) {
+	var dialed []string
+	base := transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		dialed = append(dialed, addr)
+		return nil, os.ErrNotExist
+	})
+	dialer := newDNSStreamDialer(netip.MustParseAddrPort("[2620:fe::fe]:53"), base)
+	dialer.DialStream(context.Background(), "192.168.1.1:53")
+	dialer.DialStream(context.Background(), "192.168.1.1:853")
+	require.Equal(t, []string{"[2620:fe::fe]:53", "192.168.1.1:853"}, dialed)
+}
+
+func TestExcludedRoutesPacketProxy(t *testing.T) {
+	options := NewOptions()
+	require.NoError(t, options.AddExcludedRoute("192.168.0.0/16"))
+	direct, tunnel := &recordingPacketProxy{}, &recordingPacketProxy{}
+	receiver := &recordingReceiver{}
+	sender, err := newExcludedRoutesPacketProxy(options, direct, tunnel).NewSession(receiver)
+	require.NoError(t, err)
+
+	for _, destination := range []string{"192.168.1.1:53", "8.8.8.8:53", "192.168.1.2:53"} {
+		_, err = sender.WriteTo([]byte{1}, netip.MustParseAddrPort(destination))
+		require.NoError(t, err)
+	}
+	require.Equal(t, []netip.AddrPort{netip.MustParseAddrPort("192.168.1.1:53"), netip.MustParseAddrPort("192.168.1.2:53")}, direct.destinations)
+	require.Equal(t, []netip.AddrPort{netip.MustParseAddrPort("8.8.8.8:53")}, tunnel.destinations)
+	require.Len(t, direct.receivers, 1)
+
+	// Closing the receiver of a route creates a new session on the next packet.
+	require.NoError(t, direct.receivers[0].Close())
+	_, err = sender.WriteTo([]byte{1}, netip.MustParseAddrPort("192.168.1.1:53"))
+	require.NoError(t, err)
+	require.Len(t, direct.receivers, 2)
+	require.False(t, receiver.closed)
+
+	require.NoError(t, sender.Close())
+	require.True(t, receiver.closed)
+	_, err = sender.WriteTo([]byte{1}, netip.MustParseAddrPort("8.8.8.8:53"))
+	require.ErrorIs(t, err, network.ErrClosed)
+}
@@ -48,6 +48,8 @@ func NewPacketEndpoint(urlStr string, se transport.StreamEndpoint, opts ...Optio
 type options struct {
 	tlsConfig *tls.Config
 	headers   http.Header
+	host      string
+	sni       string
 }
 
 // Option for building the Websocket endpoint.
@@ -68,8 +70,40 @@ func WithHTTPHeaders(headers http.Header) Option {
 	}
 }
 
+// WithHost sets the HTTP Host header sent in the Websocket handshake, overriding the host in the URL.
+// Combined with [WithSNI], it allows for domain fronting, where the TLS SNI carries a front domain
+// and the Host header carries the real host served by the same CDN.
+func WithHost(host string) Option {
+	return func(c *options) {
+		c.host = host
+	}
+}
+
+// WithSNI sets the TLS server name to send in the handshake, overriding the host in the URL.
+// It requires a wss URL.
+func WithSNI(sni string) Option {
+	return func(c *options) {
+		c.sni = sni
+	}
+}
+
+// validateHostname checks that name is a bare host name, optionally with a port, and nothing else.
+func validateHostname(name string) error {
+	if name == "" {
+		return errors.New("name must not be empty")
+	}
+	u, err := url.Parse("//" + name)
+	if err != nil {
+		return err
+	}
+	if u.Host != name {
+		return fmt.Errorf("%q is not a valid host", name)
+	}
+	return nil
+}
+
 func newEndpoint[ConnType net.Conn](urlStr string, se transport.StreamEndpoint, wsToConn func(*gorillaConn) ConnType, opts ...Option) (func(context.Context) (ConnType, error), error) {
-	_, err := url.Parse(urlStr)
+	wsURL, err := url.Parse(urlStr)
 	if err != nil {
 		return nil, fmt.Errorf("url is invalid: %w", err)
 	}
@@ -81,6 +115,34 @@ func newEndpoint[ConnType net.Conn](urlStr string, se transport.StreamEndpoint,
 	for _, opt := range opts {
 		opt(&resolvedOpts)
 	}
+	if resolvedOpts.host != "" {
+		if err := validateHostname(resolvedOpts.host); err != nil {
+			return nil, fmt.Errorf("invalid host option: %w", err)
+		}
+		// Gorilla uses the Host entry of the request headers as the request Host.
+		headers := make(http.Header, len(resolvedOpts.headers)+1)
+		for key, values := range resolvedOpts.headers {
+			headers[key] = values
+		}
+		headers.Set("Host", resolvedOpts.host)
+		resolvedOpts.headers = headers
+	}
+	if resolvedOpts.sni != "" {
+		if wsURL.Scheme != "wss" {
+			return nil, fmt.Errorf("SNI option requires wss scheme, got %v", wsURL.Scheme)
+		}
+		if err := validateHostname(resolvedOpts.sni); err != nil {
+			return nil, fmt.Errorf("invalid SNI option: %w", err)
+		}
+		var tlsConfig *tls.Config
+		if resolvedOpts.tlsConfig != nil {
+			tlsConfig = resolvedOpts.tlsConfig.Clone()
+		} else {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.ServerName = resolvedOpts.sni
+		resolvedOpts.tlsConfig = tlsConfig
+	}
 
 	wsDialer := &websocket.Dialer{
 		TLSClientConfig: resolvedOpts.tlsConfig,
@@ -161,3 +161,60 @@ func Test_NewPacketEndpoint(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte("Response"), buf[:n])
 }
+
+func Test_DomainFronting(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tcp", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "example.com", r.TLS.ServerName)
+		require.Equal(t, "real.example", r.Host)
+		clientConn, err := Upgrade(w, r, http.Header{})
+		require.NoError(t, err)
+		clientConn.Close()
+	})
+	ts := httptest.NewTLSServer(mux)
+	defer ts.Close()
+
+	client := ts.Client()
+	endpoint := &transport.TCPEndpoint{Address: ts.Listener.Addr().String()}
+	connect, err := NewStreamEndpoint("wss"+ts.URL[5:]+"/tcp", endpoint,
+		WithTLSConfig(client.Transport.(*http.Transport).TLSClientConfig),
+		WithSNI("example.com"),
+		WithHost("real.example"))
+	require.NoError(t, err)
+
+	conn, err := connect(context.Background())
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func Test_HostWithNilHeaders(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tcp", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "real.example", r.Host)
+		clientConn, err := Upgrade(w, r, http.Header{})
+		require.NoError(t, err)
+		clientConn.Close()
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	endpoint := &transport.TCPEndpoint{Address: ts.Listener.Addr().String()}
+	connect, err := NewStreamEndpoint("ws"+ts.URL[4:]+"/tcp", endpoint, WithHTTPHeaders(nil), WithHost("real.example"))
+	require.NoError(t, err)
+
+	conn, err := connect(context.Background())
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func Test_FrontingValidation(t *testing.T) {
+	endpoint := &transport.TCPEndpoint{Address: "127.0.0.1:443"}
+	_, err := NewStreamEndpoint("ws://example.com/tcp", endpoint, WithSNI("front.example"))
+	require.Error(t, err)
+	_, err = NewStreamEndpoint("wss://example.com/tcp", endpoint, WithSNI("front.example/path"))
+	require.Error(t, err)
+	_, err = NewStreamEndpoint("wss://example.com/tcp", endpoint, WithHost("user@real.example"))
+	require.Error(t, err)
+	_, err = NewStreamEndpoint("wss://example.com/tcp", endpoint, WithSNI("front.example"), WithHost("real.example:8443"))
+	require.NoError(t, err)
+}
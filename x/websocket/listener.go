@@ -0,0 +1,112 @@
+// Copyright 2025 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// Listener is a [net.Listener] that serves HTTP on the wrapped listener and accepts the WebSocket connections
+// upgraded on a path. It's the server-side counterpart of [NewStreamEndpoint] and [NewPacketEndpoint]: the accepted
+// connections carry a stream, or one packet per message, depending on the client.
+type Listener struct {
+	listener  net.Listener
+	server    *http.Server
+	accepted  chan transport.StreamConn
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+	closeErr  error
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// NewListener creates a [Listener] that accepts WebSocket connections on the path of the HTTP server it runs on
+// listener. Requests for other paths get a 404 response. Wrap the listener with TLS first to serve wss URLs.
+func NewListener(listener net.Listener, path string) (*Listener, error) {
+	if listener == nil {
+		return nil, errors.New("argument listener must not be nil")
+	}
+	if path == "" {
+		return nil, errors.New("path must not be empty")
+	}
+	l := &Listener{
+		listener: listener,
+		accepted: make(chan transport.StreamConn),
+		done:     make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, l.handleUpgrade)
+	l.server = &http.Server{Handler: mux}
+	go func() {
+		l.shutdown(l.server.Serve(listener))
+	}()
+	return l, nil
+}
+
+func (l *Listener) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	conn, err := Upgrade(w, r, http.Header{})
+	if err != nil {
+		// Upgrade already replied with an error.
+		return
+	}
+	select {
+	case l.accepted <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// Accept implements [net.Listener].Accept. It returns the next WebSocket connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	return l.AcceptStream()
+}
+
+// AcceptStream is like Accept, but returns a [transport.StreamConn].
+func (l *Listener) AcceptStream() (transport.StreamConn, error) {
+	select {
+	case conn := <-l.accepted:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Close implements [net.Listener].Close. It stops the HTTP server, but not the accepted connections.
+func (l *Listener) Close() error {
+	l.shutdown(net.ErrClosed)
+	return l.closeErr
+}
+
+// Addr implements [net.Listener].Addr.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *Listener) shutdown(err error) {
+	l.closeOnce.Do(func() {
+		if errors.Is(err, http.ErrServerClosed) {
+			err = net.ErrClosed
+		}
+		l.err = err
+		close(l.done)
+		l.closeErr = l.server.Close()
+	})
+}